@@ -142,8 +142,16 @@ type Configuration struct {
 		Broadcast           bool `default:"false"`
 		SpendZeroConfChange bool `default:"true"`
 	}
+	DB struct {
+		ChainStateBackend string `default:"leveldb"` // key-value engine of the chainstate database: leveldb or bolt
+		BlockIndexBackend string `default:"leveldb"` // key-value engine of the block index database: leveldb or bolt
+		WalletBackend     string `default:"leveldb"` // key-value engine of the wallet database: leveldb or bolt
+	}
 }
 
+// dbBackends are the key-value engines a database can be configured with.
+var dbBackends = []string{"leveldb", "bolt"}
+
 var (
 	Cfg     *Configuration
 	Args    *Opts
@@ -288,6 +296,22 @@ func InitConfig(args []string) *Configuration {
 		println("Error: Max generated block size (blockmaxsize) cannot exceed the excessive block size (excessiveblocksize)")
 		return nil
 	}
+	if opts.TxIndex && opts.Prune > 0 {
+		println("Error: Prune mode is incompatible with -txindex.")
+		return nil
+	}
+	if opts.AddressIndex && opts.Prune > 0 {
+		println("Error: Prune mode is incompatible with -addressindex.")
+		return nil
+	}
+	if opts.BlockFilterIndex && opts.Prune > 0 {
+		println("Error: Prune mode is incompatible with -blockfilterindex.")
+		return nil
+	}
+	if opts.PeerBlockFilters && !opts.BlockFilterIndex {
+		println("Error: Cannot set -peerblockfilters without -blockfilterindex.")
+		return nil
+	}
 	if len(opts.Whitelists) > 0 {
 		initWhitelists(config, opts)
 	}
@@ -303,10 +327,26 @@ func InitConfig(args []string) *Configuration {
 	if len(opts.AssumeValid) > 0 {
 		config.Chain.AssumeValid = opts.AssumeValid
 	}
+	for _, backend := range []string{config.DB.ChainStateBackend, config.DB.BlockIndexBackend, config.DB.WalletBackend} {
+		if !isDBBackend(backend) {
+			fmt.Printf("Error: Unknown database backend %q, supported backends are %s\n",
+				backend, strings.Join(dbBackends, ", "))
+			return nil
+		}
+	}
 
 	return config
 }
 
+func isDBBackend(backend string) bool {
+	for _, b := range dbBackends {
+		if backend == b {
+			return true
+		}
+	}
+	return false
+}
+
 func initWhitelists(config *Configuration, opts *Opts) {
 	var ip net.IP
 	config.P2PNet.Whitelists = make([]*net.IPNet, 0, len(opts.Whitelists))
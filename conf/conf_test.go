@@ -319,6 +319,11 @@ func getDefaultConfiguration(args defaultArgs) *Configuration {
 			Broadcast           bool `default:"false"`
 			SpendZeroConfChange bool `default:"true"`
 		}{Enable: false, Broadcast: false, SpendZeroConfChange: true},
+		DB: struct {
+			ChainStateBackend string `default:"leveldb"` // key-value engine of the chainstate database: leveldb or bolt
+			BlockIndexBackend string `default:"leveldb"` // key-value engine of the block index database: leveldb or bolt
+			WalletBackend     string `default:"leveldb"` // key-value engine of the wallet database: leveldb or bolt
+		}{ChainStateBackend: "leveldb", BlockIndexBackend: "leveldb", WalletBackend: "leveldb"},
 	}
 }
 
@@ -424,6 +429,10 @@ func TestInitConfig2(t *testing.T) {
 				UtxoHashEndHeight:   1,
 				Excessiveblocksize:  32000000,
 			})},
+		{[]string{"--datadir=/tmp/Coper", "--txindex", "--prune=550"}, nil},
+		{[]string{"--datadir=/tmp/Coper", "--addressindex", "--prune=550"}, nil},
+		{[]string{"--datadir=/tmp/Coper", "--blockfilterindex", "--prune=550"}, nil},
+		{[]string{"--datadir=/tmp/Coper", "--peerblockfilters"}, nil},
 	}
 	createTmpFile()
 	defer os.RemoveAll("/tmp/Coper")
@@ -9,8 +9,16 @@ import (
 type Opts struct {
 	ShowVersion bool `short:"V" long:"version" description:"Display version information and exit"`
 
-	DataDir string `long:"datadir" description:"specified program data dir"`
-	Reindex bool   `long:"reindex" description:"reindex"`
+	DataDir          string `long:"datadir" description:"specified program data dir"`
+	Reindex          bool   `long:"reindex" description:"reindex"`
+	DBCache          int64  `long:"dbcache" default:"450" description:"Set database cache size in MiB (4 to 16384)"`
+	Prune            uint64 `long:"prune" default:"0" description:"Reduce storage by pruning old blocks (0 = disabled, 1 = manual pruning via RPC, >=550 = target size in MiB for block and undo files)"`
+	TxIndex          bool   `long:"txindex" description:"Maintain a full transaction index, used by the getrawtransaction rpc call"`
+	AddressIndex     bool   `long:"addressindex" description:"Maintain an index of the transactions and unspent outputs of each scriptPubKey, used by the getaddress* rpc calls"`
+	SpentIndex       bool   `long:"spentindex" description:"Maintain an index of the inputs spending each outpoint, used by the getspentinfo rpc call (changing it requires -reindex)"`
+	BlockFilterIndex bool   `long:"blockfilterindex" description:"Maintain an index of the basic compact filters of the blocks (BIP158), used by the getblockfilter rpc call"`
+	PeerBlockFilters bool   `long:"peerblockfilters" description:"Serve compact block filters to peers per BIP157 (requires -blockfilterindex)"`
+	LoadSnapshot     string `long:"loadsnapshot" description:"Bootstrap an empty chain state from a UTXO snapshot written by dumptxoutset, whose base block must be known to the chain params. The blocks below the base block are then downloaded and validated in the background"`
 
 	// //Set -discover=0 in regtest framework
 	// Discover int  `long:"discover" default:"1" description:"Discover own IP addresses (default: 1 when listening and no -externalip or -proxy) "`
@@ -24,17 +32,25 @@ type Opts struct {
 	Excessiveblocksize uint64   `long:"excessiveblocksize" default:"32000000" description:"excessive block size"`
 	BanScore           uint32   `long:"banscore" default:"100" description:"Threshold for disconnecting misbehaving peers"`
 
-	ReplayProtectionActivationTime int64  `long:"replayprotectionactivationtime" default:"-1"`
-	MagneticAnomalyTime            int64  `long:"magneticanomalyactivationtime" default:"-1"`
-	StopAtHeight                   int32  `long:"stopatheight" default:"-1"`
-	PromiscuousMempoolFlags        string `long:"promiscuousmempoolflags"`
-	Limitancestorcount             int    `long:"limitancestorcount" default:"50000"`
-	BlockVersion                   int32  `long:"blockversion" default:"-1" description:"regtest block version"`
-	MaxMempool                     int64  `long:"maxmempool" default:"300000000"`
-	SpendZeroConfChange            uint8  `long:"spendzeroconfchange" default:"1"`
-	MaxTimeAdjustment              uint64 `long:"maxtimeadjustment" default:"4200" description:"Maximum allowed median peer time offset adjustment. Local perspective of time may be influenced by peers forward or backward by this amount."`
-	MinimumChainWork               string `long:"minimumchainwork"`
-	AssumeValid                    string `long:"assumevalid"`
+	ReplayProtectionActivationTime int64    `long:"replayprotectionactivationtime" default:"-1"`
+	MagneticAnomalyTime            int64    `long:"magneticanomalyactivationtime" default:"-1"`
+	GreatWallTime                  int64    `long:"greatwallactivationtime" default:"-1"`
+	GravitonTime                   int64    `long:"gravitonactivationtime" default:"-1"`
+	PhononTime                     int64    `long:"phononactivationtime" default:"-1"`
+	AxionTime                      int64    `long:"axionactivationtime" default:"-1"`
+	Upgrade8Time                   int64    `long:"upgrade8activationtime" default:"-1"`
+	Upgrade9Time                   int64    `long:"upgrade9activationtime" default:"-1"`
+	UpgradeActivations             []string `long:"upgradeactivation" description:"Override the activation height or time of an upgrade on regtest or testnet, as <upgrade>=<value>. May be repeated"`
+	RegTestPowRetargeting          bool     `long:"regtestpowretargeting" description:"Retarget difficulty on regtest, so ASERT can be exercised by mining blocks with manipulated timestamps"`
+	StopAtHeight                   int32    `long:"stopatheight" default:"-1"`
+	PromiscuousMempoolFlags        string   `long:"promiscuousmempoolflags"`
+	Limitancestorcount             int      `long:"limitancestorcount" default:"50000"`
+	BlockVersion                   int32    `long:"blockversion" default:"-1" description:"regtest block version"`
+	MaxMempool                     int64    `long:"maxmempool" default:"300000000"`
+	SpendZeroConfChange            uint8    `long:"spendzeroconfchange" default:"1"`
+	MaxTimeAdjustment              uint64   `long:"maxtimeadjustment" default:"4200" description:"Maximum allowed median peer time offset adjustment. Local perspective of time may be influenced by peers forward or backward by this amount."`
+	MinimumChainWork               string   `long:"minimumchainwork"`
+	AssumeValid                    string   `long:"assumevalid"`
 }
 
 func InitArgs(args []string) (*Opts, error) {
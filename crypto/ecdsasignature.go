@@ -11,6 +11,7 @@ const (
 	SigHashAll          = 1
 	SigHashNone         = 2
 	SigHashSingle       = 3
+	SigHashUtxos        = 0x20
 	SigHashForkID       = 0x40
 	SigHashAnyoneCanpay = 0x80
 
@@ -171,7 +172,7 @@ func IsDefineHashtypeSignature(vchSig []byte) bool {
 	if len(vchSig) == 0 {
 		return false
 	}
-	nHashType := vchSig[len(vchSig)-1] & (^byte(SigHashAnyoneCanpay | SigHashForkID))
+	nHashType := vchSig[len(vchSig)-1] & (^byte(SigHashAnyoneCanpay | SigHashForkID | SigHashUtxos))
 	if nHashType < SigHashAll || nHashType > SigHashSingle {
 		return false
 	}
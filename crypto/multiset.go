@@ -0,0 +1,228 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/copernet/copernicus/util"
+	"github.com/pkg/errors"
+)
+
+// MultiSetLen is the serialized size of a MultiSet: the 32-byte affine x and
+// y coordinates of its point, all zero for the empty set.
+const MultiSetLen = 64
+
+var (
+	curveB       = big.NewInt(7)
+	curveSqrtExp = new(big.Int).Rsh(new(big.Int).Add(curveP, big.NewInt(1)), 2)
+
+	errMultiSetLen   = errors.New("multiset must be 64 bytes")
+	errMultiSetPoint = errors.New("multiset is not a point on the curve")
+)
+
+// jacobianPoint is a secp256k1 point in jacobian coordinates, the point at
+// infinity is represented by z == 0.
+type jacobianPoint struct {
+	x, y, z *big.Int
+}
+
+func newAffinePoint(x, y *big.Int) *jacobianPoint {
+	return &jacobianPoint{x: new(big.Int).Set(x), y: new(big.Int).Set(y), z: big.NewInt(1)}
+}
+
+func (p *jacobianPoint) isInfinity() bool {
+	return p.z.Sign() == 0
+}
+
+func infinityPoint() *jacobianPoint {
+	return &jacobianPoint{x: big.NewInt(0), y: big.NewInt(1), z: big.NewInt(0)}
+}
+
+func mulMod(a, b *big.Int) *big.Int {
+	r := new(big.Int).Mul(a, b)
+	return r.Mod(r, curveP)
+}
+
+func subMod(a, b *big.Int) *big.Int {
+	r := new(big.Int).Sub(a, b)
+	return r.Mod(r, curveP)
+}
+
+func (p *jacobianPoint) double() *jacobianPoint {
+	if p.isInfinity() || p.y.Sign() == 0 {
+		return infinityPoint()
+	}
+	y2 := mulMod(p.y, p.y)
+	s := mulMod(big.NewInt(4), mulMod(p.x, y2))
+	m := mulMod(big.NewInt(3), mulMod(p.x, p.x))
+	x := subMod(mulMod(m, m), mulMod(big.NewInt(2), s))
+	y := subMod(mulMod(m, subMod(s, x)), mulMod(big.NewInt(8), mulMod(y2, y2)))
+	z := mulMod(big.NewInt(2), mulMod(p.y, p.z))
+	return &jacobianPoint{x: x, y: y, z: z}
+}
+
+func (p *jacobianPoint) add(q *jacobianPoint) *jacobianPoint {
+	if p.isInfinity() {
+		return q
+	}
+	if q.isInfinity() {
+		return p
+	}
+	pz2 := mulMod(p.z, p.z)
+	qz2 := mulMod(q.z, q.z)
+	u1 := mulMod(p.x, qz2)
+	u2 := mulMod(q.x, pz2)
+	s1 := mulMod(p.y, mulMod(qz2, q.z))
+	s2 := mulMod(q.y, mulMod(pz2, p.z))
+	if u1.Cmp(u2) == 0 {
+		if s1.Cmp(s2) != 0 {
+			return infinityPoint()
+		}
+		return p.double()
+	}
+	h := subMod(u2, u1)
+	r := subMod(s2, s1)
+	h2 := mulMod(h, h)
+	h3 := mulMod(h2, h)
+	u1h2 := mulMod(u1, h2)
+	x := subMod(subMod(mulMod(r, r), h3), mulMod(big.NewInt(2), u1h2))
+	y := subMod(mulMod(r, subMod(u1h2, x)), mulMod(s1, h3))
+	z := mulMod(h, mulMod(p.z, q.z))
+	return &jacobianPoint{x: x, y: y, z: z}
+}
+
+func (p *jacobianPoint) toAffine() (*big.Int, *big.Int) {
+	zInv := new(big.Int).ModInverse(p.z, curveP)
+	zInv2 := mulMod(zInv, zInv)
+	return mulMod(p.x, zInv2), mulMod(p.y, mulMod(zInv2, zInv))
+}
+
+func paddedBytes32(v *big.Int) []byte {
+	buf := make([]byte, 32)
+	b := v.Bytes()
+	copy(buf[32-len(b):], b)
+	return buf
+}
+
+// MultiSet is an elliptic curve multiset hash (ECMH) over secp256k1, as used
+// by Bitcoin ABC. Each element is hashed to a curve point and the set is the
+// sum of the points of its elements, so elements can be added and removed in
+// any order and the hashes of two sets can be combined without rehashing.
+type MultiSet struct {
+	point *jacobianPoint
+}
+
+// NewMultiSet returns an empty multiset.
+func NewMultiSet() *MultiSet {
+	return &MultiSet{point: infinityPoint()}
+}
+
+// ParseMultiSet restores a multiset serialized by Serialize.
+func ParseMultiSet(b []byte) (*MultiSet, error) {
+	if len(b) != MultiSetLen {
+		return nil, errMultiSetLen
+	}
+	x := new(big.Int).SetBytes(b[:32])
+	y := new(big.Int).SetBytes(b[32:])
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return NewMultiSet(), nil
+	}
+	if x.Cmp(curveP) >= 0 || y.Cmp(curveP) >= 0 || mulMod(y, y).Cmp(curveRHS(x)) != 0 {
+		return nil, errMultiSetPoint
+	}
+	return &MultiSet{point: newAffinePoint(x, y)}, nil
+}
+
+// curveRHS returns x^3 + 7.
+func curveRHS(x *big.Int) *big.Int {
+	rhs := mulMod(x, mulMod(x, x))
+	rhs.Add(rhs, curveB)
+	return rhs.Mod(rhs, curveP)
+}
+
+// multiSetElement hashes data to a curve point with an even y coordinate by
+// trying sha256(le64(n) || sha256(data)) as x coordinate for n = 0, 1, ...
+// The even y is what ABC's secp256k1_ge_set_xo_var(x, 0) picks, and not
+// always the quadratic residue: the y of the first element of the ABC test
+// vectors is not a square.
+func multiSetElement(data []byte) *jacobianPoint {
+	var buf [8 + sha256.Size]byte
+	dataHash := sha256.Sum256(data)
+	copy(buf[8:], dataHash[:])
+	for prefix := uint64(0); ; prefix++ {
+		binary.LittleEndian.PutUint64(buf[:8], prefix)
+		trial := sha256.Sum256(buf[:])
+		x := new(big.Int).SetBytes(trial[:])
+		if x.Cmp(curveP) >= 0 {
+			continue
+		}
+		// The jacobi symbol is much cheaper than the square root, which only
+		// exists for half of the trials.
+		rhs := curveRHS(x)
+		if big.Jacobi(rhs, curveP) != 1 {
+			continue
+		}
+		y := new(big.Int).Exp(rhs, curveSqrtExp, curveP)
+		if y.Bit(0) == 1 {
+			y.Sub(curveP, y)
+		}
+		return newAffinePoint(x, y)
+	}
+}
+
+func (p *jacobianPoint) negate() *jacobianPoint {
+	if p.isInfinity() {
+		return p
+	}
+	return &jacobianPoint{x: p.x, y: new(big.Int).Sub(curveP, p.y), z: p.z}
+}
+
+// Add adds an element to the multiset.
+func (ms *MultiSet) Add(data []byte) {
+	ms.point = ms.point.add(multiSetElement(data))
+}
+
+// Remove removes an element from the multiset. Removing an element which was
+// never added is allowed, it is cancelled by adding the element later.
+func (ms *MultiSet) Remove(data []byte) {
+	ms.point = ms.point.add(multiSetElement(data).negate())
+}
+
+// Combine adds all the elements of other to the multiset.
+func (ms *MultiSet) Combine(other *MultiSet) {
+	ms.point = ms.point.add(other.point)
+}
+
+// IsEmpty reports whether the multiset is empty, or its elements cancel out.
+func (ms *MultiSet) IsEmpty() bool {
+	return ms.point.isInfinity()
+}
+
+// Clone returns a copy of the multiset.
+func (ms *MultiSet) Clone() *MultiSet {
+	p := ms.point
+	return &MultiSet{point: &jacobianPoint{
+		x: new(big.Int).Set(p.x), y: new(big.Int).Set(p.y), z: new(big.Int).Set(p.z)}}
+}
+
+// Serialize returns the affine coordinates of the multiset point.
+func (ms *MultiSet) Serialize() []byte {
+	buf := make([]byte, MultiSetLen)
+	if ms.IsEmpty() {
+		return buf
+	}
+	x, y := ms.point.toAffine()
+	copy(buf[:32], paddedBytes32(x))
+	copy(buf[32:], paddedBytes32(y))
+	return buf
+}
+
+// Hash returns the sha256 of the serialized multiset, or the zero hash for the
+// empty set.
+func (ms *MultiSet) Hash() util.Hash {
+	if ms.IsEmpty() {
+		return util.Hash{}
+	}
+	return util.Hash(sha256.Sum256(ms.Serialize()))
+}
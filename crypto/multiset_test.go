@@ -0,0 +1,144 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func multiSetOf(elements ...string) *MultiSet {
+	ms := NewMultiSet()
+	for _, e := range elements {
+		ms.Add([]byte(e))
+	}
+	return ms
+}
+
+func TestMultiSetEmpty(t *testing.T) {
+	ms := NewMultiSet()
+	assert.True(t, ms.IsEmpty())
+	assert.Equal(t, util.Hash{}, ms.Hash())
+	assert.Equal(t, make([]byte, MultiSetLen), ms.Serialize())
+
+	ms.Add([]byte("a"))
+	assert.False(t, ms.IsEmpty())
+	assert.NotEqual(t, util.Hash{}, ms.Hash())
+	ms.Remove([]byte("a"))
+	assert.True(t, ms.IsEmpty())
+}
+
+func TestMultiSetElement(t *testing.T) {
+	for _, data := range []string{"", "a", "b", "copernicus"} {
+		p := multiSetElement([]byte(data))
+		x, y := p.toAffine()
+		assert.Equal(t, curveRHS(x), mulMod(y, y))
+		assert.Equal(t, uint(0), y.Bit(0))
+	}
+}
+
+// TestMultiSetVectors checks the known-answer vectors of Bitcoin ABC's ECMH,
+// the serialized coins of the coinbases of blocks 1, 2 and 3.
+func TestMultiSetVectors(t *testing.T) {
+	d1, _ := hex.DecodeString("982051fd1e4ba744bbbe680e1fee14677ba1a3c3540bf7b1cdb606e857233e0e" +
+		"00000000010000000100f2052a0100000043410496b538e853519c726a2c91e61ec11600ae1390813a627c" +
+		"66fb8be7947be63c52da7589379515d4e0a604f8141781e62294721166bf621e73a82cbf2342c858eeac")
+	d2, _ := hex.DecodeString("d5fdcc541e25de1c7a5addedf24858b8bb665c9f36ef744ee42c316022c90f9b" +
+		"00000000020000000100f2052a010000004341047211a824f55b505228e4c3d5194c1fcfaa15a456abdf37" +
+		"f9b9d97a4040afc073dee6c89064984f03385237d92167c13e236446b417ab79a0fcae412ae3316b77ac")
+	d3, _ := hex.DecodeString("44f672226090d85db9a9f2fbfe5f0f9609b387af7be5b7fbb7a1767c831c9e99" +
+		"00000000030000000100f2052a0100000043410494b9d3e76c5b1629ecf97fff95d7a4bbdac87cc26099ad" +
+		"a28066c6ff1eb9191223cd897194a08d0c2726c5747f1db49e8cf90e75dc3e3550ae9b30086f3cd5aaac")
+
+	tests := []struct {
+		elements [][]byte
+		hash     string
+	}{
+		{nil, "0000000000000000000000000000000000000000000000000000000000000000"},
+		{[][]byte{d1}, "f883195933a687170c34fa1adec66fe2861889279fb12c03a3fb0ca68ad87893"},
+		{[][]byte{d2}, "ef85d123a15da95d8aff92623ad1e1c9fcda3baa801bd40bc567a83a6fdcf3e2"},
+		{[][]byte{d3}, "cfadf40fc017faff5e04ccc0a2fae0fd616e4226dd7c03b1334a7a610468edff"},
+		{[][]byte{d1, d2}, "fabafd38d07370982a34547daf5b57b8a4398696d6fd2294788abda07b1faaaf"},
+		{[][]byte{d1, d2, d3}, "1cbccda23d7ce8c5a8b008008e1738e6bf9cffb1d5b86a92a4e62b5394a636e2"},
+	}
+	for _, test := range tests {
+		ms := NewMultiSet()
+		for _, e := range test.elements {
+			ms.Add(e)
+		}
+		h := ms.Hash()
+		assert.Equal(t, test.hash, hex.EncodeToString(h[:]))
+	}
+
+	// The even y of d1 is not a quadratic residue.
+	_, y := multiSetElement(d1).toAffine()
+	assert.Equal(t, -1, big.Jacobi(y, curveP))
+}
+
+func TestMultiSetOrderIndependence(t *testing.T) {
+	abc := multiSetOf("a", "b", "c")
+	assert.Equal(t, abc.Hash(), multiSetOf("c", "a", "b").Hash())
+	assert.NotEqual(t, abc.Hash(), multiSetOf("a", "b").Hash())
+	assert.NotEqual(t, abc.Hash(), multiSetOf("a", "b", "c", "c").Hash())
+
+	// A removal may come before the matching addition.
+	ms := NewMultiSet()
+	ms.Remove([]byte("b"))
+	ms.Add([]byte("a"))
+	ms.Add([]byte("c"))
+	ms.Add([]byte("b"))
+	ms.Add([]byte("b"))
+	assert.Equal(t, abc.Hash(), ms.Hash())
+}
+
+func TestMultiSetCombine(t *testing.T) {
+	ms := multiSetOf("a", "b")
+	delta := NewMultiSet()
+	delta.Add([]byte("c"))
+	delta.Remove([]byte("a"))
+	ms.Combine(delta)
+	assert.Equal(t, multiSetOf("b", "c").Hash(), ms.Hash())
+
+	ms.Combine(NewMultiSet())
+	assert.Equal(t, multiSetOf("b", "c").Hash(), ms.Hash())
+
+	empty := NewMultiSet()
+	empty.Combine(ms)
+	assert.Equal(t, ms.Hash(), empty.Hash())
+
+	// Doubling an element goes through the point doubling.
+	twice := multiSetOf("b")
+	twice.Combine(multiSetOf("b"))
+	assert.Equal(t, multiSetOf("b", "b").Hash(), twice.Hash())
+}
+
+func TestMultiSetClone(t *testing.T) {
+	ms := multiSetOf("a")
+	cloned := ms.Clone()
+	cloned.Add([]byte("b"))
+	assert.Equal(t, multiSetOf("a").Hash(), ms.Hash())
+	assert.Equal(t, multiSetOf("a", "b").Hash(), cloned.Hash())
+}
+
+func TestMultiSetSerialize(t *testing.T) {
+	for _, ms := range []*MultiSet{NewMultiSet(), multiSetOf("a"), multiSetOf("a", "b", "c")} {
+		parsed, err := ParseMultiSet(ms.Serialize())
+		assert.Nil(t, err)
+		assert.Equal(t, ms.Hash(), parsed.Hash())
+		assert.Equal(t, ms.Serialize(), parsed.Serialize())
+	}
+
+	_, err := ParseMultiSet(make([]byte, MultiSetLen-1))
+	assert.Equal(t, errMultiSetLen, err)
+
+	buf := multiSetOf("a").Serialize()
+	buf[63] ^= 1
+	_, err = ParseMultiSet(buf)
+	assert.Equal(t, errMultiSetPoint, err)
+
+	copy(buf[:32], paddedBytes32(new(big.Int).Add(curveP, big.NewInt(1))))
+	_, err = ParseMultiSet(buf)
+	assert.Equal(t, errMultiSetPoint, err)
+}
@@ -0,0 +1,161 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/copernet/copernicus/util"
+	"github.com/copernet/secp256k1-go/secp256k1"
+	"github.com/pkg/errors"
+)
+
+// SchnorrSignatureLen is the serialized size of a Schnorr signature: the
+// 32-byte x coordinate of R followed by the 32-byte scalar s.
+const SchnorrSignatureLen = 64
+
+var (
+	curveP, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F", 16)
+	curveN, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+
+	// schnorrNonceAlgo is mixed into the RFC6979 nonce of Schnorr signatures,
+	// as libsecp256k1 does, so that a Schnorr and an ECDSA signature of the
+	// same hash with the same key never share a nonce.
+	schnorrNonceAlgo = []byte("Schnorr+SHA256  ")
+
+	errSchnorrInvalidKey   = errors.New("invalid private key for schnorr signing")
+	errSchnorrInvalidHash  = errors.New("schnorr signing needs a 32-byte hash")
+	errSchnorrInvalidNonce = errors.New("invalid nonce for schnorr signing")
+)
+
+// nonceRFC6979 returns the first candidate nonce of the RFC6979 HMAC-SHA256
+// DRBG seeded with key32 || msg32 || algo16, matching libsecp256k1's
+// nonce_function_rfc6979 with a zero counter.
+func nonceRFC6979(key32, msg32, algo16 []byte) []byte {
+	seed := make([]byte, 0, len(key32)+len(msg32)+len(algo16))
+	seed = append(seed, key32...)
+	seed = append(seed, msg32...)
+	seed = append(seed, algo16...)
+
+	k := make([]byte, sha256.Size)
+	v := bytes.Repeat([]byte{0x01}, sha256.Size)
+	k = hmacSHA256(k, v, []byte{0x00}, seed)
+	v = hmacSHA256(k, v)
+	k = hmacSHA256(k, v, []byte{0x01}, seed)
+	v = hmacSHA256(k, v)
+	return hmacSHA256(k, v)
+}
+
+func hmacSHA256(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func schnorrChallenge(r []byte, compressedPubKey []byte, msg []byte) []byte {
+	h := sha256.New()
+	h.Write(r)
+	h.Write(compressedPubKey)
+	h.Write(msg)
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	return paddedBytes32(e.Mod(e, curveN))
+}
+
+// hasSquareY reports whether the y coordinate of an uncompressed point is a
+// quadratic residue. It only ever looks at R, which is public.
+func hasSquareY(uncompressed []byte) bool {
+	return big.Jacobi(new(big.Int).SetBytes(uncompressed[33:65]), curveP) == 1
+}
+
+// VerifySchnorr checks a 64-byte Schnorr signature over hash, as specified by
+// the Bitcoin Cash May 2019 upgrade.
+func (publicKey *PublicKey) VerifySchnorr(hash *util.Hash, vchSig []byte) bool {
+	if len(vchSig) != SchnorrSignatureLen || !publicKey.isValid() {
+		return false
+	}
+	if new(big.Int).SetBytes(vchSig[:32]).Cmp(curveP) >= 0 {
+		return false
+	}
+	if new(big.Int).SetBytes(vchSig[32:]).Cmp(curveN) >= 0 {
+		return false
+	}
+
+	compressed := publicKey.SerializeCompressed()
+	e := schnorrChallenge(vchSig[:32], compressed, hash.GetCloneBytes())
+
+	// R = sG - eP. The library rejects s == 0 and e == 0, neither of which
+	// can be reached without breaking sha256 or the discrete log.
+	_, sG, err := secp256k1.EcPubkeyCreate(secp256k1Context, vchSig[32:])
+	if err != nil {
+		return false
+	}
+	_, negEP, err := secp256k1.EcPubkeyParse(secp256k1Context, compressed)
+	if err != nil {
+		return false
+	}
+	if _, err = secp256k1.EcPubkeyNegate(secp256k1Context, negEP); err != nil {
+		return false
+	}
+	if _, err = secp256k1.EcPubkeyTweakMul(secp256k1Context, negEP, e); err != nil {
+		return false
+	}
+	_, rPoint, err := secp256k1.EcPubkeyCombine(secp256k1Context, []*secp256k1.PublicKey{sG, negEP})
+	if err != nil {
+		return false
+	}
+	_, rBytes, err := secp256k1.EcPubkeySerialize(secp256k1Context, rPoint, secp256k1.EcUncompressed)
+	if err != nil {
+		return false
+	}
+	return hasSquareY(rBytes) && bytes.Equal(rBytes[1:33], vchSig[:32])
+}
+
+// SignSchnorr produces a 64-byte Schnorr signature over hash. The nonce is
+// the RFC6979 nonce of the key and hash tagged with "Schnorr+SHA256  ", so
+// signatures are identical to the ones Bitcoin ABC produces.
+func (privateKey *PrivateKey) SignSchnorr(hash []byte) ([]byte, error) {
+	if len(hash) != 32 {
+		return nil, errSchnorrInvalidHash
+	}
+	_, pubKey, err := secp256k1.EcPubkeyCreate(secp256k1Context, privateKey.bytes)
+	if err != nil {
+		return nil, errSchnorrInvalidKey
+	}
+	_, compressed, err := secp256k1.EcPubkeySerialize(secp256k1Context, pubKey, secp256k1.EcCompressed)
+	if err != nil {
+		return nil, errSchnorrInvalidKey
+	}
+
+	k := nonceRFC6979(privateKey.bytes, hash, schnorrNonceAlgo)
+	_, rPoint, err := secp256k1.EcPubkeyCreate(secp256k1Context, k)
+	if err != nil {
+		return nil, errSchnorrInvalidNonce
+	}
+	_, rBytes, err := secp256k1.EcPubkeySerialize(secp256k1Context, rPoint, secp256k1.EcUncompressed)
+	if err != nil {
+		return nil, errSchnorrInvalidNonce
+	}
+	if !hasSquareY(rBytes) {
+		if _, err = secp256k1.EcPrivkeyNegate(secp256k1Context, k); err != nil {
+			return nil, errSchnorrInvalidNonce
+		}
+	}
+
+	// s = k + e*d
+	e := schnorrChallenge(rBytes[1:33], compressed, hash)
+	s := make([]byte, 32)
+	copy(s, privateKey.bytes)
+	if _, err = secp256k1.EcPrivkeyTweakMul(secp256k1Context, s, e); err != nil {
+		return nil, errSchnorrInvalidKey
+	}
+	if _, err = secp256k1.EcPrivkeyTweakAdd(secp256k1Context, s, k); err != nil {
+		return nil, errSchnorrInvalidKey
+	}
+
+	sig := make([]byte, 0, SchnorrSignatureLen)
+	sig = append(sig, rBytes[1:33]...)
+	return append(sig, s...), nil
+}
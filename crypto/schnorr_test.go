@@ -0,0 +1,216 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/copernet/copernicus/util"
+	"github.com/copernet/secp256k1-go/secp256k1"
+	"github.com/stretchr/testify/assert"
+)
+
+type schnorrVector struct {
+	name   string
+	pubKey string
+	msg    string
+	sig    string
+	valid  bool
+}
+
+// schnorrVectors are the test vectors of the Bitcoin Cash Schnorr signature
+// specification, shared with bip-schnorr.
+var schnorrVectors = []schnorrVector{
+	{
+		name:   "privkey 1, zero message",
+		pubKey: "0279BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798",
+		msg:    "0000000000000000000000000000000000000000000000000000000000000000",
+		sig:    "787A848E71043D280C50470E8E1532B2DD5D20EE912A45DBDD2BD1DFBF187EF67031A98831859DC34DFFEEDDA86831842CCD0079E1F92AF177F7F22CC1DCED05",
+		valid:  true,
+	},
+	{
+		name:   "vector 2",
+		pubKey: "02DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		msg:    "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		sig:    "2A298DACAE57395A15D0795DDBFD1DCB564DA82B0F269BC70A74F8220429BA1D1E51A22CCEC35599B8F266912281F8365FFC2D035A230434A1A64DC59F7013FD",
+		valid:  true,
+	},
+	{
+		name:   "vector 3",
+		pubKey: "03FAC2114C2FBB091527EB7C64ECB11F8021CB45E8E7809D3C0938E4B8C0E5F84B",
+		msg:    "5E2D58D8B3BCDF1ABADEC7829054F90DDA9805AAB56C77333024B9D0A508B75C",
+		sig:    "00DA9B08172A9B6F0466A2DEFD817F2D7AB437E0D253CB5395A963866B3574BE00880371D01766935B92D2AB4CD5C8A2A5837EC57FED7660773A05F0DE142380",
+		valid:  true,
+	},
+	{
+		name:   "r with leading zero bytes",
+		pubKey: "03DEFDEA4CDB677750A420FEE807EACF21EB9898AE79B9768766E4FAA04A2D4A34",
+		msg:    "4DF3C3F68FCC83B27E9D42C90431A72499F17875C81A599B566C9889B9696703",
+		sig:    "00000000000000000000003B78CE563F89A0ED9414F5AA28AD0D96D6795F9C6302A8DC32E64E86A333F20EF56EAC9BA30B7246D6D25E22ADB8C6BE1AEB08D49D",
+		valid:  true,
+	},
+	{
+		name:   "vector 5",
+		pubKey: "031B84C5567B126440995D3ED5AABA0565D71E1834604819FF9C17F5E9D5DD078F",
+		msg:    "0000000000000000000000000000000000000000000000000000000000000000",
+		sig:    "52818579ACA59767E3291D91B76B637BEF062083284992F2D95F564CA6CB4E3530B1DA849C8E8304ADC0CFE870660334B3CFC18E825EF1DB34CFAE3DFC5D8187",
+		valid:  true,
+	},
+	{
+		name:   "R has non-square y",
+		pubKey: "02DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		msg:    "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		sig:    "2A298DACAE57395A15D0795DDBFD1DCB564DA82B0F269BC70A74F8220429BA1DFA16AEE06609280A19B67A24E1977E4697712B5FD2943914ECD5F730901B4AB7",
+		valid:  false,
+	},
+	{
+		name:   "negated message",
+		pubKey: "03FAC2114C2FBB091527EB7C64ECB11F8021CB45E8E7809D3C0938E4B8C0E5F84B",
+		msg:    "5E2D58D8B3BCDF1ABADEC7829054F90DDA9805AAB56C77333024B9D0A508B75C",
+		sig:    "00DA9B08172A9B6F0466A2DEFD817F2D7AB437E0D253CB5395A963866B3574BED092F9D860F1776A1F7412AD8A1EB50DACCC222BC8C0E26B2056DF2F273EFDEC",
+		valid:  false,
+	},
+	{
+		name:   "negated s",
+		pubKey: "0279BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798",
+		msg:    "0000000000000000000000000000000000000000000000000000000000000000",
+		sig:    "787A848E71043D280C50470E8E1532B2DD5D20EE912A45DBDD2BD1DFBF187EF68FCE5677CE7A623CB20011225797CE7A8DE1DC6CCD4F754A47DA6C600E59543C",
+		valid:  false,
+	},
+	{
+		name:   "negated public key",
+		pubKey: "03DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		msg:    "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		sig:    "2A298DACAE57395A15D0795DDBFD1DCB564DA82B0F269BC70A74F8220429BA1D1E51A22CCEC35599B8F266912281F8365FFC2D035A230434A1A64DC59F7013FD",
+		valid:  false,
+	},
+	{
+		name:   "R is infinity",
+		pubKey: "02DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		msg:    "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		sig:    "00000000000000000000000000000000000000000000000000000000000000009E9D01AF988B5CEDCE47221BFA9B222721F3FA408915444A4B489021DB55775F",
+		valid:  false,
+	},
+	{
+		name:   "r is not an x coordinate",
+		pubKey: "02DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		msg:    "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		sig:    "4A298DACAE57395A15D0795DDBFD1DCB564DA82B0F269BC70A74F8220429BA1D1E51A22CCEC35599B8F266912281F8365FFC2D035A230434A1A64DC59F7013FD",
+		valid:  false,
+	},
+	{
+		name:   "r equals field size",
+		pubKey: "02DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		msg:    "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		sig:    "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F1E51A22CCEC35599B8F266912281F8365FFC2D035A230434A1A64DC59F7013FD",
+		valid:  false,
+	},
+	{
+		name:   "s equals curve order",
+		pubKey: "02DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		msg:    "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		sig:    "2A298DACAE57395A15D0795DDBFD1DCB564DA82B0F269BC70A74F8220429BA1DFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141",
+		valid:  false,
+	},
+}
+
+func hashFromHex(t *testing.T, s string) *util.Hash {
+	b, err := hex.DecodeString(s)
+	assert.NoError(t, err)
+	var h util.Hash
+	copy(h[:], b)
+	return &h
+}
+
+func TestVerifySchnorr(t *testing.T) {
+	InitSecp256()
+	for _, v := range schnorrVectors {
+		pubKeyBytes, _ := hex.DecodeString(v.pubKey)
+		sig, _ := hex.DecodeString(v.sig)
+		pubKey, err := ParsePubKey(pubKeyBytes)
+		assert.NoError(t, err, v.name)
+		assert.Equal(t, v.valid, pubKey.VerifySchnorr(hashFromHex(t, v.msg), sig), v.name)
+	}
+}
+
+func TestVerifySchnorrPubKeyNotOnCurve(t *testing.T) {
+	InitSecp256()
+	pubKeyBytes, _ := hex.DecodeString("03EEFDEA4CDB677750A420FEE807EACF21EB9898AE79B9768766E4FAA04A2D4A34")
+	_, err := ParsePubKey(pubKeyBytes)
+	assert.Error(t, err)
+}
+
+func TestVerifySchnorrBadLength(t *testing.T) {
+	InitSecp256()
+	v := schnorrVectors[0]
+	pubKeyBytes, _ := hex.DecodeString(v.pubKey)
+	sig, _ := hex.DecodeString(v.sig)
+	pubKey, err := ParsePubKey(pubKeyBytes)
+	assert.NoError(t, err)
+	assert.False(t, pubKey.VerifySchnorr(hashFromHex(t, v.msg), sig[:63]))
+	assert.False(t, pubKey.VerifySchnorr(hashFromHex(t, v.msg), append(sig, 0x41)))
+}
+
+func TestNonceRFC6979(t *testing.T) {
+	key := make([]byte, 32)
+	key[31] = 1
+	tests := []struct {
+		msg string
+		k   string
+	}{
+		{"Satoshi Nakamoto", "8f8a276c19f4149656b280621e358cce24f5f52542772691ee69063b74f15d15"},
+		{"All those moments will be lost in time, like tears in rain. Time to die...",
+			"38aa22d72376b4dbc472e06c3ba403ee0a394da63fc58d88686c611aba98d6b3"},
+	}
+	for _, test := range tests {
+		msg := sha256.Sum256([]byte(test.msg))
+		assert.Equal(t, test.k, hex.EncodeToString(nonceRFC6979(key, msg[:], nil)), test.msg)
+		assert.NotEqual(t, test.k, hex.EncodeToString(nonceRFC6979(key, msg[:], schnorrNonceAlgo)), test.msg)
+	}
+}
+
+func TestSignSchnorr(t *testing.T) {
+	InitSecp256()
+	tests := []struct {
+		privKey string
+		msg     string
+		sig     string
+	}{
+		{
+			"0000000000000000000000000000000000000000000000000000000000000001",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"31ab79a6591ae4af37c4223bfa75b7396ac9c14950ea78d94afc14be3a6b61dc2a901f43c609dfb10dfe3f00015957f6461d48b61df9f452143ac6f6f7dd4edd",
+		},
+		{
+			"B7E151628AED2A6ABF7158809CF4F3C762E7160F38B4DA56A784D9045190CFEF",
+			"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+			"e87cec707424360691ebf78b40be9bf5fbcfcf4cda8a9e49fb1a550fe00dfb6037170b5c71423897409718c46f7cd8a9f4a398fa5d367a539a60e62aaa2fc11a",
+		},
+	}
+	for _, test := range tests {
+		keyBytes, _ := hex.DecodeString(test.privKey)
+		privKey := NewPrivateKeyFromBytes(keyBytes, true)
+		msg, _ := hex.DecodeString(test.msg)
+		sig, err := privKey.SignSchnorr(msg)
+		assert.NoError(t, err)
+		assert.Equal(t, test.sig, hex.EncodeToString(sig))
+		assert.Equal(t, keyBytes, privKey.GetBytes())
+
+		// R is the point of the tagged RFC6979 nonce, possibly negated
+		_, rPoint, err := secp256k1.EcPubkeyCreate(secp256k1Context, nonceRFC6979(keyBytes, msg, schnorrNonceAlgo))
+		assert.NoError(t, err)
+		_, rBytes, err := secp256k1.EcPubkeySerialize(secp256k1Context, rPoint, secp256k1.EcCompressed)
+		assert.NoError(t, err)
+		assert.Equal(t, rBytes[1:], sig[:32])
+
+		assert.True(t, privKey.PubKey().VerifySchnorr(hashFromHex(t, test.msg), sig))
+		sig[63] ^= 1
+		assert.False(t, privKey.PubKey().VerifySchnorr(hashFromHex(t, test.msg), sig))
+	}
+
+	_, err := NewPrivateKeyFromBytes(make([]byte, 32), true).SignSchnorr(make([]byte, 32))
+	assert.Error(t, err)
+	keyBytes, _ := hex.DecodeString(tests[0].privKey)
+	_, err = NewPrivateKeyFromBytes(keyBytes, true).SignSchnorr(make([]byte, 31))
+	assert.Error(t, err)
+}
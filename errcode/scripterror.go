@@ -78,6 +78,31 @@ const (
 	ScriptErrIllegalForkID
 	ScriptErrMustUseForkID
 
+	// ScriptErrSigBadLength Schnorr signatures
+
+	ScriptErrSigBadLength
+	ScriptErrSigNonSchnorr
+
+	// ScriptErrInvalidBitfieldSize Schnorr multisig bitfield
+
+	ScriptErrInvalidBitfieldSize
+	ScriptErrInvalidBitRange
+	ScriptErrInvalidBitCount
+
+	// ScriptErrContextNotPresent native introspection
+
+	ScriptErrContextNotPresent
+	ScriptErrInvalidTxInputIndex
+	ScriptErrInvalidTxOutputIndex
+
+	// ScriptErrInvalidNumberRange64Bit 64-bit script integers
+
+	ScriptErrInvalidNumberRange64Bit
+
+	// ScriptErrInputSigChecks SigChecks density limit
+
+	ScriptErrInputSigChecks
+
 	ScriptErrErrorCount
 
 	// ScriptErrSize other errcode
@@ -196,6 +221,26 @@ func scriptErrorString(scriptError ScriptErr) string {
 		return "Signature must be zero for failed CHECK(MULTI)SIG operation"
 	case ScriptErrIllegalForkID:
 		return "Illegal use of SIGHASH_FORKID"
+	case ScriptErrSigBadLength:
+		return "Signature cannot be 65 bytes in CHECKMULTISIG"
+	case ScriptErrSigNonSchnorr:
+		return "Only Schnorr signatures allowed in this operation"
+	case ScriptErrInvalidBitfieldSize:
+		return "Bitfield of unexpected size error"
+	case ScriptErrInvalidBitRange:
+		return "Bitfield's bit out of the expected range"
+	case ScriptErrInvalidBitCount:
+		return "Bitfield's number of set bits does not match the signature count"
+	case ScriptErrContextNotPresent:
+		return "Introspection opcode used without a transaction context"
+	case ScriptErrInvalidTxInputIndex:
+		return "Specified transaction input index is out of range"
+	case ScriptErrInvalidTxOutputIndex:
+		return "Specified transaction output index is out of range"
+	case ScriptErrInvalidNumberRange64Bit:
+		return "Integer overflow, the result is outside the 64-bit range"
+	case ScriptErrInputSigChecks:
+		return "Input SigChecks limit exceeded"
 	case ScriptErrDiscourageUpgradableNops:
 		return "NOPx reserved for soft-fork upgrades"
 	case ScriptErrDiscourageUpgradableWitnessProgram:
@@ -61,6 +61,18 @@ func TestScriptErr_String(t *testing.T) {
 		// ScriptErrIllegalForkID anti replay
 		{ScriptErrIllegalForkID, "Illegal use of SIGHASH_FORKID"},
 		{ScriptErrMustUseForkID, "unknown error"},
+		// ScriptErrSigBadLength Schnorr signatures
+		{ScriptErrSigBadLength, "Signature cannot be 65 bytes in CHECKMULTISIG"},
+		{ScriptErrSigNonSchnorr, "Only Schnorr signatures allowed in this operation"},
+		// ScriptErrInvalidBitfieldSize Schnorr multisig bitfield
+		{ScriptErrInvalidBitfieldSize, "Bitfield of unexpected size error"},
+		{ScriptErrInvalidBitRange, "Bitfield's bit out of the expected range"},
+		{ScriptErrInvalidBitCount, "Bitfield's number of set bits does not match the signature count"},
+		{ScriptErrContextNotPresent, "Introspection opcode used without a transaction context"},
+		{ScriptErrInvalidTxInputIndex, "Specified transaction input index is out of range"},
+		{ScriptErrInvalidTxOutputIndex, "Specified transaction output index is out of range"},
+		{ScriptErrInvalidNumberRange64Bit, "Integer overflow, the result is outside the 64-bit range"},
+		{ScriptErrInputSigChecks, "Input SigChecks limit exceeded"},
 		{ScriptErrErrorCount, "unknown error"},
 		// ScriptErrSize other errcode
 		{ScriptErrSize, "unknown error"},
@@ -8,6 +8,7 @@ import (
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/logic/lblockindex"
 	"github.com/copernet/copernicus/logic/lchain"
+	"github.com/copernet/copernicus/logic/lindex"
 	"github.com/copernet/copernicus/logic/lreindex"
 	"github.com/copernet/copernicus/logic/ltx"
 	"github.com/copernet/copernicus/model"
@@ -36,6 +37,10 @@ func appInitMain(args []string) {
 	} else if conf.Cfg.P2PNet.RegTest {
 		model.SetRegTestParams()
 	}
+	if err := model.ApplyUpgradeOverrides(model.ActiveNetParams, conf.Args.UpgradeActivations); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	pow.UpdateMinimumChainWork()
 
 	fmt.Println("Current data dir:\033[0;32m", conf.DataDir, "\033[0m")
@@ -63,11 +68,19 @@ func appInitMain(args []string) {
 	}
 	log.Init(string(configuration))
 
+	// Split the -dbcache budget between the databases and the UTXO cache
+	cacheSizes := persist.NewDBCacheSizes(conf.Args.DBCache)
+	persist.CoinCacheUsage = cacheSizes.CoinCache
+	log.Info("Cache configuration: block index database %.1fMiB, chain state database %.1fMiB, "+
+		"in-memory UTXO set %.1fMiB", float64(cacheSizes.BlockTreeDB)/(1<<20),
+		float64(cacheSizes.CoinsDB)/(1<<20), float64(cacheSizes.CoinCache)/(1<<20))
+
 	// Init UTXO DB
 	utxoDbCfg := &db.DBOption{
 		FilePath:  conf.Cfg.DataDir + "/chainstate",
-		CacheSize: (1 << 20) * 8,
+		CacheSize: cacheSizes.CoinsDB,
 		Wipe:      conf.Cfg.Reindex,
+		Backend:   conf.Cfg.DB.ChainStateBackend,
 	}
 	utxoConfig := utxo.UtxoConfig{Do: utxoDbCfg}
 	utxo.InitUtxoLruTip(&utxoConfig)
@@ -77,16 +90,38 @@ func appInitMain(args []string) {
 	// Init blocktree DB
 	blkDbCfg := &db.DBOption{
 		FilePath:  conf.Cfg.DataDir + "/blocks/index",
-		CacheSize: (1 << 20) * 8,
+		CacheSize: cacheSizes.BlockTreeDB,
 		Wipe:      conf.Cfg.Reindex,
+		Backend:   conf.Cfg.DB.BlockIndexBackend,
 	}
 	blkdbCfg := blkdb.BlockTreeDBConfig{Do: blkDbCfg}
 	blkdb.InitBlockTreeDB(&blkdbCfg)
 
 	persist.InitPersistGlobal()
 
+	if err := disk.SetupPruneMode(conf.Args.Prune); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	// Load blockindex DB
-	lblockindex.LoadBlockIndexDB()
+	if !lblockindex.LoadBlockIndexDB() {
+		fmt.Println("Error loading the block database, you need to rebuild the database using -reindex")
+		os.Exit(1)
+	}
+
+	// The spent index is maintained while connecting blocks, switching it
+	// requires to connect them again
+	persist.SpentIndex = conf.Args.SpentIndex
+	if !conf.Cfg.Reindex && chain.GetInstance().Height() > 0 &&
+		blkdb.GetInstance().ReadFlag(blkdb.SpentIndexFlag) != persist.SpentIndex {
+		fmt.Println("You need to rebuild the database using -reindex to change -spentindex")
+		os.Exit(1)
+	}
+	if err := blkdb.GetInstance().WriteFlag(blkdb.SpentIndexFlag, persist.SpentIndex); err != nil {
+		fmt.Printf("Failed to write the spent index flag: %v\n", err)
+		os.Exit(1)
+	}
 
 	// when reindexing, we reuse the genesis block already on the disk
 	if !conf.Cfg.Reindex {
@@ -99,6 +134,14 @@ func appInitMain(args []string) {
 	wallet.InitWallet()
 
 	ltx.ScriptVerifyInit()
+	if conf.Args.LoadSnapshot != "" && !conf.Cfg.Reindex {
+		if chain.GetInstance().Height() > 0 {
+			log.Info("Ignoring -loadsnapshot, the chain state is not empty")
+		} else if err := lchain.LoadSnapshot(conf.Args.LoadSnapshot); err != nil {
+			fmt.Printf("Failed to load the UTXO snapshot: %v\n", err)
+			os.Exit(1)
+		}
+	}
 	if conf.Cfg.Reindex {
 		disk.CleanupBlockRevFiles()
 		err := lreindex.Reindex()
@@ -120,4 +163,36 @@ func appInitMain(args []string) {
     tip block index: %s
 ---------------------`, gChain.Height(), gChain.IndexMapSize(), gChain.Tip().String())
 	}
+
+	// The history below a UTXO snapshot is validated in the background
+	bgDbCfg := &db.DBOption{
+		FilePath:  conf.Cfg.DataDir + "/chainstate_background",
+		CacheSize: cacheSizes.CoinsDB,
+		Backend:   conf.Cfg.DB.ChainStateBackend,
+	}
+	if err := lchain.StartBackgroundValidation(bgDbCfg); err != nil {
+		fmt.Printf("Failed to start the background validation of the UTXO snapshot: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The indexes catch up with the active chain in the background
+	if conf.Args.TxIndex {
+		if err := lindex.InitTxIndex(); err != nil {
+			fmt.Printf("Failed to start the transaction index: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if conf.Args.AddressIndex {
+		mempool.GetInstance().EnableAddressIndex()
+		if err := lindex.InitAddrIndex(); err != nil {
+			fmt.Printf("Failed to start the address index: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if conf.Args.BlockFilterIndex {
+		if err := lindex.InitBlockFilterIndex(); err != nil {
+			fmt.Printf("Failed to start the block filter index: %v\n", err)
+			os.Exit(1)
+		}
+	}
 }
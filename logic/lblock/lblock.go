@@ -108,12 +108,7 @@ func CheckBlock(pblock *block.Block, checkHeader, checkMerlke bool) error {
 		return errcode.NewError(errcode.RejectInvalid, "bad-blk-length")
 	}
 
-	nMaxBlockSigOps, errSig := consensus.GetMaxBlockSigOpsCount(uint64(currentBlockSize))
-	if errSig != nil {
-		return errSig
-	}
-
-	err := ltx.CheckBlockTransactions(pblock.Txs, nMaxBlockSigOps)
+	err := ltx.CheckBlockTransactions(pblock.Txs)
 	if err != nil {
 		log.Debug("ErrorBadBlkTx: %v", err)
 		return err
@@ -145,10 +140,15 @@ func ContextualCheckBlock(b *block.Block, indexPrev *blockindex.BlockIndex) erro
 		lockTimeCutoff = mediaTimePast
 	}
 
+	maxBlockSigOps, err := consensus.GetMaxBlockSigOpsCount(uint64(b.EncodeSize()))
+	if err != nil {
+		return err
+	}
+
 	// Check that all transactions are finalized
 	// Enforce rule that the coinBase starts with serialized lblock height
-	err := ltx.ContextureCheckBlockTransactions(b.Txs, height, lockTimeCutoff,
-		mediaTimePast)
+	err = ltx.ContextureCheckBlockTransactions(b.Txs, height, lockTimeCutoff,
+		mediaTimePast, maxBlockSigOps)
 	return err
 }
 
@@ -157,7 +157,9 @@ func ContextualCheckBlock(b *block.Block, indexPrev *blockindex.BlockIndex) erro
 func ReceivedBlockTransactions(pblock *block.Block,
 	pindexNew *blockindex.BlockIndex, pos *block.DiskBlockPos) {
 	pindexNew.TxCount = int32(len(pblock.Txs))
-	pindexNew.ChainTxCount = 0
+	if !pindexNew.IsAssumedValid() {
+		pindexNew.ChainTxCount = 0
+	}
 	pindexNew.File = pos.File
 	pindexNew.DataPos = pos.Pos
 	pindexNew.UndoPos = 0
@@ -167,6 +169,12 @@ func ReceivedBlockTransactions(pblock *block.Block,
 	gPersist := persist.GetInstance()
 	gPersist.AddDirtyBlockIndex(pindexNew)
 
+	// A block below the base block of a UTXO snapshot is already in the
+	// active chain, it is downloaded for the background validation.
+	if pindexNew.IsAssumedValid() {
+		return
+	}
+
 	gChain := chain.GetInstance()
 	if pindexNew.IsGenesis(gChain.GetParams()) || gChain.ParentInBranch(pindexNew) {
 		// If indexNew is the genesis lblock or all parents are in branch
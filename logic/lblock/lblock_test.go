@@ -345,8 +345,9 @@ func TestContextualCheckBlock(t *testing.T) {
 		t.Errorf("TestContextualCheckBlock test 3 check big block failed")
 	}
 
-	blk1Index.Header.Time = uint32(chain.GetInstance().GetParams().MonolithActivationTime)
+	// May 15, 2018 hard fork
+	blk1Index.Header.Time = 1526400000
 	if err := ContextualCheckBlock(blk2, blk1Index); err != nil {
-		t.Errorf("TestContextualCheckBlock test 4 check MonolithActivationTime failed")
+		t.Errorf("TestContextualCheckBlock test 4 check May 2018 hard fork failed")
 	}
 }
@@ -30,6 +30,11 @@ func LoadBlockIndexDB() bool {
 	if !blkdb.GetInstance().LoadBlockIndexGuts(GlobalBlockIndexMap, gChain.GetParams()) {
 		return false
 	}
+	discarded, err := discardSnapshotHeaders(GlobalBlockIndexMap)
+	if err != nil {
+		log.Error("LoadBlockIndexDB: unable to discard the interrupted UTXO snapshot load: %v", err)
+		return false
+	}
 	gPersist := persist.GetInstance()
 	sortedByHeight := make([]*blockindex.BlockIndex, 0, len(GlobalBlockIndexMap))
 	for _, index := range GlobalBlockIndexMap {
@@ -71,6 +76,13 @@ func LoadBlockIndexDB() bool {
 			index.ChainTxCount = index.TxCount
 			branch = append(branch, index)
 		}
+		// The transaction counts below a UTXO snapshot base block are faked,
+		// restore the real count of the chain at the base block.
+		if index.IsAssumedValid() && index.ChainTxCount != 0 {
+			if data := gChain.GetParams().AssumeUTXOForBlock(index.GetBlockHash()); data != nil {
+				index.ChainTxCount = data.ChainTxCount
+			}
+		}
 
 		if index.Prev != nil {
 			index.BuildSkip()
@@ -89,7 +101,6 @@ func LoadBlockIndexDB() bool {
 
 	// Load block file info
 	btd := blkdb.GetInstance()
-	var err error
 	var bfi *block.BlockFileInfo
 
 	globalLastBlockFile, err := btd.ReadLastBlockFile()
@@ -122,6 +133,12 @@ func LoadBlockIndexDB() bool {
 	gPersist.GlobalLastBlockFile = globalLastBlockFile
 	log.Debug("LoadBlockIndexDB: Read last block file info: %d, block file info len:%d",
 		globalLastBlockFile, len(globalBlockFileInfo))
+	if discarded != nil {
+		if err = eraseSnapshotLoad(discarded, globalLastBlockFile); err != nil {
+			log.Error("LoadBlockIndexDB: unable to erase the UTXO snapshot load marker: %v", err)
+			return false
+		}
+	}
 
 	// Check presence of block index files
 	setBlkDataFiles := set.New()
@@ -148,6 +165,10 @@ func LoadBlockIndexDB() bool {
 
 	// Build chain's active
 	gChain.InitLoad(GlobalBlockIndexMap, branch)
+	if err := ReplayBlocks(GlobalBlockIndexMap, gChain.GetParams()); err != nil {
+		log.Error("LoadBlockIndexDB: unable to replay blocks: %v", err)
+		return false
+	}
 	bestHash, err := utxo.GetUtxoCacheInstance().GetBestBlock()
 	log.Debug("find bestblock hash:%s and err:%v from utxo", bestHash, err)
 	if err == nil {
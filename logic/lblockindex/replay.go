@@ -0,0 +1,170 @@
+package lblockindex
+
+import (
+	"fmt"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/logic/lundo"
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/undo"
+	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/persist/disk"
+	"github.com/copernet/copernicus/util"
+)
+
+// ReplayBlocks completes a chain state flush which was interrupted between
+// its batches, as recorded by the head blocks marker of the coins database.
+// The coins database then holds a mix of the old and the new best block's
+// coins: the blocks of the old branch are disconnected down to the fork with
+// their undo data, and the blocks up to the new best block are connected
+// again, overwriting the coins which were already written.
+func ReplayBlocks(blockIndexMap map[util.Hash]*blockindex.BlockIndex, params *model.BitcoinParams) error {
+	utxoTip := utxo.GetUtxoCacheInstance()
+	cdb := utxoTip.(*utxo.CoinsViewCache).GetCoinsDB()
+	heads, err := cdb.GetHeadBlocks()
+	if err != nil {
+		return err
+	}
+	if len(heads) == 0 {
+		return nil
+	}
+
+	newTip, ok := blockIndexMap[heads[0]]
+	if !ok {
+		return fmt.Errorf("the new best block %s of the interrupted flush is not in the block index", heads[0])
+	}
+	var oldTip, fork *blockindex.BlockIndex
+	if !heads[1].IsNull() {
+		oldTip, ok = blockIndexMap[heads[1]]
+		if !ok {
+			return fmt.Errorf("the old best block %s of the interrupted flush is not in the block index", heads[1])
+		}
+		fork = lastCommonAncestor(oldTip, newTip)
+		if fork == nil {
+			return fmt.Errorf("the best blocks %s and %s of the interrupted flush have no common ancestor",
+				heads[1], heads[0])
+		}
+	}
+	log.Info("Replaying the blocks of an interrupted chain state flush, from %s to %s",
+		heads[1], heads[0])
+
+	// Roll back along the old branch.
+	for index := oldTip; index != fork; index = index.Prev {
+		log.Info("Rolling back %s (%d)", index.GetBlockHash(), index.Height)
+		if err := rollbackBlock(index, params); err != nil {
+			return err
+		}
+	}
+	if oldTip != fork {
+		// The restored coins are added fresh but may already be in the
+		// database, write them before the new branch spends them again.
+		utxoTip.Flush()
+	}
+
+	// Roll forward from the fork to the new best block.
+	forkHeight := int32(0)
+	if fork != nil {
+		forkHeight = fork.Height
+	}
+	for height := forkHeight + 1; height <= newTip.Height; height++ {
+		index := newTip.GetAncestor(height)
+		log.Info("Rolling forward %s (%d)", index.GetBlockHash(), index.Height)
+		if err := rollforwardBlock(index, params); err != nil {
+			return err
+		}
+	}
+
+	if err := utxoTip.UpdateCoins(utxo.NewEmptyCoinsMap(), newTip.GetBlockHash()); err != nil {
+		return err
+	}
+	utxoTip.Flush()
+	log.Info("Replayed the interrupted chain state flush, the best block is %s (%d)",
+		newTip.GetBlockHash(), newTip.Height)
+	return nil
+}
+
+func lastCommonAncestor(a, b *blockindex.BlockIndex) *blockindex.BlockIndex {
+	if a.Height > b.Height {
+		a = a.GetAncestor(b.Height)
+	} else if b.Height > a.Height {
+		b = b.GetAncestor(a.Height)
+	}
+	for a != b && a != nil && b != nil {
+		a = a.Prev
+		b = b.Prev
+	}
+	if a != b {
+		return nil
+	}
+	return a
+}
+
+func rollbackBlock(index *blockindex.BlockIndex, params *model.BitcoinParams) error {
+	blk, ok := disk.ReadBlockFromDisk(index, params)
+	if !ok {
+		return fmt.Errorf("failed to read block %s", index.GetBlockHash())
+	}
+	pos := index.GetUndoPos()
+	if pos.IsNull() || index.Prev == nil {
+		return fmt.Errorf("no undo data available for block %s", index.GetBlockHash())
+	}
+	blockUndo, ok := disk.UndoReadFromDisk(&pos, *index.Prev.GetBlockHash())
+	if !ok {
+		return fmt.Errorf("failed to read the undo data of block %s", index.GetBlockHash())
+	}
+	// Only some of the coins of the block may have been flushed, so the
+	// disconnection is expected to be unclean.
+	if lundo.ApplyBlockUndo(blockUndo, blk, utxo.NewEmptyCoinsMap(), index.Height) == undo.DisconnectFailed {
+		return fmt.Errorf("failed to roll back block %s", index.GetBlockHash())
+	}
+	return nil
+}
+
+// rollforwardBlock applies the transactions of a block whose inputs may
+// already be spent and whose outputs may already exist, keeping the UTXO
+// commitment in line with the coins actually changed.
+func rollforwardBlock(index *blockindex.BlockIndex, params *model.BitcoinParams) error {
+	blk, ok := disk.ReadBlockFromDisk(index, params)
+	if !ok {
+		return fmt.Errorf("failed to read block %s", index.GetBlockHash())
+	}
+	cm := utxo.NewEmptyCoinsMap()
+	for _, txn := range blk.Txs {
+		if !txn.IsCoinBase() {
+			for _, in := range txn.GetIns() {
+				if existingCoin(cm, in.PreviousOutPoint) != nil {
+					cm.UncommitCoin(in.PreviousOutPoint, cm.SpendGlobalCoin(in.PreviousOutPoint))
+				}
+			}
+		}
+		txid := txn.GetHash()
+		for i, out := range txn.GetOuts() {
+			point := outpoint.NewOutPoint(txid, uint32(i))
+			if old := existingCoin(cm, point); old != nil {
+				cm.UncommitCoin(point, old)
+			}
+			coin := utxo.NewFreshCoin(out, index.Height, txn.IsCoinBase())
+			cm.OverwriteCoin(point, coin)
+			cm.CommitCoin(point, coin)
+		}
+	}
+	if !cm.Flush(*index.GetBlockHash()) {
+		return fmt.Errorf("failed to roll forward block %s", index.GetBlockHash())
+	}
+	return nil
+}
+
+// existingCoin returns the unspent coin at point in cm or in the UTXO cache,
+// without fetching it into cm.
+func existingCoin(cm *utxo.CoinsMap, point *outpoint.OutPoint) *utxo.Coin {
+	coin := cm.GetCoin(point)
+	if coin == nil {
+		coin = utxo.GetUtxoCacheInstance().GetCoin(point)
+	}
+	if coin == nil || coin.IsSpent() {
+		return nil
+	}
+	return coin
+}
@@ -0,0 +1,48 @@
+package lblockindex
+
+import (
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/persist/blkdb"
+	"github.com/copernet/copernicus/util"
+)
+
+// discardSnapshotHeaders turns the headers of a UTXO snapshot whose load did
+// not complete back into plain headers, as recorded by the snapshot load
+// marker of the coins database. The coins of the snapshot were wiped when the
+// coins database was opened: the blocks below the snapshot base are no longer
+// assumed valid, and are downloaded and connected as any other block. The
+// discarded indexes are returned, nil if no load was interrupted.
+func discardSnapshotHeaders(blockIndexMap map[util.Hash]*blockindex.BlockIndex) ([]*blockindex.BlockIndex, error) {
+	cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsViewCache).GetCoinsDB()
+	oldTip, err := cdb.GetSnapshotLoad()
+	if err != nil || oldTip == nil {
+		return nil, err
+	}
+
+	discarded := make([]*blockindex.BlockIndex, 0)
+	for _, index := range blockIndexMap {
+		if !index.IsAssumedValid() {
+			continue
+		}
+		index.SubStatus(blockindex.BlockAssumedValid)
+		if !index.HasData() {
+			index.TxCount = 0
+		}
+		discarded = append(discarded, index)
+	}
+	log.Warn("LoadBlockIndexDB: discarding the %d assumed valid blocks of an interrupted UTXO snapshot load",
+		len(discarded))
+	return discarded, nil
+}
+
+// eraseSnapshotLoad writes the indexes discarded by discardSnapshotHeaders,
+// then erases the snapshot load marker.
+func eraseSnapshotLoad(discarded []*blockindex.BlockIndex, lastFile int32) error {
+	if err := blkdb.GetInstance().WriteBatchSync(nil, int(lastFile), discarded); err != nil {
+		return err
+	}
+	cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsViewCache).GetCoinsDB()
+	return cdb.EraseSnapshotLoad()
+}
@@ -0,0 +1,363 @@
+package lchain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/logic/lblock"
+	"github.com/copernet/copernicus/logic/ltx"
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/model/chain"
+	"github.com/copernet/copernicus/model/consensus"
+	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/persist"
+	"github.com/copernet/copernicus/persist/blkdb"
+	"github.com/copernet/copernicus/persist/db"
+	"github.com/copernet/copernicus/persist/disk"
+)
+
+// backgroundFlushInterval is how often the coins of the background chain
+// state are written while the history is validated.
+const backgroundFlushInterval = 10 * time.Minute
+
+// backgroundWaitInterval is how long the background validation waits for the
+// next block of the history to be downloaded.
+const backgroundWaitInterval = time.Second
+
+// backgroundLogInterval is how often the progress of the background validation
+// is logged.
+const backgroundLogInterval = 30 * time.Second
+
+// backgroundValidation connects the blocks below the base block of a loaded
+// UTXO snapshot on a chain state of its own, from the genesis block. Once it
+// reaches the base block, the UTXO set it built must match the snapshot: the
+// blocks below the base block are then no longer assumed valid.
+type backgroundValidation struct {
+	do   *db.DBOption
+	base *blockindex.BlockIndex
+	data *model.AssumeUTXOData
+	view *utxo.CoinsViewCache
+
+	// lock protects best and failed, which are only set by the validation
+	// goroutine.
+	lock   sync.RWMutex
+	best   *blockindex.BlockIndex
+	failed bool
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+var bgValidation *backgroundValidation
+
+// StartBackgroundValidation starts validating the history below the base
+// block of the UTXO snapshot the chain state was loaded from, with the
+// background chain state stored as described by do. Without such a snapshot,
+// the background chain state left by a completed validation is removed.
+func StartBackgroundValidation(do *db.DBOption) error {
+	persist.CsMain.Lock()
+	defer persist.CsMain.Unlock()
+
+	gChain := chain.GetInstance()
+	params := gChain.GetParams()
+	var base *blockindex.BlockIndex
+	var data *model.AssumeUTXOData
+	for _, d := range params.AssumeUTXO {
+		index := gChain.FindBlockIndex(*d.BlockHash)
+		if index != nil && index.IsAssumedValid() && gChain.Contains(index) {
+			base, data = index, d
+			break
+		}
+	}
+	if base == nil {
+		return os.RemoveAll(do.FilePath)
+	}
+
+	bv := &backgroundValidation{
+		do:   do,
+		base: base,
+		data: data,
+		best: gChain.Genesis(),
+		quit: make(chan struct{}),
+	}
+	if err := bv.open(); err != nil {
+		return err
+	}
+	log.Info("Validating the history of the UTXO snapshot at block %s (height %d) from height %d",
+		base.GetBlockHash(), base.Height, bv.best.Height+1)
+
+	bgValidation = bv
+	bv.wg.Add(1)
+	go bv.validateLoop()
+	return nil
+}
+
+// StopBackgroundValidation interrupts the background validation and writes
+// the background chain state.
+func StopBackgroundValidation() {
+	bv := bgValidation
+	if bv == nil {
+		return
+	}
+	close(bv.quit)
+	bv.wg.Wait()
+	bgValidation = nil
+
+	persist.CsMain.Lock()
+	defer persist.CsMain.Unlock()
+	if bv.view != nil {
+		if err := bv.flush(); err != nil {
+			log.Error("Background validation: write the chain state failed: %v", err)
+		}
+		bv.view.Close()
+	}
+}
+
+// BackgroundValidationRange returns the next block the background validation
+// connects and the base block of the UTXO snapshot, or nil if no history is
+// being validated. The blocks in between are to be downloaded.
+func BackgroundValidationRange() (next, base *blockindex.BlockIndex) {
+	bv := bgValidation
+	if bv == nil {
+		return nil, nil
+	}
+	bv.lock.RLock()
+	defer bv.lock.RUnlock()
+	if bv.best == bv.base {
+		return nil, nil
+	}
+	return bv.base.GetAncestor(bv.best.Height + 1), bv.base
+}
+
+// BackgroundValidationFailed reports whether the background validation found
+// the history of the UTXO snapshot invalid.
+func BackgroundValidationFailed() bool {
+	bv := bgValidation
+	if bv == nil {
+		return false
+	}
+	bv.lock.RLock()
+	defer bv.lock.RUnlock()
+	return bv.failed
+}
+
+// open opens the background chain state and resumes from its best block. A
+// chain state whose best block is not below the base block, or whose last
+// write did not complete, is wiped. CsMain must be held.
+func (bv *backgroundValidation) open() error {
+	for wiped := false; ; wiped = true {
+		view, err := utxo.OpenCoinsViewCache(bv.do)
+		if err != nil {
+			return err
+		}
+		cdb := view.GetCoinsDB()
+		hash, err := cdb.GetBestBlock()
+		if err == db.ErrNotFound {
+			heads, err := cdb.GetHeadBlocks()
+			if err == nil && len(heads) == 0 {
+				bv.view = view
+				return nil
+			}
+		} else if err == nil {
+			index := chain.GetInstance().FindBlockIndex(*hash)
+			if index != nil && bv.base.GetAncestor(index.Height) == index {
+				bv.view = view
+				bv.best = index
+				return nil
+			}
+		}
+		view.Close()
+		if wiped {
+			return errors.New("the background chain state can not be reset")
+		}
+		log.Warn("Background validation: the chain state at %s does not lead to the UTXO snapshot, wiping it",
+			bv.do.FilePath)
+		if err := os.RemoveAll(bv.do.FilePath); err != nil {
+			return err
+		}
+	}
+}
+
+func (bv *backgroundValidation) isStopped() bool {
+	select {
+	case <-bv.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+func (bv *backgroundValidation) getBest() *blockindex.BlockIndex {
+	bv.lock.RLock()
+	defer bv.lock.RUnlock()
+	return bv.best
+}
+
+func (bv *backgroundValidation) setBest(index *blockindex.BlockIndex) {
+	bv.lock.Lock()
+	bv.best = index
+	bv.lock.Unlock()
+}
+
+// validateLoop connects the blocks up to the base block as they are
+// downloaded, then checks the UTXO set against the snapshot.
+func (bv *backgroundValidation) validateLoop() {
+	defer bv.wg.Done()
+
+	lastFlush := time.Now()
+	lastLog := time.Now()
+	for !bv.isStopped() {
+		persist.CsMain.Lock()
+		best := bv.getBest()
+		if best == bv.base {
+			err := bv.complete()
+			persist.CsMain.Unlock()
+			if err != nil {
+				bv.fail(best, err)
+			}
+			return
+		}
+		next := bv.base.GetAncestor(best.Height + 1)
+		if !next.HasData() {
+			persist.CsMain.Unlock()
+			select {
+			case <-bv.quit:
+			case <-time.After(backgroundWaitInterval):
+			}
+			continue
+		}
+		err := bv.connectBlock(next)
+		if err == nil && (time.Since(lastFlush) > backgroundFlushInterval ||
+			bv.view.DynamicMemoryUsage() > persist.CoinCacheUsage/2) {
+			err = bv.flush()
+			lastFlush = time.Now()
+		}
+		persist.CsMain.Unlock()
+
+		if err != nil {
+			bv.fail(next, err)
+			return
+		}
+		if time.Since(lastLog) > backgroundLogInterval {
+			log.Info("Background validation of the UTXO snapshot history at height %d of %d",
+				next.Height, bv.base.Height)
+			lastLog = time.Now()
+		}
+	}
+}
+
+// fail reports the history of the UTXO snapshot to be invalid at index.
+func (bv *backgroundValidation) fail(index *blockindex.BlockIndex, err error) {
+	bv.lock.Lock()
+	bv.failed = true
+	bv.lock.Unlock()
+	log.Error("Background validation of the UTXO snapshot history failed at block %s (height %d): %v. "+
+		"The chain state loaded from the snapshot can not be trusted, restart with -reindex",
+		index.GetBlockHash(), index.Height, err)
+}
+
+// connectBlock connects the block at index, the next block of the history,
+// to the background chain state. CsMain must be held.
+func (bv *backgroundValidation) connectBlock(index *blockindex.BlockIndex) error {
+	params := chain.GetInstance().GetParams()
+	persist.CsBlockFiles.RLock()
+	pblock, ok := disk.ReadBlockFromDisk(index, params)
+	persist.CsBlockFiles.RUnlock()
+	if !ok {
+		return fmt.Errorf("failed to read block %s", index.GetBlockHash())
+	}
+
+	if err := lblock.CheckBlock(pblock, true, true); err != nil {
+		return err
+	}
+	blockHash := pblock.GetHash()
+	bip30Enable := bip30Enforced(index, &blockHash)
+	lockTimeFlags := 0
+	if index.Height >= params.CSVHeight {
+		lockTimeFlags |= consensus.LocktimeVerifySequence
+	}
+	flags := lblock.GetBlockScriptFlags(index.Prev)
+	maxSigOps, err := consensus.GetMaxBlockSigOpsCount(uint64(pblock.EncodeSize()))
+	if err != nil {
+		return err
+	}
+
+	coinsMap, blockUndo, spentIndex, err := ltx.ApplyBlockTransactions(pblock.Txs, bip30Enable, flags,
+		scriptChecksRequired(index), model.GetBlockSubsidy(index.Height, params), index.Height, maxSigOps,
+		uint32(lockTimeFlags), index, bv.view)
+	if err != nil {
+		return err
+	}
+	if err = writeBlockUndo(index, blockUndo); err != nil {
+		return err
+	}
+	if len(spentIndex) > 0 {
+		if err = blkdb.GetInstance().WriteSpentIndex(spentIndex); err != nil {
+			return err
+		}
+	}
+	ltx.BlockCommitCoins(pblock.Txs, blockUndo, coinsMap, index.Height, bip30Enable, bv.view)
+	if err = bv.view.UpdateCoins(coinsMap, &blockHash); err != nil {
+		return err
+	}
+	bv.setBest(index)
+	return nil
+}
+
+// flush writes the background chain state. The block index is written first,
+// so that the blocks connected are known to have their undo data when the
+// validation resumes from the best block written. CsMain must be held.
+func (bv *backgroundValidation) flush() error {
+	if err := disk.FlushStateToDisk(disk.FlushStateAlways, 0); err != nil {
+		return err
+	}
+	if !bv.view.Flush() {
+		return errors.New("failed to write the background chain state")
+	}
+	return nil
+}
+
+// complete checks the UTXO set at the base block against the snapshot. The
+// blocks below the base block are validated then, their real transaction
+// counts replace the faked ones and the background chain state is removed.
+// CsMain must be held.
+func (bv *backgroundValidation) complete() error {
+	if err := bv.flush(); err != nil {
+		return err
+	}
+	stat, err := GetUTXOStats(bv.view.GetCoinsDB())
+	if err != nil {
+		return err
+	}
+	if stat.HashSerialized != *bv.data.HashSerialized {
+		return fmt.Errorf("the UTXO set hash %s does not match the snapshot hash %s",
+			stat.HashSerialized, bv.data.HashSerialized)
+	}
+
+	gPersist := persist.GetInstance()
+	for height := int32(1); height <= bv.base.Height; height++ {
+		index := bv.base.GetAncestor(height)
+		index.SubStatus(blockindex.BlockAssumedValid)
+		if height < bv.base.Height {
+			index.ChainTxCount = index.Prev.ChainTxCount + index.TxCount
+		}
+		gPersist.AddDirtyBlockIndex(index)
+	}
+	if err = disk.FlushStateToDisk(disk.FlushStateAlways, 0); err != nil {
+		return err
+	}
+
+	bv.view.Close()
+	bv.view = nil
+	if err = os.RemoveAll(bv.do.FilePath); err != nil {
+		log.Warn("Background validation: remove the chain state at %s failed: %v", bv.do.FilePath, err)
+	}
+	log.Info("Background validation of the UTXO snapshot history completed at block %s (height %d)",
+		bv.base.GetBlockHash(), bv.base.Height)
+	return nil
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/copernet/copernicus/persist"
 	"github.com/copernet/copernicus/persist/disk"
 	"github.com/copernet/copernicus/util"
+	"sort"
 	"syscall"
 	"time"
 )
@@ -94,7 +95,7 @@ func ActivateBestChain(pblock *block.Block) error {
 		// MemPoolConflictRemovalTracker destroyed and conflict evictions
 		// are notified
 
-		sendNotifications(pindexOldTip, pblock)
+		sendNotifications(pindexOldTip, pblock, connTrace)
 
 		if gChain.Tip() == pindexMostWork {
 			break
@@ -120,15 +121,25 @@ func stopAtHeightIfNeed(currentHeight int32) {
 
 // sendNotifications When we reach this point, we switched to a new tip.
 // Notify external listeners about the new tip.
-func sendNotifications(pindexOldTip *blockindex.BlockIndex, pblock *block.Block) {
+func sendNotifications(pindexOldTip *blockindex.BlockIndex, pblock *block.Block, connTrace connectTrace) {
+	gChain := chain.GetInstance()
+
+	// Notify each connected block, in the order of the chain.
+	connected := make([]*blockindex.BlockIndex, 0, len(connTrace))
+	for index := range connTrace {
+		connected = append(connected, index)
+	}
+	sort.Slice(connected, func(i, j int) bool {
+		return connected[i].Height < connected[j].Height
+	})
+	for _, index := range connected {
+		gChain.SendNotification(chain.NTBlockConnected, connTrace[index])
+	}
+
 	if pblock == nil {
 		return
 	}
 
-	gChain := chain.GetInstance()
-
-	gChain.SendNotification(chain.NTBlockConnected, pblock)
-
 	forkIndex := gChain.FindFork(pindexOldTip)
 	event := chain.TipUpdatedEvent{TipIndex: gChain.Tip(), ForkIndex: forkIndex, IsInitialDownload: lblock.IsInitialBlockDownload()}
 	gChain.SendNotification(chain.NTChainTipUpdated, &event)
@@ -266,7 +277,7 @@ func CheckBlockIndex() error {
 		if pindexFirstInvalid == nil && pindex.Failed() {
 			pindexFirstInvalid = pindex
 		}
-		if pindexFirstMissing == nil && !pindex.HasData() {
+		if pindexFirstMissing == nil && !pindex.HasData() && !pindex.IsAssumedValid() {
 			pindexFirstMissing = pindex
 		}
 		if pindexFirstNeverProcessed == nil && pindex.TxCount == 0 {
@@ -275,13 +286,16 @@ func CheckBlockIndex() error {
 		if pindex.Prev != nil && pindexFirstNotTreeValid == nil && (pindex.Status&blockindex.BlockValidMask) < blockindex.BlockValidTree {
 			pindexFirstNotTreeValid = pindex
 		}
-		if pindex.Prev != nil && pindexFirstNotTransactionsValid == nil && (pindex.Status&blockindex.BlockValidMask) < blockindex.BlockValidTransactions {
+		if pindex.Prev != nil && pindexFirstNotTransactionsValid == nil && !pindex.IsAssumedValid() &&
+			(pindex.Status&blockindex.BlockValidMask) < blockindex.BlockValidTransactions {
 			pindexFirstNotTransactionsValid = pindex
 		}
-		if pindex.Prev != nil && pindexFirstNotChainValid == nil && (pindex.Status&blockindex.BlockValidMask) < blockindex.BlockValidChain {
+		if pindex.Prev != nil && pindexFirstNotChainValid == nil && !pindex.IsAssumedValid() &&
+			(pindex.Status&blockindex.BlockValidMask) < blockindex.BlockValidChain {
 			pindexFirstNotChainValid = pindex
 		}
-		if pindex.Prev != nil && pindexFirstNotScriptsValid == nil && (pindex.Status&blockindex.BlockValidMask) < blockindex.BlockValidScripts {
+		if pindex.Prev != nil && pindexFirstNotScriptsValid == nil && !pindex.IsAssumedValid() &&
+			(pindex.Status&blockindex.BlockValidMask) < blockindex.BlockValidScripts {
 			pindexFirstNotScriptsValid = pindex
 		}
 
@@ -311,7 +325,8 @@ func CheckBlockIndex() error {
 		if !pruneState.HavePruned {
 			// If we've never pruned, then HAVE_DATA should be equivalent to nTx
 			// > 0
-			if pindex.HasData() != (pindex.TxCount > 0) {
+			// Blocks below a UTXO snapshot have a faked TxCount.
+			if (pindex.HasData() || pindex.IsAssumedValid()) != (pindex.TxCount > 0) {
 				err := fmt.Errorf("TxCount=%d, conflict with HasData()", pindex.TxCount)
 				return err
 			}
@@ -332,7 +347,8 @@ func CheckBlockIndex() error {
 				return errors.New("if pindex HasUndo, it must HasData")
 			}
 		}
-		if ((pindex.Status & blockindex.BlockValidMask) >= blockindex.BlockValidTransactions) != (pindex.TxCount > 0) {
+		if ((pindex.Status&blockindex.BlockValidMask) >= blockindex.BlockValidTransactions || pindex.IsAssumedValid()) !=
+			(pindex.TxCount > 0) {
 			return errors.New("Valid upon Transactions equal TxCount>0, vice versa")
 		}
 		// All parents having had data (at some point) is equivalent to all
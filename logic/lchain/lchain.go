@@ -23,13 +23,13 @@ import (
 
 	"github.com/copernet/copernicus/model/undo"
 	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/persist/blkdb"
 	"github.com/copernet/copernicus/persist/disk"
 
 	"github.com/copernet/copernicus/logic/lblock"
 	mchain "github.com/copernet/copernicus/model/chain"
 	"github.com/copernet/copernicus/model/consensus"
 	"github.com/copernet/copernicus/model/pow"
-	"github.com/copernet/copernicus/persist/db"
 )
 
 func ConnectBlock(pblock *block.Block, pindex *blockindex.BlockIndex, view *utxo.CoinsMap, fJustCheck bool) error {
@@ -63,6 +63,83 @@ func ConnectBlock(pblock *block.Block, pindex *blockindex.BlockIndex, view *utxo
 		return nil
 	}
 
+	fScriptChecks := scriptChecksRequired(pindex)
+
+	time1 := time.Now()
+	gPersist := persist.GetInstance()
+	gPersist.GlobalTimeCheck += time1.Sub(start)
+	log.Print("bench", "debug", " - Sanity checks: current %v [total %v]",
+		time1.Sub(start), gPersist.GlobalTimeCheck)
+
+	// Do not allow blocks that contain transactions which 'overwrite' older
+	// transactions, unless those are already completely spent. If such
+	// overwrites are allowed, coinbases and transactions depending upon those
+	// can be duplicated to remove the ability to spend the first instance --
+	// even after being sent to another address. See BIP30 and
+	// http://r6.ca/blog/20120206T005236Z.html for more information. This logic
+	// is not necessary for memory pool transactions, as AcceptToMemoryPool
+	// already refuses previously-known transaction ids entirely. This rule was
+	// originally applied to all blocks with a timestamp after March 15, 2012,
+	// 0:00 UTC. Now that the whole chain is irreversibly beyond that time it is
+	// applied to all blocks except the two in the chain that violate it. This
+	// prevents exploiting the issue against nodes during their initial block
+	// download.
+	bip30Enable := bip30Enforced(pindex, &blockHash)
+
+	lockTimeFlags := 0
+	if pindex.Height >= gChain.GetParams().CSVHeight {
+		lockTimeFlags |= consensus.LocktimeVerifySequence
+	}
+
+	flags := lblock.GetBlockScriptFlags(pindex.Prev)
+	log.Debug("Connect Block: %s, height: %d, flags: %d", pindex.GetBlockHash().String(), pindex.Height, flags)
+	blockSubSidy := model.GetBlockSubsidy(pindex.Height, params)
+	time2 := time.Now()
+	gPersist.GlobalTimeForks += time2.Sub(time1)
+	log.Print("bench", "debug", " - Fork checks: current %v [total %v]",
+		time2.Sub(time1), gPersist.GlobalTimeForks)
+
+	maxSigOps, errSig := consensus.GetMaxBlockSigOpsCount(uint64(pblock.EncodeSize()))
+	if errSig != nil {
+		return errSig
+	}
+
+	coinsMap, blockUndo, spentIndex, err := ltx.ApplyBlockTransactions(pblock.Txs, bip30Enable, flags,
+		fScriptChecks, blockSubSidy, pindex.Height, maxSigOps, uint32(lockTimeFlags), pindex, gUtxo)
+	if err != nil {
+		return err
+	}
+
+	// Write undo information to disk
+	if !fJustCheck {
+		if err := writeBlockUndo(pindex, blockUndo); err != nil {
+			return err
+		}
+		if len(spentIndex) > 0 {
+			if err := blkdb.GetInstance().WriteSpentIndex(spentIndex); err != nil {
+				return err
+			}
+		}
+		// add this block to the view's block chain
+		ltx.BlockCommitCoins(pblock.Txs, blockUndo, coinsMap, pindex.Height, bip30Enable, gUtxo)
+		*view = *coinsMap
+	}
+
+	// If we just activated the replay protection with that block, it means
+	// transaction in the mempool are now invalid. As a result, we need to clear the mempool.
+	if pindex.IsReplayProtectionJustEnabled() {
+		mempool.InitMempool()
+	}
+
+	log.Debug("Connect block heigh:%d, hash:%s, txs: %d", pindex.Height, blockHash, len(pblock.Txs))
+	return nil
+}
+
+// scriptChecksRequired reports whether the scripts of the block at pindex
+// have to be verified.
+func scriptChecksRequired(pindex *blockindex.BlockIndex) bool {
+	gChain := chain.GetInstance()
+	params := gChain.GetParams()
 	fScriptChecks := true
 	if chain.HashAssumeValid != util.HashZero {
 		// We've been configured with the hash of a block which has been
@@ -96,26 +173,13 @@ func ConnectBlock(pblock *block.Block, pindex *blockindex.BlockIndex, view *utxo
 			}
 		}
 	}
+	return fScriptChecks
+}
 
-	time1 := time.Now()
-	gPersist := persist.GetInstance()
-	gPersist.GlobalTimeCheck += time1.Sub(start)
-	log.Print("bench", "debug", " - Sanity checks: current %v [total %v]",
-		time1.Sub(start), gPersist.GlobalTimeCheck)
-
-	// Do not allow blocks that contain transactions which 'overwrite' older
-	// transactions, unless those are already completely spent. If such
-	// overwrites are allowed, coinbases and transactions depending upon those
-	// can be duplicated to remove the ability to spend the first instance --
-	// even after being sent to another address. See BIP30 and
-	// http://r6.ca/blog/20120206T005236Z.html for more information. This logic
-	// is not necessary for memory pool transactions, as AcceptToMemoryPool
-	// already refuses previously-known transaction ids entirely. This rule was
-	// originally applied to all blocks with a timestamp after March 15, 2012,
-	// 0:00 UTC. Now that the whole chain is irreversibly beyond that time it is
-	// applied to all blocks except the two in the chain that violate it. This
-	// prevents exploiting the issue against nodes during their initial block
-	// download.
+// bip30Enforced reports whether the transactions of the block at pindex may
+// not overwrite unspent coins.
+func bip30Enforced(pindex *blockindex.BlockIndex, blockHash *util.Hash) bool {
+	params := chain.GetInstance().GetParams()
 	//zHash := util.HashZero
 	//fEnforceBIP30 := (!blockHash.IsEqual(&zHash)) ||
 	//	!((pindex.Height == 91842 &&
@@ -139,63 +203,32 @@ func ConnectBlock(pblock *block.Block, pindex *blockindex.BlockIndex, view *utxo
 	// block hash at that height doesn't correspond.
 	bip34Enable := pindexBIP34height != nil && pindexBIP34height.GetBlockHash().IsEqual(&params.BIP34Hash)
 	bip30Enable = bip30Enable && !bip34Enable
+	return bip30Enable
+}
 
-	lockTimeFlags := 0
-	if pindex.Height >= gChain.GetParams().CSVHeight {
-		lockTimeFlags |= consensus.LocktimeVerifySequence
-	}
-
-	flags := lblock.GetBlockScriptFlags(pindex.Prev)
-	log.Debug("Connect Block: %s, height: %d, flags: %d", pindex.GetBlockHash().String(), pindex.Height, flags)
-	blockSubSidy := model.GetBlockSubsidy(pindex.Height, params)
-	time2 := time.Now()
-	gPersist.GlobalTimeForks += time2.Sub(time1)
-	log.Print("bench", "debug", " - Fork checks: current %v [total %v]",
-		time2.Sub(time1), gPersist.GlobalTimeForks)
-
-	maxSigOps, errSig := consensus.GetMaxBlockSigOpsCount(uint64(pblock.EncodeSize()))
-	if errSig != nil {
-		return errSig
-	}
-
-	coinsMap, blockUndo, err := ltx.ApplyBlockTransactions(pblock.Txs, bip30Enable, flags,
-		fScriptChecks, blockSubSidy, pindex.Height, maxSigOps, uint32(lockTimeFlags), pindex)
-	if err != nil {
-		return err
-	}
-
+// writeBlockUndo writes the undo data of the block at pindex, unless it is
+// already on disk, and raises the block to BlockValidScripts.
+func writeBlockUndo(pindex *blockindex.BlockIndex, blockUndo *undo.BlockUndo) error {
+	params := chain.GetInstance().GetParams()
 	undoPos := pindex.GetUndoPos()
-	// Write undo information to disk
-	if !fJustCheck {
-		if undoPos.IsNull() || !pindex.IsValid(blockindex.BlockValidScripts) {
-			if undoPos.IsNull() {
-				pos := block.NewDiskBlockPos(pindex.File, 0)
-				//blockUndo size + hash size + 4bytes len
-				if err := disk.FindUndoPos(pindex.File, pos, blockUndo.SerializeSize()+36); err != nil {
-					return err
-				}
-				if err := disk.UndoWriteToDisk(blockUndo, pos, *pindex.Prev.GetBlockHash(), params.BitcoinNet); err != nil {
-					return err
-				}
-
-				// update nUndoPos in block index
-				pindex.UndoPos = pos.Pos
-				pindex.AddStatus(blockindex.BlockHaveUndo)
+	if undoPos.IsNull() || !pindex.IsValid(blockindex.BlockValidScripts) {
+		if undoPos.IsNull() {
+			pos := block.NewDiskBlockPos(pindex.File, 0)
+			//blockUndo size + hash size + 4bytes len
+			if err := disk.FindUndoPos(pindex.File, pos, blockUndo.SerializeSize()+36); err != nil {
+				return err
+			}
+			if err := disk.UndoWriteToDisk(blockUndo, pos, *pindex.Prev.GetBlockHash(), params.BitcoinNet); err != nil {
+				return err
 			}
-			pindex.RaiseValidity(blockindex.BlockValidScripts)
-			gPersist.AddDirtyBlockIndex(pindex)
-		}
-		// add this block to the view's block chain
-		*view = *coinsMap
-	}
 
-	// If we just activated the replay protection with that block, it means
-	// transaction in the mempool are now invalid. As a result, we need to clear the mempool.
-	if pindex.IsReplayProtectionJustEnabled() {
-		mempool.InitMempool()
+			// update nUndoPos in block index
+			pindex.UndoPos = pos.Pos
+			pindex.AddStatus(blockindex.BlockHaveUndo)
+		}
+		pindex.RaiseValidity(blockindex.BlockValidScripts)
+		persist.GetInstance().AddDirtyBlockIndex(pindex)
 	}
-
-	log.Debug("Connect block heigh:%d, hash:%s, txs: %d", pindex.Height, blockHash, len(pblock.Txs))
 	return nil
 }
 
@@ -271,24 +304,13 @@ func ConnectTip(pIndexNew *blockindex.BlockIndex,
 		nTime4-nTime3, float64(gPersist.GlobalTimeFlush)*0.000001)
 
 	// Write the chain state to disk, if necessary.
-	if err := disk.FlushStateToDisk(disk.FlushStateAlways, 0); err != nil {
+	if err := disk.FlushStateToDisk(disk.FlushStateIfNeeded, 0); err != nil {
 		return err
 	}
 	if pIndexNew.Height >= conf.Cfg.Chain.UtxoHashStartHeight && pIndexNew.Height < conf.Cfg.Chain.UtxoHashEndHeight {
-		cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsLruCache).GetCoinsDB()
-		besthash, err := cdb.GetBestBlock()
-		if err != nil {
-			log.Debug("in utxostats, GetBestBlock(), failed=%v\n", err)
-			return err
-		}
-		var stat stat
-		stat.bestblock = *besthash
-		stat.height = int(mchain.GetInstance().FindBlockIndex(*besthash).Height)
-		iter := cdb.GetDBW().Iterator(nil)
-		iter.Seek([]byte{db.DbCoin})
+		commitment := utxo.GetUtxoCacheInstance().GetCommitment()
 		taskControl.StartLogTask()
-		taskControl.StartUtxoTask()
-		taskControl.PushUtxoTask(utxoTaskArg{iter, &stat})
+		taskControl.PushUtxoResult(utxoCommitmentLog(pIndexNew.Height, &indexHash, commitment))
 	}
 	nTime5 := util.GetTimeMicroSec()
 	gPersist.GlobalTimeChainState += nTime5 - nTime4
@@ -341,7 +363,6 @@ func DisconnectTip(fBare bool) error {
 		if err != nil {
 			panic("view flush error !!!")
 		}
-		utxo.GetUtxoCacheInstance().Flush()
 	}
 	// replace implement with log.Print(in C++).
 	log.Info("bench-debug - Disconnect block : %.2fms\n",
@@ -2,6 +2,7 @@ package lchain_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/copernet/copernicus/conf"
 	"github.com/copernet/copernicus/crypto"
 	"github.com/copernet/copernicus/log"
@@ -12,6 +13,7 @@ import (
 	"github.com/copernet/copernicus/model"
 	"github.com/copernet/copernicus/model/block"
 	"github.com/copernet/copernicus/model/chain"
+	"github.com/copernet/copernicus/model/consensus"
 	"github.com/copernet/copernicus/model/mempool"
 	"github.com/copernet/copernicus/model/opcodes"
 	"github.com/copernet/copernicus/model/outpoint"
@@ -277,7 +279,7 @@ func TestGetUTXOStats(t *testing.T) {
 	pubKey := script.NewEmptyScript()
 	pubKey.PushOpCode(opcodes.OP_TRUE)
 
-	cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsLruCache).GetCoinsDB()
+	cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsViewCache).GetCoinsDB()
 
 	_, err = generateDummyBlocks(pubKey, 100, 1000000, 0, nil)
 	assert.Nil(t, err)
@@ -285,3 +287,325 @@ func TestGetUTXOStats(t *testing.T) {
 	_, err = lchain.GetUTXOStats(cdb)
 	assert.Nil(t, err)
 }
+
+// checkUtxoCommitment checks the commitment maintained by the coins cache
+// against the one written to the coins db and one computed from all the coins.
+func checkUtxoCommitment(t *testing.T) {
+	expected := utxo.GetUtxoCacheInstance().GetCommitment().Hash()
+	assert.Nil(t, disk.FlushStateToDisk(disk.FlushStateAlways, 0))
+
+	cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsViewCache).GetCoinsDB()
+	assert.Equal(t, expected, cdb.GetCommitment().Hash())
+
+	assert.Nil(t, cdb.GetDBW().Erase([]byte{db.DbUtxoCommitment}, true))
+	assert.Equal(t, expected, cdb.GetCommitment().Hash())
+}
+
+func TestUtxoCommitment(t *testing.T) {
+	// set params, don't modify!
+	model.SetRegTestParams()
+	// clear chain data of last test case
+	testDir, err := initTestEnv(t, []string{"--regtest"})
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	tChain := chain.GetInstance()
+	assert.True(t, utxo.GetUtxoCacheInstance().GetCommitment().IsEmpty())
+
+	pubKey := script.NewEmptyScript()
+	pubKey.PushOpCode(opcodes.OP_TRUE)
+	_, err = generateDummyBlocks(pubKey, 101, 1000000, 0, nil)
+	assert.Nil(t, err)
+	checkUtxoCommitment(t)
+	before := utxo.GetUtxoCacheInstance().GetCommitment().Hash()
+
+	block1, ok := disk.ReadBlockFromDisk(tChain.GetIndex(1), tChain.GetParams())
+	assert.True(t, ok)
+	transaction := tx.NewTx(0, tx.DefaultVersion)
+	preOut := outpoint.NewOutPoint(block1.Txs[0].GetHash(), 0)
+	transaction.AddTxIn(txin.NewTxIn(preOut, script.NewEmptyScript(), math.MaxUint32-1))
+	for i := 0; i < 20; i++ {
+		transaction.AddTxOut(txout.NewTxOut(1, pubKey))
+	}
+	_, err = generateDummyBlocks(pubKey, 1, 1000000, 101, []*tx.Tx{transaction})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(102), tChain.TipHeight())
+	assert.NotEqual(t, before, utxo.GetUtxoCacheInstance().GetCommitment().Hash())
+	checkUtxoCommitment(t)
+
+	// Disconnecting the block restores the previous commitment.
+	assert.Nil(t, lchain.DisconnectTip(true))
+	assert.Equal(t, before, utxo.GetUtxoCacheInstance().GetCommitment().Hash())
+	checkUtxoCommitment(t)
+	assert.Nil(t, lchain.ActivateBestChain(nil))
+	assert.Equal(t, int32(102), tChain.TipHeight())
+
+	// A reorganization to a longer branch from the genesis block.
+	_, err = generateDummyBlocks(pubKey, 103, 1000000, 0, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(103), tChain.TipHeight())
+	checkUtxoCommitment(t)
+}
+
+func dumpCoins(cdb utxo.CoinsDB) map[string][]byte {
+	coins := make(map[string][]byte)
+	iter := cdb.GetDBW().Prefix([]byte{db.DbCoin})
+	defer iter.Close()
+	for iter.Next(); iter.Valid(); iter.Next() {
+		coins[string(iter.GetKey())] = iter.GetVal()
+	}
+	return coins
+}
+
+func TestReplayInterruptedFlush(t *testing.T) {
+	// set params, don't modify!
+	model.SetRegTestParams()
+	// clear chain data of last test case
+	testDir, err := initTestEnv(t, []string{"--regtest"})
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	tChain := chain.GetInstance()
+	pubKey := script.NewEmptyScript()
+	pubKey.PushOpCode(opcodes.OP_TRUE)
+	spendCoinbase := func(height int32) *tx.Tx {
+		blk, ok := disk.ReadBlockFromDisk(tChain.GetIndex(height), tChain.GetParams())
+		assert.True(t, ok)
+		transaction := tx.NewTx(0, tx.DefaultVersion)
+		preOut := outpoint.NewOutPoint(blk.Txs[0].GetHash(), 0)
+		transaction.AddTxIn(txin.NewTxIn(preOut, script.NewEmptyScript(), math.MaxUint32-1))
+		for i := 0; i < 20; i++ {
+			transaction.AddTxOut(txout.NewTxOut(1, pubKey))
+		}
+		return transaction
+	}
+
+	// The old best block spends a coinbase on one branch.
+	_, err = generateDummyBlocks(pubKey, 101, 1000000, 0, nil)
+	assert.Nil(t, err)
+	_, err = generateDummyBlocks(pubKey, 1, 1000000, 101, []*tx.Tx{spendCoinbase(1)})
+	assert.Nil(t, err)
+	checkUtxoCommitment(t)
+	cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsViewCache).GetCoinsDB()
+	heads, err := cdb.GetHeadBlocks()
+	assert.Nil(t, err)
+	assert.Empty(t, heads)
+	oldTip := *tChain.Tip().GetBlockHash()
+	oldCoins := dumpCoins(cdb)
+
+	// The new best block spends another coinbase on a longer branch.
+	_, err = generateDummyBlocks(pubKey, 2, 1000000, 101, nil)
+	assert.Nil(t, err)
+	_, err = generateDummyBlocks(pubKey, 1, 1000000, 103, []*tx.Tx{spendCoinbase(2)})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(104), tChain.TipHeight())
+	newTip := *tChain.Tip().GetBlockHash()
+	commitment := utxo.GetUtxoCacheInstance().GetCommitment().Hash()
+	checkUtxoCommitment(t)
+	newCoins := dumpCoins(cdb)
+
+	// Leave the database as a flush from the old to the new best block
+	// interrupted between two batches: some coins are written, others not.
+	dbw := cdb.GetDBW()
+	i := 0
+	for _, coins := range []map[string][]byte{oldCoins, newCoins} {
+		for key := range coins {
+			written := newCoins
+			if i%2 == 1 {
+				written = oldCoins
+			}
+			i++
+			if val, ok := written[key]; ok {
+				assert.Nil(t, dbw.Write([]byte(key), val, false))
+			} else {
+				assert.Nil(t, dbw.Erase([]byte(key), false))
+			}
+		}
+	}
+	assert.Nil(t, dbw.Erase([]byte{db.DbBestBlock}, false))
+	assert.Nil(t, dbw.Erase([]byte{db.DbUtxoCommitment}, false))
+	assert.Nil(t, dbw.Write([]byte{db.DbHeadBlocks}, append(newTip[:], oldTip[:]...), true))
+	assert.NotEqual(t, newCoins, dumpCoins(cdb))
+
+	// Restarting replays the blocks from the old to the new best block.
+	dbw.Close()
+	utxo.InitUtxoLruTip(&utxo.UtxoConfig{Do: &db.DBOption{
+		FilePath:  conf.Cfg.DataDir + "/chainstate",
+		CacheSize: (1 << 20) * 8,
+	}})
+	*tChain = *chain.NewChain()
+	assert.True(t, lblockindex.LoadBlockIndexDB())
+	assert.Equal(t, newTip, *tChain.Tip().GetBlockHash())
+
+	cdb = utxo.GetUtxoCacheInstance().(*utxo.CoinsViewCache).GetCoinsDB()
+	heads, err = cdb.GetHeadBlocks()
+	assert.Nil(t, err)
+	assert.Empty(t, heads)
+	bestBlock, err := cdb.GetBestBlock()
+	assert.Nil(t, err)
+	assert.Equal(t, newTip, *bestBlock)
+	assert.Equal(t, newCoins, dumpCoins(cdb))
+	assert.Equal(t, commitment, utxo.GetUtxoCacheInstance().GetCommitment().Hash())
+	checkUtxoCommitment(t)
+
+	// A bad marker cannot be replayed.
+	assert.Nil(t, cdb.GetDBW().Write([]byte{db.DbHeadBlocks}, util.HashOne[:], true))
+	*tChain = *chain.NewChain()
+	assert.False(t, lblockindex.LoadBlockIndexDB())
+}
+
+// spendCoinbases returns a transaction spending the coinbases of the blocks at
+// heights, with an OP_RETURN output padding it over the minimum transaction
+// size.
+func spendCoinbases(t *testing.T, pubKey *script.Script, heights ...int32) *tx.Tx {
+	tChain := chain.GetInstance()
+	transaction := tx.NewTx(0, tx.DefaultVersion)
+	for _, height := range heights {
+		blk, ok := disk.ReadBlockFromDisk(tChain.GetIndex(height), tChain.GetParams())
+		assert.True(t, ok)
+		preOut := outpoint.NewOutPoint(blk.Txs[0].GetHash(), 0)
+		transaction.AddTxIn(txin.NewTxIn(preOut, script.NewEmptyScript(), math.MaxUint32-1))
+	}
+	transaction.AddTxOut(txout.NewTxOut(1, pubKey))
+	padding := script.NewEmptyScript()
+	padding.PushOpCode(opcodes.OP_RETURN)
+	padding.PushSingleData(make([]byte, 16))
+	transaction.AddTxOut(txout.NewTxOut(0, padding))
+	assert.True(t, transaction.SerializeSize() >= consensus.MinTxSizeUpgrade9)
+	return transaction
+}
+
+func TestSpentIndex(t *testing.T) {
+	// set params, don't modify!
+	model.SetRegTestParams()
+	// clear chain data of last test case
+	testDir, err := initTestEnv(t, []string{"--regtest"})
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+	persist.SpentIndex = true
+	defer func() { persist.SpentIndex = false }()
+
+	tChain := chain.GetInstance()
+	pubKey := script.NewEmptyScript()
+	pubKey.PushOpCode(opcodes.OP_TRUE)
+	_, err = generateDummyBlocks(pubKey, 101, 1000000, 0, nil)
+	assert.Nil(t, err)
+
+	transaction := spendCoinbases(t, pubKey, 1, 2)
+	_, err = generateDummyBlocks(pubKey, 1, 1000000, 101, []*tx.Tx{transaction})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(102), tChain.TipHeight())
+
+	checkSpentIndex := func(spent bool) {
+		for i, in := range transaction.GetIns() {
+			value, err := blkdb.GetInstance().ReadSpentIndex(in.PreviousOutPoint)
+			assert.Nil(t, err)
+			if spent {
+				expected := &blkdb.SpentIndexValue{TxHash: transaction.GetHash(),
+					InputIndex: uint32(i), Height: 102}
+				assert.Equal(t, expected, value)
+			} else {
+				assert.Nil(t, value)
+			}
+		}
+		// The outputs of the transaction are not spent.
+		value, err := blkdb.GetInstance().ReadSpentIndex(outpoint.NewOutPoint(transaction.GetHash(), 0))
+		assert.Nil(t, err)
+		assert.Nil(t, value)
+	}
+	checkSpentIndex(true)
+
+	// Disconnecting the block forgets the spends.
+	assert.Nil(t, lchain.DisconnectTip(true))
+	checkSpentIndex(false)
+	assert.Nil(t, lchain.ActivateBestChain(nil))
+	checkSpentIndex(true)
+
+	// A reorganization to a longer branch without the spends.
+	_, err = generateDummyBlocks(pubKey, 103, 1000000, 0, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(103), tChain.TipHeight())
+	checkSpentIndex(false)
+}
+
+func TestScrubBlockFiles(t *testing.T) {
+	// set params, don't modify!
+	model.SetRegTestParams()
+	// clear chain data of last test case
+	testDir, err := initTestEnv(t, []string{"--regtest"})
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	tChain := chain.GetInstance()
+	pubKey := script.NewEmptyScript()
+	pubKey.PushOpCode(opcodes.OP_TRUE)
+	_, err = generateDummyBlocks(pubKey, 101, 1000000, 0, nil)
+	assert.Nil(t, err)
+	transaction := spendCoinbases(t, pubKey, 1)
+	_, err = generateDummyBlocks(pubKey, 1, 1000000, 101, []*tx.Tx{transaction})
+	assert.Nil(t, err)
+	block1, ok := disk.ReadBlockFromDisk(tChain.GetIndex(1), tChain.GetParams())
+	assert.True(t, ok)
+
+	report, err := disk.ScrubBlockFiles(false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Files)
+	assert.Equal(t, 103, report.Blocks)
+	assert.Equal(t, 102, report.Undos)
+	assert.Equal(t, 0, report.Unreferenced)
+	assert.Empty(t, report.Corrupt)
+
+	// A second copy of block 1 which no block index refers to, and a
+	// corrupt undo record for the tip.
+	pos := block.NewDiskBlockPos(0, 0)
+	assert.True(t, disk.FindBlockPos(pos, uint32(block1.SerializeSize())+4, 1, uint64(block1.Header.Time), false))
+	assert.True(t, disk.WriteBlockToDisk(block1, pos))
+	tip := tChain.Tip()
+	undoPos := tip.GetUndoPos()
+	revFile, err := os.OpenFile(disk.GetBlockPosFilename(undoPos, "rev"), os.O_RDWR, 0)
+	assert.Nil(t, err)
+	_, err = revFile.WriteAt([]byte{0xff, 0xff}, int64(undoPos.Pos)+6)
+	assert.Nil(t, err)
+	revFile.Close()
+
+	report, err = disk.ScrubBlockFiles(false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 104, report.Blocks)
+	assert.Equal(t, 101, report.Undos)
+	assert.Equal(t, 1, report.Unreferenced)
+	if assert.Equal(t, 1, len(report.Corrupt)) {
+		assert.True(t, report.Corrupt[0].Undo)
+		assert.Equal(t, *tip.GetBlockHash(), *report.Corrupt[0].Hash)
+		assert.False(t, report.Corrupt[0].Quarantined)
+	}
+
+	// Start a new block file, so that the first one can be compacted.
+	persist.GetInstance().GlobalLastBlockFile = 1
+	report, err = disk.ScrubBlockFiles(true, true)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(report.Corrupt)) {
+		assert.True(t, report.Corrupt[0].Quarantined)
+	}
+	assert.Equal(t, []int32{0}, report.Compacted)
+	assert.True(t, report.Reclaimed > 0)
+	assert.False(t, tip.HasUndo())
+	_, err = os.Stat(filepath.Join(disk.GetBlockPosParentFilename(), disk.QuarantineDirName,
+		fmt.Sprintf("rev00000-%d.dat", undoPos.Pos)))
+	assert.Nil(t, err)
+	_, err = os.Stat(disk.GetBlockPosFilename(*block.NewDiskBlockPos(0, 0), "blk"))
+	assert.True(t, os.IsNotExist(err))
+
+	// The blocks were moved to the new file.
+	for height := int32(0); height <= tChain.Height(); height++ {
+		index := tChain.GetIndex(height)
+		assert.Equal(t, int32(1), index.File)
+		_, ok := disk.ReadBlockFromDisk(index, tChain.GetParams())
+		assert.True(t, ok)
+	}
+	report, err = disk.ScrubBlockFiles(false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 103, report.Blocks)
+	assert.Equal(t, 101, report.Undos)
+	assert.Equal(t, 0, report.Unreferenced)
+	assert.Empty(t, report.Corrupt)
+}
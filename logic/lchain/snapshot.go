@@ -0,0 +1,363 @@
+package lchain
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/logic/lblock"
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/model/chain"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/persist"
+	"github.com/copernet/copernicus/persist/db"
+	"github.com/copernet/copernicus/persist/disk"
+	"github.com/copernet/copernicus/util"
+)
+
+const snapshotVersion = uint16(1)
+
+var snapshotMagic = [4]byte{'u', 't', 'x', 'o'}
+
+// snapshotMetadataSize is the size of the serialized SnapshotMetadata.
+const snapshotMetadataSize = 4 + 2 + 4 + util.Hash256Size + 4
+
+// snapshotHeaderSize is the size of a serialized block header.
+const snapshotHeaderSize = 80
+
+// SnapshotMetadata describes the block a UTXO set snapshot was taken at. The
+// snapshot holds the headers of the chain up to that block followed by the
+// coins of the UTXO set in coins db order.
+type SnapshotMetadata struct {
+	NetMagic   uint32
+	BaseHash   util.Hash
+	BaseHeight int32
+	CoinsCount uint64
+}
+
+func (sm *SnapshotMetadata) serialize(w io.Writer) error {
+	return util.WriteElements(w, snapshotMagic, snapshotVersion, sm.NetMagic, &sm.BaseHash, sm.BaseHeight)
+}
+
+func (sm *SnapshotMetadata) unserialize(r io.Reader) error {
+	var magic [4]byte
+	var version uint16
+	if err := util.ReadElements(r, &magic, &version); err != nil {
+		return err
+	}
+	if magic != snapshotMagic {
+		return errors.New("invalid UTXO snapshot magic")
+	}
+	if version != snapshotVersion {
+		return fmt.Errorf("unsupported UTXO snapshot version %d", version)
+	}
+	return util.ReadElements(r, &sm.NetMagic, &sm.BaseHash, &sm.BaseHeight)
+}
+
+// DumpTxOutSet writes a snapshot of the UTXO set of cdb to path. The coins db
+// must not be modified meanwhile, and the chain up to its best block must be
+// the active chain.
+func DumpTxOutSet(cdb utxo.CoinsDB, path string) (*UTXOStat, error) {
+	bestHash, err := cdb.GetBestBlock()
+	if err != nil {
+		return nil, err
+	}
+	gChain := chain.GetInstance()
+	base := gChain.FindBlockIndex(*bestHash)
+	if base == nil || !gChain.Contains(base) {
+		return nil, fmt.Errorf("the best block %s of the UTXO set is not in the active chain", bestHash)
+	}
+
+	tmpPath := path + ".incomplete"
+	f, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpPath)
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	meta := SnapshotMetadata{
+		NetMagic:   uint32(gChain.GetParams().BitcoinNet),
+		BaseHash:   *bestHash,
+		BaseHeight: base.Height,
+	}
+	if err = meta.serialize(w); err != nil {
+		return nil, err
+	}
+	for height := int32(1); height <= base.Height; height++ {
+		if err = base.GetAncestor(height).Header.Serialize(w); err != nil {
+			return nil, err
+		}
+	}
+	// The coins count is only known once the coins are written.
+	countOffset := int64(snapshotMetadataSize) + int64(base.Height)*snapshotHeaderSize
+	if err = util.WriteElements(w, meta.CoinsCount); err != nil {
+		return nil, err
+	}
+
+	sh := newStatsHasher(bestHash, int(base.Height))
+	iter := cdb.GetDBW().Iterator(nil)
+	defer iter.Close()
+	iter.Seek([]byte{db.DbCoin})
+	for ; iter.Valid() && iter.GetKey()[0] == db.DbCoin; iter.Next() {
+		outPoint := &outpoint.OutPoint{}
+		if err = outPoint.Unserialize(bytes.NewBuffer(iter.GetKey()[1:])); err != nil {
+			return nil, err
+		}
+		coin := utxo.NewEmptyCoin()
+		if err = coin.Unserialize(bytes.NewBuffer(iter.GetVal())); err != nil {
+			return nil, err
+		}
+		if err = sh.add(outPoint, coin); err != nil {
+			return nil, err
+		}
+		if err = outPoint.Serialize(w); err != nil {
+			return nil, err
+		}
+		if err = coin.Serialize(w); err != nil {
+			return nil, err
+		}
+		meta.CoinsCount++
+	}
+	stat, err := sh.finish()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = w.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(countOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err = util.WriteElements(f, meta.CoinsCount); err != nil {
+		return nil, err
+	}
+	if err = f.Sync(); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return nil, err
+	}
+	log.Info("Dumped %d coins of the UTXO set at block %s (height %d) to %s",
+		meta.CoinsCount, bestHash, base.Height, path)
+
+	return &UTXOStat{
+		Height:         stat.height,
+		BestBlock:      stat.bestblock,
+		TxCount:        stat.nTx,
+		TxOutsCount:    stat.nTxOuts,
+		HashSerialized: stat.hashSerialized,
+		Amount:         stat.amount,
+		BogoSize:       stat.bogoSize,
+	}, nil
+}
+
+// snapshotReader reads the parts of a UTXO snapshot file in order.
+type snapshotReader struct {
+	f    *os.File
+	r    *bufio.Reader
+	meta SnapshotMetadata
+}
+
+func openSnapshot(path string) (*snapshotReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sr := &snapshotReader{f: f, r: bufio.NewReader(f)}
+	if err = sr.meta.unserialize(sr.r); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("invalid UTXO snapshot %s: %v", path, err)
+	}
+	return sr, nil
+}
+
+func (sr *snapshotReader) Close() error {
+	return sr.f.Close()
+}
+
+func (sr *snapshotReader) readHeaders(fn func(header *block.BlockHeader) error) error {
+	for height := int32(1); height <= sr.meta.BaseHeight; height++ {
+		header := block.NewBlockHeader()
+		if err := header.Unserialize(sr.r); err != nil {
+			return err
+		}
+		if err := fn(header); err != nil {
+			return err
+		}
+	}
+	return util.ReadElements(sr.r, &sr.meta.CoinsCount)
+}
+
+// rewindCoins positions the reader on the first coin again.
+func (sr *snapshotReader) rewindCoins() error {
+	offset := int64(snapshotMetadataSize) + int64(sr.meta.BaseHeight)*snapshotHeaderSize + 8
+	if _, err := sr.f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	sr.r.Reset(sr.f)
+	return nil
+}
+
+func (sr *snapshotReader) readCoins(fn func(outPoint *outpoint.OutPoint, coin *utxo.Coin) error) error {
+	for i := uint64(0); i < sr.meta.CoinsCount; i++ {
+		outPoint := &outpoint.OutPoint{}
+		if err := outPoint.Unserialize(sr.r); err != nil {
+			return fmt.Errorf("bad snapshot, only %d of %d coins could be read: %v", i, sr.meta.CoinsCount, err)
+		}
+		coin := utxo.NewEmptyCoin()
+		if err := coin.Unserialize(sr.r); err != nil {
+			return fmt.Errorf("bad snapshot, only %d of %d coins could be read: %v", i, sr.meta.CoinsCount, err)
+		}
+		if err := fn(outPoint, coin); err != nil {
+			return err
+		}
+	}
+	if _, err := sr.r.ReadByte(); err != io.EOF {
+		return errors.New("bad snapshot, more coins than the coins count")
+	}
+	return nil
+}
+
+// LoadSnapshot replaces the empty chain state with the UTXO snapshot at path,
+// which must be based on a block committed in the AssumeUTXO chain params. The
+// headers up to the base block are validated and the UTXO set is checked
+// against the committed hash before anything is written to the coins db. The
+// blocks below the base block are marked as assumed valid, and the node then
+// syncs forward from the base block. They stay assumed valid until the
+// background validation started by StartBackgroundValidation connects them.
+func LoadSnapshot(path string) error {
+	gChain := chain.GetInstance()
+	if gChain.Height() != 0 {
+		return errors.New("a UTXO snapshot can only be loaded into an empty chain state")
+	}
+	params := gChain.GetParams()
+
+	sr, err := openSnapshot(path)
+	if err != nil {
+		return err
+	}
+	defer sr.Close()
+	meta := &sr.meta
+
+	if meta.NetMagic != uint32(params.BitcoinNet) {
+		return fmt.Errorf("the UTXO snapshot is not for the %s network", params.Name)
+	}
+	data := params.AssumeUTXOForBlock(&meta.BaseHash)
+	if data == nil {
+		return fmt.Errorf("assumeutxo block hash in snapshot metadata not recognized (%s)", meta.BaseHash)
+	}
+	if data.Height != meta.BaseHeight {
+		return fmt.Errorf("bad snapshot, base height %d does not match the assumeutxo height %d",
+			meta.BaseHeight, data.Height)
+	}
+	log.Info("Loading UTXO snapshot at block %s (height %d) from %s", meta.BaseHash, meta.BaseHeight, path)
+
+	// Validate and index the headers up to the base block.
+	base := gChain.Genesis()
+	err = sr.readHeaders(func(header *block.BlockHeader) error {
+		index, err := lblock.AcceptBlockHeader(header)
+		if err != nil {
+			return fmt.Errorf("bad snapshot, invalid header %s: %v", header.GetHash(), err)
+		}
+		if index.Prev != base {
+			return fmt.Errorf("bad snapshot, header %s does not follow the previous one", header.GetHash())
+		}
+		base = index
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if *base.GetBlockHash() != meta.BaseHash {
+		return errors.New("bad snapshot, the headers do not end at the base block")
+	}
+
+	// Check the UTXO set before writing anything to the coins db.
+	sh := newStatsHasher(&meta.BaseHash, int(meta.BaseHeight))
+	if err = sr.readCoins(sh.add); err != nil {
+		return err
+	}
+	stat, err := sh.finish()
+	if err != nil {
+		return err
+	}
+	if stat.hashSerialized != *data.HashSerialized {
+		return fmt.Errorf("bad snapshot content hash: expected %s, got %s",
+			data.HashSerialized, stat.hashSerialized)
+	}
+
+	// The load is recorded in the coins db until the coins and the block
+	// index are all written. The coins of a load interrupted meanwhile are
+	// wiped when the coins db is opened again, and its headers discarded.
+	if err = sr.rewindCoins(); err != nil {
+		return err
+	}
+	coinsTip := utxo.GetUtxoCacheInstance()
+	cdb := coinsTip.(*utxo.CoinsViewCache).GetCoinsDB()
+	genesisHash := gChain.Genesis().GetBlockHash()
+	if err = cdb.WriteSnapshotLoad(genesisHash); err != nil {
+		return err
+	}
+	view := utxo.NewEmptyCoinsMap()
+	err = sr.readCoins(func(outPoint *outpoint.OutPoint, coin *utxo.Coin) error {
+		txOut := coin.GetTxOut()
+		freshCoin := utxo.NewFreshCoin(&txOut, coin.GetHeight(), coin.IsCoinBase())
+		view.AddCoin(outPoint, freshCoin, false)
+		view.CommitCoin(outPoint, freshCoin)
+		if len(view.GetMap()) < 10000 {
+			return nil
+		}
+		if err := coinsTip.UpdateCoins(view, genesisHash); err != nil {
+			return err
+		}
+		if coinsTip.DynamicMemoryUsage() > persist.CoinCacheUsage && !coinsTip.Flush() {
+			return errors.New("failed to write the snapshot coins")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = coinsTip.UpdateCoins(view, &meta.BaseHash); err != nil {
+		return err
+	}
+
+	// The blocks below the base block were not validated. Their transaction
+	// counts are faked so that they link to the base block when loaded.
+	gPersist := persist.GetInstance()
+	for height := int32(1); height <= base.Height; height++ {
+		index := base.GetAncestor(height)
+		if index.TxCount == 0 {
+			index.TxCount = 1
+		}
+		index.ChainTxCount = index.Prev.ChainTxCount + index.TxCount
+		if !index.IsValid(blockindex.BlockValidScripts) {
+			index.AddStatus(blockindex.BlockAssumedValid)
+		}
+		gPersist.AddDirtyBlockIndex(index)
+	}
+	if err = gChain.AddToBranch(base); err != nil {
+		return err
+	}
+	base.ChainTxCount = data.ChainTxCount
+	gChain.SetTip(base)
+
+	if err = disk.FlushStateToDisk(disk.FlushStateAlways, 0); err != nil {
+		return err
+	}
+	if err = cdb.EraseSnapshotLoad(); err != nil {
+		return err
+	}
+	log.Info("Loaded %d coins of the UTXO snapshot, chain tip is now %s (height %d)",
+		meta.CoinsCount, meta.BaseHash, meta.BaseHeight)
+	return nil
+}
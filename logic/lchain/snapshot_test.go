@@ -0,0 +1,341 @@
+package lchain_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/logic/lblockindex"
+	"github.com/copernet/copernicus/logic/lchain"
+	"github.com/copernet/copernicus/logic/lmerkleroot"
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/model/chain"
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/pow"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/persist"
+	"github.com/copernet/copernicus/persist/db"
+	"github.com/copernet/copernicus/persist/disk"
+	"github.com/copernet/copernicus/service"
+	"github.com/copernet/copernicus/service/mining"
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// The regtest UTXO snapshot committed in the chain params is taken on a fresh
+// regtest node after "setmocktime 1600000000" and "generatetoaddress 110
+// mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r", the address of the compressed public
+// key of the private key 1.
+const (
+	regtestSnapshotMockTime = 1600000000
+	regtestSnapshotAddress  = "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r"
+	regtestSnapshotBlocks   = 110
+)
+
+// generateToAddress mines blocks paying to scriptPubKey as the
+// generatetoaddress rpc call does.
+func generateToAddress(scriptPubKey *script.Script, generate int) error {
+	params := model.ActiveNetParams
+	maxTries := uint64(1000000)
+	var extraNonce uint
+	for mined := 0; mined < generate; {
+		ba := mining.NewBlockAssembler(params)
+		bt := ba.CreateNewBlock(scriptPubKey, mining.CoinbaseScriptSig(extraNonce))
+		if bt == nil {
+			return errors.New("could not create new block")
+		}
+		bt.Block.Header.MerkleRoot = lmerkleroot.BlockMerkleRoot(bt.Block.Txs, nil)
+
+		powCheck := pow.Pow{}
+		for maxTries > 0 && bt.Block.Header.Nonce < 0x100000 {
+			maxTries--
+			bt.Block.Header.Nonce++
+			hash := bt.Block.GetHash()
+			if powCheck.CheckProofOfWork(&hash, bt.Block.Header.Bits, params) {
+				break
+			}
+		}
+		if maxTries == 0 {
+			return errors.New("no block found")
+		}
+		if bt.Block.Header.Nonce == 0x100000 {
+			extraNonce++
+			continue
+		}
+
+		fNewBlock := false
+		if err := service.ProcessNewBlock(bt.Block, true, &fNewBlock); err != nil {
+			return err
+		}
+		mined++
+		extraNonce = 0
+	}
+	return nil
+}
+
+// mineRegtestSnapshotChain mines the chain of the regtest UTXO snapshot on a
+// fresh node, the mock time must be set by the caller.
+func mineRegtestSnapshotChain(t *testing.T) string {
+	testDir, err := initTestEnv(t, []string{"--regtest"})
+	assert.Nil(t, err)
+
+	addr, err := script.AddressFromString(regtestSnapshotAddress)
+	assert.Nil(t, err)
+	scriptPubKey := script.NewEmptyScript()
+	scriptPubKey.PushOpCode(opcodes.OP_DUP)
+	scriptPubKey.PushOpCode(opcodes.OP_HASH160)
+	scriptPubKey.PushSingleData(addr.EncodeToPubKeyHash())
+	scriptPubKey.PushOpCode(opcodes.OP_EQUALVERIFY)
+	scriptPubKey.PushOpCode(opcodes.OP_CHECKSIG)
+	assert.Nil(t, generateToAddress(scriptPubKey, regtestSnapshotBlocks))
+	assert.Nil(t, disk.FlushStateToDisk(disk.FlushStateAlways, 0))
+	return testDir
+}
+
+func TestRegtestAssumeUTXO(t *testing.T) {
+	// set params, don't modify!
+	model.SetRegTestParams()
+	util.SetMockTime(regtestSnapshotMockTime)
+	defer util.SetMockTime(0)
+
+	testDir := mineRegtestSnapshotChain(t)
+	defer os.RemoveAll(testDir)
+
+	tip := chain.GetInstance().Tip()
+	cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsViewCache).GetCoinsDB()
+	stat, err := lchain.GetUTXOStats(cdb)
+	assert.Nil(t, err)
+	t.Logf("height %d block %s hash_serialized %s nchaintx %d", tip.Height, tip.GetBlockHash(),
+		stat.HashSerialized, tip.ChainTxCount)
+
+	data := model.RegressionNetParams.AssumeUTXOForBlock(tip.GetBlockHash())
+	if assert.NotNil(t, data) {
+		assert.Equal(t, tip.Height, data.Height)
+		assert.Equal(t, *data.HashSerialized, stat.HashSerialized)
+		assert.Equal(t, tip.ChainTxCount, data.ChainTxCount)
+	}
+}
+
+func TestDumpAndLoadSnapshot(t *testing.T) {
+	// set params, don't modify!
+	model.SetRegTestParams()
+	defer func(assumeUTXO []*model.AssumeUTXOData) {
+		model.RegressionNetParams.AssumeUTXO = assumeUTXO
+	}(model.RegressionNetParams.AssumeUTXO)
+
+	snapshotDir, err := ioutil.TempDir("", "snapshot")
+	assert.Nil(t, err)
+	defer os.RemoveAll(snapshotDir)
+	snapshotPath := filepath.Join(snapshotDir, "utxo.dat")
+
+	testDir, err := initTestEnv(t, []string{"--regtest"})
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	pubKey := script.NewEmptyScript()
+	pubKey.PushOpCode(opcodes.OP_TRUE)
+	_, err = generateDummyBlocks(pubKey, 110, 1000000, 0, nil)
+	assert.Nil(t, err)
+	base := chain.GetInstance().Tip()
+	baseHash := *base.GetBlockHash()
+	baseChainTxCount := base.ChainTxCount
+
+	assert.Nil(t, disk.FlushStateToDisk(disk.FlushStateAlways, 0))
+	cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsViewCache).GetCoinsDB()
+	expected, err := lchain.GetUTXOStats(cdb)
+	assert.Nil(t, err)
+
+	dumped, err := lchain.DumpTxOutSet(cdb, snapshotPath)
+	assert.Nil(t, err)
+	assert.Equal(t, int(base.Height), dumped.Height)
+	assert.Equal(t, baseHash, dumped.BestBlock)
+	assert.Equal(t, expected.TxOutsCount, dumped.TxOutsCount)
+	assert.Equal(t, expected.HashSerialized, dumped.HashSerialized)
+	assert.Equal(t, expected.Amount, dumped.Amount)
+
+	// Bootstrap an empty node from the snapshot.
+	testDir2, err := initTestEnv(t, []string{"--regtest"})
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir2)
+
+	assert.Error(t, lchain.LoadSnapshot(snapshotPath), "the base block is not committed in the params")
+
+	wrongHash := util.HashOne
+	model.RegressionNetParams.AssumeUTXO = []*model.AssumeUTXOData{
+		{Height: base.Height, BlockHash: &baseHash, HashSerialized: &wrongHash, ChainTxCount: baseChainTxCount},
+	}
+	err = lchain.LoadSnapshot(snapshotPath)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bad snapshot content hash")
+	assert.Equal(t, int32(0), chain.GetInstance().Height())
+	assert.Equal(t, 0, utxo.GetUtxoCacheInstance().GetCacheSize())
+
+	model.RegressionNetParams.AssumeUTXO[0].HashSerialized = &expected.HashSerialized
+	assert.Nil(t, lchain.LoadSnapshot(snapshotPath))
+
+	gChain := chain.GetInstance()
+	tip := gChain.Tip()
+	assert.Equal(t, baseHash, *tip.GetBlockHash())
+	assert.Equal(t, baseChainTxCount, tip.ChainTxCount)
+	assert.True(t, tip.IsAssumedValid())
+	assert.True(t, gChain.GetIndex(1).IsAssumedValid())
+	assert.False(t, gChain.GetIndex(1).HasData())
+
+	cdb = utxo.GetUtxoCacheInstance().(*utxo.CoinsViewCache).GetCoinsDB()
+	loaded, err := lchain.GetUTXOStats(cdb)
+	assert.Nil(t, err)
+	assert.Equal(t, expected.HashSerialized, loaded.HashSerialized)
+	assert.Equal(t, expected.TxOutsCount, loaded.TxOutsCount)
+
+	assert.Error(t, lchain.LoadSnapshot(snapshotPath), "the chain state is not empty anymore")
+
+	// A load which did not complete is discarded on restart.
+	assert.Nil(t, cdb.WriteSnapshotLoad(gChain.Genesis().GetBlockHash()))
+	cdb.GetDBW().Close()
+	utxo.InitUtxoLruTip(&utxo.UtxoConfig{Do: &db.DBOption{
+		FilePath:  conf.Cfg.DataDir + "/chainstate",
+		CacheSize: (1 << 20) * 8,
+	}})
+	*gChain = *chain.NewChain()
+	assert.True(t, lblockindex.LoadBlockIndexDB())
+	assert.Equal(t, int32(0), gChain.Height())
+	discarded := gChain.FindBlockIndex(baseHash)
+	assert.False(t, discarded.IsAssumedValid())
+	assert.Equal(t, int32(0), discarded.TxCount)
+	cdb = utxo.GetUtxoCacheInstance().(*utxo.CoinsViewCache).GetCoinsDB()
+	wiped, err := lchain.GetUTXOStats(cdb)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), wiped.TxOutsCount)
+	oldTip, err := cdb.GetSnapshotLoad()
+	assert.Nil(t, err)
+	assert.Nil(t, oldTip)
+
+	assert.Nil(t, lchain.LoadSnapshot(snapshotPath))
+	tip = gChain.Tip()
+	assert.Equal(t, baseHash, *tip.GetBlockHash())
+	assert.Equal(t, baseChainTxCount, tip.ChainTxCount)
+	assert.True(t, gChain.GetIndex(1).IsAssumedValid())
+
+	// The node keeps syncing from the base block.
+	_, err = generateDummyBlocks(pubKey, 2, 1000000, base.Height, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, base.Height+2, gChain.Height())
+	assert.False(t, gChain.Tip().IsAssumedValid())
+	assert.Equal(t, baseChainTxCount+2, gChain.Tip().ChainTxCount)
+
+	// The snapshot chain state survives a restart.
+	assert.Nil(t, disk.FlushStateToDisk(disk.FlushStateAlways, 0))
+	tipHash := *gChain.Tip().GetBlockHash()
+	*gChain = *chain.NewChain()
+	assert.True(t, lblockindex.LoadBlockIndexDB())
+	assert.Equal(t, tipHash, *gChain.Tip().GetBlockHash())
+	assert.Equal(t, baseChainTxCount, gChain.GetIndex(base.Height).ChainTxCount)
+	assert.Equal(t, baseChainTxCount+2, gChain.Tip().ChainTxCount)
+}
+
+// waitBackgroundValidation waits for the background validation to reach the
+// state reported by done.
+func waitBackgroundValidation(t *testing.T, done func() bool) {
+	for i := 0; i < 300; i++ {
+		persist.CsMain.RLock()
+		ok := done()
+		persist.CsMain.RUnlock()
+		if ok {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("the background validation did not complete")
+}
+
+func TestBackgroundValidation(t *testing.T) {
+	// set params, don't modify!
+	model.SetRegTestParams()
+	util.SetMockTime(regtestSnapshotMockTime)
+	defer util.SetMockTime(0)
+	data := model.RegressionNetParams.AssumeUTXO[0]
+	defer func(hashSerialized *util.Hash) { data.HashSerialized = hashSerialized }(data.HashSerialized)
+
+	snapshotDir, err := ioutil.TempDir("", "snapshot")
+	assert.Nil(t, err)
+	defer os.RemoveAll(snapshotDir)
+	snapshotPath := filepath.Join(snapshotDir, "utxo.dat")
+
+	testDir := mineRegtestSnapshotChain(t)
+	defer os.RemoveAll(testDir)
+	gChain := chain.GetInstance()
+	base := gChain.Tip()
+	blocks := make([]*block.Block, 0, base.Height)
+	for height := int32(1); height <= base.Height; height++ {
+		blk, ok := disk.ReadBlockFromDisk(gChain.GetIndex(height), gChain.GetParams())
+		assert.True(t, ok)
+		blocks = append(blocks, blk)
+	}
+	cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsViewCache).GetCoinsDB()
+	_, err = lchain.DumpTxOutSet(cdb, snapshotPath)
+	assert.Nil(t, err)
+
+	// Bootstrap an empty node from the snapshot, then download the history.
+	testDir2, err := initTestEnv(t, []string{"--regtest"})
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir2)
+	assert.Nil(t, lchain.LoadSnapshot(snapshotPath))
+	base = gChain.Tip()
+	for _, blk := range blocks {
+		fNewBlock := false
+		assert.Nil(t, service.ProcessNewBlock(blk, true, &fNewBlock))
+	}
+	assert.Equal(t, base, gChain.Tip())
+	assert.True(t, gChain.GetIndex(1).HasData())
+	assert.True(t, gChain.GetIndex(1).IsAssumedValid())
+
+	bgDir := filepath.Join(conf.Cfg.DataDir, "chainstate_background")
+	bgDbCfg := &db.DBOption{FilePath: bgDir, CacheSize: (1 << 20) * 8}
+
+	// The history stays assumed valid when its UTXO set does not match.
+	wrongHash := util.HashOne
+	hashSerialized := data.HashSerialized
+	data.HashSerialized = &wrongHash
+	assert.Nil(t, lchain.StartBackgroundValidation(bgDbCfg))
+	waitBackgroundValidation(t, lchain.BackgroundValidationFailed)
+	lchain.StopBackgroundValidation()
+	assert.True(t, gChain.GetIndex(1).IsAssumedValid())
+	assert.True(t, base.IsAssumedValid())
+
+	// The validation resumes from the background chain state it wrote.
+	data.HashSerialized = hashSerialized
+	assert.Nil(t, lchain.StartBackgroundValidation(bgDbCfg))
+	next, _ := lchain.BackgroundValidationRange()
+	assert.Nil(t, next)
+	waitBackgroundValidation(t, func() bool { return !base.IsAssumedValid() })
+	lchain.StopBackgroundValidation()
+
+	for height := int32(1); height <= base.Height; height++ {
+		index := gChain.GetIndex(height)
+		assert.False(t, index.IsAssumedValid())
+		assert.True(t, index.IsValid(blockindex.BlockValidScripts))
+		assert.True(t, index.HasUndo())
+		assert.Equal(t, height+1, index.ChainTxCount)
+	}
+	assert.Equal(t, data.ChainTxCount, base.ChainTxCount)
+	assert.Nil(t, lchain.CheckBlockIndex())
+	_, err = os.Stat(bgDir)
+	assert.True(t, os.IsNotExist(err))
+
+	// Nothing is left to validate after a restart.
+	*gChain = *chain.NewChain()
+	assert.True(t, lblockindex.LoadBlockIndexDB())
+	assert.False(t, gChain.GetIndex(1).IsAssumedValid())
+	assert.Equal(t, int32(2), gChain.GetIndex(1).ChainTxCount)
+	assert.Nil(t, lchain.StartBackgroundValidation(bgDbCfg))
+	next, _ = lchain.BackgroundValidationRange()
+	assert.Nil(t, next)
+	assert.False(t, lchain.BackgroundValidationFailed())
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"fmt"
+	"hash"
 	"os"
 	"path/filepath"
 	"sort"
@@ -11,17 +12,15 @@ import (
 	"time"
 
 	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/crypto"
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/model/chain"
 	"github.com/copernet/copernicus/model/outpoint"
 	"github.com/copernet/copernicus/model/utxo"
 	"github.com/copernet/copernicus/persist/db"
 	"github.com/copernet/copernicus/util"
-	"strconv"
 )
 
-var timeFile *os.File
-
 type stat struct {
 	height         int
 	bestblock      util.Hash
@@ -43,11 +42,6 @@ type UTXOStat struct {
 	DiskSize       uint64
 }
 
-func (s *stat) String() string {
-	return fmt.Sprintf("height=%d,bestblock=%s,hash_serialized=%s\n",
-		s.height, s.bestblock, s.hashSerialized)
-}
-
 func applyStats(stat *stat, hashbuf *bytes.Buffer, txid *util.Hash, outputs map[uint32]*utxo.Coin) error {
 	txIndexSort := []uint32{}
 	for k := range outputs {
@@ -87,26 +81,71 @@ func applyStats(stat *stat, hashbuf *bytes.Buffer, txid *util.Hash, outputs map[
 	return err
 }
 
+// statsHasher accumulates the statistics of a UTXO set from its coins, which
+// are given ordered as in the coins db, so that the outputs of a transaction
+// are consecutive.
+type statsHasher struct {
+	stat     *stat
+	hasher   hash.Hash
+	prevHash util.Hash
+	outputs  map[uint32]*utxo.Coin
+}
+
+func newStatsHasher(bestBlock *util.Hash, height int) *statsHasher {
+	sh := &statsHasher{
+		stat:    &stat{height: height, bestblock: *bestBlock},
+		hasher:  sha256.New(),
+		outputs: make(map[uint32]*utxo.Coin),
+	}
+	sh.hasher.Write(bestBlock[:])
+	return sh
+}
+
+func (sh *statsHasher) add(outPoint *outpoint.OutPoint, coin *utxo.Coin) error {
+	if outPoint.Hash != sh.prevHash && len(sh.outputs) > 0 {
+		if err := sh.applyOutputs(); err != nil {
+			return err
+		}
+	}
+	sh.prevHash = outPoint.Hash
+	sh.outputs[outPoint.Index] = coin
+	return nil
+}
+
+func (sh *statsHasher) applyOutputs() error {
+	hashBuf := bytes.NewBuffer(nil)
+	if err := applyStats(sh.stat, hashBuf, &sh.prevHash, sh.outputs); err != nil {
+		return err
+	}
+	sh.hasher.Write(hashBuf.Bytes())
+	sh.outputs = make(map[uint32]*utxo.Coin)
+	return nil
+}
+
+// finish returns the statistics of the coins added so far.
+func (sh *statsHasher) finish() (*stat, error) {
+	if len(sh.outputs) > 0 {
+		if err := sh.applyOutputs(); err != nil {
+			return nil, err
+		}
+	}
+	copy(sh.stat.hashSerialized[:], sh.hasher.Sum(nil))
+	return sh.stat, nil
+}
+
 func GetUTXOStats(cdb utxo.CoinsDB) (*UTXOStat, error) {
-	stat := &stat{}
 	b := time.Now()
 	besthash, err := cdb.GetBestBlock()
 	if err != nil {
 		log.Debug("in GetUTXOStats, GetBestBlock(), failed=%v\n", err)
 		return nil, err
 	}
-	stat.bestblock = *besthash
-	stat.height = int(chain.GetInstance().FindBlockIndex(*besthash).Height)
-
-	h := sha256.New()
-	h.Write(stat.bestblock[:])
+	sh := newStatsHasher(besthash, int(chain.GetInstance().FindBlockIndex(*besthash).Height))
 
 	iter := cdb.GetDBW().Iterator(nil)
 	defer iter.Close()
 	iter.Seek([]byte{db.DbCoin})
 
-	var prevHash util.Hash
-	outputs := make(map[uint32]*utxo.Coin)
 	for ; iter.Valid() && iter.GetKey()[0] == db.DbCoin; iter.Next() {
 		outPoint := &outpoint.OutPoint{}
 		if err = outPoint.Unserialize(bytes.NewBuffer(iter.GetKey()[1:])); err != nil {
@@ -116,25 +155,14 @@ func GetUTXOStats(cdb utxo.CoinsDB) (*UTXOStat, error) {
 		if err = coin.Unserialize(bytes.NewBuffer(iter.GetVal())); err != nil {
 			return nil, err
 		}
-		if outPoint.Hash != prevHash && len(outputs) > 0 {
-			hashBuf := bytes.NewBuffer(nil)
-			if err = applyStats(stat, hashBuf, &prevHash, outputs); err != nil {
-				return nil, err
-			}
-			h.Write(hashBuf.Bytes())
-			outputs = make(map[uint32]*utxo.Coin)
-		}
-		prevHash = outPoint.Hash
-		outputs[outPoint.Index] = coin
-	}
-	if len(outputs) > 0 {
-		hashBuf := bytes.NewBuffer(nil)
-		if err = applyStats(stat, hashBuf, &prevHash, outputs); err != nil {
+		if err = sh.add(outPoint, coin); err != nil {
 			return nil, err
 		}
-		h.Write(hashBuf.Bytes())
 	}
-	copy(stat.hashSerialized[:], h.Sum(nil))
+	stat, err := sh.finish()
+	if err != nil {
+		return nil, err
+	}
 
 	utxoStat := &UTXOStat{
 		Height:         stat.height,
@@ -151,55 +179,44 @@ func GetUTXOStats(cdb utxo.CoinsDB) (*UTXOStat, error) {
 	return utxoStat, nil
 }
 
-type utxoTaskArg struct {
-	iter *db.IterWrapper
-	stat *stat
-}
-
+// utxoTaskControl writes the UTXO commitments logged between the
+// -utxohashstartheight and -utxohashendheight heights to logs/utxo.log.
 type utxoTaskControl struct {
 	utxoResult chan string
-	utxoTask   chan utxoTaskArg
 	done       chan struct{}
-	numWorker  int
-	numTask    int
 	logOnce    sync.Once
-	utxoOnce   sync.Once
 }
 
 var taskControl *utxoTaskControl
 
 func init() {
-	taskControl = newUtxoTaskControl(1, 16)
+	taskControl = newUtxoTaskControl(16)
 }
 
-func newUtxoTaskControl(numTask, numWorker int) *utxoTaskControl {
+func newUtxoTaskControl(numTask int) *utxoTaskControl {
 	if numTask < 0 {
 		numTask = 0
 	}
-	if numWorker < 0 {
-		numWorker = 1
-	}
 	return &utxoTaskControl{
 		utxoResult: make(chan string, numTask),
-		utxoTask:   make(chan utxoTaskArg, numTask),
-		numWorker:  numWorker,
-		numTask:    numTask,
 		done:       make(chan struct{}),
 	}
 }
 
-func (tc *utxoTaskControl) PushUtxoTask(arg utxoTaskArg) {
-	tc.utxoTask <- arg
+// PushUtxoResult queues a line for the log, dropping it if the log writer
+// falls behind.
+func (tc *utxoTaskControl) PushUtxoResult(str string) {
+	select {
+	case tc.utxoResult <- str:
+	default:
+		log.Debug("utxo log is full, dropping: %s", str)
+	}
 }
 
 func (tc *utxoTaskControl) StartLogTask() {
 	tc.logOnce.Do(tc.startLogTask)
 }
 
-func (tc *utxoTaskControl) StartUtxoTask() {
-	tc.utxoOnce.Do(tc.startUtxoTask)
-}
-
 func (tc *utxoTaskControl) Stop() {
 	close(tc.done)
 }
@@ -226,108 +243,7 @@ func (tc *utxoTaskControl) startLogTask() {
 	}()
 }
 
-func (tc *utxoTaskControl) startUtxoTask() {
-	var err error
-	timeFile, err = os.OpenFile(filepath.Join(conf.DataDir, "logs/utxo_stat.log"), os.O_APPEND|os.O_RDWR|os.O_CREATE, 0640)
-	if err != nil {
-		log.Debug("os.OpenFile() failed with : %s", err)
-		return
-	}
-	for i := 0; i < tc.numWorker; i++ {
-		go func() {
-			for {
-				select {
-				case <-tc.done:
-					return
-				case arg := <-tc.utxoTask:
-					//t1 := time.Now()
-					utxoStat(arg.iter, arg.stat, tc.utxoResult)
-					//statElasped := time.Since(t1)
-					//if _, err := timeFile.WriteString("height: " + strconv.Itoa(arg.stat.height) + ", stat time: " + statElasped.String() + "\n"); err != nil {
-					//	panic("write file failed")
-					//}
-				}
-			}
-		}()
-	}
-}
-
-func utxoStat(iter *db.IterWrapper, stat *stat, res chan<- string) {
-	defer iter.Close()
-
-	tStatStart := time.Now()
-
-	h := sha256.New()
-	var key []byte
-	var value []byte
-	var tReadElasp time.Duration
-	var tSha256Elasp time.Duration
-	var tIterValidElasp time.Duration
-	var tIterNextElasp time.Duration
-
-	tSha256Start := time.Now()
-	h.Write(stat.bestblock[:])
-	tSha256Elasp += time.Since(tSha256Start)
-
-	var dataSize int
-	var i int
-	//timeFile.WriteString(time.Now().String() + ", height: " + strconv.Itoa(stat.height) + ", Data: ")
-	for {
-		tIterValidStart := time.Now()
-		if !iter.Valid() {
-			break
-		}
-		tIterValidElasp += time.Since(tIterValidStart)
-		tReadStart := time.Now()
-		key = iter.GetKey()
-		value = iter.GetVal()
-		tReadElasp += time.Since(tReadStart)
-
-		dataSize += len(key) + len(value)
-
-		tSha256Start := time.Now()
-		//timeFile.WriteString(hex.EncodeToString(key) + hex.EncodeToString(value))
-		h.Write(key)
-		h.Write(value)
-		tSha256Elasp += time.Since(tSha256Start)
-
-		tIterNextStart := time.Now()
-		iter.Next()
-		tIterNextElasp += time.Since(tIterNextStart)
-
-		i++
-	}
-	//timeFile.WriteString("\n")
-	//for ; iter.Valid(); iter.Next() {
-	//	//tReadStart := time.Now()
-	//	//key = iter.GetKey()
-	//	//value = iter.GetVal()
-	//	//tReadElasp += time.Since(tReadStart)
-	//	//
-	//	//dataSize += len(key) + len(value)
-	//	//
-	//	//tSha256Start := time.Now()
-	//	//h.Write(key)
-	//	//h.Write(value)
-	//	//tSha256Elasp += time.Since(tSha256Start)
-	//	tSha256Start := time.Now()
-	//	h.Write(iter.GetKey())
-	//	h.Write(iter.GetVal())
-	//	tSha256Elasp += time.Since(tSha256Start)
-	//
-	//	i++
-	//}
-
-	tSha256SumStart := time.Now()
-	copy(stat.hashSerialized[:], h.Sum(nil))
-	tSha256Elasp += time.Since(tSha256SumStart)
-
-	totalStatTime := time.Since(tStatStart)
-
-	timeFile.WriteString(time.Now().String() + ", height: " + strconv.Itoa(stat.height) + ", count: " + strconv.Itoa(i) +
-		", size: " + strconv.Itoa(dataSize) + " bytes, read time: " + tReadElasp.String() + ", sha256 time: " +
-		tSha256Elasp.String() + ", iter valid time: " + tIterValidElasp.String() + ", iter next time: " +
-		tIterNextElasp.String() + ", total time:" + totalStatTime.String() + "\n")
-	timeFile.Sync()
-	res <- stat.String()
+// utxoCommitmentLog formats the UTXO commitment at a block for logs/utxo.log.
+func utxoCommitmentLog(height int32, hash *util.Hash, commitment *crypto.MultiSet) string {
+	return fmt.Sprintf("height=%d,bestblock=%s,ecmh=%s\n", height, hash, commitment.Hash())
 }
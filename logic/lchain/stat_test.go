@@ -15,8 +15,10 @@ import (
 	"github.com/copernet/copernicus/persist/blkdb"
 	"github.com/copernet/copernicus/persist/db"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -108,25 +110,26 @@ func TestStat(t *testing.T) {
 	assert.Nil(t, err)
 	defer os.RemoveAll(testDir)
 
-	done := make(chan struct{}, 1)
-	cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsLruCache).GetCoinsDB()
+	cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsViewCache).GetCoinsDB()
 	besthash, _ := cdb.GetBestBlock()
+	height := chain.GetInstance().FindBlockIndex(*besthash).Height
 
-	var stat stat
-	stat.bestblock = *besthash
-	stat.height = int(chain.GetInstance().FindBlockIndex(*besthash).Height)
-	iter := cdb.GetDBW().Iterator(nil)
-	iter.Seek([]byte{db.DbCoin})
+	commitment := utxo.GetUtxoCacheInstance().GetCommitment()
+	line := utxoCommitmentLog(height, besthash, commitment)
+	assert.Contains(t, line, "ecmh="+commitment.Hash().String())
 	taskControl.StartLogTask()
-	taskControl.StartUtxoTask()
-	taskControl.PushUtxoTask(utxoTaskArg{iter, &stat})
-	done <- struct{}{}
+	taskControl.PushUtxoResult(line)
 
-	select {
-	case <-done:
-
-	case <-time.After(time.Second * 10):
-		assert.Fail(t, "taskControl timeout")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		content, _ := ioutil.ReadFile(filepath.Join(conf.DataDir, "logs/utxo.log"))
+		if strings.Contains(string(content), line) {
+			break
+		}
+		if time.Now().After(deadline) {
+			assert.Fail(t, "taskControl timeout")
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
-
 }
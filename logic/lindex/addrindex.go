@@ -0,0 +1,179 @@
+package lindex
+
+import (
+	"fmt"
+
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/undo"
+	"github.com/copernet/copernicus/persist/blkdb"
+	"github.com/copernet/copernicus/persist/disk"
+	"github.com/copernet/copernicus/util"
+)
+
+// AddrIndexName is the name of the address index, as shown by getindexinfo.
+const AddrIndexName = "addressindex"
+
+// AddrIndex maps the hash of each scriptPubKey to the transactions of the
+// active chain which paid to it or spent from it, and to its unspent outputs.
+type AddrIndex struct {
+	*baseIndex
+}
+
+var addrIndex *AddrIndex
+
+// InitAddrIndex starts the address index, which catches up with the active
+// chain in the background.
+func InitAddrIndex() error {
+	ai := new(AddrIndex)
+	ai.baseIndex = newBaseIndex(AddrIndexName, ai)
+	if err := ai.start(); err != nil {
+		return err
+	}
+	addrIndex = ai
+	indexes = append(indexes, ai.baseIndex)
+	return nil
+}
+
+// GetAddrIndex returns the address index, or nil when -addressindex is not
+// enabled.
+func GetAddrIndex() *AddrIndex {
+	return addrIndex
+}
+
+// ScriptHash returns the key of scriptPubKey in the address index.
+func ScriptHash(scriptPubKey *script.Script) util.Hash {
+	return util.Sha256Hash(scriptPubKey.GetData())
+}
+
+// readBlockUndo returns the coins spent by the block, the genesis block has
+// none.
+func readBlockUndo(blk *block.Block, index *blockindex.BlockIndex) (*undo.BlockUndo, error) {
+	if index.Prev == nil {
+		return undo.NewBlockUndo(0), nil
+	}
+	pos := index.GetUndoPos()
+	if pos.IsNull() {
+		return nil, fmt.Errorf("no undo data available for block %s", index.GetBlockHash())
+	}
+	blockUndo, ok := disk.UndoReadFromDisk(&pos, *index.Prev.GetBlockHash())
+	if !ok {
+		return nil, fmt.Errorf("failed to read undo data of block %s", index.GetBlockHash())
+	}
+	if len(blockUndo.GetTxundo())+1 != len(blk.Txs) {
+		return nil, fmt.Errorf("undo data of block %s is inconsistent", index.GetBlockHash())
+	}
+	return blockUndo, nil
+}
+
+// blockAddressChanges lists the balance changes made by a block, along with
+// the outputs it created and the coins it spent.
+func blockAddressChanges(blk *block.Block, index *blockindex.BlockIndex) (entries []blkdb.AddressIndexEntry,
+	created []blkdb.AddressUnspentEntry, spent []blkdb.AddressUnspentEntry, err error) {
+	// The outputs of the genesis block are not spendable
+	if index.Prev == nil {
+		return nil, nil, nil, nil
+	}
+	blockUndo, err := readBlockUndo(blk, index)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	txUndos := blockUndo.GetTxundo()
+
+	for i, txn := range blk.Txs {
+		txid := txn.GetHash()
+		for j, out := range txn.GetOuts() {
+			if !out.IsSpendable() {
+				continue
+			}
+			key := blkdb.AddressIndexKey{
+				ScriptHash: ScriptHash(out.GetScriptPubKey()),
+				Height:     index.Height,
+				TxHash:     txid,
+				Index:      uint32(j),
+			}
+			entries = append(entries, blkdb.AddressIndexEntry{AddressIndexKey: key, Amount: int64(out.GetValue())})
+			created = append(created, blkdb.AddressUnspentEntry{
+				AddressUnspentKey: blkdb.AddressUnspentKey{ScriptHash: key.ScriptHash, TxHash: txid, Index: uint32(j)},
+				Amount:            int64(out.GetValue()),
+				Height:            index.Height,
+				ScriptPubKey:      out.GetScriptPubKey().GetData(),
+			})
+		}
+		if i == 0 {
+			continue
+		}
+
+		coins := txUndos[i-1].GetUndoCoins()
+		if len(coins) != len(txn.GetIns()) {
+			return nil, nil, nil, fmt.Errorf("undo data of tx %s is inconsistent", txid)
+		}
+		for j, in := range txn.GetIns() {
+			scriptPubKey := coins[j].GetScriptPubKey()
+			scriptHash := ScriptHash(scriptPubKey)
+			entries = append(entries, blkdb.AddressIndexEntry{
+				AddressIndexKey: blkdb.AddressIndexKey{
+					ScriptHash: scriptHash,
+					Height:     index.Height,
+					TxHash:     txid,
+					Index:      uint32(j),
+					Spending:   true,
+				},
+				Amount: -int64(coins[j].GetAmount()),
+			})
+			spent = append(spent, blkdb.AddressUnspentEntry{
+				AddressUnspentKey: blkdb.AddressUnspentKey{
+					ScriptHash: scriptHash,
+					TxHash:     in.PreviousOutPoint.Hash,
+					Index:      in.PreviousOutPoint.Index,
+				},
+				Amount:       int64(coins[j].GetAmount()),
+				Height:       coins[j].GetHeight(),
+				ScriptPubKey: scriptPubKey.GetData(),
+			})
+		}
+	}
+	return entries, created, spent, nil
+}
+
+func (ai *AddrIndex) connectBlock(blk *block.Block, index *blockindex.BlockIndex) error {
+	entries, created, spent, err := blockAddressChanges(blk, index)
+	if err != nil {
+		return err
+	}
+	spentKeys := make([]blkdb.AddressUnspentKey, 0, len(spent))
+	for i := range spent {
+		spentKeys = append(spentKeys, spent[i].AddressUnspentKey)
+	}
+	return blkdb.GetInstance().WriteAddressIndex(entries, created, spentKeys)
+}
+
+func (ai *AddrIndex) disconnectBlock(blk *block.Block, index *blockindex.BlockIndex) error {
+	entries, created, spent, err := blockAddressChanges(blk, index)
+	if err != nil {
+		return err
+	}
+	keys := make([]blkdb.AddressIndexKey, 0, len(entries))
+	for i := range entries {
+		keys = append(keys, entries[i].AddressIndexKey)
+	}
+	createdKeys := make([]blkdb.AddressUnspentKey, 0, len(created))
+	for i := range created {
+		createdKeys = append(createdKeys, created[i].AddressUnspentKey)
+	}
+	return blkdb.GetInstance().EraseAddressIndex(keys, spent, createdKeys)
+}
+
+// GetHistory returns the balance changes of the scriptPubKey hashed to
+// scriptHash between the heights start and end, sorted by height. An end
+// lower than 0 reads up to the best block of the index.
+func (ai *AddrIndex) GetHistory(scriptHash *util.Hash, start, end int32) ([]blkdb.AddressIndexEntry, error) {
+	return blkdb.GetInstance().ReadAddressIndex(scriptHash, start, end)
+}
+
+// GetUnspent returns the unspent outputs paying to the scriptPubKey hashed
+// to scriptHash.
+func (ai *AddrIndex) GetUnspent(scriptHash *util.Hash) ([]blkdb.AddressUnspentEntry, error) {
+	return blkdb.GetInstance().ReadAddressUnspent(scriptHash)
+}
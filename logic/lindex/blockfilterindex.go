@@ -0,0 +1,136 @@
+package lindex
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/persist/db"
+	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/gcs"
+)
+
+// BlockFilterIndexName is the name of the block filter index, as shown by
+// getindexinfo.
+const BlockFilterIndexName = "basic block filter index"
+
+// BlockFilterEntry is the basic filter of a block, along with its hash and
+// its filter header.
+type BlockFilterEntry struct {
+	FilterHash util.Hash
+	Header     util.Hash
+	// Filter is the filter serialized with its number of items.
+	Filter []byte
+}
+
+// BlockFilterIndex maps the hash of each block of the active chain to its
+// basic filter (BIP0158) and filter header (BIP0157), which chain the filters
+// of the active chain. The entries are stored in a database of their own and
+// are kept when the blocks are disconnected, since they do not depend on the
+// active chain.
+type BlockFilterIndex struct {
+	*baseIndex
+	dbw *db.DBWrapper
+}
+
+var blockFilterIndex *BlockFilterIndex
+
+// InitBlockFilterIndex opens the database of the block filter index and
+// starts the index, which catches up with the active chain in the background.
+func InitBlockFilterIndex() error {
+	dbw, err := db.NewDBWrapper(&db.DBOption{
+		FilePath:  filepath.Join(conf.Cfg.DataDir, "indexes", "blockfilter", "basic"),
+		CacheSize: (1 << 20) * 8,
+		Wipe:      conf.Cfg.Reindex,
+		Backend:   conf.Cfg.DB.BlockIndexBackend,
+	})
+	if err != nil {
+		return err
+	}
+
+	bfi := &BlockFilterIndex{dbw: dbw}
+	bfi.baseIndex = newBaseIndex(BlockFilterIndexName, bfi)
+	if err := bfi.start(); err != nil {
+		dbw.Close()
+		return err
+	}
+	blockFilterIndex = bfi
+	indexes = append(indexes, bfi.baseIndex)
+	return nil
+}
+
+// GetBlockFilterIndex returns the block filter index, or nil when
+// -blockfilterindex is not enabled.
+func GetBlockFilterIndex() *BlockFilterIndex {
+	return blockFilterIndex
+}
+
+func blockFilterKey(hash *util.Hash) []byte {
+	key := make([]byte, 0, 1+util.Hash256Size)
+	key = append(key, db.DbBlockFilter)
+	return append(key, hash[:]...)
+}
+
+func (bfi *BlockFilterIndex) connectBlock(blk *block.Block, index *blockindex.BlockIndex) error {
+	blockUndo, err := readBlockUndo(blk, index)
+	if err != nil {
+		return err
+	}
+	filter, err := gcs.BuildBasicFilter(blk, blockUndo)
+	if err != nil {
+		return err
+	}
+
+	var prevHeader util.Hash
+	if index.Prev != nil {
+		prev, err := bfi.LookupFilter(index.Prev.GetBlockHash())
+		if err != nil {
+			return err
+		}
+		if prev == nil {
+			return fmt.Errorf("filter header of block %s is missing", index.Prev.GetBlockHash())
+		}
+		prevHeader = prev.Header
+	}
+
+	filterBytes := filter.NBytes()
+	filterHash := util.DoubleSha256Hash(filterBytes)
+	header := gcs.MakeHeaderForFilterHash(&filterHash, &prevHeader)
+
+	value := make([]byte, 0, 2*util.Hash256Size+len(filterBytes))
+	value = append(value, filterHash[:]...)
+	value = append(value, header[:]...)
+	value = append(value, filterBytes...)
+	return bfi.dbw.Write(blockFilterKey(index.GetBlockHash()), value, false)
+}
+
+func (bfi *BlockFilterIndex) disconnectBlock(blk *block.Block, index *blockindex.BlockIndex) error {
+	return nil
+}
+
+// LookupFilter returns the filter of the block hash, or nil if the block has
+// not been indexed.
+func (bfi *BlockFilterIndex) LookupFilter(hash *util.Hash) (*BlockFilterEntry, error) {
+	value, err := bfi.dbw.Read(blockFilterKey(hash))
+	if err == db.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(value) < 2*util.Hash256Size {
+		return nil, fmt.Errorf("filter of block %s is corrupted", hash)
+	}
+
+	entry := &BlockFilterEntry{Filter: value[2*util.Hash256Size:]}
+	copy(entry.FilterHash[:], value[:util.Hash256Size])
+	copy(entry.Header[:], value[util.Hash256Size:2*util.Hash256Size])
+	return entry, nil
+}
+
+// close closes the database of the index once it is stopped.
+func (bfi *BlockFilterIndex) close() {
+	bfi.dbw.Close()
+}
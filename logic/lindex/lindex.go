@@ -0,0 +1,317 @@
+// Package lindex maintains the optional indexes of the active chain. An index
+// follows the blocks connected and disconnected by the chain once it is
+// synced, and catches up from its own best block in the background before.
+package lindex
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/model/chain"
+	"github.com/copernet/copernicus/persist"
+	"github.com/copernet/copernicus/persist/blkdb"
+	"github.com/copernet/copernicus/persist/disk"
+)
+
+// locatorWriteInterval is how often the best block of an index is written
+// while it catches up.
+const locatorWriteInterval = 30 * time.Second
+
+// blockIndexer is implemented by each index to record the blocks.
+type blockIndexer interface {
+	// connectBlock indexes a block which extends the best block of the index.
+	connectBlock(blk *block.Block, index *blockindex.BlockIndex) error
+	// disconnectBlock removes the best block of the index.
+	disconnectBlock(blk *block.Block, index *blockindex.BlockIndex) error
+}
+
+// Info is the sync state of an index.
+type Info struct {
+	Synced          bool
+	BestBlockHeight int32
+}
+
+// indexes are the started indexes, in the order they were started.
+var indexes []*baseIndex
+
+// GetIndexInfo returns the sync state of the started indexes by name.
+func GetIndexInfo() map[string]*Info {
+	infos := make(map[string]*Info, len(indexes))
+	for _, bi := range indexes {
+		infos[bi.name] = bi.info()
+	}
+	return infos
+}
+
+// StopIndexes stops the started indexes and writes their best blocks.
+func StopIndexes() {
+	for _, bi := range indexes {
+		bi.stop()
+	}
+	if blockFilterIndex != nil {
+		blockFilterIndex.close()
+	}
+	indexes = nil
+	txIndex = nil
+	addrIndex = nil
+	blockFilterIndex = nil
+}
+
+// baseIndex syncs a blockIndexer with the active chain and persists the
+// locator of its best block in the block tree db.
+type baseIndex struct {
+	name    string
+	indexer blockIndexer
+
+	// lock protects best. Before the index is synced, best is only moved by
+	// the sync goroutine, and after by the chain notifications.
+	lock   sync.RWMutex
+	best   *blockindex.BlockIndex
+	synced int32
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newBaseIndex(name string, indexer blockIndexer) *baseIndex {
+	return &baseIndex{
+		name:    name,
+		indexer: indexer,
+		quit:    make(chan struct{}),
+	}
+}
+
+// start loads the best block of the index, subscribes to the chain
+// notifications and starts catching up with the active chain.
+func (bi *baseIndex) start() error {
+	hashes, err := blkdb.GetInstance().ReadIndexLocator(bi.name)
+	if err != nil {
+		return err
+	}
+
+	persist.CsMain.Lock()
+	gChain := chain.GetInstance()
+	for i := range hashes {
+		if index := gChain.FindBlockIndex(hashes[i]); index != nil {
+			bi.best = index
+			break
+		}
+	}
+	if len(hashes) > 0 && bi.best == nil {
+		log.Warn("%s: the best block %s is unknown, rebuilding the index", bi.name, hashes[0])
+	}
+	gChain.Subscribe(bi.handleBlockChainNotification)
+	persist.CsMain.Unlock()
+
+	bi.wg.Add(1)
+	go bi.syncLoop()
+	return nil
+}
+
+// stop interrupts the sync and writes the best block of the index.
+func (bi *baseIndex) stop() {
+	close(bi.quit)
+	bi.wg.Wait()
+
+	persist.CsMain.Lock()
+	defer persist.CsMain.Unlock()
+	bi.writeLocator()
+}
+
+func (bi *baseIndex) isSynced() bool {
+	return atomic.LoadInt32(&bi.synced) == 1
+}
+
+func (bi *baseIndex) isStopped() bool {
+	select {
+	case <-bi.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+func (bi *baseIndex) getBest() *blockindex.BlockIndex {
+	bi.lock.RLock()
+	defer bi.lock.RUnlock()
+	return bi.best
+}
+
+func (bi *baseIndex) setBest(index *blockindex.BlockIndex) {
+	bi.lock.Lock()
+	bi.best = index
+	bi.lock.Unlock()
+}
+
+func (bi *baseIndex) info() *Info {
+	info := &Info{Synced: bi.isSynced(), BestBlockHeight: -1}
+	if best := bi.getBest(); best != nil {
+		info.BestBlockHeight = best.Height
+	}
+	return info
+}
+
+// writeLocator persists the best block of the index, CsMain must be held so
+// that the locator is built on a stable active chain.
+func (bi *baseIndex) writeLocator() {
+	best := bi.getBest()
+	if best == nil {
+		return
+	}
+	locator := chain.GetInstance().GetLocator(best)
+	if err := blkdb.GetInstance().WriteIndexLocator(bi.name, locator.GetBlockHashList()); err != nil {
+		log.Error("%s: write best block failed: %v", bi.name, err)
+	}
+}
+
+// nextSyncStep returns the block to connect to the index, or the best block
+// of the index to disconnect when it left the active chain. Both are nil when
+// the index reached the tip. CsMain must be held.
+func (bi *baseIndex) nextSyncStep() (connect, disconnect *blockindex.BlockIndex) {
+	gChain := chain.GetInstance()
+	best := bi.getBest()
+	if best == nil {
+		return gChain.Genesis(), nil
+	}
+	if !gChain.Contains(best) {
+		return nil, best
+	}
+	return gChain.Next(best), nil
+}
+
+// syncLoop catches up with the active chain, then hands the index over to the
+// chain notifications.
+func (bi *baseIndex) syncLoop() {
+	defer bi.wg.Done()
+
+	params := chain.GetInstance().GetParams()
+	lastLocatorWrite := time.Now()
+	lastLog := time.Now()
+	for !bi.isStopped() {
+		persist.CsMain.Lock()
+		connect, disconnect := bi.nextSyncStep()
+		if connect == nil && disconnect == nil {
+			atomic.StoreInt32(&bi.synced, 1)
+			bi.writeLocator()
+			persist.CsMain.Unlock()
+			if best := bi.getBest(); best != nil {
+				log.Info("%s is enabled at height %d", bi.name, best.Height)
+			}
+			return
+		}
+		if time.Since(lastLocatorWrite) > locatorWriteInterval {
+			bi.writeLocator()
+			lastLocatorWrite = time.Now()
+		}
+		persist.CsMain.Unlock()
+
+		if err := bi.step(connect, disconnect, params); err != nil {
+			log.Error("%s: sync failed, the index is stopped: %v", bi.name, err)
+			return
+		}
+		if connect != nil && time.Since(lastLog) > locatorWriteInterval {
+			log.Info("Syncing %s with block chain from height %d", bi.name, connect.Height)
+			lastLog = time.Now()
+		}
+	}
+}
+
+// step connects or disconnects one block read from disk. The block files are
+// read locked, a scrub may otherwise move the records being read.
+func (bi *baseIndex) step(connect, disconnect *blockindex.BlockIndex, params *model.BitcoinParams) error {
+	persist.CsBlockFiles.RLock()
+	defer persist.CsBlockFiles.RUnlock()
+
+	index := connect
+	if disconnect != nil {
+		index = disconnect
+	}
+	blk, ok := disk.ReadBlockFromDisk(index, params)
+	if !ok {
+		return fmt.Errorf("failed to read block %s", index.GetBlockHash())
+	}
+	if disconnect != nil {
+		if err := bi.indexer.disconnectBlock(blk, disconnect); err != nil {
+			return err
+		}
+		bi.setBest(disconnect.Prev)
+		return nil
+	}
+	if err := bi.indexer.connectBlock(blk, connect); err != nil {
+		return err
+	}
+	bi.setBest(connect)
+	return nil
+}
+
+// catchUp brings a synced index to the tip of the active chain, when it
+// missed some blocks. CsMain must be held.
+func (bi *baseIndex) catchUp() error {
+	params := chain.GetInstance().GetParams()
+	for {
+		connect, disconnect := bi.nextSyncStep()
+		if connect == nil && disconnect == nil {
+			return nil
+		}
+		if err := bi.step(connect, disconnect, params); err != nil {
+			return err
+		}
+	}
+}
+
+// handleBlockChainNotification keeps a synced index in line with the active
+// chain. The notifications are sent with CsMain held.
+func (bi *baseIndex) handleBlockChainNotification(notification *chain.Notification) {
+	if !bi.isSynced() || bi.isStopped() {
+		return
+	}
+
+	switch notification.Type {
+	case chain.NTBlockConnected:
+		blk, ok := notification.Data.(*block.Block)
+		if !ok {
+			return
+		}
+		index := chain.GetInstance().FindBlockIndex(blk.GetHash())
+		if index == nil {
+			return
+		}
+		if index.Prev != bi.getBest() {
+			// The block is already indexed, or some blocks were not
+			// notified: index the active chain up to its tip instead.
+			if err := bi.catchUp(); err != nil {
+				log.Error("%s: catch up with block %s failed: %v", bi.name, index.GetBlockHash(), err)
+				return
+			}
+		} else {
+			if err := bi.indexer.connectBlock(blk, index); err != nil {
+				log.Error("%s: index block %s failed: %v", bi.name, index.GetBlockHash(), err)
+				return
+			}
+			bi.setBest(index)
+		}
+		bi.writeLocator()
+
+	case chain.NTBlockDisconnected:
+		blk, ok := notification.Data.(*block.Block)
+		if !ok {
+			return
+		}
+		index := chain.GetInstance().FindBlockIndex(blk.GetHash())
+		if index == nil || index != bi.getBest() {
+			return
+		}
+		if err := bi.indexer.disconnectBlock(blk, index); err != nil {
+			log.Error("%s: remove block %s failed: %v", bi.name, index.GetBlockHash(), err)
+			return
+		}
+		bi.setBest(index.Prev)
+		bi.writeLocator()
+	}
+}
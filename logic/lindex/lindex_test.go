@@ -0,0 +1,321 @@
+package lindex_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/crypto"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/logic/lblockindex"
+	"github.com/copernet/copernicus/logic/lchain"
+	"github.com/copernet/copernicus/logic/lindex"
+	"github.com/copernet/copernicus/logic/lmerkleroot"
+	"github.com/copernet/copernicus/logic/ltx"
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/chain"
+	"github.com/copernet/copernicus/model/mempool"
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/pow"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/model/versionbits"
+	"github.com/copernet/copernicus/persist"
+	"github.com/copernet/copernicus/persist/blkdb"
+	"github.com/copernet/copernicus/persist/db"
+	"github.com/copernet/copernicus/service"
+	"github.com/copernet/copernicus/service/mining"
+	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/gcs"
+	"github.com/stretchr/testify/assert"
+)
+
+func initTestEnv(t *testing.T) (dirpath string, err error) {
+	conf.Cfg = conf.InitConfig([]string{"--regtest"})
+
+	unitTestDataDirPath, err := conf.SetUnitTestDataDir(conf.Cfg)
+	t.Logf("test in temp dir: %s", unitTestDataDirPath)
+	if err != nil {
+		return "", err
+	}
+	model.SetRegTestParams()
+
+	logDir := filepath.Join(conf.DataDir, log.DefaultLogDirname)
+	if err := os.MkdirAll(logDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	logConf := struct {
+		FileName string `json:"filename"`
+		Level    int    `json:"level"`
+	}{
+		FileName: logDir + "/" + conf.Cfg.Log.FileName + ".log",
+		Level:    log.GetLevel(conf.Cfg.Log.Level),
+	}
+	configuration, err := json.Marshal(logConf)
+	if err != nil {
+		return "", err
+	}
+	log.Init(string(configuration))
+
+	persist.InitPersistGlobal()
+
+	utxoDbCfg := &db.DBOption{
+		FilePath:  conf.Cfg.DataDir + "/chainstate",
+		CacheSize: (1 << 20) * 8,
+	}
+	utxo.InitUtxoLruTip(&utxo.UtxoConfig{Do: utxoDbCfg})
+
+	blkDbCfg := &db.DBOption{
+		FilePath:  conf.Cfg.DataDir + "/blocks/index",
+		CacheSize: (1 << 20) * 8,
+	}
+	blkdb.InitBlockTreeDB(&blkdb.BlockTreeDBConfig{Do: blkDbCfg})
+
+	chain.InitGlobalChain()
+	*chain.GetInstance() = *chain.NewChain()
+	lblockindex.LoadBlockIndexDB()
+	if err := lchain.InitGenesisChain(); err != nil {
+		return "", err
+	}
+
+	mempool.InitMempool()
+	crypto.InitSecp256()
+	ltx.ScriptVerifyInit()
+
+	return unitTestDataDirPath, nil
+}
+
+// generateBlocks mines n blocks on top of prev, paying the coinbases to
+// scriptPubKey, and returns them.
+func generateBlocks(t *testing.T, scriptPubKey *script.Script, n int, prev *util.Hash) []*block.Block {
+	blocks := make([]*block.Block, 0, n)
+	for i := 0; i < n; i++ {
+		indexPrev := chain.GetInstance().FindBlockIndex(*prev)
+		bk := block.NewBlock()
+		bk.Header.Version = versionbits.ComputeBlockVersion()
+		bk.Header.HashPrevBlock = *prev
+
+		scriptSig := script.NewEmptyScript()
+		scriptSig.PushScriptNum(script.NewScriptNum(int64(indexPrev.Height + 1)))
+		scriptSig.PushData([]byte("copernicus.............................."))
+		coinbase := tx.NewTx(0, tx.DefaultVersion)
+		coinbase.AddTxIn(txin.NewTxIn(&outpoint.OutPoint{Hash: util.HashZero, Index: 0xffffffff},
+			scriptSig, 0xffffffff))
+		coinbase.AddTxOut(txout.NewTxOut(50, scriptPubKey))
+		bk.Txs = []*tx.Tx{coinbase}
+
+		mining.UpdateTime(bk, indexPrev)
+		p := pow.Pow{}
+		bk.Header.Bits = p.GetNextWorkRequired(indexPrev, &bk.Header, model.ActiveNetParams)
+		bk.Header.MerkleRoot = lmerkleroot.BlockMerkleRoot(bk.Txs, nil)
+		for {
+			hash := bk.GetHash()
+			if p.CheckProofOfWork(&hash, bk.Header.Bits, model.ActiveNetParams) {
+				break
+			}
+			bk.Header.Nonce++
+		}
+
+		fNewBlock := false
+		if err := service.ProcessNewBlock(bk, true, &fNewBlock); err != nil {
+			t.Fatalf("ProcessNewBlock failed: %v", err)
+		}
+		blocks = append(blocks, bk)
+		hash := bk.GetHash()
+		prev = &hash
+	}
+	return blocks
+}
+
+func waitForSync(t *testing.T, name string) *lindex.Info {
+	for i := 0; i < 1000; i++ {
+		info := lindex.GetIndexInfo()[name]
+		if info.Synced {
+			return info
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("the %s did not sync", name)
+	return nil
+}
+
+func assertIndexed(t *testing.T, blocks []*block.Block) {
+	for _, bk := range blocks {
+		txid := bk.Txs[0].GetHash()
+		txn, blockHash, err := lindex.GetTxIndex().FindTx(&txid)
+		assert.Nil(t, err)
+		if assert.NotNil(t, txn) {
+			assert.Equal(t, txid, txn.GetHash())
+			assert.Equal(t, bk.GetHash(), *blockHash)
+		}
+	}
+}
+
+func assertNotIndexed(t *testing.T, blocks []*block.Block) {
+	for _, bk := range blocks {
+		txid := bk.Txs[0].GetHash()
+		txn, _, err := lindex.GetTxIndex().FindTx(&txid)
+		assert.Nil(t, err)
+		assert.Nil(t, txn)
+	}
+}
+
+func TestTxIndex(t *testing.T) {
+	testDir, err := initTestEnv(t)
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+	defer lindex.StopIndexes()
+
+	pubKey := script.NewEmptyScript()
+	pubKey.PushOpCode(opcodes.OP_TRUE)
+	otherPubKey := script.NewEmptyScript()
+	otherPubKey.PushOpCode(opcodes.OP_2)
+
+	gChain := chain.GetInstance()
+	blocks := generateBlocks(t, pubKey, 20, gChain.Tip().GetBlockHash())
+
+	// The index catches up from the genesis block in the background.
+	assert.Nil(t, lindex.GetTxIndex())
+	assert.Nil(t, lindex.InitTxIndex())
+	info := waitForSync(t, lindex.TxIndexName)
+	assert.Equal(t, int32(20), info.BestBlockHeight)
+	assertIndexed(t, blocks)
+
+	// A synced index follows the connected blocks.
+	more := generateBlocks(t, pubKey, 5, gChain.Tip().GetBlockHash())
+	assert.Equal(t, int32(25), lindex.GetIndexInfo()[lindex.TxIndexName].BestBlockHeight)
+	assertIndexed(t, more)
+
+	// And the reorganizations.
+	fork := generateBlocks(t, otherPubKey, 7, gChain.GetIndex(22).GetBlockHash())
+	assert.Equal(t, int32(29), gChain.TipHeight())
+	assert.Equal(t, int32(29), lindex.GetIndexInfo()[lindex.TxIndexName].BestBlockHeight)
+	assertNotIndexed(t, more[2:])
+	assertIndexed(t, more[:2])
+	assertIndexed(t, fork)
+
+	// A restarted index resumes from its best block.
+	lindex.StopIndexes()
+	assert.Nil(t, lindex.GetTxIndex())
+	later := generateBlocks(t, otherPubKey, 3, gChain.Tip().GetBlockHash())
+	assert.Nil(t, lindex.InitTxIndex())
+	info = waitForSync(t, lindex.TxIndexName)
+	assert.Equal(t, int32(32), info.BestBlockHeight)
+	assertIndexed(t, later)
+	assertIndexed(t, fork)
+}
+
+func assertAddressHistory(t *testing.T, scriptPubKey *script.Script, blocks []*block.Block) {
+	scriptHash := lindex.ScriptHash(scriptPubKey)
+	entries, err := lindex.GetAddrIndex().GetHistory(&scriptHash, 0, -1)
+	assert.Nil(t, err)
+	unspent, err := lindex.GetAddrIndex().GetUnspent(&scriptHash)
+	assert.Nil(t, err)
+	if !assert.Equal(t, len(blocks), len(entries)) || !assert.Equal(t, len(blocks), len(unspent)) {
+		return
+	}
+	for i, bk := range blocks {
+		assert.Equal(t, bk.Txs[0].GetHash(), entries[i].TxHash)
+		assert.Equal(t, int64(50), entries[i].Amount)
+		assert.False(t, entries[i].Spending)
+	}
+}
+
+func TestAddrIndex(t *testing.T) {
+	testDir, err := initTestEnv(t)
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+	defer lindex.StopIndexes()
+
+	pubKey := script.NewEmptyScript()
+	pubKey.PushOpCode(opcodes.OP_TRUE)
+	otherPubKey := script.NewEmptyScript()
+	otherPubKey.PushOpCode(opcodes.OP_2)
+
+	gChain := chain.GetInstance()
+	blocks := generateBlocks(t, pubKey, 10, gChain.Tip().GetBlockHash())
+
+	// The index catches up from the genesis block in the background.
+	assert.Nil(t, lindex.GetAddrIndex())
+	assert.Nil(t, lindex.InitAddrIndex())
+	info := waitForSync(t, lindex.AddrIndexName)
+	assert.Equal(t, int32(10), info.BestBlockHeight)
+	assertAddressHistory(t, pubKey, blocks)
+
+	// A synced index follows the connected blocks.
+	more := generateBlocks(t, pubKey, 5, gChain.Tip().GetBlockHash())
+	assertAddressHistory(t, pubKey, append(blocks, more...))
+
+	// And the reorganizations, which remove the coins of the old branch.
+	fork := generateBlocks(t, otherPubKey, 7, gChain.GetIndex(12).GetBlockHash())
+	assert.Equal(t, int32(19), lindex.GetIndexInfo()[lindex.AddrIndexName].BestBlockHeight)
+	assertAddressHistory(t, pubKey, append(blocks, more[:2]...))
+	assertAddressHistory(t, otherPubKey, fork)
+}
+
+func TestBlockFilterIndex(t *testing.T) {
+	testDir, err := initTestEnv(t)
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+	defer lindex.StopIndexes()
+
+	pubKey := script.NewEmptyScript()
+	pubKey.PushOpCode(opcodes.OP_TRUE)
+	otherPubKey := script.NewEmptyScript()
+	otherPubKey.PushOpCode(opcodes.OP_2)
+
+	gChain := chain.GetInstance()
+	generateBlocks(t, pubKey, 10, gChain.Tip().GetBlockHash())
+
+	assert.Nil(t, lindex.GetBlockFilterIndex())
+	assert.Nil(t, lindex.InitBlockFilterIndex())
+	info := waitForSync(t, lindex.BlockFilterIndexName)
+	assert.Equal(t, int32(10), info.BestBlockHeight)
+
+	// A synced index follows the connected blocks, the filters of the
+	// disconnected blocks are kept.
+	more := generateBlocks(t, pubKey, 3, gChain.Tip().GetBlockHash())
+	fork := generateBlocks(t, otherPubKey, 5, gChain.GetIndex(11).GetBlockHash())
+	assert.Equal(t, int32(16), lindex.GetIndexInfo()[lindex.BlockFilterIndexName].BestBlockHeight)
+
+	bfi := lindex.GetBlockFilterIndex()
+	for _, bk := range append(more, fork...) {
+		hash := bk.GetHash()
+		entry, err := bfi.LookupFilter(&hash)
+		assert.Nil(t, err)
+		if !assert.NotNil(t, entry) {
+			continue
+		}
+		filter, err := gcs.FromNBytes(gcs.BasicFilterP, gcs.BasicFilterM, entry.Filter)
+		assert.Nil(t, err)
+		match, err := filter.Match(gcs.DeriveKey(&hash), bk.Txs[0].GetOuts()[0].GetScriptPubKey().GetData())
+		assert.Nil(t, err)
+		assert.True(t, match)
+	}
+
+	// The filter headers chain the filters of the active chain.
+	var prevHeader util.Hash
+	for height := int32(0); height <= gChain.TipHeight(); height++ {
+		entry, err := bfi.LookupFilter(gChain.GetIndex(height).GetBlockHash())
+		assert.Nil(t, err)
+		if !assert.NotNil(t, entry) {
+			return
+		}
+		assert.Equal(t, util.DoubleSha256Hash(entry.Filter), entry.FilterHash)
+		assert.Equal(t, gcs.MakeHeaderForFilterHash(&entry.FilterHash, &prevHeader), entry.Header)
+		prevHeader = entry.Header
+	}
+
+	unknown := util.HashOne
+	entry, err := bfi.LookupFilter(&unknown)
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+}
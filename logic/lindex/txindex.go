@@ -0,0 +1,79 @@
+package lindex
+
+import (
+	"fmt"
+
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/persist/blkdb"
+	"github.com/copernet/copernicus/persist/disk"
+	"github.com/copernet/copernicus/util"
+)
+
+// TxIndexName is the name of the tx index, as shown by getindexinfo.
+const TxIndexName = "txindex"
+
+// TxIndex maps the txid of each transaction of the active chain to its
+// position in the block files.
+type TxIndex struct {
+	*baseIndex
+}
+
+var txIndex *TxIndex
+
+// InitTxIndex starts the tx index, which catches up with the active chain in
+// the background.
+func InitTxIndex() error {
+	ti := new(TxIndex)
+	ti.baseIndex = newBaseIndex(TxIndexName, ti)
+	if err := ti.start(); err != nil {
+		return err
+	}
+	txIndex = ti
+	indexes = append(indexes, ti.baseIndex)
+	return nil
+}
+
+// GetTxIndex returns the tx index, or nil when -txindex is not enabled.
+func GetTxIndex() *TxIndex {
+	return txIndex
+}
+
+func (ti *TxIndex) connectBlock(blk *block.Block, index *blockindex.BlockIndex) error {
+	blockPos := index.GetBlockPos()
+	// The offsets are relative to the end of the block header.
+	offset := util.VarIntSerializeSize(uint64(len(blk.Txs)))
+	positions := make(map[util.Hash]block.DiskTxPos, len(blk.Txs))
+	for _, txn := range blk.Txs {
+		positions[txn.GetHash()] = block.DiskTxPos{BlockIn: &blockPos, TxOffsetIn: offset}
+		offset += txn.SerializeSize()
+	}
+	return blkdb.GetInstance().WriteTxIndex(positions)
+}
+
+func (ti *TxIndex) disconnectBlock(blk *block.Block, index *blockindex.BlockIndex) error {
+	txids := make([]util.Hash, 0, len(blk.Txs))
+	for _, txn := range blk.Txs {
+		txids = append(txids, txn.GetHash())
+	}
+	return blkdb.GetInstance().EraseTxIndex(txids)
+}
+
+// FindTx returns the transaction txid of the active chain and the hash of its
+// block, or nil if the index does not know the transaction.
+func (ti *TxIndex) FindTx(txid *util.Hash) (*tx.Tx, *util.Hash, error) {
+	pos, err := blkdb.GetInstance().ReadTxIndex(txid)
+	if err != nil || pos == nil {
+		return nil, nil, err
+	}
+	header, txn, err := disk.ReadTxFromDisk(pos)
+	if err != nil {
+		return nil, nil, err
+	}
+	if txn.GetHash() != *txid {
+		return nil, nil, fmt.Errorf("txid mismatch at %s, the tx index is corrupted", pos.BlockIn.String())
+	}
+	blockHash := header.GetHash()
+	return txn, &blockHash, nil
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/logic/ltx"
 	//"github.com/copernet/copernicus/model/consensus"
+	"github.com/copernet/copernicus/model/dsproof"
 	"github.com/copernet/copernicus/model/mempool"
 	"github.com/copernet/copernicus/model/outpoint"
 	"github.com/copernet/copernicus/model/tx"
@@ -289,10 +290,12 @@ func CheckMempool(bestHeight int32) {
 		nCountCheck := int64(len(setAncestors)) + 1
 		nSizeCheck := int64(entry.TxSize)
 		nSigOpCheck := int64(entry.SigOpCount)
+		nSigChecksCheck := int64(entry.SigChecks)
 		nFeesCheck := entry.TxFee
 		for ancestorIt := range setAncestors {
 			nSizeCheck += int64(ancestorIt.TxSize)
 			nSigOpCheck += int64(ancestorIt.SigOpCount)
+			nSigChecksCheck += int64(ancestorIt.SigChecks)
 			nFeesCheck += ancestorIt.TxFee
 		}
 		if entry.SumTxCountWithAncestors != nCountCheck {
@@ -311,6 +314,11 @@ func CheckMempool(bestHeight int32) {
 				entry.SumTxSigOpCountWithAncestors, nSigOpCheck)
 			entry.SumTxSigOpCountWithAncestors = nSigOpCheck
 		}
+		if entry.SumTxSigChecksWithAncestors != nSigChecksCheck {
+			log.Error("the txentry's ancestors sigchecks is incorrect: entry.SumTxSigChecksWithAncestors(%d), nSigChecksCheck(%d)",
+				entry.SumTxSigChecksWithAncestors, nSigChecksCheck)
+			entry.SumTxSigChecksWithAncestors = nSigChecksCheck
+		}
 		if entry.SumTxFeeWithAncestors != nFeesCheck {
 			log.Error("the txentry's ancestors feew is incorrect: entry.SumTxFeeWithAncestors(%d), nFeesCheck(%d)",
 				entry.SumTxFeeWithAncestors, nFeesCheck)
@@ -423,3 +431,44 @@ func FindOrphanTxInMemPool(hash util.Hash) *tx.Tx {
 
 	return nil
 }
+
+// GetTxsForBlockReconstruction returns the transactions of the mempool and
+// the orphan pool, which a compact block is reconstructed from.
+func GetTxsForBlockReconstruction() []*tx.Tx {
+	pool := mempool.GetInstance()
+	pool.RLock()
+	defer pool.RUnlock()
+
+	entries := pool.GetAllTxEntryWithoutLock()
+	txs := make([]*tx.Tx, 0, len(entries)+len(pool.OrphanTransactions))
+	for _, entry := range entries {
+		txs = append(txs, entry.Tx)
+	}
+	for _, orphan := range pool.OrphanTransactions {
+		txs = append(txs, orphan.Tx)
+	}
+	return txs
+}
+
+// AcceptDSProof validates a double spend proof received from a peer and adds
+// it to the mempool.  It returns false when the proof is not added, because
+// it is invalid or the coin already has a proof.
+func AcceptDSProof(proof *dsproof.DSProof) (bool, error) {
+	if err := ltx.ValidateDSProof(proof); err != nil {
+		return false, err
+	}
+	return mempool.GetInstance().AddDSProof(proof), nil
+}
+
+// FindDSProofsOfTx returns the double spend proofs of the coins spent by
+// txn, which are relayed when txn is rejected as a double spend.
+func FindDSProofsOfTx(txn *tx.Tx) []*dsproof.DSProof {
+	pool := mempool.GetInstance()
+	var proofs []*dsproof.DSProof
+	for _, in := range txn.GetIns() {
+		if entry := pool.GetDSProofByOutPoint(in.PreviousOutPoint); entry != nil {
+			proofs = append(proofs, entry.Proof)
+		}
+	}
+	return proofs
+}
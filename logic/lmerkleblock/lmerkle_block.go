@@ -4,7 +4,9 @@ import (
 	"io"
 
 	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/net/wire"
 	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/bloom"
 	"gopkg.in/fatih/set.v0"
 )
 
@@ -42,6 +44,44 @@ func NewMerkleBlock(bk *block.Block, txids *set.Set) *MerkleBlock {
 	return &ret
 }
 
+// NewMerkleBlockWithFilter returns a merkle block of the transactions of bk
+// matching filter, which are recorded in MatchedTxn.  The filter is updated
+// with the matched transactions according to its update flags.
+func NewMerkleBlockWithFilter(bk *block.Block, filter *bloom.Filter) *MerkleBlock {
+	ret := MerkleBlock{}
+
+	ret.Header = bk.Header
+
+	match := make([]bool, 0, len(bk.Txs))
+	hashes := make([]util.Hash, 0, len(bk.Txs))
+
+	for i, transaction := range bk.Txs {
+		txid := transaction.GetHash()
+		matched := filter.MatchTxAndUpdate(transaction)
+		if matched {
+			ret.MatchedTxn = append(ret.MatchedTxn, Matched{N: i, H: txid})
+		}
+
+		match = append(match, matched)
+		hashes = append(hashes, txid)
+	}
+	ret.Txn = NewPartialMerkleTree(hashes, match)
+
+	return &ret
+}
+
+// MsgMerkleBlock returns the merkleblock message carrying the merkle block.
+func (mb *MerkleBlock) MsgMerkleBlock() *wire.MsgMerkleBlock {
+	msg := wire.NewMsgMerkleBlock(&mb.Header)
+	msg.Transactions = uint32(mb.Txn.txs)
+	for i := range mb.Txn.hashes {
+		msg.AddTxHash(&mb.Txn.hashes[i])
+	}
+	msg.Flags = mb.Txn.flagBytes()
+
+	return msg
+}
+
 func (mb *MerkleBlock) Serialize(w io.Writer) (err error) {
 	err = mb.Header.Serialize(w)
 	if err != nil {
@@ -3,6 +3,7 @@ package lmerkleblock
 import (
 	"bytes"
 	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/logic/lmerkleroot"
 	"github.com/copernet/copernicus/model/block"
 	"github.com/copernet/copernicus/model/opcodes"
 	"github.com/copernet/copernicus/model/outpoint"
@@ -10,8 +11,10 @@ import (
 	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/model/txin"
 	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/net/wire"
 	"github.com/copernet/copernicus/persist"
 	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/bloom"
 	"github.com/magiconair/properties/assert"
 	"gopkg.in/fatih/set.v0"
 	"math"
@@ -63,3 +66,39 @@ func TestMerkleBlock(t *testing.T) {
 	assert.Equal(t, exp.Txn.hashes, mb.Txn.hashes)
 
 }
+
+func TestMerkleBlockWithFilter(t *testing.T) {
+	bk := block.NewBlock()
+	for i := 0; i < 10; i++ {
+		transaction := tx.NewTx(uint32(i), tx.DefaultVersion)
+		preOut := outpoint.NewOutPoint(*util.GetRandHash(), 0)
+		transaction.AddTxIn(txin.NewTxIn(preOut, script.NewEmptyScript(), math.MaxUint32-1))
+		transaction.AddTxOut(txout.NewTxOut(10, script.NewEmptyScript()))
+		bk.Txs = append(bk.Txs, transaction)
+	}
+
+	filter := bloom.NewFilter(10, 0, 0.000001, wire.BloomUpdateNone)
+	for _, i := range []int{2, 7} {
+		txid := bk.Txs[i].GetHash()
+		filter.AddHash(&txid)
+	}
+
+	mb := NewMerkleBlockWithFilter(bk, filter)
+	assert.Equal(t, []Matched{{N: 2, H: bk.Txs[2].GetHash()}, {N: 7, H: bk.Txs[7].GetHash()}}, mb.MatchedTxn)
+
+	// The merkleblock message carries the same tree as the merkle block.
+	msg := mb.MsgMerkleBlock()
+	assert.Equal(t, uint32(len(bk.Txs)), msg.Transactions)
+	assert.Equal(t, len(mb.Txn.hashes), len(msg.Hashes))
+	assert.Equal(t, mb.Txn.flagBytes(), msg.Flags)
+	buf := bytes.NewBuffer(nil)
+	err := msg.Encode(buf, wire.ProtocolVersion, wire.BaseEncoding)
+	assert.Equal(t, nil, err)
+
+	matches := make([]util.Hash, 0)
+	items := make([]int, 0)
+	root := mb.Txn.ExtractMatches(&matches, &items)
+	mutated := false
+	assert.Equal(t, lmerkleroot.BlockMerkleRoot(bk.Txs, &mutated), *root)
+	assert.Equal(t, []util.Hash{bk.Txs[2].GetHash(), bk.Txs[7].GetHash()}, matches)
+}
@@ -211,18 +211,23 @@ func (pmt *PartialMerkleTree) Serialize(w io.Writer) (err error) {
 		}
 	}
 
+	err = util.WriteVarBytes(w, pmt.flagBytes())
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// flagBytes packs the flag bits of the tree, least significant bit first.
+func (pmt *PartialMerkleTree) flagBytes() []byte {
 	bs := make([]byte, (len(pmt.bits)+7)/8)
 	for p := 0; p < len(pmt.bits); p++ {
 		if pmt.bits[p] {
 			bs[p/8] |= uint8(1 << uint(p%8))
 		}
 	}
-	err = util.WriteVarBytes(w, bs)
-	if err != nil {
-		return
-	}
-
-	return
+	return bs
 }
 
 func (pmt *PartialMerkleTree) Unserialize(r io.Reader) (err error) {
@@ -0,0 +1,202 @@
+package lscript
+
+import (
+	"github.com/copernet/copernicus/errcode"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/util"
+)
+
+// evalIntrospection executes one of the native introspection opcodes.
+// activeCode holds the opcodes from the last executed OP_CODESEPARATOR on.
+func evalIntrospection(opValue byte, stack *util.Stack, activeCode []opcodes.ParsedOpCode, transaction *tx.Tx,
+	nIn int, spentOutputs []*txout.TxOut, fRequireMinimal bool, maxNumSize int) error {
+	if transaction == nil {
+		log.Debug("ScriptErrContextNotPresent")
+		return errcode.New(errcode.ScriptErrContextNotPresent)
+	}
+
+	switch opValue {
+	case opcodes.OP_INPUTINDEX:
+		// ( -- index)
+		stack.Push(script.NewScriptNum(int64(nIn)).Serialize())
+
+	case opcodes.OP_ACTIVEBYTECODE:
+		// ( -- bytecode)
+		if len(activeCode) > 0 && activeCode[0].OpValue == opcodes.OP_CODESEPARATOR {
+			activeCode = activeCode[1:]
+		}
+		return pushIntrospectedBytes(stack, script.NewScriptOps(activeCode).GetData())
+
+	case opcodes.OP_TXVERSION:
+		// ( -- version)
+		stack.Push(script.NewScriptNum(int64(transaction.GetVersion())).Serialize())
+
+	case opcodes.OP_TXINPUTCOUNT:
+		// ( -- count)
+		stack.Push(script.NewScriptNum(int64(transaction.GetInsCount())).Serialize())
+
+	case opcodes.OP_TXOUTPUTCOUNT:
+		// ( -- count)
+		stack.Push(script.NewScriptNum(int64(transaction.GetOutsCount())).Serialize())
+
+	case opcodes.OP_TXLOCKTIME:
+		// ( -- locktime)
+		stack.Push(script.NewScriptNum(int64(transaction.GetLockTime())).Serialize())
+
+	case opcodes.OP_UTXOVALUE, opcodes.OP_UTXOBYTECODE:
+		// (index -- value|bytecode)
+		index, err := popIntrospectionIndex(stack, transaction.GetInsCount(), fRequireMinimal, maxNumSize,
+			errcode.ScriptErrInvalidTxInputIndex)
+		if err != nil {
+			return err
+		}
+		spent, err := getSpentOutput(transaction, spentOutputs, index)
+		if err != nil {
+			return err
+		}
+		if opValue == opcodes.OP_UTXOVALUE {
+			stack.Push(script.NewScriptNum(int64(spent.GetValue())).Serialize())
+			break
+		}
+		return pushIntrospectedBytes(stack, spent.GetScriptPubKey().GetData())
+
+	case opcodes.OP_OUTPOINTTXHASH, opcodes.OP_OUTPOINTINDEX, opcodes.OP_INPUTBYTECODE,
+		opcodes.OP_INPUTSEQUENCENUMBER:
+		// (index -- hash|index|bytecode|sequence)
+		index, err := popIntrospectionIndex(stack, transaction.GetInsCount(), fRequireMinimal, maxNumSize,
+			errcode.ScriptErrInvalidTxInputIndex)
+		if err != nil {
+			return err
+		}
+		in := transaction.GetIns()[index]
+		switch opValue {
+		case opcodes.OP_OUTPOINTTXHASH:
+			hash := in.PreviousOutPoint.Hash
+			stack.Push(hash[:])
+		case opcodes.OP_OUTPOINTINDEX:
+			stack.Push(script.NewScriptNum(int64(in.PreviousOutPoint.Index)).Serialize())
+		case opcodes.OP_INPUTBYTECODE:
+			return pushIntrospectedBytes(stack, in.GetScriptSig().GetData())
+		case opcodes.OP_INPUTSEQUENCENUMBER:
+			stack.Push(script.NewScriptNum(int64(in.Sequence)).Serialize())
+		}
+
+	case opcodes.OP_OUTPUTVALUE, opcodes.OP_OUTPUTBYTECODE:
+		// (index -- value|bytecode)
+		index, err := popIntrospectionIndex(stack, transaction.GetOutsCount(), fRequireMinimal, maxNumSize,
+			errcode.ScriptErrInvalidTxOutputIndex)
+		if err != nil {
+			return err
+		}
+		out := transaction.GetTxOut(index)
+		if opValue == opcodes.OP_OUTPUTVALUE {
+			stack.Push(script.NewScriptNum(int64(out.GetValue())).Serialize())
+			break
+		}
+		return pushIntrospectedBytes(stack, out.GetScriptPubKey().GetData())
+
+	case opcodes.OP_UTXOTOKENCATEGORY, opcodes.OP_UTXOTOKENCOMMITMENT, opcodes.OP_UTXOTOKENAMOUNT:
+		// (index -- category|commitment|amount)
+		index, err := popIntrospectionIndex(stack, transaction.GetInsCount(), fRequireMinimal, maxNumSize,
+			errcode.ScriptErrInvalidTxInputIndex)
+		if err != nil {
+			return err
+		}
+		spent, err := getSpentOutput(transaction, spentOutputs, index)
+		if err != nil {
+			return err
+		}
+		pushTokenData(stack, opValue, spent.GetTokenData())
+
+	case opcodes.OP_OUTPUTTOKENCATEGORY, opcodes.OP_OUTPUTTOKENCOMMITMENT, opcodes.OP_OUTPUTTOKENAMOUNT:
+		// (index -- category|commitment|amount)
+		index, err := popIntrospectionIndex(stack, transaction.GetOutsCount(), fRequireMinimal, maxNumSize,
+			errcode.ScriptErrInvalidTxOutputIndex)
+		if err != nil {
+			return err
+		}
+		pushTokenData(stack, opValue, transaction.GetTxOut(index).GetTokenData())
+
+	default:
+		return errcode.New(errcode.ScriptErrBadOpCode)
+	}
+
+	return nil
+}
+
+// getSpentOutput returns the coin spent by input index, which is only known
+// if the caller provided all the spent outputs.
+func getSpentOutput(transaction *tx.Tx, spentOutputs []*txout.TxOut, index int) (*txout.TxOut, error) {
+	if len(spentOutputs) != transaction.GetInsCount() || spentOutputs[index] == nil {
+		log.Debug("ScriptErrContextNotPresent")
+		return nil, errcode.New(errcode.ScriptErrContextNotPresent)
+	}
+	return spentOutputs[index], nil
+}
+
+// pushTokenData pushes the part of tokenData read by a token introspection
+// opcode. Outputs without tokens have an empty category and commitment, and a
+// zero amount.
+func pushTokenData(stack *util.Stack, opValue byte, tokenData *txout.TokenData) {
+	switch opValue {
+	case opcodes.OP_UTXOTOKENCATEGORY, opcodes.OP_OUTPUTTOKENCATEGORY:
+		vch := make([]byte, 0, util.Hash256Size+1)
+		if tokenData != nil {
+			vch = append(vch, tokenData.Category[:]...)
+			// The capability of an NFT is appended, unless it is immutable.
+			if tokenData.HasNFT() && tokenData.GetCapability() != txout.TokenCapabilityNone {
+				vch = append(vch, tokenData.GetCapability())
+			}
+		}
+		stack.Push(vch)
+	case opcodes.OP_UTXOTOKENCOMMITMENT, opcodes.OP_OUTPUTTOKENCOMMITMENT:
+		vch := make([]byte, 0, txout.MaxTokenCommitmentLength)
+		if tokenData != nil {
+			vch = append(vch, tokenData.Commitment...)
+		}
+		stack.Push(vch)
+	default:
+		var tokenAmount int64
+		if tokenData != nil {
+			tokenAmount = tokenData.Amount
+		}
+		stack.Push(script.NewScriptNum(tokenAmount).Serialize())
+	}
+}
+
+// popIntrospectionIndex pops the index operand of an introspection opcode and
+// checks it against count.
+func popIntrospectionIndex(stack *util.Stack, count int, fRequireMinimal bool, maxNumSize int,
+	errRange errcode.ScriptErr) (int, error) {
+	if stack.Size() < 1 {
+		log.Debug("ScriptErrInvalidStackOperation")
+		return 0, errcode.New(errcode.ScriptErrInvalidStackOperation)
+	}
+	bn, err := script.GetScriptNum(stack.Top(-1).([]byte), fRequireMinimal, maxNumSize)
+	if err != nil {
+		return 0, err
+	}
+	if bn.Value < 0 || bn.Value >= int64(count) {
+		log.Debug("introspection index %d out of range [0, %d)", bn.Value, count)
+		return 0, errcode.New(errRange)
+	}
+	stack.Pop()
+	return int(bn.Value), nil
+}
+
+// pushIntrospectedBytes pushes a copy of data, which must respect the stack
+// element size limit.
+func pushIntrospectedBytes(stack *util.Stack, data []byte) error {
+	if len(data) > script.MaxScriptElementSize {
+		log.Debug("ScriptErrPushSize")
+		return errcode.New(errcode.ScriptErrPushSize)
+	}
+	vch := make([]byte, len(data))
+	copy(vch, data)
+	stack.Push(vch)
+	return nil
+}
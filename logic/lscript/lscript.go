@@ -8,12 +8,30 @@ import (
 	"github.com/copernet/copernicus/model/opcodes"
 	"github.com/copernet/copernicus/model/script"
 	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txout"
 	"github.com/copernet/copernicus/util"
 	"github.com/copernet/copernicus/util/amount"
+	"math/bits"
 )
 
+// ScriptExecutionMetrics collects statistics about the execution of scripts.
+type ScriptExecutionMetrics struct {
+	// SigChecks is the number of signature checks the scripts are charged
+	// for, as defined by the May 2020 upgrade: one per non-null signature of
+	// OP_CHECK(DATA)SIG(VERIFY), one per signature of a Schnorr
+	// OP_CHECKMULTISIG(VERIFY), and one per public key of a legacy
+	// OP_CHECKMULTISIG(VERIFY) with any non-null signature.
+	SigChecks int
+}
+
+// VerifyScript verifies the scriptSig of input nIn of transaction against the
+// scriptPubKey it spends. spentOutputs are the outputs spent by the inputs of
+// transaction, in input order, and may be nil when they are not known, in
+// which case the introspection opcodes reading them fail. The signature checks
+// executed are added to metrics, which may be nil.
 func VerifyScript(transaction *tx.Tx, scriptSig *script.Script, scriptPubKey *script.Script,
-	nIn int, value amount.Amount, flags uint32, scriptChecker Checker) error {
+	nIn int, value amount.Amount, flags uint32, scriptChecker Checker, spentOutputs []*txout.TxOut,
+	metrics *ScriptExecutionMetrics) error {
 	if flags&script.ScriptEnableSigHashForkID == script.ScriptEnableSigHashForkID {
 		flags |= script.ScriptVerifyStrictEnc
 	}
@@ -21,13 +39,16 @@ func VerifyScript(transaction *tx.Tx, scriptSig *script.Script, scriptPubKey *sc
 		log.Debug("ScriptErrSigPushOnly")
 		return errcode.New(errcode.ScriptErrSigPushOnly)
 	}
+	if metrics == nil {
+		metrics = &ScriptExecutionMetrics{}
+	}
 	stack := util.NewStack()
-	err := EvalScript(stack, scriptSig, transaction, nIn, value, flags, scriptChecker)
+	err := EvalScript(stack, scriptSig, transaction, nIn, value, flags, scriptChecker, spentOutputs, metrics)
 	if err != nil {
 		return err
 	}
 	stackCopy := stack.Copy()
-	err = EvalScript(stack, scriptPubKey, transaction, nIn, value, flags, scriptChecker)
+	err = EvalScript(stack, scriptPubKey, transaction, nIn, value, flags, scriptChecker, spentOutputs, metrics)
 	if err != nil {
 		return err
 	}
@@ -50,7 +71,16 @@ func VerifyScript(transaction *tx.Tx, scriptSig *script.Script, scriptPubKey *sc
 		topBytes := stack.Top(-1)
 		stack.Pop()
 		scriptPubKey2 := script.NewScriptRaw(topBytes.([]byte))
-		err = EvalScript(stack, scriptPubKey2, transaction, nIn, value, flags, scriptChecker)
+
+		// Bail out early if segwit recovery is allowed, the redeem script is
+		// a P2SH segwit program, and it was the only item pushed onto the
+		// stack.
+		if flags&script.ScriptAllowSegwitRecovery != 0 && stack.Empty() && scriptPubKey2.IsWitnessProgram() {
+			return nil
+		}
+
+		err = EvalScript(stack, scriptPubKey2, transaction, nIn, value, flags, scriptChecker, spentOutputs,
+			metrics)
 		if err != nil {
 			return err
 		}
@@ -81,11 +111,20 @@ func VerifyScript(transaction *tx.Tx, scriptSig *script.Script, scriptPubKey *sc
 			return errcode.New(errcode.ScriptErrCleanStack)
 		}
 	}
+
+	// The scriptSig must be large enough to pay for the signature checks it
+	// triggers: an input may execute at most (scriptSig.Size()+60)/43
+	// SigChecks, so a 59-byte scriptSig allows 2 of them.
+	if flags&script.ScriptVerifyInputSigChecks != 0 && scriptSig.Size() < metrics.SigChecks*43-60 {
+		log.Debug("ScriptErrInputSigChecks")
+		return errcode.New(errcode.ScriptErrInputSigChecks)
+	}
 	return nil
 }
 
 func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int,
-	money amount.Amount, flags uint32, scriptChecker Checker) error {
+	money amount.Amount, flags uint32, scriptChecker Checker, spentOutputs []*txout.TxOut,
+	metrics *ScriptExecutionMetrics) error {
 
 	if s.GetBadOpCode() {
 		log.Debug("ScriptErrBadOpCode, txid: %s, input: %d", transaction.GetHash().String(), nIn)
@@ -96,6 +135,9 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 		return errcode.New(errcode.ScriptErrScriptSize)
 	}
 
+	if metrics == nil {
+		metrics = &ScriptExecutionMetrics{}
+	}
 	nOpCount := 0
 
 	bnZero := script.ScriptNum{Value: 0}
@@ -111,6 +153,11 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 		fRequireMinimal = false
 	}
 
+	maxNumSize := script.DefaultMaxNumSize
+	if flags&script.ScriptEnable64BitIntegers == script.ScriptEnable64BitIntegers {
+		maxNumSize = script.MaxNumSize64Bit
+	}
+
 	var fExec bool
 	stackExec := util.NewStack()
 	stackAlt := util.NewStack()
@@ -606,7 +653,7 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 					log.Debug("ScriptErrInvalidStackOperation")
 					return errcode.New(errcode.ScriptErrInvalidStackOperation)
 				}
-				scriptNum, err := script.GetScriptNum(vch.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				scriptNum, err := script.GetScriptNum(vch.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					return err
 
@@ -788,15 +835,22 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 					log.Debug("ScriptErrInvalidStackOperation")
 					return errcode.New(errcode.ScriptErrInvalidStackOperation)
 				}
-				bn, err := script.GetScriptNum(vch.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				bn, err := script.GetScriptNum(vch.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					return err
 				}
+				var ok bool
 				switch e.OpValue {
 				case opcodes.OP_1ADD:
-					bn.Value += bnOne.Value
+					if bn.Value, ok = script.SafeAdd(bn.Value, bnOne.Value); !ok {
+						log.Debug("ScriptErrInvalidNumberRange64Bit")
+						return errcode.New(errcode.ScriptErrInvalidNumberRange64Bit)
+					}
 				case opcodes.OP_1SUB:
-					bn.Value -= bnOne.Value
+					if bn.Value, ok = script.SafeSub(bn.Value, bnOne.Value); !ok {
+						log.Debug("ScriptErrInvalidNumberRange64Bit")
+						return errcode.New(errcode.ScriptErrInvalidNumberRange64Bit)
+					}
 				case opcodes.OP_NEGATE:
 					bn.Value = -bn.Value
 				case opcodes.OP_ABS:
@@ -823,7 +877,7 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 					log.Debug("ScriptErrInvalidStackOperation")
 					return errcode.New(errcode.ScriptErrInvalidStackOperation)
 				}
-				bn, err := script.GetScriptNum(vch.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				bn, err := script.GetScriptNum(vch.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					return err
 				}
@@ -851,6 +905,8 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 				fallthrough
 			case opcodes.OP_SUB:
 				fallthrough
+			case opcodes.OP_MUL:
+				fallthrough
 			case opcodes.OP_DIV:
 				fallthrough
 			case opcodes.OP_MOD:
@@ -873,20 +929,32 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 					log.Debug("ScriptErrInvalidStackOperation")
 					return errcode.New(errcode.ScriptErrInvalidStackOperation)
 				}
-				bn1, err := script.GetScriptNum(vch1.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				bn1, err := script.GetScriptNum(vch1.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					return err
 				}
-				bn2, err := script.GetScriptNum(vch2.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				bn2, err := script.GetScriptNum(vch2.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					return err
 				}
 				bn := script.NewScriptNum(0)
+				var ok bool
 				switch e.OpValue {
 				case opcodes.OP_ADD:
-					bn.Value = bn1.Value + bn2.Value
+					if bn.Value, ok = script.SafeAdd(bn1.Value, bn2.Value); !ok {
+						log.Debug("ScriptErrInvalidNumberRange64Bit")
+						return errcode.New(errcode.ScriptErrInvalidNumberRange64Bit)
+					}
 				case opcodes.OP_SUB:
-					bn.Value = bn1.Value - bn2.Value
+					if bn.Value, ok = script.SafeSub(bn1.Value, bn2.Value); !ok {
+						log.Debug("ScriptErrInvalidNumberRange64Bit")
+						return errcode.New(errcode.ScriptErrInvalidNumberRange64Bit)
+					}
+				case opcodes.OP_MUL:
+					if bn.Value, ok = script.SafeMul(bn1.Value, bn2.Value); !ok {
+						log.Debug("ScriptErrInvalidNumberRange64Bit")
+						return errcode.New(errcode.ScriptErrInvalidNumberRange64Bit)
+					}
 				case opcodes.OP_DIV:
 					// denominator must not be 0
 					if bn2.Value == 0 {
@@ -956,11 +1024,11 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 					log.Debug("ScriptErrInvalidStackOperation")
 					return errcode.New(errcode.ScriptErrInvalidStackOperation)
 				}
-				bn1, err := script.GetScriptNum(vch1.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				bn1, err := script.GetScriptNum(vch1.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					return err
 				}
-				bn2, err := script.GetScriptNum(vch2.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				bn2, err := script.GetScriptNum(vch2.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					return err
 				}
@@ -1060,15 +1128,15 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 					log.Debug("ScriptErrInvalidStackOperation")
 					return errcode.New(errcode.ScriptErrInvalidStackOperation)
 				}
-				bn1, err := script.GetScriptNum(vch1.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				bn1, err := script.GetScriptNum(vch1.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					return err
 				}
-				bn2, err := script.GetScriptNum(vch2.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				bn2, err := script.GetScriptNum(vch2.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					return err
 				}
-				bn3, err := script.GetScriptNum(vch3.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				bn3, err := script.GetScriptNum(vch3.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					return err
 				}
@@ -1168,10 +1236,13 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 				scriptCode.FindAndDelete(vchScript)*/
 				scriptCode = scriptCode.RemoveOpcodeByData(vchSigBytes)
 
-				fSuccess, err := scriptChecker.CheckSig(transaction, vchSigBytes, vchPubkey.([]byte), scriptCode, nIn, money, flags)
+				fSuccess, err := scriptChecker.CheckSig(transaction, vchSigBytes, vchPubkey.([]byte), scriptCode, nIn, money, flags, spentOutputs)
 				if err != nil {
 					return err
 				}
+				if len(vchSigBytes) > 0 {
+					metrics.SigChecks++
+				}
 
 				if !fSuccess &&
 					(flags&script.ScriptVerifyNullFail == script.ScriptVerifyNullFail) &&
@@ -1235,8 +1306,9 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 
 				success := false
 				if len(vchSigBytes) > 0 {
+					metrics.SigChecks++
 					vchHashs := util.Sha256Hash(vchMessage.([]byte))
-					success, err = scriptChecker.VerifySignature(vchSigBytes, ppubKey, &vchHashs)
+					success, err = scriptChecker.VerifySignature(vchSigBytes, ppubKey, &vchHashs, flags)
 					if err != nil {
 						log.Debug("verify error")
 					}
@@ -1283,7 +1355,7 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 				}
 
 				// ScriptSig1 ScriptSig2...ScriptSigM M PubKey1 PubKey2...PubKey N
-				pubKeysNum, err := script.GetScriptNum(vch.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				pubKeysNum, err := script.GetScriptNum(vch.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					//log.Debug("ScriptErrInvalidStackOperation")
 					return err
@@ -1317,7 +1389,7 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 					log.Debug("ScriptErrInvalidStackOperation")
 					return errcode.New(errcode.ScriptErrInvalidStackOperation)
 				}
-				nSigsNum, err := script.GetScriptNum(sigsNumVch.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				nSigsNum, err := script.GetScriptNum(sigsNumVch.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					//log.Debug("ScriptErrInvalidStackOperation")
 					return err
@@ -1340,53 +1412,76 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 				scriptCode := script.NewScriptOps(s.ParsedOpCodes[beginCodeHash:])
 
 				// Drop the signature in pre-segwit scripts but not segwit scripts
+				allSigsNull := true
 				for k := 0; k < int(nSigsCount); k++ {
 					vchSig := stack.Top(-iSig - k)
 					if vchSig == nil {
 						log.Debug("ScriptErrInvalidStackOperation")
 						return errcode.New(errcode.ScriptErrInvalidStackOperation)
 					}
+					if len(vchSig.([]byte)) > 0 {
+						allSigsNull = false
+					}
 					scriptCode = scriptCode.RemoveOpcodeByData(vchSig.([]byte))
 				}
 				fSuccess := true
-				for fSuccess && nSigsCount > 0 {
-					vchSig := stack.Top(-iSig)
-					if vchSig == nil {
-						log.Debug("ScriptErrInvalidStackOperation")
-						return errcode.New(errcode.ScriptErrInvalidStackOperation)
-					}
-					vchPubkey := stack.Top(-iPubKey)
-					if vchPubkey == nil {
-						log.Debug("ScriptErrInvalidStackOperation")
-						return errcode.New(errcode.ScriptErrInvalidStackOperation)
-					}
-					// Note how this makes the exact order of
-					// pubkey/signature evaluation distinguishable by
-					// CHECKMULTISIG NOT if the STRICTENC flag is set.
-					// See the script_(in)valid tests for details.
-					err := script.CheckTransactionSignatureEncoding(vchSig.([]byte), flags)
-					if err != nil {
-						return err
-					}
-					err = script.CheckPubKeyEncoding(vchPubkey.([]byte), flags)
+				// With Schnorr multisig enabled, a non-null dummy element is a
+				// bitfield selecting which public keys the signatures are
+				// checked against.
+				isSchnorrMultiSig := flags&script.ScriptEnableSchnorrMultisig != 0 &&
+					len(stack.Top(-i).([]byte)) > 0
+				if isSchnorrMultiSig {
+					err := verifySchnorrMultiSig(transaction, stack, stack.Top(-i).([]byte), iSig, iPubKey,
+						int(nSigsCount), int(pubKeysCount), scriptCode, nIn, money, flags, scriptChecker, spentOutputs)
 					if err != nil {
 						return err
 					}
-					fOk, err := scriptChecker.CheckSig(transaction, vchSig.([]byte), vchPubkey.([]byte), scriptCode, nIn, money, flags)
-					if err != nil {
-						return err
-					}
-					if fOk {
-						iSig++
-						nSigsCount--
+					metrics.SigChecks += int(nSigsCount)
+				} else {
+					// A legacy multisig with any signature is charged for
+					// every public key it may check.
+					if !allSigsNull {
+						metrics.SigChecks += int(pubKeysCount)
 					}
-					iPubKey++
-					pubKeysCount--
-					// If there are more signatures left than keys left,
-					// then too many signatures have failed. Exit early,
-					// without checking any further signatures.
-					if nSigsCount > pubKeysCount {
-						fSuccess = false
+					for fSuccess && nSigsCount > 0 {
+						vchSig := stack.Top(-iSig)
+						if vchSig == nil {
+							log.Debug("ScriptErrInvalidStackOperation")
+							return errcode.New(errcode.ScriptErrInvalidStackOperation)
+						}
+						vchPubkey := stack.Top(-iPubKey)
+						if vchPubkey == nil {
+							log.Debug("ScriptErrInvalidStackOperation")
+							return errcode.New(errcode.ScriptErrInvalidStackOperation)
+						}
+						// Note how this makes the exact order of
+						// pubkey/signature evaluation distinguishable by
+						// CHECKMULTISIG NOT if the STRICTENC flag is set.
+						// See the script_(in)valid tests for details.
+						err := script.CheckTransactionECDSASignatureEncoding(vchSig.([]byte), flags)
+						if err != nil {
+							return err
+						}
+						err = script.CheckPubKeyEncoding(vchPubkey.([]byte), flags)
+						if err != nil {
+							return err
+						}
+						fOk, err := scriptChecker.CheckSig(transaction, vchSig.([]byte), vchPubkey.([]byte), scriptCode, nIn, money, flags, spentOutputs)
+						if err != nil {
+							return err
+						}
+						if fOk {
+							iSig++
+							nSigsCount--
+						}
+						iPubKey++
+						pubKeysCount--
+						// If there are more signatures left than keys left,
+						// then too many signatures have failed. Exit early,
+						// without checking any further signatures.
+						if nSigsCount > pubKeysCount {
+							fSuccess = false
+						}
 					}
 				}
 				// Clean up stack of actual arguments
@@ -1415,7 +1510,7 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 					log.Debug("ScriptErrInvalidStackOperation")
 					return errcode.New(errcode.ScriptErrInvalidStackOperation)
 				}
-				if flags&script.ScriptVerifyNullDummy == script.ScriptVerifyNullDummy &&
+				if !isSchnorrMultiSig && flags&script.ScriptVerifyNullDummy == script.ScriptVerifyNullDummy &&
 					len(stack.Top(-1).([]byte)) > 0 {
 					log.Debug("ScriptErrSigNullDummy")
 					return errcode.New(errcode.ScriptErrSigNullDummy)
@@ -1469,7 +1564,7 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 
 				vch1 := stack.Top(-2)
 				vch2 := stack.Top(-1)
-				scriptNum, err := script.GetScriptNum(vch2.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				scriptNum, err := script.GetScriptNum(vch2.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					log.Debug("ScriptErrInvalidStackOperation")
 					return errcode.New(errcode.ScriptErrInvalidStackOperation)
@@ -1501,7 +1596,7 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 					return errcode.New(errcode.ScriptErrInvalidStackOperation)
 				}
 				vch2 := stack.Top(-1)
-				scriptNum, err := script.GetScriptNum(vch2.([]byte), fRequireMinimal, script.DefaultMaxNumSize)
+				scriptNum, err := script.GetScriptNum(vch2.([]byte), fRequireMinimal, maxNumSize)
 				if err != nil {
 					return err
 				}
@@ -1555,12 +1650,96 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 				vchEncode := script.MinimallyEncode(vch.([]byte))
 
 				// The resulting number must be a valid number.
-				if !script.IsMinimallyEncoded(vchEncode, script.DefaultMaxNumSize) {
+				if !script.IsMinimallyEncoded(vchEncode, int64(maxNumSize)) {
 					log.Debug("ScriptErrInvalidNumberRange")
 					return errcode.New(errcode.ScriptErrInvalidNumberRange)
 				}
 				stack.Pop()
 				stack.Push(vchEncode)
+
+			case opcodes.OP_REVERSEBYTES:
+				if flags&script.ScriptEnableOpReverseBytes == 0 {
+					log.Debug("ScriptErrBadOpCode")
+					return errcode.New(errcode.ScriptErrBadOpCode)
+				}
+
+				// (in -- out)
+				if stack.Size() < 1 {
+					log.Debug("ScriptErrInvalidStackOperation")
+					return errcode.New(errcode.ScriptErrInvalidStackOperation)
+				}
+
+				vch := stack.Top(-1).([]byte)
+				vchReversed := make([]byte, len(vch))
+				for k := range vch {
+					vchReversed[len(vch)-1-k] = vch[k]
+				}
+				stack.Pop()
+				stack.Push(vchReversed)
+
+				//
+				// Native introspection
+				//
+			case opcodes.OP_INPUTINDEX:
+				fallthrough
+			case opcodes.OP_ACTIVEBYTECODE:
+				fallthrough
+			case opcodes.OP_TXVERSION:
+				fallthrough
+			case opcodes.OP_TXINPUTCOUNT:
+				fallthrough
+			case opcodes.OP_TXOUTPUTCOUNT:
+				fallthrough
+			case opcodes.OP_TXLOCKTIME:
+				fallthrough
+			case opcodes.OP_UTXOVALUE:
+				fallthrough
+			case opcodes.OP_UTXOBYTECODE:
+				fallthrough
+			case opcodes.OP_OUTPOINTTXHASH:
+				fallthrough
+			case opcodes.OP_OUTPOINTINDEX:
+				fallthrough
+			case opcodes.OP_INPUTBYTECODE:
+				fallthrough
+			case opcodes.OP_INPUTSEQUENCENUMBER:
+				fallthrough
+			case opcodes.OP_OUTPUTVALUE:
+				fallthrough
+			case opcodes.OP_OUTPUTBYTECODE:
+				if flags&script.ScriptEnableNativeIntrospection == 0 {
+					log.Debug("ScriptErrBadOpCode")
+					return errcode.New(errcode.ScriptErrBadOpCode)
+				}
+				err := evalIntrospection(e.OpValue, stack, s.ParsedOpCodes[beginCodeHash:], transaction, nIn,
+					spentOutputs, fRequireMinimal, maxNumSize)
+				if err != nil {
+					return err
+				}
+
+				//
+				// Token introspection
+				//
+			case opcodes.OP_UTXOTOKENCATEGORY:
+				fallthrough
+			case opcodes.OP_UTXOTOKENCOMMITMENT:
+				fallthrough
+			case opcodes.OP_UTXOTOKENAMOUNT:
+				fallthrough
+			case opcodes.OP_OUTPUTTOKENCATEGORY:
+				fallthrough
+			case opcodes.OP_OUTPUTTOKENCOMMITMENT:
+				fallthrough
+			case opcodes.OP_OUTPUTTOKENAMOUNT:
+				if flags&script.ScriptEnableNativeIntrospection == 0 || flags&script.ScriptEnableTokens == 0 {
+					log.Debug("ScriptErrBadOpCode")
+					return errcode.New(errcode.ScriptErrBadOpCode)
+				}
+				err := evalIntrospection(e.OpValue, stack, nil, transaction, nIn, spentOutputs,
+					fRequireMinimal, maxNumSize)
+				if err != nil {
+					return err
+				}
 			default:
 				return errcode.New(errcode.ScriptErrBadOpCode)
 			}
@@ -1578,3 +1757,82 @@ func EvalScript(stack *util.Stack, s *script.Script, transaction *tx.Tx, nIn int
 
 	return nil
 }
+
+// decodeBitfield decodes the little endian Schnorr multisig dummy element into
+// a bitfield of size bits.
+func decodeBitfield(vch []byte, size int) (uint32, error) {
+	if size > 32 {
+		log.Debug("ScriptErrInvalidBitfieldSize")
+		return 0, errcode.New(errcode.ScriptErrInvalidBitfieldSize)
+	}
+	if len(vch) != (size+7)/8 {
+		log.Debug("ScriptErrInvalidBitfieldSize")
+		return 0, errcode.New(errcode.ScriptErrInvalidBitfieldSize)
+	}
+
+	var bitfield uint32
+	for i, b := range vch {
+		bitfield |= uint32(b) << (8 * uint(i))
+	}
+
+	mask := uint32((uint64(1) << uint(size)) - 1)
+	if bitfield&mask != bitfield {
+		log.Debug("ScriptErrInvalidBitRange")
+		return 0, errcode.New(errcode.ScriptErrInvalidBitRange)
+	}
+	return bitfield, nil
+}
+
+// verifySchnorrMultiSig checks the signatures of a Schnorr-mode
+// OP_CHECKMULTISIG. iSig and iPubKey are the stack positions of the topmost
+// signature and public key, signatures and the keys selected by the bitfield
+// are matched in the order they were pushed.
+func verifySchnorrMultiSig(transaction *tx.Tx, stack *util.Stack, vchDummy []byte, iSig int, iPubKey int,
+	nSigsCount int, pubKeysCount int, scriptCode *script.Script, nIn int, money amount.Amount,
+	flags uint32, scriptChecker Checker, spentOutputs []*txout.TxOut) error {
+	checkBits, err := decodeBitfield(vchDummy, pubKeysCount)
+	if err != nil {
+		return err
+	}
+
+	if bits.OnesCount32(checkBits) != nSigsCount {
+		log.Debug("ScriptErrInvalidBitCount")
+		return errcode.New(errcode.ScriptErrInvalidBitCount)
+	}
+
+	iBottomKey := iPubKey + pubKeysCount - 1
+	iBottomSig := iSig + nSigsCount - 1
+
+	iKey := 0
+	for k := 0; k < nSigsCount; k++ {
+		// Find the next key selected by the bitfield.
+		for (checkBits>>uint(iKey))&0x01 == 0 {
+			iKey++
+		}
+
+		vchSig := stack.Top(-(iBottomSig - k)).([]byte)
+		vchPubkey := stack.Top(-(iBottomKey - iKey)).([]byte)
+
+		// Only the public keys associated with a signature are checked.
+		if err := script.CheckTransactionSchnorrSignatureEncoding(vchSig, flags); err != nil {
+			return err
+		}
+		if err := script.CheckPubKeyEncoding(vchPubkey, flags); err != nil {
+			return err
+		}
+
+		fOk, err := scriptChecker.CheckSig(transaction, vchSig, vchPubkey, scriptCode, nIn, money, flags, spentOutputs)
+		if err != nil {
+			return err
+		}
+		// An empty signature fails here as well, which is a NULLFAIL error
+		// since the bitfield is not null.
+		if !fOk {
+			log.Debug("ScriptErrSigNullFail")
+			return errcode.New(errcode.ScriptErrSigNullFail)
+		}
+		iKey++
+	}
+
+	return nil
+}
@@ -253,7 +253,7 @@ func (tb *TestBuilder) PushSig(
 	flags int,
 ) *TestBuilder {
 	txSigHash, err := tx.SignatureHash(tb.spendTx, tb.script, sigHash,
-		0, amount.Amount(value), uint32(flags))
+		0, amount.Amount(value), uint32(flags), nil)
 	if err != nil {
 		panic(err)
 	}
@@ -297,6 +297,8 @@ func DoTest(
 		amount.Amount(value),
 		flag,
 		NewScriptRealChecker(),
+		nil,
+		nil,
 	)
 
 	if scriptError == 0 {
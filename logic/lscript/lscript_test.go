@@ -121,6 +121,14 @@ var scriptFlagMap = map[string]uint32{
 	"SIGHASH_FORKID":             script.ScriptEnableSigHashForkID,
 	"REPLAY_PROTECTION":          script.ScriptEnableReplayProtection,
 	"CHECKDATASIG":               script.ScriptEnableCheckDataSig,
+	"SCHNORR":                    script.ScriptEnableSchnorr,
+	"SCHNORR_MULTISIG":           script.ScriptEnableSchnorrMultisig,
+	"ALLOW_SEGWIT_RECOVERY":      script.ScriptAllowSegwitRecovery,
+	"64_BIT_INTEGERS":            script.ScriptEnable64BitIntegers,
+	"NATIVE_INTROSPECTION":       script.ScriptEnableNativeIntrospection,
+	"TOKENS":                     script.ScriptEnableTokens,
+	"REVERSEBYTES":               script.ScriptEnableOpReverseBytes,
+	"INPUT_SIGCHECKS":            script.ScriptVerifyInputSigChecks,
 }
 
 type scriptErrChecker struct {
@@ -312,7 +320,8 @@ func doScriptJSONTest(t *testing.T, itest []interface{}, sec scriptErrChecker) (
 	trax.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(pretx.GetHash(), 0), scriptSig, script.SequenceFinal))
 	trax.AddTxOut(txout.NewTxOut(amount.Amount(nValue), script.NewScriptRaw([]byte{})))
 
-	err = VerifyScript(trax, scriptSig, scriptPubKey, 0, amount.Amount(nValue), flags, NewScriptRealChecker())
+	err = VerifyScript(trax, scriptSig, scriptPubKey, 0, amount.Amount(nValue), flags, NewScriptRealChecker(),
+		[]*txout.TxOut{pretx.GetTxOut(0)}, nil)
 
 	if err = sec.check(err, scriptErrorString); err != nil {
 		for _, v := range test {
@@ -393,7 +402,7 @@ func parseScriptFlag(s string) (uint32, error) {
 
 func signMultisig(scriptPubKey *script.Script, keys []crypto.PrivateKey, transaction *tx.Tx) *script.Script {
 	hash, _ := tx.SignatureHash(transaction, scriptPubKey,
-		uint32(crypto.SigHashAll), 0, amount.Amount(0), 0)
+		uint32(crypto.SigHashAll), 0, amount.Amount(0), 0, nil)
 	result := script.NewEmptyScript()
 	result.PushOpCode(opcodes.OP_0)
 	for _, key := range keys {
@@ -429,22 +438,22 @@ func TestScriptCHECKMULTISIG12(t *testing.T) {
 	txTo12.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(txFrom12.GetHash(), 0),
 		script.NewEmptyScript(), script.SequenceFinal))
 	goodsig1 := signMultisig(scriptPubKey12, []crypto.PrivateKey{key1}, &txTo12)
-	if err := VerifyScript(&txTo12, goodsig1, scriptPubKey12, 0, 0, flag, NewScriptRealChecker()); err != nil {
+	if err := VerifyScript(&txTo12, goodsig1, scriptPubKey12, 0, 0, flag, NewScriptRealChecker(), nil, nil); err != nil {
 		t.Errorf("checkMultiSig fail, sk = key1, pk = key12")
 	}
 
 	txTo12.AddTxOut(txout.NewTxOut(0, script.NewEmptyScript()))
-	if err := VerifyScript(&txTo12, goodsig1, scriptPubKey12, 0, 0, flag, NewScriptRealChecker()); err == nil {
+	if err := VerifyScript(&txTo12, goodsig1, scriptPubKey12, 0, 0, flag, NewScriptRealChecker(), nil, nil); err == nil {
 		t.Errorf("checkMultiSig should fail, sk = key1, pk = key12, bug sig damaged")
 	}
 
 	goodsig2 := signMultisig(scriptPubKey12, []crypto.PrivateKey{key2}, &txTo12)
-	if err := VerifyScript(&txTo12, goodsig2, scriptPubKey12, 0, 0, flag, NewScriptRealChecker()); err != nil {
+	if err := VerifyScript(&txTo12, goodsig2, scriptPubKey12, 0, 0, flag, NewScriptRealChecker(), nil, nil); err != nil {
 		t.Errorf("checkMultiSig fail, sk = key2, pk = key12")
 	}
 
 	badsig1 := signMultisig(scriptPubKey12, []crypto.PrivateKey{key3}, &txTo12)
-	if err := VerifyScript(&txTo12, badsig1, scriptPubKey12, 0, 0, flag, NewScriptRealChecker()); err == nil {
+	if err := VerifyScript(&txTo12, badsig1, scriptPubKey12, 0, 0, flag, NewScriptRealChecker(), nil, nil); err == nil {
 		t.Errorf("checkMultiSig should fail, sk = key3, pk = key12")
 	}
 }
@@ -467,39 +476,39 @@ func TestScriptCHECKMULTISIG23(t *testing.T) {
 	txTo23.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(txFrom23.GetHash(), 0),
 		script.NewEmptyScript(), script.SequenceFinal))
 	goodsig1 := signMultisig(scriptPubKey23, []crypto.PrivateKey{key1, key2}, &txTo23)
-	if err := VerifyScript(&txTo23, goodsig1, scriptPubKey23, 0, 0, flag, NewScriptRealChecker()); err != nil {
+	if err := VerifyScript(&txTo23, goodsig1, scriptPubKey23, 0, 0, flag, NewScriptRealChecker(), nil, nil); err != nil {
 		t.Errorf("checkMultiSig fail, sk = key12, pk = key123")
 	}
 	goodsig2 := signMultisig(scriptPubKey23, []crypto.PrivateKey{key1, key3}, &txTo23)
-	if err := VerifyScript(&txTo23, goodsig2, scriptPubKey23, 0, 0, flag, NewScriptRealChecker()); err != nil {
+	if err := VerifyScript(&txTo23, goodsig2, scriptPubKey23, 0, 0, flag, NewScriptRealChecker(), nil, nil); err != nil {
 		t.Errorf("checkMultiSig fail, sk = key13, pk = key123")
 	}
 	goodsig3 := signMultisig(scriptPubKey23, []crypto.PrivateKey{key2, key3}, &txTo23)
-	if err := VerifyScript(&txTo23, goodsig3, scriptPubKey23, 0, 0, flag, NewScriptRealChecker()); err != nil {
+	if err := VerifyScript(&txTo23, goodsig3, scriptPubKey23, 0, 0, flag, NewScriptRealChecker(), nil, nil); err != nil {
 		t.Errorf("checkMultiSig fail, sk = key23, pk = key123")
 	}
 	badsig1 := signMultisig(scriptPubKey23, []crypto.PrivateKey{key2, key2}, &txTo23)
-	if err := VerifyScript(&txTo23, badsig1, scriptPubKey23, 0, 0, flag, NewScriptRealChecker()); err == nil {
+	if err := VerifyScript(&txTo23, badsig1, scriptPubKey23, 0, 0, flag, NewScriptRealChecker(), nil, nil); err == nil {
 		t.Errorf("checkMultiSig should fail, sk = key22, pk = key123")
 	}
 	badsig2 := signMultisig(scriptPubKey23, []crypto.PrivateKey{key2, key1}, &txTo23)
-	if err := VerifyScript(&txTo23, badsig2, scriptPubKey23, 0, 0, flag, NewScriptRealChecker()); err == nil {
+	if err := VerifyScript(&txTo23, badsig2, scriptPubKey23, 0, 0, flag, NewScriptRealChecker(), nil, nil); err == nil {
 		t.Errorf("checkMultiSig should fail, sk = key21, pk = key123")
 	}
 	badsig3 := signMultisig(scriptPubKey23, []crypto.PrivateKey{key3, key2}, &txTo23)
-	if err := VerifyScript(&txTo23, badsig3, scriptPubKey23, 0, 0, flag, NewScriptRealChecker()); err == nil {
+	if err := VerifyScript(&txTo23, badsig3, scriptPubKey23, 0, 0, flag, NewScriptRealChecker(), nil, nil); err == nil {
 		t.Errorf("checkMultiSig should fail, sk = key32, pk = key123")
 	}
 	badsig4 := signMultisig(scriptPubKey23, []crypto.PrivateKey{key4, key2}, &txTo23)
-	if err := VerifyScript(&txTo23, badsig4, scriptPubKey23, 0, 0, flag, NewScriptRealChecker()); err == nil {
+	if err := VerifyScript(&txTo23, badsig4, scriptPubKey23, 0, 0, flag, NewScriptRealChecker(), nil, nil); err == nil {
 		t.Errorf("checkMultiSig should fail, sk = key42, pk = key123")
 	}
 	badsig5 := signMultisig(scriptPubKey23, []crypto.PrivateKey{key1, key4}, &txTo23)
-	if err := VerifyScript(&txTo23, badsig5, scriptPubKey23, 0, 0, flag, NewScriptRealChecker()); err == nil {
+	if err := VerifyScript(&txTo23, badsig5, scriptPubKey23, 0, 0, flag, NewScriptRealChecker(), nil, nil); err == nil {
 		t.Errorf("checkMultiSig should fail, sk = key14, pk = key123")
 	}
 	badsig6 := signMultisig(scriptPubKey23, []crypto.PrivateKey{}, &txTo23)
-	if err := VerifyScript(&txTo23, badsig6, scriptPubKey23, 0, 0, flag, NewScriptRealChecker()); err == nil {
+	if err := VerifyScript(&txTo23, badsig6, scriptPubKey23, 0, 0, flag, NewScriptRealChecker(), nil, nil); err == nil {
 		t.Errorf("checkMultiSig should fail, sk = key{empty}, pk = key123")
 	}
 }
@@ -512,13 +521,13 @@ func TestScriptPushData(t *testing.T) {
 	pushdatascript := [][]byte{pushdata1, pushdata2, pushdata4}
 	directStack := util.NewStack()
 	if err := EvalScript(directStack, script.NewScriptRaw(direct),
-		nil, 0, 0, script.ScriptVerifyP2SH, NewScriptRealChecker()); err != nil {
+		nil, 0, 0, script.ScriptVerifyP2SH, NewScriptRealChecker(), nil, nil); err != nil {
 		t.Error(err)
 	}
 	for i := 0; i < 3; i++ {
 		pushdataStack := util.NewStack()
 		if err := EvalScript(pushdataStack, script.NewScriptRaw(pushdatascript[i]),
-			nil, 0, 0, script.ScriptVerifyP2SH, NewScriptRealChecker()); err != nil {
+			nil, 0, 0, script.ScriptVerifyP2SH, NewScriptRealChecker(), nil, nil); err != nil {
 			t.Error(err)
 		}
 		if !reflect.DeepEqual(directStack, pushdataStack) {
@@ -535,7 +544,7 @@ func TestScriptStandardPush(t *testing.T) {
 			t.Errorf("Number %d is not pure push.", i)
 		}
 		if VerifyScript(nil, s, script.NewScriptRaw([]byte{opcodes.OP_1}),
-			0, 0, script.ScriptVerifyMinmalData, NewScriptRealChecker()) != nil {
+			0, 0, script.ScriptVerifyMinmalData, NewScriptRealChecker(), nil, nil) != nil {
 			t.Errorf("Number %d push is not minimal data.", i)
 		}
 	}
@@ -546,7 +555,7 @@ func TestScriptStandardPush(t *testing.T) {
 			t.Errorf("Length %d is not pure push.", i)
 		}
 		if VerifyScript(nil, s, script.NewScriptRaw([]byte{opcodes.OP_1}),
-			0, 0, script.ScriptVerifyMinmalData, NewScriptRealChecker()) != nil {
+			0, 0, script.ScriptVerifyMinmalData, NewScriptRealChecker(), nil, nil) != nil {
 			t.Errorf("Length %d push is not minimal data.", i)
 		}
 	}
@@ -559,3 +568,218 @@ func TestIsPushOnlyOnInvalidScripts(t *testing.T) {
 		t.Errorf("IsPushOnly should return false on invalid scripts")
 	}
 }
+
+func TestIntrospectionContext(t *testing.T) {
+	flags := uint32(script.ScriptEnableNativeIntrospection)
+	for _, code := range []byte{opcodes.OP_INPUTINDEX, opcodes.OP_TXVERSION, opcodes.OP_ACTIVEBYTECODE} {
+		err := EvalScript(util.NewStack(), script.NewScriptRaw([]byte{code}), nil, 0, 0, flags,
+			NewScriptRealChecker(), nil, nil)
+		if !errcode.IsErrorCode(err, errcode.ScriptErrContextNotPresent) {
+			t.Errorf("opcode %s without a transaction: error %v", opcodes.GetOpName(int(code)), err)
+		}
+	}
+
+	transaction := tx.NewTx(0, 1)
+	transaction.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(util.Hash{}, 0), script.NewEmptyScript(),
+		script.SequenceFinal))
+	transaction.AddTxOut(txout.NewTxOut(1, script.NewEmptyScript()))
+	spent := txout.NewTxOut(7, script.NewScriptRaw([]byte{opcodes.OP_TRUE}))
+
+	tests := []struct {
+		scriptPubKey []byte
+		spentOutputs []*txout.TxOut
+		errCode      errcode.ScriptErr
+	}{
+		{[]byte{opcodes.OP_0, opcodes.OP_UTXOVALUE, opcodes.OP_7, opcodes.OP_EQUAL}, []*txout.TxOut{spent},
+			errcode.ScriptErrOK},
+		{[]byte{opcodes.OP_0, opcodes.OP_UTXOVALUE}, nil, errcode.ScriptErrContextNotPresent},
+		{[]byte{opcodes.OP_0, opcodes.OP_UTXOBYTECODE}, []*txout.TxOut{nil}, errcode.ScriptErrContextNotPresent},
+		{[]byte{opcodes.OP_0, opcodes.OP_OUTPUTVALUE, opcodes.OP_1, opcodes.OP_EQUAL}, nil, errcode.ScriptErrOK},
+	}
+
+	for i, test := range tests {
+		err := VerifyScript(transaction, script.NewEmptyScript(), script.NewScriptRaw(test.scriptPubKey), 0, 7,
+			flags, NewScriptRealChecker(), test.spentOutputs, nil)
+		if test.errCode == errcode.ScriptErrOK {
+			if err != nil {
+				t.Errorf("%dth test: unexpected error %v", i, err)
+			}
+			continue
+		}
+		if !errcode.IsErrorCode(err, test.errCode) {
+			t.Errorf("%dth test: error %v, expect %v", i, err, test.errCode)
+		}
+	}
+}
+
+func TestTokenIntrospection(t *testing.T) {
+	category := util.Hash{0xaa, 0xbb}
+	tokenData := txout.NewTokenData(category, 300, true, txout.TokenCapabilityMinting, []byte{0xcc, 0xdd})
+
+	transaction := tx.NewTx(0, 1)
+	transaction.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(util.Hash{}, 0), script.NewEmptyScript(),
+		script.SequenceFinal))
+	transaction.AddTxOut(txout.NewTxOut(1, script.NewEmptyScript()))
+	spent := []*txout.TxOut{txout.NewTokenTxOut(7, script.NewScriptRaw([]byte{opcodes.OP_TRUE}), tokenData)}
+
+	push := func(data []byte) []byte {
+		return append([]byte{byte(len(data))}, data...)
+	}
+	check := func(code byte, expect []byte) []byte {
+		return append(append([]byte{opcodes.OP_0, code}, push(expect)...), opcodes.OP_EQUAL)
+	}
+
+	flags := uint32(script.ScriptEnableNativeIntrospection | script.ScriptEnableTokens)
+	tests := []struct {
+		scriptPubKey []byte
+		flags        uint32
+		errCode      errcode.ScriptErr
+	}{
+		{check(opcodes.OP_UTXOTOKENCATEGORY, append(category[:], txout.TokenCapabilityMinting)), flags,
+			errcode.ScriptErrOK},
+		{check(opcodes.OP_UTXOTOKENCOMMITMENT, []byte{0xcc, 0xdd}), flags, errcode.ScriptErrOK},
+		{check(opcodes.OP_UTXOTOKENAMOUNT, []byte{0x2c, 0x01}), flags, errcode.ScriptErrOK},
+		{check(opcodes.OP_OUTPUTTOKENCATEGORY, nil), flags, errcode.ScriptErrOK},
+		{check(opcodes.OP_OUTPUTTOKENCOMMITMENT, nil), flags, errcode.ScriptErrOK},
+		{check(opcodes.OP_OUTPUTTOKENAMOUNT, nil), flags, errcode.ScriptErrOK},
+		{[]byte{opcodes.OP_1, opcodes.OP_OUTPUTTOKENAMOUNT}, flags, errcode.ScriptErrInvalidTxOutputIndex},
+		{check(opcodes.OP_UTXOTOKENAMOUNT, []byte{0x2c, 0x01}), uint32(script.ScriptEnableNativeIntrospection),
+			errcode.ScriptErrBadOpCode},
+		{check(opcodes.OP_UTXOTOKENAMOUNT, []byte{0x2c, 0x01}), uint32(script.ScriptEnableTokens),
+			errcode.ScriptErrBadOpCode},
+	}
+
+	for i, test := range tests {
+		err := VerifyScript(transaction, script.NewEmptyScript(), script.NewScriptRaw(test.scriptPubKey), 0, 7,
+			test.flags, NewScriptRealChecker(), spent, nil)
+		if test.errCode == errcode.ScriptErrOK {
+			if err != nil {
+				t.Errorf("%dth test: unexpected error %v", i, err)
+			}
+			continue
+		}
+		if !errcode.IsErrorCode(err, test.errCode) {
+			t.Errorf("%dth test: error %v, expect %v", i, err, test.errCode)
+		}
+	}
+
+	// An immutable NFT category has no capability byte.
+	immutable := txout.NewTokenData(category, 0, true, txout.TokenCapabilityNone, nil)
+	stack := util.NewStack()
+	pushTokenData(stack, opcodes.OP_OUTPUTTOKENCATEGORY, immutable)
+	if !bytes.Equal(stack.Top(-1).([]byte), category[:]) {
+		t.Errorf("immutable NFT category %x, expect %x", stack.Top(-1), category[:])
+	}
+}
+
+// falseSigChecker fails every signature check without an error.
+type falseSigChecker struct {
+	EmptyChecker
+}
+
+func (c *falseSigChecker) CheckSig(transaction *tx.Tx, signature []byte, pubKey []byte, scriptCode *script.Script,
+	nIn int, money amount.Amount, flags uint32, spentOutputs []*txout.TxOut) (bool, error) {
+	return false, nil
+}
+
+func TestSigChecksMetrics(t *testing.T) {
+	sig := []byte{2, 0x30, 0x01}
+	pubKey := append([]byte{33, 0x02}, bytes.Repeat([]byte{0x11}, 32)...)
+	join := func(parts ...[]byte) []byte {
+		var res []byte
+		for _, part := range parts {
+			res = append(res, part...)
+		}
+		return res
+	}
+	op := func(codes ...byte) []byte {
+		return codes
+	}
+
+	flags := uint32(script.ScriptEnableCheckDataSig)
+	tests := []struct {
+		scriptPubKey []byte
+		sigChecks    int
+	}{
+		{join(sig, pubKey, op(opcodes.OP_CHECKSIG, opcodes.OP_NOT)), 1},
+		{join(op(opcodes.OP_0), pubKey, op(opcodes.OP_CHECKSIG, opcodes.OP_NOT)), 0},
+		{join(sig, op(opcodes.OP_0), pubKey, op(opcodes.OP_CHECKDATASIG, opcodes.OP_NOT)), 1},
+		{join(op(opcodes.OP_0, opcodes.OP_0), pubKey, op(opcodes.OP_CHECKDATASIG, opcodes.OP_NOT)), 0},
+		{join(op(opcodes.OP_0), sig, sig, op(opcodes.OP_2), pubKey, pubKey, pubKey,
+			op(opcodes.OP_3, opcodes.OP_CHECKMULTISIG, opcodes.OP_NOT)), 3},
+		{join(op(opcodes.OP_0, opcodes.OP_0, opcodes.OP_0, opcodes.OP_2), pubKey, pubKey, pubKey,
+			op(opcodes.OP_3, opcodes.OP_CHECKMULTISIG, opcodes.OP_NOT)), 0},
+	}
+
+	for i, test := range tests {
+		metrics := ScriptExecutionMetrics{}
+		err := EvalScript(util.NewStack(), script.NewScriptRaw(test.scriptPubKey), nil, 0, 0, flags,
+			&falseSigChecker{}, nil, &metrics)
+		if err != nil {
+			t.Errorf("%dth test: unexpected error %v", i, err)
+			continue
+		}
+		if metrics.SigChecks != test.sigChecks {
+			t.Errorf("%dth test: SigChecks %d, expect %d", i, metrics.SigChecks, test.sigChecks)
+		}
+	}
+
+	// Three SigChecks need a scriptSig of at least 3*43-60 = 69 bytes.
+	multisig := script.NewScriptRaw(tests[4].scriptPubKey)
+	transaction := tx.NewTx(0, 1)
+	smallSig := script.NewScriptRaw(join(op(67), make([]byte, 67)))
+	largeSig := script.NewScriptRaw(join(op(68), make([]byte, 68)))
+	err := VerifyScript(transaction, smallSig, multisig, 0, 0, flags, &falseSigChecker{}, nil, nil)
+	if err != nil {
+		t.Errorf("unexpected error without the density rule: %v", err)
+	}
+	err = VerifyScript(transaction, smallSig, multisig, 0, 0, flags|script.ScriptVerifyInputSigChecks,
+		&falseSigChecker{}, nil, nil)
+	if !errcode.IsErrorCode(err, errcode.ScriptErrInputSigChecks) {
+		t.Errorf("error %v, expect %v", err, errcode.ScriptErrInputSigChecks)
+	}
+	err = VerifyScript(transaction, largeSig, multisig, 0, 0, flags|script.ScriptVerifyInputSigChecks,
+		&falseSigChecker{}, nil, nil)
+	if err != nil {
+		t.Errorf("unexpected error with a large scriptSig: %v", err)
+	}
+}
+
+func TestDecodeBitfield(t *testing.T) {
+	tests := []struct {
+		vch      []byte
+		size     int
+		bitfield uint32
+		errCode  errcode.ScriptErr
+	}{
+		{[]byte{}, 0, 0, errcode.ScriptErrOK},
+		{[]byte{0x01}, 1, 0x01, errcode.ScriptErrOK},
+		{[]byte{0x02}, 1, 0, errcode.ScriptErrInvalidBitRange},
+		{[]byte{0x05}, 3, 0x05, errcode.ScriptErrOK},
+		{[]byte{0x08}, 3, 0, errcode.ScriptErrInvalidBitRange},
+		{[]byte{0x05, 0x00}, 3, 0, errcode.ScriptErrInvalidBitfieldSize},
+		{[]byte{0xff}, 8, 0xff, errcode.ScriptErrOK},
+		{[]byte{0xff, 0x01}, 9, 0x1ff, errcode.ScriptErrOK},
+		{[]byte{0xff, 0x02}, 9, 0, errcode.ScriptErrInvalidBitRange},
+		{[]byte{0x00, 0x00, 0x0f}, 20, 0x0f0000, errcode.ScriptErrOK},
+		{[]byte{0x00, 0x00, 0x10}, 20, 0, errcode.ScriptErrInvalidBitRange},
+		{[]byte{0x00, 0x00, 0x00, 0x80}, 32, 0x80000000, errcode.ScriptErrOK},
+		{[]byte{0x00, 0x00, 0x00, 0x00, 0x00}, 33, 0, errcode.ScriptErrInvalidBitfieldSize},
+	}
+
+	for i, test := range tests {
+		bitfield, err := decodeBitfield(test.vch, test.size)
+		if test.errCode == errcode.ScriptErrOK {
+			if err != nil {
+				t.Errorf("%dth test: unexpected error %v", i, err)
+			}
+			if bitfield != test.bitfield {
+				t.Errorf("%dth test: bitfield %x, expect %x", i, bitfield, test.bitfield)
+			}
+			continue
+		}
+		if !errcode.IsErrorCode(err, test.errCode) {
+			t.Errorf("%dth test: error %v, expect %v", i, err, test.errCode)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/copernet/copernicus/crypto"
 	"github.com/copernet/copernicus/model/script"
 	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txout"
 	"github.com/copernet/copernicus/util"
 	"github.com/copernet/copernicus/util/amount"
 )
@@ -12,6 +13,6 @@ type Checker interface {
 	CheckLockTime(lockTime int64, txLockTime int64, sequence uint32) bool
 	CheckSequence(sequence int64, txToSequence int64, txVersion uint32) bool
 	CheckSig(transaction *tx.Tx, signature []byte, pubKey []byte, scriptCode *script.Script,
-		nIn int, money amount.Amount, flags uint32) (bool, error)
-	VerifySignature(vchSig []byte, pubKey *crypto.PublicKey, sigHash *util.Hash) (bool, error)
+		nIn int, money amount.Amount, flags uint32, spentOutputs []*txout.TxOut) (bool, error)
+	VerifySignature(vchSig []byte, pubKey *crypto.PublicKey, sigHash *util.Hash, flags uint32) (bool, error)
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/copernet/copernicus/errcode"
 	"github.com/copernet/copernicus/model/script"
 	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txout"
 	"github.com/copernet/copernicus/util"
 	"github.com/copernet/copernicus/util/amount"
 )
@@ -13,7 +14,7 @@ type EmptyChecker struct {
 }
 
 func (sec *EmptyChecker) CheckSig(transaction *tx.Tx, signature []byte, pubKey []byte, scriptCode *script.Script,
-	nIn int, money amount.Amount, flags uint32) (bool, error) {
+	nIn int, money amount.Amount, flags uint32, spentOutputs []*txout.TxOut) (bool, error) {
 	return false, errcode.New(errcode.ScriptErrInvalidOpCode)
 }
 
@@ -26,7 +27,7 @@ func (sec *EmptyChecker) CheckSequence(sequence int64, txToSequence int64, txVer
 	return false
 }
 
-func (sec *EmptyChecker) VerifySignature(vchSig []byte, pubKey *crypto.PublicKey, sigHash *util.Hash) (bool, error) {
+func (sec *EmptyChecker) VerifySignature(vchSig []byte, pubKey *crypto.PublicKey, sigHash *util.Hash, flags uint32) (bool, error) {
 	return false, nil
 }
 
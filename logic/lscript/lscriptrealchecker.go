@@ -6,6 +6,7 @@ import (
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/model/script"
 	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txout"
 	"github.com/copernet/copernicus/util"
 	"github.com/copernet/copernicus/util/amount"
 )
@@ -14,17 +15,22 @@ type RealChecker struct {
 }
 
 func (src *RealChecker) CheckSig(transaction *tx.Tx, signature []byte, pubKey []byte, scriptCode *script.Script,
-	nIn int, money amount.Amount, flags uint32) (bool, error) {
+	nIn int, money amount.Amount, flags uint32, spentOutputs []*txout.TxOut) (bool, error) {
 	if len(signature) == 0 || len(pubKey) == 0 {
 		return false, nil
 	}
 	hashType := signature[len(signature)-1]
-	txSigHash, err := tx.SignatureHash(transaction, scriptCode, uint32(hashType), nIn, money, flags)
+	txSigHash, err := tx.SignatureHash(transaction, scriptCode, uint32(hashType), nIn, money, flags, spentOutputs)
 	if err != nil {
 		return false, err
 	}
 	signature = signature[:len(signature)-1]
-	fOk := tx.CheckSig(txSigHash, signature, pubKey)
+	var fOk bool
+	if isSchnorrSignature(signature, flags) {
+		fOk = tx.CheckSchnorrSig(txSigHash, signature, pubKey)
+	} else {
+		fOk = tx.CheckSig(txSigHash, signature, pubKey)
+	}
 	log.Debug("CheckSig: txid: %s, txSigHash: %s, signature: %s, pubkey: %s, flags: %d, result: %v",
 		transaction.GetHash().String(), txSigHash.String(), hex.EncodeToString(signature),
 		hex.EncodeToString(pubKey), flags, fOk)
@@ -104,10 +110,19 @@ func (src *RealChecker) CheckSequence(sequence int64, txToSequence int64, txVers
 	return true
 }
 
-func (src *RealChecker) VerifySignature(vchSig []byte, pubKey *crypto.PublicKey, sigHash *util.Hash) (bool, error) {
+func (src *RealChecker) VerifySignature(vchSig []byte, pubKey *crypto.PublicKey, sigHash *util.Hash, flags uint32) (bool, error) {
+	if isSchnorrSignature(vchSig, flags) {
+		return pubKey.VerifySchnorr(sigHash, vchSig), nil
+	}
 	return pubKey.Verify(sigHash, vchSig)
 }
 
+// isSchnorrSignature reports whether vchSig (without hash type) must be
+// verified as a Schnorr signature rather than ECDSA.
+func isSchnorrSignature(vchSig []byte, flags uint32) bool {
+	return flags&script.ScriptEnableSchnorr != 0 && len(vchSig) == crypto.SchnorrSignatureLen
+}
+
 func NewScriptRealChecker() *RealChecker {
 	return &RealChecker{}
 }
@@ -0,0 +1,127 @@
+package ltx
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/model/dsproof"
+	"github.com/copernet/copernicus/model/mempool"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/util"
+)
+
+var (
+	// ErrDSProofMissingTx means no mempool transaction spends the coin of
+	// a double spend proof.
+	ErrDSProofMissingTx = errors.New("no mempool transaction spends the coin of the proof")
+
+	// ErrDSProofMissingCoin means the coin of a double spend proof is
+	// unknown, the proof is an orphan.
+	ErrDSProofMissingCoin = errors.New("the coin of the proof is unknown")
+
+	// ErrDSProofUnsupported means the coin of a double spend proof is not
+	// paid to a public key hash, which is the only supported script.
+	ErrDSProofUnsupported = errors.New("the coin of the proof is not paid to a public key hash")
+
+	// ErrDSProofBadSignature means a signature of a double spend proof is
+	// invalid.
+	ErrDSProofBadSignature = errors.New("invalid signature in the proof")
+)
+
+// ValidateDSProof checks a double spend proof against the mempool: a mempool
+// transaction has to spend the coin of the proof, and both signatures of the
+// proof have to be valid for the public key used by this transaction.  Only
+// the coins paid to a public key hash are supported.
+func ValidateDSProof(proof *dsproof.DSProof) error {
+	if err := proof.CheckSanity(); err != nil {
+		return err
+	}
+
+	out := proof.OutPoint()
+	spender := mempool.GetInstance().FindSpender(out)
+	if spender == nil {
+		return ErrDSProofMissingTx
+	}
+	coin := utxo.GetUtxoCacheInstance().GetCoin(out)
+	if coin == nil {
+		coin = mempool.GetInstance().GetCoin(out)
+	}
+	if coin == nil || coin.IsSpent() {
+		return ErrDSProofMissingCoin
+	}
+
+	scriptPubKey := coin.GetScriptPubKey()
+	pubKeyType, pubKeyHashes, _ := scriptPubKey.IsStandardScriptPubKey()
+	if pubKeyType != script.ScriptPubkeyHash {
+		return ErrDSProofUnsupported
+	}
+	pubKey := spenderPubKey(spender.Tx, out)
+	if pubKey == nil || !bytes.Equal(util.Hash160(pubKey), pubKeyHashes[0]) {
+		return ErrDSProofUnsupported
+	}
+
+	for _, s := range []*dsproof.Spender{&proof.Spender1, &proof.Spender2} {
+		spent := coin.GetTxOut()
+		sigHash, err := s.SignatureHash(out, scriptPubKey, &spent)
+		if err != nil {
+			return err
+		}
+		sig := s.Signature()
+		var valid bool
+		if len(sig) == 64 {
+			valid = tx.CheckSchnorrSig(sigHash, sig, pubKey)
+		} else {
+			valid = tx.CheckSig(sigHash, sig, pubKey)
+		}
+		if !valid {
+			return ErrDSProofBadSignature
+		}
+	}
+	return nil
+}
+
+// spenderPubKey returns the public key pushed by the scriptSig of txn
+// spending out, after the signature.
+func spenderPubKey(txn *tx.Tx, out *outpoint.OutPoint) []byte {
+	for _, in := range txn.GetIns() {
+		if *in.PreviousOutPoint != *out {
+			continue
+		}
+		scriptSig := in.GetScriptSig()
+		if scriptSig == nil || !scriptSig.IsPushOnly() || len(scriptSig.ParsedOpCodes) != 2 {
+			return nil
+		}
+		return scriptSig.ParsedOpCodes[1].Data
+	}
+	return nil
+}
+
+// addDSProof builds the proof of the double spend of out by txn and by the
+// mempool transaction spending it, then adds it to the mempool to be relayed.
+// Double spends which can not be proven are only logged.
+func addDSProof(txn *tx.Tx, out *outpoint.OutPoint) {
+	pool := mempool.GetInstance()
+	if pool.GetDSProofByOutPoint(out) != nil {
+		return
+	}
+	spender := pool.FindSpender(out)
+	if spender == nil {
+		return
+	}
+
+	proof, err := dsproof.NewDSProof(spender.Tx, txn, out)
+	if err == nil {
+		err = ValidateDSProof(proof)
+	}
+	if err != nil {
+		log.Debug("No double spend proof of %s by tx %s: %v", out, txn.GetHash(), err)
+		return
+	}
+	if pool.AddDSProof(proof) {
+		log.Info("Double spend of %s by tx %s, proof %s", out, txn.GetHash(), proof.GetHash())
+	}
+}
@@ -23,8 +23,11 @@ import (
 	"github.com/copernet/copernicus/model/script"
 	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
 	"github.com/copernet/copernicus/model/undo"
 	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/persist"
+	"github.com/copernet/copernicus/persist/blkdb"
 	"github.com/copernet/copernicus/util"
 	"github.com/copernet/copernicus/util/amount"
 )
@@ -38,6 +41,7 @@ type ScriptVerifyJob struct {
 	Flags                  uint32
 	ScriptChecker          lscript.Checker
 	ScriptVerifyResultChan chan ScriptVerifyResult
+	SpentOutputs           []*txout.TxOut
 }
 
 type ScriptVerifyResult struct {
@@ -46,6 +50,7 @@ type ScriptVerifyResult struct {
 	ScriptPubKey *script.Script
 	InputNum     int
 	Err          error
+	SigChecks    int
 }
 
 type SignError struct {
@@ -53,8 +58,8 @@ type SignError struct {
 	ErrMsg string
 }
 
-func verifyResult(j ScriptVerifyJob, err error) ScriptVerifyResult {
-	return ScriptVerifyResult{j.Tx.GetHash(), j.ScriptSig, j.ScriptPubKey, j.IputNum, err}
+func verifyResult(j ScriptVerifyJob, err error, sigChecks int) ScriptVerifyResult {
+	return ScriptVerifyResult{j.Tx.GetHash(), j.ScriptSig, j.ScriptPubKey, j.IputNum, err, sigChecks}
 }
 
 const (
@@ -110,6 +115,7 @@ func CheckTxBeforeAcceptToMemPool(txn *tx.Tx) (*mempool.TxEntry, error) {
 	for _, e := range txn.GetIns() {
 		if gPool.HasSpentOut(e.PreviousOutPoint) {
 			log.Debug("tx ins alread spent out in mempool")
+			addDSProof(txn, e.PreviousOutPoint)
 			return nil, errcode.NewError(errcode.RejectConflict, "txn-mempool-conflict")
 		}
 	}
@@ -126,6 +132,19 @@ func CheckTxBeforeAcceptToMemPool(txn *tx.Tx) (*mempool.TxEntry, error) {
 		return nil, errcode.New(errcode.TxErrNoPreviousOut)
 	}
 
+	// Token outputs are not relayed before the tokens are enabled.
+	tokensEnabled := model.IsUpgrade9Enabled(chain.GetInstance().Tip().GetMedianTimePast())
+	if !tokensEnabled {
+		for _, out := range txn.GetOuts() {
+			if out.HasTokenData() {
+				return nil, errcode.NewError(errcode.RejectNonstandard, "txn-tokens-before-activation")
+			}
+		}
+	}
+	if err := CheckTxTokens(txn, inputCoins, tokensEnabled); err != nil {
+		return nil, err
+	}
+
 	// CLTV(CheckLockTimeVerify)
 	// Only accept BIP68 sequence locked transactions that can be mined
 	// in the next block; we don't want our mempool filled up with
@@ -158,9 +177,11 @@ func CheckTxBeforeAcceptToMemPool(txn *tx.Tx) (*mempool.TxEntry, error) {
 	// sigops, making it impossible to mine. Since the coinbase transaction
 	// itself can contain sigops MAX_STANDARD_TX_SIGOPS is less than
 	// MAX_BLOCK_SIGOPS_PER_MB; we still consider this an invalid rather
-	// than merely non-standard transaction.
+	// than merely non-standard transaction. After the May 2020 upgrade the
+	// SigChecks of the scripts are limited instead, see below.
+	phononEnabled := model.IsPhononEnabled(chain.GetInstance().Tip().GetMedianTimePast())
 	sigOpsCount := GetTransactionSigOpCount(txn, uint32(script.StandardScriptVerifyFlags), inputCoins)
-	if uint(sigOpsCount) > tx.MaxStandardTxSigOps {
+	if !phononEnabled && uint(sigOpsCount) > tx.MaxStandardTxSigOps {
 		return nil, errcode.NewError(errcode.RejectNonstandard, "bad-txns-too-many-sigops")
 	}
 
@@ -184,6 +205,27 @@ func CheckTxBeforeAcceptToMemPool(txn *tx.Tx) (*mempool.TxEntry, error) {
 		extraFlags |= script.ScriptEnableCheckDataSig
 	}
 
+	if model.IsGreatWallEnabled(tip.GetMedianTimePast()) {
+		extraFlags |= script.ScriptEnableSchnorr
+	}
+
+	if model.IsGravitonEnabled(tip.GetMedianTimePast()) {
+		extraFlags |= script.ScriptEnableSchnorrMultisig
+	}
+
+	if phononEnabled {
+		extraFlags |= script.ScriptEnableOpReverseBytes
+	}
+
+	if model.IsUpgrade8Enabled(tip.GetMedianTimePast()) {
+		extraFlags |= script.ScriptEnable64BitIntegers
+		extraFlags |= script.ScriptEnableNativeIntrospection
+	}
+
+	if model.IsUpgrade9Enabled(tip.GetMedianTimePast()) {
+		extraFlags |= script.ScriptEnableTokens
+	}
+
 	//check inputs
 	var scriptVerifyFlags = uint32(script.StandardScriptVerifyFlags)
 	if !model.ActiveNetParams.RequireStandard {
@@ -193,11 +235,18 @@ func CheckTxBeforeAcceptToMemPool(txn *tx.Tx) (*mempool.TxEntry, error) {
 
 	// Check against previous transactions. This is done last to help
 	// prevent CPU exhaustion denial-of-service attacks.
-	err = checkInputs(txn, inputCoins, scriptVerifyFlags, txScriptVerifyResultChan)
+	sigChecks, err := checkInputs(txn, inputCoins, scriptVerifyFlags, txScriptVerifyResultChan)
 	if err != nil {
 		return nil, err
 	}
 
+	// The transaction must not execute more SigChecks than a block can
+	// contain per transaction, which is also the standard limit.
+	if phononEnabled && sigChecks > tx.MaxStandardTxSigChecks {
+		log.Debug("tx %s has too many sigchecks: %d", txn.GetHash(), sigChecks)
+		return nil, errcode.NewError(errcode.RejectNonstandard, "bad-txns-too-many-sigchecks")
+	}
+
 	// Check again against the current block tip's script verification flags
 	// to cache our script execution flags. This is, of course, useless if
 	// the next block has different script flags from the previous one, but
@@ -213,13 +262,17 @@ func CheckTxBeforeAcceptToMemPool(txn *tx.Tx) (*mempool.TxEntry, error) {
 	// There is a similar check in CreateNewBlock() to prevent creating
 	// invalid blocks (using TestBlockValidity), however allowing such
 	// transactions into the mempool can be exploited as a DoS attack.
-	var currentBlockScriptVerifyFlags = chain.GetInstance().GetBlockScriptFlags(tip)
-	err = checkInputs(txn, inputCoins, currentBlockScriptVerifyFlags, txScriptVerifyResultChan)
+	//
+	// Segwit recovery is a consensus-only exemption from the clean stack rule,
+	// so it is never granted for mempool acceptance.
+	var currentBlockScriptVerifyFlags = chain.GetInstance().GetBlockScriptFlags(tip) &^
+		script.ScriptAllowSegwitRecovery
+	_, err = checkInputs(txn, inputCoins, currentBlockScriptVerifyFlags, txScriptVerifyResultChan)
 	if err != nil {
 		if ((^scriptVerifyFlags) & currentBlockScriptVerifyFlags) == 0 {
 			return nil, errcode.New(errcode.ScriptCheckInputsBug)
 		}
-		err = checkInputs(txn, inputCoins, uint32(script.MandatoryScriptVerifyFlags)|extraFlags, txScriptVerifyResultChan)
+		_, err = checkInputs(txn, inputCoins, uint32(script.MandatoryScriptVerifyFlags)|extraFlags, txScriptVerifyResultChan)
 		if err != nil {
 			return nil, err
 		}
@@ -229,7 +282,7 @@ func CheckTxBeforeAcceptToMemPool(txn *tx.Tx) (*mempool.TxEntry, error) {
 	}
 
 	txEntry := mempool.NewTxentry(txn, txFee, util.GetTimeSec(),
-		chain.GetInstance().Height(), *lp, sigOpsCount, spendCoinbase)
+		chain.GetInstance().Height(), *lp, sigOpsCount, sigChecks, spendCoinbase)
 
 	return txEntry, nil
 }
@@ -260,7 +313,7 @@ func promiscuousMempoolFlags() uint32 {
 }
 
 // CheckBlockTransactions block service use these 3 func to check transactions or to apply transaction while connecting block to active chain
-func CheckBlockTransactions(txs []*tx.Tx, maxBlockSigOps uint64) error {
+func CheckBlockTransactions(txs []*tx.Tx) error {
 	txsLen := len(txs)
 	if txsLen == 0 {
 		log.Debug("block has no transactions")
@@ -270,16 +323,9 @@ func CheckBlockTransactions(txs []*tx.Tx, maxBlockSigOps uint64) error {
 	if err != nil {
 		return err
 	}
-	sigOps := txs[0].GetSigOpCountWithoutP2SH(uint32(script.StandardScriptVerifyFlags))
 
 	TxsInputOutpoint := make(map[outpoint.OutPoint]bool)
-	for i, transaction := range txs[1:] {
-		sigOps += txs[i+1].GetSigOpCountWithoutP2SH(uint32(script.StandardScriptVerifyFlags))
-		if uint64(sigOps) > maxBlockSigOps {
-			log.Debug("block has too many sigOps:%d", sigOps)
-			return errcode.NewError(errcode.RejectInvalid, "bad-blk-sigops")
-		}
-
+	for _, transaction := range txs[1:] {
 		err := transaction.CheckRegularTransactionWhenNewBlock(TxsInputOutpoint)
 		if err != nil {
 			return err
@@ -288,7 +334,11 @@ func CheckBlockTransactions(txs []*tx.Tx, maxBlockSigOps uint64) error {
 	return nil
 }
 
-func ContextureCheckBlockTransactions(txs []*tx.Tx, blockHeight int32, blockLockTime, mediaTimePast int64) error {
+// ContextureCheckBlockTransactions checks the transactions of a block against
+// its height and the median time past of its parent. Before the May 2020
+// upgrade, the legacy sigops of the block are limited to maxBlockSigOps.
+func ContextureCheckBlockTransactions(txs []*tx.Tx, blockHeight int32, blockLockTime, mediaTimePast int64,
+	maxBlockSigOps uint64) error {
 	txsLen := len(txs)
 	if txsLen == 0 {
 		log.Debug("no transactions err")
@@ -299,6 +349,17 @@ func ContextureCheckBlockTransactions(txs []*tx.Tx, blockHeight int32, blockLock
 		return err
 	}
 
+	if !model.IsPhononEnabled(mediaTimePast) {
+		sigOps := 0
+		for _, transaction := range txs {
+			sigOps += transaction.GetSigOpCountWithoutP2SH(uint32(script.StandardScriptVerifyFlags))
+			if uint64(sigOps) > maxBlockSigOps {
+				log.Debug("block has too many sigOps:%d", sigOps)
+				return errcode.NewError(errcode.RejectInvalid, "bad-blk-sigops")
+			}
+		}
+	}
+
 	var prevTx *tx.Tx
 	for _, transaction := range txs {
 		if model.IsMagneticAnomalyEnabled(mediaTimePast) {
@@ -326,11 +387,11 @@ func ContextureCheckBlockTransactions(txs []*tx.Tx, blockHeight int32, blockLock
 
 func ApplyBlockTransactions(txs []*tx.Tx, bip30Enable bool, scriptCheckFlags uint32,
 	needCheckScript bool, blockSubSidy amount.Amount, blockHeight int32, blockMaxSigOpsCount uint64,
-	lockTimeFlags uint32, pindex *blockindex.BlockIndex) (coinMap *utxo.CoinsMap, bundo *undo.BlockUndo, err error) {
+	lockTimeFlags uint32, pindex *blockindex.BlockIndex, view utxo.CacheView) (coinMap *utxo.CoinsMap,
+	bundo *undo.BlockUndo, spentIndex []blkdb.SpentIndexEntry, err error) {
 
 	// make view
 	coinsMap := utxo.NewEmptyCoinsMap()
-	utxoCache := utxo.GetUtxoCacheInstance()
 	sigOpsCount := 0
 	var fees amount.Amount
 	bundo = undo.NewBlockUndo(0)
@@ -340,9 +401,9 @@ func ApplyBlockTransactions(txs []*tx.Tx, bip30Enable bool, scriptCheckFlags uin
 		for _, transaction := range txs {
 			outs := transaction.GetOuts()
 			for i := range outs {
-				if utxoCache.HaveCoin(outpoint.NewOutPoint(transaction.GetHash(), uint32(i))) {
+				if view.HaveCoin(outpoint.NewOutPoint(transaction.GetHash(), uint32(i))) {
 					log.Debug("tried to overwrite transaction")
-					return nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-txns-BIP30")
+					return nil, nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-txns-BIP30")
 				}
 			}
 		}
@@ -351,6 +412,12 @@ func ApplyBlockTransactions(txs []*tx.Tx, bip30Enable bool, scriptCheckFlags uin
 	txUndoList := make([]*undo.TxUndo, 0, len(txs)-1)
 	isMagneticAnomalyEnabled := model.IsMagneticAnomalyEnabled(pindex.GetMedianTimePast())
 
+	// After the May 2020 upgrade, the SigChecks counted while verifying the
+	// scripts replace the legacy sigops.
+	enforceSigChecks := scriptCheckFlags&script.ScriptEnforceSigChecks != 0
+	maxBlockSigChecks := consensus.GetMaxBlockSigChecksCount(conf.Cfg.Excessiveblocksize)
+	var blockSigChecks uint64
+
 	for _, ptx := range txs {
 		//pos := block.DiskTxPos{
 		//	BlockIn:    &blkPos,
@@ -360,7 +427,7 @@ func ApplyBlockTransactions(txs []*tx.Tx, bip30Enable bool, scriptCheckFlags uin
 		//pos = vPos[ptx.GetHash()]
 		//pos.TxOffsetIn += ptx.EncodeSize()
 
-		if ptx.IsCoinBase() {
+		if ptx.IsCoinBase() && !enforceSigChecks {
 			// We've already checked for sigops count before P2SH in CheckBlock.
 			sigOpsCount += ptx.GetSigOpCountWithoutP2SH(scriptCheckFlags)
 		}
@@ -370,40 +437,50 @@ func ApplyBlockTransactions(txs []*tx.Tx, bip30Enable bool, scriptCheckFlags uin
 		}
 	}
 
+	tokensEnabled := scriptCheckFlags&script.ScriptEnableTokens != 0
 	for i, transaction := range txs {
 		if transaction.IsCoinBase() {
+			if err := CheckTxTokens(transaction, coinsMap, tokensEnabled); err != nil {
+				return nil, nil, nil, err
+			}
 			continue
 		}
 		ins := transaction.GetIns()
 		for _, in := range ins {
-			coin := coinsMap.FetchCoin(in.PreviousOutPoint)
+			coin := coinsMap.FetchCoinFromView(view, in.PreviousOutPoint)
 			if coin == nil || coin.IsSpent() {
 				log.Debug("can't find coin or has been spent out before apply transaction: %+v", in.PreviousOutPoint)
-				return nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-txns-inputs-missingorspent")
+				return nil, nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-txns-inputs-missingorspent")
 			}
 		}
 
+		if err := CheckTxTokens(transaction, coinsMap, tokensEnabled); err != nil {
+			return nil, nil, nil, err
+		}
+
 		// Check that transaction is BIP68 final BIP68 lock checks (as
 		// opposed to nLockTime checks) must be in ConnectBlock because they
 		// require the UTXO set.
 		coinHeight, coinTime := CalculateSequenceLocks(transaction, coinsMap, lockTimeFlags)
-		if !CheckSequenceLocks(coinHeight, coinTime) {
+		if !checkSequenceLocksAt(pindex.Prev, coinHeight, coinTime) {
 			log.Debug("block contains a non-bip68-final transaction")
-			return nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-txns-nonfinal")
+			return nil, nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-txns-nonfinal")
 		}
 
-		// GetTransactionSigOpCount counts 2 types of sigops:
-		// * legacy (always)
-		// * p2sh (when P2SH enabled in flags and excludes coinbase)
-		sigsCount := GetTransactionSigOpCount(transaction, scriptCheckFlags, coinsMap)
-		if sigsCount > tx.MaxTxSigOpsCounts {
-			log.Debug("transaction has too many sigops")
-			return nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-txn-sigops")
-		}
-		sigOpsCount += sigsCount
-		if sigOpsCount > int(blockMaxSigOpsCount) {
-			log.Debug("block has too many sigops at %d transaction", i)
-			return nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-blk-sigops")
+		if !enforceSigChecks {
+			// GetTransactionSigOpCount counts 2 types of sigops:
+			// * legacy (always)
+			// * p2sh (when P2SH enabled in flags and excludes coinbase)
+			sigsCount := GetTransactionSigOpCount(transaction, scriptCheckFlags, coinsMap)
+			if sigsCount > tx.MaxTxSigOpsCounts {
+				log.Debug("transaction has too many sigops")
+				return nil, nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-txn-sigops")
+			}
+			sigOpsCount += sigsCount
+			if sigOpsCount > int(blockMaxSigOpsCount) {
+				log.Debug("block has too many sigops at %d transaction", i)
+				return nil, nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-blk-sigops")
+			}
 		}
 
 		fee := coinsMap.GetValueIn(transaction) - transaction.GetValueOut()
@@ -411,12 +488,39 @@ func ApplyBlockTransactions(txs []*tx.Tx, bip30Enable bool, scriptCheckFlags uin
 
 		if needCheckScript {
 			//check inputs
-			err := checkInputs(transaction, coinsMap, scriptCheckFlags, blockScriptVerifyResultChan)
+			txSigChecks, err := checkInputsAt(transaction, coinsMap, blockHeight, scriptCheckFlags,
+				blockScriptVerifyResultChan)
 			if err != nil {
 				if strings.Contains(err.Error(), "script-verify") {
-					return nil, nil, errcode.NewError(errcode.RejectInvalid, "blk-bad-inputs")
+					return nil, nil, nil, errcode.NewError(errcode.RejectInvalid, "blk-bad-inputs")
+				}
+				return nil, nil, nil, err
+			}
+
+			if enforceSigChecks {
+				if txSigChecks > consensus.MaxTxSigChecks {
+					log.Debug("transaction has too many sigchecks: %d", txSigChecks)
+					return nil, nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-txn-sigchecks")
+				}
+				blockSigChecks += uint64(txSigChecks)
+				if blockSigChecks > maxBlockSigChecks {
+					log.Debug("block has too many sigchecks at %d transaction", i)
+					return nil, nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-blk-sigchecks")
 				}
-				return nil, nil, err
+			}
+		}
+
+		if persist.SpentIndex {
+			txid := transaction.GetHash()
+			for j, in := range ins {
+				spentIndex = append(spentIndex, blkdb.SpentIndexEntry{
+					OutPoint: *in.PreviousOutPoint,
+					SpentIndexValue: blkdb.SpentIndexValue{
+						TxHash:     txid,
+						InputIndex: uint32(j),
+						Height:     blockHeight,
+					},
+				})
 			}
 		}
 
@@ -433,9 +537,9 @@ func ApplyBlockTransactions(txs []*tx.Tx, bip30Enable bool, scriptCheckFlags uin
 	if txs[0].GetValueOut() > fees+blockSubSidy {
 		log.Debug("coinbase pays too much: coinbase out:%d fee:%d expected:%d txcnt(%d)",
 			txs[0].GetValueOut(), fees, fees+blockSubSidy, len(txs))
-		return nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-cb-amount")
+		return nil, nil, nil, errcode.NewError(errcode.RejectInvalid, "bad-cb-amount")
 	}
-	return coinsMap, bundo, nil
+	return coinsMap, bundo, spentIndex, nil
 }
 
 // check coinbase with height
@@ -475,14 +579,19 @@ func ContextualCheckTransaction(txn *tx.Tx, nBlockHeight int32, nLockTimeCutoff,
 	//	}
 	//}
 
-	if model.IsMagneticAnomalyEnabled(mediaTimePast) {
-		txnsize := txn.SerializeSize()
-		if txnsize < consensus.MinTxSize {
-			e := fmt.Sprintf("bad-txns-undersize: tx(%d) should be equal to or greater than %d",
-				txnsize, consensus.MinTxSize)
-			return errcode.NewError(errcode.RejectInvalid, e)
+	// The legacy sigops limit was replaced by SigChecks in May 2020.
+	if !model.IsPhononEnabled(mediaTimePast) {
+		if err := txn.CheckSigOps(); err != nil {
+			return err
 		}
 	}
+
+	minTxSize := model.ActiveNetParams.MinTxSize(mediaTimePast)
+	if txnsize := txn.SerializeSize(); txnsize < uint32(minTxSize) {
+		e := fmt.Sprintf("bad-txns-undersize: tx(%d) should be equal to or greater than %d",
+			txnsize, minTxSize)
+		return errcode.NewError(errcode.RejectInvalid, e)
+	}
 	return nil
 }
 
@@ -614,7 +723,7 @@ func AreInputsStandard(transaction *tx.Tx, coinsMap *utxo.CoinsMap) bool {
 			scriptSig := e.GetScriptSig()
 			stack := util.NewStack()
 			err := lscript.EvalScript(stack, scriptSig, transaction, i, amount.Amount(0), script.ScriptVerifyNone,
-				lscript.NewScriptEmptyChecker())
+				lscript.NewScriptEmptyChecker(), nil, nil)
 			if err != nil {
 				log.Debug("AreInputsStandard EvalScript err: %v", err)
 				return false
@@ -637,23 +746,33 @@ func AreInputsStandard(transaction *tx.Tx, coinsMap *utxo.CoinsMap) bool {
 	return true
 }
 
+// checkInputs verifies the money and the scripts of the inputs of tx, and
+// returns the number of SigChecks the scripts executed.
 func checkInputs(tx *tx.Tx, tempCoinMap *utxo.CoinsMap, flags uint32,
-	scriptVerifyResultChan chan ScriptVerifyResult) error {
-	//check inputs money range
+	scriptVerifyResultChan chan ScriptVerifyResult) (int, error) {
 	bestBlockHash, _ := utxo.GetUtxoCacheInstance().GetBestBlock()
 	spendHeight := chain.GetInstance().GetSpendHeight(&bestBlockHash)
 	if spendHeight == -1 {
 		log.Debug("indexMap can`t find bestblock")
-		return errcode.New(errcode.RejectInvalid)
+		return 0, errcode.New(errcode.RejectInvalid)
 	}
+	return checkInputsAt(tx, tempCoinMap, spendHeight, flags, scriptVerifyResultChan)
+}
 
+// checkInputsAt is checkInputs for tx spending its inputs in a block at
+// spendHeight.
+func checkInputsAt(tx *tx.Tx, tempCoinMap *utxo.CoinsMap, spendHeight int32, flags uint32,
+	scriptVerifyResultChan chan ScriptVerifyResult) (int, error) {
+	//check inputs money range
 	err := CheckInputsMoney(tx, tempCoinMap, spendHeight)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	ins := tx.GetIns()
 	insLen := len(ins)
+	spentOutputs := getSpentOutputs(tx, tempCoinMap)
+	sigChecks := 0
 
 	batches := insLen / MaxScriptVerifyJobNum
 	reminder := insLen % MaxScriptVerifyJobNum
@@ -679,7 +798,7 @@ func checkInputs(tx *tx.Tx, tempCoinMap *utxo.CoinsMap, flags uint32,
 			scriptSig := ins[index].GetScriptSig()
 			log.Debug("Push Script verify job txid: %s, inex: %d", tx.GetHash().String(), index)
 			scriptVerifyJobChan <- ScriptVerifyJob{tx, scriptSig, scriptPubKey, index,
-				coin.GetAmount(), flags, lscript.NewScriptRealChecker(), scriptVerifyResultChan}
+				coin.GetAmount(), flags, lscript.NewScriptRealChecker(), scriptVerifyResultChan, spentOutputs}
 		}
 
 		var err error
@@ -695,38 +814,57 @@ func checkInputs(tx *tx.Tx, tempCoinMap *utxo.CoinsMap, flags uint32,
 					err = result.Err
 				}
 			}
+			sigChecks += result.SigChecks
 		}
 
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 
-	return nil
+	return sigChecks, nil
+}
+
+// getSpentOutputs returns the outputs spent by the inputs of transaction, in
+// input order, or nil if any of them is missing from coinsMap.
+func getSpentOutputs(transaction *tx.Tx, coinsMap *utxo.CoinsMap) []*txout.TxOut {
+	spentOutputs := make([]*txout.TxOut, 0, transaction.GetInsCount())
+	for _, in := range transaction.GetIns() {
+		coin := coinsMap.GetCoin(in.PreviousOutPoint)
+		if coin == nil {
+			return nil
+		}
+		out := coin.GetTxOut()
+		spentOutputs = append(spentOutputs, &out)
+	}
+	return spentOutputs
 }
 
 func checkScript() {
 	for {
 		j := <-scriptVerifyJobChan
 
-		err1 := lscript.VerifyScript(j.Tx, j.ScriptSig, j.ScriptPubKey, j.IputNum, j.Value, j.Flags, j.ScriptChecker)
+		metrics := lscript.ScriptExecutionMetrics{}
+		err1 := lscript.VerifyScript(j.Tx, j.ScriptSig, j.ScriptPubKey, j.IputNum, j.Value, j.Flags, j.ScriptChecker,
+			j.SpentOutputs, &metrics)
 		if err1 != nil {
 
 			hasNonMandatoryFlags := (j.Flags & uint32(script.StandardNotMandatoryVerifyFlags)) != 0
 			if hasNonMandatoryFlags {
 				fallbackFlags := uint32(uint64(j.Flags) & uint64(^script.StandardNotMandatoryVerifyFlags))
-				err2 := lscript.VerifyScript(j.Tx, j.ScriptSig, j.ScriptPubKey, j.IputNum, j.Value, fallbackFlags, j.ScriptChecker)
+				err2 := lscript.VerifyScript(j.Tx, j.ScriptSig, j.ScriptPubKey, j.IputNum, j.Value, fallbackFlags,
+					j.ScriptChecker, j.SpentOutputs, nil)
 				if err2 == nil {
-					j.ScriptVerifyResultChan <- verifyResult(j, errorNonMandatoryPass(j, err1))
+					j.ScriptVerifyResultChan <- verifyResult(j, errorNonMandatoryPass(j, err1), 0)
 					continue
 				}
 			}
 
-			j.ScriptVerifyResultChan <- verifyResult(j, errorMandatoryFailed(j, err1))
+			j.ScriptVerifyResultChan <- verifyResult(j, errorMandatoryFailed(j, err1), 0)
 			continue
 		}
 
-		j.ScriptVerifyResultChan <- verifyResult(j, nil)
+		j.ScriptVerifyResultChan <- verifyResult(j, nil, metrics.SigChecks)
 	}
 }
 
@@ -880,9 +1018,13 @@ func calculateSequenceLockPair(transaction *tx.Tx, preHeight []int32, flags uint
 }
 
 func CheckSequenceLocks(height int32, time int64) bool {
-	activeChain := chain.GetInstance()
-	blockTime := activeChain.Tip().GetMedianTimePast()
-	if height >= activeChain.Height()+1 || time >= blockTime {
+	return checkSequenceLocksAt(chain.GetInstance().Tip(), height, time)
+}
+
+// checkSequenceLocksAt is CheckSequenceLocks for a block on top of indexPrev.
+func checkSequenceLocksAt(indexPrev *blockindex.BlockIndex, height int32, time int64) bool {
+	blockTime := indexPrev.GetMedianTimePast()
+	if height >= indexPrev.Height+1 || time >= blockTime {
 		return false
 	}
 	return true
@@ -947,6 +1089,7 @@ func SignRawTransaction(transactions []*tx.Tx, redeemScripts map[outpoint.OutPoi
 	var signErrors []*SignError
 
 	mergedTx := transactions[0]
+	spentOutputs := getSpentOutputs(mergedTx, coinsMap)
 	hashSingle := int(hashType) & ^(crypto.SigHashAnyoneCanpay|crypto.SigHashForkID) == crypto.SigHashSingle
 
 	for index, in := range mergedTx.GetIns() {
@@ -973,7 +1116,7 @@ func SignRawTransaction(transactions []*tx.Tx, redeemScripts map[outpoint.OutPoi
 			} else {
 				scriptSig.PushMultData(sigData)
 				err = lscript.VerifyScript(mergedTx, scriptSig, scriptPubKey, index, value,
-					uint32(script.StandardScriptVerifyFlags), lscript.NewScriptRealChecker())
+					uint32(script.StandardScriptVerifyFlags), lscript.NewScriptRealChecker(), spentOutputs, nil)
 				if err != nil {
 					scriptSig = script.NewEmptyScript()
 					log.Info("VerifyScript error:%s", err.Error())
@@ -986,7 +1129,7 @@ func SignRawTransaction(transactions []*tx.Tx, redeemScripts map[outpoint.OutPoi
 			if len(transaction.GetIns()) > index {
 				scriptSig, err = CombineSignature(transaction, scriptPubKey, scriptSig,
 					transaction.GetIns()[index].GetScriptSig(), index, value,
-					uint32(script.StandardScriptVerifyFlags), lscript.NewScriptRealChecker())
+					uint32(script.StandardScriptVerifyFlags), lscript.NewScriptRealChecker(), spentOutputs)
 				if err != nil {
 					log.Info("CombineSignature error:%s", err.Error())
 				}
@@ -999,7 +1142,7 @@ func SignRawTransaction(transactions []*tx.Tx, redeemScripts map[outpoint.OutPoi
 		}
 
 		err = lscript.VerifyScript(mergedTx, scriptSig, scriptPubKey, index, value,
-			uint32(script.StandardScriptVerifyFlags), lscript.NewScriptRealChecker())
+			uint32(script.StandardScriptVerifyFlags), lscript.NewScriptRealChecker(), spentOutputs, nil)
 		if err != nil {
 			signErrors = append(signErrors, &SignError{
 				TxIn:   in,
@@ -1013,7 +1156,7 @@ func SignRawTransaction(transactions []*tx.Tx, redeemScripts map[outpoint.OutPoi
 
 func CombineSignature(transaction *tx.Tx, prevPubKey *script.Script, scriptSig *script.Script,
 	txOldScriptSig *script.Script, nIn int, money amount.Amount, flags uint32,
-	scriptChecker lscript.Checker) (*script.Script, error) {
+	scriptChecker lscript.Checker, spentOutputs []*txout.TxOut) (*script.Script, error) {
 	if scriptSig == nil {
 		scriptSig = script.NewEmptyScript()
 	}
@@ -1056,7 +1199,7 @@ func CombineSignature(transaction *tx.Tx, prevPubKey *script.Script, scriptSig *
 				if okSigs[string(pubKey)] != nil {
 					continue
 				}
-				ok, err := scriptChecker.CheckSig(transaction, opCode.Data, pubKey, prevPubKey, nIn, money, flags)
+				ok, err := scriptChecker.CheckSig(transaction, opCode.Data, pubKey, prevPubKey, nIn, money, flags, spentOutputs)
 				if err == nil && ok {
 					okSigs[string(pubKey)] = opCode.Data
 					break
@@ -1095,7 +1238,7 @@ func CombineSignature(transaction *tx.Tx, prevPubKey *script.Script, scriptSig *
 		scriptSig = scriptSig.RemoveOpCodeByIndex(len(scriptSig.ParsedOpCodes) - 1)
 		txOldScriptSig = txOldScriptSig.RemoveOpCodeByIndex(len(txOldScriptSig.ParsedOpCodes) - 1)
 		scriptResult, err := CombineSignature(transaction, redeemScript, scriptSig,
-			txOldScriptSig, nIn, money, flags, scriptChecker)
+			txOldScriptSig, nIn, money, flags, scriptChecker, spentOutputs)
 		scriptResult.PushSingleData(redeemScript.GetData())
 		return scriptResult, err
 	}
@@ -7,9 +7,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
@@ -260,7 +262,7 @@ func TestSigHash(t *testing.T) {
 		// }
 
 		hash, err := tx.SignatureHash(newTx, scriptPubKey, hashType, nIn,
-			amount.Amount(0), script.ScriptEnableSigHashForkID)
+			amount.Amount(0), script.ScriptEnableSigHashForkID, nil)
 		if err != nil {
 			t.Errorf("verify error for test %d", i)
 			continue
@@ -403,7 +405,7 @@ testloop:
 			pkscript := script.NewScriptRaw(prevOut.pkScript)
 
 			err := lscript.VerifyScript(newTx, txin.GetScriptSig(), pkscript, k, amount.Amount(prevOut.inputVal),
-				flags, lscript.NewScriptRealChecker())
+				flags, lscript.NewScriptRealChecker(), nil, nil)
 			if err != nil {
 				t.Errorf("verifyScript error: %v, %dth test, test=%v", err, i, test)
 			}
@@ -553,7 +555,7 @@ testloop:
 			}
 			pkscript := script.NewScriptRaw(prevOut.pkScript)
 			err := lscript.VerifyScript(newTx, txin.GetScriptSig(), pkscript, k, amount.Amount(prevOut.inputVal),
-				flags, lscript.NewScriptRealChecker())
+				flags, lscript.NewScriptRealChecker(), nil, nil)
 			if err != nil {
 				continue testloop
 			}
@@ -635,6 +637,7 @@ func check(v *Var, lockingScript *script.Script, t *testing.T) {
 		0, 0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, scriptSig) {
@@ -650,6 +653,7 @@ func check(v *Var, lockingScript *script.Script, t *testing.T) {
 		0, 0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, scriptSig) {
@@ -670,6 +674,7 @@ func check(v *Var, lockingScript *script.Script, t *testing.T) {
 		0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, scriptSig) {
@@ -722,6 +727,7 @@ func TestCombineSignature(t *testing.T) {
 		0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, empty) {
@@ -781,6 +787,7 @@ func TestCombineSignature(t *testing.T) {
 		0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, scriptSig) {
@@ -796,6 +803,7 @@ func TestCombineSignature(t *testing.T) {
 		0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, scriptSig) {
@@ -840,6 +848,7 @@ func TestCombineSignature(t *testing.T) {
 		0, 0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	if err != nil {
 		t.Error(err, t)
@@ -858,6 +867,7 @@ func TestCombineSignature(t *testing.T) {
 		0, 0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, scriptSig) {
@@ -868,21 +878,21 @@ func TestCombineSignature(t *testing.T) {
 
 	// A couple of partially-signed versions:
 	hash, err := tx.SignatureHash(
-		&v.spender, MultiLockingScript, uint32(crypto.SigHashAll), 0, 0, 0)
+		&v.spender, MultiLockingScript, uint32(crypto.SigHashAll), 0, 0, 0, nil)
 	checkError(err, t)
 	vchSig, err := v.priKeys[0].Sign(hash.GetCloneBytes())
 	checkError(err, t)
 	sig1 := bytes.Join([][]byte{vchSig.Serialize(), {byte(crypto.SigHashAll)}}, []byte{})
 
 	hash, err = tx.SignatureHash(
-		&v.spender, MultiLockingScript, uint32(crypto.SigHashNone), 0, 0, 0)
+		&v.spender, MultiLockingScript, uint32(crypto.SigHashNone), 0, 0, 0, nil)
 	checkError(err, t)
 	vchSig, err = v.priKeys[1].Sign(hash.GetCloneBytes())
 	checkError(err, t)
 	sig2 := bytes.Join([][]byte{vchSig.Serialize(), {byte(crypto.SigHashNone)}}, []byte{})
 
 	hash, err = tx.SignatureHash(
-		&v.spender, MultiLockingScript, uint32(crypto.SigHashSingle), 0, 0, 0)
+		&v.spender, MultiLockingScript, uint32(crypto.SigHashSingle), 0, 0, 0, nil)
 	checkError(err, t)
 	vchSig, err = v.priKeys[2].Sign(hash.GetCloneBytes())
 	checkError(err, t)
@@ -944,6 +954,7 @@ func TestCombineSignature(t *testing.T) {
 		0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, partial1a) {
@@ -959,6 +970,7 @@ func TestCombineSignature(t *testing.T) {
 		0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 
 	checkError(err, t)
@@ -975,6 +987,7 @@ func TestCombineSignature(t *testing.T) {
 		0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, complete12) {
@@ -990,6 +1003,7 @@ func TestCombineSignature(t *testing.T) {
 		0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, complete12) {
@@ -1005,6 +1019,7 @@ func TestCombineSignature(t *testing.T) {
 		0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, complete13) {
@@ -1019,6 +1034,7 @@ func TestCombineSignature(t *testing.T) {
 		0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, complete23) {
@@ -1033,6 +1049,7 @@ func TestCombineSignature(t *testing.T) {
 		0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, complete23) {
@@ -1048,6 +1065,7 @@ func TestCombineSignature(t *testing.T) {
 		0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, partial3c) {
@@ -1126,6 +1144,7 @@ func TestNonStandardCombineSignature(t *testing.T) {
 		0, 0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, scriptOldSig) {
@@ -1143,6 +1162,7 @@ func TestNonStandardCombineSignature(t *testing.T) {
 		0, 0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, scriptSig) {
@@ -1163,6 +1183,7 @@ func TestNonStandardCombineSignature(t *testing.T) {
 		0, 0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, scriptOldSig) {
@@ -1180,6 +1201,7 @@ func TestNonStandardCombineSignature(t *testing.T) {
 		0, 0,
 		standardScriptVerifyFlags,
 		realChecker,
+		nil,
 	)
 	checkError(err, t)
 	if !reflect.DeepEqual(combineSig, scriptSig) {
@@ -1668,12 +1690,89 @@ func Test_tx_with_too_many_script_ops_should_NOT_be_accepted_into_mempool(t *tes
 	defer initTestEnv()()
 
 	blocks := generateTestBlocks(t)
+	conf.Args.PhononTime = math.MaxInt64
+	defer func() { conf.Args.PhononTime = -1 }()
+
 	txn := txWithTooManyScriptOps(blocks[0].Txs[0].GetHash(), 0)
 	err := lmempool.AcceptTxToMemPool(txn)
 
 	assert.Equal(t, errcode.NewError(errcode.RejectNonstandard, "bad-txns-too-many-sigops"), err)
 }
 
+func Test_tx_with_too_many_script_ops_is_rejected_by_script_checks__after_phonon(t *testing.T) {
+	defer initTestEnv()()
+
+	blocks := generateTestBlocks(t)
+	conf.Args.PhononTime = 100
+	defer func() { conf.Args.PhononTime = -1 }()
+
+	txn := txWithTooManyScriptOps(blocks[0].Txs[0].GetHash(), 0)
+	err := lmempool.AcceptTxToMemPool(txn)
+
+	_, reason, _ := errcode.IsRejectCode(err)
+	assert.Equal(t, "mandatory-script-verify-flag-failed (Only non-push operators allowed in signatures)", reason)
+}
+
+// makeTxWithSize spends prevout into one output whose script is padded with
+// OP_TRUEs, so that the transaction serializes to size bytes.
+func makeTxWithSize(prevout util.Hash, size int) *tx.Tx {
+	txn := tx.NewTx(0, 1)
+	txn.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(prevout, 0), script.NewEmptyScript(), script.SequenceFinal))
+	scriptPubKey := bytes.Repeat([]byte{opcodes.OP_TRUE}, size-60)
+	txn.AddTxOut(txout.NewTxOut(0x0e94a78b, script.NewScriptRaw(scriptPubKey)))
+	return txn
+}
+
+func Test_tx_min_size__straddles_the_activation_boundaries(t *testing.T) {
+	magneticAnomaly := model.ActiveNetParams.MagneticAnomalyActivationTime
+	upgrade9 := model.ActiveNetParams.Upgrade9ActivationTime
+	tests := []struct {
+		size           int
+		medianTimePast int64
+		undersize      bool
+	}{
+		{64, magneticAnomaly - 1, false},
+		{64, magneticAnomaly, true},
+		{99, magneticAnomaly, true},
+		{100, magneticAnomaly, false},
+		{99, upgrade9 - 1, true},
+		{64, upgrade9, true},
+		{65, upgrade9, false},
+		{99, upgrade9, false},
+	}
+
+	for _, test := range tests {
+		txn := makeTxWithSize(util.HashOne, test.size)
+		assert.Equal(t, uint32(test.size), txn.SerializeSize())
+
+		err := ltx.ContextualCheckTransaction(txn, 1000, 0, test.medianTimePast)
+		if !test.undersize {
+			assert.NoError(t, err, "size %d at %d", test.size, test.medianTimePast)
+			continue
+		}
+		_, reason, _ := errcode.IsRejectCode(err)
+		assert.True(t, strings.HasPrefix(reason, "bad-txns-undersize"), "size %d at %d", test.size,
+			test.medianTimePast)
+	}
+}
+
+func Test_tx_smaller_than_100_bytes__is_accepted_into_mempool_only_after_upgrade9(t *testing.T) {
+	defer initTestEnv()()
+
+	blocks := generateTestBlocks(t)
+	upgrade9 := model.ActiveNetParams.Upgrade9ActivationTime
+	defer func() { model.ActiveNetParams.Upgrade9ActivationTime = upgrade9 }()
+
+	model.ActiveNetParams.Upgrade9ActivationTime = math.MaxInt64
+	err := lmempool.AcceptTxToMemPool(makeTxWithSize(blocks[0].Txs[0].GetHash(), 80))
+	_, reason, _ := errcode.IsRejectCode(err)
+	assert.True(t, strings.HasPrefix(reason, "bad-txns-undersize"), reason)
+
+	model.ActiveNetParams.Upgrade9ActivationTime = upgrade9
+	err = lmempool.AcceptTxToMemPool(makeTxWithSize(blocks[0].Txs[0].GetHash(), 80))
+	assert.NoError(t, err)
+}
+
 func Test_tx_with_too_low_fee_should_NOT_be_accepted_into_mempool(t *testing.T) {
 	defer initTestEnv()()
 
@@ -1708,7 +1807,7 @@ func Test_block_txns__should_contains_one_coinbase_tx(t *testing.T) {
 	txn := mainNetTx(1)
 	txns := []*tx.Tx{txn}
 
-	err := ltx.CheckBlockTransactions(txns, 0)
+	err := ltx.CheckBlockTransactions(txns)
 
 	assert.Equal(t, errcode.NewError(errcode.RejectInvalid, "bad-cb-missing"), err)
 }
@@ -1728,7 +1827,7 @@ func newCoinbaseTx() *tx.Tx {
 func Test_block_txns__should_at_least_contains_one_txn(t *testing.T) {
 	txns := []*tx.Tx{}
 
-	err := ltx.CheckBlockTransactions(txns, consensus.MaxBlockSigopsPerMb)
+	err := ltx.CheckBlockTransactions(txns)
 
 	assert.Equal(t, errcode.NewError(errcode.RejectInvalid, "bad-cb-missing"), err)
 }
@@ -1737,7 +1836,7 @@ func Test_block_txns__should_contains_one_coinbase_tx__happy_case(t *testing.T)
 	coinbaseTx := newCoinbaseTx()
 	txns := []*tx.Tx{coinbaseTx}
 
-	err := ltx.CheckBlockTransactions(txns, consensus.MaxBlockSigopsPerMb)
+	err := ltx.CheckBlockTransactions(txns)
 
 	assert.NoError(t, err)
 }
@@ -1746,7 +1845,7 @@ func Test_block_txns__should_only_has_one_coinbase_tx(t *testing.T) {
 	coinbaseTx := newCoinbaseTx()
 	txns := []*tx.Tx{coinbaseTx, coinbaseTx}
 
-	err := ltx.CheckBlockTransactions(txns, consensus.MaxBlockSigopsPerMb)
+	err := ltx.CheckBlockTransactions(txns)
 
 	assert.Equal(t, errcode.NewError(errcode.RejectInvalid, "bad-tx-coinbase"), err)
 }
@@ -1760,11 +1859,34 @@ func Test_block_txns__should_not_contains_too_much_script_ops__in_total(t *testi
 	txn5 := txWithTooManyScriptOps(util.HashOne, 5)
 
 	txns := []*tx.Tx{coinbaseTx, txn1, txn2, txn3, txn4, txn5}
-	err := ltx.CheckBlockTransactions(txns, consensus.MaxBlockSigopsPerMb)
+	height := model.ActiveNetParams.BIP34Height - 1
+	err := ltx.ContextureCheckBlockTransactions(txns, height, 0, 0, consensus.MaxBlockSigopsPerMb)
 
 	assert.Equal(t, errcode.NewError(errcode.RejectInvalid, "bad-blk-sigops"), err)
 }
 
+func Test_block_txns__legacy_sigops_are_not_limited__after_phonon(t *testing.T) {
+	coinbaseTx := newCoinbaseTx()
+	coinbaseTx.GetIns()[0].SetScriptSig(makeDummyScript(40))
+	txn1 := txWithTooManyScriptOps(util.HashOne, 1)
+	txn2 := txWithTooManyScriptOps(util.HashOne, 2)
+	txn3 := txWithTooManyScriptOps(util.HashOne, 3)
+	txn4 := txWithTooManyScriptOps(util.HashOne, 4)
+	txn5 := txWithTooManyScriptOps(util.HashOne, 5)
+
+	txns := []*tx.Tx{coinbaseTx, txn1, txn2, txn3, txn4, txn5}
+	// The transactions must be in canonical order after the Nov 2018 upgrade.
+	sort.Slice(txns[1:], func(a, b int) bool {
+		hashA, hashB := txns[a+1].GetHash(), txns[b+1].GetHash()
+		return pow.HashToBig(&hashA).Cmp(pow.HashToBig(&hashB)) < 0
+	})
+	height := model.ActiveNetParams.BIP34Height - 1
+	err := ltx.ContextureCheckBlockTransactions(txns, height, 0, model.ActiveNetParams.PhononActivationTime,
+		consensus.MaxBlockSigopsPerMb)
+
+	assert.NoError(t, err)
+}
+
 func Test_block_txns__should_not_contains_duplicate_prev_outpoints(t *testing.T) {
 	coinbaseTx := newCoinbaseTx()
 	txn1 := txWithTooManyScriptOps(util.HashOne, 1)
@@ -1778,7 +1900,7 @@ func Test_block_txns__should_not_contains_duplicate_prev_outpoints(t *testing.T)
 	txOut := makeOuts()[0]
 	txn2.AddTxOut(txOut)
 	txns := []*tx.Tx{coinbaseTx, txn1, txn2}
-	err := ltx.CheckBlockTransactions(txns, consensus.MaxBlockSigopsPerMb)
+	err := ltx.CheckBlockTransactions(txns)
 
 	assert.Equal(t, errcode.NewError(errcode.RejectInvalid, "bad-txns-inputs-duplicate"), err)
 }
@@ -1801,6 +1923,30 @@ func Test_tx_script_with_non_clean_stack_after_eval__should_not_be_accepted_into
 	assert.Equal(t, expectedErr, err)
 }
 
+func Test_tx_spending_p2sh_segwit_output__should_not_be_accepted_into_mempool(t *testing.T) {
+	defer initTestEnv()()
+
+	redeemScript := NewScriptBuilder().
+		PushOPCode(opcodes.OP_0).
+		PushBytesWithOP(bytes.Repeat([]byte{0x01}, 20)).
+		Script()
+	scriptPK := NewScriptBuilder().
+		PushOPCode(opcodes.OP_HASH160).
+		PushBytesWithOP(util.Hash160(redeemScript.Bytes())).
+		PushOPCode(opcodes.OP_EQUAL).
+		Script()
+
+	blocks := generateTestBlocksWithPK(t, scriptPK)
+	scriptSig := NewScriptBuilder().PushBytesWithOP(redeemScript.Bytes()).Script()
+	txn := makeNormalTxWithScripgSig(blocks[0].Txs[0].GetHash(), scriptSig)
+
+	_, err := ltx.CheckTxBeforeAcceptToMemPool(txn)
+
+	expectedErr := errcode.NewError(errcode.RejectNonstandard,
+		"non-mandatory-script-verify-flag (Script did not clean its stack)")
+	assert.Equal(t, expectedErr, err)
+}
+
 //test cases for ltx.ContextureCheckBlockTransactions
 //model.ActiveNetParams.BIP34Height
 
@@ -1821,7 +1967,7 @@ func Test_block_should_contains_at_least_one_tx(t *testing.T) {
 
 	height := model.ActiveNetParams.BIP34Height - 1
 
-	err := ltx.ContextureCheckBlockTransactions(txns, height, 0, 0)
+	err := ltx.ContextureCheckBlockTransactions(txns, height, 0, 0, consensus.MaxBlockSigopsPerMb)
 
 	assert.Equal(t, errcode.New(errcode.RejectInvalid), err)
 }
@@ -1832,7 +1978,7 @@ func Test_block_coinbase_tx___can_contains_empty_script_sig___before_BIP34_heigh
 
 	height := model.ActiveNetParams.BIP34Height - 1
 
-	err := ltx.ContextureCheckBlockTransactions(txns, height, 0, 0)
+	err := ltx.ContextureCheckBlockTransactions(txns, height, 0, 0, consensus.MaxBlockSigopsPerMb)
 
 	assert.NoError(t, err)
 }
@@ -1843,7 +1989,7 @@ func Test_block_coinbase_tx___can_NOT_contains_empty_script_sig___after_BIP34_he
 
 	height := model.ActiveNetParams.BIP34Height + 1
 
-	err := ltx.ContextureCheckBlockTransactions(txns, height, 0, 0)
+	err := ltx.ContextureCheckBlockTransactions(txns, height, 0, 0, consensus.MaxBlockSigopsPerMb)
 
 	assert.Equal(t, errcode.NewError(errcode.RejectInvalid, "bad-cb-height"), err)
 }
@@ -1866,7 +2012,7 @@ func Test_block_coinbase_tx___should_contains_height_in_script_sig___after_BIP34
 	coinbaseTx := newCoinbaseOnHeight(height)
 	txns := []*tx.Tx{coinbaseTx}
 
-	err := ltx.ContextureCheckBlockTransactions(txns, height, 0, 0)
+	err := ltx.ContextureCheckBlockTransactions(txns, height, 0, 0, consensus.MaxBlockSigopsPerMb)
 
 	assert.NoError(t, err)
 }
@@ -1877,7 +2023,7 @@ func Test_block_coinbase_tx___should_contains_correct_height_in_script_sig___aft
 	coinbaseTx := newCoinbaseOnHeight(height)
 	txns := []*tx.Tx{coinbaseTx}
 
-	err := ltx.ContextureCheckBlockTransactions(txns, height+100, 0, 0)
+	err := ltx.ContextureCheckBlockTransactions(txns, height+100, 0, 0, consensus.MaxBlockSigopsPerMb)
 
 	assert.Equal(t, errcode.NewError(errcode.RejectInvalid, "bad-cb-height"), err)
 }
@@ -1901,6 +2047,83 @@ func Test_ApplyBlockTransactions__generated_block_should_contains_tx_in_mempool(
 	assert.Contains(t, blocks[0].Txs, txn2)
 }
 
+// sigChecksFunding spends prevout into outputs OP_TRUE outputs of 1 coin, to
+// be spent by txWithSigChecks in the same block.
+func sigChecksFunding(prevout util.Hash, outputs int) *tx.Tx {
+	txn := tx.NewTx(0, 1)
+	txn.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(prevout, 0), script.NewEmptyScript(), script.SequenceFinal))
+	for i := 0; i < outputs; i++ {
+		txn.AddTxOut(txout.NewTxOut(amount.Amount(util.COIN), script.NewScriptRaw([]byte{opcodes.OP_TRUE})))
+	}
+	return txn
+}
+
+// txWithSigChecks spends inputs outputs of funding from first, each scriptSig
+// executing checksPerInput failing OP_CHECKSIGs with non-empty signatures,
+// which are all counted as SigChecks.
+func txWithSigChecks(funding *tx.Tx, first, inputs, checksPerInput int) *tx.Tx {
+	scriptSig := script.NewEmptyScript()
+	for i := 0; i < checksPerInput; i++ {
+		scriptSig.PushOpCode(opcodes.OP_1)
+		scriptSig.PushOpCode(opcodes.OP_1)
+		scriptSig.PushOpCode(opcodes.OP_CHECKSIG)
+		scriptSig.PushOpCode(opcodes.OP_DROP)
+	}
+	txn := tx.NewTx(0, 1)
+	for i := first; i < first+inputs; i++ {
+		txn.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(funding.GetHash(), uint32(i)), scriptSig,
+			script.SequenceFinal))
+	}
+	txn.AddTxOut(txout.NewTxOut(amount.Amount(util.COIN), script.NewScriptRaw([]byte{opcodes.OP_TRUE})))
+	return txn
+}
+
+func applySigChecksBlock(txs []*tx.Tx) error {
+	tip := chain.GetInstance().Tip()
+	_, _, _, err := ltx.ApplyBlockTransactions(txs, false, uint32(script.ScriptEnforceSigChecks), true, 0,
+		tip.Height+1, 0, 0, tip, utxo.GetUtxoCacheInstance())
+	return err
+}
+
+func Test_ApplyBlockTransactions__tx_with_too_many_sigchecks__is_rejected(t *testing.T) {
+	defer initTestEnv()()
+	blocks := generateTestBlocks(t)
+
+	inputs := consensus.MaxTxSigChecks/100 + 1
+	funding := sigChecksFunding(blocks[0].Txs[0].GetHash(), inputs)
+	txn := txWithSigChecks(funding, 0, inputs, 100)
+
+	err := applySigChecksBlock([]*tx.Tx{newCoinbaseTx(), funding, txn})
+	assert.Equal(t, errcode.NewError(errcode.RejectInvalid, "bad-txn-sigchecks"), err)
+
+	// The same SigChecks are allowed across transactions.
+	txs := []*tx.Tx{newCoinbaseTx(), funding}
+	for i := 0; i < inputs; i++ {
+		txs = append(txs, txWithSigChecks(funding, i, 1, 100))
+	}
+	assert.NoError(t, applySigChecksBlock(txs))
+}
+
+func Test_ApplyBlockTransactions__block_with_too_many_sigchecks__is_rejected(t *testing.T) {
+	defer initTestEnv()()
+	blocks := generateTestBlocks(t)
+
+	excessiveBlockSize := conf.Cfg.Excessiveblocksize
+	defer func() { conf.Cfg.Excessiveblocksize = excessiveBlockSize }()
+	// A block may hold 150 SigChecks.
+	conf.Cfg.Excessiveblocksize = 150 * consensus.BlockMaxBytesMaxSigChecksRatio
+
+	funding := sigChecksFunding(blocks[0].Txs[0].GetHash(), 2)
+	txn1 := txWithSigChecks(funding, 0, 1, 100)
+	txn2 := txWithSigChecks(funding, 1, 1, 50)
+
+	assert.NoError(t, applySigChecksBlock([]*tx.Tx{newCoinbaseTx(), funding, txn1, txn2}))
+
+	txn2 = txWithSigChecks(funding, 1, 1, 51)
+	err := applySigChecksBlock([]*tx.Tx{newCoinbaseTx(), funding, txn1, txn2})
+	assert.Equal(t, errcode.NewError(errcode.RejectInvalid, "bad-blk-sigchecks"), err)
+}
+
 //tests for ltx.CheckInputsMoney
 func Test_can_not_spend__premature_coinbase_tx_output(t *testing.T) {
 	txn := mainNetTx(1)
@@ -2115,3 +2338,32 @@ func TestAreInputStandard_scriptsig_with_too_much_extra_sigops_is_not_standard(t
 	txn.AddTxOut(txout.NewTxOut(amount.Amount(10*util.COIN), script.NewScriptRaw([]byte{opcodes.OP_TRUE})))
 	assert.False(t, ltx.AreInputsStandard(txn, coins))
 }
+
+func Test_tx_with_forkid_signature_should_be_accepted_into_mempool__after_great_wall(t *testing.T) {
+	defer initTestEnv()()
+	v := initVar()
+
+	p2PKHLockingScript := script.NewEmptyScript()
+	p2PKHLockingScript.PushOpCode(opcodes.OP_DUP)
+	p2PKHLockingScript.PushOpCode(opcodes.OP_HASH160)
+	p2PKHLockingScript.PushSingleData(util.Hash160(v.pubKeys[0].ToBytes()))
+	p2PKHLockingScript.PushOpCode(opcodes.OP_EQUALVERIFY)
+	p2PKHLockingScript.PushOpCode(opcodes.OP_CHECKSIG)
+
+	blocks := generateTestBlocksWithPK(t, p2PKHLockingScript)
+	tip := chain.GetInstance().Tip()
+	assert.True(t, tip.GetMedianTimePast() >= model.ActiveNetParams.GreatWallActivationTime)
+	assert.Zero(t, chain.GetInstance().GetBlockScriptFlags(tip)&script.ScriptEnableReplayProtection)
+
+	coinbase := blocks[0].Txs[0]
+	txn := makeNormalTx(coinbase.GetHash())
+	coinsMap := utxo.NewEmptyCoinsMap()
+	coinsMap.AddCoin(txn.GetIns()[0].PreviousOutPoint, utxo.NewFreshCoin(coinbase.GetTxOut(0), 1, true), true)
+
+	hashType := uint32(crypto.SigHashAll | crypto.SigHashForkID)
+	errs := ltx.SignRawTransaction([]*tx.Tx{txn}, v.redeemScripts, v.keyStore, coinsMap, hashType)
+	checkErrors(errs, t)
+
+	err := lmempool.AcceptTxToMemPool(txn)
+	assert.NoError(t, err)
+}
@@ -30,3 +30,30 @@ func TxAddCoins(tx *tx.Tx, coinMap *utxo.CoinsMap, height int32) {
 		coinMap.AddCoin(op, coin, isCoinbase)
 	}
 }
+
+// BlockCommitCoins records the coins spent and created by the transactions of
+// a block in the UTXO commitment delta of coinMap, blockUndo holding the spent
+// coins. Where BIP30 is not enforced a coinbase may overwrite an unspent coin
+// of view, which leaves the UTXO set.
+func BlockCommitCoins(txs []*tx.Tx, blockUndo *undo.BlockUndo, coinMap *utxo.CoinsMap, height int32,
+	bip30Enable bool, view utxo.CacheView) {
+	txUndos := blockUndo.GetTxundo()
+	for i, ptx := range txs {
+		if i > 0 {
+			for idx, coin := range txUndos[i-1].GetUndoCoins() {
+				coinMap.UncommitCoin(ptx.GetIns()[idx].PreviousOutPoint, coin)
+			}
+		}
+		isCoinbase := ptx.IsCoinBase()
+		txid := ptx.GetHash()
+		for idx, out := range ptx.GetOuts() {
+			op := outpoint.NewOutPoint(txid, uint32(idx))
+			if !bip30Enable && isCoinbase {
+				if old := view.GetCoin(op); old != nil && !old.IsSpent() {
+					coinMap.UncommitCoin(op, old)
+				}
+			}
+			coinMap.CommitCoin(op, utxo.NewFreshCoin(out, height, isCoinbase))
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package ltx
+
+import (
+	"github.com/copernet/copernicus/errcode"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/util"
+)
+
+// tokenBalance accumulates the tokens of one category.
+type tokenBalance struct {
+	amount     int64
+	minting    bool
+	mutable    int
+	immutables map[string]int
+	outputNFTs []*txout.TokenData
+}
+
+func newTokenBalance() *tokenBalance {
+	return &tokenBalance{immutables: make(map[string]int)}
+}
+
+// CheckTxTokens checks that the CashTokens spent and created by transaction
+// are balanced:
+//   - fungible tokens of a category may not be created from nothing, unless the
+//     category is new, i.e. it is the hash of an outpoint with index 0 spent by
+//     the transaction;
+//   - each immutable NFT output must be backed by an identical input NFT, a
+//     mutable input NFT or a minting input NFT of its category;
+//   - each mutable input NFT backs at most one mutable or immutable output NFT,
+//     and minting NFTs can only be created by minting NFTs or in a new category.
+//
+// Before the tokens are enabled, outputs with a token prefix were unspendable,
+// so spending them stays invalid.
+func CheckTxTokens(transaction *tx.Tx, coinsMap *utxo.CoinsMap, tokensEnabled bool) error {
+	if !tokensEnabled {
+		for _, in := range transaction.GetIns() {
+			coin := coinsMap.GetCoin(in.PreviousOutPoint)
+			if coin == nil {
+				continue
+			}
+			if coinOut := coin.GetTxOut(); coinOut.HasTokenData() {
+				log.Debug("CheckTxTokens spends a token output before activation")
+				return errcode.NewError(errcode.RejectInvalid, "bad-txns-vin-token-before-activation")
+			}
+		}
+		return nil
+	}
+
+	for _, out := range transaction.GetOuts() {
+		if out.HasInvalidTokenPrefix() {
+			log.Debug("CheckTxTokens invalid token prefix")
+			return errcode.NewError(errcode.RejectInvalid, "bad-txns-vout-invalid-token-prefix")
+		}
+	}
+
+	genesis := make(map[util.Hash]bool)
+	balances := make(map[util.Hash]*tokenBalance)
+	if !transaction.IsCoinBase() {
+		for _, in := range transaction.GetIns() {
+			if in.PreviousOutPoint.Index == 0 {
+				genesis[in.PreviousOutPoint.Hash] = true
+			}
+
+			coin := coinsMap.GetCoin(in.PreviousOutPoint)
+			if coin == nil {
+				log.Debug("CheckTxTokens can't find coin")
+				return errcode.NewError(errcode.RejectInvalid, "bad-txns-inputs-missingorspent")
+			}
+			coinOut := coin.GetTxOut()
+			tokenData := coinOut.GetTokenData()
+			if tokenData == nil {
+				continue
+			}
+
+			balance, ok := balances[tokenData.Category]
+			if !ok {
+				balance = newTokenBalance()
+				balances[tokenData.Category] = balance
+			}
+			if tokenData.HasAmount() {
+				sum, ok := script.SafeAdd(balance.amount, tokenData.Amount)
+				if !ok {
+					log.Debug("CheckTxTokens input token amount overflow")
+					return errcode.NewError(errcode.RejectInvalid, "bad-txns-token-in-amount-outofrange")
+				}
+				balance.amount = sum
+			}
+			switch {
+			case tokenData.IsMintingNFT():
+				balance.minting = true
+			case tokenData.IsMutableNFT():
+				balance.mutable++
+			case tokenData.IsImmutableNFT():
+				balance.immutables[string(tokenData.Commitment)]++
+			}
+		}
+	}
+
+	outputs := make(map[util.Hash]*tokenBalance)
+	categories := make([]util.Hash, 0)
+	for _, out := range transaction.GetOuts() {
+		tokenData := out.GetTokenData()
+		if tokenData == nil {
+			continue
+		}
+		if _, ok := balances[tokenData.Category]; !ok && !genesis[tokenData.Category] {
+			log.Debug("CheckTxTokens output token category %s is not spent nor created", tokenData.Category)
+			return errcode.NewError(errcode.RejectInvalid, "bad-txns-token-invalid-category")
+		}
+
+		output, ok := outputs[tokenData.Category]
+		if !ok {
+			output = newTokenBalance()
+			outputs[tokenData.Category] = output
+			categories = append(categories, tokenData.Category)
+		}
+		if tokenData.HasAmount() {
+			sum, ok := script.SafeAdd(output.amount, tokenData.Amount)
+			if !ok {
+				log.Debug("CheckTxTokens output token amount overflow")
+				return errcode.NewError(errcode.RejectInvalid, "bad-txns-token-out-amount-outofrange")
+			}
+			output.amount = sum
+		}
+		if tokenData.HasNFT() {
+			output.outputNFTs = append(output.outputNFTs, tokenData)
+		}
+	}
+
+	for _, category := range categories {
+		// A new category may be given any supply and any NFTs.
+		if genesis[category] {
+			continue
+		}
+
+		output := outputs[category]
+		balance := balances[category]
+		if output.amount > balance.amount {
+			log.Debug("CheckTxTokens category %s creates fungible tokens", category)
+			return errcode.NewError(errcode.RejectInvalid, "bad-txns-token-in-belowout")
+		}
+		if balance.minting {
+			continue
+		}
+
+		// Identical immutable NFTs are matched first, as they can not back
+		// anything else.
+		unmatched := 0
+		for _, nft := range output.outputNFTs {
+			switch {
+			case nft.IsMintingNFT():
+				log.Debug("CheckTxTokens category %s creates a minting NFT", category)
+				return errcode.NewError(errcode.RejectInvalid, "bad-txns-token-nft-ex-nihilo")
+			case nft.IsImmutableNFT() && balance.immutables[string(nft.Commitment)] > 0:
+				balance.immutables[string(nft.Commitment)]--
+			default:
+				unmatched++
+			}
+		}
+		if unmatched > balance.mutable {
+			log.Debug("CheckTxTokens category %s creates NFTs", category)
+			return errcode.NewError(errcode.RejectInvalid, "bad-txns-token-nft-ex-nihilo")
+		}
+	}
+
+	return nil
+}
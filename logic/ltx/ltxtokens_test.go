@@ -0,0 +1,190 @@
+package ltx_test
+
+import (
+	"testing"
+
+	"github.com/copernet/copernicus/errcode"
+	"github.com/copernet/copernicus/logic/ltx"
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	tokenPrevHash     = util.Hash{0x11}
+	tokenCategoryHash = util.Hash{0x22}
+	tokenLockScript   = script.NewScriptRaw([]byte{opcodes.OP_TRUE})
+)
+
+type tokenTestInput struct {
+	index     uint32
+	tokenData *txout.TokenData
+}
+
+// buildTokenTx spends inputs of tokenPrevHash into outputs carrying tokens.
+func buildTokenTx(inputs []tokenTestInput, outputs []*txout.TokenData) (*tx.Tx, *utxo.CoinsMap) {
+	transaction := tx.NewTx(0, tx.DefaultVersion)
+	coinsMap := utxo.NewEmptyCoinsMap()
+	for _, input := range inputs {
+		op := outpoint.NewOutPoint(tokenPrevHash, input.index)
+		transaction.AddTxIn(txin.NewTxIn(op, script.NewEmptyScript(), script.SequenceFinal))
+		out := txout.NewTokenTxOut(1000, tokenLockScript, input.tokenData)
+		coinsMap.AddCoin(op, utxo.NewFreshCoin(out, 1, false), false)
+	}
+	for _, tokenData := range outputs {
+		transaction.AddTxOut(txout.NewTokenTxOut(1000, tokenLockScript, tokenData))
+	}
+	return transaction, coinsMap
+}
+
+func fungible(category util.Hash, amount int64) *txout.TokenData {
+	return txout.NewTokenData(category, amount, false, 0, nil)
+}
+
+func nft(category util.Hash, capability byte, commitment []byte) *txout.TokenData {
+	return txout.NewTokenData(category, 0, true, capability, commitment)
+}
+
+func TestCheckTxTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		inputs  []tokenTestInput
+		outputs []*txout.TokenData
+		reason  string
+	}{
+		{
+			name:    "no tokens",
+			inputs:  []tokenTestInput{{1, nil}},
+			outputs: []*txout.TokenData{nil},
+		},
+		{
+			name:    "genesis from outpoint index 0",
+			inputs:  []tokenTestInput{{0, nil}},
+			outputs: []*txout.TokenData{fungible(tokenPrevHash, 1000), nft(tokenPrevHash, txout.TokenCapabilityMinting, nil)},
+		},
+		{
+			name:    "genesis needs outpoint index 0",
+			inputs:  []tokenTestInput{{1, nil}},
+			outputs: []*txout.TokenData{fungible(tokenPrevHash, 1000)},
+			reason:  "bad-txns-token-invalid-category",
+		},
+		{
+			name:    "unknown category",
+			inputs:  []tokenTestInput{{1, fungible(tokenCategoryHash, 10)}},
+			outputs: []*txout.TokenData{fungible(util.Hash{0x33}, 10)},
+			reason:  "bad-txns-token-invalid-category",
+		},
+		{
+			name:    "fungible split and burn",
+			inputs:  []tokenTestInput{{1, fungible(tokenCategoryHash, 10)}, {2, fungible(tokenCategoryHash, 5)}},
+			outputs: []*txout.TokenData{fungible(tokenCategoryHash, 7), fungible(tokenCategoryHash, 6), nil},
+		},
+		{
+			name:    "fungible inflation",
+			inputs:  []tokenTestInput{{1, fungible(tokenCategoryHash, 10)}},
+			outputs: []*txout.TokenData{fungible(tokenCategoryHash, 7), fungible(tokenCategoryHash, 4)},
+			reason:  "bad-txns-token-in-belowout",
+		},
+		{
+			name:    "fungible inflation with minting NFT",
+			inputs:  []tokenTestInput{{1, nft(tokenCategoryHash, txout.TokenCapabilityMinting, nil)}},
+			outputs: []*txout.TokenData{fungible(tokenCategoryHash, 1)},
+			reason:  "bad-txns-token-in-belowout",
+		},
+		{
+			name:    "fungible input overflow",
+			inputs:  []tokenTestInput{{1, fungible(tokenCategoryHash, txout.MaxTokenAmount)}, {2, fungible(tokenCategoryHash, 1)}},
+			outputs: []*txout.TokenData{fungible(tokenCategoryHash, 1)},
+			reason:  "bad-txns-token-in-amount-outofrange",
+		},
+		{
+			name:   "fungible output overflow",
+			inputs: []tokenTestInput{{0, nil}},
+			outputs: []*txout.TokenData{fungible(tokenPrevHash, txout.MaxTokenAmount),
+				fungible(tokenPrevHash, 1)},
+			reason: "bad-txns-token-out-amount-outofrange",
+		},
+		{
+			name:    "immutable NFT transfer",
+			inputs:  []tokenTestInput{{1, nft(tokenCategoryHash, txout.TokenCapabilityNone, []byte{0xaa})}},
+			outputs: []*txout.TokenData{nft(tokenCategoryHash, txout.TokenCapabilityNone, []byte{0xaa})},
+		},
+		{
+			name:    "immutable NFT modified",
+			inputs:  []tokenTestInput{{1, nft(tokenCategoryHash, txout.TokenCapabilityNone, []byte{0xaa})}},
+			outputs: []*txout.TokenData{nft(tokenCategoryHash, txout.TokenCapabilityNone, []byte{0xbb})},
+			reason:  "bad-txns-token-nft-ex-nihilo",
+		},
+		{
+			name:    "immutable NFT duplicated",
+			inputs:  []tokenTestInput{{1, nft(tokenCategoryHash, txout.TokenCapabilityNone, []byte{0xaa})}},
+			outputs: []*txout.TokenData{nft(tokenCategoryHash, txout.TokenCapabilityNone, []byte{0xaa}), nft(tokenCategoryHash, txout.TokenCapabilityNone, []byte{0xaa})},
+			reason:  "bad-txns-token-nft-ex-nihilo",
+		},
+		{
+			name:    "immutable NFT upgraded",
+			inputs:  []tokenTestInput{{1, nft(tokenCategoryHash, txout.TokenCapabilityNone, nil)}},
+			outputs: []*txout.TokenData{nft(tokenCategoryHash, txout.TokenCapabilityMutable, nil)},
+			reason:  "bad-txns-token-nft-ex-nihilo",
+		},
+		{
+			name:    "mutable NFT modified",
+			inputs:  []tokenTestInput{{1, nft(tokenCategoryHash, txout.TokenCapabilityMutable, []byte{0xaa})}},
+			outputs: []*txout.TokenData{nft(tokenCategoryHash, txout.TokenCapabilityMutable, []byte{0xbb})},
+		},
+		{
+			name:    "mutable NFT backs one NFT",
+			inputs:  []tokenTestInput{{1, nft(tokenCategoryHash, txout.TokenCapabilityMutable, nil)}},
+			outputs: []*txout.TokenData{nft(tokenCategoryHash, txout.TokenCapabilityNone, nil), nft(tokenCategoryHash, txout.TokenCapabilityNone, nil)},
+			reason:  "bad-txns-token-nft-ex-nihilo",
+		},
+		{
+			name:    "mutable NFT can not mint",
+			inputs:  []tokenTestInput{{1, nft(tokenCategoryHash, txout.TokenCapabilityMutable, nil)}},
+			outputs: []*txout.TokenData{nft(tokenCategoryHash, txout.TokenCapabilityMinting, nil)},
+			reason:  "bad-txns-token-nft-ex-nihilo",
+		},
+		{
+			name:   "minting NFT creates NFTs",
+			inputs: []tokenTestInput{{1, nft(tokenCategoryHash, txout.TokenCapabilityMinting, nil)}},
+			outputs: []*txout.TokenData{nft(tokenCategoryHash, txout.TokenCapabilityMinting, nil),
+				nft(tokenCategoryHash, txout.TokenCapabilityMutable, []byte{1}), nft(tokenCategoryHash, txout.TokenCapabilityNone, []byte{2})},
+		},
+	}
+
+	for _, test := range tests {
+		transaction, coinsMap := buildTokenTx(test.inputs, test.outputs)
+		err := ltx.CheckTxTokens(transaction, coinsMap, true)
+		if test.reason == "" {
+			assert.NoError(t, err, test.name)
+			continue
+		}
+		_, reason, ok := errcode.IsRejectCode(err)
+		assert.True(t, ok, test.name)
+		assert.Equal(t, test.reason, reason, test.name)
+	}
+}
+
+func TestCheckTxTokens_beforeActivation(t *testing.T) {
+	transaction, coinsMap := buildTokenTx([]tokenTestInput{{1, nil}}, []*txout.TokenData{nil})
+	assert.NoError(t, ltx.CheckTxTokens(transaction, coinsMap, false))
+
+	transaction, coinsMap = buildTokenTx([]tokenTestInput{{1, fungible(tokenCategoryHash, 1)}}, []*txout.TokenData{nil})
+	_, reason, _ := errcode.IsRejectCode(ltx.CheckTxTokens(transaction, coinsMap, false))
+	assert.Equal(t, "bad-txns-vin-token-before-activation", reason)
+}
+
+func TestCheckTxTokens_invalidPrefix(t *testing.T) {
+	transaction, coinsMap := buildTokenTx([]tokenTestInput{{1, nil}}, nil)
+	badPrefix := append([]byte{txout.PrefixToken}, make([]byte, util.Hash256Size)...)
+	transaction.AddTxOut(txout.NewTxOut(1000, script.NewScriptRaw(append(badPrefix, 0x00, opcodes.OP_TRUE))))
+
+	_, reason, _ := errcode.IsRejectCode(ltx.CheckTxTokens(transaction, coinsMap, true))
+	assert.Equal(t, "bad-txns-vout-invalid-token-prefix", reason)
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/copernet/copernicus/model/outpoint"
 	"github.com/copernet/copernicus/model/undo"
 	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/persist"
+	"github.com/copernet/copernicus/persist/blkdb"
 )
 
 func ApplyBlockUndo(blockUndo *undo.BlockUndo, blk *block.Block, cm *utxo.CoinsMap, height int32) undo.DisconnectResult {
@@ -50,9 +52,16 @@ func ApplyBlockUndo(blockUndo *undo.BlockUndo, blk *block.Block, cm *utxo.CoinsM
 			if !ptx.GetTxOut(j).IsSpendable() {
 				continue
 			}
-			coin := cm.SpendGlobalCoin(outpoint.NewOutPoint(txID, uint32(j)))
+			out := outpoint.NewOutPoint(txID, uint32(j))
+			coin := cm.SpendGlobalCoin(out)
+			if coin == nil {
+				// the output was never added or is already spent
+				clean = false
+				continue
+			}
+			cm.UncommitCoin(out, coin)
 			coinOut := coin.GetTxOut()
-			if coin == nil || !ptx.GetTxOut(j).IsEqual(&coinOut) ||
+			if !ptx.GetTxOut(j).IsEqual(&coinOut) ||
 				isCoinBase != coin.IsCoinBase() || height != coin.GetHeight() {
 				// transaction output mismatch
 				clean = false
@@ -60,6 +69,13 @@ func ApplyBlockUndo(blockUndo *undo.BlockUndo, blk *block.Block, cm *utxo.CoinsM
 		}
 	}
 
+	if persist.SpentIndex {
+		if err := eraseSpentIndex(blk); err != nil {
+			log.Error("ApplyBlockUndo: erase the spent index of block %s failed: %v", blk.GetHash(), err)
+			return undo.DisconnectFailed
+		}
+	}
+
 	cm.Flush(blk.GetBlockHeader().HashPrevBlock)
 	if clean {
 		return undo.DisconnectOk
@@ -68,12 +84,28 @@ func ApplyBlockUndo(blockUndo *undo.BlockUndo, blk *block.Block, cm *utxo.CoinsM
 	return undo.DisconnectUnclean
 }
 
+// eraseSpentIndex forgets the outpoints spent by the transactions of blk.
+func eraseSpentIndex(blk *block.Block) error {
+	var entries []blkdb.SpentIndexEntry
+	for _, ptx := range blk.Txs[1:] {
+		txid := ptx.GetHash()
+		for j, in := range ptx.GetIns() {
+			entries = append(entries, blkdb.SpentIndexEntry{
+				OutPoint:        *in.PreviousOutPoint,
+				SpentIndexValue: blkdb.SpentIndexValue{TxHash: txid, InputIndex: uint32(j)},
+			})
+		}
+	}
+	return blkdb.GetInstance().EraseSpentIndex(entries)
+}
+
 func undoCoinSpend(out *outpoint.OutPoint, undoCoin *utxo.Coin, cm *utxo.CoinsMap) undo.DisconnectResult {
 	clean := true
 
-	if cm.FetchCoin(out) != nil {
+	if overwritten := cm.FetchCoin(out); overwritten != nil {
 		// Overwriting transaction output.
 		clean = false
+		cm.UncommitCoin(out, overwritten)
 	}
 
 	if undoCoin.GetHeight() == 0 {
@@ -98,6 +130,7 @@ func undoCoinSpend(out *outpoint.OutPoint, undoCoin *utxo.Coin, cm *utxo.CoinsMa
 	// we have queried for that above using HaveCoin, we don't need to guess.
 	// When fClean is false, a coin already existed and it is an overwrite.
 	cm.AddCoin(out, undoCoin, !clean)
+	cm.CommitCoin(out, undoCoin)
 
 	if clean {
 		return undo.DisconnectOk
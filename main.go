@@ -9,6 +9,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/logic/lchain"
+	"github.com/copernet/copernicus/logic/lindex"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -19,6 +21,8 @@ import (
 	"github.com/copernet/copernicus/model"
 	"github.com/copernet/copernicus/net/limits"
 	"github.com/copernet/copernicus/net/server"
+	"github.com/copernet/copernicus/persist"
+	"github.com/copernet/copernicus/persist/disk"
 	"github.com/copernet/copernicus/rpc"
 	"github.com/copernet/copernicus/util"
 	"net"
@@ -76,6 +80,14 @@ func bchMain(ctx context.Context, args []string) error {
 		if !conf.Cfg.P2PNet.DisableRPC {
 			rpcServer.Stop()
 		}
+		lindex.StopIndexes()
+		lchain.StopBackgroundValidation()
+		// Write the cached coins and block index to disk before exiting.
+		persist.CsMain.Lock()
+		if err := disk.FlushStateToDisk(disk.FlushStateAlways, 0); err != nil {
+			log.Error("flush state to disk on shutdown failed: %v", err)
+		}
+		persist.CsMain.Unlock()
 	}()
 	go func() {
 		<-rpcServer.RequestedProcessShutdown()
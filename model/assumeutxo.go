@@ -0,0 +1,27 @@
+package model
+
+import "github.com/copernet/copernicus/util"
+
+// AssumeUTXOData commits to the UTXO set at a block of the main chain, so a
+// snapshot of the set at that block can be loaded instead of validating the
+// chain up to it.
+type AssumeUTXOData struct {
+	Height    int32
+	BlockHash *util.Hash
+	// HashSerialized is the hash_serialized of the UTXO set at the block, as
+	// reported by gettxoutsetinfo and dumptxoutset.
+	HashSerialized *util.Hash
+	// ChainTxCount is the number of transactions up to and including the block.
+	ChainTxCount int32
+}
+
+// AssumeUTXOForBlock returns the UTXO set commitment at the block hash, or nil
+// if snapshots based on that block cannot be loaded.
+func (param *BitcoinParams) AssumeUTXOForBlock(hash *util.Hash) *AssumeUTXOData {
+	for _, data := range param.AssumeUTXO {
+		if data.BlockHash.IsEqual(hash) {
+			return data
+		}
+	}
+	return nil
+}
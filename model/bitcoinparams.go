@@ -64,6 +64,11 @@ type BitcoinParams struct {
 	Checkpoints              []*Checkpoint
 	MineBlocksOnDemands      bool
 
+	// UTXO set snapshots which can be loaded by LoadSnapshot. An entry is
+	// only added for a block once the hash_serialized of the UTXO set at that
+	// block was reproduced by fully validating nodes.
+	AssumeUTXO []*AssumeUTXOData
+
 	// Enforce current block version once network has
 	// upgraded.  This is part of BIP0034.
 	BlockEnforceNumRequired uint64
@@ -133,19 +138,43 @@ var MainNetParams = BitcoinParams{
 		// November 13, 2017 hard fork
 		DAAHeight: 504031,
 
-		// May 15, 2018 hard fork
-		MonolithActivationTime: 1526400000,
-
 		// Nov 15, 2018 hard fork
 		MagneticAnomalyActivationTime: 1542300000,
 
 		// Wed, 15 May 2019 12:00:00 UTC hard fork
 		GreatWallActivationTime: 1557921600,
+
+		// Nov 15, 2019 12:00:00 UTC hard fork
+		GravitonActivationTime: 1573819200,
+
+		// May 15, 2020 12:00:00 UTC hard fork
+		PhononActivationTime: 1589544000,
+
+		// Nov 15, 2020 12:00:00 UTC hard fork
+		AxionActivationTime: 1605441600,
+
+		// May 15, 2022 12:00:00 UTC hard fork
+		Upgrade8ActivationTime: 1652616000,
+
+		// May 15, 2023 12:00:00 UTC hard fork
+		Upgrade9ActivationTime: 1684152000,
+
+		// Jan 1, 2100 00:00:00 UTC, replay protection is not scheduled
+		ReplayProtectionActivationTime: 4102444800,
+
+		// Two days
+		ASERTHalfLife: 2 * 24 * 60 * 60,
+		ASERTAnchor: &consensus.ASERTAnchor{
+			Height:        661647,
+			Bits:          0x1804dafe,
+			PrevBlockTime: 1605447844,
+		},
 	},
 
-	Name:        "main",
-	BitcoinNet:  wire.MainNet,
-	DefaultPort: "8333",
+	Name:             "main",
+	BitcoinNet:       wire.MainNet,
+	DefaultPort:      "8333",
+	PruneAfterHeight: 100000,
 	DNSSeeds: []DNSSeed{
 		{Host: "seed.bitcoinabc.org", HasFiltering: true},                  // Pieter Wuille
 		{Host: "seed-abc.bitcoinforks.org", HasFiltering: true},            // Matt Corallo
@@ -251,22 +280,46 @@ var TestNetParams = BitcoinParams{
 		DefaultAssumeValid: *util.HashFromString("0000000000000102b62e613c19671226fc8e098d4f89cf8b8da3f73aca8590e1"),
 		UAHFHeight:         1155875,
 		DAAHeight:          1188697,
-		// May 15, 2018 hard fork
-		MonolithActivationTime: 1526400000,
-
 		// Nov 15, 2018 hard fork
 		MagneticAnomalyActivationTime: 1542300000,
 		// Wed, 15 May 2019 12:00:00 UTC hard fork
 		GreatWallActivationTime: 1557921600,
+
+		// Nov 15, 2019 12:00:00 UTC hard fork
+		GravitonActivationTime: 1573819200,
+
+		// May 15, 2020 12:00:00 UTC hard fork
+		PhononActivationTime: 1589544000,
+
+		// Nov 15, 2020 12:00:00 UTC hard fork
+		AxionActivationTime: 1605441600,
+
+		// May 15, 2022 12:00:00 UTC hard fork
+		Upgrade8ActivationTime: 1652616000,
+
+		// May 15, 2023 12:00:00 UTC hard fork
+		Upgrade9ActivationTime: 1684152000,
+
+		// Jan 1, 2100 00:00:00 UTC, replay protection is not scheduled
+		ReplayProtectionActivationTime: 4102444800,
+
+		// Two days
+		ASERTHalfLife: 2 * 24 * 60 * 60,
+		ASERTAnchor: &consensus.ASERTAnchor{
+			Height:        1421481,
+			Bits:          0x1d00ffff,
+			PrevBlockTime: 1605445400,
+		},
 		//CashHardForkActivationTime: 1510600000,
 		GenesisHash: &TestNetGenesisHash,
 		//CashaddrPrefix: "xbctest",
 	},
 
-	Name:        "test",
-	BitcoinNet:  wire.TestNet3,
-	DiskMagic:   wire.TestDiskMagic,
-	DefaultPort: "18333",
+	Name:             "test",
+	BitcoinNet:       wire.TestNet3,
+	DiskMagic:        wire.TestDiskMagic,
+	DefaultPort:      "18333",
+	PruneAfterHeight: 1000,
 	DNSSeeds: []DNSSeed{
 		{Host: "testnet-seed.bitcoinabc.org", HasFiltering: true},
 		{Host: "testnet-seed-abc.bitcoinforks.org", HasFiltering: true},
@@ -348,21 +401,40 @@ var RegressionNetParams = BitcoinParams{
 		UAHFHeight:         0,
 		DAAHeight:          0,
 
-		// May 15, 2018 hard fork.
-		MonolithActivationTime: 1526400000,
-
 		// Nov 15, 2018 hard fork
 		MagneticAnomalyActivationTime: 1542300000,
 
 		// Wed, 15 May 2019 12:00:00 UTC hard fork
 		GreatWallActivationTime: 1557921600,
+
+		// Nov 15, 2019 12:00:00 UTC hard fork
+		GravitonActivationTime: 1573819200,
+
+		// May 15, 2020 12:00:00 UTC hard fork
+		PhononActivationTime: 1589544000,
+
+		// Nov 15, 2020 12:00:00 UTC hard fork
+		AxionActivationTime: 1605441600,
+
+		// May 15, 2022 12:00:00 UTC hard fork
+		Upgrade8ActivationTime: 1652616000,
+
+		// May 15, 2023 12:00:00 UTC hard fork
+		Upgrade9ActivationTime: 1684152000,
+
+		// Jan 1, 2100 00:00:00 UTC, replay protection is not scheduled
+		ReplayProtectionActivationTime: 4102444800,
+
+		// Two days
+		ASERTHalfLife: 2 * 24 * 60 * 60,
 	},
 
-	Name:         "regtest",
-	BitcoinNet:   wire.RegTestNet,
-	DefaultPort:  "18444",
-	DNSSeeds:     []DNSSeed{},
-	GenesisBlock: RegTestGenesisBlock,
+	Name:             "regtest",
+	BitcoinNet:       wire.RegTestNet,
+	DefaultPort:      "18444",
+	PruneAfterHeight: 1000,
+	DNSSeeds:         []DNSSeed{},
+	GenesisBlock:     RegTestGenesisBlock,
 
 	PowLimitBits:             RegTestGenesisBlock.Header.Bits,
 	CoinbaseMaturity:         100,
@@ -373,7 +445,17 @@ var RegressionNetParams = BitcoinParams{
 	MinDiffReductionTime:     time.Minute * 20,
 	GenerateSupported:        true,
 	Checkpoints:              nil,
-	MineBlocksOnDemands:      true,
+	// The chain mined by "setmocktime 1600000000" and "generatetoaddress 110
+	// mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r" on an empty node.
+	AssumeUTXO: []*AssumeUTXOData{
+		{
+			Height:         110,
+			BlockHash:      util.HashFromString("1f666c6269d6f08f08cc5c0329148ea79f5515f751a085ee2d8a6beb38229389"),
+			HashSerialized: util.HashFromString("8c11aeb8d1b273225892e0aad88f21b62f61abbdb4b18348b5cb0094e52ad32b"),
+			ChainTxCount:   111,
+		},
+	},
+	MineBlocksOnDemands: true,
 	// Enforce current block version once majority of the network has
 	// upgraded.
 	// 75% (750 / 1000)
@@ -449,23 +531,58 @@ func mustRegister(bp *BitcoinParams) {
 
 //IsUAHFEnabled Check is UAHF has activated.
 func IsUAHFEnabled(height int32) bool {
-	return height >= ActiveNetParams.UAHFHeight
+	return UAHFUpgrade.IsActive(ActiveNetParams, height, 0)
 }
 
 func IsDAAEnabled(height int32) bool {
-	return height >= ActiveNetParams.DAAHeight
+	return DAAUpgrade.IsActive(ActiveNetParams, height, 0)
 }
 
 func IsMagneticAnomalyEnabled(mediaTimePast int64) bool {
-	activeTime := ActiveNetParams.MagneticAnomalyActivationTime
-	if conf.Args.MagneticAnomalyTime > 0 {
-		activeTime = conf.Args.MagneticAnomalyTime
-	}
-	return mediaTimePast >= activeTime
+	return MagneticAnomalyUpgrade.IsActive(ActiveNetParams, 0, mediaTimePast)
+}
+
+// IsGreatWallEnabled Check if the May 15 2019 upgrade, which enables Schnorr
+// signatures, has activated.
+func IsGreatWallEnabled(medianTimePast int64) bool {
+	return GreatWallUpgrade.IsActive(ActiveNetParams, 0, medianTimePast)
+}
+
+// IsGravitonEnabled Check if the Nov 15 2019 upgrade, which enables Schnorr
+// multisig, has activated.
+func IsGravitonEnabled(medianTimePast int64) bool {
+	return GravitonUpgrade.IsActive(ActiveNetParams, 0, medianTimePast)
+}
+
+// IsPhononEnabled Check if the May 15 2020 upgrade, which replaces sigops with
+// SigChecks and enables OP_REVERSEBYTES, has activated.
+func IsPhononEnabled(medianTimePast int64) bool {
+	return PhononUpgrade.IsActive(ActiveNetParams, 0, medianTimePast)
+}
+
+// IsAxionEnabled Check if the Nov 15 2020 upgrade, which switches difficulty
+// adjustment to ASERT, has activated.
+func IsAxionEnabled(medianTimePast int64) bool {
+	return AxionUpgrade.IsActive(ActiveNetParams, 0, medianTimePast)
+}
+
+// IsUpgrade8Enabled Check if the May 15 2022 upgrade, which enables native
+// introspection and 64-bit script integers, has activated.
+func IsUpgrade8Enabled(medianTimePast int64) bool {
+	return Upgrade8Upgrade.IsActive(ActiveNetParams, 0, medianTimePast)
+}
+
+// IsUpgrade9Enabled Check if the May 15 2023 upgrade, which enables CashTokens,
+// has activated.
+func IsUpgrade9Enabled(medianTimePast int64) bool {
+	return Upgrade9Upgrade.IsActive(ActiveNetParams, 0, medianTimePast)
 }
 
+// IsReplayProtectionEnabled Check if the fork id of signatures is changed, to
+// split from nodes which do not follow the next upgrade. It is only ever
+// scheduled ahead of an upgrade, and is not tied to the activation of any.
 func IsReplayProtectionEnabled(medianTimePast int64) bool {
-	time := ActiveNetParams.GreatWallActivationTime
+	time := ActiveNetParams.ReplayProtectionActivationTime
 	if conf.Args.ReplayProtectionActivationTime > 0 {
 		time = conf.Args.ReplayProtectionActivationTime
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/copernet/copernicus/conf"
 	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/util"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
@@ -114,6 +115,90 @@ func TestIsMagneticAnomalyEnabled(t *testing.T) {
 		ActiveNetParams.MagneticAnomalyActivationTime))
 }
 
+func TestIsGreatWallEnabled(t *testing.T) {
+	for _, params := range []*BitcoinParams{&MainNetParams, &TestNetParams, &RegressionNetParams} {
+		ActiveNetParams = params
+		assert.False(t, IsGreatWallEnabled(0))
+		assert.False(t, IsGreatWallEnabled(ActiveNetParams.GreatWallActivationTime-1))
+		assert.True(t, IsGreatWallEnabled(ActiveNetParams.GreatWallActivationTime))
+	}
+
+	conf.Args.GreatWallTime = 100
+	defer func() { conf.Args.GreatWallTime = -1 }()
+	assert.False(t, IsGreatWallEnabled(99))
+	assert.True(t, IsGreatWallEnabled(100))
+}
+
+func TestIsGravitonEnabled(t *testing.T) {
+	for _, params := range []*BitcoinParams{&MainNetParams, &TestNetParams, &RegressionNetParams} {
+		ActiveNetParams = params
+		assert.False(t, IsGravitonEnabled(ActiveNetParams.GreatWallActivationTime))
+		assert.False(t, IsGravitonEnabled(ActiveNetParams.GravitonActivationTime-1))
+		assert.True(t, IsGravitonEnabled(ActiveNetParams.GravitonActivationTime))
+	}
+
+	conf.Args.GravitonTime = 100
+	defer func() { conf.Args.GravitonTime = -1 }()
+	assert.False(t, IsGravitonEnabled(99))
+	assert.True(t, IsGravitonEnabled(100))
+}
+
+func TestIsPhononEnabled(t *testing.T) {
+	for _, params := range []*BitcoinParams{&MainNetParams, &TestNetParams, &RegressionNetParams} {
+		ActiveNetParams = params
+		assert.False(t, IsPhononEnabled(ActiveNetParams.GravitonActivationTime))
+		assert.False(t, IsPhononEnabled(ActiveNetParams.PhononActivationTime-1))
+		assert.True(t, IsPhononEnabled(ActiveNetParams.PhononActivationTime))
+	}
+
+	conf.Args.PhononTime = 100
+	defer func() { conf.Args.PhononTime = -1 }()
+	assert.False(t, IsPhononEnabled(99))
+	assert.True(t, IsPhononEnabled(100))
+}
+
+func TestIsAxionEnabled(t *testing.T) {
+	for _, params := range []*BitcoinParams{&MainNetParams, &TestNetParams, &RegressionNetParams} {
+		ActiveNetParams = params
+		assert.False(t, IsAxionEnabled(ActiveNetParams.GravitonActivationTime))
+		assert.False(t, IsAxionEnabled(ActiveNetParams.AxionActivationTime-1))
+		assert.True(t, IsAxionEnabled(ActiveNetParams.AxionActivationTime))
+	}
+
+	conf.Args.AxionTime = 100
+	defer func() { conf.Args.AxionTime = -1 }()
+	assert.False(t, IsAxionEnabled(99))
+	assert.True(t, IsAxionEnabled(100))
+}
+
+func TestIsUpgrade8Enabled(t *testing.T) {
+	for _, params := range []*BitcoinParams{&MainNetParams, &TestNetParams, &RegressionNetParams} {
+		ActiveNetParams = params
+		assert.False(t, IsUpgrade8Enabled(ActiveNetParams.AxionActivationTime))
+		assert.False(t, IsUpgrade8Enabled(ActiveNetParams.Upgrade8ActivationTime-1))
+		assert.True(t, IsUpgrade8Enabled(ActiveNetParams.Upgrade8ActivationTime))
+	}
+
+	conf.Args.Upgrade8Time = 100
+	defer func() { conf.Args.Upgrade8Time = -1 }()
+	assert.False(t, IsUpgrade8Enabled(99))
+	assert.True(t, IsUpgrade8Enabled(100))
+}
+
+func TestIsUpgrade9Enabled(t *testing.T) {
+	for _, params := range []*BitcoinParams{&MainNetParams, &TestNetParams, &RegressionNetParams} {
+		ActiveNetParams = params
+		assert.False(t, IsUpgrade9Enabled(ActiveNetParams.Upgrade8ActivationTime))
+		assert.False(t, IsUpgrade9Enabled(ActiveNetParams.Upgrade9ActivationTime-1))
+		assert.True(t, IsUpgrade9Enabled(ActiveNetParams.Upgrade9ActivationTime))
+	}
+
+	conf.Args.Upgrade9Time = 100
+	defer func() { conf.Args.Upgrade9Time = -1 }()
+	assert.False(t, IsUpgrade9Enabled(99))
+	assert.True(t, IsUpgrade9Enabled(100))
+}
+
 func TestIsDAAEnabled(t *testing.T) {
 	ActiveNetParams = &MainNetParams
 
@@ -137,6 +222,28 @@ func TestIsReplayProtectionEnabled(t *testing.T) {
 
 	isEnable = IsReplayProtectionEnabled(MainNetParams.MagneticAnomalyActivationTime)
 	assert.False(t, isEnable)
+
+	isEnable = IsReplayProtectionEnabled(MainNetParams.GreatWallActivationTime)
+	assert.False(t, isEnable)
+
+	isEnable = IsReplayProtectionEnabled(MainNetParams.Upgrade9ActivationTime)
+	assert.False(t, isEnable)
+
+	isEnable = IsReplayProtectionEnabled(MainNetParams.ReplayProtectionActivationTime)
+	assert.True(t, isEnable)
+
+	conf.Args.GreatWallTime = 100
+	isEnable = IsReplayProtectionEnabled(MainNetParams.Upgrade9ActivationTime)
+	assert.False(t, isEnable)
+	conf.Args.GreatWallTime = -1
+
+	conf.Args.ReplayProtectionActivationTime = MainNetParams.Upgrade9ActivationTime
+	defer func() { conf.Args.ReplayProtectionActivationTime = -1 }()
+	isEnable = IsReplayProtectionEnabled(MainNetParams.Upgrade9ActivationTime - 1)
+	assert.False(t, isEnable)
+
+	isEnable = IsReplayProtectionEnabled(MainNetParams.Upgrade9ActivationTime)
+	assert.True(t, isEnable)
 }
 
 func TestGetBlockSubsidy(t *testing.T) {
@@ -172,3 +279,15 @@ func TestGetBlockSubsidy(t *testing.T) {
 
 	}
 }
+
+func TestAssumeUTXOForBlock(t *testing.T) {
+	params := RegressionNetParams
+	blockHash := util.HashOne
+	params.AssumeUTXO = []*AssumeUTXOData{
+		{Height: 110, BlockHash: &blockHash, HashSerialized: &util.HashZero, ChainTxCount: 111},
+	}
+
+	assert.Equal(t, params.AssumeUTXO[0], params.AssumeUTXOForBlock(&util.HashOne))
+	assert.Nil(t, params.AssumeUTXOForBlock(&util.HashZero))
+	assert.Nil(t, RegressionNetParams.AssumeUTXOForBlock(&util.HashOne))
+}
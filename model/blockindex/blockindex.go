@@ -192,6 +192,10 @@ func (bIndex *BlockIndex) HasUndo() bool {
 	return bIndex.Status&BlockHaveUndo != 0
 }
 
+func (bIndex *BlockIndex) IsAssumedValid() bool {
+	return bIndex.Status&BlockAssumedValid != 0
+}
+
 func (bIndex *BlockIndex) SubStatus(status uint32) {
 	bIndex.Status &= ^status
 }
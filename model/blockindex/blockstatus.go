@@ -45,4 +45,8 @@ const (
 	BlockFailedParent uint32 = 64
 	// BlockInvalidMask Mask used to check if the block failed.
 	BlockInvalidMask = BlockFailed | BlockFailedParent
+
+	// BlockAssumedValid The block was not validated, the UTXO set built on it
+	// was loaded from a snapshot.
+	BlockAssumedValid uint32 = 128
 )
@@ -249,6 +249,41 @@ func (c *Chain) GetBlockScriptFlags(pindex *blockindex.BlockIndex) uint32 {
 		flags |= script.ScriptVerifyCleanStack
 	}
 
+	// When the great wall fork is enabled, we start accepting 64-byte Schnorr
+	// signatures in OP_CHECK(DATA)SIG(VERIFY), and coins sent to P2SH-wrapped
+	// segwit outputs can be recovered.
+	if model.IsGreatWallEnabled(pindex.GetMedianTimePast()) {
+		flags |= script.ScriptEnableSchnorr
+		flags |= script.ScriptAllowSegwitRecovery
+	}
+
+	// When the graviton fork is enabled, a non-null dummy element in
+	// OP_CHECKMULTISIG(VERIFY) selects the keys to check Schnorr signatures
+	// against, and minimal data pushes become a consensus rule.
+	if model.IsGravitonEnabled(pindex.GetMedianTimePast()) {
+		flags |= script.ScriptEnableSchnorrMultisig
+		flags |= script.ScriptVerifyMinmalData
+	}
+
+	// When the phonon fork is enabled, OP_REVERSEBYTES is available and the
+	// SigChecks limits replace the legacy sigops limits.
+	if model.IsPhononEnabled(pindex.GetMedianTimePast()) {
+		flags |= script.ScriptEnableOpReverseBytes
+		flags |= script.ScriptEnforceSigChecks
+	}
+
+	// When the May 2022 upgrade is enabled, script integers are 64 bits wide,
+	// OP_MUL is re-enabled and the native introspection opcodes are available.
+	if model.IsUpgrade8Enabled(pindex.GetMedianTimePast()) {
+		flags |= script.ScriptEnable64BitIntegers
+		flags |= script.ScriptEnableNativeIntrospection
+	}
+
+	// When the May 2023 upgrade is enabled, outputs may carry CashTokens.
+	if model.IsUpgrade9Enabled(pindex.GetMedianTimePast()) {
+		flags |= script.ScriptEnableTokens
+	}
+
 	// We make sure this node will have replay protection during the next hard
 	// fork.
 	if model.IsReplayProtectionEnabled(pindex.GetMedianTimePast()) {
@@ -268,6 +303,19 @@ func (c *Chain) GetIndex(height int32) *blockindex.BlockIndex {
 	return c.active[height]
 }
 
+// FindEarliestAtLeast Find the earliest block with timestamp equal or greater
+// than the given, or nil if there is none.
+func (c *Chain) FindEarliestAtLeast(time int64) *blockindex.BlockIndex {
+	height := c.Height()
+	i := sort.Search(int(height)+1, func(i int) bool {
+		return int64(c.active[i].TimeMax) >= time
+	})
+	if i > int(height) {
+		return nil
+	}
+	return c.active[i]
+}
+
 // Equal Compare two chains efficiently.
 
 func (c *Chain) Equal(dst *Chain) bool {
@@ -629,6 +677,18 @@ func (c *Chain) BuildForwardTree() (forward map[*blockindex.BlockIndex][]*blocki
 	return
 }
 
+// GetBlockIndexesInFile returns the blocks whose data or undo data is stored
+// in the block file fileNumber.
+func (c *Chain) GetBlockIndexesInFile(fileNumber int32) []*blockindex.BlockIndex {
+	indexes := make([]*blockindex.BlockIndex, 0)
+	for _, v := range c.indexMap {
+		if v.File == fileNumber && (v.HasData() || v.HasUndo()) {
+			indexes = append(indexes, v)
+		}
+	}
+	return indexes
+}
+
 func (c *Chain) CanDirectFetch() bool {
 	return int64(c.Tip().GetBlockTime()) > util.GetAdjustedTimeSec()-int64(c.params.TargetTimePerBlock)*20
 }
@@ -307,6 +307,97 @@ func TestChain_GetBlockScriptFlags(t *testing.T) {
 	}
 }
 
+func TestChain_GetBlockScriptFlagsSchnorr(t *testing.T) {
+	InitGlobalChain()
+	testChain := GetInstance()
+	timePerBlock := int64(model.ActiveNetParams.TargetTimePerBlock)
+	initBits := model.ActiveNetParams.PowLimitBits
+
+	buildChain := func(startTime int64) *blockindex.BlockIndex {
+		blockIdx := make([]*blockindex.BlockIndex, 20)
+		blockheader := block.NewBlockHeader()
+		blockheader.Time = uint32(startTime)
+		blockIdx[0] = blockindex.NewBlockIndex(blockheader)
+		blockIdx[0].Height = 600000
+		for i := 1; i < 20; i++ {
+			blockIdx[i] = getBlockIndex(blockIdx[i-1], timePerBlock, initBits)
+		}
+		return blockIdx[19]
+	}
+
+	activation := model.ActiveNetParams.GreatWallActivationTime
+	before := buildChain(activation - 20*timePerBlock)
+	if flag := testChain.GetBlockScriptFlags(before); flag&script.ScriptEnableSchnorr != 0 {
+		t.Errorf("schnorr should not be enabled before activation, mtp: %d", before.GetMedianTimePast())
+	}
+	if flag := testChain.GetBlockScriptFlags(before); flag&script.ScriptAllowSegwitRecovery != 0 {
+		t.Errorf("segwit recovery should not be allowed before activation, mtp: %d", before.GetMedianTimePast())
+	}
+
+	after := buildChain(activation)
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnableSchnorr == 0 {
+		t.Errorf("schnorr should be enabled after activation, mtp: %d", after.GetMedianTimePast())
+	}
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptAllowSegwitRecovery == 0 {
+		t.Errorf("segwit recovery should be allowed after activation, mtp: %d", after.GetMedianTimePast())
+	}
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnableSchnorrMultisig != 0 {
+		t.Errorf("schnorr multisig should not be enabled before activation, mtp: %d", after.GetMedianTimePast())
+	}
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptVerifyMinmalData != 0 {
+		t.Errorf("minimal data should not be enforced before activation, mtp: %d", after.GetMedianTimePast())
+	}
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnableReplayProtection != 0 {
+		t.Errorf("replay protection should not be enabled by the activation, mtp: %d", after.GetMedianTimePast())
+	}
+
+	after = buildChain(model.ActiveNetParams.GravitonActivationTime)
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnableSchnorrMultisig == 0 {
+		t.Errorf("schnorr multisig should be enabled after activation, mtp: %d", after.GetMedianTimePast())
+	}
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptVerifyMinmalData == 0 {
+		t.Errorf("minimal data should be enforced after activation, mtp: %d", after.GetMedianTimePast())
+	}
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnableNativeIntrospection != 0 {
+		t.Errorf("native introspection should not be enabled before activation, mtp: %d", after.GetMedianTimePast())
+	}
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnforceSigChecks != 0 {
+		t.Errorf("sigchecks should not be enforced before activation, mtp: %d", after.GetMedianTimePast())
+	}
+
+	after = buildChain(model.ActiveNetParams.PhononActivationTime)
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnableOpReverseBytes == 0 {
+		t.Errorf("OP_REVERSEBYTES should be enabled after activation, mtp: %d", after.GetMedianTimePast())
+	}
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnforceSigChecks == 0 {
+		t.Errorf("sigchecks should be enforced after activation, mtp: %d", after.GetMedianTimePast())
+	}
+
+	after = buildChain(model.ActiveNetParams.Upgrade8ActivationTime)
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnable64BitIntegers == 0 {
+		t.Errorf("64-bit integers should be enabled after activation, mtp: %d", after.GetMedianTimePast())
+	}
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnableNativeIntrospection == 0 {
+		t.Errorf("native introspection should be enabled after activation, mtp: %d", after.GetMedianTimePast())
+	}
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnableTokens != 0 {
+		t.Errorf("tokens should not be enabled before activation, mtp: %d", after.GetMedianTimePast())
+	}
+
+	after = buildChain(model.ActiveNetParams.Upgrade9ActivationTime)
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnableTokens == 0 {
+		t.Errorf("tokens should be enabled after activation, mtp: %d", after.GetMedianTimePast())
+	}
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnableReplayProtection != 0 {
+		t.Errorf("replay protection should not be enabled before activation, mtp: %d", after.GetMedianTimePast())
+	}
+
+	after = buildChain(model.ActiveNetParams.ReplayProtectionActivationTime)
+	if flag := testChain.GetBlockScriptFlags(after); flag&script.ScriptEnableReplayProtection == 0 {
+		t.Errorf("replay protection should be enabled after activation, mtp: %d", after.GetMedianTimePast())
+	}
+}
+
 func TestBuildForwardTree(t *testing.T) {
 	globalChain = nil
 	InitGlobalChain()
@@ -370,3 +461,74 @@ func TestBuildForwardTree(t *testing.T) {
 		t.Errorf("height 10 should not have any son, but now have:%v", height11Slice)
 	}
 }
+
+func TestGetBlockIndexesInFile(t *testing.T) {
+	globalChain = nil
+	InitGlobalChain()
+	testChain := GetInstance()
+	testChain.indexMap = make(map[util.Hash]*blockindex.BlockIndex)
+	initBits := model.ActiveNetParams.PowLimitBits
+	timePerBlock := int64(model.ActiveNetParams.TargetTimePerBlock)
+
+	blockIdx := make([]*blockindex.BlockIndex, 6)
+	blockIdx[0] = blockindex.NewBlockIndex(&model.ActiveNetParams.GenesisBlock.Header)
+	testChain.AddToIndexMap(blockIdx[0])
+	for height := 1; height < len(blockIdx); height++ {
+		blockIdx[height] = getBlockIndex(blockIdx[height-1], timePerBlock, initBits)
+		testChain.AddToIndexMap(blockIdx[height])
+	}
+	for height, bi := range blockIdx[:5] {
+		bi.File = int32(height / 2)
+		bi.AddStatus(blockindex.BlockHaveData)
+	}
+	// only the header of the last block is known
+	blockIdx[5].File = 2
+
+	indexes := testChain.GetBlockIndexesInFile(1)
+	if len(indexes) != 2 {
+		t.Fatalf("block number in file 1 wrong, expect 2, actual:%d", len(indexes))
+	}
+	for _, bi := range indexes {
+		if bi != blockIdx[2] && bi != blockIdx[3] {
+			t.Errorf("unexpected block at height %d in file 1", bi.Height)
+		}
+	}
+	if indexes := testChain.GetBlockIndexesInFile(2); len(indexes) != 1 || indexes[0] != blockIdx[4] {
+		t.Errorf("file 2 should only hold the block at height 4, actual:%v", indexes)
+	}
+	if indexes := testChain.GetBlockIndexesInFile(3); len(indexes) != 0 {
+		t.Errorf("file 3 should be empty, actual:%v", indexes)
+	}
+}
+
+func TestFindEarliestAtLeast(t *testing.T) {
+	globalChain = nil
+	InitGlobalChain()
+	testChain := GetInstance()
+	testChain.indexMap = make(map[util.Hash]*blockindex.BlockIndex)
+	initBits := model.ActiveNetParams.PowLimitBits
+	timePerBlock := int64(model.ActiveNetParams.TargetTimePerBlock)
+
+	blockIdx := make([]*blockindex.BlockIndex, 10)
+	blockIdx[0] = blockindex.NewBlockIndex(&model.ActiveNetParams.GenesisBlock.Header)
+	testChain.AddToIndexMap(blockIdx[0])
+	for height := 1; height < len(blockIdx); height++ {
+		blockIdx[height] = getBlockIndex(blockIdx[height-1], timePerBlock, initBits)
+		testChain.AddToIndexMap(blockIdx[height])
+	}
+	testChain.SetTip(blockIdx[9])
+
+	genesisTime := int64(blockIdx[0].Header.Time)
+	if bi := testChain.FindEarliestAtLeast(0); bi != blockIdx[0] {
+		t.Errorf("expect the genesis block, actual:%v", bi)
+	}
+	if bi := testChain.FindEarliestAtLeast(genesisTime + 3*timePerBlock); bi != blockIdx[3] {
+		t.Errorf("expect the block at height 3, actual:%v", bi)
+	}
+	if bi := testChain.FindEarliestAtLeast(genesisTime + 3*timePerBlock + 1); bi != blockIdx[4] {
+		t.Errorf("expect the block at height 4, actual:%v", bi)
+	}
+	if bi := testChain.FindEarliestAtLeast(genesisTime + 9*timePerBlock + 1); bi != nil {
+		t.Errorf("expect no block after the tip, actual:%v", bi)
+	}
+}
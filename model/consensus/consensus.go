@@ -21,11 +21,25 @@ const (
 	/*MaxTxSigOpsCount allowed number of signature check operations per transaction. */
 	MaxTxSigOpsCount = 20000
 
+	// MaxTxSigChecks The maximum number of SigChecks allowed in a transaction
+	// since the May 2020 upgrade (network rule)
+	MaxTxSigChecks = 3000
+
+	// BlockMaxBytesMaxSigChecksRatio The ratio between the maximum allowable
+	// block size and the maximum number of SigChecks in a block (network rule)
+	BlockMaxBytesMaxSigChecksRatio = 141
+
 	// CoinbaseMaturity means Coinbase transaction outputs can only be spent after this number of new
 	// blocks (network rule)
 	CoinbaseMaturity = 100
 
-	MinTxSize = 100
+	// MinTxSizeMagneticAnomaly The minimum size of a transaction since the Nov
+	// 2018 upgrade (network rule)
+	MinTxSizeMagneticAnomaly = 100
+
+	// MinTxSizeUpgrade9 The minimum size of a transaction since the May 2023
+	// upgrade (network rule)
+	MinTxSizeUpgrade9 = 65
 )
 
 const (
@@ -48,3 +62,10 @@ func GetMaxBlockSigOpsCount(blockSize uint64) (uint64, error) {
 	roundedUp := 1 + ((blockSize - 1) / OneMegaByte)
 	return roundedUp * MaxBlockSigopsPerMb, nil
 }
+
+// GetMaxBlockSigChecksCount Compute the maximum number of SigChecks that can be
+// contained in a block given the maximum block size as parameter. Unlike the
+// sigops limit, it depends on the size limit and not on the size of the block.
+func GetMaxBlockSigChecksCount(maxBlockSize uint64) uint64 {
+	return maxBlockSize / BlockMaxBytesMaxSigChecksRatio
+}
@@ -28,6 +28,15 @@ type BIP9Deployment struct {
 	Timeout int64
 }
 
+// ASERTAnchor describes the block ASERT computes targets relative to. Networks
+// that already activated the Nov 2020 upgrade pin it, so that the anchor does
+// not have to be searched for.
+type ASERTAnchor struct {
+	Height        int32
+	Bits          uint32
+	PrevBlockTime int64
+}
+
 type Param struct {
 	GenesisHash            *util.Hash
 	SubsidyHalvingInterval int
@@ -48,13 +57,28 @@ type Param struct {
 	// Block height at which the new DAA becomes active
 	DAAHeight int32
 
-	// Unix time used for MTP activation of May 15 2018, hardfork
-	MonolithActivationTime int64
-
 	// Unix time used for MTP activation of Nov 15 2018, hardfork
 	MagneticAnomalyActivationTime int64
 	// Unix time used for MTP activation of 15 May 2019 12:00:00 UTC upgrade */
 	GreatWallActivationTime int64
+	// Unix time used for MTP activation of 15 Nov 2019 12:00:00 UTC upgrade
+	GravitonActivationTime int64
+	// Unix time used for MTP activation of 15 May 2020 12:00:00 UTC upgrade
+	PhononActivationTime int64
+	// Unix time used for MTP activation of 15 Nov 2020 12:00:00 UTC upgrade
+	AxionActivationTime int64
+	// Unix time used for MTP activation of 15 May 2022 12:00:00 UTC upgrade
+	Upgrade8ActivationTime int64
+	// Unix time used for MTP activation of 15 May 2023 12:00:00 UTC upgrade
+	Upgrade9ActivationTime int64
+	// Unix time used for MTP activation of the replay protection, which
+	// changes the fork id of signatures ahead of a future upgrade
+	ReplayProtectionActivationTime int64
+
+	// Half-life in seconds of the ASERT difficulty adjustment algorithm
+	ASERTHalfLife int64
+	// Anchor block of ASERT, nil means it is located by walking back the chain
+	ASERTAnchor *ASERTAnchor
 
 	// Minimum blocks including miner confirmation of the total of 2016 blocks
 	// in a retargeting period, (nPowTargetTimespan / nPowTargetSpacing) which
@@ -87,3 +111,17 @@ type Param struct {
 func (pm *Param) DifficultyAdjustmentInterval() int64 {
 	return int64(pm.TargetTimespan / pm.TargetTimePerBlock)
 }
+
+// MinTxSize returns the minimum serialized size of a transaction in a block
+// whose previous block has the median time past medianTimePast. There is no
+// minimum before the Nov 2018 upgrade.
+func (pm *Param) MinTxSize(medianTimePast int64) int {
+	switch {
+	case medianTimePast >= pm.Upgrade9ActivationTime:
+		return MinTxSizeUpgrade9
+	case medianTimePast >= pm.MagneticAnomalyActivationTime:
+		return MinTxSizeMagneticAnomaly
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,31 @@
+package consensus
+
+import (
+	"testing"
+)
+
+func TestParamMinTxSize(t *testing.T) {
+	param := &Param{
+		MagneticAnomalyActivationTime: 1542300000,
+		Upgrade9ActivationTime:        1684152000,
+	}
+
+	tests := []struct {
+		medianTimePast int64
+		exp            int
+	}{
+		{0, 0},
+		{1542300000 - 1, 0},
+		{1542300000, MinTxSizeMagneticAnomaly},
+		{1684152000 - 1, MinTxSizeMagneticAnomaly},
+		{1684152000, MinTxSizeUpgrade9},
+		{1684152000 + 1, MinTxSizeUpgrade9},
+	}
+
+	for _, test := range tests {
+		actual := param.MinTxSize(test.medianTimePast)
+		if actual != test.exp {
+			t.Errorf("Test MinTxSize(%d) err! Expected %d, Actual is %d", test.medianTimePast, test.exp, actual)
+		}
+	}
+}
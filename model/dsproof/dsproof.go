@@ -0,0 +1,321 @@
+// Package dsproof implements the double spend proofs (dsproof-beta) of Bitcoin
+// Cash.  A proof shows that a coin was spent by two transactions, with the
+// parts of both transactions covered by their signatures, so that it can be
+// checked by a node knowing only one of the transactions.
+package dsproof
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/copernet/copernicus/crypto"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/util"
+)
+
+// MaxPushDataSize is the maximum size of a signature of a proof.
+const MaxPushDataSize = script.MaxScriptElementSize
+
+var (
+	// ErrNoSignature means a spender of a proof has no signature, or a
+	// transaction has no signature for the double spent coin.
+	ErrNoSignature = errors.New("no signature")
+
+	// ErrTooManyPushData means a spender of a proof has more than one push
+	// data.  Only the coins spent with a single signature are supported.
+	ErrTooManyPushData = errors.New("too many push data")
+
+	// ErrNoForkID means a signature does not commit to the Bitcoin Cash
+	// fork id.
+	ErrNoForkID = errors.New("signature without fork id")
+
+	// ErrNotCanonical means the spenders of a proof are equal or not
+	// ordered.
+	ErrNotCanonical = errors.New("spenders not in canonical order")
+
+	// ErrSigHashUtxos means a signature signs the outputs spent by all the
+	// inputs, which a proof does not hold.
+	ErrSigHashUtxos = errors.New("signature with SigHashUtxos")
+)
+
+// Spender holds the parts of a transaction spending the double spent coin
+// which are signed with the fork id sighash algorithm, along with the
+// signature.
+type Spender struct {
+	TxVersion       uint32
+	OutSequence     uint32
+	LockTime        uint32
+	HashPrevOutputs util.Hash
+	HashSequence    util.Hash
+	HashOutputs     util.Hash
+	// PushData holds the signature with its hash type.
+	PushData [][]byte
+}
+
+// DSProof proves that the coin PrevTxID:PrevOutIndex is spent by two
+// transactions.
+type DSProof struct {
+	PrevTxID     util.Hash
+	PrevOutIndex uint32
+	Spender1     Spender
+	Spender2     Spender
+}
+
+// NewDSProof builds the proof of the double spend of the coin out by txA and
+// txB, which have to spend it with a fork id signature as first push of the
+// scriptSig.  The spenders are ordered, so that both transactions give the
+// same proof whatever their order.
+func NewDSProof(txA, txB *tx.Tx, out *outpoint.OutPoint) (*DSProof, error) {
+	spenderA, err := newSpender(txA, out)
+	if err != nil {
+		return nil, err
+	}
+	spenderB, err := newSpender(txB, out)
+	if err != nil {
+		return nil, err
+	}
+
+	proof := &DSProof{
+		PrevTxID:     out.Hash,
+		PrevOutIndex: out.Index,
+		Spender1:     *spenderA,
+		Spender2:     *spenderB,
+	}
+	if spenderB.less(spenderA) {
+		proof.Spender1, proof.Spender2 = *spenderB, *spenderA
+	}
+	if err := proof.CheckSanity(); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+func newSpender(txn *tx.Tx, out *outpoint.OutPoint) (*Spender, error) {
+	nIn := -1
+	for i, in := range txn.GetIns() {
+		if *in.PreviousOutPoint == *out {
+			nIn = i
+			break
+		}
+	}
+	if nIn < 0 {
+		return nil, fmt.Errorf("transaction %s does not spend %s", txn.GetHash(), out)
+	}
+
+	in := txn.GetIns()[nIn]
+	scriptSig := in.GetScriptSig()
+	if scriptSig == nil || !scriptSig.IsPushOnly() || len(scriptSig.ParsedOpCodes) == 0 ||
+		len(scriptSig.ParsedOpCodes[0].Data) == 0 {
+		return nil, ErrNoSignature
+	}
+	sig := scriptSig.ParsedOpCodes[0].Data
+	hashType := uint32(sig[len(sig)-1])
+	if hashType&crypto.SigHashForkID == 0 {
+		return nil, ErrNoForkID
+	}
+	if hashType&crypto.SigHashUtxos != 0 {
+		return nil, ErrSigHashUtxos
+	}
+
+	spender := &Spender{
+		TxVersion:   uint32(txn.GetVersion()),
+		OutSequence: in.Sequence,
+		LockTime:    txn.GetLockTime(),
+		PushData:    [][]byte{append([]byte(nil), sig...)},
+	}
+	anyoneCanPay := hashType&crypto.SigHashAnyoneCanpay != 0
+	baseType := hashType & crypto.SigHashMask
+	if !anyoneCanPay {
+		spender.HashPrevOutputs = tx.GetPreviousOutHash(txn)
+	}
+	if !anyoneCanPay && baseType != crypto.SigHashSingle && baseType != crypto.SigHashNone {
+		spender.HashSequence = tx.GetSequenceHash(txn)
+	}
+	var err error
+	if baseType != crypto.SigHashSingle && baseType != crypto.SigHashNone {
+		spender.HashOutputs, err = tx.GetOutputsHash(txn.GetOuts())
+	} else if baseType == crypto.SigHashSingle && nIn < len(txn.GetOuts()) {
+		spender.HashOutputs, err = tx.GetOutputsHash(txn.GetOuts()[nIn : nIn+1])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return spender, nil
+}
+
+// less orders the spenders by their hash of outputs, then by their hash of
+// previous outputs.
+func (s *Spender) less(other *Spender) bool {
+	if c := bytes.Compare(s.HashOutputs[:], other.HashOutputs[:]); c != 0 {
+		return c < 0
+	}
+	return bytes.Compare(s.HashPrevOutputs[:], other.HashPrevOutputs[:]) < 0
+}
+
+// HashType returns the sighash type of the signature of the spender.
+func (s *Spender) HashType() uint32 {
+	if len(s.PushData) == 0 || len(s.PushData[0]) == 0 {
+		return 0
+	}
+	sig := s.PushData[0]
+	return uint32(sig[len(sig)-1])
+}
+
+// Signature returns the signature of the spender without its hash type.
+func (s *Spender) Signature() []byte {
+	if len(s.PushData) == 0 || len(s.PushData[0]) == 0 {
+		return nil
+	}
+	sig := s.PushData[0]
+	return sig[:len(sig)-1]
+}
+
+// SignatureHash returns the hash signed by the spender of the coin out, the
+// output spent, with scriptCode, as computed by tx.SignatureHash with the fork
+// id.
+func (s *Spender) SignatureHash(out *outpoint.OutPoint, scriptCode *script.Script,
+	spent *txout.TxOut) (util.Hash, error) {
+
+	hashType := s.HashType()
+	if hashType&crypto.SigHashForkID == 0 {
+		return util.Hash{}, ErrNoForkID
+	}
+	if hashType&crypto.SigHashUtxos != 0 {
+		return util.Hash{}, ErrSigHashUtxos
+	}
+
+	preimage := &tx.ForkIDPreimage{
+		TxVersion:       s.TxVersion,
+		HashPrevOutputs: s.HashPrevOutputs,
+		HashSequence:    s.HashSequence,
+		OutPoint:        out,
+		TokenData:       spent.GetTokenData(),
+		ScriptCode:      scriptCode,
+		Value:           spent.GetValue(),
+		Sequence:        s.OutSequence,
+		HashOutputs:     s.HashOutputs,
+		LockTime:        s.LockTime,
+		HashType:        hashType,
+	}
+	return preimage.Hash()
+}
+
+// OutPoint returns the double spent coin.
+func (p *DSProof) OutPoint() *outpoint.OutPoint {
+	return outpoint.NewOutPoint(p.PrevTxID, p.PrevOutIndex)
+}
+
+// CheckSanity checks that both spenders have a single fork id signature and
+// are in canonical order.
+func (p *DSProof) CheckSanity() error {
+	for _, s := range []*Spender{&p.Spender1, &p.Spender2} {
+		if len(s.PushData) == 0 || len(s.PushData[0]) == 0 {
+			return ErrNoSignature
+		}
+		if len(s.PushData) > 1 {
+			return ErrTooManyPushData
+		}
+		if len(s.PushData[0]) > MaxPushDataSize {
+			return fmt.Errorf("signature of %d bytes is too large", len(s.PushData[0]))
+		}
+		if s.HashType()&crypto.SigHashForkID == 0 {
+			return ErrNoForkID
+		}
+		if s.HashType()&crypto.SigHashUtxos != 0 {
+			return ErrSigHashUtxos
+		}
+	}
+	if !p.Spender1.less(&p.Spender2) {
+		return ErrNotCanonical
+	}
+	return nil
+}
+
+// GetHash returns the identifier of the proof, the double sha256 of its
+// serialization.
+func (p *DSProof) GetHash() util.Hash {
+	buf := bytes.NewBuffer(make([]byte, 0, p.SerializeSize()))
+	p.Serialize(buf)
+	return util.DoubleSha256Hash(buf.Bytes())
+}
+
+// SerializeSize returns the number of bytes of the serialized proof.
+func (p *DSProof) SerializeSize() int {
+	return util.Hash256Size + 4 + p.Spender1.serializeSize() + p.Spender2.serializeSize()
+}
+
+// Serialize encodes the proof as in dsproof-beta messages.
+func (p *DSProof) Serialize(w io.Writer) error {
+	if err := util.WriteElements(w, &p.PrevTxID, p.PrevOutIndex); err != nil {
+		return err
+	}
+	if err := p.Spender1.serialize(w); err != nil {
+		return err
+	}
+	return p.Spender2.serialize(w)
+}
+
+// Unserialize decodes a proof encoded by Serialize.
+func (p *DSProof) Unserialize(r io.Reader) error {
+	if err := util.ReadElements(r, &p.PrevTxID, &p.PrevOutIndex); err != nil {
+		return err
+	}
+	if err := p.Spender1.unserialize(r); err != nil {
+		return err
+	}
+	return p.Spender2.unserialize(r)
+}
+
+func (s *Spender) serializeSize() int {
+	n := 3*4 + 3*util.Hash256Size + int(util.VarIntSerializeSize(uint64(len(s.PushData))))
+	for _, data := range s.PushData {
+		n += int(util.VarIntSerializeSize(uint64(len(data)))) + len(data)
+	}
+	return n
+}
+
+func (s *Spender) serialize(w io.Writer) error {
+	err := util.WriteElements(w, s.TxVersion, s.OutSequence, s.LockTime,
+		&s.HashPrevOutputs, &s.HashSequence, &s.HashOutputs)
+	if err != nil {
+		return err
+	}
+	if err := util.WriteVarInt(w, uint64(len(s.PushData))); err != nil {
+		return err
+	}
+	for _, data := range s.PushData {
+		if err := util.WriteVarBytes(w, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Spender) unserialize(r io.Reader) error {
+	err := util.ReadElements(r, &s.TxVersion, &s.OutSequence, &s.LockTime,
+		&s.HashPrevOutputs, &s.HashSequence, &s.HashOutputs)
+	if err != nil {
+		return err
+	}
+	count, err := util.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+	if count > 1 {
+		return ErrTooManyPushData
+	}
+	s.PushData = make([][]byte, 0, count)
+	for i := uint64(0); i < count; i++ {
+		data, err := util.ReadVarBytes(r, MaxPushDataSize, "dsproof push data")
+		if err != nil {
+			return err
+		}
+		s.PushData = append(s.PushData, data)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package dsproof
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/copernet/copernicus/crypto"
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/amount"
+)
+
+const testValue = amount.Amount(100000)
+
+func p2pkhScript(pubKey []byte) *script.Script {
+	s := script.NewEmptyScript()
+	s.PushOpCode(opcodes.OP_DUP)
+	s.PushOpCode(opcodes.OP_HASH160)
+	s.PushSingleData(util.Hash160(pubKey))
+	s.PushOpCode(opcodes.OP_EQUALVERIFY)
+	s.PushOpCode(opcodes.OP_CHECKSIG)
+	return s
+}
+
+// signedSpend returns a transaction spending the coin out, paid to the public
+// key hash of privateKey, with a signature of hashType.
+func signedSpend(t *testing.T, privateKey *crypto.PrivateKey, out *outpoint.OutPoint,
+	value amount.Amount, hashType uint32) *tx.Tx {
+
+	pubKey := privateKey.PubKey().ToBytes()
+	txn := tx.NewTx(0, tx.TxVersion)
+	txn.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(util.HashZero, 7), script.NewEmptyScript(), script.SequenceFinal))
+	txn.AddTxIn(txin.NewTxIn(out, script.NewEmptyScript(), script.SequenceFinal-1))
+	txn.AddTxOut(txout.NewTxOut(value, script.NewScriptRaw([]byte{opcodes.OP_TRUE})))
+
+	hash, err := tx.SignatureHash(txn, p2pkhScript(pubKey), hashType, 1, testValue,
+		script.ScriptEnableSigHashForkID, nil)
+	if err != nil {
+		t.Fatalf("SignatureHash: %v", err)
+	}
+	sig, err := privateKey.Sign(hash.GetCloneBytes())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	scriptSig := script.NewEmptyScript()
+	scriptSig.PushSingleData(append(sig.Serialize(), byte(hashType)))
+	scriptSig.PushSingleData(pubKey)
+	txn.GetIns()[1].SetScriptSig(scriptSig)
+	return txn
+}
+
+func TestDSProof(t *testing.T) {
+	crypto.InitSecp256()
+	privateKey, err := crypto.DecodePrivateKey("L4rK1yDtCWekvXuE6oXD9jCYfFNV2cWRpVuPLBcCU2z8TrisoyY1")
+	if err != nil {
+		t.Fatalf("DecodePrivateKey: %v", err)
+	}
+	pubKey := privateKey.PubKey().ToBytes()
+	out := outpoint.NewOutPoint(util.HashOne, 1)
+
+	txA := signedSpend(t, privateKey, out, 90000, crypto.SigHashAll|crypto.SigHashForkID)
+	txB := signedSpend(t, privateKey, out, 80000,
+		crypto.SigHashSingle|crypto.SigHashAnyoneCanpay|crypto.SigHashForkID)
+
+	proof, err := NewDSProof(txA, txB, out)
+	if err != nil {
+		t.Fatalf("NewDSProof: %v", err)
+	}
+	if proof.PrevTxID != out.Hash || proof.PrevOutIndex != out.Index {
+		t.Errorf("wrong coin %s", proof.OutPoint())
+	}
+	// The proof does not depend on the order of the transactions.
+	swapped, err := NewDSProof(txB, txA, out)
+	if err != nil {
+		t.Fatalf("NewDSProof: %v", err)
+	}
+	if !reflect.DeepEqual(proof, swapped) {
+		t.Errorf("proofs of swapped transactions differ")
+	}
+
+	// Both signatures are valid for the rebuilt signature hashes.
+	for i, s := range []*Spender{&proof.Spender1, &proof.Spender2} {
+		hash, err := s.SignatureHash(out, p2pkhScript(pubKey), txout.NewTxOut(testValue, p2pkhScript(pubKey)))
+		if err != nil {
+			t.Fatalf("SignatureHash of spender #%d: %v", i+1, err)
+		}
+		if !tx.CheckSig(hash, s.Signature(), pubKey) {
+			t.Errorf("invalid signature of spender #%d", i+1)
+		}
+		other := txout.NewTxOut(testValue+1, p2pkhScript(pubKey))
+		if hash, _ := s.SignatureHash(out, p2pkhScript(pubKey), other); tx.CheckSig(hash, s.Signature(), pubKey) {
+			t.Errorf("signature of spender #%d valid for another amount", i+1)
+		}
+	}
+	var anyoneCanPay *Spender
+	for _, s := range []*Spender{&proof.Spender1, &proof.Spender2} {
+		if s.HashType()&crypto.SigHashAnyoneCanpay != 0 {
+			anyoneCanPay = s
+		}
+	}
+	if anyoneCanPay == nil || anyoneCanPay.HashPrevOutputs != (util.Hash{}) ||
+		anyoneCanPay.HashSequence != (util.Hash{}) || anyoneCanPay.OutSequence != script.SequenceFinal-1 {
+		t.Errorf("wrong spender of the anyone can pay signature: %v", anyoneCanPay)
+	}
+
+	var buf bytes.Buffer
+	if err := proof.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	if buf.Len() != proof.SerializeSize() {
+		t.Errorf("SerializeSize: got %d, want %d", proof.SerializeSize(), buf.Len())
+	}
+	var decoded DSProof
+	if err := decoded.Unserialize(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Unserialize: %v", err)
+	}
+	if !reflect.DeepEqual(proof, &decoded) || decoded.GetHash() != util.DoubleSha256Hash(buf.Bytes()) {
+		t.Errorf("Unserialize: proof mismatch")
+	}
+}
+
+func TestDSProofInvalid(t *testing.T) {
+	crypto.InitSecp256()
+	privateKey, err := crypto.DecodePrivateKey("L4rK1yDtCWekvXuE6oXD9jCYfFNV2cWRpVuPLBcCU2z8TrisoyY1")
+	if err != nil {
+		t.Fatalf("DecodePrivateKey: %v", err)
+	}
+	out := outpoint.NewOutPoint(util.HashOne, 1)
+	txA := signedSpend(t, privateKey, out, 90000, crypto.SigHashAll|crypto.SigHashForkID)
+	txB := signedSpend(t, privateKey, out, 80000, crypto.SigHashAll|crypto.SigHashForkID)
+
+	if _, err := NewDSProof(txA, txA, out); err != ErrNotCanonical {
+		t.Errorf("spenders of the same transaction: got %v, want %v", err, ErrNotCanonical)
+	}
+	if _, err := NewDSProof(txA, txB, outpoint.NewOutPoint(util.HashOne, 2)); err == nil {
+		t.Errorf("NewDSProof accepted a coin which is not spent")
+	}
+	legacy := signedSpend(t, privateKey, out, 70000, crypto.SigHashAll)
+	if _, err := NewDSProof(txA, legacy, out); err != ErrNoForkID {
+		t.Errorf("signature without fork id: got %v, want %v", err, ErrNoForkID)
+	}
+	utxos := signedSpend(t, privateKey, out, 60000, crypto.SigHashAll|crypto.SigHashForkID|crypto.SigHashUtxos)
+	if _, err := NewDSProof(txA, utxos, out); err != ErrSigHashUtxos {
+		t.Errorf("signature with SigHashUtxos: got %v, want %v", err, ErrSigHashUtxos)
+	}
+
+	proof, err := NewDSProof(txA, txB, out)
+	if err != nil {
+		t.Fatalf("NewDSProof: %v", err)
+	}
+	swapped := *proof
+	swapped.Spender1, swapped.Spender2 = proof.Spender2, proof.Spender1
+	if err := swapped.CheckSanity(); err != ErrNotCanonical {
+		t.Errorf("swapped spenders: got %v, want %v", err, ErrNotCanonical)
+	}
+	noSig := *proof
+	noSig.Spender2.PushData = nil
+	if err := noSig.CheckSanity(); err != ErrNoSignature {
+		t.Errorf("spender without signature: got %v, want %v", err, ErrNoSignature)
+	}
+}
@@ -0,0 +1,131 @@
+package mempool
+
+import (
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/util"
+)
+
+// AddressDelta is a change of the balance of a scriptPubKey made by a
+// transaction of the mempool. The scriptPubKey is known by its sha256 hash,
+// as in the address index of the chain.
+type AddressDelta struct {
+	ScriptHash util.Hash
+	TxHash     util.Hash
+	// Index is the output created, or the input spending a coin.
+	Index    uint32
+	Spending bool
+	// Amount is negative when a coin is spent.
+	Amount int64
+	Time   int64
+	// PrevOut is the coin spent by a spending delta.
+	PrevOut outpoint.OutPoint
+}
+
+// addressIndex tracks the balance changes of the mempool transactions by
+// scriptPubKey.
+type addressIndex struct {
+	deltas map[util.Hash][]*AddressDelta
+	// scripts are the scriptPubKey hashes touched by each transaction.
+	scripts map[util.Hash][]util.Hash
+}
+
+// EnableAddressIndex makes the mempool track the balance changes of its
+// transactions, which are returned by GetAddressDeltas.
+func (m *TxMempool) EnableAddressIndex() {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.addrIndex != nil {
+		return
+	}
+	m.addrIndex = &addressIndex{
+		deltas:  make(map[util.Hash][]*AddressDelta),
+		scripts: make(map[util.Hash][]util.Hash),
+	}
+	for _, entry := range m.poolData {
+		m.addAddressIndex(entry)
+	}
+}
+
+// GetAddressDeltas returns the balance changes made by the mempool
+// transactions to the scriptPubKeys hashed to scriptHashes.
+func (m *TxMempool) GetAddressDeltas(scriptHashes []util.Hash) []AddressDelta {
+	m.RLock()
+	defer m.RUnlock()
+
+	if m.addrIndex == nil {
+		return nil
+	}
+	var deltas []AddressDelta
+	for i := range scriptHashes {
+		for _, delta := range m.addrIndex.deltas[scriptHashes[i]] {
+			deltas = append(deltas, *delta)
+		}
+	}
+	return deltas
+}
+
+// addAddressIndex records the balance changes of a new entry. The spent
+// coins are looked up in the mempool first, then in the UTXO set.
+func (m *TxMempool) addAddressIndex(entry *TxEntry) {
+	txid := entry.Tx.GetHash()
+	touched := make(map[util.Hash]struct{})
+	add := func(delta *AddressDelta) {
+		m.addrIndex.deltas[delta.ScriptHash] = append(m.addrIndex.deltas[delta.ScriptHash], delta)
+		if _, ok := touched[delta.ScriptHash]; !ok {
+			touched[delta.ScriptHash] = struct{}{}
+			m.addrIndex.scripts[txid] = append(m.addrIndex.scripts[txid], delta.ScriptHash)
+		}
+	}
+
+	for i, in := range entry.Tx.GetIns() {
+		coin := m.GetCoin(in.PreviousOutPoint)
+		if coin == nil {
+			coin = utxo.GetUtxoCacheInstance().GetCoin(in.PreviousOutPoint)
+		}
+		if coin == nil || coin.IsSpent() {
+			continue
+		}
+		add(&AddressDelta{
+			ScriptHash: util.Sha256Hash(coin.GetScriptPubKey().GetData()),
+			TxHash:     txid,
+			Index:      uint32(i),
+			Spending:   true,
+			Amount:     -int64(coin.GetAmount()),
+			Time:       entry.time,
+			PrevOut:    *in.PreviousOutPoint,
+		})
+	}
+	for i, out := range entry.Tx.GetOuts() {
+		if !out.IsSpendable() {
+			continue
+		}
+		add(&AddressDelta{
+			ScriptHash: util.Sha256Hash(out.GetScriptPubKey().GetData()),
+			TxHash:     txid,
+			Index:      uint32(i),
+			Amount:     int64(out.GetValue()),
+			Time:       entry.time,
+		})
+	}
+}
+
+// removeAddressIndex forgets the balance changes of a removed transaction.
+func (m *TxMempool) removeAddressIndex(txid util.Hash) {
+	for _, scriptHash := range m.addrIndex.scripts[txid] {
+		deltas := m.addrIndex.deltas[scriptHash]
+		kept := deltas[:0]
+		for _, delta := range deltas {
+			if delta.TxHash != txid {
+				kept = append(kept, delta)
+			}
+		}
+		if len(kept) == 0 {
+			delete(m.addrIndex.deltas, scriptHash)
+		} else {
+			m.addrIndex.deltas[scriptHash] = kept
+		}
+	}
+	delete(m.addrIndex.scripts, txid)
+}
@@ -0,0 +1,64 @@
+package mempool
+
+import (
+	"testing"
+
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/amount"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMempoolAddressIndex(t *testing.T) {
+	scriptSig := script.NewEmptyScript()
+	scriptSig.PushOpCode(opcodes.OP_11)
+	scriptA := script.NewEmptyScript()
+	scriptA.PushOpCode(opcodes.OP_TRUE)
+	scriptB := script.NewEmptyScript()
+	scriptB.PushOpCode(opcodes.OP_2)
+	hashA := util.Sha256Hash(scriptA.GetData())
+	hashB := util.Sha256Hash(scriptB.GetData())
+
+	txParent := tx.NewTx(0, tx.TxVersion)
+	txParent.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(util.HashZero, 0), scriptSig, script.SequenceFinal))
+	txParent.AddTxOut(txout.NewTxOut(amount.Amount(30000), scriptA))
+	txParent.AddTxOut(txout.NewTxOut(amount.Amount(20000), scriptB))
+
+	txChild := tx.NewTx(0, tx.TxVersion)
+	txChild.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(txParent.GetHash(), 0), scriptSig, script.SequenceFinal))
+	txChild.AddTxOut(txout.NewTxOut(amount.Amount(29000), scriptB))
+
+	pool := NewTxMempool()
+	pool.EnableAddressIndex()
+	entryHelp := NewTestMemPoolEntry()
+	// Entries older than the mempool expiry are removed when they are added.
+	now := util.GetTimeSec()
+	parentEntry := entryHelp.SetTime(now).FromTxToEntry(txParent)
+	assert.Nil(t, pool.AddTx(parentEntry, nil))
+	childEntry := entryHelp.SetTime(now + 1).FromTxToEntry(txChild)
+	assert.Nil(t, pool.AddTx(childEntry, map[*TxEntry]struct{}{parentEntry: {}}))
+
+	// The parent pays to both scripts, the child spends from A to B.
+	deltas := pool.GetAddressDeltas([]util.Hash{hashA})
+	if assert.Equal(t, 2, len(deltas)) {
+		assert.Equal(t, AddressDelta{ScriptHash: hashA, TxHash: txParent.GetHash(), Index: 0,
+			Amount: 30000, Time: now}, deltas[0])
+		assert.Equal(t, AddressDelta{ScriptHash: hashA, TxHash: txChild.GetHash(), Index: 0,
+			Spending: true, Amount: -30000, Time: now + 1, PrevOut: *outpoint.NewOutPoint(txParent.GetHash(), 0)}, deltas[1])
+	}
+	assert.Equal(t, 2, len(pool.GetAddressDeltas([]util.Hash{hashB})))
+	assert.Equal(t, 4, len(pool.GetAddressDeltas([]util.Hash{hashA, hashB})))
+
+	// The deltas of a removed transaction are forgotten.
+	pool.RemoveTxRecursive(txChild, UNKNOWN)
+	assert.Equal(t, 1, len(pool.GetAddressDeltas([]util.Hash{hashA})))
+	assert.Equal(t, 1, len(pool.GetAddressDeltas([]util.Hash{hashB})))
+	pool.RemoveTxRecursive(txParent, UNKNOWN)
+	assert.Equal(t, 0, len(pool.GetAddressDeltas([]util.Hash{hashA, hashB})))
+	assert.Equal(t, 0, len(pool.addrIndex.scripts))
+}
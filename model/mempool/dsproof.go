@@ -0,0 +1,112 @@
+package mempool
+
+import (
+	"github.com/copernet/copernicus/model/dsproof"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/util"
+)
+
+// DSProofEntry is a double spend proof along with the hash of the mempool
+// transaction spending its coin.
+type DSProofEntry struct {
+	Proof  *dsproof.DSProof
+	TxHash util.Hash
+}
+
+// AddDSProof records a double spend proof of a coin spent by a mempool
+// transaction.  It returns false when no transaction spends the coin or when
+// the coin already has a proof, as a single proof is enough to warn of the
+// double spend.  The proof is forgotten with the transaction.
+func (m *TxMempool) AddDSProof(proof *dsproof.DSProof) bool {
+	m.Lock()
+	defer m.Unlock()
+
+	out := proof.OutPoint()
+	if _, ok := m.nextTx[*out]; !ok {
+		return false
+	}
+	if _, ok := m.dsproofsByOut[*out]; ok {
+		return false
+	}
+	hash := proof.GetHash()
+	m.dsproofs[hash] = proof
+	m.dsproofsByOut[*out] = hash
+	return true
+}
+
+// GetDSProof returns the double spend proof with the hash, or nil.
+func (m *TxMempool) GetDSProof(hash util.Hash) *DSProofEntry {
+	m.RLock()
+	defer m.RUnlock()
+
+	proof, ok := m.dsproofs[hash]
+	if !ok {
+		return nil
+	}
+	return m.dsproofEntry(proof)
+}
+
+// GetDSProofByOutPoint returns the double spend proof of the coin out, or
+// nil.
+func (m *TxMempool) GetDSProofByOutPoint(out *outpoint.OutPoint) *DSProofEntry {
+	m.RLock()
+	defer m.RUnlock()
+
+	hash, ok := m.dsproofsByOut[*out]
+	if !ok {
+		return nil
+	}
+	return m.dsproofEntry(m.dsproofs[hash])
+}
+
+// GetDSProofByTx returns the double spend proof of a coin spent by the
+// mempool transaction with the hash, or nil.
+func (m *TxMempool) GetDSProofByTx(txHash util.Hash) *DSProofEntry {
+	m.RLock()
+	defer m.RUnlock()
+
+	entry, ok := m.poolData[txHash]
+	if !ok {
+		return nil
+	}
+	for _, in := range entry.Tx.GetIns() {
+		if hash, ok := m.dsproofsByOut[*in.PreviousOutPoint]; ok {
+			return m.dsproofEntry(m.dsproofs[hash])
+		}
+	}
+	return nil
+}
+
+// GetAllDSProofs returns the double spend proofs of the mempool.
+func (m *TxMempool) GetAllDSProofs() []*DSProofEntry {
+	m.RLock()
+	defer m.RUnlock()
+
+	entries := make([]*DSProofEntry, 0, len(m.dsproofs))
+	for _, proof := range m.dsproofs {
+		entries = append(entries, m.dsproofEntry(proof))
+	}
+	return entries
+}
+
+func (m *TxMempool) dsproofEntry(proof *dsproof.DSProof) *DSProofEntry {
+	entry := &DSProofEntry{Proof: proof}
+	if spender, ok := m.nextTx[*proof.OutPoint()]; ok {
+		entry.TxHash = spender.Tx.GetHash()
+	}
+	return entry
+}
+
+// removeDSProofs forgets the double spend proofs of the coins spent by a
+// removed entry.
+func (m *TxMempool) removeDSProofs(entry *TxEntry) {
+	if len(m.dsproofsByOut) == 0 {
+		return
+	}
+	for _, in := range entry.Tx.GetIns() {
+		if hash, ok := m.dsproofsByOut[*in.PreviousOutPoint]; ok {
+			delete(m.dsproofs, hash)
+			delete(m.dsproofsByOut, *in.PreviousOutPoint)
+		}
+	}
+}
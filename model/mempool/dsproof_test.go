@@ -0,0 +1,58 @@
+package mempool
+
+import (
+	"testing"
+
+	"github.com/copernet/copernicus/model/dsproof"
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/amount"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMempoolDSProofs(t *testing.T) {
+	scriptSig := script.NewEmptyScript()
+	scriptSig.PushOpCode(opcodes.OP_11)
+	out := outpoint.NewOutPoint(util.HashOne, 0)
+
+	txn := tx.NewTx(0, tx.TxVersion)
+	txn.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(util.HashOne, 1), scriptSig, script.SequenceFinal))
+	txn.AddTxIn(txin.NewTxIn(out, scriptSig, script.SequenceFinal))
+	txn.AddTxOut(txout.NewTxOut(amount.Amount(30000), scriptSig))
+
+	proof := &dsproof.DSProof{
+		PrevTxID:     out.Hash,
+		PrevOutIndex: out.Index,
+		Spender1:     dsproof.Spender{PushData: [][]byte{{0x30, 0x41}}},
+		Spender2:     dsproof.Spender{HashOutputs: util.HashOne, PushData: [][]byte{{0x30, 0x41}}},
+	}
+	other := *proof
+	other.Spender2.LockTime = 1
+
+	pool := NewTxMempool()
+	assert.False(t, pool.AddDSProof(proof), "no transaction spends the coin")
+
+	entry := NewTestMemPoolEntry().FromTxToEntry(txn)
+	assert.Nil(t, pool.AddTx(entry, nil))
+	assert.True(t, pool.AddDSProof(proof))
+	assert.False(t, pool.AddDSProof(&other), "the coin already has a proof")
+
+	want := &DSProofEntry{Proof: proof, TxHash: txn.GetHash()}
+	assert.Equal(t, want, pool.GetDSProof(proof.GetHash()))
+	assert.Nil(t, pool.GetDSProof(other.GetHash()))
+	assert.Equal(t, want, pool.GetDSProofByOutPoint(out))
+	assert.Nil(t, pool.GetDSProofByOutPoint(outpoint.NewOutPoint(util.HashOne, 1)))
+	assert.Equal(t, want, pool.GetDSProofByTx(txn.GetHash()))
+	assert.Equal(t, []*DSProofEntry{want}, pool.GetAllDSProofs())
+
+	// The proof is forgotten with the transaction.
+	pool.RemoveTxRecursive(txn, UNKNOWN)
+	assert.Nil(t, pool.GetDSProof(proof.GetHash()))
+	assert.Nil(t, pool.GetDSProofByOutPoint(out))
+	assert.Equal(t, 0, len(pool.GetAllDSProofs()))
+}
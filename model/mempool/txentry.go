@@ -17,6 +17,9 @@ type TxEntry struct {
 	TxHeight int32
 	// sigOpCount sigop plus P2SH sigops count
 	SigOpCount int
+	// SigChecks the SigChecks executed by the scripts of the inputs, which
+	// limit the block instead of the sigops since the May 2020 upgrade
+	SigChecks int
 	// time Local time when entering the memPool
 	time int64
 	// usageSize and total memory usage;
@@ -45,6 +48,7 @@ type StatisInformation struct {
 	SumTxCountWithAncestors      int64
 	SumTxSizeWitAncestors        int64
 	SumTxSigOpCountWithAncestors int64
+	SumTxSigChecksWithAncestors  int64
 	SumTxFeeWithAncestors        int64
 }
 
@@ -52,6 +56,10 @@ func (t *TxEntry) GetSigOpCountWithAncestors() int64 {
 	return t.SumTxSigOpCountWithAncestors
 }
 
+func (t *TxEntry) GetSigChecksWithAncestors() int64 {
+	return t.SumTxSigChecksWithAncestors
+}
+
 func (t *TxEntry) GetUsageSize() int64 {
 	return int64(t.usageSize)
 }
@@ -106,10 +114,11 @@ func (t *TxEntry) UpdateDescendantState(updateCount, updateSize int, updateFee i
 	t.SumTxFeeWithDescendants += updateFee
 }
 
-func (t *TxEntry) UpdateAncestorState(updateCount, updateSize, updateSigOps int, updateFee int64) {
+func (t *TxEntry) UpdateAncestorState(updateCount, updateSize, updateSigOps, updateSigChecks int, updateFee int64) {
 	t.SumTxSizeWitAncestors += int64(updateSize)
 	t.SumTxCountWithAncestors += int64(updateCount)
 	t.SumTxSigOpCountWithAncestors += int64(updateSigOps)
+	t.SumTxSigChecksWithAncestors += int64(updateSigChecks)
 	t.SumTxFeeWithAncestors += updateFee
 }
 
@@ -124,7 +133,7 @@ func (t *TxEntry) Less(than mapcontainer.Lesser) bool {
 }
 
 func NewTxentry(tx *tx.Tx, txFee int64, acceptTime int64, height int32, lp LockPoints, sigOpsCount int,
-	spendCoinbase bool) *TxEntry {
+	sigChecks int, spendCoinbase bool) *TxEntry {
 	t := new(TxEntry)
 	t.Tx = tx
 	t.time = acceptTime
@@ -135,6 +144,7 @@ func NewTxentry(tx *tx.Tx, txFee int64, acceptTime int64, height int32, lp LockP
 	t.lp = lp
 	t.TxHeight = height
 	t.SigOpCount = sigOpsCount
+	t.SigChecks = sigChecks
 
 	t.SumTxSizeWithDescendants = int64(t.TxSize)
 	t.SumTxFeeWithDescendants = txFee
@@ -144,6 +154,7 @@ func NewTxentry(tx *tx.Tx, txFee int64, acceptTime int64, height int32, lp LockP
 	t.SumTxSizeWitAncestors = int64(t.TxSize)
 	t.SumTxCountWithAncestors = 1
 	t.SumTxSigOpCountWithAncestors = int64(sigOpsCount)
+	t.SumTxSigChecksWithAncestors = int64(sigChecks)
 
 	t.ParentTx = make(map[*TxEntry]struct{})
 	t.ChildTx = make(map[*TxEntry]struct{})
@@ -10,6 +10,7 @@ import (
 	"github.com/copernet/copernicus/errcode"
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/model/consensus"
+	"github.com/copernet/copernicus/model/dsproof"
 	"github.com/copernet/copernicus/model/outpoint"
 	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/model/utxo"
@@ -94,6 +95,14 @@ type TxMempool struct {
 	rollingMinimumFeeRate        int64
 	blockSinceLastRollingFeeBump bool
 	lastRollingFeeUpdate         int64
+
+	// addrIndex is nil unless the address index is enabled.
+	addrIndex *addressIndex
+
+	// dsproofs are the double spend proofs of the coins spent by the
+	// mempool transactions, by hash and by coin.
+	dsproofs      map[util.Hash]*dsproof.DSProof
+	dsproofsByOut map[outpoint.OutPoint]util.Hash
 }
 
 func (m *TxMempool) Lock() {
@@ -149,6 +158,9 @@ func (m *TxMempool) AddTx(txEntry *TxEntry, ancestors map[*TxEntry]struct{}) err
 	if txEntry.SumTxCountWithAncestors == 1 {
 		m.rootTx[txEntry.Tx.GetHash()] = txEntry
 	}
+	if m.addrIndex != nil {
+		m.addAddressIndex(txEntry)
+	}
 	m.LimitMempoolSize(conf.Cfg.Mempool.MaxPoolSize, int64(conf.Cfg.Mempool.MaxPoolExpiry)*60*60)
 	return nil
 }
@@ -167,6 +179,14 @@ func (m *TxMempool) CleanOrphan() {
 	log.Debug("mempool.CleanOrphan clean txn: %v", m.OrphanTransactions)
 }
 
+// FindSpender returns the entry spending out, or nil.
+func (m *TxMempool) FindSpender(out *outpoint.OutPoint) *TxEntry {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.nextTx[*out]
+}
+
 func (m *TxMempool) HasSPentOutWithoutLock(out *outpoint.OutPoint) *TxEntry {
 	if e, ok := m.nextTx[*out]; ok {
 		return e
@@ -472,6 +492,7 @@ func (m *TxMempool) updateForRemoveFromMempool(entriesToRemove map[*TxEntry]stru
 			modifySize := -removeIt.TxSize
 			modifyFee := -removeIt.TxFee
 			modifySigOps := -removeIt.SigOpCount
+			modifySigChecks := -removeIt.SigChecks
 
 			for dit := range setDescendants {
 				// Google's btree library use binary search and Less() to find item.However we want to do
@@ -479,7 +500,7 @@ func (m *TxMempool) updateForRemoveFromMempool(entriesToRemove map[*TxEntry]stru
 				// its key also change which looks like dead lock:(.So temporarily use delete and insert to instead.
 				m.timeSortData.Delete(dit)
 				m.txByAncestorFeeRateSort.Delete((*EntryAncestorFeeRateSort)(dit))
-				dit.UpdateAncestorState(-1, modifySize, modifySigOps, modifyFee)
+				dit.UpdateAncestorState(-1, modifySize, modifySigOps, modifySigChecks, modifyFee)
 				m.timeSortData.ReplaceOrInsert(dit)
 				m.txByAncestorFeeRateSort.ReplaceOrInsert((*EntryAncestorFeeRateSort)(dit))
 			}
@@ -592,13 +613,15 @@ func (m *TxMempool) updateEntryForAncestors(entry *TxEntry, setAncestors map[*Tx
 	updateSize := 0
 	updateFee := int64(0)
 	updateSigOpsCount := 0
+	updateSigChecks := 0
 
 	for ancestorIt := range setAncestors {
 		updateFee += ancestorIt.TxFee
 		updateSigOpsCount += ancestorIt.SigOpCount
+		updateSigChecks += ancestorIt.SigChecks
 		updateSize += ancestorIt.TxSize
 	}
-	entry.UpdateAncestorState(updateCount, updateSize, updateSigOpsCount, updateFee)
+	entry.UpdateAncestorState(updateCount, updateSize, updateSigOpsCount, updateSigChecks, updateFee)
 }
 
 // CalculateMemPoolAncestors get tx all ancestors transaction in mempool.
@@ -683,6 +706,10 @@ func (m *TxMempool) delTxentry(removeEntry *TxEntry, reason PoolRemovalReason) {
 	m.TransactionsUpdated++
 	m.totalTxSize -= uint64(removeEntry.TxSize)
 	delete(m.poolData, removeEntry.Tx.GetHash())
+	if m.addrIndex != nil {
+		m.removeAddressIndex(removeEntry.Tx.GetHash())
+	}
+	m.removeDSProofs(removeEntry)
 	m.timeSortData.Delete(removeEntry)
 	m.txByAncestorFeeRateSort.Delete((*EntryAncestorFeeRateSort)(removeEntry))
 }
@@ -717,6 +744,9 @@ func NewTxMempool() *TxMempool {
 
 		OrphanTransactionsByPrev: make(map[outpoint.OutPoint]map[util.Hash]OrphanTx),
 		OrphanTransactions:       make(map[util.Hash]OrphanTx),
+
+		dsproofs:      make(map[util.Hash]*dsproof.DSProof),
+		dsproofsByOut: make(map[outpoint.OutPoint]util.Hash),
 	}
 }
 
@@ -25,6 +25,7 @@ type TestMemPoolEntry struct {
 	Height         int32
 	SpendsCoinbase bool
 	SigOpCost      int
+	SigChecks      int
 	lp             *LockPoints
 }
 
@@ -36,6 +37,7 @@ func NewTestMemPoolEntry() *TestMemPoolEntry {
 	t.Height = 1
 	t.SpendsCoinbase = false
 	t.SigOpCost = 4
+	t.SigChecks = 1
 	t.lp = nil
 	return &t
 }
@@ -65,12 +67,17 @@ func (t *TestMemPoolEntry) SetSigOpsCost(sigOpsCost int) *TestMemPoolEntry {
 	return t
 }
 
+func (t *TestMemPoolEntry) SetSigChecks(sigChecks int) *TestMemPoolEntry {
+	t.SigChecks = sigChecks
+	return t
+}
+
 func (t *TestMemPoolEntry) FromTxToEntry(tx *tx.Tx) *TxEntry {
 	lp := LockPoints{}
 	if t.lp != nil {
 		lp = *(t.lp)
 	}
-	entry := NewTxentry(tx, int64(t.Fee), t.Time, t.Height, lp, int(t.SigOpCost), t.SpendsCoinbase)
+	entry := NewTxentry(tx, int64(t.Fee), t.Time, t.Height, lp, int(t.SigOpCost), t.SigChecks, t.SpendsCoinbase)
 	return entry
 }
 
@@ -475,6 +475,91 @@ func TestGetOpName(t *testing.T) {
 			if opName != "OP_CHECKDATASIGVERIFY" {
 				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
 			}
+		case OP_REVERSEBYTES:
+			if opName != "OP_REVERSEBYTES" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+
+		case OP_INPUTINDEX:
+			if opName != "OP_INPUTINDEX" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_ACTIVEBYTECODE:
+			if opName != "OP_ACTIVEBYTECODE" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_TXVERSION:
+			if opName != "OP_TXVERSION" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_TXINPUTCOUNT:
+			if opName != "OP_TXINPUTCOUNT" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_TXOUTPUTCOUNT:
+			if opName != "OP_TXOUTPUTCOUNT" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_TXLOCKTIME:
+			if opName != "OP_TXLOCKTIME" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_UTXOVALUE:
+			if opName != "OP_UTXOVALUE" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_UTXOBYTECODE:
+			if opName != "OP_UTXOBYTECODE" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_OUTPOINTTXHASH:
+			if opName != "OP_OUTPOINTTXHASH" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_OUTPOINTINDEX:
+			if opName != "OP_OUTPOINTINDEX" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_INPUTBYTECODE:
+			if opName != "OP_INPUTBYTECODE" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_INPUTSEQUENCENUMBER:
+			if opName != "OP_INPUTSEQUENCENUMBER" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_OUTPUTVALUE:
+			if opName != "OP_OUTPUTVALUE" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_OUTPUTBYTECODE:
+			if opName != "OP_OUTPUTBYTECODE" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_UTXOTOKENCATEGORY:
+			if opName != "OP_UTXOTOKENCATEGORY" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_UTXOTOKENCOMMITMENT:
+			if opName != "OP_UTXOTOKENCOMMITMENT" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_UTXOTOKENAMOUNT:
+			if opName != "OP_UTXOTOKENAMOUNT" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_OUTPUTTOKENCATEGORY:
+			if opName != "OP_OUTPUTTOKENCATEGORY" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_OUTPUTTOKENCOMMITMENT:
+			if opName != "OP_OUTPUTTOKENCOMMITMENT" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
+		case OP_OUTPUTTOKENAMOUNT:
+			if opName != "OP_OUTPUTTOKENAMOUNT" {
+				t.Errorf("GetOpName return error opName of opCode: %d", opCode)
+			}
 
 		case OP_INVALIDOPCODE:
 			if opName != "OP_INVALIDOPCODE" {
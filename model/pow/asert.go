@@ -0,0 +1,135 @@
+package pow
+
+import (
+	"math/big"
+
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/blockindex"
+)
+
+// getNextASERTWorkRequired Compute the next required proof of work using the
+// absolutely scheduled exponentially rising targets algorithm (aserti3-2d)
+// activated by the Nov 15 2020 upgrade.
+//
+// The target is derived from the anchor block only: every block that is ahead
+// of the ideal schedule, measured from the anchor parent's timestamp, halves
+// the difficulty every ASERTHalfLife seconds and vice versa.
+func (pow *Pow) getNextASERTWorkRequired(indexPrev *blockindex.BlockIndex, blHeader *block.BlockHeader,
+	params *model.BitcoinParams) uint32 {
+	if indexPrev == nil {
+		panic("This cannot handle the genesis block and early blocks in general.")
+	}
+
+	// Special difficulty rule for testnet:
+	// If the new block's timestamp is more than 2* 10 minutes then allow
+	// mining of a min-difficulty block.
+	if params.FPowAllowMinDifficultyBlocks && (blHeader.Time > indexPrev.GetBlockTime()+uint32(2*params.TargetTimePerBlock)) {
+		return BigToCompact(params.PowLimit)
+	}
+
+	var anchorHeight int32
+	var anchorBits uint32
+	var anchorParentTime int64
+	if params.ASERTAnchor != nil {
+		anchorHeight = params.ASERTAnchor.Height
+		anchorBits = params.ASERTAnchor.Bits
+		anchorParentTime = params.ASERTAnchor.PrevBlockTime
+	} else {
+		indexAnchor := getASERTAnchorBlock(indexPrev)
+		anchorHeight = indexAnchor.Height
+		anchorBits = indexAnchor.Header.Bits
+		// The time difference is measured from the anchor's parent, or from
+		// the anchor itself iff it is the genesis block.
+		if indexAnchor.Prev != nil {
+			anchorParentTime = int64(indexAnchor.Prev.GetBlockTime())
+		} else {
+			anchorParentTime = int64(indexAnchor.GetBlockTime())
+		}
+	}
+
+	timeDiff := int64(indexPrev.GetBlockTime()) - anchorParentTime
+	heightDiff := int64(indexPrev.Height - anchorHeight)
+
+	nextTarget := calculateASERT(CompactToBig(anchorBits), int64(params.TargetTimePerBlock), timeDiff,
+		heightDiff, params.PowLimit, params.ASERTHalfLife)
+
+	return BigToCompact(nextTarget)
+}
+
+// getASERTAnchorBlock returns the first block on indexPrev's chain whose own
+// median time past activates the Nov 2020 upgrade, i.e. the block whose
+// parent is the last one mined under the previous difficulty algorithm.
+func getASERTAnchorBlock(indexPrev *blockindex.BlockIndex) *blockindex.BlockIndex {
+	anchor := indexPrev
+	for anchor.Prev != nil {
+		// Use the skip list to walk back quickly while it is safe.
+		if anchor.Skip != nil && model.IsAxionEnabled(anchor.Skip.GetMedianTimePast()) {
+			anchor = anchor.Skip
+			continue
+		}
+
+		if !model.IsAxionEnabled(anchor.Prev.GetMedianTimePast()) {
+			break
+		}
+		anchor = anchor.Prev
+	}
+
+	return anchor
+}
+
+// calculateASERT approximates, in fixed-point integer arithmetic,
+//
+//	refTarget * 2^((timeDiff - targetSpacing * (heightDiff + 1)) / halfLife)
+//
+// where timeDiff is measured from the anchor's parent and heightDiff from the
+// anchor. The result is clamped to [1, powLimit].
+func calculateASERT(refTarget *big.Int, targetSpacing int64, timeDiff int64, heightDiff int64,
+	powLimit *big.Int, halfLife int64) *big.Int {
+	if refTarget.Sign() <= 0 || refTarget.Cmp(powLimit) > 0 {
+		panic("the ASERT reference target should be in (0, powLimit]")
+	}
+	if heightDiff < 0 {
+		panic("the ASERT height difference should not be negative")
+	}
+
+	// The exponent is a 16.16 fixed-point number. Go's integer division
+	// truncates towards zero, as the reference implementation does.
+	exponent := ((timeDiff - targetSpacing*(heightDiff+1)) * 65536) / halfLife
+
+	// Decompose the exponent into its integer and fractional parts. The
+	// arithmetic right shift rounds downward, so frac is always positive.
+	shifts := exponent >> 16
+	frac := uint64(uint16(exponent))
+
+	// 65536 * 2^(frac/65536), using the cubic approximation
+	// 2^x ~= 1 + 0.695502049*x + 0.2262698*x^2 + 0.0782318*x^3 for 0 <= x < 1
+	factor := 65536 + ((195766423245049*frac +
+		971821376*frac*frac +
+		5127*frac*frac*frac +
+		(1 << 47)) >> 48)
+
+	nextTarget := new(big.Int).Mul(refTarget, new(big.Int).SetUint64(factor))
+
+	// Multiply by 2^shifts / 65536.
+	shifts -= 16
+	if shifts <= 0 {
+		nextTarget.Rsh(nextTarget, uint(-shifts))
+	} else {
+		// Anything that no longer fits in 256 bits is above powLimit anyway.
+		if int64(nextTarget.BitLen())+shifts > 256 {
+			return new(big.Int).Set(powLimit)
+		}
+		nextTarget.Lsh(nextTarget, uint(shifts))
+	}
+
+	if nextTarget.Sign() == 0 {
+		// 0 is not a valid target, but 1 is.
+		return big.NewInt(1)
+	}
+	if nextTarget.Cmp(powLimit) > 0 {
+		return new(big.Int).Set(powLimit)
+	}
+
+	return nextTarget
+}
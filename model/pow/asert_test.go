@@ -0,0 +1,320 @@
+package pow
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/model/consensus"
+)
+
+const asertHalfLife = 2 * 24 * 60 * 60
+
+func TestMain(m *testing.M) {
+	conf.Cfg = conf.InitConfig([]string{})
+	os.Exit(m.Run())
+}
+
+// asertApproximationError returns the relative error of bits against the
+// floating point evaluation of the ASERT formula.
+func asertApproximationError(refTarget *big.Int, timeDiff, heightDiff int64, bits uint32) float64 {
+	exponent := float64(timeDiff-600*(heightDiff+1)) / asertHalfLife
+	ideal, _ := new(big.Float).SetInt(refTarget).Float64()
+	ideal *= math.Pow(2, exponent)
+
+	actual, _ := new(big.Float).SetInt(CompactToBig(bits)).Float64()
+	return (actual - ideal) / ideal
+}
+
+func TestCalculateASERT(t *testing.T) {
+	powLimit := model.MainNetParams.PowLimit
+	initial := new(big.Int).Rsh(powLimit, 4)
+	double := new(big.Int).Lsh(initial, 1)
+	half := new(big.Int).Rsh(initial, 1)
+
+	tests := []struct {
+		name       string
+		refTarget  *big.Int
+		timeDiff   int64
+		heightDiff int64
+		expect     *big.Int
+	}{
+		{"anchor at ideal spacing", initial, 600, 0, initial},
+		{"on schedule", initial, 600 * 1001, 1000, initial},
+		{"one half-life ahead", initial, 600*11 + asertHalfLife, 10, double},
+		{"one half-life behind", initial, 600*11 - asertHalfLife, 10, half},
+		{"two half-lives behind", initial, 600*289 - 2*asertHalfLife, 288, new(big.Int).Rsh(initial, 2)},
+		{"clamped to powLimit", initial, 600 + 5*asertHalfLife, 0, powLimit},
+		{"overflow clamped to powLimit", big.NewInt(1), 600 + 300*asertHalfLife, 0, powLimit},
+		{"never below one", powLimit, 0, 2 * 300 * 144, big.NewInt(1)},
+		{"one stays one", big.NewInt(1), 600, 0, big.NewInt(1)},
+	}
+
+	for _, test := range tests {
+		actual := calculateASERT(test.refTarget, 600, test.timeDiff, test.heightDiff, powLimit, asertHalfLife)
+		if actual.Cmp(test.expect) != 0 {
+			t.Errorf("%s: expect target %x, actual %x", test.name, test.expect, actual)
+		}
+	}
+}
+
+func TestCalculateASERTApproximation(t *testing.T) {
+	powLimit := model.MainNetParams.PowLimit
+	refTarget := new(big.Int).Rsh(powLimit, 8)
+
+	// Sweep two half-lives in both directions, so that every fractional part
+	// of the exponent is exercised. The cubic approximation of 2^x is accurate
+	// to within 0.013%.
+	for timeDiff := int64(600 - 2*asertHalfLife); timeDiff <= 600+2*asertHalfLife; timeDiff += 97 {
+		bits := BigToCompact(calculateASERT(refTarget, 600, timeDiff, 0, powLimit, asertHalfLife))
+		if e := asertApproximationError(refTarget, timeDiff, 0, bits); e > 0.00013 || e < -0.00013 {
+			t.Fatalf("timeDiff %d: approximation error %f is too large", timeDiff, e)
+		}
+	}
+}
+
+func TestCalculateASERTMonotonic(t *testing.T) {
+	powLimit := model.MainNetParams.PowLimit
+	refTarget := new(big.Int).Rsh(powLimit, 8)
+
+	prev := calculateASERT(refTarget, 600, -asertHalfLife, 0, powLimit, asertHalfLife)
+	for timeDiff := int64(-asertHalfLife + 1); timeDiff <= asertHalfLife; timeDiff += 13 {
+		next := calculateASERT(refTarget, 600, timeDiff, 0, powLimit, asertHalfLife)
+		if next.Cmp(prev) < 0 {
+			t.Fatalf("timeDiff %d: target %x decreased from %x", timeDiff, next, prev)
+		}
+		prev = next
+	}
+}
+
+// checkASERTVectors checks a run of the published aserti3-2d test vectors: the
+// headers give the anchor block, each line the height and time of a block
+// followed by the nBits required for its child.
+func checkASERTVectors(t *testing.T, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	params := model.MainNetParams
+	anchor := &consensus.ASERTAnchor{}
+	params.ASERTAnchor = anchor
+	pow := Pow{}
+	blkHeaderDummy := block.BlockHeader{}
+	count := 0
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "##") {
+			kv := strings.SplitN(strings.TrimPrefix(line, "##"), ":", 2)
+			if len(kv) != 2 {
+				t.Fatalf("%s: bad header %q", path, line)
+			}
+			value, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 0, 64)
+			switch strings.TrimSpace(kv[0]) {
+			case "anchor height":
+				anchor.Height = int32(value)
+			case "anchor parent time", "anchor ancestor time":
+				anchor.PrevBlockTime = value
+			case "anchor nBits":
+				anchor.Bits = uint32(value)
+			default:
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: bad header %q: %v", path, line, err)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var iteration, height, time int64
+		var expect uint32
+		if _, err := fmt.Sscanf(line, "%d %d %d 0x%x", &iteration, &height, &time, &expect); err != nil {
+			t.Fatalf("%s: bad vector %q: %v", path, line, err)
+		}
+		indexPrev := new(blockindex.BlockIndex)
+		indexPrev.SetNull()
+		indexPrev.Height = int32(height)
+		indexPrev.Header.Time = uint32(time)
+		if bits := pow.getNextASERTWorkRequired(indexPrev, &blkHeaderDummy, &params); bits != expect {
+			t.Fatalf("%s: iteration %d: expect bits %x, actual %x", path, iteration, expect, bits)
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if count == 0 {
+		t.Fatalf("%s: no vector", path)
+	}
+}
+
+// TestASERTVectors checks the algorithm against the runs run01 to run12
+// published with the aserti3-2d specification, in test_vectors/aserti3-2d of
+// https://gitlab.com/bitcoin-cash-node/bchn-sw/qa-assets. They are read
+// unmodified from testdata/aserti3-2d.
+func TestASERTVectors(t *testing.T) {
+	paths, err := filepath.Glob("testdata/aserti3-2d/run[0-9][0-9]*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Skip("the aserti3-2d test vectors are not in testdata/aserti3-2d")
+	}
+	for _, path := range paths {
+		checkASERTVectors(t, path)
+	}
+}
+
+func TestGetASERTAnchorBlock(t *testing.T) {
+	blocks := make([]*blockindex.BlockIndex, 1000)
+	blocks[0] = new(blockindex.BlockIndex)
+	blocks[0].SetNull()
+	blocks[0].Header.Time = 1269211443
+	blocks[0].Header.Bits = 0x1c1fffff
+	for i := 1; i < len(blocks); i++ {
+		blocks[i] = getBlockIndex(blocks[i-1], 600, 0x1c1fffff)
+		blocks[i].BuildSkip()
+	}
+
+	// The median time past of block 500 is the time of block 495.
+	conf.Args.AxionTime = int64(blocks[495].GetBlockTime())
+	defer func() { conf.Args.AxionTime = -1 }()
+
+	for _, height := range []int{500, 501, 777, 999} {
+		anchor := getASERTAnchorBlock(blocks[height])
+		if anchor != blocks[500] {
+			t.Errorf("the anchor of block %d should be block 500, but got block %d", height, anchor.Height)
+		}
+	}
+}
+
+func TestGetNextASERTWorkRequired(t *testing.T) {
+	params := model.MainNetParams
+	params.ASERTAnchor = nil
+	pow := Pow{}
+	blkHeaderDummy := block.BlockHeader{}
+
+	initialTarget := new(big.Int).Rsh(params.PowLimit, 3)
+	initialBits := BigToCompact(initialTarget)
+
+	blocks := make([]*blockindex.BlockIndex, 0, 300)
+	genesis := new(blockindex.BlockIndex)
+	genesis.SetNull()
+	genesis.Header.Time = 1269211443
+	// The bits of the anchor's parent must never be used.
+	genesis.Header.Bits = 0x0dedbeef
+	blocks = append(blocks, genesis)
+
+	// Make block 1 the anchor, and give it a solve time of 150 seconds to make
+	// sure the time between the anchor and its parent is taken into account.
+	conf.Args.AxionTime = int64(genesis.GetBlockTime()) + 1
+	defer func() { conf.Args.AxionTime = -1 }()
+	blocks = append(blocks, getBlockIndex(genesis, 150, initialBits))
+
+	bits := pow.GetNextWorkRequired(blocks[1], &blkHeaderDummy, &params)
+	if bits == initialBits {
+		t.Errorf("a fast anchor block should raise the difficulty")
+	}
+	if e := asertApproximationError(initialTarget, 150, 0, bits); e > 0.0001 || e < -0.0001 {
+		t.Errorf("approximation error %f is too large", e)
+	}
+
+	// Catching up with the schedule restores the anchor's bits.
+	blocks = append(blocks, getBlockIndex(blocks[1], 1050, bits))
+	bits = pow.GetNextWorkRequired(blocks[2], &blkHeaderDummy, &params)
+	if bits != initialBits {
+		t.Errorf("expect bits %x, actual %x", initialBits, bits)
+	}
+
+	// Blocks on schedule keep the difficulty.
+	for i := 0; i < 200; i++ {
+		prev := blocks[len(blocks)-1]
+		blocks = append(blocks, getBlockIndex(prev, 600, bits))
+		bits = pow.GetNextWorkRequired(blocks[len(blocks)-1], &blkHeaderDummy, &params)
+		if bits != initialBits {
+			t.Fatalf("height %d: expect bits %x, actual %x", prev.Height+1, initialBits, bits)
+		}
+	}
+
+	// A block arriving one half-life late halves the difficulty.
+	prev := blocks[len(blocks)-1]
+	blocks = append(blocks, getBlockIndex(prev, 600+asertHalfLife, bits))
+	bits = pow.GetNextWorkRequired(blocks[len(blocks)-1], &blkHeaderDummy, &params)
+	expect := BigToCompact(new(big.Int).Lsh(CompactToBig(initialBits), 1))
+	if bits != expect {
+		t.Errorf("expect bits %x, actual %x", expect, bits)
+	}
+
+	// Testnet's special rule still allows min difficulty blocks.
+	params.FPowAllowMinDifficultyBlocks = true
+	header := block.BlockHeader{Time: blocks[len(blocks)-1].GetBlockTime() + 1201}
+	bits = pow.GetNextWorkRequired(blocks[len(blocks)-1], &header, &params)
+	if bits != BigToCompact(params.PowLimit) {
+		t.Errorf("expect min difficulty bits %x, actual %x", BigToCompact(params.PowLimit), bits)
+	}
+}
+
+func TestGetNextASERTWorkRequiredPinnedAnchor(t *testing.T) {
+	params := &model.MainNetParams
+	pow := Pow{}
+	blkHeaderDummy := block.BlockHeader{}
+
+	// The block right after the mainnet anchor, mined on schedule, keeps the
+	// anchor's bits.
+	indexPrev := new(blockindex.BlockIndex)
+	indexPrev.SetNull()
+	indexPrev.Height = params.ASERTAnchor.Height + 1
+	indexPrev.Header.Time = uint32(params.ASERTAnchor.PrevBlockTime + 1200)
+
+	bits := pow.getNextASERTWorkRequired(indexPrev, &blkHeaderDummy, params)
+	if bits != params.ASERTAnchor.Bits {
+		t.Errorf("expect bits %x, actual %x", params.ASERTAnchor.Bits, bits)
+	}
+}
+
+func TestGetNextWorkRequiredRegTestRetargeting(t *testing.T) {
+	params := &model.RegressionNetParams
+	pow := Pow{}
+	blkHeaderDummy := block.BlockHeader{}
+	powLimitBits := BigToCompact(params.PowLimit)
+
+	genesis := new(blockindex.BlockIndex)
+	genesis.SetNull()
+	genesis.Header.Time = 1296688602
+	genesis.Header.Bits = powLimitBits
+	indexPrev := genesis
+	for i := 0; i < 20; i++ {
+		indexPrev = getBlockIndex(indexPrev, 1, powLimitBits)
+	}
+
+	conf.Args.AxionTime = int64(genesis.GetBlockTime()) + 1
+	defer func() { conf.Args.AxionTime = -1 }()
+
+	if bits := pow.GetNextWorkRequired(indexPrev, &blkHeaderDummy, params); bits != powLimitBits {
+		t.Errorf("regtest should not retarget by default, expect bits %x, actual %x", powLimitBits, bits)
+	}
+
+	conf.Args.RegTestPowRetargeting = true
+	defer func() { conf.Args.RegTestPowRetargeting = false }()
+
+	bits := pow.GetNextWorkRequired(indexPrev, &blkHeaderDummy, params)
+	if CompactToBig(bits).Cmp(params.PowLimit) >= 0 {
+		t.Errorf("blocks mined faster than scheduled should raise the difficulty, actual bits %x", bits)
+	}
+}
@@ -3,6 +3,7 @@ package pow
 import (
 	"math/big"
 
+	"github.com/copernet/copernicus/conf"
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/model"
 	"github.com/copernet/copernicus/model/block"
@@ -18,11 +19,19 @@ func (pow *Pow) GetNextWorkRequired(indexPrev *blockindex.BlockIndex, blHeader *
 		return BigToCompact(params.PowLimit)
 	}
 
-	// Special rule for regTest: we never retarget.
-	if params.FPowNoRetargeting {
+	isAxionEnabled := model.IsAxionEnabled(indexPrev.GetMedianTimePast())
+
+	// Special rule for regTest: we never retarget. With -regtestpowretargeting,
+	// ASERT still applies once activated, so that it can be exercised by mining
+	// blocks with manipulated timestamps.
+	if params.FPowNoRetargeting && !(isAxionEnabled && conf.Args.RegTestPowRetargeting) {
 		return indexPrev.Header.Bits
 	}
 
+	if isAxionEnabled {
+		return pow.getNextASERTWorkRequired(indexPrev, blHeader, params)
+	}
+
 	if model.IsDAAEnabled(indexPrev.Height) {
 		return pow.getNextCashWorkRequired(indexPrev, blHeader, params)
 	}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+	"unsafe"
 
 	"github.com/copernet/copernicus/crypto"
 	"github.com/copernet/copernicus/errcode"
@@ -164,6 +165,53 @@ const (
 	//
 	ScriptEnableCheckDataSig = (1 << 18)
 
+	// Are Schnorr signatures enabled for OP_CHECK(DATA)SIG(VERIFY) and
+	// 65-byte signatures banned for OP_CHECKMULTISIG(VERIFY).
+	//
+	ScriptEnableSchnorr = (1 << 19)
+
+	// A non-null dummy element in OP_CHECKMULTISIG(VERIFY) is a bitfield
+	// selecting the public keys checked against Schnorr signatures.
+	//
+	ScriptEnableSchnorrMultisig = (1 << 20)
+
+	// Allows the recovery of coins sent to P2SH-wrapped segwit outputs by
+	// exempting such spends from the clean stack rule. Only set for
+	// consensus, never for mempool policy.
+	//
+	ScriptAllowSegwitRecovery = (1 << 21)
+
+	// Script numbers may be up to 8 bytes long, arithmetic results are
+	// checked for 64-bit overflow, and OP_MUL is re-enabled.
+	//
+	ScriptEnable64BitIntegers = (1 << 22)
+
+	// Are the native introspection opcodes, which read the transaction being
+	// verified and the coins it spends, enabled.
+	//
+	ScriptEnableNativeIntrospection = (1 << 23)
+
+	// Are CashTokens enabled: outputs may carry token data, which is checked
+	// by consensus, and the token introspection opcodes are available.
+	//
+	ScriptEnableTokens = (1 << 24)
+
+	// Is OP_REVERSEBYTES enabled.
+	//
+	ScriptEnableOpReverseBytes = (1 << 25)
+
+	// Require the scriptSig of each input to be large enough for the
+	// signature checks it executes, so that SigChecks are bounded by the size
+	// of a transaction.
+	//
+	ScriptVerifyInputSigChecks = (1 << 26)
+
+	// The SigChecks executed by scripts are limited per transaction and per
+	// block, replacing the legacy sigops limits. Only set for consensus, as
+	// it does not change how scripts are evaluated.
+	//
+	ScriptEnforceSigChecks = (1 << 27)
+
 	ScriptMaxOpReturnRelay uint = 223
 )
 
@@ -195,7 +243,7 @@ const (
 		ScriptVerifyNullDummy | ScriptVerifySigPushOnly |
 		ScriptVerifyMinmalData | ScriptVerifyDiscourageUpgradableNops |
 		ScriptVerifyCleanStack | ScriptVerifyCheckLockTimeVerify |
-		ScriptVerifyCheckSequenceVerify | ScriptVerifyNullFail
+		ScriptVerifyCheckSequenceVerify | ScriptVerifyNullFail | ScriptVerifyInputSigChecks
 
 	//StandardNotMandatoryVerifyFlags for convenience, standard but not mandatory verify flags.
 	StandardNotMandatoryVerifyFlags uint = StandardScriptVerifyFlags & (^MandatoryScriptVerifyFlags)
@@ -643,6 +691,19 @@ func (s *Script) IsPayToScriptHash() bool {
 		s.data[22] == opcodes.OP_EQUAL
 }
 
+// IsWitnessProgram reports whether the script is a segwit program: a version
+// byte (OP_0 to OP_16) followed by a single 2 to 40 byte push.
+func (s *Script) IsWitnessProgram() bool {
+	size := len(s.data)
+	if size < 4 || size > 42 {
+		return false
+	}
+	if s.data[0] != opcodes.OP_0 && (s.data[0] < opcodes.OP_1 || s.data[0] > opcodes.OP_16) {
+		return false
+	}
+	return int(s.data[1])+2 == size
+}
+
 func (s *Script) IsUnspendable() bool {
 	return (s.Size() > 0 && s.data[0] == opcodes.OP_RETURN) || s.Size() > MaxScriptSize
 }
@@ -737,6 +798,16 @@ func (s *Script) Size() int {
 	return len(s.data)
 }
 
+// DynamicMemoryUsage estimates the memory used by the script and its parsed opcodes in bytes.
+func (s *Script) DynamicMemoryUsage() int64 {
+	usage := int64(unsafe.Sizeof(*s)) + int64(cap(s.data))
+	usage += int64(cap(s.ParsedOpCodes)) * int64(unsafe.Sizeof(opcodes.ParsedOpCode{}))
+	for _, op := range s.ParsedOpCodes {
+		usage += int64(cap(op.Data))
+	}
+	return usage
+}
+
 func (s *Script) IsEqual(script2 *Script) bool {
 	return bytes.Equal(s.data, script2.data)
 }
@@ -883,6 +954,23 @@ func (s *Script) Bytes() []byte {
 }
 
 func CheckTransactionSignatureEncoding(vchSig []byte, flags uint32) error {
+	return checkTransactionSignatureEncoding(vchSig, flags, checkRawSignatureEncoding)
+}
+
+// CheckTransactionECDSASignatureEncoding is like CheckTransactionSignatureEncoding
+// but only accepts ECDSA signatures, as required by OP_CHECKMULTISIG.
+func CheckTransactionECDSASignatureEncoding(vchSig []byte, flags uint32) error {
+	return checkTransactionSignatureEncoding(vchSig, flags, checkRawECDSASignatureEncoding)
+}
+
+// CheckTransactionSchnorrSignatureEncoding is like CheckTransactionSignatureEncoding
+// but only accepts Schnorr signatures, as required by Schnorr-mode OP_CHECKMULTISIG.
+func CheckTransactionSchnorrSignatureEncoding(vchSig []byte, flags uint32) error {
+	return checkTransactionSignatureEncoding(vchSig, flags, checkRawSchnorrSignatureEncoding)
+}
+
+func checkTransactionSignatureEncoding(vchSig []byte, flags uint32,
+	checkRaw func([]byte, uint32) (bool, error)) error {
 	// Empty signature. Not strictly DER encoded, but allowed to provide a
 	// compact way to provide an invalid signature for use with CHECK(MULTI)SIG
 	vchSigLen := len(vchSig)
@@ -890,7 +978,7 @@ func CheckTransactionSignatureEncoding(vchSig []byte, flags uint32) error {
 		return nil
 	}
 
-	ok, err := checkRawSignatureEncoding(vchSig[:len(vchSig)-1], flags)
+	ok, err := checkRaw(vchSig[:len(vchSig)-1], flags)
 	if !ok {
 		return err
 	}
@@ -915,12 +1003,43 @@ func CheckTransactionSignatureEncoding(vchSig []byte, flags uint32) error {
 		if forkIDEnable && !useForkID {
 			return errcode.New(errcode.ScriptErrMustUseForkID)
 		}
+		// SigHashUtxos is only defined with CashTokens, along with the fork
+		// id, and signs the outputs spent by all the inputs.
+		if hashType&crypto.SigHashUtxos != 0 && (flags&ScriptEnableTokens == 0 || !useForkID ||
+			hashType&crypto.SigHashAnyoneCanpay != 0) {
+			log.Debug("ScriptErrSigHashType")
+			return errcode.New(errcode.ScriptErrSigHashType)
+		}
 	}
 
 	return nil
 }
 
+// checkRawSignatureEncoding accepts a 64-byte Schnorr signature once
+// ScriptEnableSchnorr is set, and falls back to the ECDSA rules otherwise.
 func checkRawSignatureEncoding(vchSig []byte, flags uint32) (bool, error) {
+	if flags&ScriptEnableSchnorr != 0 && len(vchSig) == crypto.SchnorrSignatureLen {
+		return true, nil
+	}
+
+	return checkRawECDSASignatureEncoding(vchSig, flags)
+}
+
+func checkRawSchnorrSignatureEncoding(vchSig []byte, flags uint32) (bool, error) {
+	if len(vchSig) != crypto.SchnorrSignatureLen {
+		return false, errcode.New(errcode.ScriptErrSigNonSchnorr)
+	}
+
+	return true, nil
+}
+
+func checkRawECDSASignatureEncoding(vchSig []byte, flags uint32) (bool, error) {
+	// A 64-byte signature would be interpreted as Schnorr, which is not
+	// allowed in this context.
+	if flags&ScriptEnableSchnorr != 0 && len(vchSig) == crypto.SchnorrSignatureLen {
+		return false, errcode.New(errcode.ScriptErrSigBadLength)
+	}
+
 	if ((flags & (ScriptVerifyDersig | ScriptVerifyLowS | ScriptVerifyStrictEnc)) != 0) && !crypto.
 		IsValidSignatureEncoding(vchSig) {
 		return false, errcode.New(errcode.ScriptErrSigDer)
@@ -955,8 +1074,10 @@ func CheckPubKeyEncoding(vchPubKey []byte, flags uint32) error {
 func IsOpCodeDisabled(opCode byte, flags uint32) bool {
 	switch opCode {
 	case opcodes.OP_INVERT, opcodes.OP_2MUL, opcodes.OP_2DIV,
-		opcodes.OP_MUL, opcodes.OP_LSHIFT, opcodes.OP_RSHIFT:
+		opcodes.OP_LSHIFT, opcodes.OP_RSHIFT:
 		return true
+	case opcodes.OP_MUL:
+		return flags&ScriptEnable64BitIntegers == 0
 	default:
 		return false
 	}
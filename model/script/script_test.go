@@ -143,6 +143,32 @@ func TestScript_IsSpendable(t *testing.T) {
 	}
 }
 
+func TestScript_IsWitnessProgram(t *testing.T) {
+	program20 := bytes.Repeat([]byte{0x01}, 20)
+	program32 := bytes.Repeat([]byte{0x01}, 32)
+	tests := []struct {
+		in   []byte
+		want bool
+	}{
+		{append([]byte{OP_0, 0x14}, program20...), true},
+		{append([]byte{OP_0, 0x20}, program32...), true},
+		{append([]byte{OP_16, 0x14}, program20...), true},
+		{[]byte{OP_1, 0x02, 0x01, 0x01}, true},
+		{append([]byte{OP_0, 0x28}, bytes.Repeat([]byte{0x01}, 40)...), true},
+		{append([]byte{OP_0, 0x29}, bytes.Repeat([]byte{0x01}, 41)...), false},
+		{[]byte{OP_0, 0x01, 0x01}, false},
+		{append([]byte{OP_1NEGATE, 0x14}, program20...), false},
+		{append([]byte{OP_0, 0x15}, program20...), false},
+		{append([]byte{OP_0, 0x14}, program32...), false},
+		{p2SHScript[:], false},
+		{[]byte{}, false},
+	}
+
+	for i, v := range tests {
+		assert.Equal(t, v.want, NewScriptRaw(v.in).IsWitnessProgram(), "case %d", i)
+	}
+}
+
 func TestScript_RemoveOpcode(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -989,6 +1015,8 @@ func TestCheckSignatureEncoding(t *testing.T) {
 	//errSig := hexToBytes("3045022100d83c96e2656d8c91bf508c4dda68e13f6ea55cfd728e9f55d841d9e32d9325d30221673c42ba6b6546bda1fa0e072c5a423cb02d156406c8a5b59310aa86cab4af701")
 	notDefinedHashTypeSig := hexToBytes("3045022100d83c96e2656d8c91bf508c4dda68e13f6ea55cfd728e9f55d841d9e32d9325d302201673c42ba6b6546bda1fa0e072c5a423cb02d156406c8a5b59310aa86cab4af700")
 	validSigWithSigHashForkID := hexToBytes("3045022100d83c96e2656d8c91bf508c4dda68e13f6ea55cfd728e9f55d841d9e32d9325d302201673c42ba6b6546bda1fa0e072c5a423cb02d156406c8a5b59310aa86cab4af741")
+	validSigWithSigHashUtxos := hexToBytes("3045022100d83c96e2656d8c91bf508c4dda68e13f6ea55cfd728e9f55d841d9e32d9325d302201673c42ba6b6546bda1fa0e072c5a423cb02d156406c8a5b59310aa86cab4af761")
+	sigHashUtxosAnyoneCanPay := hexToBytes("3045022100d83c96e2656d8c91bf508c4dda68e13f6ea55cfd728e9f55d841d9e32d9325d302201673c42ba6b6546bda1fa0e072c5a423cb02d156406c8a5b59310aa86cab4af7e1")
 
 	tests := []struct {
 		vchSig      []byte
@@ -1028,6 +1056,24 @@ func TestCheckSignatureEncoding(t *testing.T) {
 			nil,
 			"Without error, return nil",
 		},
+		{
+			validSigWithSigHashUtxos,
+			ScriptEnableSigHashForkID | ScriptVerifyStrictEnc,
+			errcode.New(errcode.ScriptErrSigHashType),
+			"SigHashUtxos before CashTokens, should return error.",
+		},
+		{
+			validSigWithSigHashUtxos,
+			ScriptEnableSigHashForkID | ScriptEnableTokens | ScriptVerifyStrictEnc,
+			nil,
+			"SigHashUtxos with CashTokens, return nil",
+		},
+		{
+			sigHashUtxosAnyoneCanPay,
+			ScriptEnableSigHashForkID | ScriptEnableTokens | ScriptVerifyStrictEnc,
+			errcode.New(errcode.ScriptErrSigHashType),
+			"SigHashUtxos with SigHashAnyoneCanpay, should return error.",
+		},
 	}
 
 	for _, v := range tests {
@@ -1,6 +1,8 @@
 package script
 
 import (
+	"math"
+
 	"github.com/copernet/copernicus/errcode"
 	"github.com/copernet/copernicus/log"
 )
@@ -8,6 +10,10 @@ import (
 const (
 	DefaultMaxNumSize = 4
 
+	// MaxNumSize64Bit is the maximum size of script numbers once
+	// ScriptEnable64BitIntegers is set.
+	MaxNumSize64Bit = 8
+
 	MaxInt32 = 1<<31 - 1
 	MinInt32 = -1 << 31
 )
@@ -264,6 +270,48 @@ func IsMinimallyEncoded(data []byte, nMaxNumSize int64) bool {
 	return true
 }
 
+// IsValid64Bit reports whether v can be encoded as a 64-bit script number,
+// i.e. whether it lies in [-2^63 + 1, 2^63 - 1].
+func IsValid64Bit(v int64) bool {
+	return v != math.MinInt64
+}
+
+// SafeAdd returns a + b, and false if the result overflows the 64-bit script
+// number range.
+func SafeAdd(a, b int64) (int64, bool) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, false
+	}
+	r := a + b
+	return r, IsValid64Bit(r)
+}
+
+// SafeSub returns a - b, and false if the result overflows the 64-bit script
+// number range.
+func SafeSub(a, b int64) (int64, bool) {
+	if (b < 0 && a > math.MaxInt64+b) || (b > 0 && a < math.MinInt64+b) {
+		return 0, false
+	}
+	r := a - b
+	return r, IsValid64Bit(r)
+}
+
+// SafeMul returns a * b, and false if the result overflows the 64-bit script
+// number range.
+func SafeMul(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	if !IsValid64Bit(a) || !IsValid64Bit(b) {
+		return 0, false
+	}
+	r := a * b
+	if r/b != a {
+		return 0, false
+	}
+	return r, IsValid64Bit(r)
+}
+
 func NewScriptNum(v int64) *ScriptNum {
 	return &ScriptNum{Value: v}
 }
@@ -354,3 +354,51 @@ func TestMinimallyEncode(t *testing.T) {
 		assert.Equal(t, value.want, result, hex.EncodeToString(value.in))
 	}
 }
+
+func TestSafeArithmetic(t *testing.T) {
+	const maxInt64 = 1<<63 - 1
+
+	tests := []struct {
+		name   string
+		op     func(a, b int64) (int64, bool)
+		a, b   int64
+		result int64
+		ok     bool
+	}{
+		{"add", SafeAdd, 2, 3, 5, true},
+		{"add max", SafeAdd, maxInt64 - 1, 1, maxInt64, true},
+		{"add overflow", SafeAdd, maxInt64, 1, 0, false},
+		{"add to min", SafeAdd, -maxInt64, -1, 0, false},
+		{"sub", SafeSub, 2, 3, -1, true},
+		{"sub min", SafeSub, -maxInt64 + 1, 1, -maxInt64, true},
+		{"sub to min", SafeSub, -maxInt64, 1, 0, false},
+		{"sub overflow", SafeSub, maxInt64, -1, 0, false},
+		{"mul", SafeMul, -2, 3, -6, true},
+		{"mul zero", SafeMul, 0, maxInt64, 0, true},
+		{"mul max", SafeMul, maxInt64, -1, -maxInt64, true},
+		{"mul overflow", SafeMul, 1 << 62, 2, 0, false},
+		{"mul to min", SafeMul, 1 << 62, -2, 0, false},
+		{"mul large", SafeMul, 1 << 32, 1 << 32, 0, false},
+	}
+
+	for _, test := range tests {
+		result, ok := test.op(test.a, test.b)
+		assert.Equal(t, test.ok, ok, test.name)
+		if test.ok {
+			assert.Equal(t, test.result, result, test.name)
+		}
+	}
+}
+
+func TestGetScriptNum64Bit(t *testing.T) {
+	num, err := GetScriptNum(hexToBytes("ffffffffffffff7f"), true, MaxNumSize64Bit)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1<<63-1), num.Value)
+
+	num, err = GetScriptNum(hexToBytes("ffffffffffffffff"), true, MaxNumSize64Bit)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-(1<<63 - 1)), num.Value)
+
+	_, err = GetScriptNum(hexToBytes("000000000000000001"), true, MaxNumSize64Bit)
+	assert.Error(t, err)
+}
@@ -71,6 +71,9 @@ const (
 	/*MaxStandardTxSigOps the maximum number of sigops we're willing to relay/mine in a single tx */
 	MaxStandardTxSigOps = uint(consensus.MaxTxSigOpsCount / 5)
 
+	/*MaxStandardTxSigChecks the maximum number of SigChecks we're willing to relay/mine in a single tx */
+	MaxStandardTxSigChecks = 3000
+
 	/*DefaultMaxMemPoolSize default for -maxMemPool, maximum megabytes of memPool memory usage */
 	//DefaultMaxMemPoolSize uint = 300
 
@@ -406,7 +409,12 @@ func (tx *Tx) checkTransactionCommon() error {
 		}
 	}
 
-	// check sigopcount
+	return nil
+}
+
+// CheckSigOps checks the legacy sigops limit of a transaction, which is only
+// enforced before the May 2020 upgrade replaced sigops with SigChecks.
+func (tx *Tx) CheckSigOps() error {
 	sigOpCount := tx.GetSigOpCountWithoutP2SH(script.ScriptEnableCheckDataSig)
 	if sigOpCount > MaxTxSigOpsCounts {
 		log.Debug("bad tx: %s bad-txn-sigops :%d", tx.hash, sigOpCount)
@@ -564,7 +572,7 @@ func (tx *Tx) SignStep(nIn int, keyStore *crypto.KeyStore, redeemScript *script.
 func (tx *Tx) signOne(scriptPubKey *script.Script, privateKey *crypto.PrivateKey, hashType uint32,
 	nIn int, value amount.Amount) (signature *crypto.Signature, err error) {
 
-	hash, err := SignatureHash(tx, scriptPubKey, hashType, nIn, value, script.ScriptEnableSigHashForkID)
+	hash, err := SignatureHash(tx, scriptPubKey, hashType, nIn, value, script.ScriptEnableSigHashForkID, nil)
 	if err != nil {
 		return nil, err
 	}
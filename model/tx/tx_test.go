@@ -272,7 +272,9 @@ func Test_should_able_to_reject_txn_with__too_many_sigops(t *testing.T) {
 	txn.outs[0].SetScriptPubKey(makeDummyScript(MaxTxSigOpsCounts))
 	txn.outs[1].SetScriptPubKey(makeDummyScript(1))
 
-	err := txn.CheckRegularTransaction()
+	assert.NoError(t, txn.CheckRegularTransaction())
+
+	err := txn.CheckSigOps()
 
 	assertError(err, errcode.RejectInvalid, "bad-txn-sigops", t)
 }
@@ -3,18 +3,78 @@ package tx
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 
 	"github.com/copernet/copernicus/crypto"
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/outpoint"
 	"github.com/copernet/copernicus/model/script"
 	"github.com/copernet/copernicus/model/txout"
 	"github.com/copernet/copernicus/util"
 	"github.com/copernet/copernicus/util/amount"
 )
 
+var errSigHashUtxos = errors.New("SigHashUtxos requires the outputs spent by all the inputs")
+
+// ForkIDPreimage holds the parts of a transaction which are signed by a
+// signature with the fork id, see Hash.
+type ForkIDPreimage struct {
+	TxVersion       uint32
+	HashPrevOutputs util.Hash
+	// HashUtxos is the hash of the outputs spent by all the inputs, it is
+	// only signed with SigHashUtxos.
+	HashUtxos    *util.Hash
+	HashSequence util.Hash
+	OutPoint     *outpoint.OutPoint
+	// TokenData of the spent output, signed in front of the scriptCode.
+	TokenData   *txout.TokenData
+	ScriptCode  *script.Script
+	Value       amount.Amount
+	Sequence    uint32
+	HashOutputs util.Hash
+	LockTime    uint32
+	HashType    uint32
+}
+
+// Hash returns the signature hash of the preimage: the BIP143 digest of
+// Bitcoin Cash, extended by CashTokens with the hash of the spent outputs
+// after the hash of the previous outputs, and the token prefix of the spent
+// output in front of the scriptCode.
+func (p *ForkIDPreimage) Hash() (util.Hash, error) {
+	var buf bytes.Buffer
+	err := util.WriteElements(&buf, p.TxVersion, &p.HashPrevOutputs)
+	if err != nil {
+		return util.HashOne, err
+	}
+	if p.HashUtxos != nil {
+		buf.Write(p.HashUtxos[:])
+	}
+	buf.Write(p.HashSequence[:])
+	if err = p.OutPoint.Encode(&buf); err != nil {
+		return util.HashOne, err
+	}
+	if p.TokenData != nil {
+		if err = p.TokenData.Encode(&buf); err != nil {
+			return util.HashOne, err
+		}
+	}
+	if err = p.ScriptCode.Serialize(&buf); err != nil {
+		return util.HashOne, err
+	}
+	err = util.WriteElements(&buf, uint64(p.Value), p.Sequence, &p.HashOutputs, p.LockTime, p.HashType)
+	if err != nil {
+		return util.HashOne, err
+	}
+	return util.DoubleSha256Hash(buf.Bytes()), nil
+}
+
+// SignatureHash returns the hash signed for the input nIn of transaction,
+// spending money with scriptCode s.  spentOutputs are the outputs spent by
+// the inputs of transaction, in input order, they are required by the
+// signatures with SigHashUtxos and give the token data of the spent output.
 func SignatureHash(transaction *Tx, s *script.Script, hashType uint32, nIn int,
-	money amount.Amount, flags uint32) (result util.Hash, err error) {
+	money amount.Amount, flags uint32, spentOutputs []*txout.TxOut) (result util.Hash, err error) {
 
 	var hashBuffer bytes.Buffer
 	var sigHashAnyOneCanPay = false
@@ -39,75 +99,48 @@ func SignatureHash(transaction *Tx, s *script.Script, hashType uint32, nIn int,
 
 	if hashType&crypto.SigHashForkID == crypto.SigHashForkID &&
 		flags&script.ScriptEnableSigHashForkID == script.ScriptEnableSigHashForkID {
-		var hashPrevouts util.Hash
-		var hashSequence util.Hash
-		var hashOutputs util.Hash
-
+		in := transaction.GetIns()[nIn]
+		preimage := &ForkIDPreimage{
+			TxVersion:  uint32(transaction.GetVersion()),
+			OutPoint:   in.PreviousOutPoint,
+			ScriptCode: s,
+			Value:      money,
+			Sequence:   in.Sequence,
+			LockTime:   transaction.GetLockTime(),
+			HashType:   hashType,
+		}
+		tokens := flags&script.ScriptEnableTokens == script.ScriptEnableTokens
 		if !sigHashAnyOneCanPay {
-			hashPrevouts = GetPreviousOutHash(transaction)
+			preimage.HashPrevOutputs = GetPreviousOutHash(transaction)
+		}
+		if tokens && hashType&crypto.SigHashUtxos == crypto.SigHashUtxos {
+			// The outputs spent by every input are signed, which requires
+			// all of them and is meaningless when a single input is signed.
+			if sigHashAnyOneCanPay || len(spentOutputs) != len(transaction.GetIns()) {
+				log.Debug("txSignature: SigHashUtxos without the spent outputs of tx %s", transaction.GetHash())
+				return util.HashOne, errSigHashUtxos
+			}
+			hashUtxos, err := GetOutputsHash(spentOutputs)
+			if err != nil {
+				return util.HashOne, err
+			}
+			preimage.HashUtxos = &hashUtxos
 		}
 		if !sigHashAnyOneCanPay && !sigHashSingle && !sigHashNone {
-			hashSequence = GetSequenceHash(transaction)
+			preimage.HashSequence = GetSequenceHash(transaction)
 		}
 		if !sigHashSingle && !sigHashNone {
-			hashOutputs, _ = GetOutputsHash(transaction.GetOuts())
+			preimage.HashOutputs, err = GetOutputsHash(transaction.GetOuts())
 		} else if sigHashSingle && nIn < len(transaction.GetOuts()) {
-			hashOutputs, _ = GetOutputsHash(transaction.GetOuts()[nIn : nIn+1])
-		}
-
-		err := util.BinarySerializer.PutUint32(&hashBuffer, binary.LittleEndian, uint32(transaction.GetVersion()))
-		if err != nil {
-			log.Error("txSignature:push transaction.GetVersion() to hashBuffer failed: %v", err)
-			return util.HashOne, err
-		}
-		_, err = hashBuffer.Write(hashPrevouts[:])
-		if err != nil {
-			log.Error("txSignature:write hashPrevouts failed: %v", err)
-			return util.HashOne, err
-		}
-		_, err = hashBuffer.Write(hashSequence[:])
-		if err != nil {
-			log.Error("txSignature:write hashSequence failed: %v", err)
-			return util.HashOne, err
-		}
-		err = transaction.GetIns()[nIn].PreviousOutPoint.Encode(&hashBuffer)
-		if err != nil {
-			log.Error("txSignature:Previous OutPoint encode failed: %v", err)
-			return util.HashOne, err
-		}
-		err = s.Serialize(&hashBuffer)
-		if err != nil {
-			log.Error("txSignature:serialize hashBuffer failed: %v", err)
-			return util.HashOne, err
-		}
-		//input preout amount
-		err = util.BinarySerializer.PutUint64(&hashBuffer, binary.LittleEndian, uint64(money))
-		if err != nil {
-			log.Error("txSignature:push money to hashBuffer failed: %v", err)
-			return util.HashOne, err
-		}
-		err = util.BinarySerializer.PutUint32(&hashBuffer, binary.LittleEndian, transaction.GetIns()[nIn].Sequence)
-		if err != nil {
-			log.Error("txSignature:push transaction.GetIns()[nIn].Sequence to hashBuffer failed: %v", err)
-			return util.HashOne, err
+			preimage.HashOutputs, err = GetOutputsHash(transaction.GetOuts()[nIn : nIn+1])
 		}
-		_, err = hashBuffer.Write(hashOutputs[:])
 		if err != nil {
-			log.Error("txSignature:write hashOutputs failed: %v", err)
 			return util.HashOne, err
 		}
-		err = util.BinarySerializer.PutUint32(&hashBuffer, binary.LittleEndian, transaction.GetLockTime())
-		if err != nil {
-			log.Error("txSignature:push transaction.GetLockTime() to hashBuffer failed: %v", err)
-			return util.HashOne, err
-		}
-		err = util.BinarySerializer.PutUint32(&hashBuffer, binary.LittleEndian, hashType)
-		if err != nil {
-			log.Error("txSignature:push hashType to hashBuffer failed: %v", err)
-			return util.HashOne, err
+		if tokens && nIn < len(spentOutputs) {
+			preimage.TokenData = spentOutputs[nIn].GetTokenData()
 		}
-		result = util.DoubleSha256Hash(hashBuffer.Bytes())
-		return result, nil
+		return preimage.Hash()
 	}
 	// The SigHashSingle signature type signs only the corresponding input
 	// and output (the output with the same index number as the input).
@@ -321,3 +354,19 @@ func CheckSig(signHash util.Hash, vchSigIn []byte, vchPubKey []byte) bool {
 	ret := sign.Verify(signHash.GetCloneBytes(), publicKey)
 	return ret
 }
+
+// CheckSchnorrSig verifies a 64-byte Schnorr signature (without hash type)
+// against signHash.
+func CheckSchnorrSig(signHash util.Hash, vchSigIn []byte, vchPubKey []byte) bool {
+	if len(vchPubKey) == 0 {
+		return false
+	}
+	if len(vchSigIn) != crypto.SchnorrSignatureLen {
+		return false
+	}
+	publicKey, err := crypto.ParsePubKey(vchPubKey)
+	if err != nil {
+		return false
+	}
+	return publicKey.VerifySchnorr(&signHash, vchSigIn)
+}
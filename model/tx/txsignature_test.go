@@ -2,6 +2,7 @@ package tx
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"github.com/stretchr/testify/assert"
 	"math"
@@ -180,7 +181,7 @@ func TestSignHash(t *testing.T) {
 	preTestTx := testTxs[0]
 	testTx := testTxs[1]
 	txHash, err := SignatureHash(&testTx.tx, preTestTx.tx.GetTxOut(0).GetScriptPubKey(),
-		crypto.SigHashAll, 0, preTestTx.tx.GetTxOut(0).GetValue(), uint32(script.StandardScriptVerifyFlags))
+		crypto.SigHashAll, 0, preTestTx.tx.GetTxOut(0).GetValue(), uint32(script.StandardScriptVerifyFlags), nil)
 	if err != nil {
 		t.Error("chec signature failed")
 	}
@@ -732,7 +733,7 @@ func TestNonForkSignatureHash(t *testing.T) {
 		}
 
 		script := script.NewScriptRaw(b)
-		hash, err := SignatureHash(&tx, script, hashtype, inputIndex, 0, 0)
+		hash, err := SignatureHash(&tx, script, hashtype, inputIndex, 0, 0, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -754,22 +755,95 @@ func Test_SignatureHash(t *testing.T) {
 	testTx := testTxs[1]
 
 	txHash, err := SignatureHash(&testTx.tx, preTestTx.tx.GetTxOut(0).GetScriptPubKey(),
-		crypto.SigHashAll, 0, preTestTx.tx.GetTxOut(0).GetValue(), uint32(script.StandardScriptVerifyFlags))
+		crypto.SigHashAll, 0, preTestTx.tx.GetTxOut(0).GetValue(), uint32(script.StandardScriptVerifyFlags), nil)
 	assert.NoError(t, err)
 	assert.Equal(t, "L4rK1yDtCWekvXuE6oXD9jCYfFNV2cWRpVuPLBcCU2z8TrisoyY1", privateKey.ToString())
 	assert.Equal(t, "3417281973223488255177313250047195462208622636649993559694809589307248577318", txHash.ToBigInt().String())
 
 	txHash, err = SignatureHash(&testTx.tx, preTestTx.tx.GetTxOut(0).GetScriptPubKey(),
-		crypto.SigHashAll, 0, preTestTx.tx.GetTxOut(0).GetValue(), uint32(script.ScriptEnableReplayProtection))
+		crypto.SigHashAll, 0, preTestTx.tx.GetTxOut(0).GetValue(), uint32(script.ScriptEnableReplayProtection), nil)
 	assert.NoError(t, err)
 	assert.Equal(t, "c639a06c749f918e1e8040f1a92739b2706e0cdfedf10d828d17381de18fc4de", txHash.String())
 
 	txHash, err = SignatureHash(&testTx.tx, preTestTx.tx.GetTxOut(0).GetScriptPubKey(),
-		crypto.SigHashForkID, 0, preTestTx.tx.GetTxOut(0).GetValue(), uint32(script.ScriptEnableSigHashForkID))
+		crypto.SigHashForkID, 0, preTestTx.tx.GetTxOut(0).GetValue(), uint32(script.ScriptEnableSigHashForkID), nil)
 	assert.NoError(t, err)
 	assert.Equal(t, "29326e5bd1237ef68ea1ceaad654d08dc987f568b175aedf3054e17d307359a1", txHash.String())
 }
 
+// tokenSigHashPreimage assembles the CashTokens signature preimage of input
+// nIn field by field, independently of ForkIDPreimage.
+func tokenSigHashPreimage(t *testing.T, transaction *Tx, nIn int, spent []*txout.TxOut, hashType uint32) util.Hash {
+	var buf bytes.Buffer
+	le := func(v interface{}) {
+		assert.NoError(t, binary.Write(&buf, binary.LittleEndian, v))
+	}
+	in := transaction.GetIns()[nIn]
+	le(uint32(transaction.GetVersion()))
+	prevouts := GetPreviousOutHash(transaction)
+	buf.Write(prevouts[:])
+	if hashType&crypto.SigHashUtxos != 0 {
+		var utxos bytes.Buffer
+		for _, out := range spent {
+			assert.NoError(t, out.Serialize(&utxos))
+		}
+		hashUtxos := util.DoubleSha256Hash(utxos.Bytes())
+		buf.Write(hashUtxos[:])
+	}
+	sequences := GetSequenceHash(transaction)
+	buf.Write(sequences[:])
+	buf.Write(in.PreviousOutPoint.Hash[:])
+	le(in.PreviousOutPoint.Index)
+	if tokenData := spent[nIn].GetTokenData(); tokenData != nil {
+		assert.NoError(t, tokenData.Encode(&buf))
+	}
+	assert.NoError(t, util.WriteVarBytes(&buf, spent[nIn].GetScriptPubKey().Bytes()))
+	le(int64(spent[nIn].GetValue()))
+	le(in.Sequence)
+	outputs, err := GetOutputsHash(transaction.GetOuts())
+	assert.NoError(t, err)
+	buf.Write(outputs[:])
+	le(transaction.GetLockTime())
+	le(hashType)
+	return util.DoubleSha256Hash(buf.Bytes())
+}
+
+func TestSignatureHashTokens(t *testing.T) {
+	transaction := &testTxs[1].tx
+	category := util.HashFromString("e5f8f4f7a5e52a3a7d5c2b9c4e4b6a1f7e1b0c5d2a3f4e5d6c7b8a9f0e1d2c3b")
+	tokenData := txout.NewTokenData(*category, 5, true, txout.TokenCapabilityMutable, []byte{0xcc, 0xdd})
+	spent := testTxs[0].tx.GetTxOut(0)
+	tokenSpent := txout.NewTokenTxOut(spent.GetValue(), spent.GetScriptPubKey(), tokenData)
+	spentOutputs := []*txout.TxOut{tokenSpent}
+	scriptCode := tokenSpent.GetScriptPubKey()
+	flags := uint32(script.ScriptEnableSigHashForkID | script.ScriptEnableTokens)
+	sigHashAll := uint32(crypto.SigHashAll | crypto.SigHashForkID)
+	sigHashUtxos := sigHashAll | crypto.SigHashUtxos
+
+	// The token prefix of the spent output is signed in front of the scriptCode.
+	hash, err := SignatureHash(transaction, scriptCode, sigHashAll, 0, tokenSpent.GetValue(), flags, spentOutputs)
+	assert.NoError(t, err)
+	assert.Equal(t, tokenSigHashPreimage(t, transaction, 0, spentOutputs, sigHashAll), hash)
+
+	// Before CashTokens, neither the token prefix nor the spent outputs are signed.
+	legacy, err := SignatureHash(transaction, scriptCode, sigHashAll, 0, tokenSpent.GetValue(),
+		uint32(script.ScriptEnableSigHashForkID), spentOutputs)
+	assert.NoError(t, err)
+	assert.Equal(t, tokenSigHashPreimage(t, transaction, 0, []*txout.TxOut{spent}, sigHashAll), legacy)
+	assert.NotEqual(t, hash, legacy)
+
+	// SigHashUtxos also signs the outputs spent by all the inputs.
+	hash, err = SignatureHash(transaction, scriptCode, sigHashUtxos, 0, tokenSpent.GetValue(), flags, spentOutputs)
+	assert.NoError(t, err)
+	assert.Equal(t, tokenSigHashPreimage(t, transaction, 0, spentOutputs, sigHashUtxos), hash)
+
+	_, err = SignatureHash(transaction, scriptCode, sigHashUtxos, 0, tokenSpent.GetValue(), flags, nil)
+	assert.Equal(t, errSigHashUtxos, err)
+	_, err = SignatureHash(transaction, scriptCode, sigHashUtxos|crypto.SigHashAnyoneCanpay, 0,
+		tokenSpent.GetValue(), flags, spentOutputs)
+	assert.Equal(t, errSigHashUtxos, err)
+}
+
 func Test_GetPreviousOutHash(t *testing.T) {
 	h := GetPreviousOutHash(&testTxs[0].tx)
 	assert.Equal(t, "284316979cb69928ffb64d41cc0d1f4491ccc094afbaef034daaefa3bec2263a", h.String())
@@ -808,3 +882,23 @@ func Test_CheckSig(t *testing.T) {
 	}
 	assert.False(t, CheckSig(h, sigIn, privateKey.PubKey().ToBytes()))
 }
+
+func Test_CheckSchnorrSig(t *testing.T) {
+	crypto.InitSecp256()
+
+	privateKey, err := crypto.DecodePrivateKey("L4rK1yDtCWekvXuE6oXD9jCYfFNV2cWRpVuPLBcCU2z8TrisoyY1")
+	if err != nil {
+		t.Error(err)
+	}
+	h := util.DoubleSha256Hash([]byte{0, 1, 2})
+	sig, err := privateKey.SignSchnorr(h.GetCloneBytes())
+	assert.NoError(t, err)
+
+	assert.True(t, CheckSchnorrSig(h, sig, privateKey.PubKey().ToBytes()))
+	assert.False(t, CheckSchnorrSig(h, sig, []byte{}))
+	assert.False(t, CheckSchnorrSig(h, sig[:63], privateKey.PubKey().ToBytes()))
+	assert.False(t, CheckSig(h, sig, privateKey.PubKey().ToBytes()))
+
+	other := util.DoubleSha256Hash([]byte{3, 4, 5})
+	assert.False(t, CheckSchnorrSig(other, sig, privateKey.PubKey().ToBytes()))
+}
@@ -281,6 +281,12 @@ func (tc *TxoutCompressor) Serialize(w io.Writer) error {
 	if err := util.WriteVarLenInt(w, count); err != nil {
 		return err
 	}
+	if tc.txout.tokenData != nil {
+		// The token prefix is stored in front of the script. Since it starts
+		// with PrefixToken, such scripts are never compressed.
+		wrapped := script.NewScriptRaw(tc.txout.GetWrappedScriptPubKey())
+		return newScriptCompressor(&wrapped).Serialize(w)
+	}
 	return tc.sc.Serialize(w)
 }
 
@@ -294,5 +300,12 @@ func (tc *TxoutCompressor) Unserialize(r io.Reader) error {
 		return err
 	}
 	tc.txout.value = DecompressAmount(count)
-	return tc.sc.Unserialize(r)
+	tc.txout.tokenData = nil
+	if err := tc.sc.Unserialize(r); err != nil {
+		return err
+	}
+	if data := tc.txout.scriptPubKey.GetData(); len(data) > 0 && data[0] == PrefixToken {
+		tc.txout.SetWrappedScriptPubKey(data)
+	}
+	return nil
 }
@@ -0,0 +1,229 @@
+package txout
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/copernet/copernicus/util"
+)
+
+// CashTokens (CHIP-2022-02) are carried by a prefix of the serialized locking
+// bytecode of an output:
+//
+//	PrefixToken category(32) bitfield [commitment_length commitment] [amount]
+const (
+	// PrefixToken is the first byte of the token prefix. Being an undefined
+	// opcode, it made any locking bytecode starting with it unspendable before
+	// tokens were activated.
+	PrefixToken = 0xef
+
+	// MaxTokenCommitmentLength is the maximum length of an NFT commitment.
+	MaxTokenCommitmentLength = 40
+
+	// MaxTokenAmount is the maximum fungible token amount of an output.
+	MaxTokenAmount = math.MaxInt64
+)
+
+// Bits of the token bitfield. The low nibble holds the NFT capability.
+const (
+	TokenReserved            = 0x80
+	TokenHasCommitmentLength = 0x40
+	TokenHasNFT              = 0x20
+	TokenHasAmount           = 0x10
+	TokenCapabilityMask      = 0x0f
+)
+
+// NFT capabilities.
+const (
+	TokenCapabilityNone    = 0x00
+	TokenCapabilityMutable = 0x01
+	TokenCapabilityMinting = 0x02
+)
+
+var errBadTokenPrefix = errors.New("invalid token prefix")
+
+// TokenData is the token payload of an output: an amount of fungible tokens
+// and/or a non-fungible token of a category.
+type TokenData struct {
+	Category   util.Hash
+	Bitfield   byte
+	Commitment []byte
+	Amount     int64
+}
+
+// NewTokenData builds token data from its parts. Without hasNFT, only fungible
+// tokens are created and capability and commitment are ignored.
+func NewTokenData(category util.Hash, amount int64, hasNFT bool, capability byte, commitment []byte) *TokenData {
+	td := &TokenData{Category: category, Amount: amount}
+	if hasNFT {
+		td.Bitfield |= TokenHasNFT | capability&TokenCapabilityMask
+		if len(commitment) > 0 {
+			td.Bitfield |= TokenHasCommitmentLength
+			td.Commitment = append([]byte(nil), commitment...)
+		}
+	}
+	if amount > 0 {
+		td.Bitfield |= TokenHasAmount
+	}
+	return td
+}
+
+func (td *TokenData) HasNFT() bool {
+	return td.Bitfield&TokenHasNFT != 0
+}
+
+func (td *TokenData) HasAmount() bool {
+	return td.Bitfield&TokenHasAmount != 0
+}
+
+func (td *TokenData) GetCapability() byte {
+	return td.Bitfield & TokenCapabilityMask
+}
+
+func (td *TokenData) IsMutableNFT() bool {
+	return td.HasNFT() && td.GetCapability() == TokenCapabilityMutable
+}
+
+func (td *TokenData) IsMintingNFT() bool {
+	return td.HasNFT() && td.GetCapability() == TokenCapabilityMinting
+}
+
+func (td *TokenData) IsImmutableNFT() bool {
+	return td.HasNFT() && td.GetCapability() == TokenCapabilityNone
+}
+
+// CapabilityString returns the capability name used by the RPC interface.
+func (td *TokenData) CapabilityString() string {
+	switch td.GetCapability() {
+	case TokenCapabilityMutable:
+		return "mutable"
+	case TokenCapabilityMinting:
+		return "minting"
+	default:
+		return "none"
+	}
+}
+
+// IsValid checks the consistency rules that every serialized token prefix
+// must satisfy.
+func (td *TokenData) IsValid() bool {
+	if td.Bitfield&TokenReserved != 0 || td.GetCapability() > TokenCapabilityMinting {
+		return false
+	}
+	if !td.HasNFT() && (td.GetCapability() != TokenCapabilityNone || td.Bitfield&TokenHasCommitmentLength != 0) {
+		return false
+	}
+	if !td.HasNFT() && !td.HasAmount() {
+		return false
+	}
+	if td.Bitfield&TokenHasCommitmentLength != 0 {
+		if len(td.Commitment) == 0 || len(td.Commitment) > MaxTokenCommitmentLength {
+			return false
+		}
+	} else if len(td.Commitment) != 0 {
+		return false
+	}
+	if td.HasAmount() {
+		return td.Amount > 0
+	}
+	return td.Amount == 0
+}
+
+func (td *TokenData) IsEqual(other *TokenData) bool {
+	if td == nil || other == nil {
+		return td == other
+	}
+	return td.Category == other.Category && td.Bitfield == other.Bitfield &&
+		td.Amount == other.Amount && bytes.Equal(td.Commitment, other.Commitment)
+}
+
+func (td *TokenData) Copy() *TokenData {
+	if td == nil {
+		return nil
+	}
+	c := *td
+	c.Commitment = append([]byte(nil), td.Commitment...)
+	return &c
+}
+
+func (td *TokenData) String() string {
+	return fmt.Sprintf("Category:%s Bitfield:%02x Commitment:%x Amount:%d",
+		td.Category, td.Bitfield, td.Commitment, td.Amount)
+}
+
+// EncodeSize returns the size of the token prefix, including PrefixToken.
+func (td *TokenData) EncodeSize() uint32 {
+	size := 1 + uint32(util.Hash256Size) + 1
+	if td.Bitfield&TokenHasCommitmentLength != 0 {
+		size += util.VarIntSerializeSize(uint64(len(td.Commitment))) + uint32(len(td.Commitment))
+	}
+	if td.HasAmount() {
+		size += util.VarIntSerializeSize(uint64(td.Amount))
+	}
+	return size
+}
+
+// Encode writes the token prefix, including PrefixToken.
+func (td *TokenData) Encode(writer io.Writer) error {
+	if _, err := writer.Write([]byte{PrefixToken}); err != nil {
+		return err
+	}
+	if _, err := writer.Write(td.Category[:]); err != nil {
+		return err
+	}
+	if _, err := writer.Write([]byte{td.Bitfield}); err != nil {
+		return err
+	}
+	if td.Bitfield&TokenHasCommitmentLength != 0 {
+		if err := util.WriteVarBytes(writer, td.Commitment); err != nil {
+			return err
+		}
+	}
+	if td.HasAmount() {
+		return util.WriteVarInt(writer, uint64(td.Amount))
+	}
+	return nil
+}
+
+// decodeTokenPrefix splits a serialized locking bytecode into its token data
+// and the locking bytecode proper. data must start with PrefixToken.
+func decodeTokenPrefix(data []byte) (*TokenData, []byte, error) {
+	reader := bytes.NewReader(data)
+	prefix, err := reader.ReadByte()
+	if err != nil || prefix != PrefixToken {
+		return nil, nil, errBadTokenPrefix
+	}
+
+	td := new(TokenData)
+	if _, err := io.ReadFull(reader, td.Category[:]); err != nil {
+		return nil, nil, errBadTokenPrefix
+	}
+	if td.Bitfield, err = reader.ReadByte(); err != nil {
+		return nil, nil, errBadTokenPrefix
+	}
+	if td.Bitfield&TokenHasCommitmentLength != 0 {
+		length, err := util.ReadVarInt(reader)
+		if err != nil || length == 0 || length > MaxTokenCommitmentLength {
+			return nil, nil, errBadTokenPrefix
+		}
+		td.Commitment = make([]byte, length)
+		if _, err := io.ReadFull(reader, td.Commitment); err != nil {
+			return nil, nil, errBadTokenPrefix
+		}
+	}
+	if td.HasAmount() {
+		amount, err := util.ReadVarInt(reader)
+		if err != nil || amount == 0 || amount > MaxTokenAmount {
+			return nil, nil, errBadTokenPrefix
+		}
+		td.Amount = int64(amount)
+	}
+	if !td.IsValid() {
+		return nil, nil, errBadTokenPrefix
+	}
+
+	return td, data[len(data)-reader.Len():], nil
+}
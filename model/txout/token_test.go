@@ -0,0 +1,148 @@
+package txout
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	tokenCategory = util.Hash{0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb,
+		0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb}
+	tokenCategoryHex = strings.Repeat("bb", 32)
+)
+
+func TestTokenData_Encode(t *testing.T) {
+	tests := []struct {
+		name      string
+		tokenData *TokenData
+		prefix    string
+	}{
+		{"fungible", NewTokenData(tokenCategory, 1, false, 0, nil), "ef" + tokenCategoryHex + "1001"},
+		{"fungible 253", NewTokenData(tokenCategory, 253, false, 0, nil), "ef" + tokenCategoryHex + "10fdfd00"},
+		{"max amount", NewTokenData(tokenCategory, MaxTokenAmount, false, 0, nil),
+			"ef" + tokenCategoryHex + "10ffffffffffffffff7f"},
+		{"immutable NFT", NewTokenData(tokenCategory, 0, true, TokenCapabilityNone, nil), "ef" + tokenCategoryHex + "20"},
+		{"mutable NFT", NewTokenData(tokenCategory, 0, true, TokenCapabilityMutable, nil), "ef" + tokenCategoryHex + "21"},
+		{"minting NFT with commitment", NewTokenData(tokenCategory, 0, true, TokenCapabilityMinting, []byte{0xcc}),
+			"ef" + tokenCategoryHex + "6201cc"},
+		{"NFT and amount", NewTokenData(tokenCategory, 5, true, TokenCapabilityNone, []byte{0xcc, 0xdd}),
+			"ef" + tokenCategoryHex + "7002ccdd05"},
+	}
+
+	for _, test := range tests {
+		assert.True(t, test.tokenData.IsValid(), test.name)
+
+		var buf bytes.Buffer
+		assert.NoError(t, test.tokenData.Encode(&buf), test.name)
+		assert.Equal(t, test.prefix, hex.EncodeToString(buf.Bytes()), test.name)
+		assert.Equal(t, uint32(buf.Len()), test.tokenData.EncodeSize(), test.name)
+
+		// The locking bytecode follows the prefix.
+		decoded, scriptPubKey, err := decodeTokenPrefix(append(buf.Bytes(), 0x51))
+		assert.NoError(t, err, test.name)
+		assert.True(t, decoded.IsEqual(test.tokenData), test.name)
+		assert.Equal(t, []byte{0x51}, scriptPubKey, test.name)
+	}
+}
+
+func TestDecodeTokenPrefix_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+	}{
+		{"no prefix byte", "51"},
+		{"truncated category", "ef" + tokenCategoryHex[:62]},
+		{"missing bitfield", "ef" + tokenCategoryHex},
+		{"no tokens", "ef" + tokenCategoryHex + "00"},
+		{"reserved bit", "ef" + tokenCategoryHex + "b001"},
+		{"bad capability", "ef" + tokenCategoryHex + "23"},
+		{"capability without NFT", "ef" + tokenCategoryHex + "1101"},
+		{"commitment without NFT", "ef" + tokenCategoryHex + "5001cc01"},
+		{"empty commitment", "ef" + tokenCategoryHex + "6000"},
+		{"truncated commitment", "ef" + tokenCategoryHex + "6002cc"},
+		{"commitment too long", "ef" + tokenCategoryHex + "6029" + strings.Repeat("cc", 41)},
+		{"zero amount", "ef" + tokenCategoryHex + "1000"},
+		{"non-minimal amount", "ef" + tokenCategoryHex + "10fd0100"},
+		{"amount too large", "ef" + tokenCategoryHex + "10ff0000000000000080"},
+		{"missing amount", "ef" + tokenCategoryHex + "10"},
+	}
+
+	for _, test := range tests {
+		data, err := hex.DecodeString(test.prefix)
+		assert.NoError(t, err, test.name)
+		_, _, err = decodeTokenPrefix(data)
+		assert.Error(t, err, test.name)
+	}
+}
+
+func TestTxOut_TokenSerialize(t *testing.T) {
+	tokenData := NewTokenData(tokenCategory, 5, true, TokenCapabilityMutable, []byte{0xcc, 0xdd})
+	out := NewTokenTxOut(1000, script1, tokenData)
+
+	var buf bytes.Buffer
+	assert.NoError(t, out.Encode(&buf))
+	assert.Equal(t, out.EncodeSize(), uint32(buf.Len()))
+
+	// value, length of the prefix and script, prefix, script
+	expect := "e803000000000000" + "3b" + "ef" + tokenCategoryHex + "7102ccdd05" + hex.EncodeToString(myscript)
+	assert.Equal(t, expect, hex.EncodeToString(buf.Bytes()))
+
+	decoded := &TxOut{}
+	assert.NoError(t, decoded.Decode(bytes.NewReader(buf.Bytes())))
+	assert.True(t, decoded.IsEqual(out))
+	assert.True(t, decoded.HasTokenData())
+	assert.False(t, decoded.HasInvalidTokenPrefix())
+	assert.Equal(t, myscript, decoded.GetScriptPubKey().GetData())
+
+	// Token data is part of the output.
+	assert.False(t, decoded.IsEqual(NewTxOut(1000, script1)))
+}
+
+func TestTxOut_InvalidTokenPrefix(t *testing.T) {
+	// An empty commitment is not a valid token prefix, so the whole field is
+	// kept as the scriptPubKey and serializes back unchanged.
+	field, _ := hex.DecodeString("ef" + tokenCategoryHex + "6000" + "51")
+	var buf bytes.Buffer
+	buf.Write([]byte{1, 0, 0, 0, 0, 0, 0, 0})
+	assert.NoError(t, util.WriteVarBytes(&buf, field))
+	serialized := buf.Bytes()
+
+	decoded := &TxOut{}
+	assert.NoError(t, decoded.Decode(bytes.NewReader(serialized)))
+	assert.False(t, decoded.HasTokenData())
+	assert.True(t, decoded.HasInvalidTokenPrefix())
+	assert.Equal(t, field, decoded.GetScriptPubKey().GetData())
+
+	var reencoded bytes.Buffer
+	assert.NoError(t, decoded.Encode(&reencoded))
+	assert.Equal(t, serialized, reencoded.Bytes())
+
+	assert.False(t, NewTxOut(1, script1).HasInvalidTokenPrefix())
+	assert.False(t, NewTxOut(1, script.NewEmptyScript()).HasInvalidTokenPrefix())
+}
+
+func TestTxoutCompressor_Token(t *testing.T) {
+	p2pkh, _ := hex.DecodeString("76a914" + strings.Repeat("11", 20) + "88ac")
+	tokenData := NewTokenData(tokenCategory, 42, false, 0, nil)
+	out := NewTokenTxOut(5000, script.NewScriptRaw(p2pkh), tokenData)
+
+	var buf bytes.Buffer
+	assert.NoError(t, NewTxoutCompressor(out).Serialize(&buf))
+
+	decoded := NewTxOut(0, nil)
+	assert.NoError(t, NewTxoutCompressor(decoded).Unserialize(&buf))
+	assert.True(t, decoded.IsEqual(out))
+	assert.Equal(t, p2pkh, decoded.GetScriptPubKey().GetData())
+
+	// Reusing the output for a plain coin drops the token data.
+	buf.Reset()
+	assert.NoError(t, NewTxoutCompressor(NewTxOut(5000, script.NewScriptRaw(p2pkh))).Serialize(&buf))
+	assert.NoError(t, NewTxoutCompressor(decoded).Unserialize(&buf))
+	assert.False(t, decoded.HasTokenData())
+}
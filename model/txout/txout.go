@@ -1,6 +1,7 @@
 package txout
 
 import (
+	"bytes"
 	"io"
 
 	"encoding/binary"
@@ -16,6 +17,7 @@ import (
 type TxOut struct {
 	value        amount.Amount
 	scriptPubKey *script.Script
+	tokenData    *TokenData
 }
 
 func (txOut *TxOut) SerializeSize() uint32 {
@@ -31,6 +33,13 @@ func (txOut *TxOut) Unserialize(reader io.Reader) error {
 }
 
 func (txOut *TxOut) EncodeSize() uint32 {
+	if txOut.tokenData != nil {
+		size := txOut.tokenData.EncodeSize()
+		if txOut.scriptPubKey != nil {
+			size += uint32(txOut.scriptPubKey.Size())
+		}
+		return 8 + util.VarIntSerializeSize(uint64(size)) + size
+	}
 	return 8 + txOut.scriptPubKey.EncodeSize()
 }
 
@@ -39,6 +48,9 @@ func (txOut *TxOut) Encode(writer io.Writer) error {
 	if err != nil {
 		return err
 	}
+	if txOut.tokenData != nil {
+		return util.WriteVarBytes(writer, txOut.GetWrappedScriptPubKey())
+	}
 	if txOut.scriptPubKey == nil {
 		return util.WriteVarInt(writer, 0)
 	}
@@ -51,10 +63,37 @@ func (txOut *TxOut) Decode(reader io.Reader) error {
 		return err
 	}
 	bytes, err := script.ReadScript(reader, script.MaxMessagePayload, "tx output script")
-	txOut.scriptPubKey = script.NewScriptRaw(bytes)
+	txOut.SetWrappedScriptPubKey(bytes)
 	return err
 }
 
+// GetWrappedScriptPubKey returns the serialized locking bytecode field of the
+// output, i.e. the token prefix, if any, followed by the scriptPubKey.
+func (txOut *TxOut) GetWrappedScriptPubKey() []byte {
+	var buf bytes.Buffer
+	if txOut.tokenData != nil {
+		txOut.tokenData.Encode(&buf)
+	}
+	if txOut.scriptPubKey != nil {
+		buf.Write(txOut.scriptPubKey.GetData())
+	}
+	return buf.Bytes()
+}
+
+// SetWrappedScriptPubKey splits a serialized locking bytecode field into the
+// token data and the scriptPubKey. A malformed token prefix is kept as part
+// of the scriptPubKey, see HasInvalidTokenPrefix.
+func (txOut *TxOut) SetWrappedScriptPubKey(data []byte) {
+	txOut.tokenData = nil
+	if len(data) > 0 && data[0] == PrefixToken {
+		if tokenData, scriptPubKey, err := decodeTokenPrefix(data); err == nil {
+			txOut.tokenData = tokenData
+			data = scriptPubKey
+		}
+	}
+	txOut.scriptPubKey = script.NewScriptRaw(data)
+}
+
 func (txOut *TxOut) IsDust(minRelayTxFee *util.FeeRate) bool {
 	return txOut.value < amount.Amount(txOut.GetDustThreshold(minRelayTxFee))
 }
@@ -127,6 +166,26 @@ func (txOut *TxOut) GetScriptPubKey() *script.Script {
 func (txOut *TxOut) SetScriptPubKey(s *script.Script) {
 	txOut.scriptPubKey = s
 }
+func (txOut *TxOut) GetTokenData() *TokenData {
+	return txOut.tokenData
+}
+func (txOut *TxOut) SetTokenData(tokenData *TokenData) {
+	txOut.tokenData = tokenData
+}
+func (txOut *TxOut) HasTokenData() bool {
+	return txOut.tokenData != nil
+}
+
+// HasInvalidTokenPrefix returns whether the locking bytecode of the output
+// starts with PrefixToken without being a valid token prefix. Such outputs are
+// invalid once tokens are activated.
+func (txOut *TxOut) HasInvalidTokenPrefix() bool {
+	if txOut.tokenData != nil || txOut.scriptPubKey == nil {
+		return false
+	}
+	data := txOut.scriptPubKey.GetData()
+	return len(data) > 0 && data[0] == PrefixToken
+}
 
 // IsSpendable returns whether the TxOut can be spent or not,
 // but doesn't care whether it has already been spent or not
@@ -141,12 +200,17 @@ func (txOut *TxOut) IsSpendable() bool {
 func (txOut *TxOut) SetNull() {
 	txOut.value = -1
 	txOut.scriptPubKey = nil
+	txOut.tokenData = nil
 }
 
 func (txOut *TxOut) IsNull() bool {
 	return txOut.value == -1 //&& txOut.scriptPubKey == nil
 }
 func (txOut *TxOut) String() string {
+	if txOut.tokenData != nil {
+		return fmt.Sprintf("Value :%d Script:%s Token:%s", txOut.value,
+			hex.EncodeToString(txOut.scriptPubKey.GetData()), txOut.tokenData)
+	}
 	return fmt.Sprintf("Value :%d Script:%s", txOut.value, hex.EncodeToString(txOut.scriptPubKey.GetData()))
 }
 
@@ -154,6 +218,9 @@ func (txOut *TxOut) IsEqual(out *TxOut) bool {
 	if txOut.value != out.value {
 		return false
 	}
+	if !txOut.tokenData.IsEqual(out.tokenData) {
+		return false
+	}
 
 	return txOut.scriptPubKey.IsEqual(out.scriptPubKey)
 }
@@ -169,3 +236,10 @@ func NewTxOut(value amount.Amount, scriptPubKey *script.Script) *TxOut {
 
 	return &txOut
 }
+
+// NewTokenTxOut creates an output carrying tokenData.
+func NewTokenTxOut(value amount.Amount, scriptPubKey *script.Script, tokenData *TokenData) *TxOut {
+	txOut := NewTxOut(value, scriptPubKey)
+	txOut.tokenData = tokenData.Copy()
+	return txOut
+}
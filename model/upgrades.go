@@ -0,0 +1,167 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/model/consensus"
+)
+
+// Upgrade describes a network upgrade, which activates either at a block
+// height or once the median time past of the previous block reaches a time.
+type Upgrade struct {
+	Name string
+
+	height   func(param *consensus.Param) *int32
+	time     func(param *consensus.Param) *int64
+	override func() int64
+}
+
+var (
+	UAHFUpgrade = &Upgrade{
+		Name:   "uahf",
+		height: func(param *consensus.Param) *int32 { return &param.UAHFHeight },
+	}
+	DAAUpgrade = &Upgrade{
+		Name:   "daa",
+		height: func(param *consensus.Param) *int32 { return &param.DAAHeight },
+	}
+	MagneticAnomalyUpgrade = &Upgrade{
+		Name:     "magneticanomaly",
+		time:     func(param *consensus.Param) *int64 { return &param.MagneticAnomalyActivationTime },
+		override: func() int64 { return conf.Args.MagneticAnomalyTime },
+	}
+	GreatWallUpgrade = &Upgrade{
+		Name:     "greatwall",
+		time:     func(param *consensus.Param) *int64 { return &param.GreatWallActivationTime },
+		override: func() int64 { return conf.Args.GreatWallTime },
+	}
+	GravitonUpgrade = &Upgrade{
+		Name:     "graviton",
+		time:     func(param *consensus.Param) *int64 { return &param.GravitonActivationTime },
+		override: func() int64 { return conf.Args.GravitonTime },
+	}
+	PhononUpgrade = &Upgrade{
+		Name:     "phonon",
+		time:     func(param *consensus.Param) *int64 { return &param.PhononActivationTime },
+		override: func() int64 { return conf.Args.PhononTime },
+	}
+	AxionUpgrade = &Upgrade{
+		Name:     "axion",
+		time:     func(param *consensus.Param) *int64 { return &param.AxionActivationTime },
+		override: func() int64 { return conf.Args.AxionTime },
+	}
+	Upgrade8Upgrade = &Upgrade{
+		Name:     "upgrade8",
+		time:     func(param *consensus.Param) *int64 { return &param.Upgrade8ActivationTime },
+		override: func() int64 { return conf.Args.Upgrade8Time },
+	}
+	Upgrade9Upgrade = &Upgrade{
+		Name:     "upgrade9",
+		time:     func(param *consensus.Param) *int64 { return &param.Upgrade9ActivationTime },
+		override: func() int64 { return conf.Args.Upgrade9Time },
+	}
+
+	// Upgrades lists the known upgrades in activation order. The May 2018
+	// upgrade is not one of them: its rules apply to every block.
+	Upgrades = []*Upgrade{
+		UAHFUpgrade,
+		DAAUpgrade,
+		MagneticAnomalyUpgrade,
+		GreatWallUpgrade,
+		GravitonUpgrade,
+		PhononUpgrade,
+		AxionUpgrade,
+		Upgrade8Upgrade,
+		Upgrade9Upgrade,
+	}
+)
+
+// IsHeightBased reports whether the upgrade activates at a block height.
+func (u *Upgrade) IsHeightBased() bool {
+	return u.height != nil
+}
+
+// ActivationHeight returns the height of the first block following the
+// upgrade rules, for height based upgrades.
+func (u *Upgrade) ActivationHeight(params *BitcoinParams) int32 {
+	if !u.IsHeightBased() {
+		return 0
+	}
+	return *u.height(&params.Param)
+}
+
+// ActivationTime returns the median time past from which the upgrade rules
+// apply, for time based upgrades. A per upgrade activation time given on the
+// command line takes precedence.
+func (u *Upgrade) ActivationTime(params *BitcoinParams) int64 {
+	if u.IsHeightBased() {
+		return 0
+	}
+	if u.override != nil && conf.Args != nil {
+		if activeTime := u.override(); activeTime > 0 {
+			return activeTime
+		}
+	}
+	return *u.time(&params.Param)
+}
+
+// IsActive reports whether the upgrade rules apply to the block following the
+// block at height with the median time past medianTimePast.
+func (u *Upgrade) IsActive(params *BitcoinParams, height int32, medianTimePast int64) bool {
+	if u.IsHeightBased() {
+		return height >= u.ActivationHeight(params)
+	}
+	return medianTimePast >= u.ActivationTime(params)
+}
+
+// GetUpgrade returns the upgrade called name, or nil if it is unknown.
+func GetUpgrade(name string) *Upgrade {
+	for _, upgrade := range Upgrades {
+		if upgrade.Name == name {
+			return upgrade
+		}
+	}
+	return nil
+}
+
+// ApplyUpgradeOverrides shifts the activation of upgrades of params, which
+// must be the regtest or testnet parameters. Each override has the form
+// <upgrade>=<value>, where value is an activation height or time depending
+// on the upgrade.
+func ApplyUpgradeOverrides(params *BitcoinParams, overrides []string) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	if params.Name != RegressionNetParams.Name && params.Name != TestNetParams.Name {
+		return fmt.Errorf("upgrade activations can only be overridden on regtest or testnet, not on %s",
+			params.Name)
+	}
+
+	for _, override := range overrides {
+		parts := strings.SplitN(override, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid upgrade activation %q, expect <upgrade>=<value>", override)
+		}
+		upgrade := GetUpgrade(strings.ToLower(strings.TrimSpace(parts[0])))
+		if upgrade == nil {
+			return fmt.Errorf("unknown upgrade %q", parts[0])
+		}
+		value, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil || value < 0 {
+			return fmt.Errorf("invalid activation of upgrade %s: %q", upgrade.Name, parts[1])
+		}
+
+		if upgrade.IsHeightBased() {
+			if value > int64(^uint32(0)>>1) {
+				return fmt.Errorf("invalid activation height of upgrade %s: %d", upgrade.Name, value)
+			}
+			*upgrade.height(&params.Param) = int32(value)
+		} else {
+			*upgrade.time(&params.Param) = value
+		}
+	}
+	return nil
+}
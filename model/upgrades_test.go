@@ -0,0 +1,96 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyUpgradeOverrides(t *testing.T) {
+	params := RegressionNetParams
+	err := ApplyUpgradeOverrides(&params, []string{"uahf=10", "daa=20", " Graviton = 300", "magneticanomaly=400",
+		"phonon=500", "upgrade9=600"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(10), params.UAHFHeight)
+	assert.Equal(t, int32(20), params.DAAHeight)
+	assert.Equal(t, int64(300), params.GravitonActivationTime)
+	assert.Equal(t, int64(400), params.MagneticAnomalyActivationTime)
+	assert.Equal(t, int64(500), params.PhononActivationTime)
+	assert.Equal(t, int64(600), params.Upgrade9ActivationTime)
+	assert.Equal(t, RegressionNetParams.AxionActivationTime, params.AxionActivationTime)
+
+	// The shared parameters are untouched.
+	assert.NotEqual(t, int32(10), RegressionNetParams.UAHFHeight)
+
+	testNet := TestNetParams
+	assert.NoError(t, ApplyUpgradeOverrides(&testNet, []string{"axion=100"}))
+	assert.Equal(t, int64(100), testNet.AxionActivationTime)
+
+	mainNet := MainNetParams
+	assert.NoError(t, ApplyUpgradeOverrides(&mainNet, nil))
+	assert.Error(t, ApplyUpgradeOverrides(&mainNet, []string{"axion=100"}))
+	assert.Equal(t, MainNetParams.AxionActivationTime, mainNet.AxionActivationTime)
+
+	for _, override := range []string{"axion", "axion=", "axion=abc", "axion=-1", "unknown=100",
+		"uahf=4294967296", "monolith=100"} {
+		assert.Error(t, ApplyUpgradeOverrides(&params, []string{override}), override)
+	}
+}
+
+func TestUpgradeIsActive(t *testing.T) {
+	params := RegressionNetParams
+	assert.NoError(t, ApplyUpgradeOverrides(&params, []string{"daa=20", "graviton=1000"}))
+
+	assert.True(t, DAAUpgrade.IsHeightBased())
+	assert.Equal(t, int32(20), DAAUpgrade.ActivationHeight(&params))
+	assert.Equal(t, int64(0), DAAUpgrade.ActivationTime(&params))
+	assert.False(t, DAAUpgrade.IsActive(&params, 19, 0))
+	assert.True(t, DAAUpgrade.IsActive(&params, 20, 0))
+
+	assert.False(t, GravitonUpgrade.IsHeightBased())
+	assert.Equal(t, int32(0), GravitonUpgrade.ActivationHeight(&params))
+	assert.Equal(t, int64(1000), GravitonUpgrade.ActivationTime(&params))
+	assert.False(t, GravitonUpgrade.IsActive(&params, 100, 999))
+	assert.True(t, GravitonUpgrade.IsActive(&params, 0, 1000))
+
+	// A per upgrade activation time from the command line takes precedence.
+	conf.Args.GravitonTime = 2000
+	defer func() { conf.Args.GravitonTime = -1 }()
+	assert.Equal(t, int64(2000), GravitonUpgrade.ActivationTime(&params))
+	assert.False(t, GravitonUpgrade.IsActive(&params, 0, 1999))
+}
+
+func TestIsEnabledFollowsUpgradeOverrides(t *testing.T) {
+	defer SetRegTestParams()
+	params := RegressionNetParams
+	assert.NoError(t, ApplyUpgradeOverrides(&params, []string{"uahf=5", "magneticanomaly=100", "upgrade8=200"}))
+	ActiveNetParams = &params
+
+	assert.False(t, IsUAHFEnabled(4))
+	assert.True(t, IsUAHFEnabled(5))
+	assert.False(t, IsMagneticAnomalyEnabled(99))
+	assert.True(t, IsMagneticAnomalyEnabled(100))
+	assert.False(t, IsUpgrade8Enabled(199))
+	assert.True(t, IsUpgrade8Enabled(200))
+}
+
+func TestReplayProtectionIgnoresUpgradeOverrides(t *testing.T) {
+	defer SetRegTestParams()
+	params := RegressionNetParams
+	assert.NoError(t, ApplyUpgradeOverrides(&params, []string{"greatwall=100", "upgrade9=200"}))
+	ActiveNetParams = &params
+
+	assert.True(t, IsGreatWallEnabled(100))
+	assert.False(t, IsReplayProtectionEnabled(100))
+	assert.False(t, IsReplayProtectionEnabled(params.ReplayProtectionActivationTime-1))
+	assert.True(t, IsReplayProtectionEnabled(params.ReplayProtectionActivationTime))
+}
+
+func TestGetUpgrade(t *testing.T) {
+	for _, upgrade := range Upgrades {
+		assert.Equal(t, upgrade, GetUpgrade(upgrade.Name))
+	}
+	assert.Nil(t, GetUpgrade("unknown"))
+}
@@ -1,7 +1,6 @@
 package utxo
 
 import (
-	"encoding/binary"
 	"errors"
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/model/script"
@@ -9,6 +8,7 @@ import (
 	"github.com/copernet/copernicus/util"
 	"github.com/copernet/copernicus/util/amount"
 	"io"
+	"unsafe"
 )
 
 type Coin struct {
@@ -64,14 +64,22 @@ func (coin *Coin) DeepCopy() *Coin {
 	outScript := coin.txOut.GetScriptPubKey()
 	if coin.txOut.GetScriptPubKey() != nil {
 		newOutScript := script.NewScriptRaw(outScript.GetData())
-		newOut := txout.NewTxOut(coin.txOut.GetValue(), newOutScript)
+		newOut := txout.NewTokenTxOut(coin.txOut.GetValue(), newOutScript, coin.txOut.GetTokenData())
 		newCoin.txOut = *newOut
 	}
 	return &newCoin
 }
 
+// DynamicMemoryUsage estimates the memory used by the coin in bytes.
 func (coin *Coin) DynamicMemoryUsage() int64 {
-	return int64(binary.Size(coin))
+	usage := int64(unsafe.Sizeof(*coin))
+	if scriptPubKey := coin.txOut.GetScriptPubKey(); scriptPubKey != nil {
+		usage += scriptPubKey.DynamicMemoryUsage()
+	}
+	if tokenData := coin.txOut.GetTokenData(); tokenData != nil {
+		usage += int64(unsafe.Sizeof(*tokenData)) + int64(cap(tokenData.Commitment))
+	}
+	return usage
 }
 
 func (coin *Coin) Serialize(w io.Writer) error {
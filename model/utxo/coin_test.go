@@ -10,6 +10,7 @@ import (
 	"github.com/copernet/copernicus/model/opcodes"
 	"github.com/copernet/copernicus/model/script"
 	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/util"
 	"github.com/davecgh/go-spew/spew"
 	"reflect"
 )
@@ -40,8 +41,8 @@ func TestCoin(t *testing.T) {
 		t.Error("get script pubkey is not equal script1, please check...")
 	}
 
-	if c.DynamicMemoryUsage() > 0 {
-		t.Error("DynamicMemoryUsage not need test...")
+	if c.DynamicMemoryUsage() <= int64(len(script1.GetData())) {
+		t.Error("the memory usage of the coin should include its script")
 	}
 
 	if !reflect.DeepEqual(c.DeepCopy(), c) {
@@ -174,3 +175,26 @@ func Test_test_unserialize_failure(t *testing.T) {
 
 	assert.Equal(t, errors.New("EOF"), err)
 }
+
+func TestCoinWithToken(t *testing.T) {
+	scriptPubKey := script.NewScriptRaw([]byte{opcodes.OP_TRUE})
+	tokenData := txout.NewTokenData(util.Hash{1}, 100, true, txout.TokenCapabilityMutable, []byte{0xaa})
+	c := NewFreshCoin(txout.NewTokenTxOut(5, scriptPubKey, tokenData), 100, false)
+
+	w := bytes.NewBuffer(nil)
+	assert.NoError(t, c.Serialize(w))
+
+	target := NewEmptyCoin()
+	assert.NoError(t, target.Unserialize(bytes.NewReader(w.Bytes())))
+	targetOut := target.GetTxOut()
+	assert.True(t, targetOut.HasTokenData())
+	assert.True(t, targetOut.GetTokenData().IsEqual(tokenData))
+	assert.Equal(t, []byte{opcodes.OP_TRUE}, target.GetScriptPubKey().GetData())
+
+	copied := c.DeepCopy()
+	copiedOut := copied.GetTxOut()
+	assert.True(t, copiedOut.GetTokenData().IsEqual(tokenData))
+	// The copy does not share the token data.
+	copiedOut.GetTokenData().Commitment[0] = 0xbb
+	assert.Equal(t, byte(0xaa), tokenData.Commitment[0])
+}
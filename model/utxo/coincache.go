@@ -1,6 +1,7 @@
 package utxo
 
 import (
+	"github.com/copernet/copernicus/crypto"
 	"github.com/copernet/copernicus/model/outpoint"
 	"github.com/copernet/copernicus/util"
 
@@ -29,6 +30,7 @@ type CacheView interface {
 	GetCoin(outpoint *outpoint.OutPoint) *Coin
 	HaveCoin(point *outpoint.OutPoint) bool
 	GetBestBlock() (util.Hash, error)
+	GetCommitment() *crypto.MultiSet
 	UpdateCoins(tempCacheCoins *CoinsMap, hash *util.Hash) error
 	DynamicMemoryUsage() int64
 	GetCacheSize() int
@@ -2,15 +2,21 @@ package utxo
 
 import (
 	"bytes"
+	"errors"
+
+	"github.com/copernet/copernicus/crypto"
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/model/outpoint"
 	"github.com/copernet/copernicus/persist/db"
 	"github.com/copernet/copernicus/util"
-	"github.com/syndtr/goleveldb/leveldb"
 )
 
+// DefaultDBBatchSize is the maximum size in bytes of a batch written to the coins database.
+const DefaultDBBatchSize = 16 << 20
+
 type CoinsDB struct {
-	dbw *db.DBWrapper
+	dbw       *db.DBWrapper
+	batchSize int
 }
 
 func (coinsViewDB *CoinsDB) GetDBW() *db.DBWrapper {
@@ -48,7 +54,7 @@ func (coinsViewDB *CoinsDB) HaveCoin(outpoint *outpoint.OutPoint) bool {
 
 func (coinsViewDB *CoinsDB) GetBestBlock() (*util.Hash, error) {
 	v, err := coinsViewDB.dbw.Read([]byte{db.DbBestBlock})
-	if err == leveldb.ErrNotFound {
+	if err == db.ErrNotFound {
 		return nil, err
 	}
 	if err != nil {
@@ -62,11 +68,135 @@ func (coinsViewDB *CoinsDB) GetBestBlock() (*util.Hash, error) {
 	return hashBlock, err
 }
 
-func (coinsViewDB *CoinsDB) BatchWrite(cm map[outpoint.OutPoint]*Coin, hashBlock util.Hash) error {
+// GetHeadBlocks returns the new and the old best block of a flush which was
+// interrupted, or nothing if the last flush completed.
+func (coinsViewDB *CoinsDB) GetHeadBlocks() ([]util.Hash, error) {
+	v, err := coinsViewDB.dbw.Read([]byte{db.DbHeadBlocks})
+	if err == db.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(v) != 2*util.Hash256Size {
+		return nil, errors.New("bad head blocks marker in coin database")
+	}
+	heads := make([]util.Hash, 2)
+	copy(heads[0][:], v[:util.Hash256Size])
+	copy(heads[1][:], v[util.Hash256Size:])
+	return heads, nil
+}
+
+// GetSnapshotLoad returns the best block the coins database had before a UTXO
+// snapshot load which did not complete, or nothing.
+func (coinsViewDB *CoinsDB) GetSnapshotLoad() (*util.Hash, error) {
+	v, err := coinsViewDB.dbw.Read([]byte{db.DbSnapshotLoad})
+	if err == db.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(v) != util.Hash256Size {
+		return nil, errors.New("bad snapshot load marker in coin database")
+	}
+	oldTip := new(util.Hash)
+	copy(oldTip[:], v)
+	return oldTip, nil
+}
+
+// WriteSnapshotLoad records that the coins of a UTXO snapshot are about to be
+// written on top of the best block oldTip. The marker is kept until the coins
+// and the block index of the snapshot are all written: the coins of a load
+// interrupted meanwhile are wiped when the database is opened again.
+func (coinsViewDB *CoinsDB) WriteSnapshotLoad(oldTip *util.Hash) error {
+	return coinsViewDB.dbw.Write([]byte{db.DbSnapshotLoad}, oldTip[:], true)
+}
+
+// EraseSnapshotLoad erases the marker of a UTXO snapshot load, once the load
+// completed or its headers were discarded.
+func (coinsViewDB *CoinsDB) EraseSnapshotLoad() error {
+	return coinsViewDB.dbw.Erase([]byte{db.DbSnapshotLoad}, true)
+}
+
+// wipeSnapshotLoad erases the coins written by a UTXO snapshot load which did
+// not complete, and restores the best block from before the load. Snapshots
+// are only loaded on top of the genesis block, which has no coin. The marker
+// is left for the block index to discard the headers of the snapshot.
+func (coinsViewDB *CoinsDB) wipeSnapshotLoad() error {
+	oldTip, err := coinsViewDB.GetSnapshotLoad()
+	if err != nil || oldTip == nil {
+		return err
+	}
+	log.Warn("coinDB:wiping the coins of an interrupted UTXO snapshot load")
+
+	const wipeBatchCount = 10000
+	keys := make([][]byte, 0, wipeBatchCount)
+	for {
+		// The keys are collected before being erased, a store may not be
+		// written while it is iterated.
+		iter := coinsViewDB.dbw.Iterator(nil)
+		iter.Seek([]byte{db.DbCoin})
+		for ; iter.Valid() && iter.GetKey()[0] == db.DbCoin && len(keys) < wipeBatchCount; iter.Next() {
+			keys = append(keys, iter.GetKey())
+		}
+		iter.Close()
+		if len(keys) == 0 {
+			break
+		}
+		batch := db.NewBatchWrapper(coinsViewDB.dbw)
+		for _, key := range keys {
+			batch.Erase(key)
+		}
+		if err := coinsViewDB.dbw.WriteBatch(batch, false); err != nil {
+			return err
+		}
+		keys = keys[:0]
+	}
+
+	batch := db.NewBatchWrapper(coinsViewDB.dbw)
+	batch.Erase([]byte{db.DbHeadBlocks})
+	batch.Erase([]byte{db.DbUtxoCommitment})
+	batch.Write([]byte{db.DbBestBlock}, oldTip[:])
+	return coinsViewDB.dbw.WriteBatch(batch, true)
+}
+
+// BatchWrite writes the dirty coins of cm, and the best block with the UTXO
+// commitment at that block if hashBlock is not null.
+//
+// The coins may be written in several batches. Until the last one, the best
+// block is replaced by the head blocks marker recording the old and the new
+// best block, so that a flush interrupted in between can be completed by
+// replaying the blocks from the old best block to the new one. Without a best
+// block there is nothing to replay, the coins are written in a single batch.
+func (coinsViewDB *CoinsDB) BatchWrite(cm map[outpoint.OutPoint]*Coin, hashBlock util.Hash, commitment *crypto.MultiSet) error {
 	mapCoins := cm
 	batch := db.NewBatchWrapper(coinsViewDB.dbw)
 	count := 0
 	changed := 0
+	partial := !hashBlock.IsNull()
+	if partial {
+		oldTip, err := coinsViewDB.GetBestBlock()
+		if err == db.ErrNotFound {
+			// An interrupted flush is being completed, keep its old tip.
+			heads, err := coinsViewDB.GetHeadBlocks()
+			if err != nil {
+				return err
+			}
+			oldTip = new(util.Hash)
+			if len(heads) == 2 {
+				*oldTip = heads[1]
+			}
+		} else if err != nil {
+			return err
+		}
+		marker := make([]byte, 0, 2*util.Hash256Size)
+		marker = append(marker, hashBlock[:]...)
+		marker = append(marker, oldTip[:]...)
+		batch.Erase([]byte{db.DbBestBlock})
+		batch.Erase([]byte{db.DbUtxoCommitment})
+		batch.Write([]byte{db.DbHeadBlocks}, marker)
+	}
 	for k, v := range mapCoins {
 		if v.dirty {
 			entry := NewCoinKey(&k)
@@ -93,6 +223,13 @@ func (coinsViewDB *CoinsDB) BatchWrite(cm map[outpoint.OutPoint]*Coin, hashBlock
 		}
 		count++
 		delete(cm, k)
+		if partial && batch.SizeEstimate() > coinsViewDB.batchSize {
+			log.Debug("coinDB:writing partial batch of %.2f MiB", float64(batch.SizeEstimate())/float64(1<<20))
+			if err := coinsViewDB.dbw.WriteBatch(batch, false); err != nil {
+				return err
+			}
+			batch = db.NewBatchWrapper(coinsViewDB.dbw)
+		}
 	}
 	if !hashBlock.IsNull() {
 		hashByte := bytes.NewBuffer(nil)
@@ -101,10 +238,15 @@ func (coinsViewDB *CoinsDB) BatchWrite(cm map[outpoint.OutPoint]*Coin, hashBlock
 			log.Error("coinDB:Serialize hash block failed<%v>, please check.", err)
 			return err
 		}
+		batch.Erase([]byte{db.DbHeadBlocks})
 		batch.Write([]byte{db.DbBestBlock}, hashByte.Bytes())
+		if commitment != nil {
+			batch.Write([]byte{db.DbUtxoCommitment}, commitment.Serialize())
+		}
 	}
 
 	ret := coinsViewDB.dbw.WriteBatch(batch, false)
+	log.Debug("coinDB:committed %d changed coins (out of %d) to coin database", changed, count)
 
 	return ret
 }
@@ -125,6 +267,7 @@ func newCoinsDB(do *db.DBOption) *CoinsDB {
 	}
 
 	return &CoinsDB{
-		dbw: dbw,
+		dbw:       dbw,
+		batchSize: DefaultDBBatchSize,
 	}
 }
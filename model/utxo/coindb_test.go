@@ -11,7 +11,6 @@ import (
 	"github.com/copernet/copernicus/util"
 	"github.com/copernet/copernicus/util/amount"
 	"github.com/stretchr/testify/assert"
-	"github.com/syndtr/goleveldb/leveldb"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -53,12 +52,12 @@ func TestCoinsDB(t *testing.T) {
 		t.Errorf("the db not have coin")
 	}
 
-	if _, err := dbObj.GetCoin(&outpoint1); err != leveldb.ErrNotFound {
+	if _, err := dbObj.GetCoin(&outpoint1); err != db.ErrNotFound {
 		t.Errorf("the db not have coin, so the coin is nil.")
 	}
 
 	bestBlockHash, err := dbObj.GetBestBlock()
-	if err != leveldb.ErrNotFound {
+	if err != db.ErrNotFound {
 		t.Errorf("there should be none bestblock")
 	}
 
@@ -125,3 +124,107 @@ func givenCoinsmapContainsAFreshCoin() (*CoinsMap, *outpoint.OutPoint) {
 
 	return coinMap, outpoint
 }
+
+func TestCoinsDBBatchWritePartial(t *testing.T) {
+	path, err := ioutil.TempDir("/tmp", "coinsdbtest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(path)
+
+	dbObj := newCoinsDB(&db.DBOption{FilePath: path, CacheSize: 1 << 20})
+	dbObj.batchSize = 64
+
+	cm := make(map[outpoint.OutPoint]*Coin)
+	txOut := txout.NewTxOut(amount.Amount(50), script.NewEmptyScript())
+	for i := uint32(0); i < 100; i++ {
+		coin := NewFreshCoin(txOut, 1, false)
+		coin.dirty = true
+		cm[*outpoint.NewOutPoint(util.HashOne, i)] = coin
+	}
+	assert.NoError(t, dbObj.BatchWrite(cm, util.HashOne, nil))
+	assert.Empty(t, cm)
+
+	for i := uint32(0); i < 100; i++ {
+		assert.True(t, dbObj.HaveCoin(outpoint.NewOutPoint(util.HashOne, i)))
+	}
+	bestBlock, err := dbObj.GetBestBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, util.HashOne, *bestBlock)
+}
+
+func TestCoinsDBBatchWriteWithoutBestBlock(t *testing.T) {
+	path, err := ioutil.TempDir("/tmp", "coinsdbtest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(path)
+
+	dbObj := newCoinsDB(&db.DBOption{FilePath: path, CacheSize: 1 << 20})
+	dbObj.batchSize = 64
+
+	cm := make(map[outpoint.OutPoint]*Coin)
+	txOut := txout.NewTxOut(amount.Amount(50), script.NewEmptyScript())
+	for i := uint32(0); i < 100; i++ {
+		coin := NewFreshCoin(txOut, 1, false)
+		coin.dirty = true
+		cm[*outpoint.NewOutPoint(util.HashOne, i)] = coin
+	}
+	assert.NoError(t, dbObj.BatchWrite(cm, util.Hash{}, nil))
+	assert.Empty(t, cm)
+
+	for i := uint32(0); i < 100; i++ {
+		assert.True(t, dbObj.HaveCoin(outpoint.NewOutPoint(util.HashOne, i)))
+	}
+	heads, err := dbObj.GetHeadBlocks()
+	assert.NoError(t, err)
+	assert.Empty(t, heads)
+	_, err = dbObj.GetBestBlock()
+	assert.Equal(t, db.ErrNotFound, err)
+}
+
+func TestCoinsDBWipeSnapshotLoad(t *testing.T) {
+	path, err := ioutil.TempDir("/tmp", "coinsdbtest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(path)
+
+	dbObj := newCoinsDB(&db.DBOption{FilePath: path, CacheSize: 1 << 20})
+	dbObj.batchSize = 64
+	assert.NoError(t, dbObj.BatchWrite(map[outpoint.OutPoint]*Coin{}, util.HashOne, nil))
+
+	// Nothing to wipe without the marker.
+	assert.NoError(t, dbObj.wipeSnapshotLoad())
+	bestBlock, err := dbObj.GetBestBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, util.HashOne, *bestBlock)
+
+	// The load is interrupted while writing its base block in several batches.
+	assert.NoError(t, dbObj.WriteSnapshotLoad(&util.HashOne))
+	cm := make(map[outpoint.OutPoint]*Coin)
+	txOut := txout.NewTxOut(amount.Amount(50), script.NewEmptyScript())
+	for i := uint32(0); i < 100; i++ {
+		coin := NewFreshCoin(txOut, 1, false)
+		coin.dirty = true
+		cm[*outpoint.NewOutPoint(util.HashOne, i)] = coin
+	}
+	assert.NoError(t, dbObj.BatchWrite(cm, util.HashZero, nil))
+	assert.NoError(t, dbObj.dbw.Write([]byte{db.DbHeadBlocks}, append(util.HashZero[:], util.HashOne[:]...), false))
+	assert.NoError(t, dbObj.dbw.Erase([]byte{db.DbBestBlock}, false))
+
+	assert.NoError(t, dbObj.wipeSnapshotLoad())
+	for i := uint32(0); i < 100; i++ {
+		assert.False(t, dbObj.HaveCoin(outpoint.NewOutPoint(util.HashOne, i)))
+	}
+	heads, err := dbObj.GetHeadBlocks()
+	assert.NoError(t, err)
+	assert.Empty(t, heads)
+	bestBlock, err = dbObj.GetBestBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, util.HashOne, *bestBlock)
+	assert.True(t, dbObj.GetCommitment().IsEmpty())
+
+	// The marker is left for the block index.
+	oldTip, err := dbObj.GetSnapshotLoad()
+	assert.NoError(t, err)
+	assert.Equal(t, util.HashOne, *oldTip)
+	assert.NoError(t, dbObj.EraseSnapshotLoad())
+	oldTip, err = dbObj.GetSnapshotLoad()
+	assert.NoError(t, err)
+	assert.Nil(t, oldTip)
+}
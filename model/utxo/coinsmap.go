@@ -3,6 +3,7 @@ package utxo
 import (
 	"encoding/hex"
 	"fmt"
+	"github.com/copernet/copernicus/crypto"
 	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/util/amount"
 
@@ -14,6 +15,9 @@ import (
 
 type CoinsMap struct {
 	cacheCoins map[outpoint.OutPoint]*Coin
+	// commitment is the change of the UTXO commitment made by the coins
+	// committed or uncommitted explicitly, nil if there is none.
+	commitment *crypto.MultiSet
 }
 
 func (cm *CoinsMap) GetMap() map[outpoint.OutPoint]*Coin {
@@ -80,6 +84,7 @@ func DisplayCoinMap(cm *CoinsMap) {
 func (cm *CoinsMap) Flush(hashBlock util.Hash) bool {
 	ok := GetUtxoCacheInstance().UpdateCoins(cm, &hashBlock)
 	cm.cacheCoins = make(map[outpoint.OutPoint]*Coin)
+	cm.commitment = nil
 	return ok == nil
 }
 
@@ -106,6 +111,22 @@ func (cm *CoinsMap) AddCoin(point *outpoint.OutPoint, coin *Coin, possibleOverwr
 
 }
 
+// OverwriteCoin adds a copy of coin at point, where a coin may already be in
+// the database. Unlike a coin added fresh, it is erased from the database when
+// it is spent before being flushed.
+func (cm *CoinsMap) OverwriteCoin(point *outpoint.OutPoint, coin *Coin) {
+	coin = coin.DeepCopy()
+	if coin.IsSpent() {
+		panic("add a spent coin")
+	}
+	if !coin.IsSpendable() {
+		return
+	}
+	coin.fresh = false
+	coin.dirty = true
+	cm.cacheCoins[*point] = coin
+}
+
 // SpendCoin spend a specified coin
 func (cm *CoinsMap) SpendCoin(point *outpoint.OutPoint) *Coin {
 	coin := cm.GetCoin(point)
@@ -132,13 +153,23 @@ func (cm *CoinsMap) SpendCoin(point *outpoint.OutPoint) *Coin {
 
 // FetchCoin different from GetCoin, if not get coin, FetchCoin will get coin from global cache
 func (cm *CoinsMap) FetchCoin(out *outpoint.OutPoint) *Coin {
+	return cm.fetchCoin(GetUtxoCacheInstance(), out)
+}
+
+// FetchCoinFromView is FetchCoin reading the coins missing from cm in view
+// instead of the global cache.
+func (cm *CoinsMap) FetchCoinFromView(view CacheView, out *outpoint.OutPoint) *Coin {
+	return cm.fetchCoin(view, out)
+}
+
+func (cm *CoinsMap) fetchCoin(view CacheView, out *outpoint.OutPoint) *Coin {
 	coin := cm.GetCoin(out)
 	if coin != nil {
 		return coin
 	}
-	coin = GetUtxoCacheInstance().GetCoin(out)
+	coin = view.GetCoin(out)
 	if coin == nil {
-		_, file, line, _ := runtime.Caller(1)
+		_, file, line, _ := runtime.Caller(2)
 		log.Warn("not found coin by outpoint(%v) invoked by %s:%d", out, file, line)
 		return nil
 	}
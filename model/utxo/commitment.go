@@ -0,0 +1,90 @@
+package utxo
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/copernet/copernicus/crypto"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/persist/db"
+)
+
+// commitmentData serializes a coin as it is committed to by the UTXO
+// commitment: the outpoint, height*2+coinbase as a little endian uint32 and
+// the output, all as encoded on the wire.
+func commitmentData(point *outpoint.OutPoint, coin *Coin) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, point.EncodeSize()+4+coin.txOut.EncodeSize()))
+	if err := point.Encode(buf); err != nil {
+		panic("serialize outpoint failed: " + err.Error())
+	}
+	code := uint32(coin.height) * 2
+	if coin.isCoinBase {
+		code++
+	}
+	var codeBytes [4]byte
+	binary.LittleEndian.PutUint32(codeBytes[:], code)
+	buf.Write(codeBytes[:])
+	if err := coin.txOut.Encode(buf); err != nil {
+		panic("serialize txout failed: " + err.Error())
+	}
+	return buf.Bytes()
+}
+
+// CommitCoin adds a coin created at point to the UTXO commitment delta of the
+// map. Like AddCoin, unspendable coins are ignored.
+func (cm *CoinsMap) CommitCoin(point *outpoint.OutPoint, coin *Coin) {
+	if coin.IsSpent() || !coin.IsSpendable() {
+		return
+	}
+	cm.commitmentDelta().Add(commitmentData(point, coin))
+}
+
+// UncommitCoin removes a coin spent at point from the UTXO commitment delta
+// of the map.
+func (cm *CoinsMap) UncommitCoin(point *outpoint.OutPoint, coin *Coin) {
+	if coin.IsSpent() || !coin.IsSpendable() {
+		return
+	}
+	cm.commitmentDelta().Remove(commitmentData(point, coin))
+}
+
+func (cm *CoinsMap) commitmentDelta() *crypto.MultiSet {
+	if cm.commitment == nil {
+		cm.commitment = crypto.NewMultiSet()
+	}
+	return cm.commitment
+}
+
+// GetCommitment returns the UTXO commitment of the coins database, computing
+// it from all the coins if it was never written.
+func (coinsViewDB *CoinsDB) GetCommitment() *crypto.MultiSet {
+	v, err := coinsViewDB.dbw.Read([]byte{db.DbUtxoCommitment})
+	if err == nil {
+		commitment, err := crypto.ParseMultiSet(v)
+		if err == nil {
+			return commitment
+		}
+		log.Error("coinDB:parse utxo commitment failed<%v>, recomputing it", err)
+	}
+
+	log.Info("coinDB:computing the utxo commitment from the coins database")
+	commitment := crypto.NewMultiSet()
+	iter := coinsViewDB.dbw.Iterator(nil)
+	defer iter.Close()
+	count := 0
+	for iter.Seek([]byte{db.DbCoin}); iter.Valid() && iter.GetKey()[0] == db.DbCoin; iter.Next() {
+		point := outpoint.OutPoint{}
+		if err := point.Unserialize(bytes.NewBuffer(iter.GetKey()[1:])); err != nil {
+			panic("unserialize coin key failed: " + err.Error())
+		}
+		coin := NewEmptyCoin()
+		if err := coin.Unserialize(bytes.NewBuffer(iter.GetVal())); err != nil {
+			panic("unserialize coin failed: " + err.Error())
+		}
+		commitment.Add(commitmentData(&point, coin))
+		count++
+	}
+	log.Info("coinDB:computed the utxo commitment of %d coins", count)
+	return commitment
+}
@@ -0,0 +1,90 @@
+package utxo
+
+import (
+	"os"
+	"testing"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/crypto"
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/persist/db"
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitmentData(t *testing.T) {
+	hash := util.HashFromString("000000002dd5588a74784eaa7ab0507a18ad16a236e7b1ce69f00d7ddfb5d0c8")
+	point := &outpoint.OutPoint{Hash: *hash, Index: 2}
+	txOut := txout.NewTxOut(3, script.NewScriptRaw([]byte{opcodes.OP_TRUE}))
+
+	data := commitmentData(point, NewFreshCoin(txOut, 100, true))
+	assert.Equal(t, hash[:], data[:32])
+	assert.Equal(t, []byte{2, 0, 0, 0}, data[32:36])
+	assert.Equal(t, []byte{201, 0, 0, 0}, data[36:40])
+	assert.Equal(t, []byte{3, 0, 0, 0, 0, 0, 0, 0, 1, opcodes.OP_TRUE}, data[40:])
+
+	notCoinbase := commitmentData(point, NewFreshCoin(txOut, 100, false))
+	assert.Equal(t, []byte{200, 0, 0, 0}, notCoinbase[36:40])
+}
+
+func TestCoinsViewCacheCommitment(t *testing.T) {
+	conf.Cfg = conf.InitConfig([]string{})
+	testDataDir, err := conf.SetUnitTestDataDir(conf.Cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testDataDir)
+	uc := &UtxoConfig{Do: &db.DBOption{
+		FilePath:  conf.Cfg.DataDir,
+		CacheSize: 1 << 20,
+	}}
+	InitUtxoLruTip(uc)
+	cache := GetUtxoCacheInstance().(*CoinsViewCache)
+	cdb := cache.GetCoinsDB()
+	assert.True(t, cache.GetCommitment().IsEmpty())
+
+	hash := util.HashFromString("000000002dd5588a74784eaa7ab0507a18ad16a236e7b1ce69f00d7ddfb5d0c8")
+	point0 := outpoint.OutPoint{Hash: *hash, Index: 0}
+	point1 := outpoint.OutPoint{Hash: *hash, Index: 1}
+	unspendable := outpoint.OutPoint{Hash: *hash, Index: 2}
+	coin := NewFreshCoin(txout.NewTxOut(3, script.NewScriptRaw([]byte{opcodes.OP_TRUE})), 100, true)
+	opReturn := NewFreshCoin(txout.NewTxOut(0, script.NewScriptRaw([]byte{opcodes.OP_RETURN})), 100, true)
+
+	necm := NewEmptyCoinsMap()
+	for _, point := range []*outpoint.OutPoint{&point0, &point1} {
+		necm.AddCoin(point, coin, false)
+		necm.CommitCoin(point, coin)
+	}
+	necm.CommitCoin(&unspendable, opReturn)
+	assert.NoError(t, cache.UpdateCoins(necm, hash))
+	assert.Nil(t, necm.commitment)
+
+	expected := crypto.NewMultiSet()
+	expected.Add(commitmentData(&point0, coin))
+	expected.Add(commitmentData(&point1, coin))
+	assert.Equal(t, expected.Hash(), cache.GetCommitment().Hash())
+
+	// The commitment is written with the best block, and recomputed from the
+	// coins if it is missing.
+	assert.True(t, cache.Flush())
+	assert.Equal(t, expected.Hash(), cdb.GetCommitment().Hash())
+	assert.NoError(t, cdb.GetDBW().Erase([]byte{db.DbUtxoCommitment}, true))
+	assert.Equal(t, expected.Hash(), cdb.GetCommitment().Hash())
+
+	// Spending a coin removes it from the commitment.
+	necm = NewEmptyCoinsMap()
+	spent := necm.SpendGlobalCoin(&point1)
+	assert.NotNil(t, spent)
+	necm.UncommitCoin(&point1, spent)
+	necm.UncommitCoin(&point1, necm.GetCoin(&point1))
+	assert.NoError(t, cache.UpdateCoins(necm, hash))
+	expected.Remove(commitmentData(&point1, coin))
+	assert.Equal(t, expected.Hash(), cache.GetCommitment().Hash())
+
+	// The returned commitment is a copy.
+	cache.GetCommitment().Add([]byte("modified"))
+	assert.Equal(t, expected.Hash(), cache.GetCommitment().Hash())
+}
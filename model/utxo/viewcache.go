@@ -0,0 +1,217 @@
+package utxo
+
+import (
+	"unsafe"
+
+	"github.com/copernet/copernicus/crypto"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/persist/db"
+	"github.com/copernet/copernicus/util"
+)
+
+// coinEntryOverhead approximates the memory used by an entry of the cache map
+// besides the coin itself: the key, the coin pointer and the map bookkeeping.
+const coinEntryOverhead = int64(unsafe.Sizeof(outpoint.OutPoint{})+unsafe.Sizeof(&Coin{})) + 16
+
+// CoinsViewCache keeps the coins read from or not yet written to the CoinsDB.
+// A dirty coin differs from the database and a fresh coin does not exist in
+// the database, so a fresh coin being spent is dropped without touching it.
+// The UTXO commitment at hashBlock is kept up to date from the commitment
+// deltas of the updates and written along with the best block.
+type CoinsViewCache struct {
+	db               CoinsDB
+	hashBlock        util.Hash
+	commitment       *crypto.MultiSet
+	cacheCoins       map[outpoint.OutPoint]*Coin
+	cachedCoinsUsage int64
+}
+
+func (coinsCache *CoinsViewCache) GetCoinsDB() CoinsDB {
+	return coinsCache.db
+}
+
+func InitUtxoLruTip(uc *UtxoConfig) {
+	db := newCoinsDB(uc.Do)
+	if err := db.wipeSnapshotLoad(); err != nil {
+		panic("wipe the coins of the interrupted UTXO snapshot load failed: " + err.Error())
+	}
+	utxoTip = newCoinsViewCache(*db)
+}
+
+// OpenCoinsViewCache opens a coins cache on its own database, apart from the
+// UTXO set of the active chain. It is closed by Close.
+func OpenCoinsViewCache(do *db.DBOption) (*CoinsViewCache, error) {
+	dbw, err := db.NewDBWrapper(do)
+	if err != nil {
+		return nil, err
+	}
+	cdb := CoinsDB{dbw: dbw, batchSize: DefaultDBBatchSize}
+	return newCoinsViewCache(cdb).(*CoinsViewCache), nil
+}
+
+// Close closes the database of the cache, without flushing it.
+func (coinsCache *CoinsViewCache) Close() {
+	coinsCache.db.dbw.Close()
+}
+
+func newCoinsViewCache(db CoinsDB) CacheView {
+	c := new(CoinsViewCache)
+	c.db = db
+	c.cacheCoins = make(map[outpoint.OutPoint]*Coin)
+	c.commitment = db.GetCommitment()
+	return c
+}
+
+// GetCoin returns the unspent coin at outpoint, or nil. A coin spent in the
+// cache but not yet erased from the database is not returned either.
+func (coinsCache *CoinsViewCache) GetCoin(outpoint *outpoint.OutPoint) *Coin {
+	if coin, ok := coinsCache.cacheCoins[*outpoint]; ok {
+		if coin.IsSpent() {
+			return nil
+		}
+		return coin
+	}
+	coin, err := coinsCache.db.GetCoin(outpoint)
+	if err != nil && err == db.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		log.Emergency("CoinsViewCache.GetCoin err:%#v", err)
+		panic("get coin is failed!")
+	}
+	if coin == nil {
+		return nil
+	}
+	coinsCache.addEntry(outpoint, coin)
+	return coin
+}
+
+func (coinsCache *CoinsViewCache) HaveCoin(point *outpoint.OutPoint) bool {
+	coin := coinsCache.GetCoin(point)
+	return coin != nil && !coin.IsSpent()
+}
+
+// RemoveCoins drops the coin from the cache unless it still has to be written
+// to the database.
+func (coinsCache *CoinsViewCache) RemoveCoins(point *outpoint.OutPoint) {
+	if point == nil {
+		return
+	}
+	coin, ok := coinsCache.cacheCoins[*point]
+	if ok && !coin.dirty && !coin.fresh {
+		coinsCache.removeEntry(point, coin)
+	}
+}
+
+func (coinsCache *CoinsViewCache) GetBestBlock() (util.Hash, error) {
+	if coinsCache.hashBlock.IsNull() {
+		hashBlock, err := coinsCache.db.GetBestBlock()
+		if err == db.ErrNotFound {
+			return util.Hash{}, err
+		}
+		if err != nil {
+			log.Error("db.GetBestBlock err:%#v", err)
+			panic("db.GetBestBlock read err")
+		}
+		log.Debug("GetBestBlock: set coinsCache's besthash to %s from DB", hashBlock)
+		coinsCache.hashBlock = *hashBlock
+	}
+	return coinsCache.hashBlock, nil
+}
+
+// GetCommitment returns a copy of the UTXO commitment at the best block.
+func (coinsCache *CoinsViewCache) GetCommitment() *crypto.MultiSet {
+	return coinsCache.commitment.Clone()
+}
+
+func (coinsCache *CoinsViewCache) UpdateCoins(cm *CoinsMap, hash *util.Hash) error {
+	for point, tempCacheCoin := range cm.cacheCoins {
+		if tempCacheCoin.isMempoolCoin {
+			log.Error("MempoolCoin  save to DB!!!  %#v", tempCacheCoin)
+			panic("MempoolCoin  save to DB!!!")
+		}
+		// Ignore non-dirty entries (optimization).
+		if tempCacheCoin.dirty || tempCacheCoin.fresh {
+			point := point
+			globalCacheCoin, ok := coinsCache.cacheCoins[point]
+			if !ok {
+				// A fresh coin spent before reaching the cache never
+				// needs to be written.
+				if !(tempCacheCoin.fresh && tempCacheCoin.IsSpent()) {
+					tempCacheCoin.dirty = true
+					coinsCache.addEntry(&point, tempCacheCoin)
+				}
+			} else if globalCacheCoin.fresh && tempCacheCoin.IsSpent() {
+				// The database does not have an entry, and the child is
+				// modified and being pruned. This means we can just delete
+				// it from the cache.
+				coinsCache.removeEntry(&point, globalCacheCoin)
+			} else {
+				// The coin keeps being fresh only if the database still
+				// does not know it.
+				tempCacheCoin.fresh = globalCacheCoin.fresh
+				tempCacheCoin.dirty = true
+				coinsCache.removeEntry(&point, globalCacheCoin)
+				coinsCache.addEntry(&point, tempCacheCoin)
+			}
+		}
+		delete(cm.cacheCoins, point)
+	}
+	if cm.commitment != nil {
+		coinsCache.commitment.Combine(cm.commitment)
+		cm.commitment = nil
+	}
+	log.Debug("UpdateCoins: set besthash to %s", hash)
+	coinsCache.hashBlock = *hash
+	return nil
+}
+
+// Flush writes the dirty coins, the best block and the UTXO commitment to the
+// database and empties the cache.
+func (coinsCache *CoinsViewCache) Flush() bool {
+	log.Debug("flush utxo: bestblockhash:%s, coins:%d, usage:%d", coinsCache.hashBlock,
+		len(coinsCache.cacheCoins), coinsCache.DynamicMemoryUsage())
+
+	if len(coinsCache.cacheCoins) > 0 || !coinsCache.hashBlock.IsNull() {
+		err := coinsCache.db.BatchWrite(coinsCache.cacheCoins, coinsCache.hashBlock, coinsCache.commitment)
+		if err != nil {
+			log.Error("CoinsViewCache.Flush err:%v", err)
+			panic("CoinsViewCache.flush err:")
+		}
+	}
+	coinsCache.cacheCoins = make(map[outpoint.OutPoint]*Coin)
+	coinsCache.cachedCoinsUsage = 0
+	return true
+}
+
+func (coinsCache *CoinsViewCache) AccessByTxID(hash *util.Hash) *Coin {
+	out := outpoint.OutPoint{Hash: *hash, Index: 0}
+	for int(out.Index) < 11000 { // todo modify to be precise
+		alternate := coinsCache.GetCoin(&out)
+		if alternate != nil && !alternate.IsSpent() {
+			return alternate
+		}
+		out.Index++
+	}
+	return nil
+}
+
+func (coinsCache *CoinsViewCache) GetCacheSize() int {
+	return len(coinsCache.cacheCoins)
+}
+
+// DynamicMemoryUsage returns the memory used by the cached coins in bytes.
+func (coinsCache *CoinsViewCache) DynamicMemoryUsage() int64 {
+	return int64(len(coinsCache.cacheCoins))*coinEntryOverhead + coinsCache.cachedCoinsUsage
+}
+
+func (coinsCache *CoinsViewCache) addEntry(point *outpoint.OutPoint, coin *Coin) {
+	coinsCache.cacheCoins[*point] = coin
+	coinsCache.cachedCoinsUsage += coin.DynamicMemoryUsage()
+}
+
+func (coinsCache *CoinsViewCache) removeEntry(point *outpoint.OutPoint, coin *Coin) {
+	delete(coinsCache.cacheCoins, *point)
+	coinsCache.cachedCoinsUsage -= coin.DynamicMemoryUsage()
+}
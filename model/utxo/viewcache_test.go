@@ -29,7 +29,7 @@ func TestGetBestBlock(t *testing.T) {
 	InitUtxoLruTip(uc)
 
 	rhash, err := GetUtxoCacheInstance().GetBestBlock()
-	assert.EqualError(t, err, "leveldb: not found")
+	assert.Equal(t, db.ErrNotFound, err)
 	assert.Equal(t, util.Hash{}, rhash)
 
 	necm := NewEmptyCoinsMap()
@@ -219,8 +219,8 @@ func TestUpdateCoins2(t *testing.T) {
 	assert.Nil(t, err, "flush failed!")
 }
 
-func TestCoinsLruCache_GetCoinsDB(t *testing.T) {
-	cdb := GetUtxoCacheInstance().(*CoinsLruCache).GetCoinsDB()
+func TestCoinsViewCache_GetCoinsDB(t *testing.T) {
+	cdb := GetUtxoCacheInstance().(*CoinsViewCache).GetCoinsDB()
 	assert.NotNil(t, cdb)
 }
 
@@ -266,3 +266,74 @@ func TestAccessByTxid(t *testing.T) {
 	rCoin = GetUtxoCacheInstance().AccessByTxID(hashUnKnown)
 	assert.Nil(t, rCoin)
 }
+
+func TestCoinsViewCacheFlags(t *testing.T) {
+	conf.Cfg = conf.InitConfig([]string{})
+	testDataDir, err := conf.SetUnitTestDataDir(conf.Cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testDataDir)
+	uc := &UtxoConfig{Do: &db.DBOption{
+		FilePath:  conf.Cfg.DataDir,
+		CacheSize: 1 << 20,
+	}}
+	InitUtxoLruTip(uc)
+	cache := GetUtxoCacheInstance().(*CoinsViewCache)
+	cdb := cache.GetCoinsDB()
+	assert.Equal(t, int64(0), cache.DynamicMemoryUsage())
+
+	hash := util.HashFromString("000000002dd5588a74784eaa7ab0507a18ad16a236e7b1ce69f00d7ddfb5d0c8")
+	freshPoint := outpoint.OutPoint{Hash: *hash, Index: 0}
+	storedPoint := outpoint.OutPoint{Hash: *hash, Index: 1}
+	txOut := txout.NewTxOut(3, script.NewScriptRaw([]byte{opcodes.OP_13, opcodes.OP_EQUAL}))
+
+	// New coins are dirty and fresh in the cache, and accounted for.
+	necm := NewEmptyCoinsMap()
+	necm.AddCoin(&freshPoint, NewFreshCoin(txOut, 100, true), false)
+	necm.AddCoin(&storedPoint, NewFreshCoin(txOut, 100, true), false)
+	assert.NoError(t, cache.UpdateCoins(necm, hash))
+	assert.Equal(t, 2, cache.GetCacheSize())
+	assert.True(t, cache.cacheCoins[freshPoint].dirty)
+	assert.True(t, cache.cacheCoins[freshPoint].fresh)
+	usage := cache.DynamicMemoryUsage()
+	assert.True(t, usage > 2*coinEntryOverhead)
+
+	// Dirty coins are not uncached before being written.
+	cache.RemoveCoins(&freshPoint)
+	assert.Equal(t, 2, cache.GetCacheSize())
+
+	// Spending a fresh coin drops it without ever writing it to the db.
+	necm = NewEmptyCoinsMap()
+	assert.NotNil(t, necm.SpendGlobalCoin(&freshPoint))
+	assert.NoError(t, cache.UpdateCoins(necm, hash))
+	assert.Equal(t, 1, cache.GetCacheSize())
+	assert.True(t, cache.DynamicMemoryUsage() < usage)
+
+	assert.True(t, cache.Flush())
+	assert.Equal(t, 0, cache.GetCacheSize())
+	assert.Equal(t, int64(0), cache.DynamicMemoryUsage())
+	assert.False(t, cdb.HaveCoin(&freshPoint))
+	assert.True(t, cdb.HaveCoin(&storedPoint))
+
+	// Coins read from the db are clean and can be uncached.
+	assert.True(t, cache.HaveCoin(&storedPoint))
+	assert.False(t, cache.cacheCoins[storedPoint].dirty)
+	assert.False(t, cache.cacheCoins[storedPoint].fresh)
+	assert.True(t, cache.DynamicMemoryUsage() > 0)
+	cache.RemoveCoins(&storedPoint)
+	assert.Equal(t, 0, cache.GetCacheSize())
+	assert.Equal(t, int64(0), cache.DynamicMemoryUsage())
+
+	// Spending a coin known by the db erases it on flush.
+	necm = NewEmptyCoinsMap()
+	assert.NotNil(t, necm.SpendGlobalCoin(&storedPoint))
+	assert.NoError(t, cache.UpdateCoins(necm, hash))
+	assert.True(t, cache.cacheCoins[storedPoint].dirty)
+	assert.False(t, cache.HaveCoin(&storedPoint))
+	assert.Nil(t, cache.GetCoin(&storedPoint))
+	assert.Nil(t, NewEmptyCoinsMap().FetchCoin(&storedPoint))
+	assert.True(t, cache.Flush())
+	assert.False(t, cdb.HaveCoin(&storedPoint))
+	assert.Nil(t, cache.GetCoin(&storedPoint))
+}
@@ -17,6 +17,7 @@ func (wdb *WalletDB) initDB() {
 		FilePath:  conf.Cfg.DataDir + "/wallet",
 		CacheSize: (1 << 20) * 8,
 		Wipe:      false,
+		Backend:   conf.Cfg.DB.WalletBackend,
 	}
 
 	var err error
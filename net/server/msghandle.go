@@ -70,6 +70,7 @@ out:
 				}
 				peerFrom.SetAckReceived(true)
 				peerFrom.PushSendHeadersMsg()
+				peerFrom.PushSendCmpctMsg(false)
 				if peerFrom.Cfg.Listeners.OnVerAck != nil {
 					peerFrom.Cfg.Listeners.OnVerAck(peerFrom, data)
 				}
@@ -186,6 +187,53 @@ out:
 					peerFrom.Cfg.Listeners.OnSendHeaders(peerFrom, data)
 				}
 				msg.Done <- struct{}{}
+			case *wire.MsgSendCmpct:
+				// Other versions of compact blocks are ignored
+				if data.CmpctBlockVersion == wire.CmpctBlockVersion {
+					peerFrom.SetCmpctBlocksPreference(data.AnnounceUsingCmpctBlock)
+				}
+				if peerFrom.Cfg.Listeners.OnSendCmpct != nil {
+					peerFrom.Cfg.Listeners.OnSendCmpct(peerFrom, data)
+				}
+				msg.Done <- struct{}{}
+			case *wire.MsgCmpctBlock:
+				if peerFrom.Cfg.Listeners.OnCmpctBlock != nil {
+					peerFrom.Cfg.Listeners.OnCmpctBlock(peerFrom, data, msg.Done)
+				} else {
+					msg.Done <- struct{}{}
+				}
+			case *wire.MsgGetBlockTxn:
+				if peerFrom.Cfg.Listeners.OnGetBlockTxn != nil {
+					peerFrom.Cfg.Listeners.OnGetBlockTxn(peerFrom, data)
+				}
+				msg.Done <- struct{}{}
+			case *wire.MsgBlockTxn:
+				if peerFrom.Cfg.Listeners.OnBlockTxn != nil {
+					peerFrom.Cfg.Listeners.OnBlockTxn(peerFrom, data, msg.Done)
+				} else {
+					msg.Done <- struct{}{}
+				}
+			case *wire.MsgGetCFilters:
+				if peerFrom.Cfg.Listeners.OnGetCFilters != nil {
+					peerFrom.Cfg.Listeners.OnGetCFilters(peerFrom, data)
+				}
+				msg.Done <- struct{}{}
+			case *wire.MsgGetCFHeaders:
+				if peerFrom.Cfg.Listeners.OnGetCFHeaders != nil {
+					peerFrom.Cfg.Listeners.OnGetCFHeaders(peerFrom, data)
+				}
+				msg.Done <- struct{}{}
+			case *wire.MsgGetCFCheckpt:
+				if peerFrom.Cfg.Listeners.OnGetCFCheckpt != nil {
+					peerFrom.Cfg.Listeners.OnGetCFCheckpt(peerFrom, data)
+				}
+				msg.Done <- struct{}{}
+			case *wire.MsgDSProof:
+				if peerFrom.Cfg.Listeners.OnDSProof != nil {
+					peerFrom.Cfg.Listeners.OnDSProof(peerFrom, data, msg.Done)
+				} else {
+					msg.Done <- struct{}{}
+				}
 			default:
 				log.Debug("Received unhandled message of type %v "+
 					"from %v", data, data.Command())
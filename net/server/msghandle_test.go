@@ -53,7 +53,7 @@ func TestHandleGetNetworkInfo(t *testing.T) {
 		t.Error(err.Error())
 	}
 
-	assert.Equal(t, ret.ProtocolVersion, uint32(70013))
+	assert.Equal(t, ret.ProtocolVersion, uint32(70015))
 	assert.Equal(t, ret.LocalRelay, true)
 	assert.Equal(t, ret.NetworkActive, true)
 }
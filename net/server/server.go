@@ -6,6 +6,7 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/binary"
@@ -13,6 +14,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/copernet/copernicus/persist"
+	"io/ioutil"
 	"math"
 	"net"
 	"os"
@@ -29,11 +31,14 @@ import (
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/logic/lblock"
 	"github.com/copernet/copernicus/logic/lchain"
+	"github.com/copernet/copernicus/logic/lindex"
 	"github.com/copernet/copernicus/logic/lmempool"
+	"github.com/copernet/copernicus/logic/lmerkleblock"
 	"github.com/copernet/copernicus/model"
 	"github.com/copernet/copernicus/model/block"
 	"github.com/copernet/copernicus/model/blockindex"
 	"github.com/copernet/copernicus/model/chain"
+	"github.com/copernet/copernicus/model/dsproof"
 	"github.com/copernet/copernicus/model/mempool"
 	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/net/addrmgr"
@@ -42,6 +47,7 @@ import (
 	"github.com/copernet/copernicus/net/upnp"
 	"github.com/copernet/copernicus/net/wire"
 	"github.com/copernet/copernicus/peer"
+	"github.com/copernet/copernicus/persist/disk"
 	"github.com/copernet/copernicus/service"
 	"github.com/copernet/copernicus/util"
 	"github.com/copernet/copernicus/util/amount"
@@ -51,7 +57,7 @@ import (
 const (
 	// defaultServices describes the default services that are supported by
 	// the server.
-	defaultServices = wire.SFNodeNetwork | wire.SFNodeCash
+	defaultServices = wire.SFNodeNetwork | wire.SFNodeBloom | wire.SFNodeCash
 
 	// defaultRequiredServices describes the default services that are
 	// required to be supported by outbound peers.
@@ -72,8 +78,23 @@ const (
 	BanReasonNodeMisbehaving int = 1
 	BanReasonManuallyAdded   int = 2
 
+	// banListVersion is the current version of the on-disk ban list.
+	banListVersion = 1
+
+	// banSweepInterval is the interval between sweeps of the expired bans.
+	banSweepInterval = time.Minute * 15
+
 	// REVERT_TO_INV_DIFF when peer is neer to tip, set its revertToInv to false back
 	REVERT_TO_INV_DIFF = 7
+
+	// maxCmpctBlockDepth is how deep below the tip a block requested as a
+	// compact block may be, deeper blocks are sent in full.
+	maxCmpctBlockDepth = 5
+
+	// maxBlockTxnDepth is how deep below the tip a block may be for its
+	// transactions to be served by getblocktxn, deeper blocks are sent in
+	// full.
+	maxBlockTxnDepth = 10
 )
 
 var (
@@ -191,6 +212,13 @@ type BannedInfo struct {
 	Reason     int
 }
 
+// serializedBanList is the on-disk format of the ban list, in the ban peers
+// file of the data directory.
+type serializedBanList struct {
+	Version int
+	Banned  []*BannedInfo
+}
+
 // peerState maintains state of inbound, persistent, outbound peers as well
 // as banned peers and outbound groups.
 type peerState struct {
@@ -519,15 +547,16 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 	txDescs := mempool.GetInstance().GetAllTxEntry()
 	invMsg := wire.NewMsgInvSizeHint(uint(len(txDescs)))
 
-	for hash := range txDescs {
+	for hash, txDesc := range txDescs {
 		// Either add all transactions when there is no bloom filter,
 		// or only the transactions that match the filter when there is
 		// one.
-		// if !sp.filter.IsLoaded() || sp.filter.MatchTxAndUpdate(&hash) {
-		iv := wire.NewInvVect(wire.InvTypeTx, &hash)
-		invMsg.AddInvVect(iv)
-		if len(invMsg.InvList)+1 > wire.MaxInvPerMsg {
-			break
+		if !sp.filter.IsLoaded() || sp.filter.MatchTxAndUpdate(txDesc.Tx) {
+			iv := wire.NewInvVect(wire.InvTypeTx, &hash)
+			invMsg.AddInvVect(iv)
+			if len(invMsg.InvList)+1 > wire.MaxInvPerMsg {
+				break
+			}
 		}
 	}
 
@@ -603,6 +632,205 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte, done
 	sp.server.syncManager.QueueBlock(block, buf, sp.Peer, done)
 }
 
+// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin message.
+// Like OnBlock, it blocks until the compact block has been processed.
+func (sp *serverPeer) OnCmpctBlock(_ *peer.Peer, msg *wire.MsgCmpctBlock, done chan<- struct{}) {
+	hash := msg.Header.GetHash()
+	iv := wire.NewInvVect(wire.InvTypeBlock, &hash)
+	sp.AddKnownInventory(iv)
+
+	sp.server.syncManager.QueueCmpctBlock(msg, sp.Peer, done)
+}
+
+// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin message,
+// which completes a compact block.  It blocks until the block has been
+// processed.
+func (sp *serverPeer) OnBlockTxn(_ *peer.Peer, msg *wire.MsgBlockTxn, done chan<- struct{}) {
+	sp.server.syncManager.QueueBlockTxn(msg, sp.Peer, done)
+}
+
+// OnDSProof is invoked when a peer receives a dsproof-beta bitcoin cash
+// message.  It blocks until the proof has been validated.
+func (sp *serverPeer) OnDSProof(_ *peer.Peer, msg *wire.MsgDSProof, done chan<- struct{}) {
+	if conf.Cfg.P2PNet.BlocksOnly {
+		log.Trace("Ignoring dsproof from %v - blocksonly enabled", sp)
+		done <- struct{}{}
+		return
+	}
+
+	proof := (*dsproof.DSProof)(msg)
+	hash := proof.GetHash()
+	sp.AddKnownInventory(wire.NewInvVect(wire.InvTypeDSProof, &hash))
+
+	sp.server.syncManager.QueueDSProof(proof, sp.Peer, done)
+}
+
+// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin message.
+// The requested transactions of a recent block are sent in a blocktxn
+// message, older blocks are sent in full.
+func (sp *serverPeer) OnGetBlockTxn(_ *peer.Peer, msg *wire.MsgGetBlockTxn) {
+	blkIndex, send := findBlockIndex(&msg.BlockHash)
+	if !send || !blkIndex.HasData() {
+		log.Debug("Peer %v requested transactions of unknown block %s", sp, msg.BlockHash)
+		return
+	}
+
+	if chain.GetInstance().Height()-blkIndex.Height > maxBlockTxnDepth {
+		log.Debug("Peer %v requested transactions of old block %s, sending the block",
+			sp, msg.BlockHash)
+		sp.server.pushBlockMsg(sp, &msg.BlockHash, nil, nil, wire.BaseEncoding)
+		return
+	}
+
+	bl, err := lblock.GetBlockByIndex(blkIndex, sp.server.chainParams)
+	if err != nil {
+		log.Error("Unable to fetch block %s requested by getblocktxn: %v", msg.BlockHash, err)
+		return
+	}
+	txs := make([]*tx.Tx, 0, len(msg.Indexes))
+	for _, index := range msg.Indexes {
+		if index >= uint32(len(bl.Txs)) {
+			sp.addBanScore(100, 0, "getblocktxn-out-of-bounds")
+			return
+		}
+		txs = append(txs, bl.Txs[index])
+	}
+	sp.QueueMessage(wire.NewMsgBlockTxn(&msg.BlockHash, txs), nil)
+}
+
+// prepareBlockFilterRequest checks a request of the filters of the blocks
+// from startHeight up to stopHash, spanning less than maxHeightDiff blocks.
+// It returns the block index of stopHash and the block filter index, or nil
+// when the request is invalid, in which case the peer is disconnected.
+func (sp *serverPeer) prepareBlockFilterRequest(filterType wire.FilterType, startHeight uint32,
+	stopHash *util.Hash, maxHeightDiff uint32) (*blockindex.BlockIndex, *lindex.BlockFilterIndex) {
+
+	bfi := lindex.GetBlockFilterIndex()
+	if sp.server.services&wire.SFNodeCompactFilters == 0 || bfi == nil ||
+		filterType != wire.GCSFilterRegular {
+		log.Debug("Peer %v requested unsupported block filter type %d -- disconnecting",
+			sp, filterType)
+		sp.Disconnect()
+		return nil, nil
+	}
+
+	stopIndex, send := findBlockIndex(stopHash)
+	if !send {
+		log.Debug("Peer %v requested block filters of unknown block %s -- disconnecting",
+			sp, stopHash)
+		sp.Disconnect()
+		return nil, nil
+	}
+
+	stopHeight := uint32(stopIndex.Height)
+	if startHeight > stopHeight {
+		log.Debug("Peer %v sent invalid block filter request, start height %d "+
+			"is above stop height %d -- disconnecting", sp, startHeight, stopHeight)
+		sp.Disconnect()
+		return nil, nil
+	}
+	if stopHeight-startHeight >= maxHeightDiff {
+		log.Debug("Peer %v requested too many block filters: %d / %d -- disconnecting",
+			sp, stopHeight-startHeight+1, maxHeightDiff)
+		sp.Disconnect()
+		return nil, nil
+	}
+	return stopIndex, bfi
+}
+
+// blockFilterRange returns the blocks from startHeight up to stopIndex along
+// with their filters, or nil if some blocks are not indexed yet.
+func blockFilterRange(bfi *lindex.BlockFilterIndex, startHeight uint32,
+	stopIndex *blockindex.BlockIndex) ([]*blockindex.BlockIndex, []*lindex.BlockFilterEntry) {
+
+	count := stopIndex.Height - int32(startHeight) + 1
+	blocks := make([]*blockindex.BlockIndex, count)
+	entries := make([]*lindex.BlockFilterEntry, count)
+	index := stopIndex
+	for i := count - 1; i >= 0; i-- {
+		entry, err := bfi.LookupFilter(index.GetBlockHash())
+		if err != nil || entry == nil {
+			log.Debug("Failed to find block filter of %s: %v", index.GetBlockHash(), err)
+			return nil, nil
+		}
+		blocks[i] = index
+		entries[i] = entry
+		index = index.Prev
+	}
+	return blocks, entries
+}
+
+// OnGetCFilters is invoked when a peer receives a getcfilters bitcoin
+// message.  The filters of the requested blocks are sent in cfilter messages.
+func (sp *serverPeer) OnGetCFilters(_ *peer.Peer, msg *wire.MsgGetCFilters) {
+	stopIndex, bfi := sp.prepareBlockFilterRequest(msg.FilterType, msg.StartHeight,
+		&msg.StopHash, wire.MaxGetCFiltersReqRange)
+	if stopIndex == nil {
+		return
+	}
+
+	blocks, entries := blockFilterRange(bfi, msg.StartHeight, stopIndex)
+	for i, entry := range entries {
+		sp.QueueMessage(wire.NewMsgCFilter(msg.FilterType, blocks[i].GetBlockHash(), entry.Filter), nil)
+	}
+}
+
+// OnGetCFHeaders is invoked when a peer receives a getcfheaders bitcoin
+// message.  The filter hashes of the requested blocks are sent in a cfheaders
+// message, along with the filter header preceding them.
+func (sp *serverPeer) OnGetCFHeaders(_ *peer.Peer, msg *wire.MsgGetCFHeaders) {
+	stopIndex, bfi := sp.prepareBlockFilterRequest(msg.FilterType, msg.StartHeight,
+		&msg.StopHash, wire.MaxCFHeadersPerMsg)
+	if stopIndex == nil {
+		return
+	}
+
+	cfheaders := wire.NewMsgCFHeaders()
+	cfheaders.FilterType = msg.FilterType
+	cfheaders.StopHash = msg.StopHash
+	if msg.StartHeight > 0 {
+		prevIndex := stopIndex.GetAncestor(int32(msg.StartHeight - 1))
+		prev, err := bfi.LookupFilter(prevIndex.GetBlockHash())
+		if err != nil || prev == nil {
+			log.Debug("Failed to find block filter of %s: %v", prevIndex.GetBlockHash(), err)
+			return
+		}
+		cfheaders.PrevFilterHeader = prev.Header
+	}
+
+	_, entries := blockFilterRange(bfi, msg.StartHeight, stopIndex)
+	if entries == nil {
+		return
+	}
+	for _, entry := range entries {
+		cfheaders.AddCFHash(&entry.FilterHash)
+	}
+	sp.QueueMessage(cfheaders, nil)
+}
+
+// OnGetCFCheckpt is invoked when a peer receives a getcfcheckpt bitcoin
+// message.  The filter headers of every wire.CFCheckptInterval blocks up to
+// the requested block are sent in a cfcheckpt message.
+func (sp *serverPeer) OnGetCFCheckpt(_ *peer.Peer, msg *wire.MsgGetCFCheckpt) {
+	stopIndex, bfi := sp.prepareBlockFilterRequest(msg.FilterType, 0,
+		&msg.StopHash, math.MaxUint32)
+	if stopIndex == nil {
+		return
+	}
+
+	headers := make([]*util.Hash, stopIndex.Height/wire.CFCheckptInterval)
+	for i := range headers {
+		index := stopIndex.GetAncestor(int32(i+1) * wire.CFCheckptInterval)
+		entry, err := bfi.LookupFilter(index.GetBlockHash())
+		if err != nil || entry == nil {
+			log.Debug("Failed to find block filter of %s: %v", index.GetBlockHash(), err)
+			return
+		}
+		headers[i] = &entry.Header
+	}
+	sp.QueueMessage(wire.NewMsgCFCheckpt(msg.FilterType, &msg.StopHash, headers), nil)
+}
+
 // OnInv is invoked when a peer receives an inv bitcoin message and is
 // used to examine the inventory being advertised by the remote peer and react
 // accordingly.  We pass the message down to blockmanager which will call
@@ -687,8 +915,12 @@ func (sp *serverPeer) doGetData(msg *wire.MsgGetData, done chan<- struct{}) {
 			err = sp.server.pushTxMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
 		case wire.InvTypeBlock:
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
-			// case wire.InvTypeFilteredBlock:
-			// 	err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
+		case wire.InvTypeCompatedBlock:
+			err = sp.server.pushCmpctBlockMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
+		case wire.InvTypeFilteredBlock:
+			err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
+		case wire.InvTypeDSProof:
+			err = sp.server.pushDSProofMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
 		default:
 			log.Warn("Unknown type in inventory request %d",
 				iv.Type)
@@ -1146,12 +1378,46 @@ func (s *Server) pushTxMsg(sp *serverPeer, hash *util.Hash, doneChan chan<- stru
 	return nil
 }
 
+// pushDSProofMsg sends a dsproof-beta message for the provided proof hash to
+// the connected peer.  An error is returned if the proof is not in the
+// mempool.
+func (s *Server) pushDSProofMsg(sp *serverPeer, hash *util.Hash, doneChan chan<- struct{},
+	waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
+
+	entry := mempool.GetInstance().GetDSProof(*hash)
+	if entry == nil {
+		log.Trace("Unable to fetch dsproof %s from the transaction pool", hash)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+
+		return errors.New("dsproof not found")
+	}
+
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
+	}
+
+	sp.QueueMessageWithEncoding((*wire.MsgDSProof)(entry.Proof), doneChan, encoding)
+
+	return nil
+}
+
 // pushBlockMsg sends a block message for the provided block hash to the
 // connected peer.  An error is returned if the block hash is not known.
 func (s *Server) pushBlockMsg(sp *serverPeer, hash *util.Hash, doneChan chan<- struct{},
 	waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
 
 	blkIndex, send := findBlockIndex(hash)
+	if send && s.isPrunedForPeers(blkIndex) && !sp.IsWhitelisted() {
+		// A pruning node only promises the last blocks to its peers.
+		log.Debug("Ignore block request below the %d blocks limit of a pruning node from peer %v",
+			block.MinBlocksToKeep, sp)
+		sp.Disconnect()
+		send = false
+	}
 	if send && blkIndex.HasData() {
 		// Fetch the raw block bytes from the database.
 		bl, err := lblock.GetBlockByIndex(blkIndex, s.chainParams)
@@ -1194,13 +1460,53 @@ func (s *Server) pushBlockMsg(sp *serverPeer, hash *util.Hash, doneChan chan<- s
 		}
 	} else {
 		log.Error("data for block(%s) is not ready: send(%v) blkIndex(%v)", hash, send, blkIndex)
-		doneChan <- struct{}{}
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
 		return fmt.Errorf("data for block(%s) is not ready", hash)
 	}
 
 	return nil
 }
 
+// pushCmpctBlockMsg sends a cmpctblock message for the provided block hash to
+// the connected peer.  Blocks too deep below the tip to be reconstructed from
+// a mempool are sent in full.
+func (s *Server) pushCmpctBlockMsg(sp *serverPeer, hash *util.Hash, doneChan chan<- struct{},
+	waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
+
+	blkIndex, send := findBlockIndex(hash)
+	if !send || !blkIndex.HasData() || sp.ProtocolVersion() < wire.ShortIdsBlocksVersion ||
+		chain.GetInstance().Height()-blkIndex.Height >= maxCmpctBlockDepth {
+		return s.pushBlockMsg(sp, hash, doneChan, waitChan, encoding)
+	}
+
+	bl, err := lblock.GetBlockByIndex(blkIndex, s.chainParams)
+	if err != nil {
+		log.Trace("Unable to fetch requested block hash %v: %v", hash, err)
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
+	}
+	sp.QueueMessageWithEncoding(wire.NewMsgCmpctBlock(bl), doneChan, encoding)
+	return nil
+}
+
+// isPrunedForPeers returns whether the block is deeper than the blocks a
+// node advertising SFNodeNetworkLimited, but not SFNodeNetwork, serves.
+func (s *Server) isPrunedForPeers(blkIndex *blockindex.BlockIndex) bool {
+	if s.services&wire.SFNodeNetwork != 0 || s.services&wire.SFNodeNetworkLimited == 0 {
+		return false
+	}
+	// add two blocks buffer extension for possible races
+	return chain.GetInstance().Height()-blkIndex.Height > block.MinBlocksToKeep+2
+}
+
 func findBlockIndex(hash *util.Hash) (blkIndex *blockindex.BlockIndex, send bool) {
 	persist.CsMain.Lock() //to protect chain.indexMap
 	defer persist.CsMain.Unlock()
@@ -1229,62 +1535,74 @@ func findBlockIndex(hash *util.Hash) (blkIndex *blockindex.BlockIndex, send bool
 // the connected peer.  Since a merkle block requires the peer to have a filter
 // loaded, this call will simply be ignored if there is no filter loaded.  An
 // error is returned if the block hash is not known.
-//func (s *Server) pushMerkleBlockMsg(sp *serverPeer, hash *util.Hash,
-//	doneChan chan<- struct{}, waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
-
-// Do not send a response if the peer doesn't have a filter loaded.
-//if !sp.filter.IsLoaded() {
-//if doneChan != nil {
-//	doneChan <- struct{}{}
-//}
-//return nil
-//}
-
-// // Fetch the raw block bytes from the database.
-// blk, err := lblock.GetBlock(hash)
-// if err != nil {
-// 	log.Trace("Unable to fetch requested block hash %v: %v",
-// 		hash, err)
-
-// 	if doneChan != nil {
-// 		doneChan <- struct{}{}
-// 	}
-// 	return err
-// }
-
-// // Generate a merkle block by filtering the requested block according
-// // to the filter for the peer.
-// merkle, matchedTxIndices := bloom.NewMerkleBlock(blk, sp.filter)
-
-// // Once we have fetched data wait for any previous operation to finish.
-// if waitChan != nil {
-// 	<-waitChan
-// }
-
-// // Send the merkleblock.  Only send the done channel with this message
-// // if no transactions will be sent afterwards.
-// var dc chan<- struct{}
-// if len(matchedTxIndices) == 0 {
-// 	dc = doneChan
-// }
-// sp.QueueMessage(merkle, dc)
-
-// // Finally, send any matched transactions.
-// blkTransactions := blk.Txs
-// for i, txIndex := range matchedTxIndices {
-// 	// Only send the done channel on the final transaction.
-// 	var dc chan<- struct{}
-// 	if i == len(matchedTxIndices)-1 {
-// 		dc = doneChan
-// 	}
-// 	if txIndex < uint32(len(blkTransactions)) {
-// 		sp.QueueMessageWithEncoding(blkTransactions[txIndex], dc,
-// 			encoding)
-// 	}
-// }
-
-// return nil
-//}
+func (s *Server) pushMerkleBlockMsg(sp *serverPeer, hash *util.Hash,
+	doneChan chan<- struct{}, waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
+
+	// Do not send a response if the peer doesn't have a filter loaded.
+	if !sp.filter.IsLoaded() {
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return nil
+	}
+
+	blkIndex, send := findBlockIndex(hash)
+	if send && s.isPrunedForPeers(blkIndex) && !sp.IsWhitelisted() {
+		// A pruning node only promises the last blocks to its peers.
+		log.Debug("Ignore filtered block request below the %d blocks limit of a pruning node from peer %v",
+			block.MinBlocksToKeep, sp)
+		sp.Disconnect()
+		send = false
+	}
+	if !send || !blkIndex.HasData() {
+		log.Debug("data for filtered block(%s) is not ready: send(%v)", hash, send)
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return fmt.Errorf("data for block(%s) is not ready", hash)
+	}
+
+	// Fetch the raw block bytes from the database.
+	blk, err := lblock.GetBlockByIndex(blkIndex, s.chainParams)
+	if err != nil {
+		log.Trace("Unable to fetch requested block hash %v: %v",
+			hash, err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+
+	// Generate a merkle block by filtering the requested block according
+	// to the filter for the peer.
+	merkle := lmerkleblock.NewMerkleBlockWithFilter(blk, sp.filter)
+
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
+	}
+
+	// Send the merkleblock.  Only send the done channel with this message
+	// if no transactions will be sent afterwards.
+	var dc chan<- struct{}
+	if len(merkle.MatchedTxn) == 0 {
+		dc = doneChan
+	}
+	sp.QueueMessage(merkle.MsgMerkleBlock(), dc)
+
+	// Finally, send any matched transactions.
+	for i, matched := range merkle.MatchedTxn {
+		// Only send the done channel on the final transaction.
+		var dc chan<- struct{}
+		if i == len(merkle.MatchedTxn)-1 {
+			dc = doneChan
+		}
+		sp.QueueMessageWithEncoding((*wire.MsgTx)(blk.Txs[matched.N]), dc, encoding)
+	}
+
+	return nil
+}
 
 // handleUpdatePeerHeight updates the heights of all peers who were known to
 // announce a block we recently accepted.
@@ -1583,46 +1901,120 @@ func (s *Server) handleClearBannedMsg(state *peerState) {
 	s.saveBannedInfo(state)
 }
 
+// sweepBanned removes the expired bans of the addresses and subnets.  It
+// returns whether any ban was removed.
+func (s *Server) sweepBanned(state *peerState) bool {
+	now := util.GetTimeSec()
+	swept := false
+	for _, banned := range []map[string]*BannedInfo{state.bannedAddr, state.bannedIPNet} {
+		for address, info := range banned {
+			if now >= info.BanUntil {
+				log.Debug("Ban of %s expired", address)
+				delete(banned, address)
+				swept = true
+			}
+		}
+	}
+	return swept
+}
+
+// saveBannedInfo writes the bans which are not expired to the ban peers file.
+// The file is replaced atomically, so that a crash does not lose the list.
 func (s *Server) saveBannedInfo(state *peerState) {
-	bannedList := s.getBannedList(state)
+	s.sweepBanned(state)
+	sbl := &serializedBanList{
+		Version: banListVersion,
+		Banned:  s.getBannedList(state),
+	}
 
-	w, err := os.Create(s.banPeerFile)
+	tmpFile := s.banPeerFile + ".tmp"
+	w, err := os.Create(tmpFile)
 	if err != nil {
-		log.Error("Error opening file %s: %v", s.banPeerFile, err)
+		log.Error("Error opening file %s: %v", tmpFile, err)
 		return
 	}
-
 	enc := json.NewEncoder(w)
-	defer w.Close()
-	if err := enc.Encode(&bannedList); err != nil {
-		log.Error("Failed to encode file %s: %v", s.banPeerFile, err)
+	err = enc.Encode(sbl)
+	w.Close()
+	if err != nil {
+		log.Error("Failed to encode file %s: %v", tmpFile, err)
+		os.Remove(tmpFile)
 		return
 	}
+	if err := os.Rename(tmpFile, s.banPeerFile); err != nil {
+		log.Error("Failed to rename %s to %s: %v", tmpFile, s.banPeerFile, err)
+	}
 }
 
-func (s *Server) loadBannedInfo() error {
-	_, err := os.Stat(s.banPeerFile)
-	if os.IsNotExist(err) {
-		return nil
-	}
-	r, err := os.Open(s.banPeerFile)
+// loadBannedInfo loads the bans saved in the ban peers file into state.  If
+// the file is malformed, it is removed and no ban is loaded.
+func (s *Server) loadBannedInfo(state *peerState) {
+	bannedList, err := s.deserializeBannedInfo(s.banPeerFile)
 	if err != nil {
-		return fmt.Errorf("%s error opening file: %v", s.banPeerFile, err)
+		log.Error("Failed to parse file %s: %v", s.banPeerFile, err)
+		// if it is invalid we nuke the old one unconditionally.
+		err = os.Remove(s.banPeerFile)
+		if err != nil {
+			log.Warn("Failed to remove corrupt ban peers file %s: %v",
+				s.banPeerFile, err)
+		}
+		return
 	}
-	defer r.Close()
 
-	var bannedList []*BannedInfo
-	dec := json.NewDecoder(r)
-	err = dec.Decode(&bannedList)
+	now := util.GetTimeSec()
+	loaded := 0
+	for _, info := range bannedList {
+		if info == nil || now >= info.BanUntil {
+			continue
+		}
+		if strings.Contains(info.Address, "/") {
+			if _, _, err := net.ParseCIDR(info.Address); err != nil {
+				log.Warn("Skipping invalid banned subnet %s", info.Address)
+				continue
+			}
+			state.bannedIPNet[info.Address] = info
+		} else {
+			if net.ParseIP(info.Address) == nil {
+				log.Warn("Skipping invalid banned address %s", info.Address)
+				continue
+			}
+			state.bannedAddr[info.Address] = info
+		}
+		loaded++
+	}
+	log.Info("Loaded %d bans from file '%s'", loaded, s.banPeerFile)
+}
+
+// deserializeBannedInfo reads the bans of the ban peers file.  Besides the
+// versioned format, it reads the plain list written by former versions.
+func (s *Server) deserializeBannedInfo(filePath string) ([]*BannedInfo, error) {
+	_, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("error reading %s: %v", s.banPeerFile, err)
+		return nil, fmt.Errorf("%s error opening file: %v", filePath, err)
 	}
 
-	for _, info := range bannedList {
-		s.BanAddr(info.Address, info.CreateTime, info.BanUntil, info.Reason)
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var bannedList []*BannedInfo
+		if err := json.Unmarshal(data, &bannedList); err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", filePath, err)
+		}
+		return bannedList, nil
 	}
 
-	return nil
+	var sbl serializedBanList
+	if err := json.Unmarshal(data, &sbl); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", filePath, err)
+	}
+	if sbl.Version != banListVersion {
+		return nil, fmt.Errorf("unknown version %v in serialized "+
+			"ban list", sbl.Version)
+	}
+	return sbl.Banned, nil
 }
 
 func (s *Server) handleRelayBlocks(state *peerState, msg relayBlocksMsg) {
@@ -1651,6 +2043,11 @@ func (s *Server) handlePing(msg *PingMsg) {
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
 // known to have it.  It is invoked from the peerHandler goroutine.
 func (s *Server) handleRelayInvMsg(state *peerState, msg relayMsg) {
+	if cmpctBlock, ok := msg.data.(*wire.MsgCmpctBlock); ok {
+		s.handleRelayCmpctBlock(state, msg.invVect, cmpctBlock)
+		return
+	}
+
 	if msg.invVect.Type == wire.InvTypeTx {
 		tx, _ := msg.data.(*tx.Tx)
 		s.txRelayer.Cache(&msg.invVect.Hash, tx)
@@ -1679,6 +2076,11 @@ func (s *Server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 			}
 		}
 
+		// Double spend proofs are relayed like transactions.
+		if msg.invVect.Type == wire.InvTypeDSProof && sp.relayTxDisabled() {
+			return
+		}
+
 		if msg.invVect.Type == wire.InvTypeTx {
 			// Don't relay the transaction to the peer when it has
 			// transaction relaying disabled.
@@ -1717,6 +2119,29 @@ func (s *Server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 	})
 }
 
+// handleRelayCmpctBlock pushes a new block as a compact block to the peers
+// which asked for it in high-bandwidth mode and know about its parent.  The
+// other peers get the block announced by the following inventory relay.
+func (s *Server) handleRelayCmpctBlock(state *peerState, iv *wire.InvVect, msg *wire.MsgCmpctBlock) {
+	blkIndex := chain.GetInstance().FindBlockIndex(iv.Hash)
+	if blkIndex == nil || blkIndex.Prev == nil {
+		return
+	}
+
+	state.forAllPeers(func(sp *serverPeer) {
+		if !sp.Connected() || !sp.VerAckReceived() || !sp.WantsCmpctBlocks() ||
+			sp.ProtocolVersion() < wire.ShortIdsBlocksVersion {
+			return
+		}
+		if sp.IsKnownInventory(iv) || !sp.PeerHasHeader(blkIndex.Prev) {
+			return
+		}
+		sp.AddKnownInventory(iv)
+		sp.QueueMessage(msg, nil)
+		sp.UpdateIndexBestHeaderSent(blkIndex)
+	})
+}
+
 func (s *Server) handleMinedBlock(mb minedBlockMsg) {
 	s.syncManager.QueueMinedBlock(mb.block, mb.done)
 }
@@ -1927,21 +2352,30 @@ func disconnectPeer(peerList map[int32]*serverPeer, compareFunc func(*serverPeer
 func newPeerConfig(sp *serverPeer) *peer.Config {
 	return &peer.Config{
 		Listeners: peer.MessageListeners{
-			OnVersion:    sp.OnVersion,
-			OnVerAck:     sp.OnVerAck,
-			OnMemPool:    sp.OnMemPool,
-			OnTx:         sp.OnTx,
-			OnBlock:      sp.OnBlock,
-			OnInv:        sp.OnInv,
-			OnHeaders:    sp.OnHeaders,
-			OnGetData:    sp.OnGetData,
-			OnGetBlocks:  sp.OnGetBlocks,
-			OnGetHeaders: sp.OnGetHeaders,
-			OnFeeFilter:  sp.OnFeeFilter,
-			OnReject:     sp.OnReject,
-			//OnFilterAdd:   sp.OnFilterAdd,
-			//OnFilterClear: sp.OnFilterClear,
-			//OnFilterLoad:  sp.OnFilterLoad,
+			OnVersion:     sp.OnVersion,
+			OnVerAck:      sp.OnVerAck,
+			OnMemPool:     sp.OnMemPool,
+			OnTx:          sp.OnTx,
+			OnBlock:       sp.OnBlock,
+			OnInv:         sp.OnInv,
+			OnHeaders:     sp.OnHeaders,
+			OnGetData:     sp.OnGetData,
+			OnGetBlocks:   sp.OnGetBlocks,
+			OnGetHeaders:  sp.OnGetHeaders,
+			OnFeeFilter:   sp.OnFeeFilter,
+			OnReject:      sp.OnReject,
+			OnCmpctBlock:  sp.OnCmpctBlock,
+			OnGetBlockTxn: sp.OnGetBlockTxn,
+			OnBlockTxn:    sp.OnBlockTxn,
+			OnFilterAdd:   sp.OnFilterAdd,
+			OnFilterClear: sp.OnFilterClear,
+			OnFilterLoad:  sp.OnFilterLoad,
+
+			OnGetCFilters:  sp.OnGetCFilters,
+			OnGetCFHeaders: sp.OnGetCFHeaders,
+			OnGetCFCheckpt: sp.OnGetCFCheckpt,
+			OnDSProof:      sp.OnDSProof,
+
 			OnGetAddr:                  sp.OnGetAddr,
 			OnAddr:                     sp.OnAddr,
 			OnRead:                     sp.OnRead,
@@ -2073,6 +2507,9 @@ func (s *Server) cycle() {
 		bannedIPNet:     make(map[string]*BannedInfo),
 		outboundGroups:  make(map[string]int),
 	}
+	s.loadBannedInfo(state)
+	sweepTicker := time.NewTicker(banSweepInterval)
+	defer sweepTicker.Stop()
 
 	if !conf.Cfg.P2PNet.DisableDNSSeed {
 		// Add peers discovered through DNS to the address manager.
@@ -2118,6 +2555,12 @@ out:
 		case <-s.clearBanned:
 			s.handleClearBannedMsg(state)
 
+			// Forget the expired bans.
+		case <-sweepTicker.C:
+			if s.sweepBanned(state) {
+				s.saveBannedInfo(state)
+			}
+
 			// New inventory to potentially be relayed to other peers.
 		case invMsg := <-s.relayInv:
 			s.handleRelayInvMsg(state, invMsg)
@@ -2232,6 +2675,14 @@ func (s *Server) RelayInventory(invVect *wire.InvVect, data interface{}) {
 	s.relayInv <- relayMsg{invVect: invVect, data: data}
 }
 
+// RelayCmpctBlock announces a new block extending the tip as a compact block
+// to the peers in high-bandwidth mode.  It must be relayed before the block
+// inventory, so that these peers are not announced the block twice.
+func (s *Server) RelayCmpctBlock(blk *block.Block) {
+	hash := blk.GetHash()
+	s.relayInv <- relayMsg{invVect: wire.NewInvVect(wire.InvTypeBlock, &hash), data: wire.NewMsgCmpctBlock(blk)}
+}
+
 func (s *Server) RelayBlocks(invVects []*wire.InvVect, headers []*block.BlockHeader) {
 	s.relayBlocks <- relayBlocksMsg{invVects: invVects, headers: headers}
 }
@@ -2406,10 +2857,6 @@ func (s *Server) Start() {
 		s.wg.Add(1)
 		go s.upnpUpdateThread()
 	}
-
-	if err := s.loadBannedInfo(); err != nil {
-		log.Error("loadBannedInfo error:%s", err.Error())
-	}
 }
 
 // Stop gracefully shuts down the server by stopping and disconnecting all
@@ -2593,6 +3040,14 @@ func NewServer(chainParams *model.BitcoinParams, ts *util.MedianTime, interrupt
 	if cfg.Protocol.NoPeerBloomFilters {
 		services &^= wire.SFNodeBloom
 	}
+	if conf.Args.PeerBlockFilters {
+		services |= wire.SFNodeCompactFilters
+	}
+	if disk.GetPruneState().PruneMode {
+		// A pruned node can not serve the full chain anymore.
+		services &^= wire.SFNodeNetwork
+		services |= wire.SFNodeNetworkLimited
+	}
 
 	amgr := addrmgr.New(cfg.DataDir, net.LookupIP)
 
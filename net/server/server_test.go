@@ -706,6 +706,31 @@ func TestOnMemPool(t *testing.T) {
 	assert.False(t, sp.Connected())
 }
 
+func TestOnGetCFHeadersUnsupported(t *testing.T) {
+	chn := make(chan struct{})
+	svr, err := NewServer(model.ActiveNetParams, nil, chn)
+	assert.Nil(t, err)
+
+	svr.Start()
+	defer svr.Stop()
+
+	r, w := io.Pipe()
+	inConn := &conn{raddr: "127.0.0.1:18334", Writer: w, Reader: r}
+	sp := newServerPeer(svr, false)
+	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp), isWhitelisted(inConn.RemoteAddr()))
+	sp.AssociateConnection(inConn, svr.MsgChan, func(peer *peer.Peer) {
+		svr.syncManager.NewPeer(peer)
+	})
+	assert.True(t, sp.Connected())
+
+	// Peers requesting filters from a node which does not serve them are
+	// disconnected.
+	assert.Zero(t, svr.services&wire.SFNodeCompactFilters)
+	genesisHash := model.ActiveNetParams.GenesisHash
+	sp.OnGetCFHeaders(sp.Peer, wire.NewMsgGetCFHeaders(wire.GCSFilterRegular, 0, genesisHash))
+	assert.False(t, sp.Connected())
+}
+
 func TestOnTx(t *testing.T) {
 	msgTx := (*wire.MsgTx)(tx.NewTx(0, 1))
 	config := peer.Config{}
@@ -945,6 +970,25 @@ func TestOnFilterLoad(t *testing.T) {
 	sp.OnFilterLoad(in, msg)
 }
 
+func TestPushMerkleBlockMsg(t *testing.T) {
+	config := peer.Config{}
+	in := peer.NewInboundPeer(&config, false)
+	sp := newServerPeer(s, false)
+	sp.Peer = in
+	unknown := util.HashFromString("00000000000000000000000000000000000000000000000000000000000000ff")
+
+	// Nothing is sent to a peer without filter.
+	done := make(chan struct{}, 1)
+	err := s.pushMerkleBlockMsg(sp, unknown, done, nil, wire.BaseEncoding)
+	assert.Nil(t, err)
+	<-done
+
+	sp.filter.Reload(wire.NewMsgFilterLoad([]byte{0x01, 0x02}, 10, 0, wire.BloomUpdateAll))
+	err = s.pushMerkleBlockMsg(sp, unknown, done, nil, wire.BaseEncoding)
+	assert.NotNil(t, err)
+	<-done
+}
+
 func TestOnGetAddr(t *testing.T) {
 	config := peer.Config{}
 	in := peer.NewInboundPeer(&config, false)
@@ -1075,6 +1119,86 @@ func TestHandleAddPeerMsg(t *testing.T) {
 	assert.Equal(t, 0, len(ps.bannedAddr))
 }
 
+func TestSaveLoadBannedInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "banlist")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s := &Server{banPeerFile: filepath.Join(dir, "banpeers.json")}
+	newState := func() *peerState {
+		return &peerState{
+			bannedAddr:  make(map[string]*BannedInfo),
+			bannedIPNet: make(map[string]*BannedInfo),
+		}
+	}
+	now := util.GetTimeSec()
+
+	// a missing file loads no ban.
+	ps := newState()
+	s.loadBannedInfo(ps)
+	assert.Equal(t, 0, len(ps.bannedAddr)+len(ps.bannedIPNet))
+
+	peerBan := &BannedInfo{Address: "10.0.0.1", BanUntil: now + 60, CreateTime: now - 10,
+		Reason: BanReasonNodeMisbehaving}
+	netBan := &BannedInfo{Address: "192.168.0.0/24", BanUntil: now + 120, CreateTime: now - 20,
+		Reason: BanReasonManuallyAdded}
+	ps.bannedAddr[peerBan.Address] = peerBan
+	ps.bannedIPNet[netBan.Address] = netBan
+	ps.bannedAddr["10.0.0.2"] = &BannedInfo{Address: "10.0.0.2", BanUntil: now - 1,
+		CreateTime: now - 60, Reason: BanReasonManuallyAdded}
+	s.saveBannedInfo(ps)
+	assert.Equal(t, 1, len(ps.bannedAddr), "the expired ban is swept")
+
+	data, err := ioutil.ReadFile(s.banPeerFile)
+	assert.Nil(t, err)
+	var sbl serializedBanList
+	assert.Nil(t, json.Unmarshal(data, &sbl))
+	assert.Equal(t, banListVersion, sbl.Version)
+	assert.Equal(t, 2, len(sbl.Banned))
+
+	loaded := newState()
+	s.loadBannedInfo(loaded)
+	assert.Equal(t, map[string]*BannedInfo{peerBan.Address: peerBan}, loaded.bannedAddr)
+	assert.Equal(t, map[string]*BannedInfo{netBan.Address: netBan}, loaded.bannedIPNet)
+
+	// the plain list of former versions is still read, without the expired
+	// bans.
+	legacy, err := json.Marshal([]*BannedInfo{peerBan, {Address: "10.0.0.3", BanUntil: now - 1}})
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(s.banPeerFile, legacy, 0644))
+	loaded = newState()
+	s.loadBannedInfo(loaded)
+	assert.Equal(t, map[string]*BannedInfo{peerBan.Address: peerBan}, loaded.bannedAddr)
+	assert.Equal(t, 0, len(loaded.bannedIPNet))
+
+	// a file of an unknown version is removed.
+	assert.Nil(t, ioutil.WriteFile(s.banPeerFile, []byte(`{"Version":99,"Banned":[]}`), 0644))
+	loaded = newState()
+	s.loadBannedInfo(loaded)
+	assert.Equal(t, 0, len(loaded.bannedAddr)+len(loaded.bannedIPNet))
+	_, err = os.Stat(s.banPeerFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSweepBanned(t *testing.T) {
+	now := util.GetTimeSec()
+	ps := &peerState{
+		bannedAddr: map[string]*BannedInfo{
+			"10.0.0.1": {Address: "10.0.0.1", BanUntil: now + 60},
+			"10.0.0.2": {Address: "10.0.0.2", BanUntil: now},
+		},
+		bannedIPNet: map[string]*BannedInfo{
+			"10.1.0.0/16": {Address: "10.1.0.0/16", BanUntil: now - 60},
+		},
+	}
+	s := &Server{}
+	assert.True(t, s.sweepBanned(ps))
+	assert.Equal(t, 1, len(ps.bannedAddr))
+	assert.NotNil(t, ps.bannedAddr["10.0.0.1"])
+	assert.Equal(t, 0, len(ps.bannedIPNet))
+	assert.False(t, s.sweepBanned(ps))
+}
+
 func TestParseListeners(t *testing.T) {
 	tests := []struct {
 		addr    string
@@ -1650,3 +1774,20 @@ func TestServer_findBlockIndex(t *testing.T) {
 	_, send := findBlockIndex(idxbest.Prev.GetBlockHash())
 	assert.True(t, send)
 }
+
+func TestIsPrunedForPeers(t *testing.T) {
+	services := s.services
+	defer func() { s.services = services }()
+
+	tipHeight := chain.GetInstance().Height()
+	recent := &blockindex.BlockIndex{Height: tipHeight - block.MinBlocksToKeep - 2}
+	deep := &blockindex.BlockIndex{Height: tipHeight - block.MinBlocksToKeep - 3}
+
+	s.services = wire.SFNodeNetwork | wire.SFNodeCash
+	assert.False(t, s.isPrunedForPeers(recent))
+	assert.False(t, s.isPrunedForPeers(deep))
+
+	s.services = wire.SFNodeNetworkLimited | wire.SFNodeCash
+	assert.False(t, s.isPrunedForPeers(recent))
+	assert.True(t, s.isPrunedForPeers(deep))
+}
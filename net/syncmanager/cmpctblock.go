@@ -0,0 +1,322 @@
+package syncmanager
+
+import (
+	"errors"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/logic/lblock"
+	"github.com/copernet/copernicus/logic/lmempool"
+	"github.com/copernet/copernicus/logic/lmerkleroot"
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/model/chain"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/peer"
+	"github.com/copernet/copernicus/util"
+)
+
+// maxCmpctAnnouncers is the number of peers asked to announce new blocks
+// with cmpctblock messages (high-bandwidth mode).
+const maxCmpctAnnouncers = 3
+
+var (
+	// errInvalidCmpctBlock means a compact block or the transactions
+	// completing it are malformed.
+	errInvalidCmpctBlock = errors.New("invalid compact block")
+
+	// errShortIDCollision means the short ids of a compact block can not
+	// identify its transactions unambiguously, the full block has to be
+	// downloaded.
+	errShortIDCollision = errors.New("short id collision")
+)
+
+// cmpctBlockMsg packages a bitcoin cmpctblock message and the peer it came
+// from together so the block handler has access to that information.
+type cmpctBlockMsg struct {
+	cmpctBlock *wire.MsgCmpctBlock
+	peer       *peer.Peer
+	reply      chan<- struct{}
+}
+
+// blockTxnMsg packages a bitcoin blocktxn message and the peer it came from
+// together so the block handler has access to that information.
+type blockTxnMsg struct {
+	blockTxn *wire.MsgBlockTxn
+	peer     *peer.Peer
+	reply    chan<- struct{}
+}
+
+// partialBlock is a block being reconstructed from a compact block.
+type partialBlock struct {
+	header  block.BlockHeader
+	txs     []*tx.Tx
+	missing []uint32
+	peer    *peer.Peer
+}
+
+// newPartialBlock fills the transactions of a compact block with its
+// prefilled transactions and the matching transactions of pool.  The
+// positions left empty are recorded as missing, in ascending order.
+func newPartialBlock(msg *wire.MsgCmpctBlock, pool []*tx.Tx, p *peer.Peer) (*partialBlock, error) {
+	if msg.Header.IsNull() || msg.TxCount() == 0 {
+		return nil, errInvalidCmpctBlock
+	}
+
+	pb := &partialBlock{
+		header: msg.Header,
+		txs:    make([]*tx.Tx, msg.TxCount()),
+		peer:   p,
+	}
+	for _, prefilled := range msg.PrefilledTxs {
+		if prefilled.Tx == nil || int(prefilled.Index) >= len(pb.txs) {
+			return nil, errInvalidCmpctBlock
+		}
+		pb.txs[prefilled.Index] = prefilled.Tx
+	}
+
+	// Map the short ids to the positions left after the prefilled
+	// transactions.
+	positions := make(map[uint64]int, len(msg.ShortIDs))
+	next := 0
+	for _, id := range msg.ShortIDs {
+		for pb.txs[next] != nil {
+			next++
+		}
+		if _, ok := positions[id]; ok {
+			return nil, errShortIDCollision
+		}
+		positions[id] = next
+		next++
+	}
+
+	// A position matched by several transactions of the pool is
+	// requested from the peer instead.
+	k0, k1 := msg.ShortIDKeys()
+	ambiguous := make(map[int]struct{})
+	for _, txn := range pool {
+		txHash := txn.GetHash()
+		position, ok := positions[wire.ShortTxID(k0, k1, &txHash)]
+		if !ok {
+			continue
+		}
+		if _, ok := ambiguous[position]; ok {
+			continue
+		}
+		if pb.txs[position] != nil {
+			if pb.txs[position].GetHash() != txHash {
+				pb.txs[position] = nil
+				ambiguous[position] = struct{}{}
+			}
+			continue
+		}
+		pb.txs[position] = txn
+	}
+
+	for i, txn := range pb.txs {
+		if txn == nil {
+			pb.missing = append(pb.missing, uint32(i))
+		}
+	}
+	return pb, nil
+}
+
+// fill completes the block with the missing transactions sent by the peer,
+// in the order they were requested.
+func (pb *partialBlock) fill(txs []*tx.Tx) (*block.Block, error) {
+	if len(txs) != len(pb.missing) {
+		return nil, errInvalidCmpctBlock
+	}
+	for i, index := range pb.missing {
+		if txs[i] == nil {
+			return nil, errInvalidCmpctBlock
+		}
+		pb.txs[index] = txs[i]
+	}
+	pb.missing = nil
+
+	return &block.Block{Header: pb.header, Txs: pb.txs}, nil
+}
+
+// handleCmpctBlockMsg handles cmpctblock messages from all peers.  Compact
+// blocks extending the tip are reconstructed from the mempool, the missing
+// transactions are requested with a getblocktxn message.
+func (sm *SyncManager) handleCmpctBlockMsg(cmsg *cmpctBlockMsg) {
+	peer := cmsg.peer
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		log.Warn("Received cmpctblock message from unknown peer %s", peer.Addr())
+		return
+	}
+
+	gChain := chain.GetInstance()
+	header := &cmsg.cmpctBlock.Header
+	blockHash := header.GetHash()
+	if gChain.FindBlockIndex(header.HashPrevBlock) == nil {
+		// Doesn't connect (or is genesis), instead of DoSing in
+		// AcceptBlockHeader, request deeper headers.
+		if !lblock.IsInitialBlockDownload() {
+			peer.PushGetHeadersMsg(*gChain.GetLocator(gChain.GetIndexBestHeader()), &zeroHash)
+		}
+		return
+	}
+
+	var pindexLast blockindex.BlockIndex
+	if err := sm.ProcessBlockHeadCallBack([]*block.BlockHeader{header}, &pindexLast); err != nil {
+		log.Warn("cmpctblock header %s from %s rejected: %v", blockHash, peer.Addr(), err)
+		return
+	}
+	peer.UpdateLastAnnouncedBlock(&blockHash)
+
+	blkIndex := gChain.FindBlockIndex(blockHash)
+	if blkIndex == nil || blkIndex.HasData() {
+		return
+	}
+
+	// Only blocks extending the tip are worth reconstructing, the others
+	// are downloaded in full like any block announced by its header.
+	tip := gChain.Tip()
+	_, requested := state.requestedBlocks[blockHash]
+	if blkIndex.ChainWork.Cmp(&tip.ChainWork) <= 0 || blkIndex.Prev != tip {
+		if !requested {
+			sm.fetchHeaderBlocks(peer)
+		}
+		return
+	}
+	if !requested {
+		if _, exists := sm.requestedBlocks[blockHash]; exists ||
+			len(state.requestedBlocks) >= MAX_BLOCKS_IN_TRANSIT_PER_PEER {
+			return
+		}
+	}
+
+	pb, err := newPartialBlock(cmsg.cmpctBlock, lmempool.GetTxsForBlockReconstruction(), peer)
+	if err == errShortIDCollision {
+		log.Debug("Short id collision in cmpctblock %s from %s", blockHash, peer.Addr())
+		sm.requestFullBlock(peer, state, &blockHash)
+		return
+	}
+	if err != nil {
+		if peer.ProtocolVersion() < wire.InvalidCBNoBanVersion {
+			sm.misbehaving(peer.Addr(), 100, "invalid-cmpctblk")
+		} else {
+			log.Debug("Peer %s sent us invalid compact block %s", peer.Addr(), blockHash)
+		}
+		return
+	}
+
+	sm.requestedBlocks[blockHash] = peer
+	state.requestedBlocks[blockHash] = struct{}{}
+	if len(pb.missing) == 0 {
+		sm.completePartialBlock(peer, state, pb, nil)
+		return
+	}
+
+	log.Debug("Requesting %d missing transactions of cmpctblock %s from %s",
+		len(pb.missing), blockHash, peer.Addr())
+	sm.partialBlocks[blockHash] = pb
+	peer.QueueMessage(wire.NewMsgGetBlockTxn(&blockHash, pb.missing), nil)
+}
+
+// handleBlockTxnMsg handles blocktxn messages, which complete the compact
+// blocks waiting for their missing transactions.
+func (sm *SyncManager) handleBlockTxnMsg(bmsg *blockTxnMsg) {
+	peer := bmsg.peer
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		log.Warn("Received blocktxn message from unknown peer %s", peer.Addr())
+		return
+	}
+
+	blockHash := bmsg.blockTxn.BlockHash
+	pb, exists := sm.partialBlocks[blockHash]
+	if !exists || pb.peer != peer {
+		log.Debug("Peer %s sent us block transactions for block we weren't expecting",
+			peer.Addr())
+		return
+	}
+	delete(sm.partialBlocks, blockHash)
+
+	sm.completePartialBlock(peer, state, pb, bmsg.blockTxn.Txs)
+}
+
+// completePartialBlock fills a partial block with the missing transactions
+// and processes it.  A block whose transactions do not match its merkle root
+// is downloaded in full, since a short id may have matched the wrong
+// transaction of the mempool.
+func (sm *SyncManager) completePartialBlock(peer *peer.Peer, state *peerSyncState,
+	pb *partialBlock, txs []*tx.Tx) {
+
+	blockHash := pb.header.GetHash()
+	blk, err := pb.fill(txs)
+	if err != nil {
+		sm.misbehaving(peer.Addr(), 100, "invalid-cmpctblk-txns")
+		return
+	}
+
+	mutated := false
+	if lmerkleroot.BlockMerkleRoot(blk.Txs, &mutated) != blk.Header.MerkleRoot || mutated {
+		log.Debug("Reconstructed block %s from %s does not match its merkle root",
+			blockHash, peer.Addr())
+		sm.requestFullBlock(peer, state, &blockHash)
+		return
+	}
+
+	// The block was either requested or announced in high-bandwidth mode
+	// on top of our tip, process it even if it is not requested anymore.
+	sm.processPeerBlock(peer, state, blk, true)
+}
+
+// requestFullBlock requests a block in full, when it can not be
+// reconstructed from its compact block.
+func (sm *SyncManager) requestFullBlock(peer *peer.Peer, state *peerSyncState, hash *util.Hash) {
+	sm.requestedBlocks[*hash] = peer
+	state.requestedBlocks[*hash] = struct{}{}
+
+	gdmsg := wire.NewMsgGetData()
+	gdmsg.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, hash))
+	peer.QueueMessage(gdmsg, nil)
+}
+
+// maybeSetCmpctAnnouncer asks the peer which sent us a new tip to announce
+// the next blocks with cmpctblock messages.  The peer which provided a new
+// tip least recently is moved back to low-bandwidth mode, so that at most
+// maxCmpctAnnouncers peers are in high-bandwidth mode.
+func (sm *SyncManager) maybeSetCmpctAnnouncer(p *peer.Peer) {
+	if !p.ProvidesCmpctBlocks() {
+		return
+	}
+
+	for i, announcer := range sm.cmpctAnnouncers {
+		if announcer == p {
+			// Move it to the back of the list.
+			copy(sm.cmpctAnnouncers[i:], sm.cmpctAnnouncers[i+1:])
+			sm.cmpctAnnouncers[len(sm.cmpctAnnouncers)-1] = p
+			return
+		}
+	}
+
+	if len(sm.cmpctAnnouncers) >= maxCmpctAnnouncers {
+		sm.cmpctAnnouncers[0].PushSendCmpctMsg(false)
+		sm.cmpctAnnouncers = sm.cmpctAnnouncers[1:]
+	}
+	p.PushSendCmpctMsg(true)
+	sm.cmpctAnnouncers = append(sm.cmpctAnnouncers, p)
+}
+
+// clearCmpctState forgets the compact block announcements and partial blocks
+// of a disconnected peer.
+func (sm *SyncManager) clearCmpctState(p *peer.Peer) {
+	for i, announcer := range sm.cmpctAnnouncers {
+		if announcer == p {
+			sm.cmpctAnnouncers = append(sm.cmpctAnnouncers[:i], sm.cmpctAnnouncers[i+1:]...)
+			break
+		}
+	}
+
+	for hash, pb := range sm.partialBlocks {
+		if pb.peer == p {
+			delete(sm.partialBlocks, hash)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package syncmanager
+
+import (
+	"testing"
+
+	"github.com/copernet/copernicus/logic/lmerkleroot"
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/peer"
+	"github.com/copernet/copernicus/util"
+)
+
+// cmpctTestBlock returns a block made of a coinbase and n transactions.
+func cmpctTestBlock(n int) *block.Block {
+	coinbase := tx.NewTx(0, tx.DefaultVersion)
+	coinbase.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(util.Hash{}, 0xffffffff),
+		script.NewScriptRaw([]byte{0x51, 0x51}), script.SequenceFinal))
+	coinbase.AddTxOut(txout.NewTxOut(5000000000, script.NewEmptyScript()))
+
+	blk := &block.Block{Txs: []*tx.Tx{coinbase}}
+	for i := 0; i < n; i++ {
+		txn := tx.NewTx(uint32(i), tx.DefaultVersion)
+		txn.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(coinbase.GetHash(), 0),
+			script.NewEmptyScript(), script.SequenceFinal))
+		txn.AddTxOut(txout.NewTxOut(1000, script.NewEmptyScript()))
+		blk.Txs = append(blk.Txs, txn)
+	}
+	blk.Header.Version = 1
+	blk.Header.Bits = 0x207fffff
+	blk.Header.MerkleRoot = lmerkleroot.BlockMerkleRoot(blk.Txs, nil)
+	return blk
+}
+
+func TestPartialBlockFromMempool(t *testing.T) {
+	blk := cmpctTestBlock(4)
+	msg := wire.NewMsgCmpctBlock(blk)
+
+	// Every transaction is in the pool, along with an unrelated one.
+	pool := append([]*tx.Tx{cmpctTestBlock(5).Txs[5]}, blk.Txs[1:]...)
+	pb, err := newPartialBlock(msg, pool, nil)
+	if err != nil {
+		t.Fatalf("newPartialBlock: %v", err)
+	}
+	if len(pb.missing) != 0 {
+		t.Fatalf("missing transactions: %v", pb.missing)
+	}
+	filled, err := pb.fill(nil)
+	if err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	if filled.GetHash() != blk.GetHash() {
+		t.Fatalf("reconstructed block hash mismatch")
+	}
+	for i := range blk.Txs {
+		if filled.Txs[i].GetHash() != blk.Txs[i].GetHash() {
+			t.Errorf("transaction #%d mismatch", i)
+		}
+	}
+}
+
+func TestPartialBlockMissingTxs(t *testing.T) {
+	blk := cmpctTestBlock(4)
+	msg := wire.NewMsgCmpctBlock(blk)
+
+	pb, err := newPartialBlock(msg, []*tx.Tx{blk.Txs[2], blk.Txs[3]}, nil)
+	if err != nil {
+		t.Fatalf("newPartialBlock: %v", err)
+	}
+	if len(pb.missing) != 2 || pb.missing[0] != 1 || pb.missing[1] != 4 {
+		t.Fatalf("missing transactions: got %v, want [1 4]", pb.missing)
+	}
+
+	if _, err := pb.fill([]*tx.Tx{blk.Txs[1]}); err != errInvalidCmpctBlock {
+		t.Fatalf("fill with too few transactions: got %v, want %v", err, errInvalidCmpctBlock)
+	}
+
+	filled, err := pb.fill([]*tx.Tx{blk.Txs[1], blk.Txs[4]})
+	if err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	mutated := false
+	if lmerkleroot.BlockMerkleRoot(filled.Txs, &mutated) != blk.Header.MerkleRoot || mutated {
+		t.Fatalf("reconstructed block does not match the merkle root")
+	}
+}
+
+func TestPartialBlockInvalid(t *testing.T) {
+	blk := cmpctTestBlock(2)
+
+	empty := wire.NewMsgCmpctBlock(blk)
+	empty.ShortIDs = nil
+	empty.PrefilledTxs = nil
+	if _, err := newPartialBlock(empty, nil, nil); err != errInvalidCmpctBlock {
+		t.Errorf("empty compact block: got %v, want %v", err, errInvalidCmpctBlock)
+	}
+
+	outOfBounds := wire.NewMsgCmpctBlock(blk)
+	outOfBounds.PrefilledTxs[0].Index = 3
+	if _, err := newPartialBlock(outOfBounds, nil, nil); err != errInvalidCmpctBlock {
+		t.Errorf("prefilled index out of bounds: got %v, want %v", err, errInvalidCmpctBlock)
+	}
+
+	collision := wire.NewMsgCmpctBlock(blk)
+	collision.ShortIDs[1] = collision.ShortIDs[0]
+	if _, err := newPartialBlock(collision, nil, nil); err != errShortIDCollision {
+		t.Errorf("duplicated short ids: got %v, want %v", err, errShortIDCollision)
+	}
+}
+
+func TestMaybeSetCmpctAnnouncer(t *testing.T) {
+	sm := &SyncManager{partialBlocks: make(map[util.Hash]*partialBlock)}
+	peers := make([]*peer.Peer, maxCmpctAnnouncers+1)
+	for i := range peers {
+		peers[i] = peer.NewInboundPeer(&peer.Config{}, false)
+		peers[i].SetCmpctBlocksPreference(false)
+	}
+
+	// Peers which do not provide compact blocks are never selected.
+	legacy := peer.NewInboundPeer(&peer.Config{}, false)
+	sm.maybeSetCmpctAnnouncer(legacy)
+	if len(sm.cmpctAnnouncers) != 0 {
+		t.Fatalf("selected a peer without compact blocks")
+	}
+
+	for _, p := range peers[:maxCmpctAnnouncers] {
+		sm.maybeSetCmpctAnnouncer(p)
+	}
+	// Providing a new tip again moves the first peer to the back, so the
+	// second one is evicted by the next peer.
+	sm.maybeSetCmpctAnnouncer(peers[0])
+	sm.maybeSetCmpctAnnouncer(peers[maxCmpctAnnouncers])
+
+	want := []*peer.Peer{peers[2], peers[0], peers[3]}
+	if len(sm.cmpctAnnouncers) != len(want) {
+		t.Fatalf("announcers: got %d peers, want %d", len(sm.cmpctAnnouncers), len(want))
+	}
+	for i := range want {
+		if sm.cmpctAnnouncers[i] != want[i] {
+			t.Errorf("announcer #%d: got %v, want %v", i, sm.cmpctAnnouncers[i], want[i])
+		}
+	}
+
+	blk := cmpctTestBlock(1)
+	sm.partialBlocks[blk.GetHash()] = &partialBlock{peer: peers[0]}
+	sm.clearCmpctState(peers[0])
+	if len(sm.cmpctAnnouncers) != 2 || len(sm.partialBlocks) != 0 {
+		t.Errorf("state of the disconnected peer not cleared")
+	}
+}
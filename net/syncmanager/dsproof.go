@@ -0,0 +1,72 @@
+package syncmanager
+
+import (
+	"sync/atomic"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/logic/lmempool"
+	"github.com/copernet/copernicus/logic/ltx"
+	"github.com/copernet/copernicus/model/dsproof"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/peer"
+)
+
+// dsProofMsg packages a bitcoin cash dsproof-beta message and the peer it
+// came from together so the handler has access to that information.
+type dsProofMsg struct {
+	proof *dsproof.DSProof
+	peer  *peer.Peer
+	reply chan<- struct{}
+}
+
+// QueueDSProof adds the passed double spend proof and peer to the handling
+// queue. Responds to the done channel argument after the proof is processed.
+func (sm *SyncManager) QueueDSProof(proof *dsproof.DSProof, peer *peer.Peer, done chan<- struct{}) {
+	// Don't accept more proofs if we're shutting down.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		done <- struct{}{}
+		return
+	}
+
+	sm.processBusinessChan <- &dsProofMsg{proof: proof, peer: peer, reply: done}
+}
+
+// handleDSProofMsg handles dsproof-beta messages from all peers.  Valid
+// proofs of a double spend of a mempool transaction are added to the mempool
+// and relayed, the peers sending invalid proofs are penalized.
+func (sm *SyncManager) handleDSProofMsg(dmsg *dsProofMsg) {
+	peer := dmsg.peer
+	if _, exists := sm.peerStates[peer]; !exists {
+		log.Warn("Received dsproof message from unknown peer %s", peer.Addr())
+		return
+	}
+
+	hash := dmsg.proof.GetHash()
+	added, err := lmempool.AcceptDSProof(dmsg.proof)
+	switch err {
+	case nil:
+		if added {
+			log.Debug("Accepted dsproof %s from %s", hash, peer.Addr())
+			sm.peerNotifier.RelayInventory(wire.NewInvVect(wire.InvTypeDSProof, &hash), dmsg.proof)
+		}
+
+	case ltx.ErrDSProofMissingTx, ltx.ErrDSProofMissingCoin, ltx.ErrDSProofUnsupported:
+		// The double spent transaction may be unknown yet or already
+		// mined, the proof can not be checked.
+		log.Debug("Ignoring dsproof %s from %s: %v", hash, peer.Addr(), err)
+
+	default:
+		log.Debug("Invalid dsproof %s from %s: %v", hash, peer.Addr(), err)
+		sm.misbehaving(peer.Addr(), 10, "invalid-dsproof")
+	}
+}
+
+// relayDSProofs relays the double spend proofs of the coins spent by a
+// transaction rejected as a double spend.
+func (sm *SyncManager) relayDSProofs(txn *tx.Tx) {
+	for _, proof := range lmempool.FindDSProofsOfTx(txn) {
+		hash := proof.GetHash()
+		sm.peerNotifier.RelayInventory(wire.NewInvVect(wire.InvTypeDSProof, &hash), proof)
+	}
+}
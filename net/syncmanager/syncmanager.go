@@ -7,6 +7,7 @@ package syncmanager
 import (
 	"container/list"
 	"github.com/copernet/copernicus/logic/lblock"
+	"github.com/copernet/copernicus/logic/lchain"
 	"github.com/copernet/copernicus/model/pow"
 	"github.com/copernet/copernicus/persist"
 	"net"
@@ -276,6 +277,8 @@ type SyncManager struct {
 	requestedBlocks map[util.Hash]*peer.Peer
 	syncPeer        *peer.Peer
 	peerStates      map[*peer.Peer]*peerSyncState
+	partialBlocks   map[util.Hash]*partialBlock
+	cmpctAnnouncers []*peer.Peer
 
 	// callback for transaction And block process
 	ProcessTransactionCallBack func(*tx.Tx, map[util.Hash]struct{}, int64) ([]*tx.Tx, []util.Hash, []util.Hash, error)
@@ -485,6 +488,8 @@ func (sm *SyncManager) clearSyncPeerState(peer *peer.Peer) {
 	for blockHash := range state.requestedBlocks {
 		delete(sm.requestedBlocks, blockHash)
 	}
+
+	sm.clearCmpctState(peer)
 }
 
 // handleDonePeerMsg deals with peers that have signalled they are done.  It
@@ -540,6 +545,9 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	sm.fetchMissingTx(missTxs, peer)
 
 	if err != nil {
+		if errcode.IsErrorCode(err, errcode.RejectConflict) {
+			sm.relayDSProofs(tmsg.tx)
+		}
 		if rejectCode, reason, ok := errcode.IsRejectCode(err); ok {
 			peer.PushRejectMsg(wire.CmdTx, rejectCode, reason, &txHash, false)
 			log.Debug("Reject tx %s from %s: %v", txHash, peer.Addr(), err)
@@ -642,16 +650,27 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	fromWhitelist := peer.IsWhitelisted() && !lblock.IsInitialBlockDownload()
 	_, requested := sm.requestedBlocks[blockHash]
 
+	sm.processPeerBlock(peer, state, bmsg.block, requested || fromWhitelist)
+}
+
+// processPeerBlock processes a block received from a peer, either in full or
+// reconstructed from a compact block, and updates the sync state with it.
+func (sm *SyncManager) processPeerBlock(peer *peer.Peer, state *peerSyncState,
+	blk *block.Block, forceProcessing bool) {
+
+	blockHash := blk.GetHash()
+
 	// Remove block from request maps. Either chain will know about it and
 	// so we shouldn't have any more instances of trying to fetch it, or we
 	// will fail the insert and thus we'll retry next time we get an inv.
 	delete(state.requestedBlocks, blockHash)
 	delete(sm.requestedBlocks, blockHash)
+	delete(sm.partialBlocks, blockHash)
 	peer.SetStallingSince(0)
 
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
-	_, err := sm.ProcessBlockCallBack(bmsg.block, requested || fromWhitelist)
+	_, err := sm.ProcessBlockCallBack(blk, forceProcessing)
 	if err != nil {
 		// When the error is a rule error, it means the block was simply
 		// rejected as opposed to something actually going wrong, so log
@@ -684,7 +703,7 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 
 	// When the block is not an orphan, log information about it and
 	// update the chain state.
-	sm.progressLogger.LogBlockHeight(bmsg.block)
+	sm.progressLogger.LogBlockHeight(blk)
 
 	// Update this peer's latest block height, for future
 	// potential sync node candidacy.
@@ -708,6 +727,12 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
+	// A peer which provided a new tip is likely to be the first to relay
+	// the next one, let it announce new blocks as compact blocks.
+	if sm.current() && *blkHashUpdate == blockHash {
+		sm.maybeSetCmpctAnnouncer(peer)
+	}
+
 	sm.fetchHeaderBlocks(peer)
 }
 
@@ -880,6 +905,7 @@ out:
 			}
 		}
 	}
+	sm.fetchHistoryBlocks(peer, peerState, pindexBestKnownBlock, gdmsg)
 
 	if len(gdmsg.InvList) > 0 {
 		log.Trace("ready to send getdata request, inv Number : %d", len(gdmsg.InvList))
@@ -887,6 +913,39 @@ out:
 	}
 }
 
+// fetchHistoryBlocks adds to gdmsg the blocks below the base block of a UTXO
+// snapshot the background validation needs next, when the best block known
+// of the peer descends from the base block.
+func (sm *SyncManager) fetchHistoryBlocks(peer *peer.Peer, peerState *peerSyncState,
+	pindexBestKnownBlock *blockindex.BlockIndex, gdmsg *wire.MsgGetData) {
+	next, base := lchain.BackgroundValidationRange()
+	if next == nil || pindexBestKnownBlock.GetAncestor(base.Height) != base {
+		return
+	}
+
+	nWindowEnd := util.MinI32(next.Height+BLOCK_DOWNLOAD_WINDOW, base.Height)
+	vToFetch := list.New()
+	for pindex := base.GetAncestor(nWindowEnd); pindex != nil && pindex.Height >= next.Height; pindex = pindex.Prev {
+		vToFetch.PushFront(pindex)
+	}
+	for e := vToFetch.Front(); e != nil; e = e.Next() {
+		if len(peerState.requestedBlocks) >= MAX_BLOCKS_IN_TRANSIT_PER_PEER {
+			return
+		}
+		pindex := e.Value.(*blockindex.BlockIndex)
+		if pindex.HasData() {
+			continue
+		}
+		if _, exists := sm.requestedBlocks[*pindex.GetBlockHash()]; exists {
+			continue
+		}
+		iv := wire.NewInvVect(wire.InvTypeBlock, pindex.GetBlockHash())
+		sm.requestedBlocks[*pindex.GetBlockHash()] = peer
+		peerState.requestedBlocks[*pindex.GetBlockHash()] = struct{}{}
+		gdmsg.AddInvVect(iv)
+	}
+}
+
 func (sm *SyncManager) fetchHeadersToConnect(peer *peer.Peer, state *peerSyncState) {
 	gChain := chain.GetInstance()
 
@@ -1014,6 +1073,14 @@ func (sm *SyncManager) updatePeerState(headers []*block.BlockHeader, peer *peer.
 }
 
 func (sm *SyncManager) fetchBlocks(vToFetch *list.List, state *peerSyncState, peer *peer.Peer) {
+	// A single block on top of our tip is requested as a compact block
+	// from the peers which provide them.
+	invType := wire.InvTypeBlock
+	if vToFetch.Len() == 1 && peer.ProvidesCmpctBlocks() &&
+		vToFetch.Front().Value.(*blockindex.BlockIndex).Prev == chain.GetInstance().Tip() {
+		invType = wire.InvTypeCompatedBlock
+	}
+
 	// Download as much as possible, from earliest to latest.
 	gdmsg := wire.NewMsgGetData()
 	for e := vToFetch.Front(); e != nil; e = e.Next() {
@@ -1022,7 +1089,7 @@ func (sm *SyncManager) fetchBlocks(vToFetch *list.List, state *peerSyncState, pe
 		}
 
 		hash := *(e.Value.(*blockindex.BlockIndex).GetBlockHash())
-		iv := wire.NewInvVect(wire.InvTypeBlock, &hash)
+		iv := wire.NewInvVect(invType, &hash)
 		gdmsg.AddInvVect(iv)
 
 		sm.requestedBlocks[hash] = peer
@@ -1090,6 +1157,9 @@ func (sm *SyncManager) haveInventory(invVect *wire.InvVect) bool {
 		}
 
 		return lmempool.FindOrphanTxInMemPool(invVect.Hash) != nil
+
+	case wire.InvTypeDSProof:
+		return mempool.GetInstance().GetDSProof(invVect.Hash) != nil
 	}
 
 	// The requested inventory is is an unsupported type, so just claim
@@ -1146,6 +1216,7 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 		case wire.InvTypeBlock:
 			invBlkCnt++
 		case wire.InvTypeTx:
+		case wire.InvTypeDSProof:
 		default:
 			continue
 		}
@@ -1164,6 +1235,10 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 			}
 		}
 
+		if iv.Type == wire.InvTypeDSProof && lblock.IsInitialBlockDownload() {
+			continue
+		}
+
 		// Request the inventory if we don't already have it.
 		if haveInv := sm.haveInventory(iv); !haveInv {
 			state.requestQueue = append(state.requestQueue, iv)
@@ -1210,6 +1285,10 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 				gdmsg.AddInvVect(iv)
 				numRequested++
 			}
+
+		case wire.InvTypeDSProof:
+			gdmsg.AddInvVect(iv)
+			numRequested++
 		}
 
 		if numRequested >= wire.MaxInvPerMsg {
@@ -1326,6 +1405,18 @@ out:
 				sm.handleBlockMsg(msg)
 				msg.reply <- struct{}{}
 
+			case *cmpctBlockMsg:
+				sm.handleCmpctBlockMsg(msg)
+				msg.reply <- struct{}{}
+
+			case *blockTxnMsg:
+				sm.handleBlockTxnMsg(msg)
+				msg.reply <- struct{}{}
+
+			case *dsProofMsg:
+				sm.handleDSProofMsg(msg)
+				msg.reply <- struct{}{}
+
 			case *invMsg:
 				sm.handleInvMsg(msg)
 
@@ -1398,6 +1489,10 @@ func (sm *SyncManager) handleBlockchainNotification(notification *chain.Notifica
 			break
 		}
 
+		// Push it to the peers announcing with compact blocks first, the
+		// inventory relay skips the peers which already know it.
+		sm.peerNotifier.RelayCmpctBlock(block)
+
 		// Generate the inventory vector and relay it.
 		iv := wire.NewInvVect(wire.InvTypeBlock, &block.Header.Hash)
 		sm.peerNotifier.RelayInventory(iv, &block.Header)
@@ -1494,6 +1589,32 @@ func (sm *SyncManager) QueueBlock(block *block.Block, buf []byte, peer *peer.Pee
 	sm.processBusinessChan <- &blockMsg{block: block, buf: buf, peer: peer, reply: done}
 }
 
+// QueueCmpctBlock adds the passed cmpctblock message and peer to the block
+// handling queue. Responds to the done channel argument after the compact
+// block message is processed.
+func (sm *SyncManager) QueueCmpctBlock(cmpctBlock *wire.MsgCmpctBlock, peer *peer.Peer, done chan<- struct{}) {
+	// Don't accept more blocks if we're shutting down.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		done <- struct{}{}
+		return
+	}
+
+	sm.processBusinessChan <- &cmpctBlockMsg{cmpctBlock: cmpctBlock, peer: peer, reply: done}
+}
+
+// QueueBlockTxn adds the passed blocktxn message and peer to the block
+// handling queue. Responds to the done channel argument after the message is
+// processed.
+func (sm *SyncManager) QueueBlockTxn(blockTxn *wire.MsgBlockTxn, peer *peer.Peer, done chan<- struct{}) {
+	// Don't accept more blocks if we're shutting down.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		done <- struct{}{}
+		return
+	}
+
+	sm.processBusinessChan <- &blockTxnMsg{blockTxn: blockTxn, peer: peer, reply: done}
+}
+
 func (sm *SyncManager) QueueMessgePool(pool *wire.MsgMemPool, peer *peer.Peer, done chan<- struct{}) {
 	// Don't accept more blocks if we're shutting down.
 	if atomic.LoadInt32(&sm.shutdown) != 0 {
@@ -1623,6 +1744,7 @@ func New(config *Config) (*SyncManager, error) {
 		requestedTxns:       make(map[util.Hash]struct{}),
 		requestedBlocks:     make(map[util.Hash]*peer.Peer),
 		peerStates:          make(map[*peer.Peer]*peerSyncState),
+		partialBlocks:       make(map[util.Hash]*partialBlock),
 		progressLogger:      newBlockProgressLogger("Processed", log.GetLogger()),
 		processBusinessChan: make(chan interface{}, config.MaxPeers*3),
 		quit:                make(chan struct{}),
@@ -1648,6 +1770,8 @@ type PeerNotifier interface {
 
 	RelayInventory(invVect *wire.InvVect, data interface{})
 
+	RelayCmpctBlock(blk *block.Block)
+
 	RelayUpdatedTipBlocks(event *chain.TipUpdatedEvent)
 
 	TransactionConfirmed(tx *tx.Tx)
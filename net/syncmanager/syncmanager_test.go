@@ -53,6 +53,7 @@ func (m *mockPeerNotifier) AnnounceNewTransactions(newTxs []*mempool.TxEntry) {}
 func (m *mockPeerNotifier) UpdatePeerHeights(latestBlkHash *util.Hash, latestHeight int32, updateSource *peer.Peer) {
 }
 func (m *mockPeerNotifier) RelayInventory(invVect *wire.InvVect, data interface{}) {}
+func (m *mockPeerNotifier) RelayCmpctBlock(blk *block.Block)                       {}
 func (m *mockPeerNotifier) RelayUpdatedTipBlocks(event *chain.TipUpdatedEvent)     {}
 func (m *mockPeerNotifier) TransactionConfirmed(tx *tx.Tx)                         {}
 
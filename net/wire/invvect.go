@@ -36,6 +36,8 @@ const (
 	//Extension block
 	MsgExtTx    InvType = InvTypeTx | MsgExtFlag
 	MsgExtBlock InvType = InvTypeBlock | MsgExtFlag
+	//double spend proof
+	InvTypeDSProof InvType = 0x94a0
 )
 
 // Map of service flags back to their constant names for pretty printing.
@@ -47,6 +49,7 @@ var ivStrings = map[InvType]string{
 	InvTypeCompatedBlock: "MSG_COMPATED_BLOCK",
 	MsgExtTx:             "MSG_EXT_TX",
 	MsgExtBlock:          "MSG_EXT_BLOCK",
+	InvTypeDSProof:       "MSG_DOUBLESPENDPROOF",
 }
 
 // String returns the InvType in human-readable form.
@@ -61,6 +61,15 @@ const (
 	CmdCmpctBlock  = "cmpctblock"
 	CmdGetBlockTxn = "getblocktxn"
 	CmdBlockTxn    = "blocktxn"
+
+	CmdGetCFilters  = "getcfilters"
+	CmdCFilter      = "cfilter"
+	CmdGetCFHeaders = "getcfheaders"
+	CmdCFHeaders    = "cfheaders"
+	CmdGetCFCheckpt = "getcfcheckpt"
+	CmdCFCheckpt    = "cfcheckpt"
+
+	CmdDSProof = "dsproof-beta"
 )
 
 // MessageEncoding represents the wire message encoding format to be used.
@@ -160,20 +169,40 @@ func makeEmptyMessage(command string) (Message, error) {
 
 	case CmdFeeFilter:
 		msg = &MsgFeeFilter{}
-		/*
-			case CmdSendCmpct:
-				msg = &MsgSendCmpct{}
 
-			case CmdCmpctBlock:
-				msg = &MsgCmpctBlock{}
+	case CmdSendCmpct:
+		msg = &MsgSendCmpct{}
+
+	case CmdCmpctBlock:
+		msg = &MsgCmpctBlock{}
+
+	case CmdGetBlockTxn:
+		msg = &MsgGetBlockTxn{}
+
+	case CmdBlockTxn:
+		msg = &MsgBlockTxn{}
+
+	case CmdGetCFilters:
+		msg = &MsgGetCFilters{}
+
+	case CmdCFilter:
+		msg = &MsgCFilter{}
+
+	case CmdGetCFHeaders:
+		msg = &MsgGetCFHeaders{}
+
+	case CmdCFHeaders:
+		msg = &MsgCFHeaders{}
+
+	case CmdGetCFCheckpt:
+		msg = &MsgGetCFCheckpt{}
 
-			case CmdGetBlockTxn:
-				msg = &MsgGetBlockTxn{}
+	case CmdCFCheckpt:
+		msg = &MsgCFCheckpt{}
 
-			case CmdBlockTxn:
-				msg = &MsgBlockTxn{}
+	case CmdDSProof:
+		msg = &MsgDSProof{}
 
-		*/
 	default:
 		return nil, fmt.Errorf("unhandled command [%s]", command)
 	}
@@ -1,45 +1,48 @@
 package wire
 
-/*
 import (
 	"fmt"
 	"io"
 
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/util"
 )
 
+// MsgBlockTxn implements the Message interface and represents a bitcoin
+// blocktxn message.  It is the response to a getblocktxn message and carries
+// the requested transactions of a block, in the order they were requested.
+//
+// This message was not added until protocol version ShortIdsBlocksVersion.
 type MsgBlockTxn struct {
 	BlockHash util.Hash
-	Txn       []*MsgTx
-}
-
-func NewMsgBlockTxn(blockHash *util.Hash, indexSize int) *MsgBlockTxn {
-	return &MsgBlockTxn{
-		BlockHash: *blockHash,
-		Txn:       make([]*MsgTx, indexSize),
-	}
+	Txs       []*tx.Tx
 }
 
+// Encode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
 func (msg *MsgBlockTxn) Encode(w io.Writer, pver uint32, enc MessageEncoding) error {
 	if pver < ShortIdsBlocksVersion {
 		str := fmt.Sprintf("blocktxn message invalid for protocol "+
 			"version %d", pver)
 		return messageError("MsgBlockTxn.Encode", str)
 	}
-	if err := util.WriteElements(w, msg.BlockHash); err != nil {
+	if err := util.WriteElements(w, &msg.BlockHash); err != nil {
 		return err
 	}
-	if err := util.WriteVarInt(w, uint64(len(msg.Txn))); err != nil {
+	if err := util.WriteVarInt(w, uint64(len(msg.Txs))); err != nil {
 		return err
 	}
-	for i := 0; i < len(msg.Txn); i++ {
-		if err := msg.Txn[i].Encode(w, pver, enc); err != nil {
+	for _, txn := range msg.Txs {
+		if err := txn.Serialize(w); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// Decode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
 func (msg *MsgBlockTxn) Decode(r io.Reader, pver uint32, enc MessageEncoding) error {
 	if pver < ShortIdsBlocksVersion {
 		str := fmt.Sprintf("blocktxn message invalid for protocol "+
@@ -50,25 +53,44 @@ func (msg *MsgBlockTxn) Decode(r io.Reader, pver uint32, enc MessageEncoding) er
 	if err := util.ReadElements(r, &msg.BlockHash); err != nil {
 		return err
 	}
-	txnSize, err := util.ReadVarInt(r)
+	count, err := util.ReadVarInt(r)
 	if err != nil {
 		return err
 	}
-	txns := make([]MsgTx, int(txnSize))
-	for i := 0; i < len(txns); i++ {
-		if err := txns[i].Decode(r, pver, enc); err != nil {
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgBlockTxn.Decode", str)
+	}
+
+	msg.Txs = make([]*tx.Tx, 0, count)
+	for i := uint64(0); i < count; i++ {
+		txn := new(tx.Tx)
+		if err := txn.Unserialize(r); err != nil {
 			return err
 		}
-		msg.Txn[i] = &txns[i]
+		msg.Txs = append(msg.Txs, txn)
 	}
 	return nil
 }
 
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
 func (msg *MsgBlockTxn) Command() string {
 	return CmdBlockTxn
 }
 
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
 func (msg *MsgBlockTxn) MaxPayloadLength(pver uint32) uint64 {
-	return 32 + 3 + uint64(len(msg.Txn))*MaxBlockPayload
+	return conf.Cfg.Excessiveblocksize
+}
+
+// NewMsgBlockTxn returns a new bitcoin blocktxn message that conforms to the
+// Message interface.  See MsgBlockTxn for details.
+func NewMsgBlockTxn(blockHash *util.Hash, txs []*tx.Tx) *MsgBlockTxn {
+	return &MsgBlockTxn{
+		BlockHash: *blockHash,
+		Txs:       txs,
+	}
 }
-*/
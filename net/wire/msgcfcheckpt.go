@@ -0,0 +1,97 @@
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/copernet/copernicus/util"
+)
+
+// maxCFCheckpts is the maximum number of filter headers of a cfcheckpt
+// message, which fit in MaxMessagePayload.
+const maxCFCheckpts = (MaxMessagePayload - 1 - util.Hash256Size - MaxVarIntPayload) / util.Hash256Size
+
+// MsgCFCheckpt implements the Message interface and represents a bitcoin
+// cfcheckpt message (BIP0157).  It is the response to a getcfcheckpt message
+// and carries the filter headers of every CFCheckptInterval blocks up to the
+// block StopHash.
+type MsgCFCheckpt struct {
+	FilterType    FilterType
+	StopHash      util.Hash
+	FilterHeaders []*util.Hash
+}
+
+// AddCFHeader adds a new filter header to the message.
+func (msg *MsgCFCheckpt) AddCFHeader(header *util.Hash) {
+	msg.FilterHeaders = append(msg.FilterHeaders, header)
+}
+
+// Decode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCFCheckpt) Decode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if err := readFilterType(r, &msg.FilterType); err != nil {
+		return err
+	}
+	if err := util.ReadElements(r, &msg.StopHash); err != nil {
+		return err
+	}
+
+	count, err := util.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+	if count > maxCFCheckpts {
+		str := fmt.Sprintf("too many filter headers for message "+
+			"[count %v, max %v]", count, maxCFCheckpts)
+		return messageError("MsgCFCheckpt.Decode", str)
+	}
+
+	msg.FilterHeaders = make([]*util.Hash, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var header util.Hash
+		if err := util.ReadElements(r, &header); err != nil {
+			return err
+		}
+		msg.FilterHeaders = append(msg.FilterHeaders, &header)
+	}
+	return nil
+}
+
+// Encode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCFCheckpt) Encode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if err := util.WriteElements(w, uint8(msg.FilterType), &msg.StopHash); err != nil {
+		return err
+	}
+	if err := util.WriteVarInt(w, uint64(len(msg.FilterHeaders))); err != nil {
+		return err
+	}
+	for _, header := range msg.FilterHeaders {
+		if err := util.WriteElements(w, header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCFCheckpt) Command() string {
+	return CmdCFCheckpt
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCFCheckpt) MaxPayloadLength(pver uint32) uint64 {
+	return MaxMessagePayload
+}
+
+// NewMsgCFCheckpt returns a new bitcoin cfcheckpt message that conforms to
+// the Message interface.  See MsgCFCheckpt for details.
+func NewMsgCFCheckpt(filterType FilterType, stopHash *util.Hash, headers []*util.Hash) *MsgCFCheckpt {
+	return &MsgCFCheckpt{
+		FilterType:    filterType,
+		StopHash:      *stopHash,
+		FilterHeaders: headers,
+	}
+}
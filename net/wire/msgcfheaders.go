@@ -0,0 +1,109 @@
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/copernet/copernicus/util"
+)
+
+// MsgCFHeaders implements the Message interface and represents a bitcoin
+// cfheaders message (BIP0157).  It is the response to a getcfheaders message:
+// the filter header preceding the range and the hashes of the filters of the
+// range, from which the receiver derives their headers.
+type MsgCFHeaders struct {
+	FilterType       FilterType
+	StopHash         util.Hash
+	PrevFilterHeader util.Hash
+	FilterHashes     []*util.Hash
+}
+
+// AddCFHash adds a new filter hash to the message.
+func (msg *MsgCFHeaders) AddCFHash(hash *util.Hash) error {
+	if len(msg.FilterHashes)+1 > MaxCFHeadersPerMsg {
+		str := fmt.Sprintf("too many filter hashes in message [max %v]",
+			MaxCFHeadersPerMsg)
+		return messageError("MsgCFHeaders.AddCFHash", str)
+	}
+
+	msg.FilterHashes = append(msg.FilterHashes, hash)
+	return nil
+}
+
+// Decode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCFHeaders) Decode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if err := readFilterType(r, &msg.FilterType); err != nil {
+		return err
+	}
+	if err := util.ReadElements(r, &msg.StopHash, &msg.PrevFilterHeader); err != nil {
+		return err
+	}
+
+	count, err := util.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+	if count > MaxCFHeadersPerMsg {
+		str := fmt.Sprintf("too many committed filter headers for "+
+			"message [count %v, max %v]", count, MaxCFHeadersPerMsg)
+		return messageError("MsgCFHeaders.Decode", str)
+	}
+
+	msg.FilterHashes = make([]*util.Hash, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var hash util.Hash
+		if err := util.ReadElements(r, &hash); err != nil {
+			return err
+		}
+		msg.FilterHashes = append(msg.FilterHashes, &hash)
+	}
+	return nil
+}
+
+// Encode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCFHeaders) Encode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	count := len(msg.FilterHashes)
+	if count > MaxCFHeadersPerMsg {
+		str := fmt.Sprintf("too many committed filter headers for "+
+			"message [count %v, max %v]", count, MaxCFHeadersPerMsg)
+		return messageError("MsgCFHeaders.Encode", str)
+	}
+
+	err := util.WriteElements(w, uint8(msg.FilterType), &msg.StopHash, &msg.PrevFilterHeader)
+	if err != nil {
+		return err
+	}
+	if err := util.WriteVarInt(w, uint64(count)); err != nil {
+		return err
+	}
+	for _, hash := range msg.FilterHashes {
+		if err := util.WriteElements(w, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCFHeaders) Command() string {
+	return CmdCFHeaders
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCFHeaders) MaxPayloadLength(pver uint32) uint64 {
+	// Filter type + stop hash + previous header + hash count + the hashes.
+	return 1 + util.Hash256Size*2 + MaxVarIntPayload +
+		MaxCFHeadersPerMsg*util.Hash256Size
+}
+
+// NewMsgCFHeaders returns a new bitcoin cfheaders message that conforms to
+// the Message interface.  See MsgCFHeaders for details.
+func NewMsgCFHeaders() *MsgCFHeaders {
+	return &MsgCFHeaders{
+		FilterHashes: make([]*util.Hash, 0, MaxCFHeadersPerMsg),
+	}
+}
@@ -0,0 +1,71 @@
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/copernet/copernicus/util"
+)
+
+// MaxCFilterDataSize is the maximum byte size of a committed filter.
+const MaxCFilterDataSize = 256 * 1024
+
+// MsgCFilter implements the Message interface and represents a bitcoin
+// cfilter message (BIP0157).  It is the response to a getcfilters message
+// and carries the serialized compact filter of a block.
+type MsgCFilter struct {
+	FilterType FilterType
+	BlockHash  util.Hash
+	Data       []byte
+}
+
+// Decode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCFilter) Decode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if err := readFilterType(r, &msg.FilterType); err != nil {
+		return err
+	}
+	if err := util.ReadElements(r, &msg.BlockHash); err != nil {
+		return err
+	}
+	var err error
+	msg.Data, err = util.ReadVarBytes(r, MaxCFilterDataSize, "cfilter data")
+	return err
+}
+
+// Encode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCFilter) Encode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if len(msg.Data) > MaxCFilterDataSize {
+		str := fmt.Sprintf("cfilter size too large for message "+
+			"[size %v, max %v]", len(msg.Data), MaxCFilterDataSize)
+		return messageError("MsgCFilter.Encode", str)
+	}
+	if err := util.WriteElements(w, uint8(msg.FilterType), &msg.BlockHash); err != nil {
+		return err
+	}
+	return util.WriteVarBytes(w, msg.Data)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCFilter) Command() string {
+	return CmdCFilter
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCFilter) MaxPayloadLength(pver uint32) uint64 {
+	return uint64(util.VarIntSerializeSize(MaxCFilterDataSize)) +
+		MaxCFilterDataSize + util.Hash256Size + 1
+}
+
+// NewMsgCFilter returns a new bitcoin cfilter message that conforms to the
+// Message interface.  See MsgCFilter for details.
+func NewMsgCFilter(filterType FilterType, blockHash *util.Hash, data []byte) *MsgCFilter {
+	return &MsgCFilter{
+		FilterType: filterType,
+		BlockHash:  *blockHash,
+		Data:       data,
+	}
+}
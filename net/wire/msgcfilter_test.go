@@ -0,0 +1,182 @@
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/copernet/copernicus/util"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestGetCFiltersWire tests the MsgGetCFilters and MsgGetCFHeaders wire
+// encode and decode.
+func TestGetCFiltersWire(t *testing.T) {
+	hash := util.HashOne
+	want := append([]byte{
+		0x00,                   // Filter type
+		0xe8, 0x03, 0x00, 0x00, // Start height
+	}, hash[:]...)
+
+	msgs := []struct {
+		msg     Message
+		readmsg Message
+		command string
+	}{
+		{NewMsgGetCFilters(GCSFilterRegular, 1000, &hash), &MsgGetCFilters{}, "getcfilters"},
+		{NewMsgGetCFHeaders(GCSFilterRegular, 1000, &hash), &MsgGetCFHeaders{}, "getcfheaders"},
+	}
+	for _, test := range msgs {
+		if cmd := test.msg.Command(); cmd != test.command {
+			t.Errorf("wrong command - got %v want %v", cmd, test.command)
+		}
+		if maxLen := test.msg.MaxPayloadLength(ProtocolVersion); maxLen != uint64(len(want)) {
+			t.Errorf("%s: wrong max payload length - got %v, want %v", test.command, maxLen, len(want))
+		}
+
+		var buf bytes.Buffer
+		if err := test.msg.Encode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+			t.Fatalf("encode of %s failed: %v", test.command, err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Fatalf("Encode\n got: %s want: %s", spew.Sdump(buf.Bytes()), spew.Sdump(want))
+		}
+		if err := test.readmsg.Decode(bytes.NewReader(want), ProtocolVersion, BaseEncoding); err != nil {
+			t.Fatalf("decode of %s failed: %v", test.command, err)
+		}
+		if !reflect.DeepEqual(test.msg, test.readmsg) {
+			t.Errorf("Decode\n got: %s want: %s", spew.Sdump(test.readmsg), spew.Sdump(test.msg))
+		}
+	}
+}
+
+// TestCFilterWire tests the MsgCFilter wire encode and decode.
+func TestCFilterWire(t *testing.T) {
+	hash := util.HashOne
+	msg := NewMsgCFilter(GCSFilterRegular, &hash, []byte{0x01, 0x7f, 0xa8, 0x80})
+	if cmd := msg.Command(); cmd != "cfilter" {
+		t.Errorf("NewMsgCFilter: wrong command - got %v want cfilter", cmd)
+	}
+
+	want := append(append([]byte{0x00}, hash[:]...), 0x04, 0x01, 0x7f, 0xa8, 0x80)
+	var buf bytes.Buffer
+	if err := msg.Encode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("encode of MsgCFilter failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("Encode\n got: %s want: %s", spew.Sdump(buf.Bytes()), spew.Sdump(want))
+	}
+
+	var readmsg MsgCFilter
+	if err := readmsg.Decode(bytes.NewReader(want), ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("decode of MsgCFilter failed: %v", err)
+	}
+	if !reflect.DeepEqual(*msg, readmsg) {
+		t.Errorf("Decode\n got: %s want: %s", spew.Sdump(readmsg), spew.Sdump(msg))
+	}
+
+	// Filters over the maximum size are rejected.
+	tooBig := NewMsgCFilter(GCSFilterRegular, &hash, make([]byte, MaxCFilterDataSize+1))
+	if err := tooBig.Encode(&buf, ProtocolVersion, BaseEncoding); err == nil {
+		t.Errorf("encode of oversized MsgCFilter passed")
+	}
+}
+
+// TestCFHeadersWire tests the MsgCFHeaders wire encode and decode.
+func TestCFHeadersWire(t *testing.T) {
+	stopHash := util.HashOne
+	prevHeader := util.Hash{0x02}
+	filterHash := util.Hash{0x03}
+	msg := NewMsgCFHeaders()
+	msg.StopHash = stopHash
+	msg.PrevFilterHeader = prevHeader
+	if err := msg.AddCFHash(&filterHash); err != nil {
+		t.Fatalf("AddCFHash: %v", err)
+	}
+	if cmd := msg.Command(); cmd != "cfheaders" {
+		t.Errorf("NewMsgCFHeaders: wrong command - got %v want cfheaders", cmd)
+	}
+
+	want := append([]byte{0x00}, stopHash[:]...)
+	want = append(want, prevHeader[:]...)
+	want = append(want, 0x01)
+	want = append(want, filterHash[:]...)
+	var buf bytes.Buffer
+	if err := msg.Encode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("encode of MsgCFHeaders failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("Encode\n got: %s want: %s", spew.Sdump(buf.Bytes()), spew.Sdump(want))
+	}
+
+	var readmsg MsgCFHeaders
+	if err := readmsg.Decode(bytes.NewReader(want), ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("decode of MsgCFHeaders failed: %v", err)
+	}
+	if readmsg.StopHash != stopHash || readmsg.PrevFilterHeader != prevHeader ||
+		len(readmsg.FilterHashes) != 1 || *readmsg.FilterHashes[0] != filterHash {
+		t.Errorf("Decode\n got: %s want: %s", spew.Sdump(readmsg), spew.Sdump(msg))
+	}
+
+	// No more than MaxCFHeadersPerMsg hashes fit in a message.
+	for i := 1; i < MaxCFHeadersPerMsg; i++ {
+		if err := msg.AddCFHash(&filterHash); err != nil {
+			t.Fatalf("AddCFHash #%d: %v", i, err)
+		}
+	}
+	if err := msg.AddCFHash(&filterHash); err == nil {
+		t.Errorf("AddCFHash passed over MaxCFHeadersPerMsg")
+	}
+	tooMany := append(append([]byte{}, want[:1+2*util.Hash256Size]...), 0xfd, 0xd1, 0x07)
+	if err := readmsg.Decode(bytes.NewReader(tooMany), ProtocolVersion, BaseEncoding); err == nil {
+		t.Errorf("decode of MsgCFHeaders with too many hashes passed")
+	}
+}
+
+// TestCFCheckptWire tests the MsgGetCFCheckpt and MsgCFCheckpt wire encode
+// and decode.
+func TestCFCheckptWire(t *testing.T) {
+	stopHash := util.HashOne
+	getmsg := NewMsgGetCFCheckpt(GCSFilterRegular, &stopHash)
+	if cmd := getmsg.Command(); cmd != "getcfcheckpt" {
+		t.Errorf("NewMsgGetCFCheckpt: wrong command - got %v want getcfcheckpt", cmd)
+	}
+	var buf bytes.Buffer
+	if err := getmsg.Encode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("encode of MsgGetCFCheckpt failed: %v", err)
+	}
+	if want := append([]byte{0x00}, stopHash[:]...); !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("Encode\n got: %s want: %s", spew.Sdump(buf.Bytes()), spew.Sdump(want))
+	}
+	var readget MsgGetCFCheckpt
+	if err := readget.Decode(bytes.NewReader(buf.Bytes()), ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("decode of MsgGetCFCheckpt failed: %v", err)
+	}
+	if !reflect.DeepEqual(*getmsg, readget) {
+		t.Errorf("Decode\n got: %s want: %s", spew.Sdump(readget), spew.Sdump(getmsg))
+	}
+
+	headers := []*util.Hash{{0x02}, {0x03}}
+	msg := NewMsgCFCheckpt(GCSFilterRegular, &stopHash, headers)
+	if cmd := msg.Command(); cmd != "cfcheckpt" {
+		t.Errorf("NewMsgCFCheckpt: wrong command - got %v want cfcheckpt", cmd)
+	}
+	buf.Reset()
+	if err := msg.Encode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("encode of MsgCFCheckpt failed: %v", err)
+	}
+	want := append([]byte{0x00}, stopHash[:]...)
+	want = append(want, 0x02)
+	want = append(want, headers[0][:]...)
+	want = append(want, headers[1][:]...)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("Encode\n got: %s want: %s", spew.Sdump(buf.Bytes()), spew.Sdump(want))
+	}
+	var readmsg MsgCFCheckpt
+	if err := readmsg.Decode(bytes.NewReader(want), ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("decode of MsgCFCheckpt failed: %v", err)
+	}
+	if !reflect.DeepEqual(*msg, readmsg) {
+		t.Errorf("Decode\n got: %s want: %s", spew.Sdump(readmsg), spew.Sdump(msg))
+	}
+}
@@ -1,6 +1,5 @@
 package wire
 
-/*
 import (
 	"bytes"
 	"encoding/binary"
@@ -8,91 +7,60 @@ import (
 	"io"
 	"math"
 
+	"github.com/copernet/copernicus/conf"
 	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/util"
 )
 
-const ShortTxIDsLength = 6
+// ShortTxIDMask keeps the 6 bytes of a SipHash which make a short id.
+const ShortTxIDMask = 0xffffffffffff
 
-type PreFilledTransaction struct {
-	Tx    *MsgTx
-	Index uint16
+// PrefilledTx is a transaction sent in full within a compact block.
+type PrefilledTx struct {
+	// Index is the position of the transaction in the block.  It is
+	// differentially encoded on the wire.
+	Index uint32
+	Tx    *tx.Tx
 }
 
+// MsgCmpctBlock implements the Message interface and represents a bitcoin
+// cmpctblock message (BIP0152).  It carries a block header along with the
+// short ids of its transactions, which the receiver looks up in its mempool.
+// The transactions the receiver is unlikely to have, at least the coinbase,
+// are prefilled.
+//
+// This message was not added until protocol version ShortIdsBlocksVersion.
 type MsgCmpctBlock struct {
-	shortTxidk0  uint64
-	shortTxidk1  uint64
-	Nonce        uint64
-	ShortTxids   []uint64
-	PreFilledTxn []PreFilledTransaction
 	Header       block.BlockHeader
+	Nonce        uint64
+	ShortIDs     []uint64
+	PrefilledTxs []PrefilledTx
 }
 
-func NewMsgCmpctBlock(block *MsgBlock) *MsgCmpctBlock {
-	nonce, _ := util.RandomUint64()
-	shortids := make([]uint64, len(block.Txs)-1)
-	prefilledTxn := make([]PreFilledTransaction, 1)
-	header := block.Header
-
-	id0, id1, err := fillShortTxIDSelector(&header, nonce)
-	if err != nil {
-		return nil
-	}
-	prefilledTxn[0].Index = 0
-	prefilledTxn[0].Tx = (*MsgTx)(block.Txs[0])
-	for i := 1; i < len(block.Txs); i++ {
-		txhash := block.Txs[i].GetHash()
-		shortids[i-1] = getShortID(id0, id1, &txhash)
-	}
-	return &MsgCmpctBlock{
-		shortTxidk0:  id0,
-		shortTxidk1:  id1,
-		Nonce:        nonce,
-		ShortTxids:   shortids,
-		PreFilledTxn: prefilledTxn,
-		Header:       header,
-	}
-}
-
-func fillShortTxIDSelector(h *block.BlockHeader, nonce uint64) (uint64, uint64, error) {
-	bw := bytes.NewBuffer(nil)
-	if err := h.Serialize(bw); err != nil {
-		return 0, 0, err
-	}
-	if err := util.WriteElements(bw, nonce); err != nil {
-		return 0, 0, err
-	}
-	hb := util.Sha256Bytes(bw.Bytes())
-	return binary.LittleEndian.Uint64(hb[0:8]), binary.LittleEndian.Uint64(hb[8:16]), nil
-}
-
-func getShortID(id0, id1 uint64, hash *util.Hash) uint64 {
-	return util.SipHash(id0, id1, (*hash)[:]) & 0xffffffffffff
+// ShortIDKeys returns the SipHash keys the short ids of the block are
+// computed with.  They are derived from the header and the nonce.
+func (msg *MsgCmpctBlock) ShortIDKeys() (uint64, uint64) {
+	buf := bytes.NewBuffer(make([]byte, 0, MaxBlockHeaderPayload+8))
+	msg.Header.Serialize(buf)
+	util.WriteElements(buf, msg.Nonce)
+	hash := util.Sha256Bytes(buf.Bytes())
+	return binary.LittleEndian.Uint64(hash[0:8]), binary.LittleEndian.Uint64(hash[8:16])
 }
 
-func (pft *PreFilledTransaction) Decode(r io.Reader, pver uint32, enc MessageEncoding) error {
-	idx, err := util.ReadVarInt(r)
-	if err != nil {
-		return err
-	}
-	if idx > math.MaxUint16 {
-		return messageError("MsgCmpctBlock.Decode", fmt.Sprintf("index overflowed 16-bits"))
-	}
-	pft.Index = uint16(idx)
-	err = pft.Tx.Decode(r, pver, enc)
-	return err
+// TxCount returns the number of transactions of the block.
+func (msg *MsgCmpctBlock) TxCount() int {
+	return len(msg.ShortIDs) + len(msg.PrefilledTxs)
 }
 
-func (pft *PreFilledTransaction) Encode(w io.Writer, pver uint32, enc MessageEncoding) error {
-	if err := util.WriteVarInt(w, uint64(pft.Index)); err != nil {
-		return err
-	}
-	if err := pft.Tx.Encode(w, pver, enc); err != nil {
-		return err
-	}
-	return nil
+// ShortTxID returns the short id of a transaction with the keys returned by
+// ShortIDKeys.
+func ShortTxID(k0, k1 uint64, txHash *util.Hash) uint64 {
+	return util.SipHash(k0, k1, txHash[:]) & ShortTxIDMask
 }
 
+// Decode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
 func (msg *MsgCmpctBlock) Decode(r io.Reader, pver uint32, enc MessageEncoding) error {
 	if pver < ShortIdsBlocksVersion {
 		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
@@ -105,42 +73,58 @@ func (msg *MsgCmpctBlock) Decode(r io.Reader, pver uint32, enc MessageEncoding)
 	if err := util.ReadElements(r, &msg.Nonce); err != nil {
 		return err
 	}
-	shortIDSize, err := util.ReadVarInt(r)
+
+	count, err := util.ReadVarInt(r)
 	if err != nil {
 		return err
 	}
-	ids := make([]uint64, shortIDSize)
-	for i := 0; i < len(ids); i++ {
-		lsb := uint32(0)
-		msb := uint16(0)
-		if err := util.ReadElements(r, &lsb); err != nil {
-			return err
-		}
-		if err := util.ReadElements(r, &msb); err != nil {
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many short ids for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.Decode", str)
+	}
+	msg.ShortIDs = make([]uint64, count)
+	for i := range msg.ShortIDs {
+		var lsb uint32
+		var msb uint16
+		if err := util.ReadElements(r, &lsb, &msb); err != nil {
 			return err
 		}
-		ids[i] = (uint64(msb) << 32) | uint64(lsb)
+		msg.ShortIDs[i] = uint64(msb)<<32 | uint64(lsb)
 	}
-	msg.ShortTxids = append(msg.ShortTxids, ids...)
-	pftLen, err := util.ReadVarInt(r)
+
+	count, err = util.ReadVarInt(r)
 	if err != nil {
 		return err
 	}
-	vpft := make([]PreFilledTransaction, pftLen)
-	for i := 0; i < len(vpft); i++ {
-		if err := vpft[i].Decode(r, pver, enc); err != nil {
+	if count+uint64(len(msg.ShortIDs)) > maxTxPerBlock {
+		str := fmt.Sprintf("too many prefilled transactions for message "+
+			"[count %v, max %v]", count, maxTxPerBlock-uint64(len(msg.ShortIDs)))
+		return messageError("MsgCmpctBlock.Decode", str)
+	}
+	msg.PrefilledTxs = make([]PrefilledTx, count)
+	offset := uint64(0)
+	for i := range msg.PrefilledTxs {
+		diff, err := util.ReadVarInt(r)
+		if err != nil {
 			return err
 		}
+		index := offset + diff
+		if diff > math.MaxUint32 || index > math.MaxUint32 {
+			return messageError("MsgCmpctBlock.Decode", "prefilled index overflowed 32-bits")
+		}
+		txn := new(tx.Tx)
+		if err := txn.Unserialize(r); err != nil {
+			return err
+		}
+		msg.PrefilledTxs[i] = PrefilledTx{Index: uint32(index), Tx: txn}
+		offset = index + 1
 	}
-	id0, id1, err := fillShortTxIDSelector(&msg.Header, msg.Nonce)
-	if err != nil {
-		return err
-	}
-	msg.shortTxidk0 = id0
-	msg.shortTxidk1 = id1
 	return nil
 }
 
+// Encode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
 func (msg *MsgCmpctBlock) Encode(w io.Writer, pver uint32, enc MessageEncoding) error {
 	if pver < ShortIdsBlocksVersion {
 		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
@@ -150,37 +134,69 @@ func (msg *MsgCmpctBlock) Encode(w io.Writer, pver uint32, enc MessageEncoding)
 	if err := msg.Header.Serialize(w); err != nil {
 		return err
 	}
-	if err := util.WriteElements(w, &msg.Nonce); err != nil {
+	if err := util.WriteElements(w, msg.Nonce); err != nil {
 		return err
 	}
-	if err := util.WriteVarInt(w, uint64(len(msg.ShortTxids))); err != nil {
+
+	if err := util.WriteVarInt(w, uint64(len(msg.ShortIDs))); err != nil {
 		return err
 	}
-	for i := 0; i < len(msg.ShortTxids); i++ {
-		var lsb uint32
-		var msb uint16
-		lsb = uint32(msg.ShortTxids[i] & 0xffffffff)
-		msb = uint16((msg.ShortTxids[i] >> 32) & 0xffff)
-		if err := util.WriteElements(w, lsb); err != nil {
+	for _, id := range msg.ShortIDs {
+		lsb := uint32(id)
+		msb := uint16(id >> 32)
+		if err := util.WriteElements(w, lsb, msb); err != nil {
 			return err
 		}
-		if err := util.WriteElements(w, msb); err != nil {
+	}
+
+	if err := util.WriteVarInt(w, uint64(len(msg.PrefilledTxs))); err != nil {
+		return err
+	}
+	for i, prefilled := range msg.PrefilledTxs {
+		index := prefilled.Index
+		if i > 0 {
+			if index <= msg.PrefilledTxs[i-1].Index {
+				str := fmt.Sprintf("prefilled transactions are not sorted at %d", i)
+				return messageError("MsgCmpctBlock.Encode", str)
+			}
+			index -= msg.PrefilledTxs[i-1].Index + 1
+		}
+		if err := util.WriteVarInt(w, uint64(index)); err != nil {
 			return err
 		}
-	}
-	for i := 0; i < len(msg.PreFilledTxn); i++ {
-		if err := msg.PreFilledTxn[i].Encode(w, pver, enc); err != nil {
+		if err := prefilled.Tx.Serialize(w); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
 func (msg *MsgCmpctBlock) Command() string {
 	return CmdCmpctBlock
 }
 
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
 func (msg *MsgCmpctBlock) MaxPayloadLength(pver uint32) uint64 {
-	return 80 + 8 + 3 + uint64(len(msg.ShortTxids))*6 + 3 + uint64(len(msg.PreFilledTxn))*(3+MaxBlockPayload)
+	return conf.Cfg.Excessiveblocksize
+}
+
+// NewMsgCmpctBlock returns a new bitcoin cmpctblock message for blk with a
+// random nonce.  Only the coinbase transaction is prefilled.
+func NewMsgCmpctBlock(blk *block.Block) *MsgCmpctBlock {
+	nonce, _ := util.RandomUint64()
+	msg := &MsgCmpctBlock{
+		Header:       blk.Header,
+		Nonce:        nonce,
+		ShortIDs:     make([]uint64, 0, len(blk.Txs)-1),
+		PrefilledTxs: []PrefilledTx{{Index: 0, Tx: blk.Txs[0]}},
+	}
+	k0, k1 := msg.ShortIDKeys()
+	for _, txn := range blk.Txs[1:] {
+		txHash := txn.GetHash()
+		msg.ShortIDs = append(msg.ShortIDs, ShortTxID(k0, k1, &txHash))
+	}
+	return msg
 }
-*/
@@ -0,0 +1,169 @@
+package wire
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/util"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// cmpctTestBlock returns block one with n transactions added after its
+// coinbase.
+func cmpctTestBlock(n int) *block.Block {
+	blk := &block.Block{Header: blockOne.Header, Txs: []*tx.Tx{blockOne.Txs[0]}}
+	for i := 0; i < n; i++ {
+		txn := tx.NewTx(uint32(i), tx.DefaultVersion)
+		txn.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(blockOne.Txs[0].GetHash(), 0),
+			script.NewEmptyScript(), script.SequenceFinal))
+		txn.AddTxOut(txout.NewTxOut(1000, script.NewEmptyScript()))
+		blk.Txs = append(blk.Txs, txn)
+	}
+	return blk
+}
+
+// TestCmpctBlockShortIDs tests that NewMsgCmpctBlock prefills the coinbase and
+// identifies the other transactions by their short ids.
+func TestCmpctBlockShortIDs(t *testing.T) {
+	blk := cmpctTestBlock(3)
+	msg := NewMsgCmpctBlock(blk)
+	if cmd := msg.Command(); cmd != "cmpctblock" {
+		t.Errorf("NewMsgCmpctBlock: wrong command - got %v want cmpctblock", cmd)
+	}
+	if msg.TxCount() != len(blk.Txs) {
+		t.Fatalf("TxCount: got %d, want %d", msg.TxCount(), len(blk.Txs))
+	}
+	if len(msg.PrefilledTxs) != 1 || msg.PrefilledTxs[0].Index != 0 || msg.PrefilledTxs[0].Tx != blk.Txs[0] {
+		t.Fatalf("the coinbase is not prefilled: %s", spew.Sdump(msg.PrefilledTxs))
+	}
+
+	k0, k1 := msg.ShortIDKeys()
+	for i, txn := range blk.Txs[1:] {
+		hash := txn.GetHash()
+		id := ShortTxID(k0, k1, &hash)
+		if id != msg.ShortIDs[i] || id > ShortTxIDMask {
+			t.Errorf("short id #%d: got %x, want %x", i, msg.ShortIDs[i], id)
+		}
+	}
+
+	// The keys depend on the nonce.
+	other := *msg
+	other.Nonce++
+	if o0, o1 := other.ShortIDKeys(); o0 == k0 && o1 == k1 {
+		t.Errorf("short id keys do not depend on the nonce")
+	}
+}
+
+// TestCmpctBlockWire tests the MsgCmpctBlock wire encode and decode, the
+// indexes of the prefilled transactions being differentially encoded.
+func TestCmpctBlockWire(t *testing.T) {
+	blk := cmpctTestBlock(4)
+	msg := NewMsgCmpctBlock(blk)
+	msg.ShortIDs = append(msg.ShortIDs[:1], msg.ShortIDs[2:]...)
+	msg.PrefilledTxs = append(msg.PrefilledTxs, PrefilledTx{Index: 2, Tx: blk.Txs[2]})
+
+	var buf bytes.Buffer
+	if err := msg.Encode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("encode of MsgCmpctBlock failed: %v", err)
+	}
+	encoded := buf.Bytes()
+
+	// Header, nonce, 3 short ids of 6 bytes, then the prefilled
+	// transactions at the differential indexes 0 and 1.
+	offset := MaxBlockHeaderPayload + 8
+	if encoded[offset] != 3 {
+		t.Fatalf("wrong short id count %d", encoded[offset])
+	}
+	offset += 1 + 3*6
+	if encoded[offset] != 2 || encoded[offset+1] != 0 {
+		t.Fatalf("wrong prefilled encoding %x", encoded[offset:offset+2])
+	}
+	offset += 2 + int(blk.Txs[0].SerializeSize())
+	if encoded[offset] != 1 {
+		t.Fatalf("wrong differential index %d", encoded[offset])
+	}
+
+	var readmsg MsgCmpctBlock
+	if err := readmsg.Decode(bytes.NewReader(encoded), ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("decode of MsgCmpctBlock failed: %v", err)
+	}
+	if readmsg.Header.GetHash() != blk.Header.GetHash() || readmsg.Nonce != msg.Nonce {
+		t.Errorf("Decode: wrong header or nonce")
+	}
+	for i := range msg.ShortIDs {
+		if readmsg.ShortIDs[i] != msg.ShortIDs[i] {
+			t.Errorf("Decode: short id #%d got %x, want %x", i, readmsg.ShortIDs[i], msg.ShortIDs[i])
+		}
+	}
+	if len(readmsg.PrefilledTxs) != 2 {
+		t.Fatalf("Decode: got %d prefilled transactions", len(readmsg.PrefilledTxs))
+	}
+	for i, prefilled := range readmsg.PrefilledTxs {
+		if prefilled.Index != msg.PrefilledTxs[i].Index ||
+			prefilled.Tx.GetHash() != msg.PrefilledTxs[i].Tx.GetHash() {
+			t.Errorf("Decode: wrong prefilled transaction #%d", i)
+		}
+	}
+
+	// Prefilled transactions must be sorted to be differentially encoded.
+	msg.PrefilledTxs[1].Index = 0
+	if err := msg.Encode(&buf, ProtocolVersion, BaseEncoding); err == nil {
+		t.Errorf("encode of unsorted prefilled transactions passed")
+	}
+
+	// Older protocol versions should fail since the message didn't exist.
+	oldPver := ShortIdsBlocksVersion - 1
+	if err := msg.Encode(&buf, oldPver, BaseEncoding); err == nil {
+		t.Errorf("encode of MsgCmpctBlock passed for old protocol version")
+	}
+	if err := readmsg.Decode(bytes.NewReader(encoded), oldPver, BaseEncoding); err == nil {
+		t.Errorf("decode of MsgCmpctBlock passed for old protocol version")
+	}
+}
+
+// TestBlockTxnWire tests the MsgBlockTxn wire encode and decode.
+func TestBlockTxnWire(t *testing.T) {
+	blk := cmpctTestBlock(2)
+	hash := blk.GetHash()
+	msg := NewMsgBlockTxn(&hash, blk.Txs[1:])
+	if cmd := msg.Command(); cmd != "blocktxn" {
+		t.Errorf("NewMsgBlockTxn: wrong command - got %v want blocktxn", cmd)
+	}
+
+	var buf bytes.Buffer
+	if err := msg.Encode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("encode of MsgBlockTxn failed: %v", err)
+	}
+	encoded := buf.Bytes()
+	if !bytes.Equal(encoded[:util.Hash256Size], hash[:]) || encoded[util.Hash256Size] != 2 {
+		t.Fatalf("wrong encoding %s", spew.Sdump(encoded))
+	}
+
+	var readmsg MsgBlockTxn
+	if err := readmsg.Decode(bytes.NewReader(encoded), ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("decode of MsgBlockTxn failed: %v", err)
+	}
+	if readmsg.BlockHash != hash || len(readmsg.Txs) != 2 {
+		t.Fatalf("Decode: got %s", spew.Sdump(readmsg))
+	}
+	for i, txn := range readmsg.Txs {
+		if txn.GetHash() != blk.Txs[i+1].GetHash() {
+			t.Errorf("Decode: wrong transaction #%d", i)
+		}
+	}
+
+	// Older protocol versions should fail since the message didn't exist.
+	oldPver := ShortIdsBlocksVersion - 1
+	if err := msg.Encode(&buf, oldPver, BaseEncoding); err == nil {
+		t.Errorf("encode of MsgBlockTxn passed for old protocol version")
+	}
+	if err := readmsg.Decode(bytes.NewReader(encoded), oldPver, BaseEncoding); err == nil {
+		t.Errorf("decode of MsgBlockTxn passed for old protocol version")
+	}
+}
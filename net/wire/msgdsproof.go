@@ -0,0 +1,42 @@
+package wire
+
+import (
+	"io"
+
+	"github.com/copernet/copernicus/model/dsproof"
+	"github.com/copernet/copernicus/util"
+)
+
+// maxDSProofPayload is the maximum size of a dsproof-beta message: the coin,
+// then two spenders with a single push data.
+const maxDSProofPayload = util.Hash256Size + 4 +
+	2*(3*4+3*util.Hash256Size+1+MaxVarIntPayload+dsproof.MaxPushDataSize)
+
+// MsgDSProof implements the Message interface and represents a bitcoin cash
+// dsproof-beta message.  It carries the proof that a coin spent by a mempool
+// transaction is double spent, and is announced by InvTypeDSProof inventory.
+type MsgDSProof dsproof.DSProof
+
+// Decode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgDSProof) Decode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	return (*dsproof.DSProof)(msg).Unserialize(r)
+}
+
+// Encode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgDSProof) Encode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	return (*dsproof.DSProof)(msg).Serialize(w)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgDSProof) Command() string {
+	return CmdDSProof
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgDSProof) MaxPayloadLength(pver uint32) uint64 {
+	return maxDSProofPayload
+}
@@ -0,0 +1,66 @@
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/copernet/copernicus/model/dsproof"
+	"github.com/copernet/copernicus/util"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestDSProofWire tests the MsgDSProof wire encode and decode.
+func TestDSProofWire(t *testing.T) {
+	sig := bytes.Repeat([]byte{0x30}, 72)
+	msg := &MsgDSProof{
+		PrevTxID:     util.HashOne,
+		PrevOutIndex: 1,
+		Spender1: dsproof.Spender{
+			TxVersion:   2,
+			OutSequence: 0xffffffff,
+			HashOutputs: util.HashOne,
+			PushData:    [][]byte{sig},
+		},
+		Spender2: dsproof.Spender{
+			TxVersion:       1,
+			OutSequence:     0xfffffffe,
+			LockTime:        100,
+			HashPrevOutputs: util.HashOne,
+			PushData:        [][]byte{sig[:65]},
+		},
+	}
+	if cmd := msg.Command(); cmd != "dsproof-beta" {
+		t.Errorf("MsgDSProof: wrong command - got %v want dsproof-beta", cmd)
+	}
+
+	var buf bytes.Buffer
+	if err := msg.Encode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	wantLen := 36 + 2*(12+96+2) + 72 + 65
+	if buf.Len() != wantLen {
+		t.Fatalf("Encode: got %d bytes, want %d", buf.Len(), wantLen)
+	}
+	if uint64(buf.Len()) > msg.MaxPayloadLength(ProtocolVersion) {
+		t.Errorf("payload of %d bytes is over the max payload length", buf.Len())
+	}
+
+	var readmsg MsgDSProof
+	if err := readmsg.Decode(bytes.NewReader(buf.Bytes()), ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(msg, &readmsg) {
+		t.Errorf("Decode\n got: %s want: %s", spew.Sdump(&readmsg), spew.Sdump(msg))
+	}
+
+	// Proofs with several push data per spender are not supported.
+	msg.Spender2.PushData = append(msg.Spender2.PushData, sig)
+	buf.Reset()
+	if err := msg.Encode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := readmsg.Decode(bytes.NewReader(buf.Bytes()), ProtocolVersion, BaseEncoding); err == nil {
+		t.Errorf("Decode accepted several push data")
+	}
+}
@@ -1,6 +1,5 @@
 package wire
 
-/*
 import (
 	"fmt"
 	"io"
@@ -9,11 +8,21 @@ import (
 	"github.com/copernet/copernicus/util"
 )
 
+// MsgGetBlockTxn implements the Message interface and represents a bitcoin
+// getblocktxn message.  It is used to request the transactions of a compact
+// block which could not be found in the mempool.
+//
+// Indexes are absolute positions in the block, sorted in ascending order.
+// They are differentially encoded on the wire.
+//
+// This message was not added until protocol version ShortIdsBlocksVersion.
 type MsgGetBlockTxn struct {
 	BlockHash util.Hash
-	Indexes   []uint16
+	Indexes   []uint32
 }
 
+// Encode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
 func (msg *MsgGetBlockTxn) Encode(w io.Writer, pver uint32, enc MessageEncoding) error {
 	if pver < ShortIdsBlocksVersion {
 		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
@@ -21,19 +30,19 @@ func (msg *MsgGetBlockTxn) Encode(w io.Writer, pver uint32, enc MessageEncoding)
 		return messageError("MsgGetBlockTxn.Encode", str)
 	}
 
-	if err := util.WriteElements(w, msg.BlockHash); err != nil {
+	if err := util.WriteElements(w, &msg.BlockHash); err != nil {
 		return err
 	}
-	indexSize := uint64(len(msg.Indexes))
-	if err := util.WriteVarInt(w, indexSize); err != nil {
+	if err := util.WriteVarInt(w, uint64(len(msg.Indexes))); err != nil {
 		return err
 	}
-	for i := 0; i < len(msg.Indexes); i++ {
-		var index uint16
-		if i == 0 {
-			index = msg.Indexes[i]
-		} else {
-			index = msg.Indexes[i] - (msg.Indexes[i-1] + 1)
+	for i, index := range msg.Indexes {
+		if i > 0 {
+			if index <= msg.Indexes[i-1] {
+				str := fmt.Sprintf("indexes are not sorted at %d", i)
+				return messageError("MsgGetBlockTxn.Encode", str)
+			}
+			index -= msg.Indexes[i-1] + 1
 		}
 		if err := util.WriteVarInt(w, uint64(index)); err != nil {
 			return err
@@ -42,6 +51,8 @@ func (msg *MsgGetBlockTxn) Encode(w io.Writer, pver uint32, enc MessageEncoding)
 	return nil
 }
 
+// Decode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
 func (msg *MsgGetBlockTxn) Decode(r io.Reader, pver uint32, enc MessageEncoding) error {
 	if pver < ShortIdsBlocksVersion {
 		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
@@ -51,38 +62,53 @@ func (msg *MsgGetBlockTxn) Decode(r io.Reader, pver uint32, enc MessageEncoding)
 	if err := util.ReadElements(r, &msg.BlockHash); err != nil {
 		return err
 	}
-	indexSize, err := util.ReadVarInt(r)
+	count, err := util.ReadVarInt(r)
 	if err != nil {
 		return err
 	}
-	indexes := make([]uint16, indexSize)
-	for i := 0; i < len(indexes); i++ {
-		index, err := util.ReadVarInt(r)
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many indexes for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgGetBlockTxn.Decode", str)
+	}
+
+	indexes := make([]uint32, count)
+	offset := uint64(0)
+	for i := range indexes {
+		diff, err := util.ReadVarInt(r)
 		if err != nil {
 			return err
 		}
-		if index > math.MaxUint16 {
-			return messageError("MsgGetBlockTxn.Decode", fmt.Sprintf("index overflowed 16-bits"))
-		}
-		indexes[i] = uint16(index)
-	}
-	offset := uint16(0)
-	for j := 0; j < len(indexes); j++ {
-		if uint64(indexes[j])+uint64(offset) > math.MaxUint16 {
-			return messageError("MsgGetBlockTxn.Decode", fmt.Sprintf("index overflowed 16-bits"))
+		index := offset + diff
+		if diff > math.MaxUint32 || index > math.MaxUint32 {
+			return messageError("MsgGetBlockTxn.Decode", "index overflowed 32-bits")
 		}
-		indexes[j] += offset
-		offset = indexes[j] + 1
+		indexes[i] = uint32(index)
+		offset = index + 1
 	}
 	msg.Indexes = indexes
 	return nil
 }
 
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
 func (msg *MsgGetBlockTxn) Command() string {
 	return CmdGetBlockTxn
 }
 
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
 func (msg *MsgGetBlockTxn) MaxPayloadLength(pver uint32) uint64 {
-	return 32 + 3 + uint64(len(msg.Indexes))*3
+	// Block hash + index count + an index of up to 5 bytes for each
+	// transaction of the block.
+	return util.Hash256Size + MaxVarIntPayload + maxTxPerBlock*5
+}
+
+// NewMsgGetBlockTxn returns a new bitcoin getblocktxn message that conforms
+// to the Message interface.  See MsgGetBlockTxn for details.
+func NewMsgGetBlockTxn(blockHash *util.Hash, indexes []uint32) *MsgGetBlockTxn {
+	return &MsgGetBlockTxn{
+		BlockHash: *blockHash,
+		Indexes:   indexes,
+	}
 }
-*/
@@ -0,0 +1,66 @@
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/copernet/copernicus/util"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestGetBlockTxnWire tests the MsgGetBlockTxn wire encode and decode, the
+// indexes being differentially encoded.
+func TestGetBlockTxnWire(t *testing.T) {
+	hash := util.HashOne
+	msg := NewMsgGetBlockTxn(&hash, []uint32{0, 1, 5, 70000})
+	if cmd := msg.Command(); cmd != "getblocktxn" {
+		t.Errorf("NewMsgGetBlockTxn: wrong command - got %v want getblocktxn", cmd)
+	}
+
+	want := append(append([]byte{}, hash[:]...),
+		0x04,                         // Index count
+		0x00,                         // 0
+		0x00,                         // 1
+		0x03,                         // 5
+		0xfe, 0x6a, 0x11, 0x01, 0x00, // 70000
+	)
+	var buf bytes.Buffer
+	if err := msg.Encode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("encode of MsgGetBlockTxn failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("Encode\n got: %s want: %s", spew.Sdump(buf.Bytes()), spew.Sdump(want))
+	}
+
+	var readmsg MsgGetBlockTxn
+	if err := readmsg.Decode(bytes.NewReader(want), ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("decode of MsgGetBlockTxn failed: %v", err)
+	}
+	if !reflect.DeepEqual(*msg, readmsg) {
+		t.Errorf("Decode\n got: %s want: %s", spew.Sdump(readmsg), spew.Sdump(msg))
+	}
+
+	// Indexes must be sorted to be differentially encoded.
+	unsorted := NewMsgGetBlockTxn(&hash, []uint32{3, 3})
+	if err := unsorted.Encode(&buf, ProtocolVersion, BaseEncoding); err == nil {
+		t.Errorf("encode of unsorted MsgGetBlockTxn passed")
+	}
+
+	// An index overflowing 32 bits is rejected.
+	overflow := append(append([]byte{}, hash[:]...), 0x02,
+		0xfe, 0xff, 0xff, 0xff, 0xff,
+		0x00)
+	if err := readmsg.Decode(bytes.NewReader(overflow), ProtocolVersion, BaseEncoding); err == nil {
+		t.Errorf("decode of overflowing MsgGetBlockTxn passed")
+	}
+
+	// Older protocol versions should fail since the message didn't exist.
+	oldPver := ShortIdsBlocksVersion - 1
+	if err := msg.Encode(&buf, oldPver, BaseEncoding); err == nil {
+		t.Errorf("encode of MsgGetBlockTxn passed for old protocol version")
+	}
+	if err := readmsg.Decode(bytes.NewReader(want), oldPver, BaseEncoding); err == nil {
+		t.Errorf("decode of MsgGetBlockTxn passed for old protocol version")
+	}
+}
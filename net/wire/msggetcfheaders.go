@@ -0,0 +1,58 @@
+package wire
+
+import (
+	"io"
+
+	"github.com/copernet/copernicus/util"
+)
+
+// MaxCFHeadersPerMsg is the maximum number of filter hashes that may be
+// requested in a getcfheaders message and sent in a cfheaders message.
+const MaxCFHeadersPerMsg = 2000
+
+// MsgGetCFHeaders implements the Message interface and represents a bitcoin
+// getcfheaders message (BIP0157).  It is used to request the filter headers
+// of a range of blocks, from StartHeight up to the block StopHash.
+type MsgGetCFHeaders struct {
+	FilterType  FilterType
+	StartHeight uint32
+	StopHash    util.Hash
+}
+
+// Decode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFHeaders) Decode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if err := readFilterType(r, &msg.FilterType); err != nil {
+		return err
+	}
+	return util.ReadElements(r, &msg.StartHeight, &msg.StopHash)
+}
+
+// Encode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFHeaders) Encode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	return util.WriteElements(w, uint8(msg.FilterType), msg.StartHeight, &msg.StopHash)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetCFHeaders) Command() string {
+	return CmdGetCFHeaders
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetCFHeaders) MaxPayloadLength(pver uint32) uint64 {
+	// Filter type + start height + stop hash.
+	return 1 + 4 + util.Hash256Size
+}
+
+// NewMsgGetCFHeaders returns a new bitcoin getcfheaders message that conforms
+// to the Message interface.  See MsgGetCFHeaders for details.
+func NewMsgGetCFHeaders(filterType FilterType, startHeight uint32, stopHash *util.Hash) *MsgGetCFHeaders {
+	return &MsgGetCFHeaders{
+		FilterType:  filterType,
+		StartHeight: startHeight,
+		StopHash:    *stopHash,
+	}
+}
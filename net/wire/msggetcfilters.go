@@ -0,0 +1,76 @@
+package wire
+
+import (
+	"io"
+
+	"github.com/copernet/copernicus/util"
+)
+
+// MaxGetCFiltersReqRange is the maximum number of filters that may be
+// requested in a getcfilters message.
+const MaxGetCFiltersReqRange = 1000
+
+// FilterType is used to represent a filter type.
+type FilterType uint8
+
+const (
+	// GCSFilterRegular is the basic filter type of BIP0158.
+	GCSFilterRegular FilterType = iota
+)
+
+// readFilterType reads a filter type from r.
+func readFilterType(r io.Reader, filterType *FilterType) error {
+	var value uint8
+	if err := util.ReadElements(r, &value); err != nil {
+		return err
+	}
+	*filterType = FilterType(value)
+	return nil
+}
+
+// MsgGetCFilters implements the Message interface and represents a bitcoin
+// getcfilters message (BIP0157).  It is used to request the compact filters
+// of a range of blocks, from StartHeight up to the block StopHash.
+type MsgGetCFilters struct {
+	FilterType  FilterType
+	StartHeight uint32
+	StopHash    util.Hash
+}
+
+// Decode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFilters) Decode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if err := readFilterType(r, &msg.FilterType); err != nil {
+		return err
+	}
+	return util.ReadElements(r, &msg.StartHeight, &msg.StopHash)
+}
+
+// Encode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFilters) Encode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	return util.WriteElements(w, uint8(msg.FilterType), msg.StartHeight, &msg.StopHash)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetCFilters) Command() string {
+	return CmdGetCFilters
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetCFilters) MaxPayloadLength(pver uint32) uint64 {
+	// Filter type + start height + stop hash.
+	return 1 + 4 + util.Hash256Size
+}
+
+// NewMsgGetCFilters returns a new bitcoin getcfilters message that conforms
+// to the Message interface.  See MsgGetCFilters for details.
+func NewMsgGetCFilters(filterType FilterType, startHeight uint32, stopHash *util.Hash) *MsgGetCFilters {
+	return &MsgGetCFilters{
+		FilterType:  filterType,
+		StartHeight: startHeight,
+		StopHash:    *stopHash,
+	}
+}
@@ -1,6 +1,5 @@
 package wire
 
-/*
 import (
 	"fmt"
 	"io"
@@ -8,20 +7,34 @@ import (
 	"github.com/copernet/copernicus/util"
 )
 
+// CmpctBlockVersion is the version of the compact block encoding this package
+// supports (BIP0152).
+const CmpctBlockVersion uint64 = 1
+
+// MsgSendCmpct implements the Message interface and represents a bitcoin
+// sendcmpct message.  It is used to request the receiving peer to announce
+// new blocks with cmpctblock messages (high-bandwidth mode) or with inv or
+// headers messages (low-bandwidth mode).
+//
+// This message was not added until protocol version ShortIdsBlocksVersion.
 type MsgSendCmpct struct {
 	AnnounceUsingCmpctBlock bool
 	CmpctBlockVersion       uint64
 }
 
+// Decode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
 func (msg *MsgSendCmpct) Decode(r io.Reader, pver uint32, enc MessageEncoding) error {
 	if pver < ShortIdsBlocksVersion {
 		str := fmt.Sprintf("sendcmpct message invalid for protocol "+
 			"version %d", pver)
-		return messageError("MsgSendCmpt.Decode", str)
+		return messageError("MsgSendCmpct.Decode", str)
 	}
 	return util.ReadElements(r, &msg.AnnounceUsingCmpctBlock, &msg.CmpctBlockVersion)
 }
 
+// Encode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
 func (msg *MsgSendCmpct) Encode(w io.Writer, pver uint32, enc MessageEncoding) error {
 	if pver < ShortIdsBlocksVersion {
 		str := fmt.Sprintf("sendcmpct message invalid for protocol "+
@@ -31,18 +44,23 @@ func (msg *MsgSendCmpct) Encode(w io.Writer, pver uint32, enc MessageEncoding) e
 	return util.WriteElements(w, msg.AnnounceUsingCmpctBlock, msg.CmpctBlockVersion)
 }
 
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
 func (msg *MsgSendCmpct) Command() string {
 	return CmdSendCmpct
 }
 
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
 func (msg *MsgSendCmpct) MaxPayloadLength(pver uint32) uint64 {
 	return 9
 }
 
+// NewMsgSendCmpct returns a new bitcoin sendcmpct message that conforms to
+// the Message interface.  See MsgSendCmpct for details.
 func NewMsgSendCmpct(announce bool, version uint64) *MsgSendCmpct {
 	return &MsgSendCmpct{
 		AnnounceUsingCmpctBlock: announce,
 		CmpctBlockVersion:       version,
 	}
 }
-*/
@@ -0,0 +1,46 @@
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestSendCmpctWire tests the MsgSendCmpct wire encode and decode.
+func TestSendCmpctWire(t *testing.T) {
+	msg := NewMsgSendCmpct(true, CmpctBlockVersion)
+	if cmd := msg.Command(); cmd != "sendcmpct" {
+		t.Errorf("NewMsgSendCmpct: wrong command - got %v want sendcmpct", cmd)
+	}
+
+	want := []byte{0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	var buf bytes.Buffer
+	if err := msg.Encode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("encode of MsgSendCmpct failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("Encode\n got: %s want: %s", spew.Sdump(buf.Bytes()), spew.Sdump(want))
+	}
+	if uint64(len(want)) != msg.MaxPayloadLength(ProtocolVersion) {
+		t.Errorf("MaxPayloadLength: got %d, want %d", msg.MaxPayloadLength(ProtocolVersion), len(want))
+	}
+
+	var readmsg MsgSendCmpct
+	if err := readmsg.Decode(bytes.NewReader(want), ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("decode of MsgSendCmpct failed: %v", err)
+	}
+	if !reflect.DeepEqual(*msg, readmsg) {
+		t.Errorf("Decode\n got: %s want: %s", spew.Sdump(readmsg), spew.Sdump(msg))
+	}
+
+	// Older protocol versions should fail since the message didn't exist.
+	oldPver := ShortIdsBlocksVersion - 1
+	if err := msg.Encode(&buf, oldPver, BaseEncoding); err == nil {
+		t.Errorf("encode of MsgSendCmpct passed for old protocol version")
+	}
+	if err := readmsg.Decode(bytes.NewReader(want), oldPver, BaseEncoding); err == nil {
+		t.Errorf("decode of MsgSendCmpct passed for old protocol version")
+	}
+}
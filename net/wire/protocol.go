@@ -12,7 +12,7 @@ import (
 
 const (
 	// ProtocolVersion is the latest protocol version this package supports.
-	ProtocolVersion uint32 = 70013
+	ProtocolVersion uint32 = 70015
 
 	// MultipleAddressVersion is the protocol version which added multiple
 	// addresses per message (pver >= MultipleAddressVersion).
@@ -88,6 +88,14 @@ const (
 	// needed.
 	SFNodeCash
 
+	// SFNodeCompactFilters is a flag used to indicate a peer serves the
+	// compact block filters of BIP0157 and BIP0158.
+	SFNodeCompactFilters ServiceFlag = 1 << 6
+
+	// SFNodeNetworkLimited is a flag used to indicate a peer only serves the
+	// last 288 blocks, as defined in BIP0159.
+	SFNodeNetworkLimited ServiceFlag = 1 << 10
+
 	// Bits 24-31 are reserved for temporary experiments. Just pick a bit that
 	// isn't getting used, or one not being used much, and notify the
 	// bitcoin-development mailing list. Remember that service bits are just
@@ -104,6 +112,9 @@ var sfStrings = map[ServiceFlag]string{
 	SFNodeBloom:   "SFNodeBloom",
 	SFNodeXthin:   "SFNodeXthin",
 	SFNodeCash:    "SFNodeCash",
+
+	SFNodeCompactFilters: "SFNodeCompactFilters",
+	SFNodeNetworkLimited: "SFNodeNetworkLimited",
 }
 
 // orderedSFStrings is an ordered list of service flags from highest to
@@ -114,6 +125,8 @@ var orderedSFStrings = []ServiceFlag{
 	SFNodeBloom,
 	SFNodeXthin,
 	SFNodeCash,
+	SFNodeCompactFilters,
+	SFNodeNetworkLimited,
 }
 
 // String returns the ServiceFlag in human-readable form.
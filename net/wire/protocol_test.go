@@ -18,7 +18,9 @@ func TestServiceFlagStringer(t *testing.T) {
 		{SFNodeBloom, "SFNodeBloom"},
 		{SFNodeXthin, "SFNodeXthin"},
 		{SFNodeCash, "SFNodeCash"},
-		{0xffffffff, "SFNodeNetwork|SFNodeGetUTXO|SFNodeBloom|SFNodeXthin|SFNodeCash|0xffffffe0"},
+		{SFNodeCompactFilters, "SFNodeCompactFilters"},
+		{SFNodeNetworkLimited, "SFNodeNetworkLimited"},
+		{0xffffffff, "SFNodeNetwork|SFNodeGetUTXO|SFNodeBloom|SFNodeXthin|SFNodeCash|SFNodeCompactFilters|SFNodeNetworkLimited|0xfffffba0"},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -31,7 +31,7 @@ import (
 
 const (
 	// MaxProtocolVersion is the max protocol version the peer supports.
-	MaxProtocolVersion = wire.FeeFilterVersion
+	MaxProtocolVersion = wire.InvalidCBNoBanVersion
 
 	// minAcceptableProtocolVersion is the lowest protocol version that a
 	// connected peer may support.
@@ -208,6 +208,37 @@ type MessageListeners struct {
 	// message.
 	OnSendHeaders func(p *Peer, msg *wire.MsgSendHeaders)
 
+	// OnSendCmpct is invoked when a peer receives a sendcmpct bitcoin
+	// message.
+	OnSendCmpct func(p *Peer, msg *wire.MsgSendCmpct)
+
+	// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin
+	// message.
+	OnCmpctBlock func(p *Peer, msg *wire.MsgCmpctBlock, done chan<- struct{})
+
+	// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin
+	// message.
+	OnGetBlockTxn func(p *Peer, msg *wire.MsgGetBlockTxn)
+
+	// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin message.
+	OnBlockTxn func(p *Peer, msg *wire.MsgBlockTxn, done chan<- struct{})
+
+	// OnGetCFilters is invoked when a peer receives a getcfilters bitcoin
+	// message.
+	OnGetCFilters func(p *Peer, msg *wire.MsgGetCFilters)
+
+	// OnGetCFHeaders is invoked when a peer receives a getcfheaders bitcoin
+	// message.
+	OnGetCFHeaders func(p *Peer, msg *wire.MsgGetCFHeaders)
+
+	// OnGetCFCheckpt is invoked when a peer receives a getcfcheckpt bitcoin
+	// message.
+	OnGetCFCheckpt func(p *Peer, msg *wire.MsgGetCFCheckpt)
+
+	// OnDSProof is invoked when a peer receives a dsproof-beta bitcoin cash
+	// message.
+	OnDSProof func(p *Peer, msg *wire.MsgDSProof, done chan<- struct{})
+
 	// OnRead is invoked when a peer receives a bitcoin message.  It
 	// consists of the number of bytes read, the message, and whether or not
 	// an error in the read occurred.  Typically, callers will opt to use
@@ -465,6 +496,8 @@ type Peer struct {
 	protocolVersion      uint32 // negotiated protocol version
 	sendHeadersPreferred bool   // peer sent a sendheaders message
 	revertToInv          bool   //whether to revert to inv mode for a prefer-header-node
+	cmpctBlocksProvided  bool   // peer sent a sendcmpct message of a supported version
+	cmpctBlocksAnnounce  bool   // peer asked for new blocks as cmpctblock messages
 	verAckReceived       bool
 	isWhitelisted        bool
 
@@ -890,6 +923,39 @@ func (p *Peer) SetPreferHeaders() {
 	p.flagsMtx.Unlock()
 }
 
+// ProvidesCmpctBlocks returns whether the peer understands the compact blocks
+// this package supports, which can then be requested from it.
+//
+// This function is safe for concurrent access.
+func (p *Peer) ProvidesCmpctBlocks() bool {
+	p.flagsMtx.Lock()
+	provided := p.cmpctBlocksProvided
+	p.flagsMtx.Unlock()
+
+	return provided
+}
+
+// WantsCmpctBlocks returns whether the peer asked to be announced new blocks
+// with cmpctblock messages instead of inventory vectors or headers.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsCmpctBlocks() bool {
+	p.flagsMtx.Lock()
+	announce := p.cmpctBlocksAnnounce
+	p.flagsMtx.Unlock()
+
+	return announce
+}
+
+// SetCmpctBlocksPreference records the compact block announcement mode the
+// peer asked for in a sendcmpct message of a supported version.
+func (p *Peer) SetCmpctBlocksPreference(announce bool) {
+	p.flagsMtx.Lock()
+	p.cmpctBlocksProvided = true
+	p.cmpctBlocksAnnounce = announce
+	p.flagsMtx.Unlock()
+}
+
 // localVersionMsg creates a version message that can be used to send to the
 // remote peer.
 func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
@@ -1036,6 +1102,16 @@ func (p *Peer) PushSendHeadersMsg() {
 	p.QueueMessage(msg, nil)
 }
 
+// PushSendCmpctMsg sends a sendcmpct msg to tell the peer whether new blocks
+// should be announced to us with cmpctblock messages.  Nothing is sent to
+// peers too old to know compact blocks.
+func (p *Peer) PushSendCmpctMsg(announce bool) {
+	if p.ProtocolVersion() < wire.ShortIdsBlocksVersion {
+		return
+	}
+	p.QueueMessage(wire.NewMsgSendCmpct(announce, wire.CmpctBlockVersion), nil)
+}
+
 // PushRejectMsg sends a reject message for the provided command, reject code,
 // reject reason, and hash.  The hash will only be used when the command is a tx
 // or block and should be nil in other cases.  The wait parameter will cause the
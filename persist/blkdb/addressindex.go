@@ -0,0 +1,209 @@
+package blkdb
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/copernet/copernicus/persist/db"
+	"github.com/copernet/copernicus/util"
+)
+
+const (
+	// scriptHash | height | txid | index | spending
+	addressIndexKeySize = 1 + util.Hash256Size + 4 + util.Hash256Size + 4 + 1
+	// scriptHash | txid | index
+	addressUnspentKeySize = 1 + util.Hash256Size + util.Hash256Size + 4
+)
+
+var errBadAddressIndex = errors.New("bad address index entry")
+
+// AddressIndexKey identifies a change of the balance of a scriptPubKey made by
+// a transaction of the active chain. The scriptPubKey is known by its sha256
+// hash.
+type AddressIndexKey struct {
+	ScriptHash util.Hash
+	Height     int32
+	TxHash     util.Hash
+	// Index is the output created, or the input spending a coin.
+	Index    uint32
+	Spending bool
+}
+
+// AddressIndexEntry is a change of the balance of a scriptPubKey, Amount is
+// negative when a coin is spent.
+type AddressIndexEntry struct {
+	AddressIndexKey
+	Amount int64
+}
+
+// AddressUnspentKey identifies an unspent output paying to a scriptPubKey.
+type AddressUnspentKey struct {
+	ScriptHash util.Hash
+	TxHash     util.Hash
+	Index      uint32
+}
+
+// AddressUnspentEntry is an unspent output paying to a scriptPubKey.
+type AddressUnspentEntry struct {
+	AddressUnspentKey
+	Amount       int64
+	Height       int32
+	ScriptPubKey []byte
+}
+
+func (key *AddressIndexKey) encode() []byte {
+	buf := make([]byte, addressIndexKeySize)
+	buf[0] = db.DbAddressIndex
+	copy(buf[1:], key.ScriptHash[:])
+	// The heights are big endian so that the entries are sorted by height.
+	binary.BigEndian.PutUint32(buf[33:], uint32(key.Height))
+	copy(buf[37:], key.TxHash[:])
+	binary.BigEndian.PutUint32(buf[69:], key.Index)
+	if key.Spending {
+		buf[73] = 1
+	}
+	return buf
+}
+
+func (key *AddressIndexKey) decode(buf []byte) error {
+	if len(buf) != addressIndexKeySize || buf[0] != db.DbAddressIndex {
+		return errBadAddressIndex
+	}
+	copy(key.ScriptHash[:], buf[1:])
+	key.Height = int32(binary.BigEndian.Uint32(buf[33:]))
+	copy(key.TxHash[:], buf[37:])
+	key.Index = binary.BigEndian.Uint32(buf[69:])
+	key.Spending = buf[73] == 1
+	return nil
+}
+
+func (key *AddressUnspentKey) encode() []byte {
+	buf := make([]byte, addressUnspentKeySize)
+	buf[0] = db.DbAddressUnspent
+	copy(buf[1:], key.ScriptHash[:])
+	copy(buf[33:], key.TxHash[:])
+	binary.BigEndian.PutUint32(buf[65:], key.Index)
+	return buf
+}
+
+func (key *AddressUnspentKey) decode(buf []byte) error {
+	if len(buf) != addressUnspentKeySize || buf[0] != db.DbAddressUnspent {
+		return errBadAddressIndex
+	}
+	copy(key.ScriptHash[:], buf[1:])
+	copy(key.TxHash[:], buf[33:])
+	key.Index = binary.BigEndian.Uint32(buf[65:])
+	return nil
+}
+
+func (entry *AddressUnspentEntry) encodeValue() []byte {
+	buf := make([]byte, 12, 12+len(entry.ScriptPubKey))
+	binary.LittleEndian.PutUint64(buf, uint64(entry.Amount))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(entry.Height))
+	return append(buf, entry.ScriptPubKey...)
+}
+
+func (entry *AddressUnspentEntry) decodeValue(buf []byte) error {
+	if len(buf) < 12 {
+		return errBadAddressIndex
+	}
+	entry.Amount = int64(binary.LittleEndian.Uint64(buf))
+	entry.Height = int32(binary.LittleEndian.Uint32(buf[8:]))
+	entry.ScriptPubKey = append([]byte(nil), buf[12:]...)
+	return nil
+}
+
+// WriteAddressIndex records the balance changes of a connected block: the
+// outputs it created are added to the unspent outputs, then the coins it
+// spent are removed.
+func (blockTreeDB *BlockTreeDB) WriteAddressIndex(entries []AddressIndexEntry,
+	created []AddressUnspentEntry, spent []AddressUnspentKey) error {
+	batch := db.NewBatchWrapper(blockTreeDB.dbw)
+	amount := make([]byte, 8)
+	for i := range entries {
+		binary.LittleEndian.PutUint64(amount, uint64(entries[i].Amount))
+		batch.Write(entries[i].encode(), amount)
+	}
+	for i := range created {
+		batch.Write(created[i].encode(), created[i].encodeValue())
+	}
+	for i := range spent {
+		batch.Erase(spent[i].encode())
+	}
+	return blockTreeDB.dbw.WriteBatch(batch, false)
+}
+
+// EraseAddressIndex reverts the balance changes of a disconnected block: the
+// coins it spent are restored, then the outputs it created are removed.
+func (blockTreeDB *BlockTreeDB) EraseAddressIndex(keys []AddressIndexKey,
+	restored []AddressUnspentEntry, created []AddressUnspentKey) error {
+	batch := db.NewBatchWrapper(blockTreeDB.dbw)
+	for i := range keys {
+		batch.Erase(keys[i].encode())
+	}
+	for i := range restored {
+		batch.Write(restored[i].encode(), restored[i].encodeValue())
+	}
+	for i := range created {
+		batch.Erase(created[i].encode())
+	}
+	return blockTreeDB.dbw.WriteBatch(batch, false)
+}
+
+// ReadAddressIndex returns the balance changes of the scriptPubKey hashed to
+// scriptHash between the heights start and end included, sorted by height.
+// An end lower than 0 reads up to the tip.
+func (blockTreeDB *BlockTreeDB) ReadAddressIndex(scriptHash *util.Hash, start, end int32) ([]AddressIndexEntry, error) {
+	prefix := make([]byte, 0, 1+util.Hash256Size)
+	prefix = append(prefix, db.DbAddressIndex)
+	prefix = append(prefix, scriptHash[:]...)
+
+	first := AddressIndexKey{ScriptHash: *scriptHash, Height: start}
+	if start < 0 {
+		first.Height = 0
+	}
+	iter := blockTreeDB.dbw.Prefix(prefix)
+	defer iter.Close()
+
+	var entries []AddressIndexEntry
+	for iter.Seek(first.encode()[:len(prefix)+4]); iter.Valid(); iter.Next() {
+		var entry AddressIndexEntry
+		if err := entry.decode(iter.GetKey()); err != nil {
+			return nil, err
+		}
+		if end >= 0 && entry.Height > end {
+			break
+		}
+		val := iter.GetVal()
+		if len(val) != 8 {
+			return nil, errBadAddressIndex
+		}
+		entry.Amount = int64(binary.LittleEndian.Uint64(val))
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ReadAddressUnspent returns the unspent outputs paying to the scriptPubKey
+// hashed to scriptHash.
+func (blockTreeDB *BlockTreeDB) ReadAddressUnspent(scriptHash *util.Hash) ([]AddressUnspentEntry, error) {
+	prefix := make([]byte, 0, 1+util.Hash256Size)
+	prefix = append(prefix, db.DbAddressUnspent)
+	prefix = append(prefix, scriptHash[:]...)
+
+	iter := blockTreeDB.dbw.Prefix(prefix)
+	defer iter.Close()
+
+	var entries []AddressUnspentEntry
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		var entry AddressUnspentEntry
+		if err := entry.decode(iter.GetKey()); err != nil {
+			return nil, err
+		}
+		if err := entry.decodeValue(iter.GetVal()); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -5,9 +5,9 @@ import (
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/model/blockindex"
 	"github.com/copernet/copernicus/persist/db"
-	"github.com/syndtr/goleveldb/leveldb"
 
 	"encoding/hex"
+	"fmt"
 	"github.com/copernet/copernicus/model"
 	"github.com/copernet/copernicus/model/block"
 	"github.com/copernet/copernicus/model/pow"
@@ -61,7 +61,7 @@ func (blockTreeDB *BlockTreeDB) ReadBlockFileInfo(file int32) (*block.BlockFileI
 		return nil, err
 	}
 	vbytes, err := blockTreeDB.dbw.Read(keyBuf.Bytes())
-	if err == leveldb.ErrNotFound {
+	if err == db.ErrNotFound {
 		return nil, err
 	}
 
@@ -166,13 +166,13 @@ func (blockTreeDB *BlockTreeDB) ReadTxIndex(txid *util.Hash) (*block.DiskTxPos,
 	tmp = append(tmp, db.DbTxIndex)
 	tmp = append(tmp, txid[:]...)
 	vdata, err := blockTreeDB.dbw.Read(tmp)
-	if err != nil {
-		log.Error("Error: ReadTxIndex======%#v", err)
-		panic("Error: ReadTxIndex======")
-	}
-	if vdata == nil {
+	if err == db.ErrNotFound {
 		return nil, nil
 	}
+	if err != nil {
+		log.Error("blkDB: read tx index of %s failed: %v", txid, err)
+		return nil, err
+	}
 	dtp := block.NewDiskTxPos(nil, 0)
 	err = dtp.Unserialize(bytes.NewBuffer(vdata))
 	return dtp, err
@@ -205,6 +205,62 @@ func (blockTreeDB *BlockTreeDB) WriteTxIndex(txIndexes map[util.Hash]block.DiskT
 	return blockTreeDB.dbw.WriteBatch(batch, false)
 }
 
+// EraseTxIndex removes the tx index entries of txids.
+func (blockTreeDB *BlockTreeDB) EraseTxIndex(txids []util.Hash) error {
+	var batch = db.NewBatchWrapper(blockTreeDB.dbw)
+	key := make([]byte, 0, 1+util.Hash256Size)
+	for i := range txids {
+		key = append(key[:0], db.DbTxIndex)
+		key = append(key, txids[i][:]...)
+		batch.Erase(key)
+	}
+	return blockTreeDB.dbw.WriteBatch(batch, false)
+}
+
+// ReadIndexLocator returns the locator of the best block of the optional
+// index name, or nil if the index has not been built yet.
+func (blockTreeDB *BlockTreeDB) ReadIndexLocator(name string) ([]util.Hash, error) {
+	key := append([]byte{db.DbIndexBestBlock}, name...)
+	vdata, err := blockTreeDB.dbw.Read(key)
+	if err == db.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(vdata)
+	count, err := util.ReadVarInt(buf)
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(len(vdata))/util.Hash256Size {
+		return nil, fmt.Errorf("bad locator of index %s", name)
+	}
+	hashes := make([]util.Hash, count)
+	for i := range hashes {
+		if _, err := hashes[i].Unserialize(buf); err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
+
+// WriteIndexLocator records the locator of the best block of the optional
+// index name.
+func (blockTreeDB *BlockTreeDB) WriteIndexLocator(name string, hashes []util.Hash) error {
+	key := append([]byte{db.DbIndexBestBlock}, name...)
+	buf := bytes.NewBuffer(nil)
+	if err := util.WriteVarInt(buf, uint64(len(hashes))); err != nil {
+		return err
+	}
+	for i := range hashes {
+		if _, err := hashes[i].Serialize(buf); err != nil {
+			return err
+		}
+	}
+	return blockTreeDB.dbw.Write(key, buf.Bytes(), false)
+}
+
 func (blockTreeDB *BlockTreeDB) WriteFlag(name string, value bool) error {
 	tmp := make([]byte, 0, 100)
 	tmp = append(tmp, db.DbFlag)
@@ -220,11 +276,10 @@ func (blockTreeDB *BlockTreeDB) ReadFlag(name string) bool {
 	tmp = append(tmp, db.DbFlag)
 	tmp = append(tmp, name...)
 	b, err := blockTreeDB.dbw.Read(tmp)
-
-	if b[0] == '1' && err == nil {
-		return true
+	if err != nil || len(b) == 0 {
+		return false
 	}
-	return false
+	return b[0] == '1'
 }
 
 func (blockTreeDB *BlockTreeDB) LoadBlockIndexGuts(blkIdxMap map[util.Hash]*blockindex.BlockIndex,
@@ -11,6 +11,7 @@ import (
 	"github.com/copernet/copernicus/model"
 	"github.com/copernet/copernicus/model/block"
 	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/model/outpoint"
 	"github.com/copernet/copernicus/persist/db"
 	"github.com/copernet/copernicus/util"
 	"os"
@@ -64,6 +65,145 @@ func TestWRTxIndex(t *testing.T) {
 	if !reflect.DeepEqual(wantVal, txpos) {
 		t.Errorf("the wantVal not equal except value: %v, %v\n", wantVal, txpos)
 	}
+
+	//test Erase TxIndex
+	if err := GetInstance().EraseTxIndex([]util.Hash{*h}); err != nil {
+		t.Errorf("erase tx index failed: %v\n", err)
+	}
+	txpos, err = GetInstance().ReadTxIndex(h)
+	if err != nil || txpos != nil {
+		t.Errorf("the erased tx index should not be found: %v, %v\n", txpos, err)
+	}
+}
+
+func TestWRIndexLocator(t *testing.T) {
+	defer initBlockDB()()
+
+	hashes, err := GetInstance().ReadIndexLocator("txindex")
+	if err != nil || hashes != nil {
+		t.Errorf("the locator of a new index should be nil: %v, %v\n", hashes, err)
+	}
+
+	want := []util.Hash{
+		*util.HashFromString("000000002dd5588a74784eaa7ab0507a18ad16a236e7b1ce69f00d7ddfb5d011"),
+		*util.HashFromString("000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"),
+	}
+	if err := GetInstance().WriteIndexLocator("txindex", want); err != nil {
+		t.Errorf("write index locator failed: %v\n", err)
+	}
+	hashes, err = GetInstance().ReadIndexLocator("txindex")
+	if err != nil {
+		t.Errorf("read index locator failed: %v\n", err)
+	}
+	if !reflect.DeepEqual(want, hashes) {
+		t.Errorf("the locator not equal except value: %v, %v\n", want, hashes)
+	}
+
+	hashes, err = GetInstance().ReadIndexLocator("addressindex")
+	if err != nil || hashes != nil {
+		t.Errorf("the locators of the indexes should be separate: %v, %v\n", hashes, err)
+	}
+}
+
+func TestWRAddressIndex(t *testing.T) {
+	defer initBlockDB()()
+
+	scriptHash := *util.HashFromString("000000002dd5588a74784eaa7ab0507a18ad16a236e7b1ce69f00d7ddfb5d011")
+	otherHash := *util.HashFromString("000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f")
+	funding := *util.HashFromString("00000000839a8e6886ab5951d76f411475428afc90947ee320161bbf18eb6048")
+	spending := *util.HashFromString("000000006a625f06636b8bb6ac7b960a8d03705d1ace08b1a19da3fdcc99ddbd")
+
+	received := AddressIndexEntry{AddressIndexKey: AddressIndexKey{ScriptHash: scriptHash, Height: 300, TxHash: funding, Index: 1}, Amount: 5000}
+	coin := AddressUnspentEntry{AddressUnspentKey: AddressUnspentKey{ScriptHash: scriptHash, TxHash: funding, Index: 1},
+		Amount: 5000, Height: 300, ScriptPubKey: []byte{0x51}}
+	if err := GetInstance().WriteAddressIndex([]AddressIndexEntry{received}, []AddressUnspentEntry{coin}, nil); err != nil {
+		t.Errorf("write address index failed: %v\n", err)
+	}
+	unspent, err := GetInstance().ReadAddressUnspent(&scriptHash)
+	if err != nil || !reflect.DeepEqual([]AddressUnspentEntry{coin}, unspent) {
+		t.Errorf("the unspent outputs not equal except value: %v, %v\n", unspent, err)
+	}
+
+	sent := AddressIndexEntry{AddressIndexKey: AddressIndexKey{ScriptHash: scriptHash, Height: 301, TxHash: spending, Spending: true}, Amount: -5000}
+	if err := GetInstance().WriteAddressIndex([]AddressIndexEntry{sent}, nil, []AddressUnspentKey{coin.AddressUnspentKey}); err != nil {
+		t.Errorf("write address index failed: %v\n", err)
+	}
+	unspent, err = GetInstance().ReadAddressUnspent(&scriptHash)
+	if err != nil || len(unspent) != 0 {
+		t.Errorf("the spent output should be removed: %v, %v\n", unspent, err)
+	}
+
+	// The entries are sorted by height and filtered by the range
+	entries, err := GetInstance().ReadAddressIndex(&scriptHash, 0, -1)
+	if err != nil || !reflect.DeepEqual([]AddressIndexEntry{received, sent}, entries) {
+		t.Errorf("the entries not equal except value: %v, %v\n", entries, err)
+	}
+	entries, err = GetInstance().ReadAddressIndex(&scriptHash, 301, 400)
+	if err != nil || !reflect.DeepEqual([]AddressIndexEntry{sent}, entries) {
+		t.Errorf("the entries not equal except value: %v, %v\n", entries, err)
+	}
+	entries, err = GetInstance().ReadAddressIndex(&scriptHash, 0, 300)
+	if err != nil || !reflect.DeepEqual([]AddressIndexEntry{received}, entries) {
+		t.Errorf("the entries not equal except value: %v, %v\n", entries, err)
+	}
+	entries, err = GetInstance().ReadAddressIndex(&otherHash, 0, -1)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("the entries of another script should be separate: %v, %v\n", entries, err)
+	}
+
+	// Erasing the spend restores the coin
+	if err := GetInstance().EraseAddressIndex([]AddressIndexKey{sent.AddressIndexKey}, []AddressUnspentEntry{coin}, nil); err != nil {
+		t.Errorf("erase address index failed: %v\n", err)
+	}
+	entries, err = GetInstance().ReadAddressIndex(&scriptHash, 0, -1)
+	if err != nil || !reflect.DeepEqual([]AddressIndexEntry{received}, entries) {
+		t.Errorf("the entries not equal except value: %v, %v\n", entries, err)
+	}
+	unspent, err = GetInstance().ReadAddressUnspent(&scriptHash)
+	if err != nil || !reflect.DeepEqual([]AddressUnspentEntry{coin}, unspent) {
+		t.Errorf("the unspent outputs not equal except value: %v, %v\n", unspent, err)
+	}
+}
+
+func TestWRSpentIndex(t *testing.T) {
+	defer initBlockDB()()
+
+	funding := *util.HashFromString("00000000839a8e6886ab5951d76f411475428afc90947ee320161bbf18eb6048")
+	spending := *util.HashFromString("000000006a625f06636b8bb6ac7b960a8d03705d1ace08b1a19da3fdcc99ddbd")
+	forked := *util.HashFromString("000000002dd5588a74784eaa7ab0507a18ad16a236e7b1ce69f00d7ddfb5d011")
+
+	out := outpoint.NewOutPoint(funding, 1)
+	entry := SpentIndexEntry{OutPoint: *out, SpentIndexValue: SpentIndexValue{TxHash: spending, InputIndex: 2, Height: 301}}
+	if err := GetInstance().WriteSpentIndex([]SpentIndexEntry{entry}); err != nil {
+		t.Errorf("write spent index failed: %v\n", err)
+	}
+	value, err := GetInstance().ReadSpentIndex(out)
+	if err != nil || !reflect.DeepEqual(&entry.SpentIndexValue, value) {
+		t.Errorf("the spent index not equal except value: %v, %v\n", value, err)
+	}
+	value, err = GetInstance().ReadSpentIndex(outpoint.NewOutPoint(funding, 0))
+	if err != nil || value != nil {
+		t.Errorf("the unspent outpoint should not be found: %v, %v\n", value, err)
+	}
+
+	// The outpoint spent by another transaction is kept
+	other := entry
+	other.TxHash = forked
+	if err := GetInstance().EraseSpentIndex([]SpentIndexEntry{other}); err != nil {
+		t.Errorf("erase spent index failed: %v\n", err)
+	}
+	value, err = GetInstance().ReadSpentIndex(out)
+	if err != nil || !reflect.DeepEqual(&entry.SpentIndexValue, value) {
+		t.Errorf("the spent index not equal except value: %v, %v\n", value, err)
+	}
+
+	if err := GetInstance().EraseSpentIndex([]SpentIndexEntry{entry}); err != nil {
+		t.Errorf("erase spent index failed: %v\n", err)
+	}
+	value, err = GetInstance().ReadSpentIndex(out)
+	if err != nil || value != nil {
+		t.Errorf("the erased outpoint should not be found: %v, %v\n", value, err)
+	}
 }
 
 func TestWriteFlag(t *testing.T) {
@@ -87,6 +227,11 @@ func TestWriteFlag(t *testing.T) {
 	if !res2 {
 		t.Errorf("the flag should is true: %v\n", res2)
 	}
+
+	//test flag: never written
+	if GetInstance().ReadFlag("missing") {
+		t.Errorf("the missing flag should is false\n")
+	}
 }
 
 func TestWriteReindexing(t *testing.T) {
@@ -0,0 +1,106 @@
+package blkdb
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/persist/db"
+	"github.com/copernet/copernicus/util"
+)
+
+// SpentIndexFlag records whether the spent index was maintained while the
+// blocks of the chain state were connected.
+const SpentIndexFlag = "spentindex"
+
+const (
+	// txid | index
+	spentIndexKeySize = 1 + util.Hash256Size + 4
+	// spending txid | input index | height
+	spentIndexValueSize = util.Hash256Size + 4 + 4
+)
+
+var errBadSpentIndex = errors.New("bad spent index entry")
+
+// SpentIndexValue is the input of the active chain which spent an outpoint.
+type SpentIndexValue struct {
+	TxHash     util.Hash
+	InputIndex uint32
+	Height     int32
+}
+
+// SpentIndexEntry maps an outpoint to the input which spent it.
+type SpentIndexEntry struct {
+	OutPoint outpoint.OutPoint
+	SpentIndexValue
+}
+
+func spentIndexKey(out *outpoint.OutPoint) []byte {
+	buf := make([]byte, spentIndexKeySize)
+	buf[0] = db.DbSpentIndex
+	copy(buf[1:], out.Hash[:])
+	binary.LittleEndian.PutUint32(buf[33:], out.Index)
+	return buf
+}
+
+func (value *SpentIndexValue) encode() []byte {
+	buf := make([]byte, spentIndexValueSize)
+	copy(buf, value.TxHash[:])
+	binary.LittleEndian.PutUint32(buf[32:], value.InputIndex)
+	binary.LittleEndian.PutUint32(buf[36:], uint32(value.Height))
+	return buf
+}
+
+func (value *SpentIndexValue) decode(buf []byte) error {
+	if len(buf) != spentIndexValueSize {
+		return errBadSpentIndex
+	}
+	copy(value.TxHash[:], buf)
+	value.InputIndex = binary.LittleEndian.Uint32(buf[32:])
+	value.Height = int32(binary.LittleEndian.Uint32(buf[36:]))
+	return nil
+}
+
+// WriteSpentIndex records the outpoints spent by a connected block.
+func (blockTreeDB *BlockTreeDB) WriteSpentIndex(entries []SpentIndexEntry) error {
+	batch := db.NewBatchWrapper(blockTreeDB.dbw)
+	for i := range entries {
+		batch.Write(spentIndexKey(&entries[i].OutPoint), entries[i].encode())
+	}
+	return blockTreeDB.dbw.WriteBatch(batch, false)
+}
+
+// EraseSpentIndex forgets the outpoints spent by a disconnected block. An
+// outpoint is kept when it has been spent by another transaction since, which
+// happens when a block is rolled back after a fork was connected.
+func (blockTreeDB *BlockTreeDB) EraseSpentIndex(entries []SpentIndexEntry) error {
+	batch := db.NewBatchWrapper(blockTreeDB.dbw)
+	for i := range entries {
+		value, err := blockTreeDB.ReadSpentIndex(&entries[i].OutPoint)
+		if err != nil {
+			return err
+		}
+		if value == nil || value.TxHash != entries[i].TxHash {
+			continue
+		}
+		batch.Erase(spentIndexKey(&entries[i].OutPoint))
+	}
+	return blockTreeDB.dbw.WriteBatch(batch, false)
+}
+
+// ReadSpentIndex returns the input which spent out, or nil if out is unspent
+// or unknown.
+func (blockTreeDB *BlockTreeDB) ReadSpentIndex(out *outpoint.OutPoint) (*SpentIndexValue, error) {
+	vdata, err := blockTreeDB.dbw.Read(spentIndexKey(out))
+	if err == db.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	value := new(SpentIndexValue)
+	if err := value.decode(vdata); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
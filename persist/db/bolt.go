@@ -0,0 +1,313 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/copernet/copernicus/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+const boltFileName = "kv.bolt"
+
+var boltBucket = []byte("kv")
+
+// boltStore keeps the database in a single B+tree file. Every batch is
+// one bolt transaction, synced when it commits, and iterators hold a read
+// transaction so that they see a snapshot of the database.
+//
+// A write which grows the file past the mapping waits for all the read
+// transactions to end, so a goroutine writing while it iterates would
+// deadlock. Writes first detach the open iterators from their transaction.
+type boltStore struct {
+	db *bolt.DB
+	// iterLock guards iters, the iterators still holding a read transaction.
+	iterLock sync.Mutex
+	iters    map[*boltIterator]struct{}
+}
+
+func openBoltStore(do *DBOption) (Store, error) {
+	db, err := bolt.Open(filepath.Join(do.FilePath, boltFileName), 0640, &bolt.Options{
+		FreelistType:   bolt.FreelistMapType,
+		NoFreelistSync: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db, iters: make(map[*boltIterator]struct{})}, nil
+}
+
+func boltStoreExists(path string) bool {
+	_, err := os.Stat(filepath.Join(path, boltFileName))
+	return err == nil
+}
+
+func destroyBoltStore(path string) error {
+	err := os.Remove(filepath.Join(path, boltFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (bs *boltStore) Get(key []byte) (value []byte, err error) {
+	err = bs.db.View(func(tx *bolt.Tx) error {
+		// Bucket.Get cannot tell an empty value from a missing key.
+		k, v := tx.Bucket(boltBucket).Cursor().Seek(key)
+		if k == nil || !bytes.Equal(k, key) {
+			return ErrNotFound
+		}
+		value = append([]byte(nil), v...)
+		return nil
+	})
+	return value, err
+}
+
+func (bs *boltStore) Has(key []byte) (bool, error) {
+	_, err := bs.Get(key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (bs *boltStore) NewBatch() Batch {
+	return new(opBatch)
+}
+
+// Write always syncs, bolt cannot commit a transaction without it and stay
+// consistent across a crash. The callers already group their changes into
+// batches, so that the syncs are few.
+func (bs *boltStore) Write(batch Batch, sync bool) error {
+	bs.detachIterators()
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		for _, op := range batch.(*opBatch).ops {
+			var err error
+			if op.delete {
+				err = bucket.Delete(op.key)
+			} else {
+				err = bucket.Put(op.key, op.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bs *boltStore) NewIterator(slice *Range) Iterator {
+	tx, err := bs.db.Begin(false)
+	if err != nil {
+		log.Error("DBWrapper: begin bolt read transaction failed: %v", err)
+		return &boltIterator{}
+	}
+	it := &boltIterator{store: bs, tx: tx, cursor: tx.Bucket(boltBucket).Cursor()}
+	if slice != nil {
+		it.start, it.limit = slice.Start, slice.Limit
+	}
+	bs.iterLock.Lock()
+	bs.iters[it] = struct{}{}
+	bs.iterLock.Unlock()
+	return it
+}
+
+// detachIterators copies the ranges of the open iterators out of their read
+// transactions and ends the transactions, so that the next write never waits
+// for them. The iterators are hardly ever open across a write, the copies
+// are only made then.
+func (bs *boltStore) detachIterators() {
+	bs.iterLock.Lock()
+	iters := make([]*boltIterator, 0, len(bs.iters))
+	for it := range bs.iters {
+		iters = append(iters, it)
+	}
+	bs.iterLock.Unlock()
+
+	for _, it := range iters {
+		it.detach()
+	}
+}
+
+func (bs *boltStore) forgetIterator(it *boltIterator) {
+	bs.iterLock.Lock()
+	delete(bs.iters, it)
+	bs.iterLock.Unlock()
+}
+
+// SizeOf adds up the sizes of the keys and values in the range, bolt keeps
+// no statistics to estimate it.
+func (bs *boltStore) SizeOf(begin, end []byte) (size uint64, err error) {
+	err = bs.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+		for k, v := c.Seek(begin); k != nil && (end == nil || bytes.Compare(k, end) < 0); k, v = c.Next() {
+			size += uint64(len(k) + len(v))
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Compact does nothing, bolt reuses the pages freed by the writes.
+func (bs *boltStore) Compact(begin, end []byte) error {
+	return nil
+}
+
+func (bs *boltStore) Close() error {
+	return bs.db.Close()
+}
+
+// boltIterator walks a read transaction with a cursor until it is detached,
+// then walks the copy of its range made from that transaction.
+type boltIterator struct {
+	// mtx guards the iterator against a detach by a writing goroutine.
+	mtx    sync.Mutex
+	store  *boltStore
+	tx     *bolt.Tx
+	cursor *bolt.Cursor
+	start  []byte
+	limit  []byte
+	key    []byte
+	value  []byte
+	seeked bool
+
+	detached bool
+	keys     [][]byte
+	values   [][]byte
+	pos      int
+}
+
+// set copies the entry out of the mmap, a write may remap it as soon as the
+// iterator is detached.
+func (it *boltIterator) set(k, v []byte) bool {
+	if k == nil || (it.limit != nil && bytes.Compare(k, it.limit) >= 0) {
+		it.key, it.value = nil, nil
+		return false
+	}
+	it.key, it.value = append([]byte(nil), k...), append([]byte(nil), v...)
+	return true
+}
+
+func (it *boltIterator) setPos(pos int) bool {
+	it.pos = pos
+	if pos >= len(it.keys) {
+		it.key, it.value = nil, nil
+		return false
+	}
+	it.key, it.value = it.keys[pos], it.values[pos]
+	return true
+}
+
+// detach copies the whole range, the iterator may still seek backwards, and
+// ends the read transaction.
+func (it *boltIterator) detach() {
+	it.mtx.Lock()
+	defer it.mtx.Unlock()
+	if it.tx == nil {
+		return
+	}
+
+	c := it.tx.Bucket(boltBucket).Cursor()
+	for k, v := c.Seek(it.start); k != nil && (it.limit == nil || bytes.Compare(k, it.limit) < 0); k, v = c.Next() {
+		it.keys = append(it.keys, append([]byte(nil), k...))
+		it.values = append(it.values, append([]byte(nil), v...))
+	}
+	pos := len(it.keys)
+	if it.key != nil {
+		pos = it.search(it.key)
+	}
+	it.setPos(pos)
+
+	it.tx.Rollback()
+	it.tx, it.cursor = nil, nil
+	it.detached = true
+	it.store.forgetIterator(it)
+}
+
+func (it *boltIterator) search(key []byte) int {
+	return sort.Search(len(it.keys), func(i int) bool {
+		return bytes.Compare(it.keys[i], key) >= 0
+	})
+}
+
+func (it *boltIterator) Seek(key []byte) bool {
+	it.mtx.Lock()
+	defer it.mtx.Unlock()
+	return it.seek(key)
+}
+
+func (it *boltIterator) seek(key []byte) bool {
+	if it.cursor == nil && !it.detached {
+		return false
+	}
+	it.seeked = true
+	if it.start != nil && bytes.Compare(key, it.start) < 0 {
+		key = it.start
+	}
+	if it.detached {
+		return it.setPos(it.search(key))
+	}
+	return it.set(it.cursor.Seek(key))
+}
+
+// Next moves to the next key, or to the first key of a fresh iterator.
+func (it *boltIterator) Next() bool {
+	it.mtx.Lock()
+	defer it.mtx.Unlock()
+	if it.cursor == nil && !it.detached {
+		return false
+	}
+	if !it.seeked {
+		return it.seek(it.start)
+	}
+	if it.key == nil {
+		return false
+	}
+	if it.detached {
+		return it.setPos(it.pos + 1)
+	}
+	return it.set(it.cursor.Next())
+}
+
+func (it *boltIterator) Valid() bool {
+	it.mtx.Lock()
+	defer it.mtx.Unlock()
+	return it.key != nil
+}
+
+func (it *boltIterator) Key() []byte {
+	it.mtx.Lock()
+	defer it.mtx.Unlock()
+	return it.key
+}
+
+func (it *boltIterator) Value() []byte {
+	it.mtx.Lock()
+	defer it.mtx.Unlock()
+	return it.value
+}
+
+func (it *boltIterator) Release() {
+	it.mtx.Lock()
+	defer it.mtx.Unlock()
+	if it.tx != nil {
+		it.tx.Rollback()
+		it.store.forgetIterator(it)
+	}
+	it.tx, it.cursor = nil, nil
+	it.detached = false
+	it.keys, it.values = nil, nil
+	it.key, it.value = nil, nil
+}
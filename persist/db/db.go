@@ -3,19 +3,10 @@ package db
 import (
 	"crypto/rand"
 	"errors"
-	"os"
 	"path/filepath"
 
 	"encoding/hex"
 	"github.com/copernet/copernicus/log"
-	lvldb "github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/comparer"
-	"github.com/syndtr/goleveldb/leveldb/filter"
-	"github.com/syndtr/goleveldb/leveldb/iterator"
-	"github.com/syndtr/goleveldb/leveldb/memdb"
-	"github.com/syndtr/goleveldb/leveldb/opt"
-	"github.com/syndtr/goleveldb/leveldb/storage"
-	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 const (
@@ -25,10 +16,19 @@ const (
 	DbTxIndex    byte = 't'
 	DbBlockIndex byte = 'b'
 
-	DbBestBlock   byte = 'B'
-	DbFlag        byte = 'F'
-	DbReindexFlag byte = 'R'
-	DbLastBlock   byte = 'l'
+	DbAddressIndex   byte = 'a'
+	DbAddressUnspent byte = 'u'
+	DbSpentIndex     byte = 'p'
+	DbBlockFilter    byte = 'g'
+
+	DbBestBlock      byte = 'B'
+	DbHeadBlocks     byte = 'H'
+	DbUtxoCommitment byte = 'M'
+	DbFlag           byte = 'F'
+	DbReindexFlag    byte = 'R'
+	DbLastBlock      byte = 'l'
+	DbIndexBestBlock byte = 'I'
+	DbSnapshotLoad   byte = 'L'
 
 	DbWalletKey      byte = 'W'
 	DbWalletScript   byte = 'S'
@@ -46,14 +46,9 @@ const (
 	preallocValueSize = 1024
 )
 
+// DBWrapper is a database of the node, stored by one of the Store backends.
 type DBWrapper struct {
-	option       opt.Options
-	readOption   opt.ReadOptions
-	iterOption   opt.ReadOptions
-	writeOption  opt.WriteOptions
-	syncOption   opt.WriteOptions
-	db           *lvldb.DB
-	mdb          *memdb.DB
+	store        Store
 	name         string
 	obfuscateKey []byte
 }
@@ -67,41 +62,6 @@ func genObfuscateKey() []byte {
 	return buf
 }
 
-func getOptions(cacheSize int) opt.Options {
-	var opts opt.Options
-	opts.BlockCacher = opt.LRUCacher
-	opts.BlockCacheCapacity = cacheSize / 2
-	opts.WriteBuffer = cacheSize / 4
-	opts.Filter = filter.NewBloomFilter(10)
-	opts.Compression = opt.NoCompression
-	opts.OpenFilesCacheCapacity = 64
-
-	return opts
-}
-
-func destroyDB(path string) error {
-	st, err := storage.OpenFile(path, false)
-	if err != nil {
-		return err
-	}
-	defer st.Close()
-	fds, err := st.List(storage.TypeAll)
-	if err != nil {
-		return err
-	}
-	for _, fd := range fds {
-		if err := st.Remove(fd); err != nil {
-			return err
-		}
-	}
-	for _, other := range []string{"CURRENT", "LOCK", "LOG", "LOG.old"} {
-		if err := os.Remove(filepath.Join(path, other)); err != nil && !os.IsNotExist(err) {
-			return err
-		}
-	}
-	return nil
-}
-
 type DBOption struct {
 	FilePath       string
 	CacheSize      int
@@ -109,6 +69,9 @@ type DBOption struct {
 	DontObfuscate  bool
 	ForceCompactdb bool
 	UseMemStore    bool
+	// Backend is the key-value engine of the database, BackendLevelDB if
+	// empty.
+	Backend string
 }
 
 func writeObfuscateKey(do *DBOption, dbw *DBWrapper) error {
@@ -133,9 +96,8 @@ func NewDBWrapper(do *DBOption) (*DBWrapper, error) {
 		return nil, errors.New("DBWrapper: nil DBOption")
 	}
 	if do.UseMemStore {
-		mdb := memdb.New(comparer.DefaultComparer, do.CacheSize)
 		dbw := &DBWrapper{
-			mdb: mdb,
+			store: newMemStore(do.CacheSize),
 		}
 		if err := writeObfuscateKey(do, dbw); err != nil {
 			return nil, err
@@ -143,52 +105,18 @@ func NewDBWrapper(do *DBOption) (*DBWrapper, error) {
 		return dbw, nil
 	}
 
-	opts := getOptions(do.CacheSize)
-	if do.Wipe {
-		if err := destroyDB(do.FilePath); err != nil {
-			return nil, err
-		}
-	}
-
-	err := os.MkdirAll(do.FilePath, 0740)
-	if err != nil && !os.IsExist(err) {
-		return nil, err
-	}
-
-	db, err := lvldb.OpenFile(do.FilePath, &opts)
+	store, err := openStore(do)
 	if err != nil {
 		return nil, err
 	}
-	if do.ForceCompactdb {
-		if err := db.CompactRange(util.Range{}); err != nil {
-			return nil, err
-		}
-	}
-
-	ro := opt.ReadOptions{
-		DontFillCache: false,
-		Strict:        opt.StrictJournalChecksum | opt.StrictBlockChecksum,
-	}
-	io := opt.ReadOptions{
-		DontFillCache: true,
-		Strict:        opt.StrictJournalChecksum | opt.StrictBlockChecksum,
-	}
-	wo := opt.WriteOptions{}
-	so := opt.WriteOptions{
-		Sync: true,
-	}
 
 	dbw := &DBWrapper{
-		option:      opts,
-		readOption:  ro,
-		iterOption:  io,
-		writeOption: wo,
-		syncOption:  so,
-		db:          db,
-		name:        filepath.Base(do.FilePath),
+		store: store,
+		name:  filepath.Base(do.FilePath),
 		//obfuscateKey: make([]byte, 8),
 	}
 	if err := writeObfuscateKey(do, dbw); err != nil {
+		store.Close()
 		return nil, err
 	}
 	return dbw, nil
@@ -208,17 +136,7 @@ func xor(val, obkey []byte) {
 }
 
 func (dbw *DBWrapper) Read(key []byte) ([]byte, error) {
-	var (
-		value []byte
-		err   error
-	)
-	if dbw.mdb != nil {
-		origVal, origErr := dbw.mdb.Get(key)
-		value = append(value, origVal...)
-		err = origErr
-	} else {
-		value, err = dbw.db.Get(key, &dbw.readOption)
-	}
+	value, err := dbw.store.Get(key)
 	if err != nil {
 		log.Debug("Read DB key: %s err: %v", hex.EncodeToString(key), err)
 		return nil, err
@@ -228,99 +146,59 @@ func (dbw *DBWrapper) Read(key []byte) ([]byte, error) {
 }
 
 func (dbw *DBWrapper) Write(key, val []byte, sync bool) error {
-	if dbw.mdb != nil {
-		tmpval := []byte{}
-		tmpval = append(tmpval, val...)
-		xor(tmpval, dbw.obfuscateKey)
-		return dbw.mdb.Put(key, tmpval)
-	}
 	bw := NewBatchWrapper(dbw)
 	bw.Write(key, val)
 	return dbw.WriteBatch(bw, sync)
 }
 
 func (dbw *DBWrapper) WriteBatch(bw *BatchWrapper, sync bool) error {
-	if dbw.mdb != nil {
-		return nil
-	}
-	var opts opt.WriteOptions
-	if sync {
-		opts = dbw.syncOption
-	} else {
-		opts = dbw.writeOption
-	}
-	return dbw.db.Write(&bw.bat, &opts)
+	return dbw.store.Write(bw.bat, sync)
 }
 
 func (dbw *DBWrapper) Exists(key []byte) bool {
-	if dbw.mdb != nil {
-		return dbw.mdb.Contains(key)
-	}
-	_, err := dbw.db.Get(key, &dbw.readOption)
+	exists, err := dbw.store.Has(key)
 	if err != nil {
-		if err == lvldb.ErrNotFound {
-			return false
-		}
 		panic("DBWrapper :" + err.Error())
-
 	}
-	return true
+	return exists
 }
 
 func (dbw *DBWrapper) Erase(key []byte, sync bool) error {
-	if dbw.mdb != nil {
-		return dbw.mdb.Delete(key)
-	}
 	bw := NewBatchWrapper(dbw)
 	bw.Erase(key)
 	return dbw.WriteBatch(bw, sync)
 }
 
 func (dbw *DBWrapper) Sync() error {
-	if dbw.mdb != nil {
-		return nil
-	}
 	bw := NewBatchWrapper(dbw)
 	return dbw.WriteBatch(bw, true)
 }
 
-func (dbw *DBWrapper) Iterator(slice *util.Range) *IterWrapper {
-	if dbw.mdb != nil {
-		return NewIterWrapper(dbw, dbw.mdb.NewIterator(slice))
-	}
-	return NewIterWrapper(dbw, dbw.db.NewIterator(slice, &dbw.iterOption))
+func (dbw *DBWrapper) Iterator(slice *Range) *IterWrapper {
+	return NewIterWrapper(dbw, dbw.store.NewIterator(slice))
 }
 
 func (dbw *DBWrapper) Prefix(prefix []byte) *IterWrapper {
-	return dbw.Iterator(util.BytesPrefix(prefix))
+	return dbw.Iterator(BytesPrefix(prefix))
 }
 
 func (dbw *DBWrapper) IsEmpty() bool {
-	if dbw.mdb != nil {
-		return dbw.mdb.Len() == 0
-	}
 	it := dbw.Iterator(nil)
+	defer it.Close()
 	it.SeekToFirst()
 	return !it.Valid()
 }
 
 func (dbw *DBWrapper) EstimateSize(begin, end []byte) uint64 {
-	if dbw.mdb != nil {
-		return uint64(dbw.mdb.Size())
-	}
-	r := []util.Range{{Start: begin, Limit: end}}
-	sizes, err := dbw.db.SizeOf(r)
+	size, err := dbw.store.SizeOf(begin, end)
 	if err != nil {
 		return 0
 	}
-	return uint64(sizes.Sum())
+	return size
 }
 
 func (dbw *DBWrapper) CompactRange(begin, end []byte) error {
-	if dbw.mdb != nil {
-		return nil
-	}
-	return dbw.db.CompactRange(util.Range{Start: begin, Limit: end})
+	return dbw.store.Compact(begin, end)
 }
 
 func (dbw *DBWrapper) GetObfuscateKey() []byte {
@@ -328,22 +206,20 @@ func (dbw *DBWrapper) GetObfuscateKey() []byte {
 }
 
 func (dbw *DBWrapper) Close() {
-	if dbw.mdb != nil {
-		return
-	}
-	if dbw.db != nil {
-		dbw.db.Close()
+	if dbw.store != nil {
+		dbw.store.Close()
 	}
 }
 
+// Reset clears an in-memory database.
 func (dbw *DBWrapper) Reset() {
-	if dbw.mdb != nil {
-		dbw.mdb.Reset()
+	if ms, ok := dbw.store.(*memStore); ok {
+		ms.db.Reset()
 	}
 }
 
 type BatchWrapper struct {
-	bat     lvldb.Batch
+	bat     Batch
 	parent  *DBWrapper
 	bkey    []byte
 	bval    []byte
@@ -352,6 +228,7 @@ type BatchWrapper struct {
 
 func NewBatchWrapper(parent *DBWrapper) *BatchWrapper {
 	return &BatchWrapper{
+		bat:    parent.store.NewBatch(),
 		parent: parent,
 		bkey:   make([]byte, 0, preallocKeySize),
 		bval:   make([]byte, 0, preallocValueSize),
@@ -370,7 +247,7 @@ func (bw *BatchWrapper) Write(key, val []byte) {
 	//log.Printf("bw.parent.GetObfuscateKey():%s\n", bw.parent.GetObfuscateKey())
 	xor(bw.bval, bw.parent.GetObfuscateKey())
 	bw.bat.Put(bw.bkey, bw.bval)
-	// LevelDB serializes writes as:
+	// The estimate follows how LevelDB serializes writes:
 	// - byte: header
 	// - varint: key length (1 byte up to 127B, 2 bytes up to 16383B, ...)
 	// - byte[]: key
@@ -407,10 +284,10 @@ func (bw *BatchWrapper) Erase(key []byte) {
 
 type IterWrapper struct {
 	parent *DBWrapper
-	iter   iterator.Iterator
+	iter   Iterator
 }
 
-func NewIterWrapper(parent *DBWrapper, iter iterator.Iterator) *IterWrapper {
+func NewIterWrapper(parent *DBWrapper, iter Iterator) *IterWrapper {
 	return &IterWrapper{
 		parent: parent,
 		iter:   iter,
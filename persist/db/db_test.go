@@ -25,6 +25,17 @@ func rand256() []byte {
 	return b
 }
 
+var testBackends = []string{BackendLevelDB, BackendBolt}
+
+// forEachBackend runs the test against a database of each backend.
+func forEachBackend(t *testing.T, f func(t *testing.T, backend string)) {
+	for _, backend := range testBackends {
+		t.Run(backend, func(t *testing.T) {
+			f(t, backend)
+		})
+	}
+}
+
 func testdbw(t *testing.T, dbw *DBWrapper, obfuscate bool) {
 	key := []byte{'k'}
 	in := rand256()
@@ -58,24 +69,27 @@ func testdbw(t *testing.T, dbw *DBWrapper, obfuscate bool) {
 }
 
 func TestDBWrapper(t *testing.T) {
-	for _, obfuscate := range []bool{false, true} {
-		path, err := ioutil.TempDir("", "dbwtest")
-		if err != nil {
-			t.Fatalf("generate temp db path failed: %s\n", err)
-		}
-		defer os.RemoveAll(path)
-
-		dbw, err := NewDBWrapper(&DBOption{
-			FilePath:      path,
-			CacheSize:     1 << 20,
-			DontObfuscate: !obfuscate,
-		})
-		if err != nil {
-			t.Fatalf("NewDBWrapper failed: %s\n", err)
+	forEachBackend(t, func(t *testing.T, backend string) {
+		for _, obfuscate := range []bool{false, true} {
+			path, err := ioutil.TempDir("", "dbwtest")
+			if err != nil {
+				t.Fatalf("generate temp db path failed: %s\n", err)
+			}
+			defer os.RemoveAll(path)
+
+			dbw, err := NewDBWrapper(&DBOption{
+				FilePath:      path,
+				Backend:       backend,
+				CacheSize:     1 << 20,
+				DontObfuscate: !obfuscate,
+			})
+			if err != nil {
+				t.Fatalf("NewDBWrapper failed: %s\n", err)
+			}
+			defer dbw.Close()
+			testdbw(t, dbw, obfuscate)
 		}
-		defer dbw.Close()
-		testdbw(t, dbw, obfuscate)
-	}
+	})
 }
 
 func TestDBWrapperWithMem(t *testing.T) {
@@ -95,66 +109,69 @@ func TestDBWrapperWithMem(t *testing.T) {
 }
 
 func TestDBWrapperBatch(t *testing.T) {
-	for _, obfuscate := range []bool{false, true} {
-		path, err := ioutil.TempDir("", "dbwtest")
-		if err != nil {
-			t.Fatalf("generate temp db path failed: %s\n", err)
-		}
-		defer os.RemoveAll(path)
-
-		dbw, err := NewDBWrapper(&DBOption{
-			FilePath:      path,
-			CacheSize:     1 << 20,
-			DontObfuscate: !obfuscate,
-		})
-		if err != nil {
-			t.Fatalf("NewDBWrapper failed: %s\n", err)
-		}
-		defer dbw.Close()
-
-		key := []byte{'i'}
-		key2 := []byte{'j'}
-		key3 := []byte{'k'}
-		in := rand256()
-		in2 := rand256()
-		in3 := rand256()
-
-		batch := NewBatchWrapper(dbw)
-		batch.Write(key, in)
-		batch.Write(key2, in2)
-		batch.Write(key3, in3)
-
-		if batch.SizeEstimate() != 783 {
-			t.Fatalf("SizeEstimate failed: %d\n", batch.SizeEstimate())
-		}
+	forEachBackend(t, func(t *testing.T, backend string) {
+		for _, obfuscate := range []bool{false, true} {
+			path, err := ioutil.TempDir("", "dbwtest")
+			if err != nil {
+				t.Fatalf("generate temp db path failed: %s\n", err)
+			}
+			defer os.RemoveAll(path)
+
+			dbw, err := NewDBWrapper(&DBOption{
+				FilePath:      path,
+				Backend:       backend,
+				CacheSize:     1 << 20,
+				DontObfuscate: !obfuscate,
+			})
+			if err != nil {
+				t.Fatalf("NewDBWrapper failed: %s\n", err)
+			}
+			defer dbw.Close()
+
+			key := []byte{'i'}
+			key2 := []byte{'j'}
+			key3 := []byte{'k'}
+			in := rand256()
+			in2 := rand256()
+			in3 := rand256()
+
+			batch := NewBatchWrapper(dbw)
+			batch.Write(key, in)
+			batch.Write(key2, in2)
+			batch.Write(key3, in3)
+
+			if batch.SizeEstimate() != 783 {
+				t.Fatalf("SizeEstimate failed: %d\n", batch.SizeEstimate())
+			}
 
-		batch.Erase(key3)
-		dbw.WriteBatch(batch, false)
+			batch.Erase(key3)
+			dbw.WriteBatch(batch, false)
 
-		res, err := dbw.Read(key)
-		if err != nil {
-			t.Fatalf("dbw.Read(): %s", err)
-		}
-		if !bytes.Equal(res, in) {
-			t.Fatalf("should read back key 'i' value")
-		}
+			res, err := dbw.Read(key)
+			if err != nil {
+				t.Fatalf("dbw.Read(): %s", err)
+			}
+			if !bytes.Equal(res, in) {
+				t.Fatalf("should read back key 'i' value")
+			}
 
-		res, err = dbw.Read(key2)
-		if err != nil {
-			t.Fatalf("dbw.Read(): %s", err)
-		}
-		if !bytes.Equal(res, in2) {
-			t.Fatalf("should read back key 'j' value")
-		}
+			res, err = dbw.Read(key2)
+			if err != nil {
+				t.Fatalf("dbw.Read(): %s", err)
+			}
+			if !bytes.Equal(res, in2) {
+				t.Fatalf("should read back key 'j' value")
+			}
 
-		if dbw.Exists(key3) {
-			t.Fatalf("shouldn't read out key 'k' value")
-		}
-		batch.Clear()
-		if batch.SizeEstimate() != 0 {
-			t.Fatalf("batch clear failed.")
+			if dbw.Exists(key3) {
+				t.Fatalf("shouldn't read out key 'k' value")
+			}
+			batch.Clear()
+			if batch.SizeEstimate() != 0 {
+				t.Fatalf("batch clear failed.")
+			}
 		}
-	}
+	})
 }
 
 func testIterator(t *testing.T, dbw *DBWrapper) {
@@ -204,24 +221,27 @@ func testIterator(t *testing.T, dbw *DBWrapper) {
 }
 
 func TestIterator(t *testing.T) {
-	for _, obfuscate := range []bool{false, true} {
-		path, err := ioutil.TempDir("", "dbwtest")
-		if err != nil {
-			t.Fatalf("generate temp db path failed: %s\n", err)
-		}
-		defer os.RemoveAll(path)
-
-		dbw, err := NewDBWrapper(&DBOption{
-			FilePath:      path,
-			CacheSize:     1 << 20,
-			DontObfuscate: !obfuscate,
-		})
-		if err != nil {
-			t.Fatalf("NewDBWrapper failed: %s\n", err)
+	forEachBackend(t, func(t *testing.T, backend string) {
+		for _, obfuscate := range []bool{false, true} {
+			path, err := ioutil.TempDir("", "dbwtest")
+			if err != nil {
+				t.Fatalf("generate temp db path failed: %s\n", err)
+			}
+			defer os.RemoveAll(path)
+
+			dbw, err := NewDBWrapper(&DBOption{
+				FilePath:      path,
+				Backend:       backend,
+				CacheSize:     1 << 20,
+				DontObfuscate: !obfuscate,
+			})
+			if err != nil {
+				t.Fatalf("NewDBWrapper failed: %s\n", err)
+			}
+			defer dbw.Close()
+			testIterator(t, dbw)
 		}
-		defer dbw.Close()
-		testIterator(t, dbw)
-	}
+	})
 }
 
 func TestIteratorWithMem(t *testing.T) {
@@ -241,123 +261,131 @@ func TestIteratorWithMem(t *testing.T) {
 }
 
 func TestExistingDataNoObfuscate(t *testing.T) {
-	path, err := ioutil.TempDir("", "dbwtest")
-	if err != nil {
-		t.Fatalf("generate temp db path failed: %s\n", err)
-	}
-	defer os.RemoveAll(path)
+	forEachBackend(t, func(t *testing.T, backend string) {
+		path, err := ioutil.TempDir("", "dbwtest")
+		if err != nil {
+			t.Fatalf("generate temp db path failed: %s\n", err)
+		}
+		defer os.RemoveAll(path)
 
-	dbw, err := NewDBWrapper(&DBOption{
-		FilePath:      path,
-		CacheSize:     1 << 10,
-		DontObfuscate: true,
-	})
-	if err != nil {
-		t.Fatalf("NewDBWrapper failed: %s\n", err)
-	}
+		dbw, err := NewDBWrapper(&DBOption{
+			FilePath:      path,
+			Backend:       backend,
+			CacheSize:     1 << 10,
+			DontObfuscate: true,
+		})
+		if err != nil {
+			t.Fatalf("NewDBWrapper failed: %s\n", err)
+		}
 
-	key := []byte{'k'}
-	in := rand256()
-	if err := dbw.Write(key, in, false); err != nil {
-		t.Fatalf("dbw.Write(): %s", err)
-	}
-	if res, err := dbw.Read(key); err != nil {
-		t.Fatalf("dbw.Read(): %s", err)
-	} else if err == nil && !bytes.Equal(res, in) {
-		t.Fatalf("res should equal in")
-	}
+		key := []byte{'k'}
+		in := rand256()
+		if err := dbw.Write(key, in, false); err != nil {
+			t.Fatalf("dbw.Write(): %s", err)
+		}
+		if res, err := dbw.Read(key); err != nil {
+			t.Fatalf("dbw.Read(): %s", err)
+		} else if err == nil && !bytes.Equal(res, in) {
+			t.Fatalf("res should equal in")
+		}
 
-	dbw.Close()
+		dbw.Close()
 
-	odbw, err := NewDBWrapper(&DBOption{
-		FilePath:      path,
-		CacheSize:     1 << 10,
-		DontObfuscate: false,
-	})
-	if err != nil {
-		t.Fatalf("NewDBWrapper failed: %s\n", err)
-	}
-	defer odbw.Close()
+		odbw, err := NewDBWrapper(&DBOption{
+			FilePath:      path,
+			Backend:       backend,
+			CacheSize:     1 << 10,
+			DontObfuscate: false,
+		})
+		if err != nil {
+			t.Fatalf("NewDBWrapper failed: %s\n", err)
+		}
+		defer odbw.Close()
 
-	if res, err := odbw.Read(key); err != nil {
-		t.Fatalf("dbw.Read(): %s", err)
-	} else if err == nil && !bytes.Equal(res, in) {
-		t.Fatalf("res should equal in")
-	}
-	if odbw.IsEmpty() {
-		t.Fatalf("There should be existing data")
-	}
-	if !isNullKey(odbw.GetObfuscateKey()) {
-		t.Fatalf("odbw's ObfuscateKey should be null")
-	}
+		if res, err := odbw.Read(key); err != nil {
+			t.Fatalf("dbw.Read(): %s", err)
+		} else if err == nil && !bytes.Equal(res, in) {
+			t.Fatalf("res should equal in")
+		}
+		if odbw.IsEmpty() {
+			t.Fatalf("There should be existing data")
+		}
+		if !isNullKey(odbw.GetObfuscateKey()) {
+			t.Fatalf("odbw's ObfuscateKey should be null")
+		}
 
-	in2 := rand256()
-	if err := odbw.Write(key, in2, false); err != nil {
-		t.Fatalf("dbw.Write(): %s", err)
-	}
-	if res, err := odbw.Read(key); err != nil {
-		t.Fatalf("dbw.Read(): %s", err)
-	} else if err == nil && !bytes.Equal(res, in2) {
-		t.Fatalf("res should equal in2")
-	}
+		in2 := rand256()
+		if err := odbw.Write(key, in2, false); err != nil {
+			t.Fatalf("dbw.Write(): %s", err)
+		}
+		if res, err := odbw.Read(key); err != nil {
+			t.Fatalf("dbw.Read(): %s", err)
+		} else if err == nil && !bytes.Equal(res, in2) {
+			t.Fatalf("res should equal in2")
+		}
+	})
 }
 
 func TestExistingDataReindex(t *testing.T) {
-	path, err := ioutil.TempDir("", "dbwtest")
-	if err != nil {
-		t.Fatalf("generate temp db path failed: %s\n", err)
-	}
-	defer os.RemoveAll(path)
+	forEachBackend(t, func(t *testing.T, backend string) {
+		path, err := ioutil.TempDir("", "dbwtest")
+		if err != nil {
+			t.Fatalf("generate temp db path failed: %s\n", err)
+		}
+		defer os.RemoveAll(path)
 
-	dbw, err := NewDBWrapper(&DBOption{
-		FilePath:      path,
-		CacheSize:     1 << 10,
-		DontObfuscate: true,
-	})
-	if err != nil {
-		t.Fatalf("NewDBWrapper failed: %s\n", err)
-	}
+		dbw, err := NewDBWrapper(&DBOption{
+			FilePath:      path,
+			Backend:       backend,
+			CacheSize:     1 << 10,
+			DontObfuscate: true,
+		})
+		if err != nil {
+			t.Fatalf("NewDBWrapper failed: %s\n", err)
+		}
 
-	key := []byte{'k'}
-	in := rand256()
-	if err := dbw.Write(key, in, false); err != nil {
-		t.Fatalf("dbw.Write(): %s", err)
-	}
-	if res, err := dbw.Read(key); err != nil {
-		t.Fatalf("dbw.Read(): %s", err)
-	} else if err == nil && !bytes.Equal(res, in) {
-		t.Fatalf("res should equal in")
-	}
+		key := []byte{'k'}
+		in := rand256()
+		if err := dbw.Write(key, in, false); err != nil {
+			t.Fatalf("dbw.Write(): %s", err)
+		}
+		if res, err := dbw.Read(key); err != nil {
+			t.Fatalf("dbw.Read(): %s", err)
+		} else if err == nil && !bytes.Equal(res, in) {
+			t.Fatalf("res should equal in")
+		}
 
-	dbw.Close()
+		dbw.Close()
 
-	odbw, err := NewDBWrapper(&DBOption{
-		FilePath:      path,
-		CacheSize:     1 << 10,
-		DontObfuscate: false,
-		Wipe:          true,
-	})
-	if err != nil {
-		t.Fatalf("NewDBWrapper failed: %s\n", err)
-	}
-	defer odbw.Close()
+		odbw, err := NewDBWrapper(&DBOption{
+			FilePath:      path,
+			Backend:       backend,
+			CacheSize:     1 << 10,
+			DontObfuscate: false,
+			Wipe:          true,
+		})
+		if err != nil {
+			t.Fatalf("NewDBWrapper failed: %s\n", err)
+		}
+		defer odbw.Close()
 
-	if odbw.Exists(key) {
-		t.Fatalf("odbw should not contain 'k'")
-	}
-	if isNullKey(odbw.GetObfuscateKey()) {
-		t.Fatalf("odbw's ObfuscateKey should not be null")
-	}
+		if odbw.Exists(key) {
+			t.Fatalf("odbw should not contain 'k'")
+		}
+		if isNullKey(odbw.GetObfuscateKey()) {
+			t.Fatalf("odbw's ObfuscateKey should not be null")
+		}
 
-	in2 := rand256()
-	if err := odbw.Write(key, in2, false); err != nil {
-		t.Fatalf("dbw.Write(): %s", err)
-	}
-	if res, err := odbw.Read(key); err != nil {
-		t.Fatalf("dbw.Read(): %s", err)
-	} else if err == nil && !bytes.Equal(res, in2) {
-		t.Fatalf("res should equal in2")
-	}
+		in2 := rand256()
+		if err := odbw.Write(key, in2, false); err != nil {
+			t.Fatalf("dbw.Write(): %s", err)
+		}
+		if res, err := odbw.Read(key); err != nil {
+			t.Fatalf("dbw.Read(): %s", err)
+		} else if err == nil && !bytes.Equal(res, in2) {
+			t.Fatalf("res should equal in2")
+		}
+	})
 }
 
 func testIteratorOrdering(t *testing.T, dbw *DBWrapper) {
@@ -428,22 +456,25 @@ func testIteratorOrdering(t *testing.T, dbw *DBWrapper) {
 }
 
 func TestIteratorOrdering(t *testing.T) {
-	path, err := ioutil.TempDir("", "dbwtest")
-	if err != nil {
-		t.Fatalf("generate temp db path failed: %s\n", err)
-	}
-	defer os.RemoveAll(path)
+	forEachBackend(t, func(t *testing.T, backend string) {
+		path, err := ioutil.TempDir("", "dbwtest")
+		if err != nil {
+			t.Fatalf("generate temp db path failed: %s\n", err)
+		}
+		defer os.RemoveAll(path)
 
-	dbw, err := NewDBWrapper(&DBOption{
-		FilePath:      path,
-		CacheSize:     1 << 20,
-		DontObfuscate: true,
+		dbw, err := NewDBWrapper(&DBOption{
+			FilePath:      path,
+			Backend:       backend,
+			CacheSize:     1 << 20,
+			DontObfuscate: true,
+		})
+		if err != nil {
+			t.Fatalf("NewDBWrapper failed: %s\n", err)
+		}
+		defer dbw.Close()
+		testIteratorOrdering(t, dbw)
 	})
-	if err != nil {
-		t.Fatalf("NewDBWrapper failed: %s\n", err)
-	}
-	defer dbw.Close()
-	testIteratorOrdering(t, dbw)
 }
 
 /*
@@ -517,14 +548,30 @@ func testIteratorStringOrdering(t *testing.T, dbw *DBWrapper) {
 }
 
 func TestIteratorStringOrdering(t *testing.T) {
-	path, err := ioutil.TempDir("", "dbwtest")
-	if err != nil {
-		t.Fatalf("generate temp db path failed: %s\n", err)
-	}
-	defer os.RemoveAll(path)
+	forEachBackend(t, func(t *testing.T, backend string) {
+		path, err := ioutil.TempDir("", "dbwtest")
+		if err != nil {
+			t.Fatalf("generate temp db path failed: %s\n", err)
+		}
+		defer os.RemoveAll(path)
+
+		dbw, err := NewDBWrapper(&DBOption{
+			FilePath:      path,
+			Backend:       backend,
+			CacheSize:     1 << 20,
+			DontObfuscate: true,
+		})
+		if err != nil {
+			t.Fatalf("NewDBWrapper failed: %s\n", err)
+		}
+		defer dbw.Close()
+		testIteratorStringOrdering(t, dbw)
+	})
+}
 
+func TestIteratorStringOrderingWithMem(t *testing.T) {
 	dbw, err := NewDBWrapper(&DBOption{
-		FilePath:      path,
+		UseMemStore:   true,
 		CacheSize:     1 << 20,
 		DontObfuscate: true,
 	})
@@ -535,7 +582,104 @@ func TestIteratorStringOrdering(t *testing.T) {
 	testIteratorStringOrdering(t, dbw)
 }
 
-func TestIteratorStringOrderingWithMem(t *testing.T) {
+func TestDBWrapper_EstimateSize(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend string) {
+		path, err := ioutil.TempDir("", "dbwtest")
+		if err != nil {
+			t.Fatalf("generate temp db path failed: %s\n", err)
+		}
+		defer os.RemoveAll(path)
+
+		dbw, err := NewDBWrapper(&DBOption{
+			FilePath:      path,
+			Backend:       backend,
+			CacheSize:     1 << 20,
+			DontObfuscate: true,
+		})
+		if err != nil {
+			t.Fatalf("NewDBWrapper failed: %s\n", err)
+		}
+		defer dbw.Close()
+
+		if err := dbw.CompactRange(nil, nil); err != nil {
+			t.Fatalf("compact range err:%v", err)
+		}
+
+		batch := NewBatchWrapper(dbw)
+
+		var s string
+		for i := 0; i < 1e4; i++ {
+			s = fmt.Sprintf("%d", i)
+			batch.Write([]byte(s), rand256())
+		}
+
+		if err := dbw.WriteBatch(batch, true); err != nil {
+			t.Fatalf("batch write err:%v", err)
+		}
+
+		num := dbw.EstimateSize([]byte{'0'}, []byte(s))
+		t.Logf("the Estimate Size is:%d", num)
+		if num == 0 {
+			t.Fatalf("the Estimate Size is:%d", num)
+		}
+	})
+}
+
+func testIteratorPrefix(t *testing.T, dbw *DBWrapper) {
+	for _, key := range []string{"a", "b1", "b2", "b\xff", "c"} {
+		if err := dbw.Write([]byte(key), []byte(key), false); err != nil {
+			t.Fatalf("dbw.Write(): %s", err)
+		}
+	}
+
+	iter := dbw.Prefix([]byte("b"))
+	defer iter.Close()
+
+	var keys []string
+	for iter.Next(); iter.Valid(); iter.Next() {
+		keys = append(keys, string(iter.GetKey()))
+		if !bytes.Equal(iter.GetKey(), iter.GetVal()) {
+			t.Fatalf("iter.GetVal() should read back the value of %s", iter.GetKey())
+		}
+	}
+	if fmt.Sprint(keys) != fmt.Sprint([]string{"b1", "b2", "b\xff"}) {
+		t.Fatalf("prefix iteration returned %q", keys)
+	}
+
+	// Seeking before the range stops at its first key.
+	iter.Seek([]byte("a"))
+	if !bytes.Equal(iter.GetKey(), []byte("b1")) {
+		t.Fatalf("iter.Seek() before the range should stop at 'b1', got %q", iter.GetKey())
+	}
+	iter.Seek([]byte("c"))
+	if iter.Valid() {
+		t.Fatalf("iter.Seek() past the range should be invalid")
+	}
+}
+
+func TestIteratorPrefix(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend string) {
+		path, err := ioutil.TempDir("", "dbwtest")
+		if err != nil {
+			t.Fatalf("generate temp db path failed: %s\n", err)
+		}
+		defer os.RemoveAll(path)
+
+		dbw, err := NewDBWrapper(&DBOption{
+			FilePath:      path,
+			Backend:       backend,
+			CacheSize:     1 << 20,
+			DontObfuscate: true,
+		})
+		if err != nil {
+			t.Fatalf("NewDBWrapper failed: %s\n", err)
+		}
+		defer dbw.Close()
+		testIteratorPrefix(t, dbw)
+	})
+}
+
+func TestIteratorPrefixWithMem(t *testing.T) {
 	dbw, err := NewDBWrapper(&DBOption{
 		UseMemStore:   true,
 		CacheSize:     1 << 20,
@@ -545,45 +689,128 @@ func TestIteratorStringOrderingWithMem(t *testing.T) {
 		t.Fatalf("NewDBWrapper failed: %s\n", err)
 	}
 	defer dbw.Close()
-	testIteratorStringOrdering(t, dbw)
+	testIteratorPrefix(t, dbw)
 }
 
-func TestDBWrapper_EstimateSize(t *testing.T) {
+func TestBytesPrefix(t *testing.T) {
+	tests := []struct {
+		prefix []byte
+		limit  []byte
+	}{
+		{[]byte{'b'}, []byte{'c'}},
+		{[]byte{'b', 0xff}, []byte{'c'}},
+		{[]byte{0xff, 0xff}, nil},
+		{nil, nil},
+	}
+	for _, test := range tests {
+		r := BytesPrefix(test.prefix)
+		if !bytes.Equal(r.Start, test.prefix) || !bytes.Equal(r.Limit, test.limit) {
+			t.Errorf("BytesPrefix(%x) = [%x, %x), want limit %x", test.prefix, r.Start, r.Limit, test.limit)
+		}
+	}
+}
+
+func TestSwitchBackend(t *testing.T) {
 	path, err := ioutil.TempDir("", "dbwtest")
 	if err != nil {
 		t.Fatalf("generate temp db path failed: %s\n", err)
 	}
 	defer os.RemoveAll(path)
 
-	dbw, err := NewDBWrapper(&DBOption{
-		FilePath:      path,
-		CacheSize:     1 << 20,
-		DontObfuscate: true,
-	})
+	if _, err := NewDBWrapper(&DBOption{FilePath: path, Backend: "unknown"}); err == nil {
+		t.Fatalf("an unknown backend should be rejected")
+	}
+
+	dbw, err := NewDBWrapper(&DBOption{FilePath: path, CacheSize: 1 << 20})
 	if err != nil {
 		t.Fatalf("NewDBWrapper failed: %s\n", err)
 	}
-	defer dbw.Close()
+	key := []byte{'k'}
+	if err := dbw.Write(key, rand256(), true); err != nil {
+		t.Fatalf("dbw.Write(): %s", err)
+	}
+	dbw.Close()
+
+	// The data of another backend is never silently ignored.
+	if _, err := NewDBWrapper(&DBOption{FilePath: path, Backend: BackendBolt}); err == nil {
+		t.Fatalf("opening a leveldb database with the bolt backend should fail")
+	}
 
-	if err := dbw.CompactRange(nil, nil); err != nil {
-		t.Fatalf("compact range err:%v", err)
+	// Wiping the database switches its backend.
+	dbw, err = NewDBWrapper(&DBOption{FilePath: path, Backend: BackendBolt, Wipe: true})
+	if err != nil {
+		t.Fatalf("NewDBWrapper failed: %s\n", err)
+	}
+	if dbw.Exists(key) {
+		t.Fatalf("the wiped database should not contain 'k'")
+	}
+	if err := dbw.Write(key, rand256(), true); err != nil {
+		t.Fatalf("dbw.Write(): %s", err)
+	}
+	dbw.Close()
+
+	if _, err := NewDBWrapper(&DBOption{FilePath: path, Backend: BackendLevelDB}); err == nil {
+		t.Fatalf("opening a bolt database with the leveldb backend should fail")
+	}
+	dbw, err = NewDBWrapper(&DBOption{FilePath: path, Backend: BackendBolt})
+	if err != nil {
+		t.Fatalf("NewDBWrapper failed: %s\n", err)
 	}
+	defer dbw.Close()
+	if !dbw.Exists(key) {
+		t.Fatalf("the bolt database should keep 'k' across reopening")
+	}
+}
 
-	batch := NewBatchWrapper(dbw)
+func TestBoltWriteWhileIterating(t *testing.T) {
+	path, err := ioutil.TempDir("", "dbwtest")
+	if err != nil {
+		t.Fatalf("generate temp db path failed: %s\n", err)
+	}
+	defer os.RemoveAll(path)
 
-	var s string
-	for i := 0; i < 1e4; i++ {
-		s = fmt.Sprintf("%d", i)
-		batch.Write([]byte(s), rand256())
+	dbw, err := NewDBWrapper(&DBOption{FilePath: path, Backend: BackendBolt})
+	if err != nil {
+		t.Fatalf("NewDBWrapper failed: %s\n", err)
 	}
+	defer dbw.Close()
+	for i := 0; i < 4; i++ {
+		if err := dbw.Write([]byte{0x02, byte(i)}, []byte{byte(i)}, true); err != nil {
+			t.Fatalf("dbw.Write(): %s", err)
+		}
+	}
+
+	iter := dbw.Prefix([]byte{0x02})
+	defer iter.Close()
+	iter.Seek([]byte{0x02, 0x01})
 
-	if err := dbw.WriteBatch(batch, true); err != nil {
-		t.Fatalf("batch write err:%v", err)
+	// Several megabytes grow the file far past its initial mapping, the
+	// remap must not wait for the iterator of this goroutine.
+	for i := 0; i < 64; i++ {
+		batch := NewBatchWrapper(dbw)
+		for j := 0; j < 256; j++ {
+			batch.Write([]byte{0x02, 0x10 + byte(i), byte(j)}, rand256())
+		}
+		if err := dbw.WriteBatch(batch, false); err != nil {
+			t.Fatalf("dbw.WriteBatch(): %s", err)
+		}
 	}
 
-	num := dbw.EstimateSize([]byte{'0'}, []byte(s))
-	t.Logf("the Estimate Size is:%d", num)
-	if num == 0 {
-		t.Fatalf("the Estimate Size is:%d", num)
+	// The iterator keeps its position and its snapshot.
+	for i := 1; i < 4; i++ {
+		if !iter.Valid() || !bytes.Equal(iter.GetKey(), []byte{0x02, byte(i)}) {
+			t.Fatalf("iterator should be at key %d", i)
+		}
+		if !bytes.Equal(iter.GetVal(), []byte{byte(i)}) {
+			t.Fatalf("iterator should see the value of key %d", i)
+		}
+		iter.Next()
+	}
+	if iter.Valid() {
+		t.Fatalf("iterator should not see the keys written after it")
+	}
+	iter.Seek([]byte{0x02})
+	if !iter.Valid() || !bytes.Equal(iter.GetKey(), []byte{0x02, 0x00}) {
+		t.Fatalf("iterator should seek back to the first key")
 	}
 }
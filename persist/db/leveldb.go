@@ -0,0 +1,141 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+
+	lvldb "github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+type levelStore struct {
+	db          *lvldb.DB
+	readOption  opt.ReadOptions
+	iterOption  opt.ReadOptions
+	writeOption opt.WriteOptions
+	syncOption  opt.WriteOptions
+}
+
+func getOptions(cacheSize int) opt.Options {
+	var opts opt.Options
+	opts.BlockCacher = opt.LRUCacher
+	opts.BlockCacheCapacity = cacheSize / 2
+	opts.WriteBuffer = cacheSize / 4
+	opts.Filter = filter.NewBloomFilter(10)
+	opts.Compression = opt.NoCompression
+	opts.OpenFilesCacheCapacity = 64
+
+	return opts
+}
+
+func openLevelStore(do *DBOption) (Store, error) {
+	opts := getOptions(do.CacheSize)
+	db, err := lvldb.OpenFile(do.FilePath, &opts)
+	if err != nil {
+		return nil, err
+	}
+	if do.ForceCompactdb {
+		if err := db.CompactRange(util.Range{}); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &levelStore{
+		db: db,
+		readOption: opt.ReadOptions{
+			DontFillCache: false,
+			Strict:        opt.StrictJournalChecksum | opt.StrictBlockChecksum,
+		},
+		iterOption: opt.ReadOptions{
+			DontFillCache: true,
+			Strict:        opt.StrictJournalChecksum | opt.StrictBlockChecksum,
+		},
+		writeOption: opt.WriteOptions{},
+		syncOption: opt.WriteOptions{
+			Sync: true,
+		},
+	}, nil
+}
+
+func levelStoreExists(path string) bool {
+	_, err := os.Stat(filepath.Join(path, "CURRENT"))
+	return err == nil
+}
+
+func destroyLevelStore(path string) error {
+	st, err := storage.OpenFile(path, false)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	fds, err := st.List(storage.TypeAll)
+	if err != nil {
+		return err
+	}
+	for _, fd := range fds {
+		if err := st.Remove(fd); err != nil {
+			return err
+		}
+	}
+	for _, other := range []string{"CURRENT", "LOCK", "LOG", "LOG.old"} {
+		if err := os.Remove(filepath.Join(path, other)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ls *levelStore) Get(key []byte) ([]byte, error) {
+	value, err := ls.db.Get(key, &ls.readOption)
+	if err == lvldb.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (ls *levelStore) Has(key []byte) (bool, error) {
+	return ls.db.Has(key, &ls.readOption)
+}
+
+func (ls *levelStore) NewBatch() Batch {
+	return new(lvldb.Batch)
+}
+
+func (ls *levelStore) Write(batch Batch, sync bool) error {
+	opts := &ls.writeOption
+	if sync {
+		opts = &ls.syncOption
+	}
+	return ls.db.Write(batch.(*lvldb.Batch), opts)
+}
+
+func (ls *levelStore) NewIterator(slice *Range) Iterator {
+	return ls.db.NewIterator(levelRange(slice), &ls.iterOption)
+}
+
+func (ls *levelStore) SizeOf(begin, end []byte) (uint64, error) {
+	sizes, err := ls.db.SizeOf([]util.Range{{Start: begin, Limit: end}})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(sizes.Sum()), nil
+}
+
+func (ls *levelStore) Compact(begin, end []byte) error {
+	return ls.db.CompactRange(util.Range{Start: begin, Limit: end})
+}
+
+func (ls *levelStore) Close() error {
+	return ls.db.Close()
+}
+
+func levelRange(slice *Range) *util.Range {
+	if slice == nil {
+		return nil
+	}
+	return &util.Range{Start: slice.Start, Limit: slice.Limit}
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+)
+
+// memStore keeps the database in memory, for tests. Its iterators do not
+// take a snapshot.
+type memStore struct {
+	db *memdb.DB
+}
+
+func newMemStore(cacheSize int) *memStore {
+	return &memStore{db: memdb.New(comparer.DefaultComparer, cacheSize)}
+}
+
+func (ms *memStore) Get(key []byte) ([]byte, error) {
+	value, err := ms.db.Get(key)
+	if err == memdb.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), value...), err
+}
+
+func (ms *memStore) Has(key []byte) (bool, error) {
+	return ms.db.Contains(key), nil
+}
+
+func (ms *memStore) NewBatch() Batch {
+	return new(opBatch)
+}
+
+func (ms *memStore) Write(batch Batch, sync bool) error {
+	for _, op := range batch.(*opBatch).ops {
+		var err error
+		if op.delete {
+			err = ms.db.Delete(op.key)
+			if err == memdb.ErrNotFound {
+				err = nil
+			}
+		} else {
+			err = ms.db.Put(op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *memStore) NewIterator(slice *Range) Iterator {
+	return ms.db.NewIterator(levelRange(slice))
+}
+
+func (ms *memStore) SizeOf(begin, end []byte) (uint64, error) {
+	return uint64(ms.db.Size()), nil
+}
+
+func (ms *memStore) Compact(begin, end []byte) error {
+	return nil
+}
+
+func (ms *memStore) Close() error {
+	return nil
+}
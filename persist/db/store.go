@@ -0,0 +1,161 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Supported key-value engines of a DBWrapper.
+const (
+	// BackendLevelDB stores the database with goleveldb, it is the default.
+	BackendLevelDB = "leveldb"
+	// BackendBolt stores the database in a single bbolt B+tree file.
+	BackendBolt = "bolt"
+)
+
+// ErrNotFound is returned by reads of a key which does not exist, whatever
+// the backend.
+var ErrNotFound = errors.New("db: not found")
+
+// Store is the key-value engine under a DBWrapper. Keys are ordered
+// bytewise. Values are stored as given, the obfuscation is applied by the
+// DBWrapper.
+type Store interface {
+	// Get returns a copy of the value of key, or ErrNotFound.
+	Get(key []byte) ([]byte, error)
+	// Has reports whether key exists.
+	Has(key []byte) (bool, error)
+	// NewBatch returns an empty batch to be applied by Write.
+	NewBatch() Batch
+	// Write applies all the operations of the batch atomically. With sync,
+	// it returns only once the batch is durable.
+	Write(batch Batch, sync bool) error
+	// NewIterator returns an iterator over a consistent snapshot of the keys
+	// in slice, or of all keys if slice is nil.
+	NewIterator(slice *Range) Iterator
+	// SizeOf returns the approximate disk usage of the keys in [begin, end).
+	SizeOf(begin, end []byte) (uint64, error)
+	// Compact reorganizes the keys in [begin, end) to reclaim space, nil
+	// bounds extend to the first and last key.
+	Compact(begin, end []byte) error
+	Close() error
+}
+
+// Batch records puts and deletes to be applied atomically. It owns copies of
+// the keys and values given to it.
+type Batch interface {
+	Put(key, value []byte)
+	Delete(key []byte)
+	Reset()
+}
+
+// Iterator walks the keys of a Store in order. The key and value slices are
+// only valid until the next move of the iterator.
+type Iterator interface {
+	Seek(key []byte) bool
+	Next() bool
+	Valid() bool
+	Key() []byte
+	Value() []byte
+	Release()
+}
+
+// Range is the key range [Start, Limit). A nil Start is the first key and a
+// nil Limit is past the last key.
+type Range struct {
+	Start []byte
+	Limit []byte
+}
+
+// BytesPrefix returns the range of the keys beginning with prefix.
+func BytesPrefix(prefix []byte) *Range {
+	var limit []byte
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] < 0xff {
+			limit = make([]byte, i+1)
+			copy(limit, prefix)
+			limit[i]++
+			break
+		}
+	}
+	return &Range{Start: prefix, Limit: limit}
+}
+
+type storeBackend struct {
+	open func(do *DBOption) (Store, error)
+	// exists reports whether the backend has files in path.
+	exists  func(path string) bool
+	destroy func(path string) error
+}
+
+var storeBackends = map[string]*storeBackend{
+	BackendLevelDB: {open: openLevelStore, exists: levelStoreExists, destroy: destroyLevelStore},
+	BackendBolt:    {open: openBoltStore, exists: boltStoreExists, destroy: destroyBoltStore},
+}
+
+// IsValidBackend reports whether name is a supported key-value engine.
+func IsValidBackend(name string) bool {
+	_, ok := storeBackends[name]
+	return ok
+}
+
+func openStore(do *DBOption) (Store, error) {
+	name := do.Backend
+	if name == "" {
+		name = BackendLevelDB
+	}
+	backend, ok := storeBackends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown database backend %q", name)
+	}
+
+	// Wiping clears the files of every backend, so that -reindex also
+	// migrates a database to another backend.
+	if do.Wipe {
+		for _, other := range storeBackends {
+			if err := other.destroy(do.FilePath); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for otherName, other := range storeBackends {
+		if otherName != name && other.exists(do.FilePath) {
+			return nil, fmt.Errorf("database %s was created with the %s backend, "+
+				"configure it back or reindex to switch to %s", do.FilePath, otherName, name)
+		}
+	}
+
+	err := os.MkdirAll(do.FilePath, 0740)
+	if err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	return backend.open(do)
+}
+
+// opBatch is a Batch which records its operations, for the backends without
+// a native batch.
+type opBatch struct {
+	ops []batchOp
+}
+
+type batchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+func (b *opBatch) Put(key, value []byte) {
+	b.ops = append(b.ops, batchOp{
+		key:   append([]byte(nil), key...),
+		value: append([]byte(nil), value...),
+	})
+}
+
+func (b *opBatch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{key: append([]byte(nil), key...), delete: true})
+}
+
+func (b *opBatch) Reset() {
+	b.ops = b.ops[:0]
+}
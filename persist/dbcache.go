@@ -0,0 +1,60 @@
+package persist
+
+const (
+	// DefaultDBCache is the default size of the database caches in MiB.
+	DefaultDBCache = 450
+	// MinDBCache is the minimum size of the database caches in MiB.
+	MinDBCache = 4
+	// MaxDBCache is the maximum size of the database caches in MiB.
+	MaxDBCache = 16384
+	// maxBlockTreeDBCache is the maximum leveldb cache of the block tree db in MiB.
+	maxBlockTreeDBCache = 2
+	// maxCoinsDBCache is the maximum leveldb cache of the coins db in MiB.
+	maxCoinsDBCache = 8
+)
+
+// CoinCacheUsage is the memory budget in bytes of the in-memory UTXO cache,
+// above which the cache is flushed to the coins db.
+var CoinCacheUsage = NewDBCacheSizes(DefaultDBCache).CoinCache
+
+// DBCacheSizes splits the -dbcache budget between the leveldb caches and the
+// in-memory UTXO cache, all in bytes.
+type DBCacheSizes struct {
+	BlockTreeDB int
+	CoinsDB     int
+	CoinCache   int64
+}
+
+// NewDBCacheSizes splits a total cache size of dbCacheMiB MiB, which is
+// clamped to [MinDBCache, MaxDBCache].
+func NewDBCacheSizes(dbCacheMiB int64) *DBCacheSizes {
+	if dbCacheMiB < MinDBCache {
+		dbCacheMiB = MinDBCache
+	}
+	if dbCacheMiB > MaxDBCache {
+		dbCacheMiB = MaxDBCache
+	}
+	totalCache := dbCacheMiB << 20
+
+	blockTreeDBCache := totalCache / 8
+	if blockTreeDBCache > maxBlockTreeDBCache<<20 {
+		blockTreeDBCache = maxBlockTreeDBCache << 20
+	}
+	totalCache -= blockTreeDBCache
+
+	// use 25%-50% of the remainder for the coins db
+	coinsDBCache := totalCache/4 + (1 << 23)
+	if coinsDBCache > totalCache/2 {
+		coinsDBCache = totalCache / 2
+	}
+	if coinsDBCache > maxCoinsDBCache<<20 {
+		coinsDBCache = maxCoinsDBCache << 20
+	}
+	totalCache -= coinsDBCache
+
+	return &DBCacheSizes{
+		BlockTreeDB: int(blockTreeDBCache),
+		CoinsDB:     int(coinsDBCache),
+		CoinCache:   totalCache,
+	}
+}
@@ -0,0 +1,24 @@
+package persist
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDBCacheSizes(t *testing.T) {
+	sizes := NewDBCacheSizes(DefaultDBCache)
+	assert.Equal(t, 2<<20, sizes.BlockTreeDB)
+	assert.Equal(t, 8<<20, sizes.CoinsDB)
+	assert.Equal(t, int64(440<<20), sizes.CoinCache)
+	assert.Equal(t, sizes.CoinCache, CoinCacheUsage)
+
+	// small caches are split by ratio
+	sizes = NewDBCacheSizes(1)
+	assert.Equal(t, 512<<10, sizes.BlockTreeDB)
+	assert.Equal(t, 1792<<10, sizes.CoinsDB)
+	assert.Equal(t, int64(1792<<10), sizes.CoinCache)
+
+	sizes = NewDBCacheSizes(1 << 20)
+	assert.Equal(t, int64(MaxDBCache-10)<<20, sizes.CoinCache)
+}
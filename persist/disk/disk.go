@@ -1,11 +1,13 @@
 package disk
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"os"
@@ -26,6 +28,7 @@ import (
 	"github.com/copernet/copernicus/model"
 	"github.com/copernet/copernicus/model/chain"
 	"github.com/copernet/copernicus/model/mempool"
+	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/model/undo"
 	"github.com/copernet/copernicus/model/utxo"
 	"github.com/copernet/copernicus/net/wire"
@@ -39,6 +42,13 @@ type FlushStateMode int
 
 var gps = persist.InitPruneState()
 
+// maxBlockCoinsDBUsage is the maximum growth in MiB of the UTXO cache while
+// connecting a block, kept free below the cache limit on periodic flushes.
+const maxBlockCoinsDBUsage = 10
+
+// prunedBlockFilesFlag is the block tree db flag set once any block file was pruned.
+const prunedBlockFilesFlag = "prunedblockfiles"
+
 const (
 	FlushStateNone FlushStateMode = iota
 	FlushStateIfNeeded
@@ -277,6 +287,36 @@ func ReadBlockFromDisk(pindex *blockindex.BlockIndex, param *model.BitcoinParams
 	return blk, true
 }
 
+// ReadTxFromDisk reads the transaction at pos, along with the header of the
+// block which contains it.
+func ReadTxFromDisk(pos *block.DiskTxPos) (*block.BlockHeader, *tx.Tx, error) {
+	file := OpenBlockFile(pos.BlockIn, true)
+	if file == nil {
+		log.Error("ReadTxFromDisk: OpenBlockFile failed for %s", pos.BlockIn.String())
+		return nil, nil, errors.New("ErrOpenBlockFile")
+	}
+	defer file.Close()
+
+	// Skip the block length
+	if _, err := util.BinarySerializer.Uint32(file, binary.LittleEndian); err != nil {
+		return nil, nil, err
+	}
+	header := block.NewBlockHeader()
+	if err := header.Unserialize(file); err != nil {
+		log.Error("ReadTxFromDisk: read block header failed at %s: %v", pos.BlockIn.String(), err)
+		return nil, nil, err
+	}
+	if _, err := file.Seek(int64(pos.TxOffsetIn), io.SeekCurrent); err != nil {
+		return nil, nil, err
+	}
+	txn := tx.NewEmptyTx()
+	if err := txn.Unserialize(bufio.NewReader(file)); err != nil {
+		log.Error("ReadTxFromDisk: deserialize tx failed at %s: %v", pos.BlockIn.String(), err)
+		return nil, nil, err
+	}
+	return header, txn, nil
+}
+
 func WriteBlockToDisk(block *block.Block, pos *block.DiskBlockPos) bool {
 	// Open history file to append
 	file := OpenBlockFile(pos, false)
@@ -319,23 +359,21 @@ func FlushStateToDisk(mode FlushStateMode, nManualPruneHeight int) error {
 	gPersist := persist.GetInstance()
 	mem := mempool.GetInstance()
 	flushForPrune := false
-	dbPeakUsageFactor := int64(2)
-	maxBlockCoinsDBUsage := float64(dbPeakUsageFactor * 200)
-	coinCacheUsage := 5000 * 300
 	dataBaseWriteInterval := 60 * 60
 	dataBaseFlushInterval := 24 * 60 * 60
-	minBlockCoinsDBUsage := 50 * dbPeakUsageFactor
 
 	if gps.PruneMode && (gps.CheckForPruning || nManualPruneHeight > 0) && !persist.Reindex {
-		FindFilesToPruneManual(setFilesToPrune, nManualPruneHeight)
-	} else {
-		FindFilesToPrune(setFilesToPrune, uint64(params.PruneAfterHeight))
-		gps.CheckForPruning = false
+		if nManualPruneHeight > 0 {
+			FindFilesToPruneManual(setFilesToPrune, nManualPruneHeight)
+		} else {
+			FindFilesToPrune(setFilesToPrune, uint64(params.PruneAfterHeight))
+			gps.CheckForPruning = false
+		}
 	}
 	if !setFilesToPrune.IsEmpty() {
 		flushForPrune = true
 		if !gps.HavePruned {
-			err := blockTree.WriteFlag("prunedblockfiles", true)
+			err := blockTree.WriteFlag(prunedBlockFilesFlag, true)
 			if err != nil {
 				log.Error("write flag prunedblockfiles error: %v", err)
 				return err
@@ -356,17 +394,23 @@ func FlushStateToDisk(mode FlushStateMode, nManualPruneHeight int) error {
 		gPersist.GlobalLastSetChain = int(nNow)
 	}
 
+	// The unused part of the mempool budget can hold coins too.
 	mempoolUsage := mem.GetPoolUsage()
 	mempoolSizeMax := int64(persist.DefaultMaxMemPoolSize) * 1000000
-	cacheSize := coinsTip.DynamicMemoryUsage() * dbPeakUsageFactor
-	totalSpace := float64(coinCacheUsage) + math.Max(float64(mempoolSizeMax-mempoolUsage), 0)
-	// The cache is large and we're within 10% and 200 MiB or 50% and 50MiB
-	// of the limit, but we have time now (not in the middle of a block processing).
-	x := math.Max(totalSpace/2, totalSpace-float64(minBlockCoinsDBUsage*1024*1024))
-	y := math.Max(9*totalSpace/10, totalSpace-maxBlockCoinsDBUsage*1024*1024)
-	cacheLarge := mode == FlushStatePeriodic && float64(cacheSize) > math.Min(x, y)
+	cacheSize := coinsTip.DynamicMemoryUsage()
+	totalSpace := persist.CoinCacheUsage
+	if mempoolSizeMax > mempoolUsage {
+		totalSpace += mempoolSizeMax - mempoolUsage
+	}
+	// The cache is large and we're within 10% and 10 MiB of the limit, but
+	// we have time now (not in the middle of a block processing).
+	largeThreshold := totalSpace - maxBlockCoinsDBUsage*1024*1024
+	if largeThreshold < 9*totalSpace/10 {
+		largeThreshold = 9 * totalSpace / 10
+	}
+	cacheLarge := mode == FlushStatePeriodic && cacheSize > largeThreshold
 	// The cache is over the limit, we have to write now.
-	cacheCritical := mode == FlushStateIfNeeded && float64(cacheSize) > totalSpace
+	cacheCritical := mode == FlushStateIfNeeded && cacheSize > totalSpace
 	// It's been a while since we wrote the block index to disk. Do this
 	// frequently, so we don't need to redownLoad after a crash.
 	periodicWrite := mode == FlushStatePeriodic && int(nNow) > gPersist.GlobalLastWrite+dataBaseWriteInterval*1000000
@@ -537,6 +581,9 @@ func FindBlockPos(pos *block.DiskBlockPos, nAddSize uint32,
 		nOldChunks := (pos.Pos + persist.BlockFileChunkSize - 1) / persist.BlockFileChunkSize
 		nNewChunks := (nNewSize + persist.BlockFileChunkSize - 1) / persist.BlockFileChunkSize
 		if nNewChunks > nOldChunks {
+			if gps.PruneMode {
+				gps.CheckForPruning = true
+			}
 			allocateSize := nNewChunks*persist.BlockFileChunkSize - pos.Pos
 			if CheckDiskSpace(allocateSize) {
 				file := OpenBlockFile(pos, false)
@@ -573,7 +620,9 @@ func FindUndoPos(nFile int32, undoPos *block.DiskBlockPos, nAddSize int) error {
 	nNewChunks := (nNewSize + persist.UndoFileChunkSize - 1) / persist.UndoFileChunkSize
 
 	if nNewChunks > nOldChunks {
-
+		if gps.PruneMode {
+			gps.CheckForPruning = true
+		}
 		if CheckDiskSpace(nNewChunks*persist.UndoFileChunkSize - undoPos.Pos) {
 			file := OpenUndoFile(*undoPos, false)
 			if file != nil {
@@ -625,9 +674,10 @@ func FindFilesToPrune(setFilesToPrune *set.Set, nPruneAfterHeight uint64) {
 	nBuffer := uint64(persist.BlockFileChunkSize + persist.UndoFileChunkSize)
 	count := 0
 	if nCurrentUsage+nBuffer >= gps.PruneTarget {
-		for fileNumber := 0; int32(fileNumber) < gPersist.GlobalLastBlockFile; fileNumber++ {
-			nBytesToPrune := uint64(gPersist.GlobalBlockFileInfo[fileNumber].Size + gPersist.GlobalBlockFileInfo[fileNumber].UndoSize)
-			if gPersist.GlobalBlockFileInfo[fileNumber].Size == 0 {
+		for fileNumber := int32(0); fileNumber < gPersist.GlobalLastBlockFile; fileNumber++ {
+			fileInfo := gPersist.GlobalBlockFileInfo[fileNumber]
+			nBytesToPrune := uint64(fileInfo.Size + fileInfo.UndoSize)
+			if fileInfo.Size == 0 {
 				continue
 			}
 			// are we below our target?
@@ -636,11 +686,11 @@ func FindFilesToPrune(setFilesToPrune *set.Set, nPruneAfterHeight uint64) {
 			}
 			// don't prune files that could have a block within
 			// MIN_BLOCKS_TO_KEEP of the main chain's tip but keep scanning
-			if gPersist.GlobalBlockFileInfo[fileNumber].HeightLast > nLastBlockWeCanPrune {
+			if fileInfo.HeightLast > nLastBlockWeCanPrune {
 				continue
 			}
 
-			PruneOneBlockFile(int32(fileNumber))
+			PruneOneBlockFile(fileNumber)
 			// Queue up the files for removal
 			setFilesToPrune.Add(fileNumber)
 			nCurrentUsage -= nBytesToPrune
@@ -648,97 +698,135 @@ func FindFilesToPrune(setFilesToPrune *set.Set, nPruneAfterHeight uint64) {
 		}
 	}
 
-	log.Info("prune", "Prune: target=%dMiB actual=%dMiB diff=%dMiB max_prune_height=%d removed %d blk/rev pairs\n",
-		gps.PruneTarget/1024/1024, nCurrentUsage/1024/1024, (gps.PruneTarget-nCurrentUsage)/1024/1024, nLastBlockWeCanPrune, count)
+	var nDiff int64
+	if gps.PruneTarget >= nCurrentUsage {
+		nDiff = int64((gps.PruneTarget - nCurrentUsage) / 1024 / 1024)
+	} else {
+		nDiff = -int64((nCurrentUsage - gps.PruneTarget) / 1024 / 1024)
+	}
+	log.Info("Prune: target=%dMiB actual=%dMiB diff=%dMiB max_prune_height=%d removed %d blk/rev pairs",
+		gps.PruneTarget/1024/1024, nCurrentUsage/1024/1024, nDiff, nLastBlockWeCanPrune, count)
 }
 
+// FindFilesToPruneManual calculate the block/rev files holding only blocks at
+// or below manualPruneHeight, never pruning within MIN_BLOCKS_TO_KEEP of the tip
 func FindFilesToPruneManual(setFilesToPrune *set.Set, manualPruneHeight int) {
 	gPersist := persist.GetInstance()
 	gChainActive := chain.GetInstance()
-	if gps.PruneMode && manualPruneHeight <= 0 {
-		panic("the PruneMode is false and manualPruneHeight equal zero")
+	if !gps.PruneMode || manualPruneHeight <= 0 {
+		panic("manual pruning needs the PruneMode and a positive manualPruneHeight")
 	}
 
-	persist.CsLastBlockFile.Lock()
-	defer persist.CsLastBlockFile.Unlock()
-
 	if gChainActive.Tip() == nil {
 		return
 	}
 
 	// last block to prune is the lesser of (user-specified height, MIN_BLOCKS_TO_KEEP from the tip)
-	lastBlockWeCanPrune := math.Min(float64(manualPruneHeight), float64(gChainActive.Tip().Height-block.MinBlocksToKeep))
+	lastBlockWeCanPrune := gChainActive.Tip().Height - block.MinBlocksToKeep
+	if int32(manualPruneHeight) < lastBlockWeCanPrune {
+		lastBlockWeCanPrune = int32(manualPruneHeight)
+	}
 	count := 0
-	for fileNumber := 0; int32(fileNumber) < gPersist.GlobalLastBlockFile; fileNumber++ {
-		if gPersist.GlobalBlockFileInfo[fileNumber].Size == 0 || gPersist.GlobalBlockFileInfo[fileNumber].HeightLast > gPersist.GlobalLastBlockFile {
+	for fileNumber := int32(0); fileNumber < gPersist.GlobalLastBlockFile; fileNumber++ {
+		fileInfo := gPersist.GlobalBlockFileInfo[fileNumber]
+		if fileInfo.Size == 0 || fileInfo.HeightLast > lastBlockWeCanPrune {
 			continue
 		}
-		PruneOneBlockFile(int32(fileNumber))
+		PruneOneBlockFile(fileNumber)
 		setFilesToPrune.Add(fileNumber)
 		count++
 	}
-	log.Info("Prune (Manual): prune_height=%d removed %d blk/rev pairs\n", lastBlockWeCanPrune, count)
+	log.Info("Prune (Manual): prune_height=%d removed %d blk/rev pairs", lastBlockWeCanPrune, count)
 }
 
 // PruneOneBlockFile prune a block file (modify associated database entries)
 func PruneOneBlockFile(fileNumber int32) {
-	bm := make(map[util.Hash]*blockindex.BlockIndex)
 	gPersist := persist.GetInstance()
-	for _, value := range bm {
-		pindex := value
-		if pindex.File == fileNumber {
-			pindex.Status &= ^blockindex.BlockHaveData
-			pindex.Status &= ^blockindex.BlockHaveUndo
-			pindex.File = 0
-			pindex.DataPos = 0
-			pindex.UndoPos = 0
-			gPersist.AddDirtyBlockIndex(pindex)
-
-			// Prune from mapBlocksUnlinked -- any block we prune would have
-			// to be downloaded again in order to consider its chain, at which
-			// point it would be considered as a candidate for
-			// mapBlocksUnlinked or setBlockIndexCandidates.
-			ranges := gPersist.GlobalMapBlocksUnlinked[pindex.Prev]
-			tmpRange := make([]*blockindex.BlockIndex, len(ranges))
-			copy(tmpRange, ranges)
-			for len(tmpRange) > 0 {
-				v := tmpRange[0]
-				tmpRange = tmpRange[1:]
-				if v == pindex {
-					tmp := make([]*blockindex.BlockIndex, len(ranges)-1)
-					for _, val := range tmpRange {
-						if val != v {
-							tmp = append(tmp, val)
-						}
-					}
-					gPersist.GlobalMapBlocksUnlinked[pindex.Prev] = tmp
-				}
+	for _, pindex := range chain.GetInstance().GetBlockIndexesInFile(fileNumber) {
+		pindex.Status &= ^blockindex.BlockHaveData
+		pindex.Status &= ^blockindex.BlockHaveUndo
+		pindex.File = 0
+		pindex.DataPos = 0
+		pindex.UndoPos = 0
+		gPersist.AddDirtyBlockIndex(pindex)
+
+		// Prune from mapBlocksUnlinked -- any block we prune would have
+		// to be downloaded again in order to consider its chain, at which
+		// point it would be considered as a candidate for
+		// mapBlocksUnlinked or setBlockIndexCandidates.
+		unlinked, ok := gPersist.GlobalMapBlocksUnlinked[pindex.Prev]
+		if !ok {
+			continue
+		}
+		remain := make([]*blockindex.BlockIndex, 0, len(unlinked))
+		for _, v := range unlinked {
+			if v != pindex {
+				remain = append(remain, v)
 			}
 		}
+		if len(remain) == 0 {
+			delete(gPersist.GlobalMapBlocksUnlinked, pindex.Prev)
+		} else {
+			gPersist.GlobalMapBlocksUnlinked[pindex.Prev] = remain
+		}
 	}
 
 	gPersist.GlobalBlockFileInfo[fileNumber].SetNull()
 	gPersist.GlobalDirtyFileInfo[fileNumber] = true
 }
 
+// UnlinkPrunedFiles delete the block/rev files queued up by the pruning
 func UnlinkPrunedFiles(setFilesToPrune *set.Set) {
-	lists := setFilesToPrune.List()
-	for key, value := range lists {
-		v := value.(int32)
-		pos := &block.DiskBlockPos{
-			File: v,
+	for _, value := range setFilesToPrune.List() {
+		pos := block.DiskBlockPos{
+			File: value.(int32),
 			Pos:  0,
 		}
-		os.Remove(GetBlockPosFilename(*pos, "blk"))
-		os.Remove(GetBlockPosFilename(*pos, "rev"))
-		log.Info("Prune: %s deleted blk/rev (%05u)\n", key)
+		os.Remove(GetBlockPosFilename(pos, "blk"))
+		os.Remove(GetBlockPosFilename(pos, "rev"))
+		log.Info("Prune: deleted blk/rev (%05d)", pos.File)
 	}
 }
 
+// PruneBlockFilesManual prune the block/rev files holding only blocks at or
+// below height, as requested by the pruneblockchain RPC.
+func PruneBlockFilesManual(height int32) error {
+	return FlushStateToDisk(FlushStateNone, int(height))
+}
+
 func GetPruneState() *persist.PruneState {
 	return gps
 }
 
+// SetupPruneMode configures the block file pruning from the -prune option in MiB:
+// 0 disables pruning, 1 only prunes on the pruneblockchain RPC, and greater
+// values are the target size of the blk/rev files.
+func SetupPruneMode(pruneMiB uint64) error {
+	gps.PruneMode = false
+	gps.PruneTarget = 0
+	gps.CheckForPruning = false
+	gps.HavePruned = blkdb.GetInstance().ReadFlag(prunedBlockFilesFlag)
+	switch {
+	case pruneMiB == 0:
+		if gps.HavePruned {
+			return errors.New("you need to rebuild the database using -reindex to go back to unpruned mode")
+		}
+		return nil
+	case pruneMiB == 1:
+		gps.PruneTarget = math.MaxUint64
+		log.Info("Block pruning enabled. Use RPC call pruneblockchain(height) to manually prune block and undo files.")
+	case pruneMiB < persist.MinDiskSpaceForBlockFiles/1024/1024:
+		return fmt.Errorf("prune configured below the minimum of %d MiB, please use a higher number",
+			persist.MinDiskSpaceForBlockFiles/1024/1024)
+	default:
+		gps.PruneTarget = pruneMiB * 1024 * 1024
+		log.Info("Prune configured to target %dMiB on disk for block and undo files.", pruneMiB)
+	}
+	gps.PruneMode = true
+	gps.CheckForPruning = true
+	return nil
+}
+
 func isBlkDataFile(name string) (ok bool) {
 	return len(name) == 12 && name[8:12] == ".dat"
 }
@@ -29,6 +29,7 @@ import (
 	"github.com/copernet/copernicus/persist/blkdb"
 	"github.com/copernet/copernicus/persist/db"
 	"github.com/copernet/copernicus/util"
+	"gopkg.in/fatih/set.v0"
 )
 
 func initTestEnv(t *testing.T) (dirpath string, err error) {
@@ -477,3 +478,169 @@ func TestCleanupBlockRevFiles(t *testing.T) {
 	}
 
 }
+
+// initPruneChain builds an active chain of blocks stored in fileCount block files
+// of blocksPerFile blocks each, with 100MiB of block and undo data per file.
+func initPruneChain(fileCount int, blocksPerFile int) []*blockindex.BlockIndex {
+	chain.InitGlobalChain()
+	gPersist := persist.GetInstance()
+	gPersist.GlobalBlockFileInfo = make([]*block.BlockFileInfo, 0, fileCount)
+	gPersist.GlobalDirtyFileInfo = make(map[int32]bool)
+	gPersist.GlobalDirtyBlockIndex = make(map[util.Hash]*blockindex.BlockIndex)
+	gPersist.GlobalLastBlockFile = int32(fileCount - 1)
+
+	indexMap := make(map[util.Hash]*blockindex.BlockIndex)
+	indexes := make([]*blockindex.BlockIndex, 0, fileCount*blocksPerFile)
+	var prev *blockindex.BlockIndex
+	for file := 0; file < fileCount; file++ {
+		fileInfo := block.NewBlockFileInfo()
+		fileInfo.Size = 90 * 1024 * 1024
+		fileInfo.UndoSize = 10 * 1024 * 1024
+		for i := 0; i < blocksPerFile; i++ {
+			height := int32(file*blocksPerFile + i)
+			bi := blockindex.NewBlockIndex(block.NewBlockHeader())
+			bi.Header.Nonce = uint32(height)
+			bi.Height = height
+			bi.Prev = prev
+			bi.File = int32(file)
+			bi.AddStatus(blockindex.BlockHaveData)
+			bi.AddStatus(blockindex.BlockHaveUndo)
+			fileInfo.AddBlock(height, 0)
+			indexMap[*bi.GetBlockHash()] = bi
+			indexes = append(indexes, bi)
+			prev = bi
+		}
+		gPersist.GlobalBlockFileInfo = append(gPersist.GlobalBlockFileInfo, fileInfo)
+	}
+	chain.GetInstance().InitLoad(indexMap, nil)
+	chain.GetInstance().SetTip(prev)
+	return indexes
+}
+
+func TestSetupPruneMode(t *testing.T) {
+	testDirPath, err := initTestEnv(t)
+	if err != nil {
+		t.Fatalf("init test environment failed: %s", err)
+	}
+	defer os.RemoveAll(testDirPath)
+	blkdb.InitBlockTreeDB(&blkdb.BlockTreeDBConfig{
+		Do: &db.DBOption{
+			FilePath:  filepath.Join(testDirPath, "blocks", "index"),
+			CacheSize: 1 << 20,
+		},
+	})
+	defer SetupPruneMode(0)
+
+	assert.NoError(t, SetupPruneMode(0))
+	assert.False(t, GetPruneState().PruneMode)
+
+	assert.NoError(t, SetupPruneMode(1))
+	assert.True(t, GetPruneState().PruneMode)
+	assert.Equal(t, uint64(math.MaxUint64), GetPruneState().PruneTarget)
+
+	assert.Error(t, SetupPruneMode(549))
+
+	assert.NoError(t, SetupPruneMode(550))
+	assert.True(t, GetPruneState().PruneMode)
+	assert.True(t, GetPruneState().CheckForPruning)
+	assert.Equal(t, uint64(550*1024*1024), GetPruneState().PruneTarget)
+	assert.False(t, GetPruneState().HavePruned)
+
+	assert.NoError(t, blkdb.GetInstance().WriteFlag(prunedBlockFilesFlag, true))
+	assert.NoError(t, SetupPruneMode(1000))
+	assert.True(t, GetPruneState().HavePruned)
+	assert.Error(t, SetupPruneMode(0))
+	assert.NoError(t, blkdb.GetInstance().WriteFlag(prunedBlockFilesFlag, false))
+}
+
+func TestFindFilesToPrune(t *testing.T) {
+	testDirPath, err := initTestEnv(t)
+	if err != nil {
+		t.Fatalf("init test environment failed: %s", err)
+	}
+	defer os.RemoveAll(testDirPath)
+	defer func() { *gps = *persist.InitPruneState() }()
+
+	// the tip is at height 399, so the blocks up to height 111 may be pruned
+	indexes := initPruneChain(4, 100)
+	gps.PruneMode = true
+	gps.PruneTarget = 250 * 1024 * 1024
+
+	setFilesToPrune := set.New()
+	FindFilesToPrune(setFilesToPrune, 0)
+	assert.Equal(t, []interface{}{int32(0)}, setFilesToPrune.List())
+	assert.Equal(t, uint64(300*1024*1024), CalculateCurrentUsage())
+
+	gPersist := persist.GetInstance()
+	assert.True(t, gPersist.GlobalDirtyFileInfo[0])
+	assert.Equal(t, uint32(0), gPersist.GlobalBlockFileInfo[0].Size)
+	for _, bi := range indexes[:100] {
+		assert.False(t, bi.HasData())
+		assert.False(t, bi.HasUndo())
+		assert.Equal(t, bi, gPersist.GlobalDirtyBlockIndex[*bi.GetBlockHash()])
+	}
+	for _, bi := range indexes[100:] {
+		assert.True(t, bi.HasData())
+	}
+
+	// the remaining files hold blocks too close to the tip, and nothing is
+	// pruned before the prune height
+	setFilesToPrune = set.New()
+	FindFilesToPrune(setFilesToPrune, 0)
+	assert.True(t, setFilesToPrune.IsEmpty())
+
+	initPruneChain(4, 100)
+	FindFilesToPrune(setFilesToPrune, 399)
+	assert.True(t, setFilesToPrune.IsEmpty())
+}
+
+func TestFindFilesToPruneManual(t *testing.T) {
+	testDirPath, err := initTestEnv(t)
+	if err != nil {
+		t.Fatalf("init test environment failed: %s", err)
+	}
+	defer os.RemoveAll(testDirPath)
+	defer func() { *gps = *persist.InitPruneState() }()
+
+	initPruneChain(6, 100)
+	gps.PruneMode = true
+	gps.PruneTarget = math.MaxUint64
+
+	setFilesToPrune := set.New()
+	FindFilesToPruneManual(setFilesToPrune, 50)
+	assert.True(t, setFilesToPrune.IsEmpty())
+
+	FindFilesToPruneManual(setFilesToPrune, 250)
+	assert.Equal(t, 2, setFilesToPrune.Size())
+	assert.True(t, setFilesToPrune.Has(int32(0), int32(1)))
+
+	// the blocks within MinBlocksToKeep of the tip are kept
+	setFilesToPrune = set.New()
+	FindFilesToPruneManual(setFilesToPrune, 599)
+	assert.Equal(t, []interface{}{int32(2)}, setFilesToPrune.List())
+}
+
+func TestUnlinkPrunedFiles(t *testing.T) {
+	testDirPath, err := initTestEnv(t)
+	if err != nil {
+		t.Fatalf("init test environment failed: %s", err)
+	}
+	defer os.RemoveAll(testDirPath)
+
+	for _, file := range []int32{0, 1} {
+		pos := block.DiskBlockPos{File: file, Pos: 0}
+		OpenBlockFile(&pos, false).Close()
+		OpenUndoFile(pos, false).Close()
+	}
+
+	UnlinkPrunedFiles(set.New(int32(0)))
+
+	blkFiles, err := GetBlkFiles()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(blkFiles))
+	assert.Equal(t, "blk00001.dat", filepath.Base(blkFiles[0]))
+	_, err = os.Stat(GetBlockPosFilename(block.DiskBlockPos{File: 0}, "rev"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(GetBlockPosFilename(block.DiskBlockPos{File: 1}, "rev"))
+	assert.Nil(t, err)
+}
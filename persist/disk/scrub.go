@@ -0,0 +1,447 @@
+package disk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/model/chain"
+	"github.com/copernet/copernicus/model/pow"
+	"github.com/copernet/copernicus/model/undo"
+	"github.com/copernet/copernicus/persist"
+	"github.com/copernet/copernicus/persist/blkdb"
+	"github.com/copernet/copernicus/util"
+)
+
+// QuarantineDirName is the directory of the blocks directory where the
+// corrupt records are copied.
+const QuarantineDirName = "quarantine"
+
+// ScrubEntry is a block or undo record which failed the verification.
+type ScrubEntry struct {
+	File int32
+	Pos  uint32
+	Undo bool
+	// Hash is the block whose index refers to the record, nil if none does.
+	Hash        *util.Hash
+	Err         error
+	Quarantined bool
+}
+
+// ScrubReport summarizes a pass of ScrubBlockFiles.
+type ScrubReport struct {
+	Files int
+	// Blocks and Undos count the valid records.
+	Blocks int
+	Undos  int
+	// Unreferenced counts the valid block records no block index refers to.
+	Unreferenced int
+	Corrupt      []ScrubEntry
+	Compacted    []int32
+	// Reclaimed is the number of bytes freed by the compaction.
+	Reclaimed uint64
+}
+
+// scrubbedFile holds the valid records of a block file.
+type scrubbedFile struct {
+	blocks map[*blockindex.BlockIndex]*block.Block
+	undos  map[*blockindex.BlockIndex]*undo.BlockUndo
+	// wasted is set when the file holds records no block index refers to.
+	wasted bool
+	// corrupt is set when corrupt records are still referred to.
+	corrupt bool
+}
+
+// ScrubBlockFiles verifies the block and undo records of the block files
+// listed in the block file info against the block indexes referring to them.
+// Blocks are checked for their length prefix, proof of work and hash, undo
+// data for their length prefix and checksum.
+//
+// With quarantine, the corrupt records are copied to the quarantine directory
+// and unlinked from their block index, which then behaves as if the data was
+// pruned. With compact, the files holding records no block index refers to
+// are rewritten: the referenced records are stored again at the end of the
+// last block file, then the old files are deleted once the block index is
+// flushed. persist.CsMain is taken for one file at a time, so that the chain
+// goes on during a long scrub, the caller must not hold it.
+func ScrubBlockFiles(quarantine, compact bool) (*ScrubReport, error) {
+	report := new(ScrubReport)
+	compacted := make([]int32, 0)
+	for file := int32(0); ; file++ {
+		exists, moved, err := scrubBlockFile(file, quarantine, compact, report)
+		if err != nil {
+			return report, err
+		}
+		if !exists {
+			break
+		}
+		if moved {
+			compacted = append(compacted, file)
+		}
+	}
+
+	persist.CsMain.Lock()
+	defer persist.CsMain.Unlock()
+	persist.CsBlockFiles.Lock()
+	defer persist.CsBlockFiles.Unlock()
+
+	gPersist := persist.GetInstance()
+	if len(gPersist.GlobalDirtyBlockIndex) > 0 || len(compacted) > 0 {
+		if err := FlushStateToDisk(FlushStateAlways, 0); err != nil {
+			return report, err
+		}
+	}
+	// The block index no longer refers to the compacted files
+	for _, file := range compacted {
+		pos := block.NewDiskBlockPos(file, 0)
+		os.Remove(GetBlockPosFilename(*pos, "blk"))
+		os.Remove(GetBlockPosFilename(*pos, "rev"))
+		log.Info("Scrub: compacted blk/rev (%05d)", file)
+	}
+	report.Compacted = compacted
+	return report, nil
+}
+
+// scrubBlockFile verifies, and compacts if asked to, one block file under
+// persist.CsMain. It reports whether the file is known and whether it was
+// compacted.
+func scrubBlockFile(file int32, quarantine, compact bool, report *ScrubReport) (bool, bool, error) {
+	persist.CsMain.Lock()
+	defer persist.CsMain.Unlock()
+	persist.CsBlockFiles.Lock()
+	defer persist.CsBlockFiles.Unlock()
+
+	gPersist := persist.GetInstance()
+	if file >= int32(len(gPersist.GlobalBlockFileInfo)) {
+		return false, false, nil
+	}
+	info := gPersist.GlobalBlockFileInfo[file]
+	if info.Size == 0 && info.UndoSize == 0 {
+		return true, false, nil
+	}
+	report.Files++
+	scrubbed, err := scrubFile(file, info, quarantine, report)
+	if err != nil {
+		return true, false, err
+	}
+	// The last file may still receive blocks
+	if !compact || !scrubbed.wasted || scrubbed.corrupt || file == gPersist.GlobalLastBlockFile {
+		return true, false, nil
+	}
+
+	oldSize := uint64(info.Size) + uint64(info.UndoSize)
+	moved, err := compactFile(file, scrubbed)
+	if err != nil {
+		return true, false, err
+	}
+	gPersist.GlobalBlockFileInfo[file].SetNull()
+	gPersist.GlobalDirtyFileInfo[file] = true
+	if oldSize > moved {
+		report.Reclaimed += oldSize - moved
+	}
+	return true, true, nil
+}
+
+// scrubFile verifies the records of one block file.
+func scrubFile(file int32, info *block.BlockFileInfo, quarantine bool, report *ScrubReport) (*scrubbedFile, error) {
+	gPersist := persist.GetInstance()
+	scrubbed := &scrubbedFile{
+		blocks: make(map[*blockindex.BlockIndex]*block.Block),
+		undos:  make(map[*blockindex.BlockIndex]*undo.BlockUndo),
+	}
+	indexes := chain.GetInstance().GetBlockIndexesInFile(file)
+	byPos := make(map[uint32]*blockindex.BlockIndex)
+	positions := make([]uint32, 0, len(indexes))
+	for _, index := range indexes {
+		if index.HasData() {
+			byPos[index.DataPos] = index
+			positions = append(positions, index.DataPos)
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+
+	pos := block.NewDiskBlockPos(file, 0)
+	blkFile, err := os.Open(GetBlockPosFilename(*pos, "blk"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if blkFile != nil {
+		defer blkFile.Close()
+	}
+
+	corrupt := func(entry ScrubEntry, src *os.File, prefix string, end uint32) {
+		if quarantine && entry.Hash != nil {
+			if err := quarantineRecord(src, prefix, file, entry.Pos, end); err != nil {
+				log.Error("Scrub: quarantine %s%05d.dat at %d failed: %v", prefix, file, entry.Pos, err)
+			} else {
+				entry.Quarantined = true
+			}
+		}
+		if entry.Hash != nil && !entry.Quarantined {
+			scrubbed.corrupt = true
+		}
+		scrubbed.wasted = true
+		report.Corrupt = append(report.Corrupt, entry)
+		log.Warn("Scrub: corrupt record in %s%05d.dat at %d: %v", prefix, file, entry.Pos, entry.Err)
+	}
+
+	// Walk the block records, a corrupt one is skipped up to the next
+	// position referred to by a block index.
+	reported := make(map[*blockindex.BlockIndex]bool)
+	for offset := uint32(0); offset < info.Size; {
+		index := byPos[offset]
+		var blk *block.Block
+		var size uint32
+		if blkFile == nil {
+			err = errors.New("missing block file")
+		} else {
+			blk, size, err = readBlockRecord(blkFile, offset, info.Size)
+		}
+		if err == nil && index != nil && blk.GetHash() != *index.GetBlockHash() {
+			err = fmt.Errorf("block hash %s does not match the block index", blk.GetHash())
+		}
+		if err != nil {
+			next := info.Size
+			i := sort.Search(len(positions), func(i int) bool { return positions[i] > offset })
+			if i < len(positions) {
+				next = positions[i]
+			}
+			entry := ScrubEntry{File: file, Pos: offset, Err: err}
+			if index != nil {
+				entry.Hash = index.GetBlockHash()
+				reported[index] = true
+				if quarantine {
+					index.Status &= ^blockindex.BlockHaveData
+					index.DataPos = 0
+					gPersist.AddDirtyBlockIndex(index)
+				}
+			}
+			corrupt(entry, blkFile, "blk", next)
+			offset = next
+			continue
+		}
+
+		report.Blocks++
+		if index == nil {
+			report.Unreferenced++
+			scrubbed.wasted = true
+		} else {
+			scrubbed.blocks[index] = blk
+		}
+		offset += size
+	}
+	// The block indexes referring to the middle of a record
+	for _, index := range indexes {
+		if !index.HasData() || scrubbed.blocks[index] != nil || reported[index] {
+			continue
+		}
+		entry := ScrubEntry{File: file, Pos: index.DataPos, Hash: index.GetBlockHash(),
+			Err: errors.New("no block record at this position")}
+		if quarantine {
+			index.Status &= ^blockindex.BlockHaveData
+			index.DataPos = 0
+			gPersist.AddDirtyBlockIndex(index)
+			entry.Quarantined = true
+		} else {
+			scrubbed.corrupt = true
+		}
+		report.Corrupt = append(report.Corrupt, entry)
+	}
+
+	revFile, err := os.Open(GetBlockPosFilename(*pos, "rev"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if revFile != nil {
+		defer revFile.Close()
+	}
+	for _, index := range indexes {
+		if !index.HasUndo() {
+			continue
+		}
+		var bu *undo.BlockUndo
+		var size uint32
+		if revFile == nil {
+			err = errors.New("missing undo file")
+		} else if index.Prev == nil {
+			err = errors.New("undo data of the genesis block")
+		} else {
+			bu, size, err = readUndoRecord(revFile, index.UndoPos, info.UndoSize, index.Prev.GetBlockHash())
+		}
+		if blk := scrubbed.blocks[index]; err == nil && blk != nil && len(bu.GetTxundo())+1 != len(blk.Txs) {
+			err = errors.New("undo data inconsistent with the block")
+		}
+		if err != nil {
+			end := info.UndoSize
+			if size != 0 {
+				end = index.UndoPos + size
+			}
+			entry := ScrubEntry{File: file, Pos: index.UndoPos, Undo: true, Hash: index.GetBlockHash(), Err: err}
+			if quarantine {
+				index.Status &= ^blockindex.BlockHaveUndo
+				index.UndoPos = 0
+				gPersist.AddDirtyBlockIndex(index)
+			}
+			corrupt(entry, revFile, "rev", end)
+			continue
+		}
+		report.Undos++
+		scrubbed.undos[index] = bu
+	}
+	return scrubbed, nil
+}
+
+// readBlockRecord reads the block record at pos, as written by
+// WriteBlockToDisk, and returns its size including the length prefix.
+func readBlockRecord(file *os.File, pos, end uint32) (*block.Block, uint32, error) {
+	if uint64(pos)+4 > uint64(end) {
+		return nil, 0, errors.New("truncated block record")
+	}
+	var lenBuf [4]byte
+	if _, err := file.ReadAt(lenBuf[:], int64(pos)); err != nil {
+		return nil, 0, err
+	}
+	size := binary.LittleEndian.Uint32(lenBuf[:])
+	if size == 0 || uint64(pos)+4+uint64(size) > uint64(end) {
+		return nil, 0, fmt.Errorf("bad block record size %d", size)
+	}
+	buf := make([]byte, size)
+	if _, err := file.ReadAt(buf, int64(pos)+4); err != nil {
+		return nil, 0, err
+	}
+	blk := block.NewBlock()
+	if err := blk.Unserialize(bytes.NewBuffer(buf)); err != nil {
+		return nil, 0, err
+	}
+	objPow := pow.Pow{}
+	blockHash := blk.GetHash()
+	if !objPow.CheckProofOfWork(&blockHash, blk.Header.Bits, model.ActiveNetParams) {
+		return nil, 0, errors.New("bad proof of work")
+	}
+	return blk, size + 4, nil
+}
+
+// readUndoRecord reads the undo record at pos, as written by UndoWriteToDisk,
+// and returns its size including the length prefix. The size is 0 when the
+// length prefix is unusable.
+func readUndoRecord(file *os.File, pos, end uint32, hashPrev *util.Hash) (*undo.BlockUndo, uint32, error) {
+	if uint64(pos)+4 > uint64(end) {
+		return nil, 0, errors.New("truncated undo record")
+	}
+	var lenBuf [4]byte
+	if _, err := file.ReadAt(lenBuf[:], int64(pos)); err != nil {
+		return nil, 0, err
+	}
+	size := binary.LittleEndian.Uint32(lenBuf[:])
+	if size < sha256.Size || uint64(pos)+4+uint64(size) > uint64(end) {
+		return nil, 0, fmt.Errorf("bad undo record size %d", size)
+	}
+	buf := make([]byte, size)
+	if _, err := file.ReadAt(buf, int64(pos)+4); err != nil {
+		return nil, size + 4, err
+	}
+	undoData := buf[:len(buf)-sha256.Size]
+	hasher := sha256.New()
+	hasher.Write(hashPrev[:])
+	hasher.Write(undoData)
+	if !bytes.Equal(hasher.Sum(nil), buf[len(buf)-sha256.Size:]) {
+		return nil, size + 4, errors.New("undo checksum mismatch")
+	}
+	bu := undo.NewBlockUndo(0)
+	if err := bu.Unserialize(bytes.NewBuffer(undoData)); err != nil {
+		return nil, size + 4, err
+	}
+	return bu, size + 4, nil
+}
+
+// quarantineRecord copies the bytes of src between pos and end to the
+// quarantine directory.
+func quarantineRecord(src *os.File, prefix string, file int32, pos, end uint32) error {
+	if src == nil || end <= pos {
+		return nil
+	}
+	dir := filepath.Join(GetBlockPosParentFilename(), QuarantineDirName)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	buf := make([]byte, end-pos)
+	n, err := src.ReadAt(buf, int64(pos))
+	if n == 0 && err != nil {
+		return err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("%s%05d-%d.dat", prefix, file, pos))
+	return ioutil.WriteFile(name, buf[:n], 0644)
+}
+
+// compactFile stores again the valid records of a file referred to by a block
+// index at the end of the last block file, and returns the bytes written.
+func compactFile(file int32, scrubbed *scrubbedFile) (uint64, error) {
+	gPersist := persist.GetInstance()
+	var moved uint64
+	for _, index := range chain.GetInstance().GetBlockIndexesInFile(file) {
+		blk := scrubbed.blocks[index]
+		bu := scrubbed.undos[index]
+		newPos := block.NewDiskBlockPos(gPersist.GlobalLastBlockFile, 0)
+		if blk != nil {
+			size := uint32(blk.SerializeSize()) + 4
+			if !FindBlockPos(newPos, size, index.Height, uint64(blk.GetBlockHeader().Time), false) {
+				return moved, fmt.Errorf("no room to store block %s", index.GetBlockHash())
+			}
+			if !WriteBlockToDisk(blk, newPos) {
+				return moved, fmt.Errorf("failed to store block %s", index.GetBlockHash())
+			}
+			if err := relocateTxIndex(blk, index.GetBlockPos(), *newPos); err != nil {
+				return moved, err
+			}
+			index.DataPos = newPos.Pos
+			moved += uint64(size)
+		}
+		if bu != nil {
+			undoPos := block.NewDiskBlockPos(newPos.File, 0)
+			size := bu.SerializeSize() + 36
+			if err := FindUndoPos(newPos.File, undoPos, size); err != nil {
+				return moved, err
+			}
+			if err := UndoWriteToDisk(bu, undoPos, *index.Prev.GetBlockHash(), model.ActiveNetParams.BitcoinNet); err != nil {
+				return moved, err
+			}
+			index.UndoPos = undoPos.Pos
+			moved += uint64(size)
+		}
+		index.File = newPos.File
+		gPersist.AddDirtyBlockIndex(index)
+	}
+	return moved, nil
+}
+
+// relocateTxIndex points the tx index entries of the transactions of blk
+// stored at oldPos to newPos.
+func relocateTxIndex(blk *block.Block, oldPos, newPos block.DiskBlockPos) error {
+	blockTree := blkdb.GetInstance()
+	moved := make(map[util.Hash]block.DiskTxPos)
+	for _, txn := range blk.Txs {
+		txid := txn.GetHash()
+		txPos, err := blockTree.ReadTxIndex(&txid)
+		if err != nil {
+			return err
+		}
+		if txPos == nil || txPos.BlockIn == nil || *txPos.BlockIn != oldPos {
+			continue
+		}
+		moved[txid] = block.DiskTxPos{BlockIn: &newPos, TxOffsetIn: txPos.TxOffsetIn}
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+	return blockTree.WriteTxIndex(moved)
+}
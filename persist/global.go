@@ -17,6 +17,9 @@ const (
 	// UndoFileChunkSize is the pre-allocation chunk size for rev?????.dat files (since 0.8) */
 	UndoFileChunkSize     = 0x100000
 	DefaultMaxMemPoolSize = 300
+	// MinDiskSpaceForBlockFiles is the minimum disk space kept for blk/rev files when pruning:
+	// 288 blocks of 1MB with their undo data, the orphan rate and the pre-allocated chunks.
+	MinDiskSpaceForBlockFiles = 550 * 1024 * 1024
 )
 
 var (
@@ -24,6 +27,13 @@ var (
 	CsLastBlockFile = new(sync.RWMutex)
 	persistGlobal   *PersistGlobal
 	Reindex         bool
+	// SpentIndex is set when the outpoints spent by the connected blocks are
+	// recorded in the spent index.
+	SpentIndex bool
+	// CsBlockFiles is held while block records are moved between block
+	// files, and read locked by the readers of the block files which do not
+	// hold CsMain.
+	CsBlockFiles = new(sync.RWMutex)
 )
 
 type PersistGlobal struct {
@@ -208,6 +208,50 @@ func NewGetBlockHeaderCmd(hash string, verbose *bool) *GetBlockHeaderCmd {
 	}
 }
 
+// GetBlockFilterCmd defines the getblockfilter JSON-RPC command.
+type GetBlockFilterCmd struct {
+	BlockHash  string
+	FilterType *string `jsonrpcdefault:"\"basic\""`
+}
+
+// NewGetBlockFilterCmd returns a new instance which can be used to issue a
+// getblockfilter JSON-RPC command.
+func NewGetBlockFilterCmd(blockHash string, filterType *string) *GetBlockFilterCmd {
+	return &GetBlockFilterCmd{
+		BlockHash:  blockHash,
+		FilterType: filterType,
+	}
+}
+
+// GetDSProofCmd defines the getdsproof JSON-RPC command.  Hash is the hash
+// of a double spend proof or of the double spent mempool transaction.
+type GetDSProofCmd struct {
+	Hash    string
+	Verbose *bool `jsonrpcdefault:"true"`
+}
+
+// NewGetDSProofCmd returns a new instance which can be used to issue a
+// getdsproof JSON-RPC command.
+func NewGetDSProofCmd(hash string, verbose *bool) *GetDSProofCmd {
+	return &GetDSProofCmd{
+		Hash:    hash,
+		Verbose: verbose,
+	}
+}
+
+// GetDSProofListCmd defines the getdsprooflist JSON-RPC command.
+type GetDSProofListCmd struct {
+	Verbose *bool `jsonrpcdefault:"false"`
+}
+
+// NewGetDSProofListCmd returns a new instance which can be used to issue a
+// getdsprooflist JSON-RPC command.
+func NewGetDSProofListCmd(verbose *bool) *GetDSProofListCmd {
+	return &GetDSProofListCmd{
+		Verbose: verbose,
+	}
+}
+
 // GetChainTxStatsCmd defines the getchaintxstats JSON-RPC command.
 type GetChainTxStatsCmd struct {
 	Blocks    *int32
@@ -523,12 +567,19 @@ func NewGetTxOutProofCmd(txIDs []string, blockHash *string) *GetTxOutProofCmd {
 }
 
 // GetTxOutSetInfoCmd defines the gettxoutsetinfo JSON-RPC command.
-type GetTxOutSetInfoCmd struct{}
+type GetTxOutSetInfoCmd struct {
+	HashType *string `json:"hash_type" jsonrpcdefault:"\"ecmh\""`
+}
 
 // NewGetTxOutSetInfoCmd returns a new instance which can be used to issue a
 // gettxoutsetinfo JSON-RPC command.
-func NewGetTxOutSetInfoCmd() *GetTxOutSetInfoCmd {
-	return &GetTxOutSetInfoCmd{}
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetTxOutSetInfoCmd(hashType *string) *GetTxOutSetInfoCmd {
+	return &GetTxOutSetInfoCmd{
+		HashType: hashType,
+	}
 }
 
 // GetWorkCmd defines the getwork JSON-RPC command.
@@ -734,6 +785,115 @@ func NewValidateAddressCmd(address string) *ValidateAddressCmd {
 	}
 }
 
+// GetIndexInfoCmd defines the getindexinfo JSON-RPC command.
+type GetIndexInfoCmd struct {
+	IndexName *string
+}
+
+// NewGetIndexInfoCmd returns a new instance which can be used to issue a
+// getindexinfo JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetIndexInfoCmd(indexName *string) *GetIndexInfoCmd {
+	return &GetIndexInfoCmd{
+		IndexName: indexName,
+	}
+}
+
+// AddressRequest selects the addresses, and optionally the range of block
+// heights, of the address index commands. It is unmarshalled from a JSON
+// object or from a single address string.
+type AddressRequest struct {
+	Addresses []string `json:"addresses"`
+	Start     int32    `json:"start,omitempty"`
+	End       int32    `json:"end,omitempty"`
+}
+
+// UnmarshalJSON provides a custom Unmarshal method for AddressRequest, which
+// also accepts a single address.
+func (r *AddressRequest) UnmarshalJSON(data []byte) error {
+	var address string
+	if err := json.Unmarshal(data, &address); err == nil {
+		r.Addresses = []string{address}
+		return nil
+	}
+
+	type addressRequest AddressRequest
+	return json.Unmarshal(data, (*addressRequest)(r))
+}
+
+// GetAddressTxIdsCmd defines the getaddresstxids JSON-RPC command.
+type GetAddressTxIdsCmd struct {
+	Request AddressRequest
+}
+
+// NewGetAddressTxIdsCmd returns a new instance which can be used to issue a
+// getaddresstxids JSON-RPC command.
+func NewGetAddressTxIdsCmd(request AddressRequest) *GetAddressTxIdsCmd {
+	return &GetAddressTxIdsCmd{
+		Request: request,
+	}
+}
+
+// GetAddressBalanceCmd defines the getaddressbalance JSON-RPC command.
+type GetAddressBalanceCmd struct {
+	Request AddressRequest
+}
+
+// NewGetAddressBalanceCmd returns a new instance which can be used to issue a
+// getaddressbalance JSON-RPC command.
+func NewGetAddressBalanceCmd(request AddressRequest) *GetAddressBalanceCmd {
+	return &GetAddressBalanceCmd{
+		Request: request,
+	}
+}
+
+// GetAddressUtxosCmd defines the getaddressutxos JSON-RPC command.
+type GetAddressUtxosCmd struct {
+	Request AddressRequest
+}
+
+// NewGetAddressUtxosCmd returns a new instance which can be used to issue a
+// getaddressutxos JSON-RPC command.
+func NewGetAddressUtxosCmd(request AddressRequest) *GetAddressUtxosCmd {
+	return &GetAddressUtxosCmd{
+		Request: request,
+	}
+}
+
+// GetAddressMempoolCmd defines the getaddressmempool JSON-RPC command.
+type GetAddressMempoolCmd struct {
+	Request AddressRequest
+}
+
+// NewGetAddressMempoolCmd returns a new instance which can be used to issue a
+// getaddressmempool JSON-RPC command.
+func NewGetAddressMempoolCmd(request AddressRequest) *GetAddressMempoolCmd {
+	return &GetAddressMempoolCmd{
+		Request: request,
+	}
+}
+
+// SpentInfoRequest selects the outpoint of the getspentinfo command.
+type SpentInfoRequest struct {
+	TxID  string `json:"txid"`
+	Index uint32 `json:"index"`
+}
+
+// GetSpentInfoCmd defines the getspentinfo JSON-RPC command.
+type GetSpentInfoCmd struct {
+	Request SpentInfoRequest
+}
+
+// NewGetSpentInfoCmd returns a new instance which can be used to issue a
+// getspentinfo JSON-RPC command.
+func NewGetSpentInfoCmd(request SpentInfoRequest) *GetSpentInfoCmd {
+	return &GetSpentInfoCmd{
+		Request: request,
+	}
+}
+
 // VerifyChainCmd defines the verifychain JSON-RPC command.
 type VerifyChainCmd struct {
 	CheckLevel *int32 `jsonrpcdefault:"3"`
@@ -782,6 +942,34 @@ func NewVerifyTxOutProofCmd(proof string) *VerifyTxOutProofCmd {
 	}
 }
 
+// DumpTxOutSetCmd defines the dumptxoutset JSON-RPC command.
+type DumpTxOutSetCmd struct {
+	Path string
+}
+
+// NewDumpTxOutSetCmd returns a new instance which can be used to issue a
+// dumptxoutset JSON-RPC command.
+func NewDumpTxOutSetCmd(path string) *DumpTxOutSetCmd {
+	return &DumpTxOutSetCmd{
+		Path: path,
+	}
+}
+
+// ScrubBlockFilesCmd defines the scrubblockfiles JSON-RPC command.
+type ScrubBlockFilesCmd struct {
+	Quarantine *bool `jsonrpcdefault:"false"`
+	Compact    *bool `jsonrpcdefault:"false"`
+}
+
+// NewScrubBlockFilesCmd returns a new instance which can be used to issue a
+// scrubblockfiles JSON-RPC command.
+func NewScrubBlockFilesCmd(quarantine, compact *bool) *ScrubBlockFilesCmd {
+	return &ScrubBlockFilesCmd{
+		Quarantine: quarantine,
+		Compact:    compact,
+	}
+}
+
 // PruneBlockChainCmd defines the pruneblockchain JSON-RPC command.
 type PruneBlockChainCmd struct {
 	Height int
@@ -1045,11 +1233,14 @@ func init() {
 	MustRegisterCmd("getblockcount", (*GetBlockCountCmd)(nil), flags)
 	MustRegisterCmd("getblockhash", (*GetBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblockheader", (*GetBlockHeaderCmd)(nil), flags)
+	MustRegisterCmd("getblockfilter", (*GetBlockFilterCmd)(nil), flags)
 	MustRegisterCmd("getblocktemplate", (*GetBlockTemplateCmd)(nil), flags)
 	MustRegisterCmd("getchaintips", (*GetChainTipsCmd)(nil), flags)
 	MustRegisterCmd("getchaintxstats", (*GetChainTxStatsCmd)(nil), flags)
 	MustRegisterCmd("getconnectioncount", (*GetConnectionCountCmd)(nil), flags)
 	MustRegisterCmd("getdifficulty", (*GetDifficultyCmd)(nil), flags)
+	MustRegisterCmd("getdsproof", (*GetDSProofCmd)(nil), flags)
+	MustRegisterCmd("getdsprooflist", (*GetDSProofListCmd)(nil), flags)
 	MustRegisterCmd("getgenerate", (*GetGenerateCmd)(nil), flags)
 	MustRegisterCmd("gethashespersec", (*GetHashesPerSecCmd)(nil), flags)
 	MustRegisterCmd("getinfo", (*GetInfoCmd)(nil), flags)
@@ -1079,6 +1270,12 @@ func init() {
 	MustRegisterCmd("submitblock", (*SubmitBlockCmd)(nil), flags)
 	MustRegisterCmd("uptime", (*UptimeCmd)(nil), flags)
 	MustRegisterCmd("validateaddress", (*ValidateAddressCmd)(nil), flags)
+	MustRegisterCmd("getindexinfo", (*GetIndexInfoCmd)(nil), flags)
+	MustRegisterCmd("getaddresstxids", (*GetAddressTxIdsCmd)(nil), flags)
+	MustRegisterCmd("getaddressbalance", (*GetAddressBalanceCmd)(nil), flags)
+	MustRegisterCmd("getaddressutxos", (*GetAddressUtxosCmd)(nil), flags)
+	MustRegisterCmd("getaddressmempool", (*GetAddressMempoolCmd)(nil), flags)
+	MustRegisterCmd("getspentinfo", (*GetSpentInfoCmd)(nil), flags)
 	MustRegisterCmd("verifychain", (*VerifyChainCmd)(nil), flags)
 	MustRegisterCmd("verifymessage", (*VerifyMessageCmd)(nil), flags)
 	MustRegisterCmd("getmempoolancestors", (*GetMempoolAncestorsCmd)(nil), flags)
@@ -1096,6 +1293,8 @@ func init() {
 	MustRegisterCmd("setexcessiveblock", (*SetExcessiveBlockCmd)(nil), flags)
 	MustRegisterCmd("getexcessiveblock", (*GetExcessiveBlockCmd)(nil), flags)
 	MustRegisterCmd("pruneblockchain", (*PruneBlockChainCmd)(nil), flags)
+	MustRegisterCmd("dumptxoutset", (*DumpTxOutSetCmd)(nil), flags)
+	MustRegisterCmd("scrubblockfiles", (*ScrubBlockFilesCmd)(nil), flags)
 	MustRegisterCmd("createmultisig", (*CreateMultiSigCmd)(nil), flags)
 	MustRegisterCmd("estimatefee", (*EstimateFeeCmd)(nil), flags)
 
@@ -100,6 +100,45 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"decodescript","params":["00"],"id":1}`,
 			unmarshalled: &DecodeScriptCmd{HexScript: "00"},
 		},
+		{
+			name: "dumptxoutset",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("dumptxoutset", "utxo.dat")
+			},
+			staticCmd: func() interface{} {
+				return NewDumpTxOutSetCmd("utxo.dat")
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"dumptxoutset","params":["utxo.dat"],"id":1}`,
+			unmarshalled: &DumpTxOutSetCmd{Path: "utxo.dat"},
+		},
+		{
+			name: "scrubblockfiles",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("scrubblockfiles")
+			},
+			staticCmd: func() interface{} {
+				return NewScrubBlockFilesCmd(nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"scrubblockfiles","params":[],"id":1}`,
+			unmarshalled: &ScrubBlockFilesCmd{
+				Quarantine: Bool(false),
+				Compact:    Bool(false),
+			},
+		},
+		{
+			name: "scrubblockfiles optional",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("scrubblockfiles", true, true)
+			},
+			staticCmd: func() interface{} {
+				return NewScrubBlockFilesCmd(Bool(true), Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"scrubblockfiles","params":[true,true],"id":1}`,
+			unmarshalled: &ScrubBlockFilesCmd{
+				Quarantine: Bool(true),
+				Compact:    Bool(true),
+			},
+		},
 		{
 			name: "getaddednodeinfo",
 			newCmd: func() (interface{}, error) {
@@ -231,6 +270,47 @@ func TestChainSvrCmds(t *testing.T) {
 				Verbose: Bool(true),
 			},
 		},
+		{
+			name: "getblockfilter",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getblockfilter", "123")
+			},
+			staticCmd: func() interface{} {
+				return NewGetBlockFilterCmd("123", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockfilter","params":["123"],"id":1}`,
+			unmarshalled: &GetBlockFilterCmd{
+				BlockHash:  "123",
+				FilterType: String("basic"),
+			},
+		},
+		{
+			name: "getdsproof",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getdsproof", "123", false)
+			},
+			staticCmd: func() interface{} {
+				return NewGetDSProofCmd("123", Bool(false))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getdsproof","params":["123",false],"id":1}`,
+			unmarshalled: &GetDSProofCmd{
+				Hash:    "123",
+				Verbose: Bool(false),
+			},
+		},
+		{
+			name: "getdsprooflist",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getdsprooflist")
+			},
+			staticCmd: func() interface{} {
+				return NewGetDSProofListCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getdsprooflist","params":[],"id":1}`,
+			unmarshalled: &GetDSProofListCmd{
+				Verbose: Bool(false),
+			},
+		},
 		{
 			name: "getblocktemplate",
 			newCmd: func() (interface{}, error) {
@@ -611,10 +691,25 @@ func TestChainSvrCmds(t *testing.T) {
 				return NewCmd("gettxoutsetinfo")
 			},
 			staticCmd: func() interface{} {
-				return NewGetTxOutSetInfoCmd()
+				return NewGetTxOutSetInfoCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":[],"id":1}`,
+			unmarshalled: &GetTxOutSetInfoCmd{
+				HashType: String("ecmh"),
+			},
+		},
+		{
+			name: "gettxoutsetinfo hash_serialized",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("gettxoutsetinfo", "hash_serialized")
+			},
+			staticCmd: func() interface{} {
+				return NewGetTxOutSetInfoCmd(String("hash_serialized"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":["hash_serialized"],"id":1}`,
+			unmarshalled: &GetTxOutSetInfoCmd{
+				HashType: String("hash_serialized"),
 			},
-			marshalled:   `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":[],"id":1}`,
-			unmarshalled: &GetTxOutSetInfoCmd{},
 		},
 		{
 			name: "getwork",
@@ -983,6 +1078,69 @@ func TestChainSvrCmds(t *testing.T) {
 				Address: "1Address",
 			},
 		},
+		{
+			name: "getindexinfo",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getindexinfo")
+			},
+			staticCmd: func() interface{} {
+				return NewGetIndexInfoCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getindexinfo","params":[],"id":1}`,
+			unmarshalled: &GetIndexInfoCmd{},
+		},
+		{
+			name: "getindexinfo optional",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getindexinfo", "txindex")
+			},
+			staticCmd: func() interface{} {
+				return NewGetIndexInfoCmd(String("txindex"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getindexinfo","params":["txindex"],"id":1}`,
+			unmarshalled: &GetIndexInfoCmd{
+				IndexName: String("txindex"),
+			},
+		},
+		{
+			name: "getaddresstxids",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getaddresstxids", `{"addresses":["1Address"],"start":5,"end":10}`)
+			},
+			staticCmd: func() interface{} {
+				return NewGetAddressTxIdsCmd(AddressRequest{Addresses: []string{"1Address"}, Start: 5, End: 10})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddresstxids","params":[{"addresses":["1Address"],"start":5,"end":10}],"id":1}`,
+			unmarshalled: &GetAddressTxIdsCmd{
+				Request: AddressRequest{Addresses: []string{"1Address"}, Start: 5, End: 10},
+			},
+		},
+		{
+			name: "getaddressbalance",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getaddressbalance", `{"addresses":["1Address","2Address"]}`)
+			},
+			staticCmd: func() interface{} {
+				return NewGetAddressBalanceCmd(AddressRequest{Addresses: []string{"1Address", "2Address"}})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressbalance","params":[{"addresses":["1Address","2Address"]}],"id":1}`,
+			unmarshalled: &GetAddressBalanceCmd{
+				Request: AddressRequest{Addresses: []string{"1Address", "2Address"}},
+			},
+		},
+		{
+			name: "getspentinfo",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getspentinfo", `{"txid":"123","index":1}`)
+			},
+			staticCmd: func() interface{} {
+				return NewGetSpentInfoCmd(SpentInfoRequest{TxID: "123", Index: 1})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getspentinfo","params":[{"txid":"123","index":1}],"id":1}`,
+			unmarshalled: &GetSpentInfoCmd{
+				Request: SpentInfoRequest{TxID: "123", Index: 1},
+			},
+		},
 		{
 			name: "verifychain",
 			newCmd: func() (interface{}, error) {
@@ -28,6 +28,34 @@ type GetBlockHeaderVerboseResult struct {
 	NextHash      string  `json:"nextblockhash,omitempty"`
 }
 
+// GetBlockFilterResult models the data from the getblockfilter command.
+type GetBlockFilterResult struct {
+	Filter string `json:"filter"`
+	Header string `json:"header"`
+}
+
+// DSProofSpenderResult models a spender of a double spend proof.
+type DSProofSpenderResult struct {
+	TxVersion       uint32   `json:"txversion"`
+	Sequence        uint32   `json:"sequence"`
+	LockTime        uint32   `json:"locktime"`
+	HashPrevOutputs string   `json:"hashprevoutputs"`
+	HashSequence    string   `json:"hashsequence"`
+	HashOutputs     string   `json:"hashoutputs"`
+	PushData        []string `json:"pushdata"`
+}
+
+// GetDSProofResult models the data from the getdsproof and getdsprooflist
+// commands when the verbose flag is set.
+type GetDSProofResult struct {
+	Hex      string                 `json:"hex"`
+	DSPID    string                 `json:"dspid"`
+	TxID     string                 `json:"txid"`
+	PrevTxID string                 `json:"prevtxid"`
+	PrevOut  uint32                 `json:"prevout"`
+	Spenders []DSProofSpenderResult `json:"spenders"`
+}
+
 // GetBlockVerboseResult models the data from the getblock command when the
 // verbose flag is set.  When the verbose flag is not set, getblock returns a
 // hex-encoded string.
@@ -125,6 +153,15 @@ type GetBlockChainInfoResult struct {
 	ChainWork            string                              `json:"chainwork,omitempty"`
 	SoftForks            []*SoftForkDescription              `json:"softforks"`
 	Bip9SoftForks        map[string]*Bip9SoftForkDescription `json:"bip9_softforks"`
+	Upgrades             []*UpgradeDescription               `json:"upgrades"`
+}
+
+// UpgradeDescription describes the activation of a network upgrade.
+type UpgradeDescription struct {
+	Name             string `json:"name"`
+	ActivationHeight int32  `json:"activationheight,omitempty"`
+	ActivationTime   int64  `json:"activationtime,omitempty"`
+	Status           string `json:"status"`
 }
 
 // GetBlockTemplateResultTx models the transactions field of the
@@ -326,10 +363,51 @@ type GetTxOutSetInfoResult struct {
 	TxOuts         uint64  `json:"txouts"`
 	BogoSize       uint64  `json:"bogosize"`
 	HashSerialized string  `json:"hash_serialized"`
+	ECMH           string  `json:"ecmh"`
 	DiskSize       uint64  `json:"disk_size"`
 	TotalAmount    float64 `json:"total_amount"`
 }
 
+// GetTxOutSetCommitmentResult models the data from the gettxoutsetinfo
+// command with the ecmh hash type.
+type GetTxOutSetCommitmentResult struct {
+	Height    int    `json:"height"`
+	BestBlock string `json:"bestblock"`
+	ECMH      string `json:"ecmh"`
+}
+
+// DumpTxOutSetResult models the data from the dumptxoutset command.
+type DumpTxOutSetResult struct {
+	CoinsWritten uint64 `json:"coins_written"`
+	BaseHash     string `json:"base_hash"`
+	BaseHeight   int    `json:"base_height"`
+	Path         string `json:"path"`
+	TxOutSetHash string `json:"txoutset_hash"`
+	ChainTxCount int32  `json:"nchaintx"`
+}
+
+// ScrubBlockFilesEntry models a corrupt record returned by the
+// scrubblockfiles command.
+type ScrubBlockFilesEntry struct {
+	File        int32  `json:"file"`
+	Pos         uint32 `json:"pos"`
+	Type        string `json:"type"`
+	BlockHash   string `json:"blockhash,omitempty"`
+	Error       string `json:"error"`
+	Quarantined bool   `json:"quarantined"`
+}
+
+// ScrubBlockFilesResult models the data from the scrubblockfiles command.
+type ScrubBlockFilesResult struct {
+	Files        int                    `json:"files"`
+	Blocks       int                    `json:"blocks"`
+	Undos        int                    `json:"undos"`
+	Unreferenced int                    `json:"unreferenced"`
+	Corrupt      []ScrubBlockFilesEntry `json:"corrupt"`
+	Compacted    []int32                `json:"compacted"`
+	Reclaimed    uint64                 `json:"reclaimed"`
+}
+
 // GetNetTotalsResult models the data returned from the getnettotals command.
 type GetNetTotalsResult struct {
 	TotalBytesRecv uint64       `json:"totalbytesrecv"`
@@ -454,6 +532,25 @@ type Vout struct {
 	Value        float64            `json:"value"`
 	N            uint32             `json:"n"`
 	ScriptPubKey ScriptPubKeyResult `json:"scriptPubKey"`
+	TokenData    *TokenDataResult   `json:"tokenData,omitempty"`
+	// The spending input is only set when the spent index is enabled.
+	SpentTxID   string  `json:"spentTxId,omitempty"`
+	SpentIndex  *uint32 `json:"spentIndex,omitempty"`
+	SpentHeight int32   `json:"spentHeight,omitempty"`
+}
+
+// TokenDataResult models the CashTokens carried by an output. The amount is a
+// string since it may not fit in a double.
+type TokenDataResult struct {
+	Category string          `json:"category"`
+	Amount   string          `json:"amount"`
+	NFT      *TokenNFTResult `json:"nft,omitempty"`
+}
+
+// TokenNFTResult models the non-fungible token carried by an output.
+type TokenNFTResult struct {
+	Capability string `json:"capability"`
+	Commitment string `json:"commitment"`
 }
 
 // GetMiningInfoResult models the data from the getmininginfo command.
@@ -553,6 +650,50 @@ type ValidateAddressChainResult struct {
 	HDMasterKeyID string `json:"hdmasterkeyid,omitempty"`
 }
 
+// GetIndexInfoResult models the sync state of one index returned by the
+// getindexinfo command.
+type GetIndexInfoResult struct {
+	Synced          bool  `json:"synced"`
+	BestBlockHeight int32 `json:"best_block_height"`
+}
+
+// GetAddressBalanceResult models the data returned by the getaddressbalance
+// command, in satoshis.
+type GetAddressBalanceResult struct {
+	Balance  int64 `json:"balance"`
+	Received int64 `json:"received"`
+}
+
+// GetAddressUtxosResult models an unspent output returned by the
+// getaddressutxos command.
+type GetAddressUtxosResult struct {
+	Address     string `json:"address"`
+	TxID        string `json:"txid"`
+	OutputIndex uint32 `json:"outputIndex"`
+	Script      string `json:"script"`
+	Satoshis    int64  `json:"satoshis"`
+	Height      int32  `json:"height"`
+}
+
+// GetAddressMempoolResult models a balance change returned by the
+// getaddressmempool command. The previous output is only set for the spends.
+type GetAddressMempoolResult struct {
+	Address   string  `json:"address"`
+	TxID      string  `json:"txid"`
+	Index     uint32  `json:"index"`
+	Satoshis  int64   `json:"satoshis"`
+	Timestamp int64   `json:"timestamp"`
+	PrevTxID  string  `json:"prevtxid,omitempty"`
+	PrevOut   *uint32 `json:"prevout,omitempty"`
+}
+
+// GetSpentInfoResult models the input returned by the getspentinfo command.
+type GetSpentInfoResult struct {
+	TxID   string `json:"txid"`
+	Index  uint32 `json:"index"`
+	Height int32  `json:"height"`
+}
+
 type GetMempoolEntryRelativeInfoVerbose struct {
 	Size             int      `json:"size"`
 	Fee              float64  `json:"fee"`
@@ -66,6 +66,28 @@ func TestChainSvrCustomResults(t *testing.T) {
 			},
 			expected: `{"txid":"123","vout":1,"scriptSig":{"asm":"0","hex":"00"},"prevOut":{"addresses":["addr1"],"value":0},"sequence":4294967295}`,
 		},
+		{
+			name: "vout marshal without token data",
+			result: &Vout{
+				Value:        1,
+				ScriptPubKey: ScriptPubKeyResult{Asm: "OP_TRUE", Hex: "51", Type: "nonstandard"},
+			},
+			expected: `{"value":1,"n":0,"scriptPubKey":{"asm":"OP_TRUE","hex":"51","type":"nonstandard"}}`,
+		},
+		{
+			name: "vout marshal with token data",
+			result: &Vout{
+				Value:        1,
+				ScriptPubKey: ScriptPubKeyResult{Asm: "OP_TRUE", Hex: "51", Type: "nonstandard"},
+				TokenData: &TokenDataResult{
+					Category: "aa",
+					Amount:   "9223372036854775807",
+					NFT:      &TokenNFTResult{Capability: "minting", Commitment: "cc"},
+				},
+			},
+			expected: `{"value":1,"n":0,"scriptPubKey":{"asm":"OP_TRUE","hex":"51","type":"nonstandard"},` +
+				`"tokenData":{"category":"aa","amount":"9223372036854775807","nft":{"capability":"minting","commitment":"cc"}}}`,
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -24,6 +24,7 @@ type helpDescInfo struct {
 
 const (
 	DebugCmd           = ""
+	AddressIndexCmd    = "AddressIndex"
 	BlockChainCmd      = "BlockChain"
 	ControlCmd         = "Control"
 	GeneratingCmd      = "Generating"
@@ -41,6 +42,7 @@ var allMethodHelp = map[string]helpDescInfo{
 	"getblock":              {BlockChainCmd, getblockDesc},
 	"getblockhash":          {BlockChainCmd, getblockhashDesc},
 	"getblockheader":        {BlockChainCmd, getblockheader},
+	"getblockfilter":        {BlockChainCmd, getblockfilterDesc},
 	"getchaintips":          {BlockChainCmd, getchaintipsDesc},
 	"getchaintxstats":       {BlockChainCmd, getchaintxstatsDesc},
 	"getdifficulty":         {BlockChainCmd, getdifficultyDesc},
@@ -50,8 +52,13 @@ var allMethodHelp = map[string]helpDescInfo{
 	"getmempoolinfo":        {BlockChainCmd, getmempoolinfoDesc},
 	"getrawmempool":         {BlockChainCmd, getrawmempoolDesc},
 	"gettxout":              {BlockChainCmd, gettxoutDesc},
+	"getspentinfo":          {BlockChainCmd, getspentinfoDesc},
+	"getdsproof":            {BlockChainCmd, getdsproofDesc},
+	"getdsprooflist":        {BlockChainCmd, getdsprooflistDesc},
 	"gettxoutsetinfo":       {BlockChainCmd, gettxoutsetinfoDesc},
 	"pruneblockchain":       {BlockChainCmd, pruneblockchainDesc},
+	"dumptxoutset":          {BlockChainCmd, dumptxoutsetDesc},
+	"scrubblockfiles":       {BlockChainCmd, scrubblockfilesDesc},
 	"verifychain":           {BlockChainCmd, verifychainDesc},
 	"preciousblock":         {BlockChainCmd, preciousblockDesc},
 	"gettxoutproof":         {BlockChainCmd, gettxoutproofDesc},
@@ -92,6 +99,12 @@ var allMethodHelp = map[string]helpDescInfo{
 
 	"validateaddress": {UtilCmd, validateaddressDesc},
 	"createmultisig":  {UtilCmd, createmultisigDesc},
+	"getindexinfo":    {UtilCmd, getindexinfoDesc},
+
+	"getaddresstxids":   {AddressIndexCmd, getaddresstxidsDesc},
+	"getaddressbalance": {AddressIndexCmd, getaddressbalanceDesc},
+	"getaddressutxos":   {AddressIndexCmd, getaddressutxosDesc},
+	"getaddressmempool": {AddressIndexCmd, getaddressmempoolDesc},
 
 	"getexcessiveblock":  {DebugCmd, getexcessiveblockDesc},
 	"setexcessiveblock":  {DebugCmd, setexcessiveblockDesc},
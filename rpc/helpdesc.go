@@ -100,7 +100,21 @@ var (
 		"        \"since\": xx            (numeric) height of the first " +
 		"block to which the status applies\n" +
 		"     }\n" +
-		"  }\n" +
+		"  },\n" +
+		"  \"upgrades\": [             (array) status of the network " +
+		"upgrades\n" +
+		"     {\n" +
+		"        \"name\": \"xxxx\",      (string) name of the upgrade\n" +
+		"        \"activationheight\": xx, (numeric) height of the first " +
+		"block following the upgrade rules (only for upgrades activated " +
+		"by height)\n" +
+		"        \"activationtime\": xx, (numeric) median time past of the " +
+		"previous block from which the upgrade rules apply (only for " +
+		"upgrades activated by time)\n" +
+		"        \"status\": \"xxxx\"     (string) \"active\" if the next " +
+		"block follows the upgrade rules, \"pending\" otherwise\n" +
+		"     }, ...\n" +
+		"  ]\n" +
 		"}\n" +
 		"\nExamples:\n" +
 		HelpExampleCli("getblockchaininfo") +
@@ -220,6 +234,73 @@ var (
 		HelpExampleCli("getblockheader", "\"00000000c937983704a73af28acdec37b049d214adbda81d7e2a3dd146f6ed09\"") +
 		HelpExampleRPC("getblockheader", "\"00000000c937983704a73af28acdec37b049d214adbda81d7e2a3dd146f6ed09\"")
 
+	getblockfilterDesc = "getblockfilter \"blockhash\" ( \"filtertype\" )\n" +
+		"\nRetrieve a BIP 157 content filter for a particular block " +
+		"(requires -blockfilterindex).\n" +
+		"\nArguments:\n" +
+		"1. \"blockhash\"     (string, required) The hash of the block\n" +
+		"2. \"filtertype\"    (string, optional, default=basic) The type name " +
+		"of the filter\n" +
+		"\nResult:\n" +
+		"{\n" +
+		"  \"filter\" : (string) the hex-encoded filter data\n" +
+		"  \"header\" : (string) the hex-encoded filter header\n" +
+		"}\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("getblockfilter", "\"00000000c937983704a73af28acdec37b049d214adbda81d7e2a3dd146f6ed09\"", "\"basic\"") +
+		HelpExampleRPC("getblockfilter", "\"00000000c937983704a73af28acdec37b049d214adbda81d7e2a3dd146f6ed09\"", "\"basic\"")
+
+	getdsproofDesc = "getdsproof \"hash\" ( verbose )\n" +
+		"\nReturns the double spend proof of a mempool transaction.\n" +
+		"\nArguments:\n" +
+		"1. \"hash\"        (string, required) The hash of the proof, or of the double spent " +
+		"mempool transaction\n" +
+		"2. verbose         (boolean, optional, default=true) true for a json object, false " +
+		"for the hex encoded proof\n" +
+		"\nResult (for verbose=true):\n" +
+		"{\n" +
+		"  \"hex\" : \"hex\",            (string) The hex encoded proof\n" +
+		"  \"dspid\" : \"hash\",         (string) The hash of the proof\n" +
+		"  \"txid\" : \"hash\",          (string) The mempool transaction spending the coin\n" +
+		"  \"prevtxid\" : \"hash\",      (string) The transaction of the double spent coin\n" +
+		"  \"prevout\" : n,              (numeric) The output index of the double spent coin\n" +
+		"  \"spenders\" : [            (array) The two spenders of the coin\n" +
+		"    {\n" +
+		"      \"txversion\" : n,        (numeric) The version of the transaction\n" +
+		"      \"sequence\" : n,         (numeric) The sequence of the input\n" +
+		"      \"locktime\" : n,         (numeric) The lock time of the transaction\n" +
+		"      \"hashprevoutputs\" : \"hash\", (string) The hash of the previous outputs\n" +
+		"      \"hashsequence\" : \"hash\",    (string) The hash of the sequences\n" +
+		"      \"hashoutputs\" : \"hash\",     (string) The hash of the outputs\n" +
+		"      \"pushdata\" : [\"hex\"]        (array) The signature\n" +
+		"    }, ...\n" +
+		"  ]\n" +
+		"}\n" +
+		"\nResult (for verbose=false):\n" +
+		"\"data\"             (string) The hex encoded proof\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("getdsproof", "\"mydspid\"") +
+		HelpExampleRPC("getdsproof", "\"mydspid\"")
+
+	getdsprooflistDesc = "getdsprooflist ( verbose )\n" +
+		"\nReturns the double spend proofs of the mempool transactions.\n" +
+		"\nArguments:\n" +
+		"1. verbose         (boolean, optional, default=false) true for json objects, false " +
+		"for the hashes of the proofs\n" +
+		"\nResult (for verbose=false):\n" +
+		"[\n" +
+		"  \"dspid\"          (string) The hash of a proof\n" +
+		"  ,...\n" +
+		"]\n" +
+		"\nResult (for verbose=true):\n" +
+		"[\n" +
+		"  {...}            (json object) The proof, as returned by getdsproof\n" +
+		"  ,...\n" +
+		"]\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("getdsprooflist", "true") +
+		HelpExampleRPC("getdsprooflist", "true")
+
 	getchaintipsDesc = "getchaintips\n" +
 		"Return information about all known tips in the block tree," +
 		" including the main chain as well as orphaned branches.\n" +
@@ -544,9 +625,32 @@ var (
 		"\nAs a json rpc call\n" +
 		HelpExampleRPC("gettxout", "\"txid\"", "1")
 
-	gettxoutsetinfoDesc = "gettxoutsetinfo\n" +
+	getspentinfoDesc = "getspentinfo {\"txid\": \"txid\", \"index\": n}\n" +
+		"\nReturns the input of the active chain which spent an output " +
+		"(requires -spentindex).\n" +
+		"\nArguments:\n" +
+		"{\n" +
+		"  \"txid\"   (string, required) The hex string of the txid\n" +
+		"  \"index\"  (numeric, required) The output index\n" +
+		"}\n" +
+		"\nResult:\n" +
+		"{\n" +
+		"  \"txid\"    (string) The spending txid\n" +
+		"  \"index\"   (numeric) The spending input index\n" +
+		"  \"height\"  (numeric) The height of the spending block\n" +
+		"}\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("getspentinfo", "'{\"txid\": \"0437cd7f8525ceed2324359c2d0ba26006d92d856a9c20fa0241106ee5a597c9\", \"index\": 0}'") +
+		HelpExampleRPC("getspentinfo", "{\"txid\": \"0437cd7f8525ceed2324359c2d0ba26006d92d856a9c20fa0241106ee5a597c9\", \"index\": 0}")
+
+	gettxoutsetinfoDesc = "gettxoutsetinfo ( \"hash_type\" )\n" +
 		"\nReturns statistics about the unspent transaction output set.\n" +
-		"Note this call may take some time.\n" +
+		"Note this call may take some time when hash_type is hash_serialized.\n" +
+		"\nArguments:\n" +
+		"1. \"hash_type\"     (string, optional, default=ecmh) " +
+		"Which UTXO set hash should be calculated. Options: 'ecmh', " +
+		"'hash_serialized'. With 'ecmh' only the height, bestblock and ecmh are " +
+		"returned, without going through the whole set.\n" +
 		"\nResult:\n" +
 		"{\n" +
 		"  \"height\":n,     (numeric) The current block height (index)\n" +
@@ -557,12 +661,15 @@ var (
 		"  \"bogosize\": n,          (numeric) A database-independent " +
 		"metric for UTXO set size\n" +
 		"  \"hash_serialized\": \"hash\",   (string) The serialized hash\n" +
+		"  \"ecmh\": \"hash\",   (string) The elliptic curve multiset hash of " +
+		"the set, maintained as blocks are connected\n" +
 		"  \"disk_size\": n,         (numeric) The estimated size of the " +
 		"chainstate on disk\n" +
 		"  \"total_amount\": x.xxx          (numeric) The total amount\n" +
 		"}\n" +
 		"\nExamples:\n" +
 		HelpExampleCli("gettxoutsetinfo") +
+		HelpExampleCli("gettxoutsetinfo", "\"hash_serialized\"") +
 		HelpExampleRPC("gettxoutsetinfo")
 
 	pruneblockchainDesc = "pruneblockchain\n" +
@@ -577,6 +684,71 @@ var (
 		HelpExampleCli("pruneblockchain", "1000") +
 		HelpExampleRPC("pruneblockchain", "1000")
 
+	dumptxoutsetDesc = "dumptxoutset \"path\"\n" +
+		"\nWrite the serialized UTXO set to disk, along with the headers " +
+		"of the active chain.\n" +
+		"The snapshot can bootstrap a node with -loadsnapshot once its " +
+		"base block is committed in the chain params.\n" +
+		"\nArguments:\n" +
+		"1. \"path\"    (string, required) Path to the output file. If " +
+		"relative, will be prefixed by datadir.\n" +
+		"\nResult:\n" +
+		"{\n" +
+		"  \"coins_written\": n,       (numeric) The number of coins written " +
+		"in the snapshot\n" +
+		"  \"base_hash\": \"hex\",      (string) The hash of the base block " +
+		"of the snapshot\n" +
+		"  \"base_height\": n,         (numeric) The height of the base " +
+		"block of the snapshot\n" +
+		"  \"path\": \"path\",          (string) The absolute path that " +
+		"the snapshot was written to\n" +
+		"  \"txoutset_hash\": \"hash\", (string) The hash_serialized of " +
+		"the UTXO set at the base block\n" +
+		"  \"nchaintx\": n             (numeric) The number of transactions " +
+		"in the chain up to and including the base block\n" +
+		"}\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("dumptxoutset", "utxo.dat") +
+		HelpExampleRPC("dumptxoutset", "utxo.dat")
+
+	scrubblockfilesDesc = "scrubblockfiles ( quarantine compact )\n" +
+		"\nVerifies the blocks and undo data stored in the blk/rev files " +
+		"against the block index.\n" +
+		"Blocks are checked for their size, proof of work and hash, undo " +
+		"data for their size and checksum.\n" +
+		"\nArguments:\n" +
+		"1. quarantine  (boolean, optional, default=false) Copy the corrupt " +
+		"records to blocks/quarantine and treat their blocks as pruned\n" +
+		"2. compact     (boolean, optional, default=false) Rewrite the " +
+		"files holding blocks no longer referenced by the block index\n" +
+		"\nResult:\n" +
+		"{\n" +
+		"  \"files\": n,          (numeric) The number of files verified\n" +
+		"  \"blocks\": n,         (numeric) The number of valid blocks\n" +
+		"  \"undos\": n,          (numeric) The number of valid undo records\n" +
+		"  \"unreferenced\": n,   (numeric) The number of valid blocks not " +
+		"referenced by the block index\n" +
+		"  \"corrupt\": [         (array) The corrupt records\n" +
+		"    {\n" +
+		"      \"file\": n,       (numeric) The file number\n" +
+		"      \"pos\": n,        (numeric) The position in the file\n" +
+		"      \"type\": \"xxx\",   (string) block or undo\n" +
+		"      \"blockhash\": \"hash\", (string) The block referencing " +
+		"the record, if any\n" +
+		"      \"error\": \"xxx\",  (string) The verification error\n" +
+		"      \"quarantined\": true|false (boolean) Whether the record " +
+		"was quarantined\n" +
+		"    }\n" +
+		"    ,...\n" +
+		"  ],\n" +
+		"  \"compacted\": [n,...], (array) The numbers of the rewritten files\n" +
+		"  \"reclaimed\": n       (numeric) The bytes freed by the compaction\n" +
+		"}\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("scrubblockfiles") +
+		HelpExampleCli("scrubblockfiles", "true", "true") +
+		HelpExampleRPC("scrubblockfiles", "true", "true")
+
 	verifychainDesc = "verifychain ( checklevel nblocks )\n" +
 		"\nVerifies blockchain database.\n" +
 		"\nArguments:\n" +
@@ -1132,6 +1304,8 @@ var (
 		"by the -bantime startup argument)\n" +
 		"4. \"absolute\"     (boolean, optional) If set, the bantime must " +
 		"be a absolute timestamp in seconds since epoch (Jan 1 1970 GMT)\n" +
+		"\nThe ban is created now with the reason 'manually added', and is " +
+		"kept across restarts in the data directory until it expires.\n" +
 		"\nExamples:\n" +
 		HelpExampleCli("setban", "\"192.168.0.6\"", "\"add\"", "86400") +
 		HelpExampleCli("setban", "\"192.168.0.0/24\"", "\"add\"") +
@@ -1139,12 +1313,23 @@ var (
 
 	listbannedDesc = "listbanned\n" +
 		"\nList all banned IPs/Subnets.\n" +
+		"\nResult:\n" +
+		"[\n" +
+		"  {\n" +
+		"    \"address\": \"xxx\",        (string) The banned IP/Subnet\n" +
+		"    \"banned_until\": xxx,       (numeric) The end of the ban, in seconds since epoch (Jan 1 1970 GMT)\n" +
+		"    \"ban_created\": xxx,        (numeric) The creation time of the ban, in seconds since epoch (Jan 1 1970 GMT)\n" +
+		"    \"ban_reason\": \"xxx\"      (string) The reason of the ban, 'node misbehaving' or 'manually added'\n" +
+		"  }\n" +
+		"  ,...\n" +
+		"]\n" +
 		"\nExamples:\n" +
 		HelpExampleCli("listbanned") +
 		HelpExampleRPC("listbanned")
 
 	clearbannedDesc = "clearbanned\n" +
-		"\nClear all banned IPs.\n" +
+		"\nClear all banned IPs, including the bans kept in the data " +
+		"directory.\n" +
 		"\nExamples:\n" +
 		HelpExampleCli("clearbanned") +
 		HelpExampleRPC("clearbanned")
@@ -1215,6 +1400,10 @@ var (
 		"           ,...\n" +
 		"         ]\n" +
 		"       }\n" +
+		"       \"spentTxId\" : \"id\",         (string) The spending txid (requires " +
+		"-spentindex)\n" +
+		"       \"spentIndex\" : n,           (numeric) The spending input index\n" +
+		"       \"spentHeight\" : n,          (numeric) The spending block height\n" +
 		"     }\n" +
 		"     ,...\n" +
 		"  ],\n" +
@@ -1571,6 +1760,113 @@ var (
 		HelpExampleCli("validateaddress", "\"1PSSGeFHDnKNxiEyFrD1wcEaHr9hrQDDWc\"") +
 		HelpExampleRPC("validateaddress", "\"1PSSGeFHDnKNxiEyFrD1wcEaHr9hrQDDWc\"")
 
+	getindexinfoDesc = "getindexinfo ( \"index_name\" )\n" +
+		"\nReturns the status of one or all available indices currently " +
+		"running in the node.\n" +
+		"\nArguments:\n" +
+		"1. \"index_name\"    (string, optional) Filter results for an " +
+		"index with a specific name.\n" +
+		"\nResult:\n" +
+		"{\n" +
+		"  \"name\" : {                  (json object) The name of the " +
+		"index\n" +
+		"    \"synced\" : true|false,    (boolean) Whether the index is " +
+		"synced or not\n" +
+		"    \"best_block_height\" : n   (numeric) The block height to " +
+		"which the index is synced\n" +
+		"  }\n" +
+		"}\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("getindexinfo") +
+		HelpExampleRPC("getindexinfo") +
+		HelpExampleCli("getindexinfo", "txindex") +
+		HelpExampleRPC("getindexinfo", "\"txindex\"")
+
+	getaddresstxidsDesc = "getaddresstxids {\"addresses\": [\"address\",...], \"start\": n, \"end\": n}\n" +
+		"\nReturns the txids of the confirmed transactions paying to or " +
+		"spending from the addresses (requires -addressindex).\n" +
+		"\nArguments:\n" +
+		"{\n" +
+		"  \"addresses\"  (array, required) The cashaddr or legacy addresses\n" +
+		"  \"start\"      (numeric, optional) The first block height\n" +
+		"  \"end\"        (numeric, optional) The last block height\n" +
+		"}\n" +
+		"\nResult:\n" +
+		"[\n" +
+		"  \"transactionid\"  (string) The transaction id, sorted by " +
+		"block height\n" +
+		"  ,...\n" +
+		"]\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("getaddresstxids", "'{\"addresses\": [\"12c6DSiU4Rq3P4ZxziKxzrGXFp9fQm9cQp\"]}'") +
+		HelpExampleRPC("getaddresstxids", "{\"addresses\": [\"12c6DSiU4Rq3P4ZxziKxzrGXFp9fQm9cQp\"]}")
+
+	getaddressbalanceDesc = "getaddressbalance {\"addresses\": [\"address\",...]}\n" +
+		"\nReturns the confirmed balance of the addresses (requires " +
+		"-addressindex).\n" +
+		"\nArguments:\n" +
+		"{\n" +
+		"  \"addresses\"  (array, required) The cashaddr or legacy addresses\n" +
+		"}\n" +
+		"\nResult:\n" +
+		"{\n" +
+		"  \"balance\"   (numeric) The current balance in satoshis\n" +
+		"  \"received\"  (numeric) The total number of satoshis received " +
+		"(including change)\n" +
+		"}\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("getaddressbalance", "'{\"addresses\": [\"12c6DSiU4Rq3P4ZxziKxzrGXFp9fQm9cQp\"]}'") +
+		HelpExampleRPC("getaddressbalance", "{\"addresses\": [\"12c6DSiU4Rq3P4ZxziKxzrGXFp9fQm9cQp\"]}")
+
+	getaddressutxosDesc = "getaddressutxos {\"addresses\": [\"address\",...]}\n" +
+		"\nReturns the confirmed unspent outputs paying to the addresses " +
+		"(requires -addressindex).\n" +
+		"\nArguments:\n" +
+		"{\n" +
+		"  \"addresses\"  (array, required) The cashaddr or legacy addresses\n" +
+		"}\n" +
+		"\nResult:\n" +
+		"[\n" +
+		"  {\n" +
+		"    \"address\"      (string) The address\n" +
+		"    \"txid\"         (string) The output txid\n" +
+		"    \"outputIndex\"  (numeric) The output index\n" +
+		"    \"script\"       (string) The script hex-encoded\n" +
+		"    \"satoshis\"     (numeric) The number of satoshis of the output\n" +
+		"    \"height\"       (numeric) The block height\n" +
+		"  }\n" +
+		"  ,...\n" +
+		"]\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("getaddressutxos", "'{\"addresses\": [\"12c6DSiU4Rq3P4ZxziKxzrGXFp9fQm9cQp\"]}'") +
+		HelpExampleRPC("getaddressutxos", "{\"addresses\": [\"12c6DSiU4Rq3P4ZxziKxzrGXFp9fQm9cQp\"]}")
+
+	getaddressmempoolDesc = "getaddressmempool {\"addresses\": [\"address\",...]}\n" +
+		"\nReturns the balance changes of the addresses made by the mempool " +
+		"transactions (requires -addressindex).\n" +
+		"\nArguments:\n" +
+		"{\n" +
+		"  \"addresses\"  (array, required) The cashaddr or legacy addresses\n" +
+		"}\n" +
+		"\nResult:\n" +
+		"[\n" +
+		"  {\n" +
+		"    \"address\"    (string) The address\n" +
+		"    \"txid\"       (string) The related txid\n" +
+		"    \"index\"      (numeric) The related input or output index\n" +
+		"    \"satoshis\"   (numeric) The difference of satoshis\n" +
+		"    \"timestamp\"  (numeric) The time the transaction entered the " +
+		"mempool (seconds)\n" +
+		"    \"prevtxid\"   (string) The previous txid (if spending)\n" +
+		"    \"prevout\"    (numeric) The previous transaction output index " +
+		"(if spending)\n" +
+		"  }\n" +
+		"  ,...\n" +
+		"]\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("getaddressmempool", "'{\"addresses\": [\"12c6DSiU4Rq3P4ZxziKxzrGXFp9fQm9cQp\"]}'") +
+		HelpExampleRPC("getaddressmempool", "{\"addresses\": [\"12c6DSiU4Rq3P4ZxziKxzrGXFp9fQm9cQp\"]}")
+
 	createmultisigDesc = "createmultisig nrequired [\"key\",...]\n" +
 		"\nCreates a multi-signature address with n signature of m keys " +
 		"required.\n" +
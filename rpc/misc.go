@@ -6,14 +6,17 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/copernet/copernicus/conf"
 	"github.com/copernet/copernicus/crypto"
+	"github.com/copernet/copernicus/logic/lindex"
 	"github.com/copernet/copernicus/logic/lwallet"
 	"github.com/copernet/copernicus/model"
 	"github.com/copernet/copernicus/model/chain"
+	"github.com/copernet/copernicus/model/mempool"
 	"github.com/copernet/copernicus/net/server"
 	"github.com/copernet/copernicus/net/wire"
 	"github.com/copernet/copernicus/rpc/btcjson"
@@ -34,6 +37,11 @@ const (
 var miscHandlers = map[string]commandHandler{
 	"getinfo":                handleGetInfo,
 	"validateaddress":        handleValidateAddress,
+	"getindexinfo":           handleGetIndexInfo,
+	"getaddresstxids":        handleGetAddressTxIds,
+	"getaddressbalance":      handleGetAddressBalance,
+	"getaddressutxos":        handleGetAddressUtxos,
+	"getaddressmempool":      handleGetAddressMempool,
 	"createmultisig":         handleCreatemultisig,
 	"verifymessage":          handleVerifyMessage,
 	"signmessagewithprivkey": handleSignMessageWithPrivkey,
@@ -88,6 +96,183 @@ func handleGetInfo(s *Server, cmd interface{}, closeChan <-chan struct{}) (inter
 	return ret, nil
 }
 
+// handleGetIndexInfo implements the getindexinfo command.
+func handleGetIndexInfo(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetIndexInfoCmd)
+
+	result := make(map[string]*btcjson.GetIndexInfoResult)
+	for name, info := range lindex.GetIndexInfo() {
+		if c.IndexName != nil && *c.IndexName != name {
+			continue
+		}
+		result[name] = &btcjson.GetIndexInfoResult{
+			Synced:          info.Synced,
+			BestBlockHeight: info.BestBlockHeight,
+		}
+	}
+	return result, nil
+}
+
+// addressScriptHashes returns the keys of the addresses in the address
+// index, in the order of the addresses.
+func addressScriptHashes(addresses []string) ([]util.Hash, error) {
+	if lindex.GetAddrIndex() == nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCMisc, "Address index not enabled, restart with -addressindex")
+	}
+	if len(addresses) == 0 {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter, "No addresses given")
+	}
+	scriptHashes := make([]util.Hash, 0, len(addresses))
+	for _, address := range addresses {
+		scriptPubKey, rpcErr := getStandardScriptPubKey(address, nil)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		scriptHashes = append(scriptHashes, lindex.ScriptHash(scriptPubKey))
+	}
+	return scriptHashes, nil
+}
+
+// handleGetAddressTxIds implements the getaddresstxids command.
+func handleGetAddressTxIds(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressTxIdsCmd)
+
+	scriptHashes, err := addressScriptHashes(c.Request.Addresses)
+	if err != nil {
+		return nil, err
+	}
+	start, end := c.Request.Start, c.Request.End
+	if end <= 0 {
+		end = -1
+	} else if end < start {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter, "End value is expected to be greater than start")
+	}
+
+	type heightTx struct {
+		height int32
+		txid   util.Hash
+	}
+	seen := make(map[util.Hash]struct{})
+	var txs []heightTx
+	for i := range scriptHashes {
+		entries, err := lindex.GetAddrIndex().GetHistory(&scriptHashes[i], start, end)
+		if err != nil {
+			return nil, btcjson.NewRPCError(btcjson.ErrRPCDatabase, "Unable to read the address index: "+err.Error())
+		}
+		for _, entry := range entries {
+			if _, ok := seen[entry.TxHash]; ok {
+				continue
+			}
+			seen[entry.TxHash] = struct{}{}
+			txs = append(txs, heightTx{height: entry.Height, txid: entry.TxHash})
+		}
+	}
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].height < txs[j].height
+	})
+
+	result := make([]string, 0, len(txs))
+	for _, t := range txs {
+		result = append(result, t.txid.String())
+	}
+	return result, nil
+}
+
+// handleGetAddressBalance implements the getaddressbalance command.
+func handleGetAddressBalance(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressBalanceCmd)
+
+	scriptHashes, err := addressScriptHashes(c.Request.Addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &btcjson.GetAddressBalanceResult{}
+	for i := range scriptHashes {
+		entries, err := lindex.GetAddrIndex().GetHistory(&scriptHashes[i], 0, -1)
+		if err != nil {
+			return nil, btcjson.NewRPCError(btcjson.ErrRPCDatabase, "Unable to read the address index: "+err.Error())
+		}
+		for _, entry := range entries {
+			if entry.Amount > 0 {
+				result.Received += entry.Amount
+			}
+			result.Balance += entry.Amount
+		}
+	}
+	return result, nil
+}
+
+// handleGetAddressUtxos implements the getaddressutxos command.
+func handleGetAddressUtxos(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressUtxosCmd)
+
+	scriptHashes, err := addressScriptHashes(c.Request.Addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*btcjson.GetAddressUtxosResult, 0)
+	for i := range scriptHashes {
+		entries, err := lindex.GetAddrIndex().GetUnspent(&scriptHashes[i])
+		if err != nil {
+			return nil, btcjson.NewRPCError(btcjson.ErrRPCDatabase, "Unable to read the address index: "+err.Error())
+		}
+		for _, entry := range entries {
+			result = append(result, &btcjson.GetAddressUtxosResult{
+				Address:     c.Request.Addresses[i],
+				TxID:        entry.TxHash.String(),
+				OutputIndex: entry.Index,
+				Script:      hex.EncodeToString(entry.ScriptPubKey),
+				Satoshis:    entry.Amount,
+				Height:      entry.Height,
+			})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Height < result[j].Height
+	})
+	return result, nil
+}
+
+// handleGetAddressMempool implements the getaddressmempool command.
+func handleGetAddressMempool(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressMempoolCmd)
+
+	scriptHashes, err := addressScriptHashes(c.Request.Addresses)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make(map[util.Hash]string, len(scriptHashes))
+	for i := range scriptHashes {
+		addresses[scriptHashes[i]] = c.Request.Addresses[i]
+	}
+
+	deltas := mempool.GetInstance().GetAddressDeltas(scriptHashes)
+	sort.SliceStable(deltas, func(i, j int) bool {
+		return deltas[i].Time < deltas[j].Time
+	})
+
+	result := make([]*btcjson.GetAddressMempoolResult, 0, len(deltas))
+	for i := range deltas {
+		delta := &deltas[i]
+		item := &btcjson.GetAddressMempoolResult{
+			Address:   addresses[delta.ScriptHash],
+			TxID:      delta.TxHash.String(),
+			Index:     delta.Index,
+			Satoshis:  delta.Amount,
+			Timestamp: delta.Time,
+		}
+		if delta.Spending {
+			prevOut := delta.PrevOut.Index
+			item.PrevTxID = delta.PrevOut.Hash.String()
+			item.PrevOut = &prevOut
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
 // handleValidateAddress implements the validateaddress command.
 func handleValidateAddress(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.ValidateAddressCmd)
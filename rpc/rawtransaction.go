@@ -13,6 +13,7 @@ import (
 	"github.com/copernet/copernicus/crypto"
 	"github.com/copernet/copernicus/errcode"
 	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/logic/lindex"
 	"github.com/copernet/copernicus/logic/lmempool"
 	"github.com/copernet/copernicus/logic/lmerkleblock"
 	"github.com/copernet/copernicus/logic/ltx"
@@ -29,6 +30,8 @@ import (
 	"github.com/copernet/copernicus/model/utxo"
 	"github.com/copernet/copernicus/net/server"
 	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/persist"
+	"github.com/copernet/copernicus/persist/blkdb"
 	"github.com/copernet/copernicus/persist/disk"
 	"github.com/copernet/copernicus/rpc/btcjson"
 	"github.com/copernet/copernicus/util"
@@ -98,6 +101,11 @@ func getTxRawResult(tx *tx.Tx, hashBlock *util.Hash, strHex string) (*btcjson.Tx
 		Vin:      getVinList(tx),
 		Vout:     getVoutList(tx),
 	}
+	if persist.SpentIndex {
+		if rpcErr := addSpentInfo(hash, txReply.Vout); rpcErr != nil {
+			return nil, rpcErr
+		}
+	}
 
 	if hashBlock != nil && !hashBlock.IsNull() {
 		txReply.BlockHash = hashBlock.String()
@@ -115,6 +123,25 @@ func getTxRawResult(tx *tx.Tx, hashBlock *util.Hash, strHex string) (*btcjson.Tx
 	return txReply, nil
 }
 
+// addSpentInfo sets the inputs of the active chain which spent the outputs
+// of the transaction txid.
+func addSpentInfo(txid util.Hash, vout []btcjson.Vout) *btcjson.RPCError {
+	for i := range vout {
+		value, err := blkdb.GetInstance().ReadSpentIndex(outpoint.NewOutPoint(txid, vout[i].N))
+		if err != nil {
+			return btcjson.NewRPCError(btcjson.ErrRPCDatabase, "Unable to read the spent index: "+err.Error())
+		}
+		if value == nil {
+			continue
+		}
+		inputIndex := value.InputIndex
+		vout[i].SpentTxID = value.TxHash.String()
+		vout[i].SpentIndex = &inputIndex
+		vout[i].SpentHeight = value.Height
+	}
+	return nil
+}
+
 // getVinList returns a slice of JSON objects for the inputs of the passed transaction.
 func getVinList(tx *tx.Tx) []btcjson.Vin {
 	vinList := make([]btcjson.Vin, len(tx.GetIns()))
@@ -149,11 +176,31 @@ func getVoutList(tx *tx.Tx) []btcjson.Vout {
 			Value:        valueFromAmount(int64(out.GetValue())),
 			N:            uint32(i),
 			ScriptPubKey: *scriptPubKeyJSON,
+			TokenData:    tokenDataToJSON(out.GetTokenData()),
 		}
 	}
 	return voutList
 }
 
+// tokenDataToJSON returns the JSON object for the tokens of an output, or nil
+// if it carries none.
+func tokenDataToJSON(tokenData *txout.TokenData) *btcjson.TokenDataResult {
+	if tokenData == nil {
+		return nil
+	}
+	result := &btcjson.TokenDataResult{
+		Category: tokenData.Category.String(),
+		Amount:   strconv.FormatInt(tokenData.Amount, 10),
+	}
+	if tokenData.HasNFT() {
+		result.NFT = &btcjson.TokenNFTResult{
+			Capability: tokenData.CapabilityString(),
+			Commitment: hex.EncodeToString(tokenData.Commitment),
+		}
+	}
+	return result
+}
+
 func ScriptToAsmStr(s *script.Script, attemptSighashDecode bool) string {
 	var str string
 	for _, scriptOpcodes := range s.ParsedOpCodes {
@@ -264,10 +311,14 @@ func GetTransaction(hash *util.Hash, allowSlow bool) (*tx.Tx, *util.Hash, bool)
 		return entry.Tx, nil, true
 	}
 
-	/* TODO: NOT support txindex yet
-	if chain.GTxIndex {
-		chain.GBlockTree.ReadTxIndex(hash)
-	}*/
+	if txIndex := lindex.GetTxIndex(); txIndex != nil {
+		txn, hashBlock, err := txIndex.FindTx(hash)
+		if err != nil {
+			log.Error("GetTransaction: look up %s in the tx index failed: %v", hash, err)
+		} else if txn != nil {
+			return txn, hashBlock, true
+		}
+	}
 
 	if !allowSlow {
 		return nil, nil, false
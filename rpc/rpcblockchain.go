@@ -5,6 +5,8 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math"
+	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -13,18 +15,21 @@ import (
 	"github.com/copernet/copernicus/conf"
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/logic/lchain"
+	"github.com/copernet/copernicus/logic/lindex"
 	"github.com/copernet/copernicus/logic/lmempool"
 	"github.com/copernet/copernicus/model"
 	"github.com/copernet/copernicus/model/block"
 	"github.com/copernet/copernicus/model/blockindex"
 	"github.com/copernet/copernicus/model/chain"
 	"github.com/copernet/copernicus/model/consensus"
+	"github.com/copernet/copernicus/model/dsproof"
 	"github.com/copernet/copernicus/model/mempool"
 	"github.com/copernet/copernicus/model/outpoint"
 	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/model/utxo"
 	"github.com/copernet/copernicus/model/versionbits"
 	"github.com/copernet/copernicus/persist"
+	"github.com/copernet/copernicus/persist/blkdb"
 	"github.com/copernet/copernicus/persist/disk"
 	"github.com/copernet/copernicus/rpc/btcjson"
 	"github.com/copernet/copernicus/util"
@@ -47,10 +52,16 @@ var blockchainHandlers = map[string]commandHandler{
 	"getmempoolinfo":        handleGetMempoolInfo,        // complete
 	"getrawmempool":         handleGetRawMempool,         // complete
 	"gettxout":              handleGetTxOut,              // complete
+	"getspentinfo":          handleGetSpentInfo,
+	"getblockfilter":        handleGetBlockFilter,
+	"getdsproof":            handleGetDSProof,
+	"getdsprooflist":        handleGetDSProofList,
 	"gettxoutsetinfo":       handleGetTxoutSetInfo,
 	"pruneblockchain":       handlePruneBlockChain, //complete
-	"verifychain":           handleVerifyChain,     //complete
-	"preciousblock":         handlePreciousblock,   //complete
+	"dumptxoutset":          handleDumpTxOutSet,
+	"scrubblockfiles":       handleScrubBlockFiles,
+	"verifychain":           handleVerifyChain,   //complete
+	"preciousblock":         handlePreciousblock, //complete
 
 	/*not shown in help*/
 	"invalidateblock":    handleInvalidateBlock, //complete
@@ -74,7 +85,7 @@ func handleGetBlockChainInfo(s *Server, cmd interface{}, closeChan <-chan struct
 		MedianTime:           tip.GetMedianTimePast(),
 		VerificationProgress: lchain.GuessVerificationProgress(params.TxData(), tip),
 		ChainWork:            fmt.Sprintf("%064x", &tip.ChainWork),
-		Pruned:               false,
+		Pruned:               disk.GetPruneState().PruneMode,
 		Bip9SoftForks:        make(map[string]*btcjson.Bip9SoftForkDescription),
 	}
 
@@ -82,6 +93,10 @@ func handleGetBlockChainInfo(s *Server, cmd interface{}, closeChan <-chan struct
 	// status of soft-forks deployed via the super-majority block
 	// signalling mechanism.
 
+	if chainInfo.Pruned {
+		chainInfo.PruneHeight = getPruneHeight(tip)
+	}
+
 	height := tip.Height
 	chainInfo.SoftForks = version234Status(height, params)
 
@@ -116,9 +131,30 @@ func handleGetBlockChainInfo(s *Server, cmd interface{}, closeChan <-chan struct
 		}
 	}
 
+	chainInfo.Upgrades = upgradesStatus(tip.Height, tip.GetMedianTimePast(), params)
+
 	return chainInfo, nil
 }
 
+// upgradesStatus reports whether the block following the block at height
+// with the median time past medianTimePast follows the rules of each upgrade.
+func upgradesStatus(height int32, medianTimePast int64, params *model.BitcoinParams) []*btcjson.UpgradeDescription {
+	upgrades := make([]*btcjson.UpgradeDescription, 0, len(model.Upgrades))
+	for _, upgrade := range model.Upgrades {
+		status := "pending"
+		if upgrade.IsActive(params, height, medianTimePast) {
+			status = "active"
+		}
+		upgrades = append(upgrades, &btcjson.UpgradeDescription{
+			Name:             upgrade.Name,
+			ActivationHeight: upgrade.ActivationHeight(params),
+			ActivationTime:   upgrade.ActivationTime(params),
+			Status:           status,
+		})
+	}
+	return upgrades
+}
+
 func version234Status(height int32, params *model.BitcoinParams) []*btcjson.SoftForkDescription {
 	return []*btcjson.SoftForkDescription{
 		{
@@ -357,6 +393,127 @@ func handleGetBlockHeader(s *Server, cmd interface{}, closeChan <-chan struct{})
 	return blockHeaderReply, nil
 }
 
+// handleGetBlockFilter implements the getblockfilter command.
+func handleGetBlockFilter(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockFilterCmd)
+
+	filterType := "basic"
+	if c.FilterType != nil {
+		filterType = *c.FilterType
+	}
+	if filterType != "basic" {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidAddressOrKey, "Unknown filtertype")
+	}
+	bfi := lindex.GetBlockFilterIndex()
+	if bfi == nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCMisc, "Index is not enabled for filtertype basic")
+	}
+
+	hash, err := util.GetHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	persist.CsMain.Lock()
+	blockIndex := chain.GetInstance().FindBlockIndex(*hash)
+	persist.CsMain.Unlock()
+	if blockIndex == nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidAddressOrKey, "Block not found")
+	}
+
+	entry, err := bfi.LookupFilter(hash)
+	if err != nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCDatabase, "Unable to read the block filter index: "+err.Error())
+	}
+	if entry == nil {
+		if !lindex.GetIndexInfo()[lindex.BlockFilterIndexName].Synced {
+			return nil, btcjson.NewRPCError(btcjson.ErrRPCMisc,
+				"Filter not found. Block filters are still in the process of being indexed.")
+		}
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCMisc, "Filter not found.")
+	}
+
+	return &btcjson.GetBlockFilterResult{
+		Filter: hex.EncodeToString(entry.Filter),
+		Header: entry.Header.String(),
+	}, nil
+}
+
+// handleGetDSProof implements the getdsproof command.
+func handleGetDSProof(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetDSProofCmd)
+
+	hash, err := util.GetHashFromStr(c.Hash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Hash)
+	}
+	pool := mempool.GetInstance()
+	entry := pool.GetDSProof(*hash)
+	if entry == nil {
+		entry = pool.GetDSProofByTx(*hash)
+	}
+	if entry == nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidAddressOrKey, "dsproof not found")
+	}
+
+	if c.Verbose != nil && !*c.Verbose {
+		return dsproofToHex(entry.Proof), nil
+	}
+	return dsproofToJSON(entry), nil
+}
+
+// handleGetDSProofList implements the getdsprooflist command.
+func handleGetDSProofList(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetDSProofListCmd)
+
+	entries := mempool.GetInstance().GetAllDSProofs()
+	if c.Verbose != nil && *c.Verbose {
+		results := make([]*btcjson.GetDSProofResult, 0, len(entries))
+		for _, entry := range entries {
+			results = append(results, dsproofToJSON(entry))
+		}
+		return results, nil
+	}
+
+	hashes := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		hashes = append(hashes, entry.Proof.GetHash().String())
+	}
+	return hashes, nil
+}
+
+func dsproofToHex(proof *dsproof.DSProof) string {
+	var buf bytes.Buffer
+	proof.Serialize(&buf)
+	return hex.EncodeToString(buf.Bytes())
+}
+
+func dsproofToJSON(entry *mempool.DSProofEntry) *btcjson.GetDSProofResult {
+	proof := entry.Proof
+	result := &btcjson.GetDSProofResult{
+		Hex:      dsproofToHex(proof),
+		DSPID:    proof.GetHash().String(),
+		TxID:     entry.TxHash.String(),
+		PrevTxID: proof.PrevTxID.String(),
+		PrevOut:  proof.PrevOutIndex,
+	}
+	for _, spender := range []*dsproof.Spender{&proof.Spender1, &proof.Spender2} {
+		pushData := make([]string, 0, len(spender.PushData))
+		for _, data := range spender.PushData {
+			pushData = append(pushData, hex.EncodeToString(data))
+		}
+		result.Spenders = append(result.Spenders, btcjson.DSProofSpenderResult{
+			TxVersion:       spender.TxVersion,
+			Sequence:        spender.OutSequence,
+			LockTime:        spender.LockTime,
+			HashPrevOutputs: spender.HashPrevOutputs.String(),
+			HashSequence:    spender.HashSequence.String(),
+			HashOutputs:     spender.HashOutputs.String(),
+			PushData:        pushData,
+		})
+	}
+	return result
+}
+
 func handleGetChainTips(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Idea:  the set of chain tips is chainActive.tip, plus orphan blocks which
 	// do not have another orphan building off of them.
@@ -750,16 +907,68 @@ func handleGetTxOut(s *Server, cmd interface{}, closeChan <-chan struct{}) (inte
 	return txOutReply, nil
 }
 
+// handleGetSpentInfo implements the getspentinfo command.
+func handleGetSpentInfo(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetSpentInfoCmd)
+
+	if !persist.SpentIndex {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCMisc, "Spent index not enabled, restart with -spentindex and -reindex")
+	}
+	hash, err := util.GetHashFromStr(c.Request.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Request.TxID)
+	}
+
+	value, err := blkdb.GetInstance().ReadSpentIndex(outpoint.NewOutPoint(*hash, c.Request.Index))
+	if err != nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCDatabase, "Unable to read the spent index: "+err.Error())
+	}
+	if value == nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidAddressOrKey, "Unable to get spent info")
+	}
+	return &btcjson.GetSpentInfoResult{
+		TxID:   value.TxHash.String(),
+		Index:  value.InputIndex,
+		Height: value.Height,
+	}, nil
+}
+
 func handleGetTxoutSetInfo(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetTxOutSetInfoCmd)
+	hashType := "ecmh"
+	if c.HashType != nil {
+		hashType = *c.HashType
+	}
+	if hashType != "hash_serialized" && hashType != "ecmh" {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: hashType + " is not a valid hash_type",
+		}
+	}
+
 	persist.CsMain.Lock()
 	defer persist.CsMain.Unlock()
 
+	coinsTip := utxo.GetUtxoCacheInstance()
+	commitment := coinsTip.GetCommitment()
+	if hashType == "ecmh" {
+		// The commitment is kept up to date with the tip, no need to look
+		// at the coins. The statistics below need a scan of the whole set,
+		// which is only done when the serialized hash is asked for.
+		tip := chain.GetInstance().Tip()
+		return &btcjson.GetTxOutSetCommitmentResult{
+			Height:    int(tip.Height),
+			BestBlock: tip.GetBlockHash().String(),
+			ECMH:      commitment.Hash().String(),
+		}, nil
+	}
+
 	// Write the chain state to disk, if necessary.
 	if err := disk.FlushStateToDisk(disk.FlushStateAlways, 0); err != nil {
 		return nil, err
 	}
 
-	cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsLruCache).GetCoinsDB()
+	cdb := coinsTip.(*utxo.CoinsViewCache).GetCoinsDB()
 	stat, err := lchain.GetUTXOStats(cdb)
 	if err != nil {
 		return nil, err
@@ -772,70 +981,154 @@ func handleGetTxoutSetInfo(s *Server, cmd interface{}, closeChan <-chan struct{}
 		TxOuts:         stat.TxOutsCount,
 		BogoSize:       stat.BogoSize,
 		HashSerialized: stat.HashSerialized.String(),
+		ECMH:           commitment.Hash().String(),
 		DiskSize:       stat.DiskSize,
 		TotalAmount:    valueFromAmount(stat.Amount),
 	}
 	return reply, nil
 }
 
-func getPrunMode() (bool, error) {
-	/*	pruneArg := util.GetArg("-prune", 0)
-		if pruneArg < 0 {
-			return false, errors.New("Prune cannot be configured with a negative value")
-		}*/ // todo open
-	return true, nil
+func handleDumpTxOutSet(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.DumpTxOutSetCmd)
+	path := c.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(conf.DataDir, path)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: path + " already exists. If you are sure this is what you want, move it out of the way first",
+		}
+	}
+
+	persist.CsMain.Lock()
+	defer persist.CsMain.Unlock()
+
+	// Write the chain state to disk, so that the coins db holds the whole set.
+	if err := disk.FlushStateToDisk(disk.FlushStateAlways, 0); err != nil {
+		return nil, err
+	}
+
+	cdb := utxo.GetUtxoCacheInstance().(*utxo.CoinsViewCache).GetCoinsDB()
+	stat, err := lchain.DumpTxOutSet(cdb, path)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+
+	return &btcjson.DumpTxOutSetResult{
+		CoinsWritten: stat.TxOutsCount,
+		BaseHash:     stat.BestBlock.String(),
+		BaseHeight:   stat.Height,
+		Path:         path,
+		TxOutSetHash: stat.HashSerialized.String(),
+		ChainTxCount: chain.GetInstance().GetIndex(int32(stat.Height)).ChainTxCount,
+	}, nil
 }
 
-func handlePruneBlockChain(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	/*	pruneMode, err := getPrunMode()
+// handleScrubBlockFiles implements the scrubblockfiles command.
+func handleScrubBlockFiles(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.ScrubBlockFilesCmd)
 
-		if err != nil && !pruneMode {
-			return false, &btcjson.RPCError{
-				Code:    btcjson.ErrRPCType,
-				Message: fmt.Sprintf("Cannot prune blocks because node is not in prune mode."),
-			}
+	report, err := disk.ScrubBlockFiles(*c.Quarantine, *c.Compact)
+	if err != nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCMisc, "Unable to scrub the block files: "+err.Error())
+	}
+
+	result := &btcjson.ScrubBlockFilesResult{
+		Files:        report.Files,
+		Blocks:       report.Blocks,
+		Undos:        report.Undos,
+		Unreferenced: report.Unreferenced,
+		Corrupt:      make([]btcjson.ScrubBlockFilesEntry, 0, len(report.Corrupt)),
+		Compacted:    report.Compacted,
+		Reclaimed:    report.Reclaimed,
+	}
+	for _, entry := range report.Corrupt {
+		item := btcjson.ScrubBlockFilesEntry{
+			File:        entry.File,
+			Pos:         entry.Pos,
+			Type:        "block",
+			Error:       entry.Err.Error(),
+			Quarantined: entry.Quarantined,
+		}
+		if entry.Undo {
+			item.Type = "undo"
 		}
+		if entry.Hash != nil {
+			item.BlockHash = entry.Hash.String()
+		}
+		result.Corrupt = append(result.Corrupt, item)
+	}
+	return result, nil
+}
 
-		c := cmd.(*btcjson.PruneBlockChainCmd)
-		height := c.Height
-		if *height < 0 {
-			return false, &btcjson.RPCError{
-				Code:    btcjson.ErrRPCType,
-				Message: fmt.Sprintf("Negative block height."),
-			}
+func handlePruneBlockChain(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if !disk.GetPruneState().PruneMode {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Cannot prune blocks because node is not in prune mode.",
 		}
+	}
 
-		if *height > 1000000000 {
-			index := chain.GetInstance().FindEarliestAtLeast(int64(*height - 72000))
-			if index != nil {
-				return false, &btcjson.RPCError{
-					Code:    btcjson.ErrRPCType,
-					Message: fmt.Sprintf("Could not find block with at least the specified timestamp."),
-				}
-			}
-			height = &index.Height
+	persist.CsMain.Lock()
+	defer persist.CsMain.Unlock()
+
+	c := cmd.(*btcjson.PruneBlockChainCmd)
+	if c.Height < 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Negative block height.",
 		}
+	}
 
-		h := *height
-		chainHeight := chain.GetInstance().Height()
-		if chainHeight < consensus.ActiveNetParams.PruneAfterHeight {
-			return false, &btcjson.RPCError{
-				Code:    btcjson.ErrRPCMisc,
-				Message: fmt.Sprintf("Blockchain is too short for pruning."),
-			}
-		} else if h > chainHeight {
-			return false, &btcjson.RPCError{
+	gChain := chain.GetInstance()
+	height := int32(c.Height)
+	if c.Height > 1000000000 {
+		// Add a 2 hour buffer to include blocks which might have had old
+		// timestamps
+		index := gChain.FindEarliestAtLeast(int64(c.Height) - 7200)
+		if index == nil {
+			return nil, &btcjson.RPCError{
 				Code:    btcjson.ErrRPCInvalidParameter,
-				Message: fmt.Sprintf("Blockchain is shorter than the attempted prune height."),
+				Message: "Could not find block with at least the specified timestamp.",
 			}
-		} /*else if h > chainHeight - MIN_BLOCKS_TO_KEEP {
-			h = chainHeight - MIN_BLOCKS_TO_KEEP
 		}
+		height = index.Height
+	}
+
+	chainHeight := gChain.Height()
+	if int(chainHeight) < gChain.GetParams().PruneAfterHeight {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Blockchain is too short for pruning.",
+		}
+	} else if height > chainHeight {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Blockchain is shorter than the attempted prune height.",
+		}
+	} else if height > chainHeight-block.MinBlocksToKeep {
+		log.Debug("Attempt to prune blocks close to the tip. Retaining the minimum number of blocks.")
+		height = chainHeight - block.MinBlocksToKeep
+	}
 
-		chain.PruneBlockFilesManual(*height)
-		return uint64(*height), nil*/ // todo realise
+	if err := disk.PruneBlockFilesManual(height); err != nil {
+		return nil, err
+	}
+	return height, nil
+}
 
-	return nil, nil
+// getPruneHeight returns the height of the lowest block of the active chain
+// from which on all block data is available.
+func getPruneHeight(tip *blockindex.BlockIndex) int32 {
+	index := tip
+	for index.Prev != nil && index.Prev.HasData() {
+		index = index.Prev
+	}
+	return index.Height
 }
 
 // handleVerifyChain implements the verifychain command.
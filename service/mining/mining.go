@@ -78,7 +78,14 @@ type BlockAssembler struct {
 	inBlock               map[util.Hash]struct{}
 	height                int32
 	lockTimeCutoff        int64
+	medianTimePast        int64
 	chainParams           *model.BitcoinParams
+
+	// The SigChecks of the block replace its sigops since the May 2020
+	// upgrade, when phononEnabled.
+	blockSigChecks             uint64
+	maxGeneratedBlockSigChecks uint64
+	phononEnabled              bool
 }
 
 func NewBlockAssembler(params *model.BitcoinParams) *BlockAssembler {
@@ -96,17 +103,21 @@ func (ba *BlockAssembler) resetBlockAssembler() {
 	// Reserve space for coinbase tx.
 	ba.blockSize = 1000
 	ba.blockSigOps = 100
+	ba.blockSigChecks = 100
 
 	// These counters do not include coinbase tx.
 	ba.blockTx = 0
 	ba.fees = 0
 }
 
-func (ba *BlockAssembler) testPackage(packageSize uint64, packageSigOps int64, add *tx.Tx) bool {
+func (ba *BlockAssembler) testPackage(packageSize uint64, packageSigOps, packageSigChecks int64, add *tx.Tx) bool {
 	blockSizeWithPackage := ba.blockSize + packageSize
 	if blockSizeWithPackage >= ba.maxGeneratedBlockSize {
 		return false
 	}
+	if ba.phononEnabled {
+		return ba.blockSigChecks+uint64(packageSigChecks) < ba.maxGeneratedBlockSigChecks
+	}
 	maxSigOps, errSig := consensus.GetMaxBlockSigOpsCount(blockSizeWithPackage)
 	if errSig != nil {
 		log.Error("testPackage err :%v", errSig)
@@ -125,6 +136,7 @@ func (ba *BlockAssembler) addToBlock(te *mempool.TxEntry) {
 	ba.blockSize += uint64(te.TxSize)
 	ba.blockTx++
 	ba.blockSigOps += uint64(te.SigOpCount)
+	ba.blockSigChecks += uint64(te.SigChecks)
 	ba.fees += amount.Amount(te.TxFee)
 	ba.inBlock[te.Tx.GetHash()] = struct{}{}
 }
@@ -230,6 +242,7 @@ func (ba *BlockAssembler) addPackageTxs(sortRecord map[util.Hash]int) int {
 		packageSize := entry.SumTxSizeWitAncestors
 		packageFee := entry.SumTxFeeWithAncestors
 		packageSigOps := entry.SumTxSigOpCountWithAncestors
+		packageSigChecks := entry.SumTxSigChecksWithAncestors
 
 		// deal with several different mining strategies
 		isEnd := false
@@ -250,7 +263,7 @@ func (ba *BlockAssembler) addPackageTxs(sortRecord map[util.Hash]int) int {
 			break
 		}
 
-		if !ba.testPackage(uint64(packageSize), packageSigOps, nil) {
+		if !ba.testPackage(uint64(packageSize), packageSigOps, packageSigChecks, nil) {
 			consecutiveFailed++
 			if consecutiveFailed > maxConsecutiveFailures &&
 				ba.blockSize > ba.maxGeneratedBlockSize-1000 {
@@ -331,6 +344,9 @@ func (ba *BlockAssembler) CreateNewBlock(scriptPubKey, scriptSig *script.Script)
 	}
 	ba.bt.Block.Header.Time = uint32(util.GetAdjustedTimeSec())
 	ba.maxGeneratedBlockSize = computeMaxGeneratedBlockSize()
+	ba.maxGeneratedBlockSigChecks = consensus.GetMaxBlockSigChecksCount(ba.maxGeneratedBlockSize)
+	ba.medianTimePast = indexPrev.GetMedianTimePast()
+	ba.phononEnabled = model.IsPhononEnabled(ba.medianTimePast)
 	lockTimeCutoff := indexPrev.GetMedianTimePast()
 	if tx.StandardLockTimeVerifyFlags&consensus.LocktimeMedianTimePast != 0 {
 		ba.lockTimeCutoff = lockTimeCutoff
@@ -369,9 +385,10 @@ func (ba *BlockAssembler) CreateNewBlock(scriptPubKey, scriptSig *script.Script)
 	outPoint := outpoint.OutPoint{Hash: util.HashZero, Index: 0xffffffff}
 
 	coinbaseTx.AddTxIn(txin.NewTxIn(&outPoint, scriptSig, 0xffffffff))
-	coinbaseSerializeSize := coinbaseTx.SerializeSize()
-	if coinbaseSerializeSize < consensus.MinTxSize {
-		byteLen := consensus.MinTxSize - coinbaseSerializeSize - 1
+	// Pad the coinbase up to the minimum transaction size of the new block.
+	coinbaseSerializeSize := int(coinbaseTx.SerializeSize())
+	if minTxSize := ba.chainParams.MinTxSize(ba.medianTimePast); coinbaseSerializeSize < minTxSize {
+		byteLen := minTxSize - coinbaseSerializeSize - 1
 		scriptSig.PushData(make([]byte, byteLen))
 	}
 
@@ -383,8 +400,8 @@ func (ba *BlockAssembler) CreateNewBlock(scriptPubKey, scriptSig *script.Script)
 	ba.bt.TxFees[0] = -1 * ba.fees // coinbase's fee item is equal to tx fee sum for negative value
 
 	serializeSize := ba.bt.Block.SerializeSize()
-	log.Info("CreateNewBlock(): total size: %d txs: %d fees: %d sigops %d\n",
-		serializeSize, ba.blockTx, ba.fees, ba.blockSigOps)
+	log.Info("CreateNewBlock(): total size: %d txs: %d fees: %d sigops %d sigchecks %d\n",
+		serializeSize, ba.blockTx, ba.fees, ba.blockSigOps, ba.blockSigChecks)
 
 	// Fill in header.
 	if indexPrev == nil {
@@ -426,14 +443,19 @@ func (ba *BlockAssembler) onlyUnconfirmed(entryList []*mempool.TxEntry) []*mempo
 // Perform transaction-level checks before adding to block:
 // - transaction finality (locktime)
 // - serialized size (in case -blockmaxsize is in use)
+// - SigChecks (mempool entries may predate the May 2020 upgrade)
 func (ba *BlockAssembler) testPackageTransactions(entrySet []*mempool.TxEntry) bool {
 	potentialBlockSize := ba.blockSize
 	for _, entry := range entrySet {
-		err := ltx.ContextualCheckTransaction(entry.Tx, ba.height, ba.lockTimeCutoff, ba.lockTimeCutoff)
+		err := ltx.ContextualCheckTransaction(entry.Tx, ba.height, ba.lockTimeCutoff, ba.medianTimePast)
 		if err != nil {
 			return false
 		}
 
+		if ba.phononEnabled && entry.SigChecks > consensus.MaxTxSigChecks {
+			return false
+		}
+
 		if potentialBlockSize+uint64(entry.TxSize) >= ba.maxGeneratedBlockSize {
 			return false
 		}
@@ -465,6 +487,7 @@ func (ba *BlockAssembler) updatePackagesForAdded(txSet mapcontainer.MapContainer
 				item.SumTxSizeWitAncestors -= entry.SumTxSizeWitAncestors
 				item.SumTxFeeWithAncestors -= entry.SumTxFeeWithAncestors
 				item.SumTxSigOpCountWithAncestors -= entry.SumTxSigOpCountWithAncestors
+				item.SumTxSigChecksWithAncestors -= entry.SumTxSigChecksWithAncestors
 				// insert the modified one
 				txSet.ReplaceOrInsert(item)
 			case sortByFeeRate:
@@ -475,6 +498,7 @@ func (ba *BlockAssembler) updatePackagesForAdded(txSet mapcontainer.MapContainer
 				item.SumTxSizeWitAncestors -= entry.SumTxSizeWitAncestors
 				item.SumTxFeeWithAncestors -= entry.SumTxFeeWithAncestors
 				item.SumTxSigOpCountWithAncestors -= entry.SumTxSigOpCountWithAncestors
+				item.SumTxSigChecksWithAncestors -= entry.SumTxSigChecksWithAncestors
 				// insert the modified one
 				txSet.ReplaceOrInsert(item)
 			}
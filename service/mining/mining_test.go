@@ -12,6 +12,7 @@ import (
 	"github.com/copernet/copernicus/logic/ltx"
 	"github.com/copernet/copernicus/model"
 	"github.com/copernet/copernicus/model/chain"
+	"github.com/copernet/copernicus/model/consensus"
 	"github.com/copernet/copernicus/model/mempool"
 	"github.com/copernet/copernicus/model/opcodes"
 	"github.com/copernet/copernicus/model/outpoint"
@@ -148,6 +149,7 @@ type TestMemPoolEntry struct {
 	Height         int32
 	SpendsCoinbase bool
 	SigOpCost      int
+	SigChecks      int
 	lp             *mempool.LockPoints
 }
 
@@ -159,6 +161,7 @@ func NewTestMemPoolEntry() *TestMemPoolEntry {
 	t.Height = 1
 	t.SpendsCoinbase = false
 	t.SigOpCost = 4
+	t.SigChecks = 1
 	t.lp = nil
 	return &t
 }
@@ -188,12 +191,17 @@ func (t *TestMemPoolEntry) SetSigOpsCost(sigOpsCost int) *TestMemPoolEntry {
 	return t
 }
 
+func (t *TestMemPoolEntry) SetSigChecks(sigChecks int) *TestMemPoolEntry {
+	t.SigChecks = sigChecks
+	return t
+}
+
 func (t *TestMemPoolEntry) FromTxToEntry(transaction *tx.Tx) *mempool.TxEntry {
 	lp := mempool.LockPoints{}
 	if t.lp != nil {
 		lp = *(t.lp)
 	}
-	entry := mempool.NewTxentry(transaction, int64(t.Fee), t.Time, t.Height, lp, int(t.SigOpCost), t.SpendsCoinbase)
+	entry := mempool.NewTxentry(transaction, int64(t.Fee), t.Time, t.Height, lp, int(t.SigOpCost), t.SigChecks, t.SpendsCoinbase)
 	return entry
 }
 
@@ -475,3 +483,52 @@ func TestCreateNewBlockByFeeRate(t *testing.T) {
 		t.Error("some transactions are inserted to block error")
 	}
 }
+
+func TestCreateNewBlockPadsCoinbaseToMinTxSize(t *testing.T) {
+	// clear chain data of last test case
+	gChain := chain.GetInstance()
+	*gChain = *chain.NewChain()
+
+	tempDir, err := initTestEnv(t, false)
+	assert.Nil(t, err)
+	defer os.RemoveAll(tempDir)
+
+	pubKey := script.NewEmptyScript()
+	pubKey.PushOpCode(opcodes.OP_TRUE)
+	_, err = generateBlocks(pubKey, 1, 1000000)
+	assert.Nil(t, err)
+
+	params := model.ActiveNetParams
+	upgrade9 := params.Upgrade9ActivationTime
+	defer func() { params.Upgrade9ActivationTime = upgrade9 }()
+
+	for _, activation := range []int64{math.MaxInt64, upgrade9} {
+		params.Upgrade9ActivationTime = activation
+		minTxSize := params.MinTxSize(gChain.Tip().GetMedianTimePast())
+
+		ba := NewBlockAssembler(params)
+		bt := ba.CreateNewBlock(pubKey, CoinbaseScriptSig(0))
+		assert.NotNil(t, bt)
+		assert.True(t, int(bt.Block.Txs[0].SerializeSize()) >= minTxSize)
+		assert.True(t, int(bt.Block.Txs[0].SerializeSize()) < minTxSize+consensus.MinTxSizeUpgrade9)
+	}
+}
+
+func TestTestPackageSigChecks(t *testing.T) {
+	ba := &BlockAssembler{
+		maxGeneratedBlockSize:      consensus.OneMegaByte,
+		blockSize:                  1000,
+		blockSigChecks:             100,
+		maxGeneratedBlockSigChecks: 1000,
+		phononEnabled:              true,
+	}
+
+	// After the May 2020 upgrade, the SigChecks limit the package instead
+	// of the legacy sigops.
+	assert.True(t, ba.testPackage(1000, consensus.MaxBlockSigopsPerMb, 899, nil))
+	assert.False(t, ba.testPackage(1000, 0, 900, nil))
+
+	ba.phononEnabled = false
+	assert.True(t, ba.testPackage(1000, 0, 900, nil))
+	assert.False(t, ba.testPackage(1000, consensus.MaxBlockSigopsPerMb, 0, nil))
+}
@@ -10,6 +10,7 @@ import (
 	"sync"
 
 	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
 	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/net/wire"
 	"github.com/copernet/copernicus/util"
@@ -252,22 +253,32 @@ func (bf *Filter) AddOutPoint(outpoint *outpoint.OutPoint) {
 // script.
 //
 // This function MUST be called with the filter lock held.
-func (bf *Filter) maybeAddOutpoint(outHash *util.Hash, outIdx uint32) {
-
-	// switch bf.msgFilterLoad.Flags {
-	// case wire.BloomUpdateAll:
-	// 	outpoint := outpoint.NewOutPoint(*outHash, outIdx)
-	// 	bf.addOutPoint(outpoint)
-	// case wire.BloomUpdateP2PubkeyOnly:
-	// 	var sc *script.Script
-	// 	class, err := sc.IsStandardScriptPubKey()
-	// 	if err != nil {
-	// 		errors.New("The script not standard...")
-	// 	} else if class == script.ScriptPubkey || class == script.ScriptMultiSig {
-	// 		outpoint := outpoint.NewOutPoint(*outHash, outIdx)
-	// 		bf.addOutPoint(outpoint)
-	// 	}
-	// }
+func (bf *Filter) maybeAddOutpoint(pkScript *script.Script, outHash *util.Hash, outIdx uint32) {
+	switch bf.msgFilterLoad.Flags {
+	case wire.BloomUpdateAll:
+		bf.addOutPoint(outpoint.NewOutPoint(*outHash, outIdx))
+	case wire.BloomUpdateP2PubkeyOnly:
+		class, _, _ := pkScript.IsStandardScriptPubKey()
+		if class == script.ScriptPubkey || class == script.ScriptMultiSig {
+			bf.addOutPoint(outpoint.NewOutPoint(*outHash, outIdx))
+		}
+	}
+}
+
+// matchesPushedData returns true if the bloom filter matches the data pushed
+// by any of the opcodes of the passed script.
+//
+// This function MUST be called with the filter lock held.
+func (bf *Filter) matchesPushedData(sc *script.Script) bool {
+	if sc == nil {
+		return false
+	}
+	for _, op := range sc.ParsedOpCodes {
+		if len(op.Data) != 0 && bf.matches(op.Data) {
+			return true
+		}
+	}
+	return false
 }
 
 // matchTxAndUpdate returns true if the bloom filter matches data within the
@@ -277,11 +288,14 @@ func (bf *Filter) maybeAddOutpoint(outHash *util.Hash, outIdx uint32) {
 //
 // This function MUST be called with the filter lock held.
 func (bf *Filter) matchTxAndUpdate(tx *tx.Tx) bool {
+	if bf.msgFilterLoad == nil {
+		return false
+	}
+
 	// Check if the filter matches the hash of the transaction.
 	// This is useful for finding transactions when they appear in a block.
-
-	// txHash := tx.GetHash()
-	// matched := bf.matches(txHash[:])
+	txHash := tx.GetHash()
+	matched := bf.matches(txHash[:])
 
 	// Check if the filter matches any data elements in the public key
 	// scripts of any of the outputs.  When it does, add the outpoint that
@@ -291,51 +305,34 @@ func (bf *Filter) matchTxAndUpdate(tx *tx.Tx) bool {
 	// on the network since it avoids the need for another filteradd message
 	// from the client and avoids some potential races that could otherwise
 	// occur.
+	for i, txOut := range tx.GetOuts() {
+		pkScript := txOut.GetScriptPubKey()
+		if !bf.matchesPushedData(pkScript) {
+			continue
+		}
 
-	//for i, txOut := range tx.GetOuts() {
-	//	pushedData, err := script.PushedData(txOut.GetScriptPubKey())
-	//	if err != nil {
-	//		continue
-	//	}
-	//
-	//	for _, data := range pushedData {
-	//		if !bf.matches(data) {
-	//			continue
-	//		}
-	//
-	//		matched = true
-	//		hash := tx.GetHash()
-	//		bf.maybeAddOutpoint(&hash, uint32(i))
-	//		break
-	//	}
-	//}
+		matched = true
+		bf.maybeAddOutpoint(pkScript, &txHash, uint32(i))
+	}
 
 	// Nothing more to do if a match has already been made.
-	// if matched {
-	// 	return true
-	// }
+	if matched {
+		return true
+	}
 
 	// At this point, the transaction and none of the data elements in the
 	// public key scripts of its outputs matched.
 
 	// Check if the filter matches any outpoints this transaction spends or
 	// any any data elements in the signature scripts of any of the inputs.
-
-	//for _, txin := range tx.GetIns() {
-	//	if bf.matchesOutPoint(txin.PreviousOutPoint) {
-	//		return true
-	//	}
-	//
-	//	pushedData, err := script.PushedData(txin.GetScriptSig())
-	//	if err != nil {
-	//		continue
-	//	}
-	//	for _, data := range pushedData {
-	//		if bf.matches(data) {
-	//			return true
-	//		}
-	//	}
-	//}
+	for _, txIn := range tx.GetIns() {
+		if bf.matchesOutPoint(txIn.PreviousOutPoint) {
+			return true
+		}
+		if bf.matchesPushedData(txIn.GetScriptSig()) {
+			return true
+		}
+	}
 
 	return false
 }
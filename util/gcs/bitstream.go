@@ -0,0 +1,103 @@
+package gcs
+
+import (
+	"errors"
+)
+
+// errStreamEnd is returned when reading past the end of a bit stream.
+var errStreamEnd = errors.New("unexpected end of bit stream")
+
+// bitWriter appends bits to a byte slice, most significant bit first.
+type bitWriter struct {
+	data []byte
+	// free is the number of unused bits of the last byte.
+	free uint8
+}
+
+// writeBit appends a single bit.
+func (w *bitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.data = append(w.data, 0)
+		w.free = 8
+	}
+	w.free--
+	if bit {
+		w.data[len(w.data)-1] |= 1 << w.free
+	}
+}
+
+// writeBits appends the nbits low bits of value, most significant first.
+func (w *bitWriter) writeBits(value uint64, nbits uint8) {
+	for nbits > 0 {
+		nbits--
+		w.writeBit(value&(1<<nbits) != 0)
+	}
+}
+
+// bytes returns the written bits, the last byte is padded with zeros.
+func (w *bitWriter) bytes() []byte {
+	return w.data
+}
+
+// bitReader reads the bits of a byte slice, most significant bit first.
+type bitReader struct {
+	data []byte
+	// pos is the index of the next bit to read.
+	pos uint64
+}
+
+// readBit reads a single bit.
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= uint64(len(r.data))*8 {
+		return false, errStreamEnd
+	}
+	bit := r.data[r.pos/8]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+// readBits reads nbits bits into an integer, most significant first.
+func (r *bitReader) readBits(nbits uint8) (uint64, error) {
+	var value uint64
+	for i := uint8(0); i < nbits; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		value <<= 1
+		if bit {
+			value |= 1
+		}
+	}
+	return value, nil
+}
+
+// writeGolombRice encodes value with the Golomb-Rice parameter p: the
+// quotient in unary, then the p low bits of the remainder.
+func (w *bitWriter) writeGolombRice(value uint64, p uint8) {
+	for q := value >> p; q > 0; q-- {
+		w.writeBit(true)
+	}
+	w.writeBit(false)
+	w.writeBits(value, p)
+}
+
+// readGolombRice decodes a value encoded by writeGolombRice.
+func (r *bitReader) readGolombRice(p uint8) (uint64, error) {
+	var q uint64
+	for {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		q++
+	}
+	remainder, err := r.readBits(p)
+	if err != nil {
+		return 0, err
+	}
+	return q<<p | remainder, nil
+}
@@ -0,0 +1,81 @@
+package gcs
+
+import (
+	"fmt"
+
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/undo"
+	"github.com/copernet/copernicus/util"
+)
+
+const (
+	// BasicFilterP is the Golomb-Rice parameter of the basic block filters.
+	BasicFilterP = 19
+
+	// BasicFilterM is the inverse of the false positive rate of the basic
+	// block filters.
+	BasicFilterM = 784931
+)
+
+// DeriveKey returns the SipHash key of the filter of a block, the first bytes
+// of its hash.
+func DeriveKey(blockHash *util.Hash) [KeySize]byte {
+	var key [KeySize]byte
+	copy(key[:], blockHash[:KeySize])
+	return key
+}
+
+// BuildBasicFilter builds the basic filter of a block (BIP0158), from the
+// scriptPubKeys of its outputs and of the coins it spends, read from its undo
+// data.  Empty and OP_RETURN scripts are left out.
+func BuildBasicFilter(blk *block.Block, blockUndo *undo.BlockUndo) (*Filter, error) {
+	txUndos := blockUndo.GetTxundo()
+	if len(txUndos)+1 != len(blk.Txs) {
+		return nil, fmt.Errorf("undo data of block %s is inconsistent", blk.GetHash())
+	}
+
+	seen := make(map[string]struct{})
+	var items [][]byte
+	addItem := func(data []byte) {
+		if len(data) == 0 || data[0] == opcodes.OP_RETURN {
+			return
+		}
+		if _, ok := seen[string(data)]; ok {
+			return
+		}
+		seen[string(data)] = struct{}{}
+		items = append(items, data)
+	}
+
+	for _, txn := range blk.Txs {
+		for _, out := range txn.GetOuts() {
+			addItem(out.GetScriptPubKey().GetData())
+		}
+	}
+	for _, txUndo := range txUndos {
+		for _, coin := range txUndo.GetUndoCoins() {
+			addItem(coin.GetScriptPubKey().GetData())
+		}
+	}
+
+	blockHash := blk.GetHash()
+	return BuildGCSFilter(BasicFilterP, BasicFilterM, DeriveKey(&blockHash), items)
+}
+
+// MakeHeaderForFilter returns the header of a filter, which commits to the
+// filter and to the header of the filter of the previous block.  The previous
+// header of the genesis block is zero.
+func MakeHeaderForFilter(filter *Filter, prevHeader *util.Hash) util.Hash {
+	filterHash := util.DoubleSha256Hash(filter.NBytes())
+	return MakeHeaderForFilterHash(&filterHash, prevHeader)
+}
+
+// MakeHeaderForFilterHash returns the header of a filter from its hash, as
+// filters are summarized in cfheaders messages.
+func MakeHeaderForFilterHash(filterHash *util.Hash, prevHeader *util.Hash) util.Hash {
+	buf := make([]byte, 0, 2*util.Hash256Size)
+	buf = append(buf, filterHash[:]...)
+	buf = append(buf, prevHeader[:]...)
+	return util.DoubleSha256Hash(buf)
+}
@@ -0,0 +1,178 @@
+// Package gcs implements the Golomb-coded sets of BIP0158. A set of items is
+// hashed to integers, which are sorted and Golomb-Rice encoded as deltas, so
+// that a filter is much smaller than a bloom filter with the same false
+// positive rate.
+package gcs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+
+	"github.com/copernet/copernicus/util"
+)
+
+const (
+	// KeySize is the size of the SipHash key of a filter.
+	KeySize = 16
+
+	// MaxElements is the maximum number of items of a filter.
+	MaxElements = 1<<32 - 1
+)
+
+var (
+	// ErrNTooBig is returned when building a filter with too many items.
+	ErrNTooBig = errors.New("N is too big to fit in uint32")
+
+	// ErrPTooBig is returned when the Golomb-Rice parameter is too big.
+	ErrPTooBig = errors.New("P is too big, the maximum is 32")
+)
+
+// Filter is an immutable Golomb-coded set.
+type Filter struct {
+	n      uint32
+	p      uint8
+	m      uint64
+	modulo uint64
+	data   []byte
+}
+
+// hashItem maps an item uniformly to [0, modulo).
+func hashItem(k0, k1 uint64, item []byte, modulo uint64) uint64 {
+	hash := util.NewSipHasher(k0, k1).Write(item).Finalize()
+	value, _ := bits.Mul64(hash, modulo)
+	return value
+}
+
+func sipKeys(key [KeySize]byte) (uint64, uint64) {
+	return binary.LittleEndian.Uint64(key[0:8]), binary.LittleEndian.Uint64(key[8:16])
+}
+
+// BuildGCSFilter builds a filter of the items with the Golomb-Rice parameter
+// p, a false positive rate of 1/m and the SipHash key.  The items should be
+// distinct.
+func BuildGCSFilter(p uint8, m uint64, key [KeySize]byte, items [][]byte) (*Filter, error) {
+	if uint64(len(items)) > MaxElements {
+		return nil, ErrNTooBig
+	}
+	if p > 32 {
+		return nil, ErrPTooBig
+	}
+
+	f := &Filter{
+		n:      uint32(len(items)),
+		p:      p,
+		m:      m,
+		modulo: uint64(len(items)) * m,
+	}
+
+	k0, k1 := sipKeys(key)
+	values := make([]uint64, 0, len(items))
+	for _, item := range items {
+		values = append(values, hashItem(k0, k1, item, f.modulo))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	var w bitWriter
+	var last uint64
+	for _, value := range values {
+		w.writeGolombRice(value-last, p)
+		last = value
+	}
+	f.data = w.bytes()
+	return f, nil
+}
+
+// FromBytes returns the filter of n items encoded in data.
+func FromBytes(n uint32, p uint8, m uint64, data []byte) (*Filter, error) {
+	if p > 32 {
+		return nil, ErrPTooBig
+	}
+	return &Filter{
+		n:      n,
+		p:      p,
+		m:      m,
+		modulo: uint64(n) * m,
+		data:   data,
+	}, nil
+}
+
+// FromNBytes returns the filter serialized by NBytes.
+func FromNBytes(p uint8, m uint64, data []byte) (*Filter, error) {
+	buf := bytes.NewReader(data)
+	n, err := util.ReadVarInt(buf)
+	if err != nil {
+		return nil, err
+	}
+	if n > MaxElements {
+		return nil, ErrNTooBig
+	}
+	return FromBytes(uint32(n), p, m, data[len(data)-buf.Len():])
+}
+
+// N returns the number of items of the filter.
+func (f *Filter) N() uint32 {
+	return f.n
+}
+
+// P returns the Golomb-Rice parameter of the filter.
+func (f *Filter) P() uint8 {
+	return f.p
+}
+
+// Bytes returns the encoded items of the filter.
+func (f *Filter) Bytes() []byte {
+	return f.data
+}
+
+// NBytes returns the number of items as a var int followed by the encoded
+// items, as block filters are serialized.
+func (f *Filter) NBytes() []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, int(util.VarIntSerializeSize(uint64(f.n)))+len(f.data)))
+	util.WriteVarInt(buf, uint64(f.n))
+	buf.Write(f.data)
+	return buf.Bytes()
+}
+
+// Match reports whether the item is likely in the filter.
+func (f *Filter) Match(key [KeySize]byte, item []byte) (bool, error) {
+	return f.MatchAny(key, [][]byte{item})
+}
+
+// MatchAny reports whether any of the items is likely in the filter.
+func (f *Filter) MatchAny(key [KeySize]byte, items [][]byte) (bool, error) {
+	if f.n == 0 || len(items) == 0 {
+		return false, nil
+	}
+
+	k0, k1 := sipKeys(key)
+	targets := make([]uint64, 0, len(items))
+	for _, item := range items {
+		targets = append(targets, hashItem(k0, k1, item, f.modulo))
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i] < targets[j] })
+
+	r := bitReader{data: f.data}
+	var value uint64
+	for i := uint32(0); i < f.n; i++ {
+		delta, err := r.readGolombRice(f.p)
+		if err != nil {
+			return false, fmt.Errorf("item #%d of the filter: %v", i, err)
+		}
+		value += delta
+
+		for len(targets) > 0 && targets[0] < value {
+			targets = targets[1:]
+		}
+		if len(targets) == 0 {
+			return false, nil
+		}
+		if targets[0] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,165 @@
+package gcs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/undo"
+	"github.com/copernet/copernicus/util"
+)
+
+var testKey = [KeySize]byte{0x4c, 0xb1, 0xab, 0x12, 0x57, 0x62, 0x1e, 0x41,
+	0x3b, 0x8b, 0x0e, 0x26, 0x64, 0x8d, 0x4a, 0x15}
+
+func testItems(prefix string, n int) [][]byte {
+	items := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		items = append(items, []byte(fmt.Sprintf("%s%d", prefix, i)))
+	}
+	return items
+}
+
+func TestBitStream(t *testing.T) {
+	var w bitWriter
+	values := []uint64{0, 1, 2, 7, 8, 100, 1 << 20}
+	for _, value := range values {
+		w.writeGolombRice(value, 2)
+	}
+	w.writeBits(0x5, 3)
+
+	r := bitReader{data: w.bytes()}
+	for _, want := range values {
+		value, err := r.readGolombRice(2)
+		if err != nil {
+			t.Fatalf("readGolombRice: %v", err)
+		}
+		if value != want {
+			t.Errorf("readGolombRice: got %d, want %d", value, want)
+		}
+	}
+	if value, err := r.readBits(3); err != nil || value != 0x5 {
+		t.Errorf("readBits: got %d %v, want 5", value, err)
+	}
+
+	// 0 is encoded as 0 00, 5 as 10 01.
+	w = bitWriter{}
+	w.writeGolombRice(0, 2)
+	w.writeGolombRice(5, 2)
+	if !bytes.Equal(w.bytes(), []byte{0x12}) {
+		t.Errorf("encoding: got %x, want 12", w.bytes())
+	}
+
+	r = bitReader{data: []byte{0xff}}
+	if _, err := r.readGolombRice(2); err != errStreamEnd {
+		t.Errorf("reading past the end: got %v, want %v", err, errStreamEnd)
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	items := testItems("item", 200)
+	f, err := BuildGCSFilter(BasicFilterP, BasicFilterM, testKey, items)
+	if err != nil {
+		t.Fatalf("BuildGCSFilter: %v", err)
+	}
+	if f.N() != uint32(len(items)) {
+		t.Fatalf("N: got %d, want %d", f.N(), len(items))
+	}
+
+	for _, item := range items {
+		match, err := f.Match(testKey, item)
+		if err != nil || !match {
+			t.Errorf("item %s not matched: %v", item, err)
+		}
+	}
+
+	others := testItems("other", 200)
+	for _, item := range others {
+		if match, _ := f.Match(testKey, item); match {
+			t.Errorf("unexpected match of %s", item)
+		}
+	}
+	if match, _ := f.MatchAny(testKey, others); match {
+		t.Errorf("unexpected match of other items")
+	}
+	if match, _ := f.MatchAny(testKey, append(others, items[150])); !match {
+		t.Errorf("item %s not matched by MatchAny", items[150])
+	}
+
+	// Another key gives another filter.
+	otherKey := testKey
+	otherKey[0]++
+	if match, _ := f.MatchAny(otherKey, items); match {
+		t.Errorf("items matched with another key")
+	}
+}
+
+func TestFilterSerialization(t *testing.T) {
+	f, err := BuildGCSFilter(BasicFilterP, BasicFilterM, testKey, testItems("item", 300))
+	if err != nil {
+		t.Fatalf("BuildGCSFilter: %v", err)
+	}
+	nBytes := f.NBytes()
+	if !bytes.Equal(nBytes[:3], []byte{0xfd, 0x2c, 0x01}) {
+		t.Errorf("serialized N: got %x, want fd2c01", nBytes[:3])
+	}
+
+	f2, err := FromNBytes(BasicFilterP, BasicFilterM, nBytes)
+	if err != nil {
+		t.Fatalf("FromNBytes: %v", err)
+	}
+	if f2.N() != f.N() || !bytes.Equal(f2.Bytes(), f.Bytes()) {
+		t.Fatalf("deserialized filter mismatch")
+	}
+	if match, _ := f2.Match(testKey, []byte("item42")); !match {
+		t.Errorf("item not matched by the deserialized filter")
+	}
+
+	empty, err := BuildGCSFilter(BasicFilterP, BasicFilterM, testKey, nil)
+	if err != nil {
+		t.Fatalf("BuildGCSFilter: %v", err)
+	}
+	if !bytes.Equal(empty.NBytes(), []byte{0}) {
+		t.Errorf("empty filter: got %x, want 00", empty.NBytes())
+	}
+	if match, _ := empty.Match(testKey, []byte("item0")); match {
+		t.Errorf("empty filter matched an item")
+	}
+
+	if _, err := FromNBytes(BasicFilterP, BasicFilterM, nil); err == nil {
+		t.Errorf("FromNBytes accepted an empty slice")
+	}
+}
+
+// TestBasicFilterGenesis checks the basic filter and filter header of the
+// testnet genesis block against the BIP0158 test vectors.
+func TestBasicFilterGenesis(t *testing.T) {
+	genesis := block.NewTestNetGenesisBlock()
+	f, err := BuildBasicFilter(genesis, undo.NewBlockUndo(0))
+	if err != nil {
+		t.Fatalf("BuildBasicFilter: %v", err)
+	}
+	if got := hex.EncodeToString(f.NBytes()); got != "019dfca8" {
+		t.Errorf("filter: got %s, want 019dfca8", got)
+	}
+
+	header := MakeHeaderForFilter(f, &util.Hash{})
+	want := "21584579b7eb08997773e5aeff3a7f932700042d0ed2a6129012b7d7ae81b750"
+	if header.String() != want {
+		t.Errorf("filter header: got %s, want %s", header, want)
+	}
+
+	genesisHash := genesis.GetHash()
+	script := genesis.Txs[0].GetOuts()[0].GetScriptPubKey().GetData()
+	if match, _ := f.Match(DeriveKey(&genesisHash), script); !match {
+		t.Errorf("coinbase output not matched")
+	}
+
+	inconsistent := &block.Block{Header: genesis.Header, Txs: []*tx.Tx{genesis.Txs[0], genesis.Txs[0]}}
+	if _, err := BuildBasicFilter(inconsistent, undo.NewBlockUndo(0)); err == nil {
+		t.Errorf("BuildBasicFilter accepted inconsistent undo data")
+	}
+}